@@ -0,0 +1,63 @@
+package raft
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAcknowledgement(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		opts []OptFn
+	}{
+		{name: "unbatched"},
+		{name: "batched", opts: []OptFn{WithProposalBatching(8, time.Millisecond)}},
+	} {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			// apply blocks until released
+			release := make(chan struct{})
+			fsm := &listFSM{}
+			apply := func(commands Commands) (int, error) {
+				<-release
+				return fsm.apply(commands)
+			}
+			id := RaftId("ack-" + c.name)
+			r, err := New(id, RaftAddr(id), apply, nil, nil, append([]OptFn{WithDevMode()}, c.opts...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Stop()
+			go r.Run()
+			ctx := context.Background()
+
+			err = r.Handle(WithAcknowledgement(ctx, AckCommitted), Command("a"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			status := r.Stats()
+			if status.CommitIndex != status.LastLogIndex || status.LastApplied >= status.CommitIndex {
+				t.Fatalf("expect committed but not applied but got commit index %d, last applied %d, last log index %d",
+					status.CommitIndex, status.LastApplied, status.LastLogIndex)
+			}
+
+			applied := make(chan error, 1)
+			go func() {
+				applied <- r.Handle(ctx, Command("b"))
+			}()
+			select {
+			case err := <-applied:
+				t.Fatalf("expect waiting for apply but got %v", err)
+			case <-time.After(20 * time.Millisecond):
+			}
+			close(release)
+			if err := <-applied; err != nil {
+				t.Fatal(err)
+			}
+			if got := fsm.items; len(got) != 2 || got[0] != "a" || got[1] != "b" {
+				t.Fatalf("expect [a b] applied but got %v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+// Package admin raft 的 http 管理接口
+//
+//	http.Handle("/raft/", http.StripPrefix("/raft", admin.NewHandler(r)))
+//
+// 接口:
+//
+//	GET /status                 状态快照(raft.Status)
+//	GET /status/watch?interval= 状态变化时推送最新的状态快照, 每行一个 json 对象
+//	GET /leadership/history     本节点观察到的 leadership 变化记录
+//	POST /leadership/transfer?target= 将 leadership 转移给 target
+//	GET /peers/quarantine       本节点隔离的 peer
+//	POST /peers/quarantine?id=  隔离 peer id
+//	DELETE /peers/quarantine?id= 解除对 peer id 的隔离
+//
+// 本节点不是 Leader 时返回 409, 若知道 Leader, 响应头 X-Raft-Leader 为其地址.
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/mind1949/raft"
+)
+
+// HeaderLeader 非 Leader 拒绝请求时, 携带已知 Leader 地址的响应头
+const HeaderLeader = "X-Raft-Leader"
+
+// defaultWatchInterval 检查状态变化的默认间隔
+const defaultWatchInterval = 100 * time.Millisecond
+
+// NewHandler 创建 raft 的 http 管理接口
+func NewHandler(r raft.Raft) *Handler {
+	h := &Handler{
+		raft: r,
+		mux:  http.NewServeMux(),
+	}
+	h.mux.HandleFunc("/status", h.status)
+	h.mux.HandleFunc("/status/watch", h.watchStatus)
+	h.mux.HandleFunc("/leadership/history", h.leadershipHistory)
+	h.mux.HandleFunc("/leadership/transfer", h.transferLeadership)
+	h.mux.HandleFunc("/peers/quarantine", h.quarantine)
+	return h
+}
+
+var _ http.Handler = (*Handler)(nil)
+
+// Handler raft 的 http 管理接口
+type Handler struct {
+	raft raft.Raft
+	mux  *http.ServeMux
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) status(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.raft.Stats())
+}
+
+func (h *Handler) leadershipHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.raft.LeadershipHistory())
+}
+
+func (h *Handler) transferLeadership(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	target := raft.RaftId(r.URL.Query().Get("target"))
+	if target == "" {
+		http.Error(w, "missing target", http.StatusBadRequest)
+		return
+	}
+	err := h.raft.TransferLeadership(r.Context(), target)
+	if errors.Is(err, raft.ErrIsNotLeader) {
+		var notLeader *raft.NotLeaderError
+		if errors.As(err, &notLeader) {
+			w.Header().Set(HeaderLeader, string(notLeader.Leader.Addr))
+		}
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// quarantine 查看, 隔离或解除隔离 peer
+func (h *Handler) quarantine(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h.raft.Quarantined())
+		return
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	id := raft.RaftId(r.URL.Query().Get("id"))
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		h.raft.Unquarantine(id)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	err := h.raft.Quarantine(id)
+	if errors.Is(err, raft.ErrQuarantineSelf) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// statusChanged 状态是否变化
+// 忽略随心跳与 apply 不断变化的联系时间与耗时统计, 否则每次轮询都会推送
+func statusChanged(pre, status raft.Status) bool {
+	return !reflect.DeepEqual(stableStatus(pre), stableStatus(status))
+}
+
+// stableStatus 去掉 status 中不断变化的字段
+func stableStatus(status raft.Status) raft.Status {
+	status.LastContact = time.Time{}
+	status.Apply = raft.ApplyStatus{}
+	replication := make([]raft.ReplicationStatus, len(status.Replication))
+	for i, peer := range status.Replication {
+		peer.LastContact = time.Time{}
+		replication[i] = peer
+	}
+	status.Replication = replication
+	return status
+}
+
+// watchStatus 以 ndjson 流推送状态变化, 直到客户端断开连接
+//
+// 服务端按 interval 检查状态, 只在状态变化时推送,
+// 监控系统无需频繁轮询即可获得近实时的复制延迟.
+func (h *Handler) watchStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	interval := defaultWatchInterval
+	if s := r.URL.Query().Get("interval"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			http.Error(w, "invalid interval", http.StatusBadRequest)
+			return
+		}
+		interval = d
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var pre *raft.Status
+	for {
+		status := h.raft.Stats()
+		if pre == nil || statusChanged(*pre, status) {
+			if err := enc.Encode(status); err != nil {
+				return
+			}
+			flusher.Flush()
+			pre = &status
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			// no-op
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package admin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mind1949/raft"
+	"github.com/mind1949/raft/raftmock"
+	"github.com/mind1949/raft/transport/inmem"
+)
+
+type fakeRaft struct {
+	raft.Raft
+
+	mux    sync.Mutex
+	status raft.Status
+}
+
+func (f *fakeRaft) Stats() raft.Status {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.status
+}
+
+func (f *fakeRaft) setCommitIndex(index uint64) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.status.CommitIndex = index
+}
+
+func TestWatchStatus(t *testing.T) {
+	r := &fakeRaft{status: raft.Status{Id: "1", State: "Leader", Term: 1}}
+	server := httptest.NewServer(NewHandler(r))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/status/watch?interval=1ms", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	next := func() raft.Status {
+		t.Helper()
+		if !scanner.Scan() {
+			t.Fatalf("expect status but got %v", scanner.Err())
+		}
+		var status raft.Status
+		if err := json.Unmarshal(scanner.Bytes(), &status); err != nil {
+			t.Fatal(err)
+		}
+		return status
+	}
+
+	if status := next(); status.Id != "1" || status.CommitIndex != 0 {
+		t.Errorf("expect initial status but got %+v", status)
+	}
+	for i := uint64(1); i <= 3; i++ {
+		r.setCommitIndex(i)
+		// 只在状态变化时推送, 每次变化恰好推送一次
+		if status := next(); status.CommitIndex != i {
+			t.Errorf("expect commit index %d but got %d", i, status.CommitIndex)
+		}
+	}
+}
+
+func TestWatchStatusHeartbeats(t *testing.T) {
+	c, err := inmem.NewCluster(3, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+	c.Start()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	node, err := c.WaitLeader(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leader := node.Raft()
+	if err := leader.Handle(ctx, raft.Command("a")); err != nil {
+		t.Fatal(err)
+	}
+	// wait until the followers caught up, only heartbeats are sent afterwards
+	for caughtUp := false; !caughtUp; time.Sleep(5 * time.Millisecond) {
+		status := leader.Stats()
+		caughtUp = len(status.Replication) == 3 && status.LastApplied == status.LastLogIndex
+		for _, peer := range status.Replication {
+			caughtUp = caughtUp && peer.Lag == 0
+		}
+		if ctx.Err() != nil {
+			t.Fatal("expect followers caught up")
+		}
+	}
+
+	server := httptest.NewServer(NewHandler(leader))
+	defer server.Close()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/status/watch?interval=5ms", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	lines := make(chan raft.Status, 16)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			var status raft.Status
+			if json.Unmarshal(scanner.Bytes(), &status) == nil {
+				lines <- status
+			}
+		}
+		close(lines)
+	}()
+
+	initial := <-lines
+	select {
+	case status := <-lines:
+		t.Fatalf("expect no status pushed on heartbeats but got %+v", status)
+	case <-time.After(300 * time.Millisecond):
+	}
+	if err := leader.Handle(ctx, raft.Command("b")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case status := <-lines:
+		if status.CommitIndex <= initial.CommitIndex {
+			t.Errorf("expect commit index after %d but got %d", initial.CommitIndex, status.CommitIndex)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expect status pushed after commit")
+	}
+}
+
+func TestTransferLeadershipNotLeader(t *testing.T) {
+	r := raftmock.NewRaft("1", nil)
+	r.SetLeader(false)
+	r.SetLeaderHint(raft.RaftPeer{Id: "2", Addr: "10.0.0.2:5000"})
+	server := httptest.NewServer(NewHandler(r))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/leadership/transfer?target=3", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("expect status %d but got %d", http.StatusConflict, resp.StatusCode)
+	}
+	if leader := resp.Header.Get(HeaderLeader); leader != "10.0.0.2:5000" {
+		t.Errorf("expect leader hint %q but got %q", "10.0.0.2:5000", leader)
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	r := raftmock.NewRaft("1", nil)
+	server := httptest.NewServer(NewHandler(r))
+	defer server.Close()
+	client := NewClient(server.URL)
+	ctx := context.Background()
+
+	if err := client.Quarantine(ctx, "3"); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := client.Quarantined(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != "3" {
+		t.Errorf("expect [3] but got %v", ids)
+	}
+	if err := client.Quarantine(ctx, "1"); err == nil {
+		t.Error("expect error quarantining self but got nil")
+	}
+
+	if err := client.Unquarantine(ctx, "3"); err != nil {
+		t.Fatal(err)
+	}
+	ids, err = client.Quarantined(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 0 {
+		t.Errorf("expect no quarantined peer but got %v", ids)
+	}
+}
@@ -0,0 +1,84 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mind1949/raft"
+)
+
+// NewClient 创建 http 管理接口的客户端, addr 为 Handler 的地址, 如 http://10.0.0.1:8080/raft
+func NewClient(addr string) *Client {
+	return &Client{
+		addr:   strings.TrimSuffix(addr, "/"),
+		client: http.DefaultClient,
+	}
+}
+
+// Client http 管理接口的客户端
+type Client struct {
+	addr   string
+	client *http.Client
+}
+
+// Status 获取状态快照
+func (c *Client) Status(ctx context.Context) (raft.Status, error) {
+	var status raft.Status
+	err := c.do(ctx, http.MethodGet, "/status", &status)
+	return status, err
+}
+
+// LeadershipHistory 获取 leadership 变化记录
+func (c *Client) LeadershipHistory(ctx context.Context) ([]raft.LeadershipRecord, error) {
+	var records []raft.LeadershipRecord
+	err := c.do(ctx, http.MethodGet, "/leadership/history", &records)
+	return records, err
+}
+
+// TransferLeadership 将 leadership 转移给 target
+func (c *Client) TransferLeadership(ctx context.Context, target raft.RaftId) error {
+	return c.do(ctx, http.MethodPost, "/leadership/transfer?target="+url.QueryEscape(string(target)), nil)
+}
+
+// Quarantined 获取节点隔离的 peer
+func (c *Client) Quarantined(ctx context.Context) ([]raft.RaftId, error) {
+	var ids []raft.RaftId
+	err := c.do(ctx, http.MethodGet, "/peers/quarantine", &ids)
+	return ids, err
+}
+
+// Quarantine 在节点上隔离 peer id
+func (c *Client) Quarantine(ctx context.Context, id raft.RaftId) error {
+	return c.do(ctx, http.MethodPost, "/peers/quarantine?id="+url.QueryEscape(string(id)), nil)
+}
+
+// Unquarantine 在节点上解除对 peer id 的隔离
+func (c *Client) Unquarantine(ctx context.Context, id raft.RaftId) error {
+	return c.do(ctx, http.MethodDelete, "/peers/quarantine?id="+url.QueryEscape(string(id)), nil)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.addr+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("err: %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(b)))
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
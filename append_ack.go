@@ -0,0 +1,34 @@
+package raft
+
+import "sync"
+
+// appendAcks Follower 端 AppendEntries 的累计确认
+//
+// 同一 Leader 连续发来的多个 AppendEntries 可能并发到达, 逐个处理后,
+// 每个响应都携带已与该 Leader 一致的最大索引(MatchIndex).
+// 已被之后的请求覆盖的 log entry 不再重复写入,
+// Leader 收到落后的确认时也无需再更新 nextIndex 与 matchIndex.
+type appendAcks struct {
+	// mux 串行处理 AppendEntries, 避免较早的请求截断较新请求写入的 log entry
+	mux sync.Mutex
+	// term matched 所属的 Leader term
+	term uint64
+	// matched 已确认与 term 的 Leader 一致的最大索引
+	matched uint64
+}
+
+// covered 在 term 中 lastIndex 之前的 log entry 是否都已确认一致
+func (a *appendAcks) covered(term, lastIndex uint64) bool {
+	return a.term == term && lastIndex <= a.matched
+}
+
+// advance 确认 term 的 Leader 的 log 在 matchIndex 之前与本节点一致, 返回累计的 matched
+func (a *appendAcks) advance(term, matchIndex uint64) uint64 {
+	if a.term != term {
+		a.term, a.matched = term, 0
+	}
+	if matchIndex > a.matched {
+		a.matched = matchIndex
+	}
+	return a.matched
+}
@@ -0,0 +1,75 @@
+package raft
+
+import "testing"
+
+func TestAppendAcks(t *testing.T) {
+	r, err := New("follower", "follower", nil, &memoryStore{}, &memoryLog{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := r.(*raft).newRPCService()
+	entries := []LogEntry{
+		{Index: 1, Term: 1, Command: Command("a")},
+		{Index: 2, Term: 1, Command: Command("b")},
+		{Index: 3, Term: 1, Command: Command("c")},
+	}
+	appendEntries := func(prevLogIndex uint64, prevLogTerm uint64, entries []LogEntry) AppendEntriesResults {
+		var results AppendEntriesResults
+		err := service.AppendEntries(AppendEntriesArgs{
+			Term:         1,
+			LeaderId:     "leader",
+			PrevLogIndex: prevLogIndex,
+			PrevLogTerm:  prevLogTerm,
+			Entries:      entries,
+		}, &results)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return results
+	}
+
+	t.Run("later request first", func(t *testing.T) {
+		results := appendEntries(0, 0, entries)
+		if !results.Success || results.MatchIndex != 3 {
+			t.Errorf("expect success with match index 3 but got %+v", results)
+		}
+	})
+
+	t.Run("earlier request is covered", func(t *testing.T) {
+		results := appendEntries(0, 0, entries[:2])
+		if !results.Success || results.MatchIndex != 3 {
+			t.Errorf("expect cumulative match index 3 but got %+v", results)
+		}
+		lastIndex, _, err := r.(*raft).Last()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lastIndex != 3 {
+			t.Errorf("expect last index 3 but got %d", lastIndex)
+		}
+	})
+
+	t.Run("new leader", func(t *testing.T) {
+		var results AppendEntriesResults
+		err := service.AppendEntries(AppendEntriesArgs{Term: 2, LeaderId: "leader2", PrevLogIndex: 1, PrevLogTerm: 1}, &results)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !results.Success || results.MatchIndex != 1 {
+			t.Errorf("expect match index restarting at 1 but got %+v", results)
+		}
+	})
+}
+
+func TestRaftIdIndexMapStoreMax(t *testing.T) {
+	var m raftIdIndexMap
+	if !m.StoreMax("a", 2) {
+		t.Error("expect storing absent index")
+	}
+	if m.StoreMax("a", 1) {
+		t.Error("expect not storing smaller index")
+	}
+	if index, _ := m.Load("a"); index != 2 {
+		t.Errorf("expect 2 but got %d", index)
+	}
+}
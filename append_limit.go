@@ -0,0 +1,37 @@
+package raft
+
+const (
+	// defaultMaxAppendEntries 单个 AppendEntries 默认最多携带的 log entry 数
+	defaultMaxAppendEntries = 64
+	// defaultMaxAppendBytes 单个 AppendEntries 默认最多携带的 command 字节数
+	defaultMaxAppendBytes = 1 << 20
+)
+
+// appendEnd 从 prevLogIndex 之后复制到 lastIndex 时, 单个 AppendEntries 携带的最后一个 log entry 索引
+//
+// 落后很多的 peer 分批追赶, 避免一次读取并发送所有缺少的 log entry, 见 WithMaxAppendEntries.
+func (l *leader) appendEnd(prevLogIndex, lastIndex uint64) uint64 {
+	if l.maxAppendEntries <= 0 || lastIndex <= prevLogIndex {
+		return lastIndex
+	}
+	if max := uint64(l.maxAppendEntries); lastIndex-prevLogIndex > max {
+		return prevLogIndex + max
+	}
+	return lastIndex
+}
+
+// limitAppendBytes 截断 entries 使 command 的总字节数不超过 maxAppendBytes
+// 至少保留一个 log entry, 否则超过上限的 command 永远无法复制
+func (l *leader) limitAppendBytes(entries []LogEntry) []LogEntry {
+	if l.maxAppendBytes <= 0 {
+		return entries
+	}
+	var size int
+	for i, entry := range entries {
+		size += len(entry.Command)
+		if size > l.maxAppendBytes && i > 0 {
+			return entries[:i]
+		}
+	}
+	return entries
+}
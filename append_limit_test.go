@@ -0,0 +1,109 @@
+package raft
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingRPC 记录携带 log entry 的 AppendEntries 的最大条数与 command 字节数
+type recordingRPC struct {
+	*loopbackRPC
+
+	mux        sync.Mutex
+	maxEntries int
+	maxBytes   int
+}
+
+func (r *recordingRPC) CallAppendEntries(addr RaftAddr, args AppendEntriesArgs) (AppendEntriesResults, error) {
+	r.mux.Lock()
+	if n := len(args.Entries); n > r.maxEntries {
+		r.maxEntries = n
+	}
+	if size := entriesSize(args.Entries); size > r.maxBytes {
+		r.maxBytes = size
+	}
+	r.mux.Unlock()
+	return r.loopbackRPC.CallAppendEntries(addr, args)
+}
+
+func (r *recordingRPC) reset() {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.maxEntries, r.maxBytes = 0, 0
+}
+
+func (r *recordingRPC) max() (entries, bytes int) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.maxEntries, r.maxBytes
+}
+
+func TestAppendLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		optFns []OptFn
+	}{
+		{name: "replicate"},
+		{name: "pipeline", optFns: []OptFn{WithPipeline(4)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id := RaftId("append-limit-" + test.name)
+			rpc := &recordingRPC{loopbackRPC: newLoopbackRPC()}
+			fsm := &listFSM{}
+			optFns := append([]OptFn{WithDevMode(), WithRPC(rpc), WithMaxAppendEntries(8), WithMaxAppendBytes(100)}, test.optFns...)
+			leader, err := New(id, RaftAddr(id), fsm.apply, nil, nil, optFns...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer leader.Stop()
+			go leader.Run()
+
+			follower := runLoopbackFollower(t, id+"-follower")
+			defer follower.Stop()
+			ctx := context.Background()
+			if err := leader.AddVoter(ctx, follower.Id(), follower.Addr()); err != nil {
+				t.Fatal(err)
+			}
+
+			// the follower has to acknowledge all commands before Handle returns
+			handle := func(t *testing.T, n, size int) {
+				t.Helper()
+				rpc.reset()
+				cmds := make([]Command, n)
+				for i := range cmds {
+					cmds[i] = Command(strings.Repeat("c", size))
+				}
+				ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+				defer cancel()
+				if err := leader.Handle(ctx, cmds...); err != nil {
+					t.Fatal(err)
+				}
+			}
+			t.Run("entries", func(t *testing.T) {
+				handle(t, 50, 10)
+				if entries, _ := rpc.max(); entries != 8 {
+					t.Errorf("expect at most 8 entries per AppendEntries but got %d", entries)
+				}
+			})
+			t.Run("bytes", func(t *testing.T) {
+				handle(t, 10, 30)
+				if entries, bytes := rpc.max(); entries != 3 || bytes != 90 {
+					t.Errorf("expect at most 3 entries of 90 bytes per AppendEntries but got %d entries of %d bytes", entries, bytes)
+				}
+			})
+			t.Run("oversized command", func(t *testing.T) {
+				handle(t, 2, 200)
+				if entries, bytes := rpc.max(); entries != 1 || bytes != 200 {
+					t.Errorf("expect oversized command sent alone but got %d entries of %d bytes", entries, bytes)
+				}
+			})
+			if got := len(fsm.get()); got != 62 {
+				t.Errorf("expect 62 commands applied but got %d", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package raft
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultAccountingInterval 统计 apply worker 耗时的区间长度
+const defaultAccountingInterval = 10 * time.Second
+
+// ApplyAccounting apply worker 的耗时分布
+//
+// Apply 明显多于 ReadLog 与 WaitCommit 时, 瓶颈在状态机;
+// WaitCommit 占多数时, 瓶颈在日志复制.
+type ApplyAccounting struct {
+	// Apply 状态机 Apply 的耗时
+	Apply time.Duration
+	// WaitCommit 等待 commitIndex 推进的耗时
+	WaitCommit time.Duration
+	// ReadLog 从 log 中读取待应用的 log entry 的耗时
+	ReadLog time.Duration
+}
+
+func (a *ApplyAccounting) add(o ApplyAccounting) {
+	a.Apply += o.Apply
+	a.WaitCommit += o.WaitCommit
+	a.ReadLog += o.ReadLog
+}
+
+// ApplyStatus apply worker 的累计耗时与最近一个完整区间的耗时
+type ApplyStatus struct {
+	Total ApplyAccounting
+	// LastInterval 最近一个完整区间的耗时, 区间长度为 Interval
+	LastInterval ApplyAccounting
+	Interval     time.Duration
+}
+
+// applyAccounting 统计 apply worker 的耗时
+type applyAccounting struct {
+	mux      sync.Mutex
+	interval time.Duration
+	total    ApplyAccounting
+	// current 当前区间, 从 start 开始
+	current ApplyAccounting
+	start   time.Time
+	last    ApplyAccounting
+}
+
+func (a *applyAccounting) record(o ApplyAccounting) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	a.rotate(time.Now())
+	a.total.add(o)
+	a.current.add(o)
+}
+
+// rotate 当前区间结束时, 开始新的区间
+func (a *applyAccounting) rotate(now time.Time) {
+	if a.interval <= 0 {
+		a.interval = defaultAccountingInterval
+	}
+	if a.start.IsZero() {
+		a.start = now
+		return
+	}
+	elapsed := now.Sub(a.start)
+	if elapsed < a.interval {
+		return
+	}
+	a.last = a.current
+	if elapsed >= 2*a.interval {
+		// idle for a whole interval
+		a.last = ApplyAccounting{}
+	}
+	a.current = ApplyAccounting{}
+	a.start = now
+}
+
+func (a *applyAccounting) status() ApplyStatus {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	a.rotate(time.Now())
+	return ApplyStatus{
+		Total:        a.total,
+		LastInterval: a.last,
+		Interval:     a.interval,
+	}
+}
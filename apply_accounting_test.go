@@ -0,0 +1,40 @@
+package raft
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApplyAccounting(t *testing.T) {
+	a := applyAccounting{interval: time.Minute}
+	a.record(ApplyAccounting{Apply: time.Second, ReadLog: time.Millisecond})
+	a.record(ApplyAccounting{WaitCommit: 2 * time.Second})
+
+	status := a.status()
+	expect := ApplyAccounting{Apply: time.Second, WaitCommit: 2 * time.Second, ReadLog: time.Millisecond}
+	if status.Total != expect {
+		t.Errorf("expect total %+v but got %+v", expect, status.Total)
+	}
+	if status.LastInterval != (ApplyAccounting{}) {
+		t.Errorf("expect empty last interval but got %+v", status.LastInterval)
+	}
+
+	t.Run("interval ends", func(t *testing.T) {
+		a.start = a.start.Add(-time.Minute)
+		status := a.status()
+		if status.LastInterval != expect {
+			t.Errorf("expect last interval %+v but got %+v", expect, status.LastInterval)
+		}
+		a.record(ApplyAccounting{Apply: time.Second})
+		if status := a.status(); status.Total.Apply != 2*time.Second || status.LastInterval != expect {
+			t.Errorf("expect recording into a new interval but got %+v", status)
+		}
+	})
+
+	t.Run("idle", func(t *testing.T) {
+		a.start = a.start.Add(-3 * time.Minute)
+		if status := a.status(); status.LastInterval != (ApplyAccounting{}) {
+			t.Errorf("expect empty last interval after idling but got %+v", status.LastInterval)
+		}
+	})
+}
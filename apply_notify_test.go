@@ -0,0 +1,39 @@
+package raft
+
+import "testing"
+
+func TestNotifyApply(t *testing.T) {
+	sink := new(countingSink)
+	r, err := New("notify", "notify", nil, nil, nil, WithDevMode(), WithMetrics(sink))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raft := r.(*raft)
+	raft.SetLastApplied(raft.GetCommitIndex())
+
+	t.Run("nothing to apply", func(t *testing.T) {
+		raft.notifyApply()
+		if got := sink.counter(MetricApplyNotifications); got != 0 {
+			t.Errorf("expect 0 notifications but got %v", got)
+		}
+		if len(raft.applyNotify) != 0 {
+			t.Errorf("expect no pending wakeup but got %d", len(raft.applyNotify))
+		}
+	})
+
+	t.Run("coalesce", func(t *testing.T) {
+		raft.SetCommitIndex(raft.GetLastApplied() + 1)
+		for i := 0; i < 10; i++ {
+			raft.notifyApply()
+		}
+		if got := sink.counter(MetricApplyNotifications); got != 10 {
+			t.Errorf("expect 10 notifications but got %v", got)
+		}
+		if got := sink.counter(MetricApplyNotificationsCoalesced); got != 9 {
+			t.Errorf("expect 9 coalesced notifications but got %v", got)
+		}
+		if len(raft.applyNotify) != 1 {
+			t.Errorf("expect 1 pending wakeup but got %d", len(raft.applyNotify))
+		}
+	})
+}
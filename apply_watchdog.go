@@ -0,0 +1,78 @@
+package raft
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// applyWatchdog 监控每批 command 应用到状态机的时间
+type applyWatchdog struct {
+	// deadline 单批应用的期限, 0 表示不监控
+	deadline time.Duration
+	// split 超过期限后拆分之后的批次, 缩小问题 command 所在的区间
+	split bool
+
+	// limit 单批最多应用的 log entry 数量, 0 表示不限制
+	limit uint64
+}
+
+func (w *applyWatchdog) enabled() bool {
+	return w.deadline > 0
+}
+
+// batchLimit 单批最多应用的 log entry 数量, 0 表示不限制
+func (w *applyWatchdog) batchLimit() uint64 {
+	return atomic.LoadUint64(&w.limit)
+}
+
+// adjust 根据本批的耗时调整之后的批次大小
+// 超过期限时减半, 直到单个 log entry; 恢复后逐步加倍, 直到不再限制
+func (w *applyWatchdog) adjust(size uint64, slow bool) {
+	if !w.split {
+		return
+	}
+	if slow {
+		limit := size / 2
+		if limit == 0 {
+			limit = 1
+		}
+		atomic.StoreUint64(&w.limit, limit)
+		return
+	}
+	limit := atomic.LoadUint64(&w.limit)
+	if limit == 0 || size < limit {
+		return
+	}
+	limit *= 2
+	if limit >= 1<<16 {
+		limit = 0
+	}
+	atomic.StoreUint64(&w.limit, limit)
+}
+
+// watchApply 开始监控应用 [firstIndex, lastIndex] 区间内的 command
+//
+// 超过期限时立即发出 EventSlowApply, 即使状态机一直没有返回也能定位到问题区间.
+// 应用完成后调用 stop.
+func (r *raft) watchApply(firstIndex, lastIndex uint64) (stop func()) {
+	if !r.watchdog.enabled() {
+		return func() {}
+	}
+	start := time.Now()
+	timer := time.AfterFunc(r.watchdog.deadline, func() {
+		r.emit(Event{
+			Type:       EventSlowApply,
+			Level:      EventLevelWarning,
+			FirstIndex: firstIndex,
+			LastIndex:  lastIndex,
+			Message: fmt.Sprintf("applying entries [%d, %d] exceeds %s",
+				firstIndex, lastIndex, r.watchdog.deadline),
+		})
+	})
+	return func() {
+		timer.Stop()
+		slow := time.Since(start) > r.watchdog.deadline
+		r.watchdog.adjust(lastIndex-firstIndex+1, slow)
+	}
+}
@@ -0,0 +1,68 @@
+package raft
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestApplyWatchdog(t *testing.T) {
+	const deadline = 20 * time.Millisecond
+	slow := Command("slow")
+
+	var (
+		mux    sync.Mutex
+		events []Event
+	)
+	observer := func(event Event) {
+		mux.Lock()
+		defer mux.Unlock()
+		events = append(events, event)
+	}
+	apply := func(commands Commands) (int, error) {
+		for _, command := range commands.Data() {
+			if bytes.Equal(command, slow) {
+				time.Sleep(2 * deadline)
+			}
+		}
+		return len(commands.Data()), nil
+	}
+	raft, err := New("watchdog", "watchdog", apply, nil, nil,
+		WithDevMode(), WithObserver(observer), WithApplyWatchdog(deadline, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raft.Stop()
+	go raft.Run()
+
+	lastEvent := func() Event {
+		mux.Lock()
+		defer mux.Unlock()
+		if len(events) == 0 {
+			t.Fatal("expect slow apply event")
+		}
+		return events[len(events)-1]
+	}
+
+	// index 1 is the bootstrap configuration
+	err = raft.Handle(context.Background(), Command("a"), slow, Command("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := lastEvent()
+	if event.Type != EventSlowApply || event.FirstIndex != 1 || event.LastIndex != 4 {
+		t.Errorf("expect SlowApply of [1, 4] but got %s of [%d, %d]", event.Type, event.FirstIndex, event.LastIndex)
+	}
+
+	// batches are halved after a slow batch
+	err = raft.Handle(context.Background(), Command("c"), Command("d"), slow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event = lastEvent()
+	if event.FirstIndex != 7 || event.LastIndex != 7 {
+		t.Errorf("expect SlowApply of [7, 7] but got [%d, %d]", event.FirstIndex, event.LastIndex)
+	}
+}
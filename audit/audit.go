@@ -0,0 +1,167 @@
+// Package audit 记录每个应用到状态机的命令, 供合规审计
+//
+//	sink, err := audit.NewFileSink("/var/lib/app/audit.log")
+//	apply = audit.Middleware(apply, sink)
+//	r, err := raft.New(id, addr, apply, store, log)
+//
+// 每个命令一条记录: 提交者(见 raft.WithProposer), log entry 的索引与 term,
+// 命令的 sha256, 以及应用的结果. 记录只追加, 不会被修改.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mind1949/raft"
+)
+
+// Status 命令的应用结果
+type Status string
+
+const (
+	// StatusApplied 已应用到状态机
+	StatusApplied Status = "applied"
+	// StatusDeferred 状态机本批只应用了之前的命令, 之后会重新应用
+	StatusDeferred Status = "deferred"
+	// StatusFailed 状态机返回错误, 之后会重新应用
+	StatusFailed Status = "failed"
+)
+
+// Record 一条审计记录
+type Record struct {
+	Time     time.Time `json:"time"`
+	Index    uint64    `json:"index"`
+	Term     uint64    `json:"term"`
+	Proposer string    `json:"proposer,omitempty"`
+	// CommandHash 命令的 sha256, 十六进制编码
+	CommandHash string `json:"command_hash"`
+	Status      Status `json:"status"`
+	Error       string `json:"error,omitempty"`
+}
+
+// Sink 审计记录的存储, 只追加
+type Sink interface {
+	// Write 追加一批记录, 返回时记录须已持久化
+	Write(records []Record) error
+}
+
+// SinkFunc 使用函数实现 Sink
+type SinkFunc func(records []Record) error
+
+func (f SinkFunc) Write(records []Record) error {
+	return f(records)
+}
+
+// Option Middleware 的配置
+type Option func(*middleware)
+
+// WithErrorHandler 写入审计记录失败时调用 handler
+//
+// 命令此时已经应用, 不能因审计失败而让 raft 重新应用,
+// 因此审计失败不影响 Apply 的结果, 只报告给 handler.
+func WithErrorHandler(handler func(err error, records []Record)) Option {
+	return func(m *middleware) {
+		m.onError = handler
+	}
+}
+
+// Middleware 包装 apply, 为每个命令写入审计记录
+func Middleware(apply raft.Apply, sink Sink, options ...Option) raft.Apply {
+	m := &middleware{
+		apply:   apply,
+		sink:    sink,
+		onError: func(error, []Record) {},
+		now:     time.Now,
+	}
+	for _, option := range options {
+		option(m)
+	}
+	return m.Apply
+}
+
+type middleware struct {
+	apply   raft.Apply
+	sink    Sink
+	onError func(err error, records []Record)
+	now     func() time.Time
+}
+
+func (m *middleware) Apply(commands raft.Commands) (int, error) {
+	appliedCount, err := m.apply(commands)
+
+	now := m.now()
+	entries := raft.EntriesOf(commands)
+	records := make([]Record, 0, len(entries))
+	for i, entry := range entries {
+		sum := sha256.Sum256(entry.Command)
+		record := Record{
+			Time:        now,
+			Index:       entry.Index,
+			Term:        entry.Term,
+			Proposer:    entry.Proposer,
+			CommandHash: hex.EncodeToString(sum[:]),
+		}
+		switch {
+		case err != nil:
+			// raft discards the whole batch on error
+			record.Status = StatusFailed
+			record.Error = err.Error()
+		case i < appliedCount:
+			record.Status = StatusApplied
+		default:
+			record.Status = StatusDeferred
+		}
+		records = append(records, record)
+	}
+	if werr := m.sink.Write(records); werr != nil {
+		m.onError(werr, records)
+	}
+	return appliedCount, err
+}
+
+// NewFileSink 以 json lines 格式追加写入 path, 每批记录写入后 fsync
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{f: f}, nil
+}
+
+var _ Sink = (*FileSink)(nil)
+
+// FileSink 将审计记录追加写入文件
+type FileSink struct {
+	mux sync.Mutex
+	f   *os.File
+}
+
+func (s *FileSink) Write(records []Record) error {
+	var buf []byte
+	for _, record := range records {
+		b, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, b...), '\n')
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	_, err := s.f.Write(buf)
+	if err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+// Close 关闭文件
+func (s *FileSink) Close() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.f.Close()
+}
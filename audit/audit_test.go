@@ -0,0 +1,111 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mind1949/raft"
+)
+
+func TestMiddleware(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewFileSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	apply := func(commands raft.Commands) (int, error) {
+		for i, command := range commands.Data() {
+			if string(command) == "bad" {
+				return i, nil
+			}
+		}
+		return len(commands.Data()), nil
+	}
+	r, err := raft.New("audit", "audit", Middleware(apply, sink), nil, nil, raft.WithDevMode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	go r.Run()
+
+	err = r.Handle(raft.WithProposer(context.Background(), "alice"), raft.Command("a"), raft.Command("bad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	if len(records) < 2 {
+		t.Fatalf("expect at least 2 records but got %d", len(records))
+	}
+	// index 1 is the bootstrap configuration
+	first, second := records[0], records[1]
+	if first.Index != 2 || first.Proposer != "alice" || first.Status != StatusApplied ||
+		first.CommandHash != "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb" {
+		t.Errorf("expect applied record of index 2 proposed by alice but got %+v", first)
+	}
+	if second.Index != 3 || second.Status != StatusDeferred {
+		t.Errorf("expect deferred record of index 3 but got %+v", second)
+	}
+}
+
+func TestMiddlewareError(t *testing.T) {
+	var (
+		records []Record
+		errs    []error
+	)
+	sink := SinkFunc(func(r []Record) error {
+		records = append(records, r...)
+		return errors.New("disk full")
+	})
+	applyErr := errors.New("invalid command")
+	apply := Middleware(func(raft.Commands) (int, error) {
+		return 0, applyErr
+	}, sink, WithErrorHandler(func(err error, _ []Record) {
+		errs = append(errs, err)
+	}))
+
+	_, err := apply(fakeCommands{{Index: 7, Term: 2, Command: raft.Command("x")}})
+	if err != applyErr {
+		t.Errorf("expect %v but got %v", applyErr, err)
+	}
+	if len(records) != 1 || records[0].Status != StatusFailed || records[0].Error != applyErr.Error() {
+		t.Errorf("expect failed record but got %+v", records)
+	}
+	if len(errs) != 1 {
+		t.Errorf("expect sink error reported but got %v", errs)
+	}
+}
+
+type fakeCommands []raft.LogEntry
+
+func (c fakeCommands) Data() []raft.Command {
+	var data []raft.Command
+	for _, entry := range c {
+		data = append(data, entry.Command)
+	}
+	return data
+}
+
+func (c fakeCommands) Entries() []raft.LogEntry {
+	return c
+}
@@ -0,0 +1,136 @@
+package raft
+
+import (
+	"sync"
+	"time"
+)
+
+// bandwidthLimiter 令牌桶, 限制每秒发送的字节数
+//
+// 允许透支: 超过桶容量的发送(如快照分块)不会一直等待, 而是透支之后的额度.
+type bandwidthLimiter struct {
+	// rate 每秒的字节数, 桶容量为一秒的额度
+	rate float64
+
+	mux    sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newBandwidthLimiter(rate int64) *bandwidthLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &bandwidthLimiter{rate: float64(rate), tokens: float64(rate)}
+}
+
+// reserve 预留 n 字节, 返回发送之前需要等待的时间
+func (l *bandwidthLimiter) reserve(n int, now time.Time) time.Duration {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.rate {
+			l.tokens = l.rate
+		}
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// bandwidthBudget 发往 peer 的复制与快照流量的预算, 见 WithBandwidthBudget
+type bandwidthBudget struct {
+	perPeer int64
+	global  *bandwidthLimiter
+
+	mux   sync.Mutex
+	peers map[RaftId]*bandwidthLimiter
+	// waiting 因超出预算而等待发送的数量
+	waiting map[RaftId]int
+}
+
+func newBandwidthBudget(perPeer, global int64) *bandwidthBudget {
+	if perPeer <= 0 && global <= 0 {
+		return nil
+	}
+	return &bandwidthBudget{
+		perPeer: perPeer,
+		global:  newBandwidthLimiter(global),
+		peers:   make(map[RaftId]*bandwidthLimiter),
+		waiting: make(map[RaftId]int),
+	}
+}
+
+// reserve 预留发往 peer 的 n 字节, 返回需要等待的时间
+func (b *bandwidthBudget) reserve(peer RaftId, n int, now time.Time) time.Duration {
+	var wait time.Duration
+	if b.perPeer > 0 {
+		b.mux.Lock()
+		limiter, ok := b.peers[peer]
+		if !ok {
+			limiter = newBandwidthLimiter(b.perPeer)
+			b.peers[peer] = limiter
+		}
+		b.mux.Unlock()
+		wait = limiter.reserve(n, now)
+	}
+	if b.global != nil {
+		if w := b.global.reserve(n, now); w > wait {
+			wait = w
+		}
+	}
+	return wait
+}
+
+func (b *bandwidthBudget) wait(peer RaftId, delta int) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.waiting[peer] += delta
+}
+
+// throttled 是否有发往 peer 的 rpc 因超出预算而等待
+func (b *bandwidthBudget) throttled(peer RaftId) bool {
+	if b == nil {
+		return false
+	}
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.waiting[peer] > 0
+}
+
+// throttle 发往 peer 的 n 字节超出预算时等待
+// raft 停止时返回 ErrStopped
+func (r *raft) throttle(peer RaftId, n int) error {
+	if r.bandwidth == nil || n == 0 {
+		return nil
+	}
+	wait := r.bandwidth.reserve(peer, n, time.Now())
+	if wait <= 0 {
+		return nil
+	}
+	r.metrics.AddSample(MetricBandwidthThrottled, milliseconds(wait), Label{Name: LabelPeer, Value: string(peer)})
+	// heartbeats keep the leader's authority while waiting
+	r.bandwidth.wait(peer, 1)
+	defer r.bandwidth.wait(peer, -1)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-r.Done():
+		return ErrStopped
+	case <-timer.C:
+		return nil
+	}
+}
+
+// entriesSize log entry 中 command 的字节数
+func entriesSize(entries []LogEntry) int {
+	var size int
+	for _, entry := range entries {
+		size += len(entry.Command)
+	}
+	return size
+}
@@ -0,0 +1,89 @@
+package raft
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBandwidthLimiter(t *testing.T) {
+	limiter := newBandwidthLimiter(1000)
+	now := time.Unix(1000, 0)
+	tests := []struct {
+		name  string
+		n     int
+		after time.Duration
+		wait  time.Duration
+	}{
+		{"within burst", 800, 0, 0},
+		{"overdraw", 700, 0, 500 * time.Millisecond},
+		{"refilled", 500, time.Second, 0},
+		{"refill capped at burst", 1500, 10 * time.Second, 500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		now = now.Add(tt.after)
+		if wait := limiter.reserve(tt.n, now); wait != tt.wait {
+			t.Errorf("%s: expect wait %s but got %s", tt.name, tt.wait, wait)
+		}
+	}
+	if newBandwidthLimiter(0) != nil || newBandwidthBudget(0, 0) != nil {
+		t.Errorf("expect no limit for zero rate")
+	}
+}
+
+// samplingSink 记录采样
+type samplingSink struct {
+	countingSink
+	mux     sync.Mutex
+	samples map[string][]float64
+}
+
+func (s *samplingSink) AddSample(name string, value float64, labels ...Label) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.samples == nil {
+		s.samples = make(map[string][]float64)
+	}
+	s.samples[name] = append(s.samples[name], value)
+}
+
+func (s *samplingSink) sampled(name string) []float64 {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.samples[name]
+}
+
+func TestBandwidthBudget(t *testing.T) {
+	metrics := &samplingSink{}
+	fsm := &listFSM{}
+	leader, err := New("bandwidth-leader", "bandwidth-leader", fsm.apply, nil, nil,
+		WithDevMode(), WithBandwidthBudget(20<<10, 0), WithMetrics(metrics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leader.Stop()
+	go leader.Run()
+
+	follower := runLoopbackFollower(t, "bandwidth-follower")
+	defer follower.Stop()
+	ctx := context.Background()
+	if err := leader.AddVoter(ctx, follower.Id(), follower.Addr()); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	cmd := Command(bytes.Repeat([]byte("x"), 10<<10))
+	for i := 0; i < 3; i++ {
+		if err := leader.Handle(ctx, cmd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("expect replication throttled but took %s", elapsed)
+	}
+	if samples := metrics.sampled(MetricBandwidthThrottled); len(samples) == 0 {
+		t.Errorf("expect throttling recorded")
+	}
+}
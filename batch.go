@@ -0,0 +1,125 @@
+package raft
+
+import (
+	"context"
+	"time"
+)
+
+// proposal 等待批量提交的 log entry
+type proposal struct {
+	// ctx 提交时 Handle 的 ctx, 用于跟踪与获取 Acknowledgement
+	ctx     context.Context
+	entries []LogEntry
+	// done 容量为 1, 提交完成后写入结果
+	done chan error
+}
+
+// proposalBatcher 合并并发的 Handle, 一次 Append 与一轮复制提交多个 command
+//
+// 第一个 proposal 到达后最多等待 maxDelay, 或直到累积 maxSize 个 log entry.
+type proposalBatcher struct {
+	maxSize  int
+	maxDelay time.Duration
+
+	// proposals 无缓冲, 只有批量提交的 goroutine 运行时才能提交
+	proposals chan *proposal
+	// stopped Leader 退位时关闭
+	stopped chan struct{}
+}
+
+func (r *raft) newProposalBatcher() proposalBatcher {
+	return proposalBatcher{
+		maxSize:   r.batchSize,
+		maxDelay:  r.batchDelay,
+		proposals: make(chan *proposal),
+		stopped:   make(chan struct{}),
+	}
+}
+
+func (b *proposalBatcher) enabled() bool {
+	return b.maxSize > 1
+}
+
+// proposeBatched 将 entries 交给批量提交的 goroutine, 等待其提交并应用
+func (l *leader) proposeBatched(ctx context.Context, entries []LogEntry) error {
+	p := &proposal{ctx: ctx, entries: entries, done: make(chan error, 1)}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-l.batcher.stopped:
+		return l.staleLeaderError(l.GetCurrentTerm())
+	case l.batcher.proposals <- p:
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-p.done:
+		return err
+	}
+}
+
+// loopBatchProposals 收集一批 proposal, 一并提交
+func (l *leader) loopBatchProposals() {
+	b := &l.batcher
+	for {
+		var batch []*proposal
+		select {
+		case <-b.stopped:
+			return
+		case p := <-b.proposals:
+			batch = append(batch, p)
+		}
+
+		size := len(batch[0].entries)
+		timer := time.NewTimer(b.maxDelay)
+	collect:
+		for size < b.maxSize {
+			select {
+			case <-b.stopped:
+				timer.Stop()
+				l.finishBatch(batch, l.staleLeaderError(l.GetCurrentTerm()))
+				return
+			case p := <-b.proposals:
+				batch = append(batch, p)
+				size += len(p.entries)
+			case <-timer.C:
+				break collect
+			}
+		}
+		timer.Stop()
+
+		entries := make([]LogEntry, 0, size)
+		for _, p := range batch {
+			entries = append(entries, p.entries...)
+		}
+		l.metrics.AddSample(MetricProposalBatchSize, float64(len(entries)))
+		// waiters bound their own wait, see proposeBatched;
+		// the batch is traced under the first proposal
+		ctx := context.WithoutCancel(batch[0].ctx)
+		err := l.commitEntries(ctx, entries)
+		if err != nil {
+			l.finishBatch(batch, err)
+			continue
+		}
+		// proposals acknowledged on commit don't wait for applying
+		var applied []*proposal
+		for _, p := range batch {
+			if AcknowledgementFromContext(p.ctx) == AckCommitted {
+				p.done <- nil
+			} else {
+				applied = append(applied, p)
+			}
+		}
+		if len(applied) == 0 {
+			l.notifyApply()
+			continue
+		}
+		l.finishBatch(applied, l.applyCommitted())
+	}
+}
+
+func (l *leader) finishBatch(batch []*proposal, err error) {
+	for _, p := range batch {
+		p.done <- err
+	}
+}
@@ -0,0 +1,75 @@
+package raft
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingLog 记录 Append 的次数
+type countingLog struct {
+	*memoryLog
+	appends int32
+}
+
+func (l *countingLog) Append(entries ...LogEntry) error {
+	atomic.AddInt32(&l.appends, 1)
+	return l.memoryLog.Append(entries...)
+}
+
+func TestProposalBatching(t *testing.T) {
+	rpc := &slowRPC{loopbackRPC: newLoopbackRPC(), delay: 10 * time.Millisecond}
+	log := &countingLog{memoryLog: &memoryLog{}}
+	fsm := &listFSM{}
+	leader, err := New("batch-leader", "batch-leader", fsm.apply, &memoryStore{}, log,
+		WithDevMode(), WithRPC(rpc), WithProposalBatching(64, 5*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leader.Stop()
+	go leader.Run()
+
+	follower := runLoopbackFollower(t, "batch-follower")
+	defer follower.Stop()
+	ctx := context.Background()
+	if err := leader.AddVoter(ctx, follower.Id(), follower.Addr()); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("coalesce", func(t *testing.T) {
+		appends := atomic.LoadInt32(&log.appends)
+		var wg sync.WaitGroup
+		errs := make(chan error, 50)
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+				defer cancel()
+				errs <- leader.Handle(ctx, Command("c"))
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := len(fsm.get()); got != 50 {
+			t.Errorf("expect 50 commands applied but got %d", got)
+		}
+		if got := atomic.LoadInt32(&log.appends) - appends; got >= 50 {
+			t.Errorf("expect proposals to be coalesced but got %d appends", got)
+		}
+	})
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		if err := leader.Handle(ctx, Command("c")); err != context.Canceled {
+			t.Errorf("expect %v but got %v", context.Canceled, err)
+		}
+	})
+}
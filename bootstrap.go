@@ -0,0 +1,110 @@
+package raft
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrCantBootstrap          = errors.New("err: bootstrap only works on a node with no existing state")
+	ErrInvalidBootstrapConfig = errors.New("err: invalid bootstrap configuration")
+)
+
+// BootstrapCluster 以 configuration 中的 Peers 初始化新集群, 须在 Run 之前调用
+//
+// 在空的 log 中写入 configuration 作为第一个 log entry.
+// 集群首次启动时只在一个节点上调用, 其余节点以空的 log 启动, 由该节点当选 Leader 后复制配置;
+// 在每个节点上分别调用相同的配置同样安全.
+// 节点已有 term, 投票, log 或快照时返回 ErrCantBootstrap, 避免重启时覆盖已有状态.
+func (r *raft) BootstrapCluster(configuration Configuration) error {
+	if state := r.State(); state != LifecycleCreated {
+		return fmt.Errorf("%w: %s", ErrCantBootstrap, state)
+	}
+	peers := configuration.Peers
+	err := validatePeers(ErrInvalidBootstrapConfig, peers)
+	if err != nil {
+		return err
+	}
+	if !includePeer(peers, RaftPeer{Id: r.Id()}) {
+		return fmt.Errorf("%w: %s isn't a peer", ErrInvalidBootstrapConfig, r.Id())
+	}
+
+	err = r.checkEmptyState()
+	if err != nil {
+		return err
+	}
+	err = r.bootstrap(peers)
+	if err != nil {
+		return err
+	}
+	r.log(LogElection).Info("Bootstrapped cluster", "peers", peers)
+	return nil
+}
+
+// validatePeers 检查 peers 非空, 每个 peer 都有 id 与地址且 id 不重复, 否则返回包装了 invalid 的错误
+func validatePeers(invalid error, peers []RaftPeer) error {
+	if len(peers) == 0 {
+		return fmt.Errorf("%w: no peers", invalid)
+	}
+	seen := make(map[RaftId]bool, len(peers))
+	for _, peer := range peers {
+		if peer.Id.isNil() || peer.Addr == "" {
+			return fmt.Errorf("%w: peer %s without id or address", invalid, peer)
+		}
+		if seen[peer.Id] {
+			return fmt.Errorf("%w: duplicate peer %s", invalid, peer.Id)
+		}
+		seen[peer.Id] = true
+	}
+	return nil
+}
+
+// checkEmptyState 节点已有 term, 投票, log 或快照时返回 ErrCantBootstrap
+func (r *raft) checkEmptyState() error {
+	if term := r.GetCurrentTerm(); term != 0 {
+		return fmt.Errorf("%w: current term is %d", ErrCantBootstrap, term)
+	}
+	if voteTerm, votedFor := r.GetVote(); voteTerm != 0 || !votedFor.isNil() {
+		return fmt.Errorf("%w: voted for %q at term %d", ErrCantBootstrap, votedFor, voteTerm)
+	}
+	lastIndex, _, err := r.Log.Last()
+	if err != nil {
+		return err
+	}
+	if lastIndex != 0 {
+		return fmt.Errorf("%w: last log index is %d", ErrCantBootstrap, lastIndex)
+	}
+	if r.snapshotStore != nil {
+		_, ok, err := r.latestSnapshot()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return fmt.Errorf("%w: snapshot exists", ErrCantBootstrap)
+		}
+	}
+	return nil
+}
+
+// bootstrap 将 peers 组成的配置作为第一个 log entry 写入空的 log, 并视为已 commit
+//
+// Instead, we recommend that the very first time a cluster is created,
+// one server is initialized with a configuration entry as the first entry in its log.
+func (r *raft) bootstrap(peers []RaftPeer) error {
+	config := &configImpl{peersList: [][]RaftPeer{peers}}
+	entry, err := r.configs.NewConfigLogEntry(r.GetCurrentTerm(), config)
+	if err != nil {
+		return err
+	}
+	index, err := r.Log.AppendEntry(*entry)
+	if err != nil {
+		return err
+	}
+	config.SetIndex(index)
+	err = r.configs.UseConfig(config)
+	if err != nil {
+		return err
+	}
+	r.SetCommitIndex(index)
+	return nil
+}
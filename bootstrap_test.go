@@ -0,0 +1,100 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBootstrapCluster(t *testing.T) {
+	newRaft := func(t *testing.T, id RaftId, store Store, log Log) *raft {
+		r, err := New(id, RaftAddr(id), (&listFSM{}).apply, store, log,
+			WithRPC(newLoopbackRPC()), WithElection(50*time.Millisecond, 100*time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r.(*raft)
+	}
+	peers := func(ids ...RaftId) Configuration {
+		var configuration Configuration
+		for _, id := range ids {
+			configuration.Peers = append(configuration.Peers, RaftPeer{Id: id, Addr: RaftAddr(id)})
+		}
+		return configuration
+	}
+
+	t.Run("cluster", func(t *testing.T) {
+		ids := []RaftId{"bootstrap-a", "bootstrap-b", "bootstrap-c"}
+		var nodes []*raft
+		for _, id := range ids {
+			nodes = append(nodes, newRaft(t, id, &memoryStore{}, &memoryLog{}))
+		}
+		if err := nodes[0].BootstrapCluster(peers(ids...)); err != nil {
+			t.Fatal(err)
+		}
+		for _, node := range nodes {
+			defer node.Stop()
+			go node.Run()
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for !nodes[0].IsLeader() {
+			if time.Now().After(deadline) {
+				t.Fatal("expect the bootstrapped node elected")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err := nodes[0].Handle(context.Background(), Command("a")); err != nil {
+			t.Fatal(err)
+		}
+		for _, node := range nodes[1:] {
+			for len(node.GetConfiguration().Peers) != len(ids) {
+				if time.Now().After(deadline) {
+					t.Fatalf("expect configuration replicated to %s but got %v", node.Id(), node.GetConfiguration())
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+	})
+
+	t.Run("existing state", func(t *testing.T) {
+		store, log := &memoryStore{}, &memoryLog{}
+		r := newRaft(t, "bootstrap-twice", store, log)
+		if err := r.BootstrapCluster(peers("bootstrap-twice")); err != nil {
+			t.Fatal(err)
+		}
+		restarted := newRaft(t, "bootstrap-twice", store, log)
+		if err := restarted.BootstrapCluster(peers("bootstrap-twice", "other")); !errors.Is(err, ErrCantBootstrap) {
+			t.Fatalf("expect %v but got %v", ErrCantBootstrap, err)
+		}
+
+		voted := newRaft(t, "bootstrap-voted", &memoryStore{}, &memoryLog{})
+		if err := voted.SetVote(2, "other"); err != nil {
+			t.Fatal(err)
+		}
+		if err := voted.BootstrapCluster(peers("bootstrap-voted")); !errors.Is(err, ErrCantBootstrap) {
+			t.Fatalf("expect %v but got %v", ErrCantBootstrap, err)
+		}
+	})
+
+	t.Run("invalid configuration", func(t *testing.T) {
+		r := newRaft(t, "bootstrap-invalid", &memoryStore{}, &memoryLog{})
+		for _, c := range []struct {
+			name          string
+			configuration Configuration
+		}{
+			{name: "empty"},
+			{name: "without self", configuration: peers("other")},
+			{name: "duplicate", configuration: peers("bootstrap-invalid", "other", "other")},
+			{name: "without address", configuration: Configuration{Peers: []RaftPeer{{Id: "bootstrap-invalid"}}}},
+		} {
+			if err := r.BootstrapCluster(c.configuration); !errors.Is(err, ErrInvalidBootstrapConfig) {
+				t.Errorf("%s: expect %v but got %v", c.name, ErrInvalidBootstrapConfig, err)
+			}
+		}
+		if last, _, _ := r.Last(); last != 0 {
+			t.Fatalf("expect nothing written but got last log index %d", last)
+		}
+	})
+}
@@ -0,0 +1,156 @@
+package raft
+
+import (
+	"sync"
+	"time"
+)
+
+// CampaignAttempt 连续竞选失败的节点的选举超时到期, 决定是否再次竞选时的状态, 见 CampaignStrategy
+type CampaignAttempt struct {
+	// Id 本节点的 id
+	Id RaftId
+	// Failures 连续竞选失败的次数, 当选或发现 Leader 后清零
+	Failures int
+	// Deferrals 最近一次竞选之后连续推迟竞选的次数
+	Deferrals int
+	// ElectionTimeout WithElection 配置的选举超时区间
+	ElectionTimeout [2]time.Duration
+	// Peers 当前集群配置中除本节点之外的 peer
+	Peers []RaftPeer
+}
+
+// CampaignDecision CampaignStrategy 的决定
+type CampaignDecision struct {
+	// ElectionTimeout 之后使用的选举超时区间, 零值表示使用配置的区间
+	ElectionTimeout [2]time.Duration
+	// Defer 推迟此次竞选, 等待下一次选举超时
+	Defer bool
+}
+
+// CampaignStrategy 决定连续竞选失败的节点何时再次竞选, 见 WithCampaignStrategy
+//
+// 选举超时相同的节点可能因调度不巧反复瓜分选票, 策略可以逐步扩大本节点的选举超时区间,
+// 或推迟竞选让位于优先级更高的 peer, 打破持续的 split vote.
+type CampaignStrategy interface {
+	// Campaign 在连续竞选失败后每次选举超时到期时调用
+	Campaign(attempt CampaignAttempt) CampaignDecision
+}
+
+// CampaignStrategyFunc 函数形式的 CampaignStrategy
+type CampaignStrategyFunc func(attempt CampaignAttempt) CampaignDecision
+
+func (f CampaignStrategyFunc) Campaign(attempt CampaignAttempt) CampaignDecision {
+	return f(attempt)
+}
+
+// WidenElectionTimeout 每次竞选失败后将选举超时区间的上限增加 step, 最多增加到 max
+func WidenElectionTimeout(step, max time.Duration) CampaignStrategy {
+	return CampaignStrategyFunc(func(attempt CampaignAttempt) CampaignDecision {
+		timeout := attempt.ElectionTimeout
+		timeout[1] += step * time.Duration(attempt.Failures)
+		if timeout[1] > max {
+			timeout[1] = max
+		}
+		if timeout[1] <= timeout[0] {
+			return CampaignDecision{}
+		}
+		return CampaignDecision{ElectionTimeout: timeout}
+	})
+}
+
+// DeferToPriority 竞选失败后, 集群中有优先级更高的 peer 时推迟竞选, 最多连续推迟 maxDeferrals 次
+// 未出现在 priorities 中的节点优先级为 0
+//
+// 推迟次数有上限, 优先级更高的 peer 都不可用时集群仍能选出 Leader.
+func DeferToPriority(priorities map[RaftId]int, maxDeferrals int) CampaignStrategy {
+	return CampaignStrategyFunc(func(attempt CampaignAttempt) CampaignDecision {
+		if attempt.Deferrals >= maxDeferrals {
+			return CampaignDecision{}
+		}
+		for _, peer := range attempt.Peers {
+			if priorities[peer.Id] > priorities[attempt.Id] {
+				return CampaignDecision{Defer: true}
+			}
+		}
+		return CampaignDecision{}
+	})
+}
+
+// campaignTracker 记录连续竞选失败的次数, 由 CampaignStrategy 决定选举超时与是否推迟竞选
+type campaignTracker struct {
+	strategy CampaignStrategy
+
+	mux       sync.Mutex
+	failures  int
+	deferrals int
+	// timeout CampaignStrategy 决定的选举超时区间, 零值表示使用配置的区间
+	timeout [2]time.Duration
+}
+
+// lost 记录一次竞选失败
+func (c *campaignTracker) lost() {
+	if c.strategy == nil {
+		return
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.failures++
+}
+
+// reset 当选或发现 Leader 后清零失败次数, 恢复配置的选举超时
+func (c *campaignTracker) reset() {
+	if c.strategy == nil {
+		return
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.failures, c.deferrals, c.timeout = 0, 0, [2]time.Duration{}
+}
+
+// electionTimeout 当前的选举超时区间
+func (c *campaignTracker) electionTimeout(configured [2]time.Duration) [2]time.Duration {
+	if c.strategy == nil {
+		return configured
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.timeout == ([2]time.Duration{}) {
+		return configured
+	}
+	return c.timeout
+}
+
+// deferCampaign 选举超时到期时调用, 连续竞选失败后由 CampaignStrategy 决定是否推迟此次竞选
+func (r *raft) deferCampaign() bool {
+	c := &r.campaign
+	if c.strategy == nil {
+		return false
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.failures == 0 {
+		return false
+	}
+	var peers []RaftPeer
+	for _, peer := range r.configs.GetConfig().GetPeers() {
+		if peer.Id != r.Id() {
+			peers = append(peers, peer)
+		}
+	}
+	decision := c.strategy.Campaign(CampaignAttempt{
+		Id:              r.Id(),
+		Failures:        c.failures,
+		Deferrals:       c.deferrals,
+		ElectionTimeout: r.electionTimeout,
+		Peers:           peers,
+	})
+	c.timeout = decision.ElectionTimeout
+	if !decision.Defer {
+		c.deferrals = 0
+		return false
+	}
+	c.deferrals++
+	r.metrics.IncrCounter(MetricElectionsDeferred, 1)
+	r.log(LogElection).Info("Election timeout, defer campaign", "failures", c.failures, "deferrals", c.deferrals)
+	return true
+}
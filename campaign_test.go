@@ -0,0 +1,93 @@
+package raft
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCampaignStrategy(t *testing.T) {
+	base := [2]time.Duration{100 * time.Millisecond, 200 * time.Millisecond}
+
+	t.Run("widen election timeout", func(t *testing.T) {
+		strategy := WidenElectionTimeout(50*time.Millisecond, 300*time.Millisecond)
+		for _, c := range []struct {
+			failures int
+			expect   time.Duration
+		}{
+			{failures: 1, expect: 250 * time.Millisecond},
+			{failures: 2, expect: 300 * time.Millisecond},
+			{failures: 5, expect: 300 * time.Millisecond},
+		} {
+			decision := strategy.Campaign(CampaignAttempt{Failures: c.failures, ElectionTimeout: base})
+			if decision.Defer || decision.ElectionTimeout != [2]time.Duration{base[0], c.expect} {
+				t.Errorf("expect election timeout [%s, %s) after %d failures but got %+v", base[0], c.expect, c.failures, decision)
+			}
+		}
+	})
+
+	t.Run("defer to priority", func(t *testing.T) {
+		strategy := DeferToPriority(map[RaftId]int{"a": 2, "b": 1}, 2)
+		peers := func(ids ...RaftId) []RaftPeer {
+			var peers []RaftPeer
+			for _, id := range ids {
+				peers = append(peers, RaftPeer{Id: id})
+			}
+			return peers
+		}
+		for _, c := range []struct {
+			name    string
+			attempt CampaignAttempt
+			expect  bool
+		}{
+			{name: "higher priority peer", attempt: CampaignAttempt{Id: "b", Failures: 1, Peers: peers("a", "c")}, expect: true},
+			{name: "highest priority", attempt: CampaignAttempt{Id: "a", Failures: 1, Peers: peers("b", "c")}},
+			{name: "deferred too many times", attempt: CampaignAttempt{Id: "c", Failures: 1, Deferrals: 2, Peers: peers("a", "b")}},
+		} {
+			if decision := strategy.Campaign(c.attempt); decision.Defer != c.expect {
+				t.Errorf("%s: expect defer %t but got %t", c.name, c.expect, decision.Defer)
+			}
+		}
+	})
+
+	t.Run("tracker", func(t *testing.T) {
+		var attempts []CampaignAttempt
+		strategy := CampaignStrategyFunc(func(attempt CampaignAttempt) CampaignDecision {
+			attempts = append(attempts, attempt)
+			return CampaignDecision{
+				ElectionTimeout: [2]time.Duration{time.Second, 2 * time.Second},
+				Defer:           attempt.Deferrals < 1,
+			}
+		})
+		rf, err := New("campaign", "campaign", nil, &memoryStore{}, &memoryLog{},
+			WithElection(base[0], base[1]), WithCampaignStrategy(strategy))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := rf.(*raft)
+
+		if r.deferCampaign() || len(attempts) != 0 {
+			t.Fatal("expect strategy not consulted before losing an election")
+		}
+		r.campaign.lost()
+		if !r.deferCampaign() {
+			t.Fatal("expect campaign deferred")
+		}
+		if timeout := r.randomElectionTimeout(); timeout < time.Second || timeout >= 2*time.Second {
+			t.Fatalf("expect election timeout in [1s, 2s) but got %s", timeout)
+		}
+		if r.deferCampaign() {
+			t.Fatal("expect campaign after deferring once")
+		}
+		if last := attempts[len(attempts)-1]; last.Failures != 1 || last.Deferrals != 1 || last.ElectionTimeout != base {
+			t.Fatalf("expect 1 failure, 1 deferral and the configured timeout but got %+v", last)
+		}
+
+		r.recordLeadership(1, "leader", 0, LeadershipReasonObserved)
+		if r.deferCampaign() {
+			t.Fatal("expect failures cleared after discovering a leader")
+		}
+		if timeout := r.randomElectionTimeout(); timeout < base[0] || timeout >= base[1] {
+			t.Fatalf("expect configured election timeout but got %s", timeout)
+		}
+	})
+}
@@ -15,12 +15,20 @@ type candidate struct {
 
 func (c *candidate) Run() (server, error) {
 	config := c.raft.configs.GetConfig()
+	if config.IsStandalone(c.Id()) {
+		// the vote for self is already a majority,
+		// never run elections against absent peers
+		c.log(LogElection).Debug("Standalone, skip election")
+		return c.toLeader()
+	}
 	peers := config.GetPeers()
 	voteCh, err := c.elect(peers)
 	if err != nil {
 		return nil, err
 	}
 	decider := config.NewDecider()
+	// preVote result of the in-progress pre-vote
+	var preVote <-chan bool
 
 	for {
 		select {
@@ -34,14 +42,51 @@ func (c *candidate) Run() (server, error) {
 			if converted {
 				return server, nil
 			}
+		case term := <-c.leaderDiscovered:
+			server, converted, err := c.stepDown(term)
+			if err != nil {
+				return nil, err
+			}
+			if converted {
+				return server, nil
+			}
 		case <-c.ticker.C:
-			c.debug("Election timeout")
+			c.campaign.lost()
+			if c.deferCampaign() {
+				// wait for a higher-priority peer
+				return c.toFollower(c.GetCurrentTerm())
+			}
+			if c.cooldown.enabled() {
+				// lost the election, wait before campaigning again
+				c.cooldown.lost(c.now())
+				c.log(LogElection).Debug("Lost the election, cool down")
+				return c.toFollower(c.GetCurrentTerm())
+			}
+			if c.refuseCampaign() {
+				// wait for a more up-to-date leader
+				return c.toFollower(c.GetCurrentTerm())
+			}
+			if c.preVoteEnabled() {
+				// start new election only if a majority would vote for us
+				if preVote == nil {
+					preVote = c.startPreVote()
+				}
+				continue
+			}
+			c.log(LogElection).Debug("Election timeout")
 			// If election timeout elapses:
 			//	start new election
-			return c.toCandidate(), nil
+			return c.toCandidate()
+		case won := <-preVote:
+			preVote = nil
+			if !won {
+				continue
+			}
+			c.log(LogElection).Debug("Election timeout, won pre-vote")
+			return c.toCandidate()
 		case voterId, ok := <-voteCh:
 			if !ok {
-				c.debug("Failed to win the election")
+				c.log(LogElection).Debug("Failed to win the election")
 				voteCh = (<-chan RaftId)(nil)
 				continue
 			}
@@ -50,7 +95,7 @@ func (c *candidate) Run() (server, error) {
 			//  majority of servers: become leader
 			decider.AddVote(voterId)
 			if decider.HasAchievedMajority() {
-				c.debug("Achieved Majority vote(%v)", decider.Counts())
+				c.log(LogElection).Info("Achieved majority vote", "counts", decider.Counts())
 				return c.toLeader()
 			}
 		}
@@ -59,12 +104,12 @@ func (c *candidate) Run() (server, error) {
 }
 
 func (c *candidate) Handle(context.Context, ...Command) error {
-	return ErrIsNotLeader
+	return c.notLeader()
 }
 
 func (c *candidate) ResetTimer() {
 	c.once.Do(func() {
-		c.debug("Reset election timer")
+		c.log(LogElection).Debug("Reset election timer")
 		timeout := c.randomElectionTimeout()
 		c.ticker.Reset(timeout)
 	})
@@ -86,18 +131,51 @@ func (c *candidate) String() string {
 // 	state. If the term in the RPC is smaller than the candidate’s
 // 	current term, then the candidate rejects the RPC and continues in candidate state.
 func (c *candidate) reactToRPCArgs(args rpcArgs) (server server, converted bool, err error) {
-	if args.getType() == rpcArgsTypeAppendEntriesArgs {
-		if args.getTerm() >= c.GetCurrentTerm() {
-			server, err = c.toFollower(args.getTerm())
-			if err != nil {
-				return nil, false, err
+	switch args.getType() {
+	case rpcArgsTypeAppendEntriesArgs, rpcArgsTypeInstallSnapshotArgs:
+		return c.stepDown(args.getTerm())
+	}
+	return c.raft.reactToRPCArgs(args)
+}
+
+// discoverLeader 通知 candidate 收到了 term 的 Leader 的 AppendEntries
+//
+// rpcArgs 在 candidate 未就绪时会被丢弃, 而 candidate 只重置一次选举计时器,
+// 错过 Leader 的 AppendEntries 会使其在超时后以更大的 term 发起选举, 干扰已当选的 Leader.
+// 因此单独通知, 保证 candidate 一定能发现 Leader.
+func (c *candidate) discoverLeader(term uint64) {
+	for {
+		select {
+		case c.leaderDiscovered <- term:
+			return
+		default:
+			// no-op
+		}
+		// replace the pending discovery, which may be left over from a previous election
+		select {
+		case pending := <-c.leaderDiscovered:
+			if pending > term {
+				term = pending
 			}
-			return server, true, nil
-		} else {
-			return nil, false, nil
+		default:
+			// no-op
 		}
 	}
-	return c.raft.reactToRPCArgs(args)
+}
+
+// stepDown 收到 term 的 Leader 的 AppendEntries 时转换为 follower 并重置选举计时器
+//
+// 之前选举遗留的通知 term 一定小于当前 term, 会被忽略
+func (c *candidate) stepDown(term uint64) (server server, converted bool, err error) {
+	if term < c.GetCurrentTerm() {
+		return nil, false, nil
+	}
+	c.log(LogElection).Debug("Discovered leader, step down", "leaderTerm", term)
+	server, err = c.toFollower(term)
+	if err != nil {
+		return nil, false, err
+	}
+	return server, true, nil
 }
 
 // elect
@@ -114,6 +192,8 @@ func (c *candidate) elect(peers []RaftPeer) (<-chan RaftId, error) {
 		CandidateId:  c.Id(),
 		LastLogIndex: lastLogIndex,
 		LastLogTerm:  lastLogTerm,
+		// elected in the first election after TimeoutNow
+		LeadershipTransfer: c.transfer.inTerm(c.GetCurrentTerm() - 1),
 	}
 
 	voteCh := make(chan RaftId, len(peers))
@@ -122,7 +202,7 @@ func (c *candidate) elect(peers []RaftPeer) (<-chan RaftId, error) {
 		defer close(voteCh)
 		var wg sync.WaitGroup
 		for _, peer := range peers {
-			id, addr := peer.Id, peer.Addr
+			id, addr := peer.Id, c.resolve(peer)
 			if c.Id() == id {
 				voteCh <- id
 				continue
@@ -132,17 +212,19 @@ func (c *candidate) elect(peers []RaftPeer) (<-chan RaftId, error) {
 			go func() {
 				defer wg.Done()
 
-				c.debug("-> Request a vote %s", id)
+				c.log(LogElection).Debug("-> Request a vote", "peer", id)
 				results, err := c.rpc.CallRequestVote(addr, args)
 				if err != nil {
-					c.debug("Call %s's RequestVote, err: %+v", id, err)
+					c.log(LogTransport).Debug("Call RequestVote", "peer", id, "err", err)
 					return
 				}
+				c.observeProtocolVersion(id, results.ProtocolVersion)
+				c.divergence.observe(results.CommitIndex)
 				if results.VoteGranted {
-					c.debug("<- Vote up %s", id)
+					c.log(LogElection).Debug("<- Vote up", "peer", id)
 					voteCh <- id
 				} else {
-					c.debug("<- Vote down %s", id)
+					c.log(LogElection).Debug("<- Vote down", "peer", id)
 				}
 			}()
 		}
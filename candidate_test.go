@@ -0,0 +1,54 @@
+package raft
+
+import "testing"
+
+func TestCandidateStepDown(t *testing.T) {
+	r, err := New("candidate", "candidate", nil, nil, nil, WithDevMode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &candidate{raft: r.(*raft)}
+	c.SetCurrentTerm(3)
+
+	t.Run("stale leader", func(t *testing.T) {
+		_, converted, err := c.reactToRPCArgs(AppendEntriesArgs{Term: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if converted {
+			t.Error("expect candidate to reject leader with smaller term")
+		}
+	})
+
+	t.Run("leader of current term", func(t *testing.T) {
+		server, converted, err := c.reactToRPCArgs(AppendEntriesArgs{Term: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := server.(*follower); !converted || !ok {
+			t.Errorf("expect converting to follower but got %v", server)
+		}
+		if term := c.GetCurrentTerm(); term != 3 {
+			t.Errorf("expect term 3 but got %d", term)
+		}
+	})
+
+	t.Run("discover leader", func(t *testing.T) {
+		// left over from a previous election
+		c.discoverLeader(1)
+		c.discoverLeader(4)
+		server, converted, err := c.stepDown(<-c.leaderDiscovered)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := server.(*follower); !converted || !ok {
+			t.Errorf("expect converting to follower but got %v", server)
+		}
+		if term := c.GetCurrentTerm(); term != 4 {
+			t.Errorf("expect term 4 but got %d", term)
+		}
+		if len(c.leaderDiscovered) != 0 {
+			t.Errorf("expect no pending discovery but got %d", len(c.leaderDiscovered))
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package raft
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrCatchingUp 节点重启后还未应用到从 Leader 得知的 commitIndex, 拒绝读请求
+var ErrCatchingUp = errors.New("err: raft consensus module is catching up with leader")
+
+// catchUp 启动后追赶 Leader 的进度
+//
+// 重启的节点在应用到启动后第一次从 Leader 得知的 commitIndex 之前处于追赶状态,
+// 此时状态机可能严重落后, 不应对外提供读服务. 追上之后不再回到追赶状态.
+type catchUp struct {
+	// target 启动后第一次从 Leader 得知的 commitIndex
+	target uint64
+	// known 是否已得知 target
+	known int32
+	// done 是否已追上
+	done int32
+}
+
+// observe 记录从 Leader 得知的 commitIndex, 只有第一次有效
+func (c *catchUp) observe(commitIndex uint64) {
+	if atomic.LoadInt32(&c.known) == 1 {
+		return
+	}
+	atomic.StoreUint64(&c.target, commitIndex)
+	atomic.StoreInt32(&c.known, 1)
+}
+
+// caughtUp lastApplied 是否已追上 target
+func (c *catchUp) caughtUp(lastApplied uint64) bool {
+	if atomic.LoadInt32(&c.done) == 1 {
+		return true
+	}
+	if atomic.LoadInt32(&c.known) == 0 || lastApplied < atomic.LoadUint64(&c.target) {
+		return false
+	}
+	atomic.StoreInt32(&c.done, 1)
+	return true
+}
+
+// catchingUp 是否正在追赶 Leader
+// Leader 的 commitIndex 即是最新的, 不处于追赶状态
+func (r *raft) catchingUp() bool {
+	if r.probe.probing() {
+		return true
+	}
+	if r.IsLeader() {
+		return false
+	}
+	return !r.catchup.caughtUp(r.GetLastApplied())
+}
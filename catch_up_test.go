@@ -0,0 +1,40 @@
+package raft
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCatchUp(t *testing.T) {
+	t.Run("tracker", func(t *testing.T) {
+		var c catchUp
+		if c.caughtUp(10) {
+			t.Error("expect catching up before learning leader's commit index")
+		}
+		c.observe(5)
+		c.observe(8) // only the first commit index counts
+		if c.caughtUp(4) {
+			t.Error("expect catching up before applying to 5")
+		}
+		if !c.caughtUp(5) {
+			t.Error("expect caught up after applying to 5")
+		}
+		if !c.caughtUp(0) {
+			t.Error("expect staying caught up")
+		}
+	})
+
+	t.Run("read denial", func(t *testing.T) {
+		r, err := New("restarted", "restarted", nil, &memoryStore{}, &memoryLog{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !r.Stats().CatchingUp {
+			t.Error("expect catching up before learning leader's commit index")
+		}
+		_, err = r.ReadIndex(context.Background())
+		if err != ErrCatchingUp {
+			t.Errorf("expect %v but got %v", ErrCatchingUp, err)
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package raft
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNoQuorum Leader 与多数节点失去联系超过 WithQuorumLossTimeout, 拒绝提案
+// 已在等待复制的提案返回 ErrNoQuorum 时结果未知, 恢复联系后仍可能被 commit
+var ErrNoQuorum = errors.New("err: leader has lost contact with a majority")
+
+// contactTracker 记录 Leader 最近一次联系上各 peer 的时间
+//
+// 只要 peer 响应了 RPC 就视为联系上, 不论响应是否成功.
+// 记录的是发出 RPC 的时间, 而不是收到响应的时间, peer 至少在该时间之后
+// 仍认可本节点是 Leader, 见 LeaseRead.
+type contactTracker struct {
+	// since 成为 Leader 的时间, 尚未响应过的 peer 视为在此时联系过
+	since time.Time
+
+	mux   sync.Mutex
+	peers map[RaftId]time.Time
+}
+
+// observe 记录 peer 响应了在 sentAt 发出的 RPC
+func (c *contactTracker) observe(id RaftId, sentAt time.Time) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.peers == nil {
+		c.peers = make(map[RaftId]time.Time)
+	}
+	// concurrent RPCs may complete out of order
+	if sentAt.After(c.peers[id]) {
+		c.peers[id] = sentAt
+	}
+}
+
+// acked peer 最近一次响应的 RPC 的发出时间, 尚未响应过时 ok 为 false
+func (c *contactTracker) acked(id RaftId) (sentAt time.Time, ok bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	sentAt, ok = c.peers[id]
+	return sentAt, ok
+}
+
+// lastContact 最近一次联系上 peer 的时间
+func (c *contactTracker) lastContact(id RaftId) time.Time {
+	sentAt, ok := c.acked(id)
+	if !ok {
+		return c.since
+	}
+	return sentAt
+}
+
+// checkQuorum 检查在一个选举超时内是否与多数节点保持联系
+//
+// 被分区的 Leader 无法得知已经选出了新的 Leader, 若不主动退位会一直
+// 接受注定无法 commit 的提案.
+func (l *leader) checkQuorum() bool {
+	return l.contactedQuorum(l.electionTimeout[1])
+}
+
+// contactedQuorum 在 timeout 内是否与多数节点保持联系
+func (l *leader) contactedQuorum(timeout time.Duration) bool {
+	config := l.configs.GetConfig()
+	if config.IsStandalone(l.Id()) {
+		return true
+	}
+	decider := config.NewDecider()
+	for _, peer := range config.GetPeers() {
+		if peer.Id == l.Id() || l.now().Sub(l.contact.lastContact(peer.Id)) <= timeout {
+			decider.AddVote(peer.Id)
+		}
+	}
+	return decider.HasAchievedMajority()
+}
+
+// detectQuorumLoss 与多数节点失去联系超过 WithQuorumLossTimeout 时进入降级模式,
+// 恢复联系后退出, 分别发出 EventQuorumLost 与 EventQuorumRestored
+//
+// 降级期间新的提案立即返回 ErrNoQuorum, 等待复制的提案也不再等到超时.
+// 失去联系超过选举超时上界时 Leader 退位, 见 checkQuorum.
+func (l *leader) detectQuorumLoss() {
+	if l.quorumLossTimeout <= 0 {
+		return
+	}
+	var lost int32
+	if !l.contactedQuorum(l.quorumLossTimeout) {
+		lost = 1
+	}
+	if atomic.SwapInt32(&l.quorumLost, lost) == lost {
+		return
+	}
+	if lost == 0 {
+		l.emit(Event{Type: EventQuorumRestored, Level: EventLevelInfo, Message: "regained contact with a majority"})
+		return
+	}
+	l.emit(Event{Type: EventQuorumLost, Level: EventLevelWarning, Message: "lost contact with a majority"})
+	// proposals waiting for replication only re-check noQuorum on progress,
+	// which never comes without a majority, see TestQuorumLossTimeout
+	l.replicators.progressed()
+}
+
+// noQuorum 是否处于降级模式
+func (l *leader) noQuorum() bool {
+	return atomic.LoadInt32(&l.quorumLost) != 0
+}
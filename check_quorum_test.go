@@ -0,0 +1,122 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckQuorum(t *testing.T) {
+	fsm := &listFSM{}
+	sink := &countingSink{}
+	r, err := New("check-quorum", "check-quorum", fsm.apply, nil, nil, WithDevMode(), WithMetrics(sink))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	go r.Run()
+
+	follower := runLoopbackFollower(t, "check-quorum-follower")
+	err = r.AddVoter(context.Background(), follower.Id(), follower.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// keeps leadership while in contact with a majority
+	time.Sleep(300 * time.Millisecond)
+	if !r.IsLeader() {
+		t.Fatal("expect remain leader while follower responds")
+	}
+
+	follower.Stop()
+	deadline := time.Now().Add(3 * time.Second)
+	for r.IsLeader() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if r.IsLeader() {
+		t.Fatal("expect leader stepped down after losing contact with a majority")
+	}
+	if got := sink.counter(MetricQuorumLost); got != 1 {
+		t.Errorf("expect %s 1 but got %v", MetricQuorumLost, got)
+	}
+}
+
+func TestQuorumLossTimeout(t *testing.T) {
+	events := make(chan Event, 16)
+	observer := func(event Event) {
+		switch event.Type {
+		case EventQuorumLost, EventQuorumRestored:
+			events <- event
+		}
+	}
+	r, err := New("quorum-loss", "quorum-loss", (&listFSM{}).apply, nil, nil, WithDevMode(),
+		// steps down long after the quorum loss is detected
+		WithElection(time.Second, 3*time.Second),
+		WithQuorumLossTimeout(200*time.Millisecond),
+		WithObserver(observer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	go r.Run()
+
+	follower := runLoopbackFollower(t, "quorum-loss-follower")
+	err = r.AddVoter(context.Background(), follower.Id(), follower.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Handle(context.Background(), Command("before"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	follower.Stop()
+	// the address is released after the follower stopped
+	for {
+		if _, ok := loopbackServices.Load(string(follower.Addr())); !ok {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	start := time.Now()
+	err = r.Handle(ctx, Command("waiting"))
+	if !errors.Is(err, ErrNoQuorum) {
+		t.Fatalf("expect %v but got %v", ErrNoQuorum, err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expect waiting proposal failed fast but took %v", elapsed)
+	}
+	select {
+	case event := <-events:
+		if event.Type != EventQuorumLost || event.Level != EventLevelWarning {
+			t.Errorf("expect warning %v but got %v %v", EventQuorumLost, event.Level, event.Type)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expect %v", EventQuorumLost)
+	}
+	if !r.IsLeader() {
+		t.Fatal("expect remain leader before the election timeout")
+	}
+	err = r.Handle(context.Background(), Command("degraded"))
+	if !errors.Is(err, ErrNoQuorum) {
+		t.Fatalf("expect %v but got %v", ErrNoQuorum, err)
+	}
+
+	follower = runLoopbackFollower(t, "quorum-loss-follower")
+	defer follower.Stop()
+	select {
+	case event := <-events:
+		if event.Type != EventQuorumRestored {
+			t.Errorf("expect %v but got %v", EventQuorumRestored, event.Type)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expect %v", EventQuorumRestored)
+	}
+	err = r.Handle(context.Background(), Command("after"))
+	if err != nil {
+		t.Fatalf("expect proposal succeeded after quorum restored but got %v", err)
+	}
+}
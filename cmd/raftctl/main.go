@@ -0,0 +1,149 @@
+// Command raftctl raft 集群的运维工具, 通过节点的 http 管理接口操作集群
+//
+//	raftctl status -addr http://10.0.0.1:8080/raft
+//	raftctl transfer -addr http://10.0.0.1:8080/raft -target 2
+//	raftctl quarantine -addr http://10.0.0.1:8080/raft -peer 3 [-release]
+//	raftctl rolling-restart -nodes 1=http://10.0.0.1:8080/raft,2=http://10.0.0.2:8080/raft \
+//		-restart 'ssh {id} systemctl restart raft'
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/mind1949/raft"
+	"github.com/mind1949/raft/admin"
+	"github.com/mind1949/raft/raftops"
+)
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		usage()
+	}
+	commands := map[string]func(args []string) error{
+		"status":          status,
+		"transfer":        transfer,
+		"quarantine":      quarantine,
+		"rolling-restart": rollingRestart,
+	}
+	command, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+	}
+	if err := command(os.Args[2:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: raftctl <status|transfer|quarantine|rolling-restart> [flags]")
+	os.Exit(2)
+}
+
+func status(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	addr := fs.String("addr", "", "admin address of the node")
+	fs.Parse(args)
+
+	status, err := admin.NewClient(*addr).Status(context.Background())
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(status)
+}
+
+func transfer(args []string) error {
+	fs := flag.NewFlagSet("transfer", flag.ExitOnError)
+	addr := fs.String("addr", "", "admin address of the leader")
+	target := fs.String("target", "", "id of the new leader")
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout")
+	fs.Parse(args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	return admin.NewClient(*addr).TransferLeadership(ctx, raft.RaftId(*target))
+}
+
+// quarantine 在节点上隔离或解除隔离 peer, 未指定 -peer 时列出被隔离的 peer
+//
+// 隔离只对该节点生效, 需要在每个节点上分别执行.
+func quarantine(args []string) error {
+	fs := flag.NewFlagSet("quarantine", flag.ExitOnError)
+	addr := fs.String("addr", "", "admin address of the node")
+	peer := fs.String("peer", "", "id of the peer to quarantine")
+	release := fs.Bool("release", false, "release the peer from quarantine")
+	fs.Parse(args)
+
+	client := admin.NewClient(*addr)
+	ctx := context.Background()
+	switch {
+	case *peer == "":
+		ids, err := client.Quarantined(ctx)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			fmt.Println(id)
+		}
+		return nil
+	case *release:
+		return client.Unquarantine(ctx, raft.RaftId(*peer))
+	default:
+		return client.Quarantine(ctx, raft.RaftId(*peer))
+	}
+}
+
+func rollingRestart(args []string) error {
+	fs := flag.NewFlagSet("rolling-restart", flag.ExitOnError)
+	nodesFlag := fs.String("nodes", "", "comma separated id=admin-address of all nodes")
+	restart := fs.String("restart", "", "shell command restarting a node, {id} is replaced by the node's id")
+	maxLag := fs.Uint64("max-lag", 64, "max entries a node may lag behind the leader to be considered healthy")
+	poll := fs.Duration("poll", time.Second, "interval of checking cluster status")
+	timeout := fs.Duration("timeout", 30*time.Minute, "timeout of the whole rolling restart")
+	fs.Parse(args)
+
+	nodes, err := parseNodes(*nodesFlag)
+	if err != nil {
+		return err
+	}
+	if *restart == "" {
+		return errors.New("missing -restart")
+	}
+	cluster := raftops.NewHTTPCluster(nodes, func(ctx context.Context, node raftops.Node) error {
+		command := strings.ReplaceAll(*restart, "{id}", string(node.Id))
+		cmd := exec.CommandContext(ctx, "sh", "-c", command)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		return cmd.Run()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	return raftops.RollingRestart(ctx, cluster,
+		raftops.WithMaxLag(*maxLag),
+		raftops.WithPollInterval(*poll),
+		raftops.WithLogf(log.Printf))
+}
+
+// parseNodes 解析 id=addr,id=addr
+func parseNodes(s string) ([]raftops.Node, error) {
+	var nodes []raftops.Node
+	for _, pair := range strings.Split(s, ",") {
+		id, addr, ok := strings.Cut(pair, "=")
+		if !ok || id == "" || addr == "" {
+			return nil, fmt.Errorf("invalid node %q, expect id=admin-address", pair)
+		}
+		nodes = append(nodes, raftops.Node{Id: raft.RaftId(id), Admin: addr})
+	}
+	return nodes, nil
+}
@@ -1,5 +1,10 @@
 package raft
 
+import (
+	"context"
+	"fmt"
+)
+
 // Command 一致性模型需要提交, 状态机需要处理的命令
 type Command []byte
 
@@ -9,25 +14,191 @@ type Commands interface {
 	Data() []Command
 }
 
+// ResultSetter 可由 Commands 实现, 设置命令的应用结果
+// raft 传给 Apply 的 Commands 均已实现, 使用 SetResult 设置
+type ResultSetter interface {
+	// SetResult 设置第 i 个命令的应用结果, Propose 将其返回给提交者
+	SetResult(i int, result Result)
+}
+
+// SetResult 设置 commands 中第 i 个命令的应用结果
+// commands 未实现 ResultSetter 时忽略
+func SetResult(commands Commands, i int, result Result) {
+	if s, ok := commands.(ResultSetter); ok {
+		s.SetResult(i, result)
+	}
+}
+
+// CommandEntries 可由 Commands 实现, 获取命令所在的 log entry
+// raft 传给 Apply 的 Commands 均已实现, 使用 EntriesOf 获取
+type CommandEntries interface {
+	// Entries 获取命令所在的 log entry, 与 Data 一一对应
+	Entries() []LogEntry
+}
+
+// EntriesOf 获取 commands 中命令所在的 log entry, 与 Data 一一对应
+// commands 未实现 CommandEntries 时, log entry 只包含命令
+func EntriesOf(commands Commands) []LogEntry {
+	if c, ok := commands.(CommandEntries); ok {
+		return c.Entries()
+	}
+	data := commands.Data()
+	entries := make([]LogEntry, len(data))
+	for i, cmd := range data {
+		entries[i] = LogEntry{Type: logEntryTypeCommand, Command: cmd}
+	}
+	return entries
+}
+
+// proposerKey context 中 proposer 的 key
+type proposerKey struct{}
+
+// WithProposer 在 ctx 中记录提交命令的客户端, Handle 将其写入 log entry
+//
+//	err := r.Handle(raft.WithProposer(ctx, "alice"), cmd)
+func WithProposer(ctx context.Context, proposer string) context.Context {
+	return context.WithValue(ctx, proposerKey{}, proposer)
+}
+
+// ProposerFromContext 获取 ctx 中记录的 proposer
+func ProposerFromContext(ctx context.Context) string {
+	proposer, _ := ctx.Value(proposerKey{}).(string)
+	return proposer
+}
+
+// Acknowledgement Handle 返回的时机
+type Acknowledgement uint8
+
+const (
+	// AckApplied 应用到 Leader 的状态机后返回, 之后在 Leader 上的读取可以看到本次写入, 默认
+	AckApplied Acknowledgement = iota
+	// AckCommitted 复制到多数派并 commit 后返回, 应用到状态机异步进行;
+	// 写入已持久, 但返回时 Leader 的状态机可能还没有应用
+	AckCommitted
+)
+
+func (a Acknowledgement) String() string {
+	switch a {
+	case AckApplied:
+		return "Applied"
+	case AckCommitted:
+		return "Committed"
+	default:
+		return "Unknown Acknowledgement"
+	}
+}
+
+// acknowledgementKey context 中 Acknowledgement 的 key
+type acknowledgementKey struct{}
+
+// WithAcknowledgement 在 ctx 中记录本次 Handle 返回的时机
+//
+// 同一应用的不同接口可以选择不同的延迟与一致性:
+//
+//	err := r.Handle(raft.WithAcknowledgement(ctx, raft.AckCommitted), cmd)
+//
+// Propose 需要应用结果, 总是在应用后返回.
+func WithAcknowledgement(ctx context.Context, ack Acknowledgement) context.Context {
+	return context.WithValue(ctx, acknowledgementKey{}, ack)
+}
+
+// AcknowledgementFromContext 获取 ctx 中记录的 Acknowledgement, 没有时为 AckApplied
+func AcknowledgementFromContext(ctx context.Context) Acknowledgement {
+	ack, _ := ctx.Value(acknowledgementKey{}).(Acknowledgement)
+	return ack
+}
+
+// ExtensionIdempotencyKey log entry 扩展字段中幂等键的名字, 见 WithIdempotencyKey
+const ExtensionIdempotencyKey = "raft.idempotency_key"
+
+// idempotencyKey context 中幂等键的 key
+type idempotencyKey struct{}
+
+// WithIdempotencyKey 在 ctx 中记录本次提交的幂等键, Handle 将其写入 log entry 的扩展字段
+//
+// 启用 WithDedupWindow 时, 超时后重试的提交不会被重复应用.
+// 一次提交多个 command 时, 第 i 个 command 的幂等键为 key/i.
+//
+//	err := r.Handle(raft.WithIdempotencyKey(ctx, requestId), cmd)
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// IdempotencyKeyFromContext 获取 ctx 中记录的幂等键
+func IdempotencyKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKey{}).(string)
+	return key
+}
+
+// proposalExtensions 一次提交 n 个 command 时第 i 个 command 的 log entry 扩展字段
+func proposalExtensions(ctx context.Context, i, n int) map[string][]byte {
+	var extensions map[string][]byte
+	if key := IdempotencyKeyFromContext(ctx); key != "" {
+		if n > 1 {
+			key = fmt.Sprintf("%s/%d", key, i)
+		}
+		extensions = map[string][]byte{ExtensionIdempotencyKey: []byte(key)}
+	}
+	if id, ok := ctx.Value(proposalIdKey{}).(string); ok {
+		if extensions == nil {
+			extensions = make(map[string][]byte)
+		}
+		extensions[extensionProposalId] = []byte(id)
+	}
+	return extensions
+}
+
 func newCommands(entries []LogEntry) *commands {
 	var data = make([]Command, 0, len(entries))
+	var commandEntries = make([]LogEntry, 0, len(entries))
 	for i := range entries {
 		if entries[i].Type == logEntryTypeCommand {
 			data = append(data, entries[i].Command)
+			commandEntries = append(commandEntries, entries[i])
 		}
 	}
 	return &commands{
-		data: data,
+		data:    data,
+		entries: commandEntries,
 	}
 }
 
-var _ Commands = (*commands)(nil)
+var (
+	_ Commands       = (*commands)(nil)
+	_ CommandEntries = (*commands)(nil)
+	_ ResultSetter   = (*commands)(nil)
+)
 
 // commands 实现 Commands
 type commands struct {
-	data []Command
+	data    []Command
+	entries []LogEntry
+	results []Result
 }
 
 func (c *commands) Data() []Command {
 	return c.data
 }
+
+func (c *commands) Entries() []LogEntry {
+	return c.entries
+}
+
+// SetResult i 超出命令序列范围时忽略
+func (c *commands) SetResult(i int, result Result) {
+	if i < 0 || i >= len(c.data) {
+		return
+	}
+	if c.results == nil {
+		c.results = make([]Result, len(c.data))
+	}
+	c.results[i] = result
+}
+
+// result 第 i 个命令的应用结果, 未设置时为 nil
+func (c *commands) result(i int) Result {
+	if i >= len(c.results) {
+		return nil
+	}
+	return c.results[i]
+}
@@ -0,0 +1,113 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrCompactionVetoed       = errors.New("err: log compaction vetoed by hook")
+	ErrCompactBeyondLastIndex = errors.New("err: compact index beyond last log entry")
+)
+
+// CompactionRange 即将因压缩而被丢弃的 log entry 区间 [FirstIndex, LastIndex]
+type CompactionRange struct {
+	FirstIndex uint64
+	LastIndex  uint64
+	// SnapshotId 覆盖该区间的快照 id
+	SnapshotId string
+}
+
+// CompactionHook 截断 log 前调用的钩子, 供外部备份程序订阅
+//
+// 钩子可以阻塞直到区间内的 log entry 归档完成(延迟压缩),
+// 也可以返回 error 否决此次压缩, 被否决的区间会在下一次压缩时再次提交给钩子,
+// 从而保证集群外的归档不会出现空洞.
+type CompactionHook func(ctx context.Context, rng CompactionRange) error
+
+// defaultCompactionHookTimeout 钩子的默认超时时间
+const defaultCompactionHookTimeout = 30 * time.Second
+
+// beforeCompaction 依序调用所有 CompactionHook
+// 任一钩子返回 error 或超时, 都视为否决此次压缩
+func (r *raft) beforeCompaction(rng CompactionRange) error {
+	for _, hook := range r.compactionHooks {
+		err := func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), r.compactionHookTimeout)
+			defer cancel()
+			return hook(ctx, rng)
+		}()
+		if err != nil {
+			r.log(LogApply).Info("Compaction vetoed", "firstIndex", rng.FirstIndex, "lastIndex", rng.LastIndex, "err", err)
+			return fmt.Errorf("%w: %v", ErrCompactionVetoed, err)
+		}
+	}
+	return nil
+}
+
+// logRetention 快照之后仍保留的 log entry
+//
+// 稍微落后的 Follower 可以通过日志复制追上, 无需安装代价高昂的快照.
+type logRetention struct {
+	// entries 保留快照之前最新的 entries 个 log entry
+	entries uint64
+	// age 保留 AppendTime 在 age 之内的 log entry
+	age time.Duration
+}
+
+// compactionRange 快照覆盖 [firstIndex, snapshotIndex] 时, 在保留策略下可以丢弃的区间
+// 没有可以丢弃的 log entry 时 ok 为 false
+func (r *raft) compactionRange(firstIndex, snapshotIndex uint64, snapshotId string) (rng CompactionRange, ok bool, err error) {
+	lastIndex := snapshotIndex
+	if n := r.retention.entries; n > 0 {
+		if lastIndex <= n {
+			return rng, false, nil
+		}
+		lastIndex -= n
+	}
+	if age := r.retention.age; age > 0 && lastIndex >= firstIndex {
+		// 找到第一个在 age 之内追加的 log entry, 保留它及之后的 log entry
+		deadline := r.now().Add(-age)
+		retained, err := searchAppendTime(r.Log, firstIndex, lastIndex, deadline)
+		if err != nil {
+			return rng, false, err
+		}
+		lastIndex = retained - 1
+	}
+	if lastIndex < firstIndex {
+		return rng, false, nil
+	}
+	return CompactionRange{FirstIndex: firstIndex, LastIndex: lastIndex, SnapshotId: snapshotId}, true, nil
+}
+
+// appendTimeScanBatch searchAppendTime 每次读取的 log entry 数量
+const appendTimeScanBatch = 256
+
+// searchAppendTime 返回 [lo, hi] 中第一个在 deadline 之后追加的 log entry 的索引, 都不是时返回 hi+1
+// 没有 AppendTime 的 log entry 视为很早之前追加的
+//
+// AppendTime 来自各任 Leader 的时钟, 时钟偏移时不随索引递增, 因此依序扫描而不是二分查找.
+func searchAppendTime(log Log, lo, hi uint64, deadline time.Time) (uint64, error) {
+	for lo <= hi {
+		end := hi
+		if end-lo >= appendTimeScanBatch {
+			end = lo + appendTimeScanBatch - 1
+		}
+		entries, err := log.RangeGet(lo-1, end)
+		if err != nil {
+			return 0, err
+		}
+		if len(entries) == 0 {
+			break
+		}
+		for i, entry := range entries {
+			if entry.AppendTime.After(deadline) {
+				return lo + uint64(i), nil
+			}
+		}
+		lo += uint64(len(entries))
+	}
+	return hi + 1, nil
+}
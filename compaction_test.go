@@ -0,0 +1,88 @@
+package raft
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompactionRange(t *testing.T) {
+	log := &memoryLog{}
+	now := time.Now()
+	for i := 1; i <= 10; i++ {
+		// entries 1~5 were appended an hour ago
+		appendTime := now.Add(-time.Hour)
+		if i > 5 {
+			appendTime = now
+		}
+		err := log.Append(LogEntry{Term: 1, Command: Command("c"), AppendTime: appendTime})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, c := range []struct {
+		name      string
+		retention logRetention
+		ok        bool
+		lastIndex uint64
+	}{
+		{name: "no retention", ok: true, lastIndex: 8},
+		{name: "entries", retention: logRetention{entries: 4}, ok: true, lastIndex: 4},
+		{name: "age", retention: logRetention{age: time.Minute}, ok: true, lastIndex: 5},
+		{name: "entries and age", retention: logRetention{entries: 1, age: time.Minute}, ok: true, lastIndex: 5},
+		{name: "retain all", retention: logRetention{entries: 8}, ok: false},
+		{name: "retain all by age", retention: logRetention{age: 2 * time.Hour}, ok: false},
+	} {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			r := &raft{Log: log, retention: c.retention}
+			rng, ok, err := r.compactionRange(1, 8, "snapshot")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != c.ok {
+				t.Fatalf("expect ok %t but got %t", c.ok, ok)
+			}
+			if ok && (rng.FirstIndex != 1 || rng.LastIndex != c.lastIndex || rng.SnapshotId != "snapshot") {
+				t.Errorf("expect [1, %d] of snapshot but got %+v", c.lastIndex, rng)
+			}
+		})
+	}
+
+	t.Run("virtual clock", func(t *testing.T) {
+		// entries 1~5 were appended 30 seconds ago in virtual time
+		virtual := now.Add(-time.Hour + 30*time.Second)
+		r := &raft{Log: log, retention: logRetention{age: time.Minute},
+			tickers: newManualTickerPool(func() time.Time { return virtual })}
+		_, ok, err := r.compactionRange(1, 8, "snapshot")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			t.Error("expect entries retained by virtual time")
+		}
+	})
+
+	t.Run("clock skew", func(t *testing.T) {
+		log := &memoryLog{}
+		for i := 1; i <= 10; i++ {
+			// entries 4~7 were appended by a leader whose clock was behind
+			appendTime := now.Add(-time.Hour)
+			if i == 3 || i > 7 {
+				appendTime = now
+			}
+			err := log.Append(LogEntry{Term: 1, Command: Command("c"), AppendTime: appendTime})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		r := &raft{Log: log, retention: logRetention{age: time.Minute}}
+		rng, ok, err := r.compactionRange(1, 8, "snapshot")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok || rng.LastIndex != 2 {
+			t.Errorf("expect [1, 2] but got %+v, ok: %t", rng, ok)
+		}
+	})
+}
@@ -8,6 +8,10 @@ import (
 	"sync"
 )
 
+var (
+	ErrConfigChangeInProgress = errors.New("err: a previous configuration change is still in progress")
+)
+
 // RaftPeer raft peer
 type RaftPeer struct {
 	Id   RaftId
@@ -18,6 +22,45 @@ func (p RaftPeer) String() string {
 	return fmt.Sprintf("(%s, %s)", p.Id, p.Addr)
 }
 
+// Configuration 集群配置
+type Configuration struct {
+	// Index 配置对应的 log entry index
+	Index uint64
+	// Peers 配置中的所有 peer
+	Peers []RaftPeer
+	// Joint 是否处于 joint consensus 阶段, 即 C(old,new)
+	Joint bool
+	// Committed 配置的 log entry 是否已 commit
+	Committed bool
+	// ChangeInProgress 是否有未完成的配置变更, 即处于 joint consensus 阶段
+	// 或配置的 log entry 未 commit, 此时 ChangeConfig 返回 ErrConfigChangeInProgress
+	ChangeInProgress bool
+}
+
+// GetConfiguration 获取当前使用的集群配置
+//
+// a server always uses the latest configuration in its log,
+// regardless of whether the entry is committed
+func (r *raft) GetConfiguration() Configuration {
+	config := r.configs.GetConfig()
+	committed := config.GetIndex() <= r.GetCommitIndex()
+	return Configuration{
+		Index:            config.GetIndex(),
+		Peers:            config.GetPeers(),
+		Joint:            config.IsJoint(),
+		Committed:        committed,
+		ChangeInProgress: r.configChangeInProgress(config),
+	}
+}
+
+// configChangeInProgress 是否有未完成的配置变更
+//
+// 一次只能进行一个配置变更: 前一个变更处于 joint consensus 阶段,
+// 或配置的 log entry 未 commit 时, 在其基础上生成的新配置可能与之重叠.
+func (r *raft) configChangeInProgress(config config) bool {
+	return config.IsJoint() || config.GetIndex() > r.GetCommitIndex()
+}
+
 func newConfigManager(store Store) (*configManagerImpl, error) {
 	m := &configManagerImpl{
 		configsKey: []byte("raft.configs.key"),
@@ -34,6 +77,8 @@ func newConfigManager(store Store) (*configManagerImpl, error) {
 type configManager interface {
 	// GetConfig()
 	GetConfig() config
+	// GetConfigAt 获取 index 处生效的配置, 即索引不大于 index 的最新配置
+	GetConfigAt(index uint64) config
 	// UseConfig use config cfg
 	UseConfig(cfg config) error
 	// FallbackConfig fall back to previous cluster config
@@ -79,6 +124,18 @@ func (m *configManagerImpl) getConfig() config {
 	return m.configs[len(m.configs)-1]
 }
 
+// GetConfigAt 获取 index 处生效的配置, 即索引不大于 index 的最新配置
+func (m *configManagerImpl) GetConfigAt(index uint64) config {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	for i := len(m.configs) - 1; i >= 0; i-- {
+		if m.configs[i].GetIndex() <= index {
+			return m.configs[i]
+		}
+	}
+	return zeroConfig
+}
+
 // UseConfig use config cfg
 func (m *configManagerImpl) UseConfig(cfg config) error {
 	m.mux.Lock()
@@ -137,16 +194,44 @@ func (*configManagerImpl) NewConfig(index uint64, peersListBytes []byte) (config
 	return &config, err
 }
 
+// storedConfig 持久化到 Store 中的 config
+// config 的字段未导出, 不能直接以 json 编解码
+type storedConfig struct {
+	Index uint64
+	Peers json.RawMessage
+}
+
 func (*configManagerImpl) marshal(configs []config) ([]byte, error) {
-	return json.Marshal(configs)
+	stored := make([]storedConfig, 0, len(configs))
+	for _, cfg := range configs {
+		b, err := cfg.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		stored = append(stored, storedConfig{Index: cfg.GetIndex(), Peers: b})
+	}
+	return json.Marshal(stored)
 }
 
-func (*configManagerImpl) unmarshal(b []byte, configs *[]config) error {
+func (m *configManagerImpl) unmarshal(b []byte, configs *[]config) error {
 	if len(b) == 0 {
 		return nil
 	}
 
-	return json.Unmarshal(b, configs)
+	var stored []storedConfig
+	err := json.Unmarshal(b, &stored)
+	if err != nil {
+		return err
+	}
+	*configs = make([]config, 0, len(stored))
+	for _, s := range stored {
+		cfg, err := m.NewConfig(s.Index, s.Peers)
+		if err != nil {
+			return err
+		}
+		*configs = append(*configs, cfg)
+	}
+	return nil
 }
 
 // config cluster configuration
@@ -172,6 +257,8 @@ type config interface {
 	CreateNewConfig() (config, error)
 	// IncludePeer
 	IncludePeer(id RaftId) bool
+	// IsStandalone 配置中是否只有 id 一个 peer
+	IsStandalone(id RaftId) bool
 	// String
 	String() string
 }
@@ -300,6 +387,15 @@ func (c *configImpl) IncludePeer(id RaftId) bool {
 	return includePeer(peers, RaftPeer{Id: id})
 }
 
+// IsStandalone 配置中是否只有 id 一个 peer
+func (c *configImpl) IsStandalone(id RaftId) bool {
+	if c.IsJoint() || len(c.peersList) == 0 {
+		return false
+	}
+	peers := c.peersList[0]
+	return len(peers) == 1 && peers[0].Id == id
+}
+
 // includePeer peers 中是否包含 peer
 func includePeer(peers []RaftPeer, peer RaftPeer) bool {
 	for i := range peers {
@@ -0,0 +1,84 @@
+package raft
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+// configChecksum 配置的校验和, 对配置的编码计算 FNV-1a
+func configChecksum(c config) (uint64, error) {
+	b, err := c.Bytes()
+	if err != nil {
+		return 0, err
+	}
+	h := fnv.New64a()
+	h.Write(b)
+	return h.Sum64(), nil
+}
+
+// configMismatch Follower 与 Leader 的配置不一致
+//
+// Leader 在心跳中附带当前配置所在的索引与校验和. 同一索引的配置校验和不同,
+// 说明集群成员在节点之间悄然分歧(如手动恢复出错), 此时 Follower 拒绝投票,
+// 直到收到校验和一致的心跳, 避免以错误的成员计算多数派.
+type configMismatch struct {
+	mux sync.Mutex
+	// mismatched 不一致时 Leader 的 id, 否则为空
+	mismatched RaftId
+}
+
+// observe 记录与 Leader 的比较结果, 返回是否刚发现不一致
+func (m *configMismatch) observe(leaderId RaftId, match bool) (detected, reconciled bool) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if match {
+		reconciled = !m.mismatched.isNil()
+		m.mismatched = ""
+		return false, reconciled
+	}
+	detected = m.mismatched.isNil()
+	m.mismatched = leaderId
+	return detected, false
+}
+
+// diverged 是否与 Leader 的配置不一致
+func (m *configMismatch) diverged() bool {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return !m.mismatched.isNil()
+}
+
+// checkConfigChecksum 比较 Leader 心跳中的配置校验和与本地同一索引的配置
+//
+// 本地配置的索引不同时(复制尚未追上或有未提交的配置)无法比较, 维持之前的结论.
+func (r *raft) checkConfigChecksum(args AppendEntriesArgs) {
+	if args.ConfigIndex == 0 {
+		// leader doesn't broadcast checksums
+		return
+	}
+	local := r.configs.GetConfig()
+	if local.GetIndex() != args.ConfigIndex {
+		return
+	}
+	checksum, err := configChecksum(local)
+	if err != nil {
+		r.log(LogReplication).Error("Compute configuration checksum", "err", err)
+		return
+	}
+	detected, reconciled := r.configMismatch.observe(args.LeaderId, checksum == args.ConfigChecksum)
+	if reconciled {
+		r.log(LogReplication).Info("Configuration reconciled with leader", "leader", args.LeaderId, "configIndex", args.ConfigIndex)
+	}
+	if !detected {
+		return
+	}
+	r.metrics.IncrCounter(MetricConfigMismatches, 1)
+	r.emit(Event{
+		Type:  EventConfigMismatch,
+		Level: EventLevelCritical,
+		Peer:  RaftPeer{Id: args.LeaderId, Addr: args.LeaderAddr},
+		Message: fmt.Sprintf("configuration at index %d has checksum %x while leader %s has %x, refuse to vote until reconciled",
+			args.ConfigIndex, checksum, args.LeaderId, args.ConfigChecksum),
+	})
+}
@@ -0,0 +1,123 @@
+package raft
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestConfigChecksum(t *testing.T) {
+	leader, err := New("checksum-leader", "checksum-leader", nil, nil, nil, WithDevMode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leader.Stop()
+	go leader.Run()
+	events := make(chan Event, 16)
+	observer := func(event Event) {
+		if event.Type == EventConfigMismatch {
+			events <- event
+		}
+	}
+	follower := runLoopbackFollower(t, "checksum-follower", WithObserver(observer)).(*raft)
+	defer follower.Stop()
+	if err := leader.AddVoter(context.Background(), follower.Id(), follower.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	// replaceConfig 以 peers 替换 follower 的当前配置, 索引不变
+	replaceConfig := func(cfg config) {
+		if err := follower.configs.FallbackConfig(); err != nil {
+			t.Fatal(err)
+		}
+		if err := follower.configs.UseConfig(cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	original := follower.configs.GetConfig()
+	if original.GetIndex() != leader.(*raft).configs.GetConfig().GetIndex() {
+		t.Fatalf("expect follower at configuration %d but got %d", leader.(*raft).configs.GetConfig().GetIndex(), original.GetIndex())
+	}
+
+	t.Run("diverged", func(t *testing.T) {
+		// a botched manual recovery adds a phantom peer
+		diverged := &configImpl{index: original.GetIndex(), peersList: [][]RaftPeer{append(original.GetPeers(), RaftPeer{Id: "phantom", Addr: "phantom"})}}
+		replaceConfig(diverged)
+		select {
+		case event := <-events:
+			if event.Level != EventLevelCritical || event.Peer.Id != leader.Id() {
+				t.Errorf("expect critical event about leader %s but got %+v", leader.Id(), event)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expect configuration mismatch detected")
+		}
+		time.Sleep(100 * time.Millisecond)
+		if len(events) != 0 {
+			t.Errorf("expect a single event while diverged but got %d more", len(events))
+		}
+	})
+
+	t.Run("reconciled", func(t *testing.T) {
+		replaceConfig(original)
+		deadline := time.Now().Add(time.Second)
+		for follower.configMismatch.diverged() {
+			if time.Now().After(deadline) {
+				t.Fatal("expect configuration reconciled")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+}
+
+func TestConfigMismatchRefuseVote(t *testing.T) {
+	r, err := New("mismatch", "mismatch", nil, &memoryStore{}, &memoryLog{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raft := r.(*raft)
+	cfg := &configImpl{index: 3, peersList: [][]RaftPeer{{{Id: "mismatch", Addr: "mismatch"}, {Id: "leader", Addr: "leader"}}}}
+	if err := raft.configs.UseConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	checksum, err := configChecksum(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := raft.RPCService()
+	votes := func() (vote, preVote bool) {
+		var results RequestVoteResults
+		err := service.RequestVote(RequestVoteArgs{Term: raft.GetCurrentTerm() + 1, CandidateId: "leader", LastLogIndex: 10, LastLogTerm: 10}, &results)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var preResults PreVoteResults
+		err = service.PreVote(PreVoteArgs{Term: raft.GetCurrentTerm() + 1, CandidateId: "leader", LastLogIndex: 10, LastLogTerm: 10}, &preResults)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return results.VoteGranted, preResults.VoteGranted
+	}
+
+	cases := []struct {
+		name     string
+		args     AppendEntriesArgs
+		diverged bool
+	}{
+		{name: "mismatch", args: AppendEntriesArgs{LeaderId: "leader", ConfigIndex: 3, ConfigChecksum: checksum + 1}, diverged: true},
+		{name: "configuration not caught up", args: AppendEntriesArgs{LeaderId: "leader", ConfigIndex: 5, ConfigChecksum: checksum}, diverged: true},
+		{name: "reconciled", args: AppendEntriesArgs{LeaderId: "leader", ConfigIndex: 3, ConfigChecksum: checksum}},
+		{name: "checksum not broadcast", args: AppendEntriesArgs{LeaderId: "leader", ConfigChecksum: checksum + 1}},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			raft.checkConfigChecksum(c.args)
+			if diverged := raft.configMismatch.diverged(); diverged != c.diverged {
+				t.Fatalf("expect diverged %v but got %v", c.diverged, diverged)
+			}
+			vote, preVote := votes()
+			if vote == c.diverged || preVote == c.diverged {
+				t.Errorf("expect vote and pre-vote granted %v but got %v, %v", !c.diverged, vote, preVote)
+			}
+		})
+	}
+}
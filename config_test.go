@@ -0,0 +1,109 @@
+package raft
+
+import (
+	"context"
+	"testing"
+)
+
+func TestConfigChangeInProgress(t *testing.T) {
+	r, err := New("config", "config", nil, nil, nil, WithDevMode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	raft := r.(*raft)
+
+	t.Run("committed", func(t *testing.T) {
+		config := raft.GetConfiguration()
+		if !config.Committed || config.ChangeInProgress {
+			t.Errorf("expect committed configuration without change in progress but got %+v", config)
+		}
+	})
+
+	t.Run("uncommitted", func(t *testing.T) {
+		config := newBootstrapAsLeaderConfig(RaftPeer{raft.Id(), raft.Addr()})
+		config.SetIndex(raft.GetCommitIndex() + 1)
+		if !raft.configChangeInProgress(config) {
+			t.Error("expect change in progress while configuration is uncommitted")
+		}
+	})
+
+	t.Run("concurrent change", func(t *testing.T) {
+		l, ok := raft.GetServer().(*leader)
+		if !ok {
+			t.Fatal("expect leader")
+		}
+		l.ccm.Lock()
+		defer l.ccm.Unlock()
+		err := raft.ChangeConfig(context.Background(), nil, []RaftId{"absent"})
+		if err != ErrConfigChangeInProgress {
+			t.Errorf("expect %v but got %v", ErrConfigChangeInProgress, err)
+		}
+	})
+}
+
+func TestJointQuorum(t *testing.T) {
+	peers := func(ids ...RaftId) []RaftPeer {
+		var peers []RaftPeer
+		for _, id := range ids {
+			peers = append(peers, RaftPeer{Id: id})
+		}
+		return peers
+	}
+	// C(old,new): old {1,2,3}, new {3,4,5}
+	config := &configImpl{peersList: [][]RaftPeer{peers("1", "2", "3"), peers("3", "4", "5")}}
+
+	t.Run("vote", func(t *testing.T) {
+		decider := config.NewDecider()
+		for _, id := range []RaftId{"1", "2", "3"} {
+			decider.AddVote(id)
+		}
+		if decider.HasAchievedMajority() {
+			t.Error("expect no majority with votes from old configuration only")
+		}
+		decider.AddVote("4")
+		if !decider.HasAchievedMajority() {
+			t.Error("expect majority with votes from both configurations")
+		}
+	})
+
+	t.Run("commit", func(t *testing.T) {
+		calc := config.NewCommitCalc()
+		for id, matchIndex := range map[RaftId]uint64{"1": 9, "2": 9, "3": 5, "4": 7, "5": 3} {
+			calc.Add(id, matchIndex)
+		}
+		// old majority reached 9, new majority only reached 5
+		if index := calc.Calc(); index != 5 {
+			t.Errorf("expect commit index 5 but got %d", index)
+		}
+	})
+}
+
+func TestConfigManagerReload(t *testing.T) {
+	store := &memoryStore{}
+	m, err := newConfigManager(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := newBootstrapAsLeaderConfig(RaftPeer{"1", "addr-1"})
+	config.SetIndex(1)
+	if err := m.UseConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	joint := config.GenJointConfig([]RaftPeer{{"2", "addr-2"}}, nil)
+	joint.SetIndex(5)
+	if err := m.UseConfig(joint); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := newConfigManager(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := reloaded.GetConfig()
+	if got.GetIndex() != 5 || !got.IsJoint() || !got.IncludePeer("2") {
+		t.Errorf("expect joint config at index 5 but got %s", got)
+	}
+	if got := reloaded.GetConfigAt(4); got.GetIndex() != 1 || got.IncludePeer("2") {
+		t.Errorf("expect config at index 1 but got %s", got)
+	}
+}
@@ -0,0 +1,117 @@
+package raft
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrDuplicateCommand 幂等键与窗口内已应用的 command 相同, 没有再次应用
+var ErrDuplicateCommand = errors.New("err: command with the same idempotency key has been applied")
+
+// dedupWindow 按幂等键过滤重复的 log entry, 见 WithDedupWindow
+//
+// 只记住最近 window 个 log entry 中的幂等键. 各节点按相同的 log 得出相同的结果:
+// 重启或安装快照后从 log 中重新读取窗口内的 log entry, 已被压缩的部分无从得知,
+// 应通过 WithLogRetention 保留至少 window 个 log entry.
+type dedupWindow struct {
+	window uint64
+
+	mux sync.Mutex
+	// keys 幂等键首次出现的 log entry index
+	keys map[string]uint64
+	// order 按 index 排列的幂等键, 用于淘汰窗口外的幂等键
+	order []dedupKey
+	// next 下一个待过滤的 log entry index, 不连续时重新从 log 读取
+	next uint64
+}
+
+type dedupKey struct {
+	index uint64
+	key   string
+}
+
+func (w *dedupWindow) enabled() bool {
+	return w.window > 0
+}
+
+// observe 记录 entry 的幂等键, 幂等键已被之前的 log entry 使用时返回 true
+func (w *dedupWindow) observe(entry LogEntry) (duplicate bool) {
+	key := string(entry.Extensions[ExtensionIdempotencyKey])
+	if key == "" {
+		return false
+	}
+	for len(w.order) > 0 && w.order[0].index+w.window <= entry.Index {
+		delete(w.keys, w.order[0].key)
+		w.order = w.order[1:]
+	}
+	if index, ok := w.keys[key]; ok {
+		return index != entry.Index
+	}
+	w.keys[key] = entry.Index
+	w.order = append(w.order, dedupKey{index: entry.Index, key: key})
+	return false
+}
+
+// dedupEntries 过滤 lastApplied 之后的 entries 中的重复 log entry, 返回其 index
+func (r *raft) dedupEntries(lastApplied uint64, entries []LogEntry) (map[uint64]bool, error) {
+	w := &r.dedup
+	if !w.enabled() || len(entries) == 0 {
+		return nil, nil
+	}
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	// restarted, or lastApplied jumped after installing a snapshot
+	if w.next != lastApplied+1 {
+		if err := r.primeDedup(lastApplied); err != nil {
+			return nil, err
+		}
+	}
+	var duplicates map[uint64]bool
+	for _, entry := range entries {
+		if entry.Type != logEntryTypeCommand || !w.observe(entry) {
+			continue
+		}
+		if duplicates == nil {
+			duplicates = make(map[uint64]bool)
+		}
+		duplicates[entry.Index] = true
+		r.metrics.IncrCounter(MetricApplyDeduplicated, 1)
+	}
+	w.next = entries[len(entries)-1].Index + 1
+	return duplicates, nil
+}
+
+// primeDedup 从 log 中读取 lastApplied 之前窗口内的幂等键
+func (r *raft) primeDedup(lastApplied uint64) error {
+	w := &r.dedup
+	w.keys = make(map[string]uint64)
+	w.order = nil
+	w.next = lastApplied + 1
+
+	start := uint64(0)
+	if lastApplied > w.window {
+		start = lastApplied - w.window
+	}
+	// log entries before the first retained one have been compacted
+	firstIndex, err := r.FirstIndex()
+	if err != nil {
+		return err
+	}
+	if start < firstIndex-1 {
+		start = firstIndex - 1
+	}
+	if start >= lastApplied {
+		return nil
+	}
+	entries, err := r.RangeGet(start, lastApplied)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Type == logEntryTypeCommand {
+			w.observe(entry)
+		}
+	}
+	return nil
+}
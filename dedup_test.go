@@ -0,0 +1,147 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDedupWindow(t *testing.T) {
+	fsm := &listFSM{}
+	metrics := &countingSink{}
+	leader, err := New("dedup-leader", "dedup-leader", fsm.apply, nil, nil,
+		WithDevMode(), WithDedupWindow(4), WithMetrics(metrics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leader.Stop()
+	go leader.Run()
+
+	handle := func(t *testing.T, key string, cmd ...Command) {
+		t.Helper()
+		ctx := context.Background()
+		if key != "" {
+			ctx = WithIdempotencyKey(ctx, key)
+		}
+		if err := leader.Handle(ctx, cmd...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := func(t *testing.T, commands []string, skipped float64) {
+		t.Helper()
+		if got := fsm.get(); !reflect.DeepEqual(got, commands) {
+			t.Fatalf("expect %v applied but got %v", commands, got)
+		}
+		if got := metrics.counter(MetricApplyDeduplicated); got != skipped {
+			t.Fatalf("expect %v skipped but got %v", skipped, got)
+		}
+	}
+
+	t.Run("retry", func(t *testing.T) {
+		handle(t, "k1", Command("a"))
+		handle(t, "k1", Command("a"))
+		expect(t, []string{"a"}, 1)
+	})
+	t.Run("multiple commands", func(t *testing.T) {
+		handle(t, "k2", Command("b"), Command("c"))
+		handle(t, "k2", Command("b"), Command("c"))
+		expect(t, []string{"a", "b", "c"}, 3)
+	})
+	t.Run("without key", func(t *testing.T) {
+		handle(t, "", Command("d"))
+		handle(t, "", Command("d"))
+		expect(t, []string{"a", "b", "c", "d", "d"}, 3)
+	})
+	t.Run("outside window", func(t *testing.T) {
+		handle(t, "k1", Command("a"))
+		expect(t, []string{"a", "b", "c", "d", "d", "a"}, 3)
+	})
+}
+
+func TestDedupWindowPrime(t *testing.T) {
+	key := func(k string) map[string][]byte {
+		return map[string][]byte{ExtensionIdempotencyKey: []byte(k)}
+	}
+	log := &memoryLog{
+		// entry 1 has been compacted
+		prevIndex: 1,
+		prevTerm:  1,
+		queue: []LogEntry{
+			{Index: 2, Term: 1, Command: Command("a"), Extensions: key("k1")},
+			{Index: 3, Term: 1, Command: Command("b")},
+			{Index: 4, Term: 1, Command: Command("a"), Extensions: key("k1")},
+			{Index: 5, Term: 1, Command: Command("c"), Extensions: key("k0")},
+		},
+	}
+	fsm := &listFSM{}
+	r, err := New("dedup-prime", "dedup-prime", fsm.apply, &memoryStore{}, log, WithDedupWindow(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raft := r.(*raft)
+	// restarted from a snapshot covering entry 3
+	raft.SetLastApplied(3)
+	raft.SetCommitIndex(5)
+	if err := raft.applyCommitted(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fsm.get(); !reflect.DeepEqual(got, []string{"c"}) {
+		t.Fatalf("expect [c] applied but got %v", got)
+	}
+}
+
+func TestProposeDuplicate(t *testing.T) {
+	fsm := &listFSM{}
+	leader, err := New("dedup-propose", "dedup-propose", fsm.apply, nil, nil, WithDevMode(), WithDedupWindow(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leader.Stop()
+	go leader.Run()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	ctx = WithIdempotencyKey(ctx, "k")
+	if _, err := leader.Propose(ctx, Command("a")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := leader.Propose(ctx, Command("a")); !errors.Is(err, ErrDuplicateCommand) {
+		t.Fatalf("expect %v but got %v", ErrDuplicateCommand, err)
+	}
+	f := leader.ProposeAsync(ctx, Command("a"))
+	if err := f.Err(); !errors.Is(err, ErrDuplicateCommand) || f.Index() != 0 {
+		t.Fatalf("expect %v but got %v at %d", ErrDuplicateCommand, err, f.Index())
+	}
+	if got := fsm.get(); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Fatalf("expect [a] applied but got %v", got)
+	}
+}
+
+func TestProposeAsyncCancel(t *testing.T) {
+	release := make(chan struct{})
+	apply := func(commands Commands) (int, error) {
+		<-release
+		return len(commands.Data()), nil
+	}
+	leader, err := New("propose-cancel", "propose-cancel", apply, nil, nil, WithDevMode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leader.Stop()
+	defer close(release)
+	go leader.Run()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f := leader.ProposeAsync(ctx, Command("a"))
+	cancel()
+	select {
+	case <-f.Done():
+		if err := f.Err(); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expect %v but got %v", context.Canceled, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expect future done after ctx canceled")
+	}
+}
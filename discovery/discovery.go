@@ -0,0 +1,126 @@
+// Package discovery 基于 gossip 的 peer 发现
+//
+// 通过 gossip 协议(如 memberlist)观察到的成员变化, 为 raft 提供 peer 地址解析
+// (raft.Resolver), 并生成加入/离开集群的成员变更建议, 由 Leader 执行.
+//
+// 基于 memberlist 的集成见 raftmemberlist, 其他 gossip 实现在成员变化时调用
+// Discovery 的 NotifyJoin/NotifyLeave/NotifyUpdate.
+package discovery
+
+import (
+	"sync"
+
+	"github.com/mind1949/raft"
+)
+
+// Member gossip 层观察到的成员
+type Member struct {
+	Id   raft.RaftId
+	Addr raft.RaftAddr
+}
+
+// SuggestionType 成员变更建议类型
+type SuggestionType uint8
+
+const (
+	// SuggestJoin 建议将成员加入集群
+	SuggestJoin SuggestionType = iota + 1
+	// SuggestLeave 建议将成员移出集群
+	SuggestLeave
+)
+
+func (t SuggestionType) String() string {
+	switch t {
+	case SuggestJoin:
+		return "Join"
+	case SuggestLeave:
+		return "Leave"
+	default:
+		return "Unknown SuggestionType"
+	}
+}
+
+// Suggestion 成员变更建议
+type Suggestion struct {
+	Type   SuggestionType
+	Member Member
+}
+
+// suggestionBuffer 成员变更建议的缓冲区大小
+const suggestionBuffer = 64
+
+// New 创建 Discovery
+func New() *Discovery {
+	return &Discovery{
+		members:     make(map[raft.RaftId]raft.RaftAddr),
+		suggestions: make(chan Suggestion, suggestionBuffer),
+	}
+}
+
+var _ raft.Resolver = (*Discovery)(nil)
+
+// Discovery 记录 gossip 层观察到的成员
+type Discovery struct {
+	mux     sync.RWMutex
+	members map[raft.RaftId]raft.RaftAddr
+
+	suggestions chan Suggestion
+}
+
+// Resolve 实现 raft.Resolver
+func (d *Discovery) Resolve(id raft.RaftId) (raft.RaftAddr, bool) {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	addr, ok := d.members[id]
+	return addr, ok
+}
+
+// Members 当前存活的成员
+func (d *Discovery) Members() []Member {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	members := make([]Member, 0, len(d.members))
+	for id, addr := range d.members {
+		members = append(members, Member{Id: id, Addr: addr})
+	}
+	return members
+}
+
+// NotifyJoin 成员加入
+func (d *Discovery) NotifyJoin(m Member) {
+	d.mux.Lock()
+	d.members[m.Id] = m.Addr
+	d.mux.Unlock()
+	d.suggest(Suggestion{Type: SuggestJoin, Member: m})
+}
+
+// NotifyUpdate 成员地址变化
+func (d *Discovery) NotifyUpdate(m Member) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.members[m.Id] = m.Addr
+}
+
+// NotifyLeave 成员离开
+func (d *Discovery) NotifyLeave(m Member) {
+	d.mux.Lock()
+	delete(d.members, m.Id)
+	d.mux.Unlock()
+	d.suggest(Suggestion{Type: SuggestLeave, Member: m})
+}
+
+// Suggestions 成员变更建议
+//
+// 缓冲区满时丢弃新的建议, 可通过 Members 获取完整的成员列表进行对账
+func (d *Discovery) Suggestions() <-chan Suggestion {
+	return d.suggestions
+}
+
+func (d *Discovery) suggest(s Suggestion) {
+	select {
+	case d.suggestions <- s:
+		// no-op
+	default:
+		// no-op
+	}
+}
@@ -0,0 +1,200 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mind1949/raft"
+)
+
+// srvPrefix 以此为前缀的记录使用 SRV 查询, 如 srv:_raft._tcp.raft-0.example.com
+const srvPrefix = "srv:"
+
+const (
+	// DefaultDNSTTL ttl 未设置(<=0)时使用的重新解析间隔
+	DefaultDNSTTL = 30 * time.Second
+	// minDNSRefresh 根据记录 TTL 计算的重新解析间隔的下限
+	minDNSRefresh = time.Second
+)
+
+// Lookup 解析 DNS 记录, net.Resolver 实现了该接口
+type Lookup interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// TTLLookup 可由 Lookup 实现, 同时返回记录的 TTL
+//
+// 实现时 DNSResolver 按记录中最小的 TTL 重新解析(不超过 ttl),
+// net.Resolver 不提供 TTL, 此时每隔 ttl 重新解析.
+type TTLLookup interface {
+	LookupHostTTL(ctx context.Context, host string) ([]string, time.Duration, error)
+	LookupSRVTTL(ctx context.Context, name string) ([]*net.SRV, time.Duration, error)
+}
+
+// DNSOption 配置 DNSResolver
+type DNSOption func(d *DNSResolver)
+
+// WithLookup 使用 lookup 代替 net.DefaultResolver 解析记录
+func WithLookup(lookup Lookup) DNSOption {
+	return func(d *DNSResolver) {
+		d.resolver = lookup
+	}
+}
+
+// NewDNSResolver 创建定期重新解析 peer DNS 记录的 Resolver
+//
+// records 为 raft id 到 DNS 记录的映射, 记录为 host:port 或 srv:<name>,
+// 每隔 ttl 重新解析一次, ttl<=0 时使用 DefaultDNSTTL.
+func NewDNSResolver(records map[raft.RaftId]string, ttl time.Duration, opts ...DNSOption) *DNSResolver {
+	if ttl <= 0 {
+		ttl = DefaultDNSTTL
+	}
+	d := &DNSResolver{
+		records:  records,
+		ttl:      ttl,
+		resolver: net.DefaultResolver,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	d.addrs.Store(map[raft.RaftId]raft.RaftAddr{})
+	d.interval.Store(int64(ttl))
+	return d
+}
+
+var _ raft.Resolver = (*DNSResolver)(nil)
+
+// DNSResolver 基于 DNS/SRV 记录的 Resolver
+//
+// 记录不存在时移除对应的地址, raft 转而使用集群配置中的地址,
+// 并关闭与旧地址的连接(见 raft.AddrCloser).
+type DNSResolver struct {
+	records  map[raft.RaftId]string
+	ttl      time.Duration
+	resolver Lookup
+
+	// addrs 最近一次解析的结果, 整体原子替换
+	// map[raft.RaftId]raft.RaftAddr
+	addrs atomic.Value
+	// interval 下一次重新解析的间隔, time.Duration
+	interval atomic.Int64
+}
+
+// Resolve 实现 raft.Resolver
+func (d *DNSResolver) Resolve(id raft.RaftId) (raft.RaftAddr, bool) {
+	addrs := d.addrs.Load().(map[raft.RaftId]raft.RaftAddr)
+	addr, ok := addrs[id]
+	return addr, ok
+}
+
+// Refresh 重新解析所有记录, 并原子替换解析结果
+// 解析失败的记录保留上一次的结果
+func (d *DNSResolver) Refresh(ctx context.Context) error {
+	pre := d.addrs.Load().(map[raft.RaftId]raft.RaftAddr)
+	addrs := make(map[raft.RaftId]raft.RaftAddr, len(d.records))
+	interval := d.ttl
+	var errs []string
+	for id, record := range d.records {
+		addr, ttl, err := d.lookup(ctx, record)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s(%s): %v", id, record, err))
+			if addr, ok := pre[id]; ok && !isNotFound(err) {
+				addrs[id] = addr
+			}
+			continue
+		}
+		addrs[id] = addr
+		if ttl > 0 && ttl < interval {
+			interval = ttl
+		}
+	}
+	if interval < minDNSRefresh {
+		interval = minDNSRefresh
+	}
+	d.addrs.Store(addrs)
+	d.interval.Store(int64(interval))
+
+	if len(errs) > 0 {
+		return errors.New("err: resolve " + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Run 按记录的 TTL(不超过 ttl)重新解析, 直到 ctx 结束
+func (d *DNSResolver) Run(ctx context.Context) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			_ = d.Refresh(ctx)
+			timer.Reset(d.refreshInterval())
+		}
+	}
+}
+
+// refreshInterval 下一次重新解析的间隔
+func (d *DNSResolver) refreshInterval() time.Duration {
+	return time.Duration(d.interval.Load())
+}
+
+// lookup 解析 record, ttl 为 0 表示 TTL 未知
+func (d *DNSResolver) lookup(ctx context.Context, record string) (addr raft.RaftAddr, ttl time.Duration, err error) {
+	ttlLookup, withTTL := d.resolver.(TTLLookup)
+	if strings.HasPrefix(record, srvPrefix) {
+		name := strings.TrimPrefix(record, srvPrefix)
+		var srvs []*net.SRV
+		if withTTL {
+			srvs, ttl, err = ttlLookup.LookupSRVTTL(ctx, name)
+		} else {
+			_, srvs, err = d.resolver.LookupSRV(ctx, "", "", name)
+		}
+		if err != nil {
+			return "", 0, err
+		}
+		if len(srvs) == 0 {
+			return "", 0, errNotFound("no SRV record")
+		}
+		// LookupSRV 已按优先级与权重排序
+		target := strings.TrimSuffix(srvs[0].Target, ".")
+		return raft.RaftAddr(net.JoinHostPort(target, strconv.Itoa(int(srvs[0].Port)))), ttl, nil
+	}
+
+	host, port, err := net.SplitHostPort(record)
+	if err != nil {
+		return "", 0, err
+	}
+	var ips []string
+	if withTTL {
+		ips, ttl, err = ttlLookup.LookupHostTTL(ctx, host)
+	} else {
+		ips, err = d.resolver.LookupHost(ctx, host)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	if len(ips) == 0 {
+		return "", 0, errNotFound("no address")
+	}
+	return raft.RaftAddr(net.JoinHostPort(ips[0], port)), ttl, nil
+}
+
+// errNotFound 记录存在但没有可用的地址
+func errNotFound(msg string) error {
+	return &net.DNSError{Err: msg, IsNotFound: true}
+}
+
+// isNotFound 记录是否已不存在, 其他错误(超时等)保留上一次的结果
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
@@ -0,0 +1,138 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mind1949/raft"
+)
+
+type fakeDNS struct {
+	hosts map[string][]string
+	srvs  map[string][]*net.SRV
+}
+
+func (f *fakeDNS) LookupHost(_ context.Context, host string) ([]string, error) {
+	ips, ok := f.hosts[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return ips, nil
+}
+
+func (f *fakeDNS) LookupSRV(_ context.Context, _, _, name string) (string, []*net.SRV, error) {
+	srvs, ok := f.srvs[name]
+	if !ok {
+		return "", nil, errors.New("no such host")
+	}
+	return name, srvs, nil
+}
+
+func TestDNSResolver(t *testing.T) {
+	dns := &fakeDNS{
+		hosts: map[string][]string{"raft-1.local": {"10.0.0.1"}},
+		srvs:  map[string][]*net.SRV{"_raft._tcp.raft-2.local": {{Target: "raft-2.local.", Port: 7002}}},
+	}
+	resolver := NewDNSResolver(map[raft.RaftId]string{
+		"1": "raft-1.local:7001",
+		"2": "srv:_raft._tcp.raft-2.local",
+	}, 0, WithLookup(dns))
+	if resolver.ttl != DefaultDNSTTL {
+		t.Errorf("expect ttl %v but got %v", DefaultDNSTTL, resolver.ttl)
+	}
+
+	expect := func(id raft.RaftId, addr raft.RaftAddr) {
+		t.Helper()
+		got, ok := resolver.Resolve(id)
+		if !ok || got != addr {
+			t.Errorf("Resolve(%s), expect %q but got %q", id, addr, got)
+		}
+	}
+
+	if err := resolver.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expect("1", "10.0.0.1:7001")
+	expect("2", "raft-2.local:7002")
+
+	t.Run("address changed", func(t *testing.T) {
+		dns.hosts["raft-1.local"] = []string{"10.0.0.11"}
+		if err := resolver.Refresh(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		expect("1", "10.0.0.11:7001")
+	})
+	t.Run("keep stale address on failure", func(t *testing.T) {
+		delete(dns.hosts, "raft-1.local")
+		if err := resolver.Refresh(context.Background()); err == nil {
+			t.Errorf("expect error of failed lookup")
+		}
+		expect("1", "10.0.0.11:7001")
+	})
+	t.Run("remove address of deleted record", func(t *testing.T) {
+		dns.hosts["raft-1.local"] = []string{}
+		if err := resolver.Refresh(context.Background()); err == nil {
+			t.Errorf("expect error of failed lookup")
+		}
+		if addr, ok := resolver.Resolve("1"); ok {
+			t.Errorf("expect no address but got %q", addr)
+		}
+		expect("2", "raft-2.local:7002")
+	})
+	t.Run("run", func(t *testing.T) {
+		dns.hosts["raft-1.local"] = []string{"10.0.0.21"}
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if err := resolver.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expect %v but got %v", context.DeadlineExceeded, err)
+		}
+		expect("1", "10.0.0.21:7001")
+	})
+}
+
+// ttlDNS 返回固定 TTL 的 fakeDNS
+type ttlDNS struct {
+	*fakeDNS
+	ttl time.Duration
+}
+
+func (f *ttlDNS) LookupHostTTL(ctx context.Context, host string) ([]string, time.Duration, error) {
+	ips, err := f.LookupHost(ctx, host)
+	return ips, f.ttl, err
+}
+
+func (f *ttlDNS) LookupSRVTTL(ctx context.Context, name string) ([]*net.SRV, time.Duration, error) {
+	_, srvs, err := f.LookupSRV(ctx, "", "", name)
+	return srvs, f.ttl, err
+}
+
+func TestDNSRefreshInterval(t *testing.T) {
+	dns := &ttlDNS{fakeDNS: &fakeDNS{hosts: map[string][]string{"raft-1.local": {"10.0.0.1"}}}}
+	records := map[raft.RaftId]string{"1": "raft-1.local:7001"}
+	tests := []struct {
+		name   string
+		ttl    time.Duration
+		record time.Duration
+		expect time.Duration
+	}{
+		{name: "record ttl", ttl: time.Minute, record: 10 * time.Second, expect: 10 * time.Second},
+		{name: "bounded by ttl", ttl: time.Minute, record: time.Hour, expect: time.Minute},
+		{name: "unknown record ttl", ttl: time.Minute, expect: time.Minute},
+		{name: "lower bound", ttl: time.Minute, record: time.Millisecond, expect: minDNSRefresh},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dns.ttl = test.record
+			resolver := NewDNSResolver(records, test.ttl, WithLookup(dns))
+			if err := resolver.Refresh(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if got := resolver.refreshInterval(); got != test.expect {
+				t.Errorf("expect %v but got %v", test.expect, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package discovery
+
+import (
+	"context"
+	"time"
+
+	"github.com/mind1949/raft"
+)
+
+// Reconciler 在本节点为 Leader 时, 执行成员变更建议
+type Reconciler struct {
+	Raft      raft.Raft
+	Discovery *Discovery
+	// LeaveGrace 成员离开后等待的时间, 期间重新加入则不移出集群,
+	// 避免网络抖动导致频繁的成员变更
+	LeaveGrace time.Duration
+	// Timeout 单次成员变更的超时时间
+	Timeout time.Duration
+	// OnError 成员变更失败时调用
+	OnError func(s Suggestion, err error)
+}
+
+// Run 执行成员变更建议, 直到 ctx 结束
+func (r *Reconciler) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case s := <-r.Discovery.Suggestions():
+			if s.Type == SuggestLeave && r.LeaveGrace > 0 {
+				s := s
+				time.AfterFunc(r.LeaveGrace, func() { r.apply(ctx, s) })
+				continue
+			}
+			r.apply(ctx, s)
+		}
+	}
+}
+
+func (r *Reconciler) apply(ctx context.Context, s Suggestion) {
+	if !r.Raft.IsLeader() || ctx.Err() != nil {
+		return
+	}
+
+	_, alive := r.Discovery.Resolve(s.Member.Id)
+	included := false
+	for _, peer := range r.Raft.GetConfiguration().Peers {
+		if peer.Id == s.Member.Id {
+			included = true
+			break
+		}
+	}
+
+	var added []raft.RaftPeer
+	var removed []raft.RaftId
+	switch s.Type {
+	case SuggestJoin:
+		if included || !alive {
+			return
+		}
+		added = append(added, raft.RaftPeer{Id: s.Member.Id, Addr: s.Member.Addr})
+	case SuggestLeave:
+		// rejoined during grace period
+		if !included || alive {
+			return
+		}
+		removed = append(removed, s.Member.Id)
+	default:
+		return
+	}
+
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+	err := r.Raft.ChangeConfig(ctx, added, removed)
+	if err != nil && r.OnError != nil {
+		r.OnError(s, err)
+	}
+}
@@ -0,0 +1,83 @@
+package discovery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mind1949/raft"
+	"github.com/mind1949/raft/raftmock"
+)
+
+// fakeGossip 模拟 gossip 层的成员变化, 如 memberlist 的 EventDelegate
+type fakeGossip struct {
+	d *Discovery
+}
+
+func (g fakeGossip) join(id raft.RaftId) {
+	g.d.NotifyJoin(Member{Id: id, Addr: raft.RaftAddr(id + ":7000")})
+}
+
+func (g fakeGossip) leave(id raft.RaftId) {
+	g.d.NotifyLeave(Member{Id: id, Addr: raft.RaftAddr(id + ":7000")})
+}
+
+func TestReconciler(t *testing.T) {
+	r := raftmock.NewRaft("1", nil)
+	d := New()
+	gossip := fakeGossip{d: d}
+	reconciler := &Reconciler{Raft: r, Discovery: d, LeaveGrace: 300 * time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reconciler.Run(ctx)
+
+	included := func(id raft.RaftId) bool {
+		for _, peer := range r.GetConfiguration().Peers {
+			if peer.Id == id {
+				return true
+			}
+		}
+		return false
+	}
+	eventually := func(t *testing.T, id raft.RaftId, expect bool) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for included(id) != expect {
+			if time.Now().After(deadline) {
+				t.Fatalf("expect %s included %v but got %v", id, expect, r.GetConfiguration().Peers)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	consistently := func(t *testing.T, id raft.RaftId, expect bool) {
+		t.Helper()
+		deadline := time.Now().Add(100 * time.Millisecond)
+		for time.Now().Before(deadline) {
+			if included(id) != expect {
+				t.Fatalf("expect %s included %v but got %v", id, expect, r.GetConfiguration().Peers)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	t.Run("join", func(t *testing.T) {
+		gossip.join("2")
+		eventually(t, "2", true)
+	})
+	t.Run("rejoin during grace period", func(t *testing.T) {
+		gossip.leave("2")
+		gossip.join("2")
+		consistently(t, "2", true)
+	})
+	t.Run("leave", func(t *testing.T) {
+		gossip.leave("2")
+		consistently(t, "2", true)
+		eventually(t, "2", false)
+	})
+	t.Run("not leader", func(t *testing.T) {
+		r.SetLeader(false)
+		defer r.SetLeader(true)
+		gossip.join("3")
+		consistently(t, "3", false)
+	})
+}
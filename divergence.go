@@ -0,0 +1,55 @@
+package raft
+
+import "sync/atomic"
+
+// logDivergence 记录已知的最大 commitIndex, 判断本节点的日志是否落后太多
+//
+// 日志落后于已知 commitIndex 超过 max 个 entry 的节点放弃竞选:
+// 这样的节点即使勉强当选, 也会迫使其他节点截断大量 log entry.
+type logDivergence struct {
+	// max 允许落后的 log entry 数量, 0 表示不限制
+	max uint64
+	// knownCommit 从 Leader 的 AppendEntries 或 voter 的 RequestVote 响应中得知的最大 commitIndex
+	knownCommit uint64
+}
+
+func (d *logDivergence) enabled() bool {
+	return d.max > 0
+}
+
+// observe 记录得知的 commitIndex
+func (d *logDivergence) observe(commitIndex uint64) {
+	for {
+		known := atomic.LoadUint64(&d.knownCommit)
+		if commitIndex <= known || atomic.CompareAndSwapUint64(&d.knownCommit, known, commitIndex) {
+			return
+		}
+	}
+}
+
+// tooFarBehind lastLogIndex 是否落后于已知 commitIndex 超过 max 个 entry
+func (d *logDivergence) tooFarBehind(lastLogIndex uint64) bool {
+	if !d.enabled() {
+		return false
+	}
+	return atomic.LoadUint64(&d.knownCommit) > lastLogIndex+d.max
+}
+
+// refuseCampaign 日志落后太多时放弃竞选
+func (r *raft) refuseCampaign() bool {
+	if !r.divergence.enabled() {
+		return false
+	}
+	lastLogIndex, _, err := r.Last()
+	if err != nil {
+		r.log(LogElection).Error("Get last log entry", "err", err)
+		return false
+	}
+	if !r.divergence.tooFarBehind(lastLogIndex) {
+		return false
+	}
+	r.metrics.IncrCounter(MetricElectionsRefused, 1)
+	r.log(LogElection).Warn("Log is too far behind known commit index, refuse to campaign",
+		"lastLogIndex", lastLogIndex, "max", r.divergence.max, "knownCommit", atomic.LoadUint64(&r.divergence.knownCommit))
+	return true
+}
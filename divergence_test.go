@@ -0,0 +1,31 @@
+package raft
+
+import "testing"
+
+func TestLogDivergence(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		var d logDivergence
+		d.observe(100)
+		if d.tooFarBehind(0) {
+			t.Error("expect no limit when disabled")
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		d := logDivergence{max: 10}
+		d.observe(30)
+		d.observe(20) // stale commit index is ignored
+		for _, c := range []struct {
+			lastLogIndex uint64
+			expect       bool
+		}{
+			{lastLogIndex: 19, expect: true},
+			{lastLogIndex: 20, expect: false},
+			{lastLogIndex: 35, expect: false},
+		} {
+			if got := d.tooFarBehind(c.lastLogIndex); got != c.expect {
+				t.Errorf("expect tooFarBehind(%d) %t but got %t", c.lastLogIndex, c.expect, got)
+			}
+		}
+	})
+}
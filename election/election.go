@@ -0,0 +1,329 @@
+// Package election 基于 raft 的 leader election, 用于只在一个节点上运行的单例任务
+//
+// 只需要选出一个节点运行任务时, 不必实现状态机与 log 的读写:
+// 每个节点运行一个 raft 节点, 由 Election 等待本节点当选, 并在失去 leadership 时取消任务.
+// 不通过 Handle 提交 command 时 apply 不会被调用, 可以为 nil.
+//
+//	e := election.New(r)
+//	defer e.Close()
+//	err := e.Run(ctx, func(ctx context.Context, token uint64) error {
+//		// 只在 Leader 上运行, 失去 leadership 时 ctx 被取消
+//		return runJob(ctx, token)
+//	})
+//
+// token 是当选的 term, 随每次当选单调递增, 可作为 fencing token:
+// 任务写入外部系统时携带 token, 外部系统拒绝比已见过的 token 更小的写入,
+// 这样即使旧的 Leader 尚未察觉自己已失去 leadership, 它的写入也不会生效.
+package election
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mind1949/raft"
+)
+
+var (
+	ErrClosed         = errors.New("err: election closed")
+	ErrNotLeader      = errors.New("err: not the leader")
+	ErrNoSuccessor    = errors.New("err: no other voter to hand leadership over to")
+	ErrLeadershipLost = errors.New("err: leadership lost")
+)
+
+// confirmRetryInterval 确认 leadership 失败而 leadership 未变化时, 重试前等待的时间
+const confirmRetryInterval = 100 * time.Millisecond
+
+// State 本节点观察到的 leadership
+type State struct {
+	// Leader 当前 term 的 Leader, 不知道时为零值
+	Leader raft.RaftPeer
+	// Term 当前 term
+	Term uint64
+	// IsLeader 本节点是否是 Leader
+	IsLeader bool
+}
+
+// Election 在 raft 节点上进行的 leader election
+//
+// raft 节点持续参与选举, Campaign 等待本节点当选; Resign 将 leadership 交给其他节点.
+type Election struct {
+	r raft.Raft
+
+	mux   sync.Mutex
+	state State
+	// changed state 变化时关闭并替换
+	changed chan struct{}
+
+	once sync.Once
+	done chan struct{}
+}
+
+// New 创建在 r 上进行的 Election, r 应已 Run 或随后 Run
+// Close 或 r 停止之后, Election 不再可用
+func New(r raft.Raft) *Election {
+	e := &Election{
+		r:       r,
+		changed: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	events := r.Subscribe()
+	e.refresh()
+	go e.watch(events)
+	return e
+}
+
+// Close 停止 Election, 正在等待的 Campaign 返回 ErrClosed, 持有的 Leadership 被取消
+func (e *Election) Close() {
+	e.once.Do(func() { close(e.done) })
+}
+
+// watch 根据 raft 的 leadership 事件刷新 state
+func (e *Election) watch(events <-chan raft.Event) {
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-e.r.Done():
+			e.Close()
+			return
+		case event, ok := <-events:
+			if !ok {
+				e.Close()
+				return
+			}
+			switch event.Type {
+			case raft.EventBecameLeader, raft.EventBecameFollower, raft.EventLeaderChanged:
+				e.refresh()
+			}
+		}
+	}
+}
+
+// refresh 读取 raft 当前的 leadership, 有变化时通知等待者
+func (e *Election) refresh() {
+	leader, _ := e.r.Leader()
+	state := State{
+		Leader:   leader,
+		Term:     e.r.Stats().Term,
+		IsLeader: e.r.IsLeader(),
+	}
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	if state == e.state {
+		return
+	}
+	e.state = state
+	close(e.changed)
+	e.changed = make(chan struct{})
+}
+
+// State 本节点观察到的 leadership, 以及下一次变化时关闭的 channel
+func (e *Election) State() (State, <-chan struct{}) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	return e.state, e.changed
+}
+
+// Observe 返回接收 leadership 变化的 channel, 首先发送当前的 State
+// ctx 结束或 Election 关闭后 channel 被关闭; 接收不及时时只保留最新的 State
+func (e *Election) Observe(ctx context.Context) <-chan State {
+	ch := make(chan State, 1)
+	go func() {
+		defer close(ch)
+		for {
+			state, changed := e.State()
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- state
+			select {
+			case <-ctx.Done():
+				return
+			case <-e.done:
+				return
+			case <-changed:
+			}
+		}
+	}()
+	return ch
+}
+
+// Campaign 等待本节点当选, 返回本次当选的 Leadership
+//
+// 当选后在新的 term 中 commit 一个 no-op, 确认多数节点承认本节点的 leadership 之后才返回.
+// ctx 结束时返回 ctx.Err(), Election 关闭时返回 ErrClosed.
+func (e *Election) Campaign(ctx context.Context) (*Leadership, error) {
+	for {
+		state, changed := e.State()
+		var retry <-chan time.Time
+		if state.IsLeader {
+			l, err := e.confirm(ctx, state)
+			if err == nil {
+				return l, nil
+			}
+			// such as a leadership transfer in progress
+			retry = time.After(confirmRetryInterval)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-e.done:
+			return nil, ErrClosed
+		case <-changed:
+		case <-retry:
+		}
+	}
+}
+
+// confirm 确认本节点仍是 state.Term 的 Leader, 失去时返回 ErrLeadershipLost
+func (e *Election) confirm(ctx context.Context, state State) (*Leadership, error) {
+	_, err := e.r.ProposeEntry(ctx, raft.NewNoopEntry())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLeadershipLost, err)
+	}
+	if current, _ := e.State(); current != state {
+		return nil, fmt.Errorf("%w: term %d is over", ErrLeadershipLost, state.Term)
+	}
+	l := &Leadership{e: e, token: state.Term}
+	l.ctx, l.cancel = context.WithCancelCause(context.Background())
+	go l.watch(state)
+	return l, nil
+}
+
+// Resign 将 leadership 交给复制进度最新的其他投票成员
+// 本节点不是 Leader 时返回 ErrNotLeader, 没有其他投票成员时返回 ErrNoSuccessor
+func (e *Election) Resign(ctx context.Context) error {
+	if !e.r.IsLeader() {
+		return ErrNotLeader
+	}
+	var (
+		successor  raft.RaftId
+		matchIndex uint64
+	)
+	peers := e.r.GetConfiguration().Peers
+	for _, replication := range e.r.Stats().Replication {
+		if replication.Id == e.r.Id() || !includes(peers, replication.Id) {
+			continue
+		}
+		if successor == "" || replication.MatchIndex > matchIndex {
+			successor, matchIndex = replication.Id, replication.MatchIndex
+		}
+	}
+	if successor == "" {
+		return ErrNoSuccessor
+	}
+	return e.r.TransferLeadership(ctx, successor)
+}
+
+func includes(peers []raft.RaftPeer, id raft.RaftId) bool {
+	for _, peer := range peers {
+		if peer.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Run 在本节点当选期间运行 job, 失去 leadership 后重新等待当选
+//
+// job 的 ctx 在失去 leadership 时被取消, token 为本次当选的 fencing token.
+// job 在仍持有 leadership 时返回, Run 返回 job 的结果; ctx 结束时返回 ctx.Err().
+func (e *Election) Run(ctx context.Context, job func(ctx context.Context, token uint64) error) error {
+	for {
+		l, err := e.Campaign(ctx)
+		if err != nil {
+			return err
+		}
+		jobCtx, cancel := context.WithCancel(l.Context())
+		stop := context.AfterFunc(ctx, cancel)
+		err = job(jobCtx, l.Token())
+		stop()
+		cancel()
+		lost := errors.Is(l.Err(), ErrLeadershipLost)
+		l.Release()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !lost {
+			return err
+		}
+	}
+}
+
+// Leadership 本节点的一次当选
+type Leadership struct {
+	e     *Election
+	token uint64
+
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+}
+
+// Token 本次当选的 term, 作为 fencing token
+func (l *Leadership) Token() uint64 {
+	return l.token
+}
+
+// Context 失去 leadership 或 Release 时被取消
+func (l *Leadership) Context() context.Context {
+	return l.ctx
+}
+
+// Done 失去 leadership 或 Release 时关闭
+func (l *Leadership) Done() <-chan struct{} {
+	return l.ctx.Done()
+}
+
+// Err 失去 leadership 后返回 ErrLeadershipLost, Release 后返回 context.Canceled
+func (l *Leadership) Err() error {
+	return context.Cause(l.ctx)
+}
+
+// Release 停止跟踪 leadership, 不影响 raft 节点的 leadership; 交出 leadership 使用 Election.Resign
+func (l *Leadership) Release() {
+	l.cancel(context.Canceled)
+}
+
+// Confirm 确认本节点仍是 Leader: 多数节点承认其 leadership, 且 term 仍是 Token
+//
+// 不支持 fencing token 的外部系统, 可在每次有副作用的操作之前调用, 缩小新旧 Leader 同时运行的窗口.
+func (l *Leadership) Confirm(ctx context.Context) error {
+	if err := l.Err(); err != nil {
+		return err
+	}
+	_, err := l.e.r.ReadIndex(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrLeadershipLost, err)
+	}
+	if term := l.e.r.Stats().Term; term != l.token {
+		return fmt.Errorf("%w: term %d is over", ErrLeadershipLost, l.token)
+	}
+	return nil
+}
+
+// watch state 变化, 即本节点不再是该 term 的 Leader 时取消
+func (l *Leadership) watch(state State) {
+	for {
+		current, changed := l.e.State()
+		if current != state {
+			l.lose()
+			return
+		}
+		select {
+		case <-l.ctx.Done():
+			return
+		case <-l.e.done:
+			l.lose()
+			return
+		case <-changed:
+		}
+	}
+}
+
+func (l *Leadership) lose() {
+	l.cancel(fmt.Errorf("%w: term %d", ErrLeadershipLost, l.token))
+}
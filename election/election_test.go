@@ -0,0 +1,186 @@
+package election
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mind1949/raft"
+	"github.com/mind1949/raft/transport/inmem"
+)
+
+func newTestCluster(t *testing.T, n int) (*inmem.Cluster, map[raft.RaftId]*Election) {
+	t.Helper()
+	c, err := inmem.NewCluster(n, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Stop)
+	c.Start()
+	elections := make(map[raft.RaftId]*Election)
+	for _, node := range c.Nodes() {
+		e := New(node.Raft())
+		t.Cleanup(e.Close)
+		elections[node.Id] = e
+	}
+	return c, elections
+}
+
+// campaign 在所有节点上竞选, 返回当选的节点
+func campaign(t *testing.T, elections map[raft.RaftId]*Election) (raft.RaftId, *Leadership) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	type won struct {
+		id raft.RaftId
+		l  *Leadership
+	}
+	winner := make(chan won, len(elections))
+	for id, e := range elections {
+		id, e := id, e
+		go func() {
+			l, err := e.Campaign(ctx)
+			if err == nil {
+				winner <- won{id, l}
+			}
+		}()
+	}
+	select {
+	case w := <-winner:
+		cancel()
+		return w.id, w.l
+	case <-ctx.Done():
+		t.Fatal("expect a node elected")
+		return "", nil
+	}
+}
+
+func waitLost(t *testing.T, l *Leadership) {
+	t.Helper()
+	select {
+	case <-l.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expect leadership lost")
+	}
+	if err := l.Err(); !errors.Is(err, ErrLeadershipLost) {
+		t.Fatalf("expect %v but got %v", ErrLeadershipLost, err)
+	}
+}
+
+func TestElection(t *testing.T) {
+	t.Run("standalone", func(t *testing.T) {
+		r, err := raft.New("standalone", "standalone", nil, nil, nil, raft.WithDevMode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		go r.Run()
+		defer r.Stop()
+		e := New(r)
+		defer e.Close()
+		ctx := context.Background()
+
+		l, err := e.Campaign(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token, term := l.Token(), r.Stats().Term; token != term {
+			t.Errorf("expect token %d but got %d", term, token)
+		}
+		if err := l.Confirm(ctx); err != nil {
+			t.Errorf("expect leadership confirmed but got %v", err)
+		}
+		if err := e.Resign(ctx); !errors.Is(err, ErrNoSuccessor) {
+			t.Errorf("expect %v but got %v", ErrNoSuccessor, err)
+		}
+		l.Release()
+		if err := l.Err(); !errors.Is(err, context.Canceled) {
+			t.Errorf("expect %v but got %v", context.Canceled, err)
+		}
+	})
+
+	t.Run("resign", func(t *testing.T) {
+		_, elections := newTestCluster(t, 3)
+		id, l := campaign(t, elections)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		for other, e := range elections {
+			if other != id {
+				if err := e.Resign(ctx); !errors.Is(err, ErrNotLeader) {
+					t.Errorf("expect %v but got %v", ErrNotLeader, err)
+				}
+			}
+		}
+		if err := elections[id].Resign(ctx); err != nil {
+			t.Fatal(err)
+		}
+		waitLost(t, l)
+
+		next, successor := campaign(t, elections)
+		if next == id {
+			t.Errorf("expect another node elected after %s resigned", id)
+		}
+		if successor.Token() <= l.Token() {
+			t.Errorf("expect token greater than %d but got %d", l.Token(), successor.Token())
+		}
+	})
+
+	t.Run("partition", func(t *testing.T) {
+		c, elections := newTestCluster(t, 3)
+		id, l := campaign(t, elections)
+		if err := c.Partition([]raft.RaftId{id}); err != nil {
+			t.Fatal(err)
+		}
+		waitLost(t, l)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := l.Confirm(ctx); !errors.Is(err, ErrLeadershipLost) {
+			t.Errorf("expect %v but got %v", ErrLeadershipLost, err)
+		}
+
+		delete(elections, id)
+		_, successor := campaign(t, elections)
+		if successor.Token() <= l.Token() {
+			t.Errorf("expect token greater than %d but got %d", l.Token(), successor.Token())
+		}
+	})
+
+	t.Run("run", func(t *testing.T) {
+		_, elections := newTestCluster(t, 3)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		tokens := make(chan uint64, 16)
+		results := make(chan error, len(elections))
+		for _, e := range elections {
+			e := e
+			go func() {
+				results <- e.Run(ctx, func(ctx context.Context, token uint64) error {
+					tokens <- token
+					<-ctx.Done()
+					return ctx.Err()
+				})
+			}()
+		}
+		first := <-tokens
+		for _, e := range elections {
+			if err := e.Resign(ctx); err == nil {
+				break
+			}
+		}
+		select {
+		case second := <-tokens:
+			if second <= first {
+				t.Errorf("expect token greater than %d but got %d", first, second)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expect job run on the next leader")
+		}
+
+		cancel()
+		for range elections {
+			if err := <-results; !errors.Is(err, context.Canceled) {
+				t.Errorf("expect %v but got %v", context.Canceled, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package election_test
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/mind1949/raft"
+	"github.com/mind1949/raft/election"
+)
+
+// 在三个节点中选出一个运行定时任务, 任务写入外部系统时携带 fencing token
+func Example() {
+	peers := []raft.RaftPeer{
+		{Id: "1", Addr: "10.0.0.1:7000"},
+		{Id: "2", Addr: "10.0.0.2:7000"},
+		{Id: "3", Addr: "10.0.0.3:7000"},
+	}
+	self := peers[0]
+	// no commands are proposed, so no state machine is needed;
+	// use durable storage such as raftbolt in production
+	r, err := raft.New(self.Id, self.Addr, nil, raft.NewMemoryStore(), raft.NewMemoryLog())
+	if err != nil {
+		log.Fatal(err)
+	}
+	// only on the first start of the cluster, on one of the nodes
+	err = r.BootstrapCluster(raft.Configuration{Peers: peers})
+	if err != nil && !errors.Is(err, raft.ErrCantBootstrap) {
+		log.Fatal(err)
+	}
+	go r.Run()
+	defer r.Stop()
+
+	e := election.New(r)
+	defer e.Close()
+	err = e.Run(context.Background(), func(ctx context.Context, token uint64) error {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				// leadership lost, another node takes over
+				return ctx.Err()
+			case <-ticker.C:
+				// the external system rejects writes with a token lower than the highest seen
+				log.Printf("run job with fencing token %d", token)
+			}
+		}
+	})
+	log.Println(err)
+}
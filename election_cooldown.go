@@ -0,0 +1,46 @@
+package raft
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// electionCooldown 竞选失败后, 再次竞选前的冷却时间
+//
+// 已被移出集群但尚未得知的节点收不到心跳, 会不断发起注定失败的选举,
+// 冷却时间降低其对集群的干扰.
+type electionCooldown struct {
+	// duration 冷却时间, 为 0 时不冷却
+	duration time.Duration
+	// lostAt 最近一次竞选失败的时间(unix nano)
+	lostAt int64
+}
+
+func (c *electionCooldown) enabled() bool {
+	return c.duration > 0
+}
+
+// lost 记录 now 时的一次竞选失败
+func (c *electionCooldown) lost(now time.Time) {
+	atomic.StoreInt64(&c.lostAt, now.UnixNano())
+}
+
+// coolingDown now 时是否仍处于冷却时间内
+func (c *electionCooldown) coolingDown(now time.Time) bool {
+	if !c.enabled() {
+		return false
+	}
+	lostAt := atomic.LoadInt64(&c.lostAt)
+	return lostAt != 0 && now.Sub(time.Unix(0, lostAt)) < c.duration
+}
+
+// removedCandidate 是否忽略 candidate 的投票请求
+//
+// 存在 Leader 时忽略不在集群配置中的 candidate, 防止被移出集群的节点
+// 迫使 Leader 退位 (§4.2.3)
+func (r *raft) removedCandidate(id RaftId) bool {
+	if r.configs.GetConfig().IncludePeer(id) {
+		return false
+	}
+	return r.IsLeader() || r.isLeaderActive()
+}
@@ -0,0 +1,60 @@
+package raft
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestElectionCooldown(t *testing.T) {
+	t.Run("ignore removed candidate", func(t *testing.T) {
+		r, err := New("cooldown-leader", "cooldown-leader", nil, nil, nil, WithDevMode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		raft := r.(*raft)
+		term := raft.GetCurrentTerm()
+		service := raft.newRPCService()
+
+		var results RequestVoteResults
+		err = service.RequestVote(RequestVoteArgs{Term: term + 10, CandidateId: "removed", LeadershipTransfer: true}, &results)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if results.VoteGranted {
+			t.Error("expect vote withheld from removed candidate")
+		}
+		if got := raft.GetCurrentTerm(); got != term {
+			t.Errorf("expect term %d unchanged but got %d", term, got)
+		}
+		if !r.IsLeader() {
+			t.Error("expect leader not disrupted by removed candidate")
+		}
+	})
+
+	t.Run("cool down after losing election", func(t *testing.T) {
+		fsm := &listFSM{}
+		leader, err := New("cooldown-lost-leader", "cooldown-lost-leader", fsm.apply, nil, nil, WithDevMode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer leader.Stop()
+		go leader.Run()
+
+		sink := &countingSink{}
+		follower := runLoopbackFollower(t, "cooldown-lost-follower",
+			WithElection(50*time.Millisecond, 100*time.Millisecond), WithElectionCooldown(time.Hour), WithMetrics(sink))
+		defer follower.Stop()
+		err = leader.AddVoter(context.Background(), follower.Id(), follower.Addr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		leader.Stop()
+
+		// the follower campaigns once, loses and then cools down
+		time.Sleep(time.Second)
+		if got := sink.counter(MetricElections); got != 1 {
+			t.Errorf("expect 1 election but got %v", got)
+		}
+	})
+}
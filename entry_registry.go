@@ -0,0 +1,103 @@
+package raft
+
+import "fmt"
+
+// systemEntryType 系统 log entry 类型的处理方式
+//
+// 增加新的系统 log entry 类型只需在 systemEntryTypes 中注册,
+// 无需修改日志复制与应用的主流程.
+type systemEntryType struct {
+	name string
+	// appended follower 追加该类型的 log entry 后调用, 如新配置追加后立即生效
+	appended func(r *raft, entry LogEntry) error
+	// truncated follower 删除 afterIndex 之后的 log entry 后调用
+	truncated func(r *raft, afterIndex uint64) error
+	// apply 与 command 依序应用该类型的 log entry, 为 nil 时应用时跳过
+	apply func(r *raft, entry LogEntry) error
+}
+
+// systemEntryTypes 本版本已知的系统 log entry 类型
+var systemEntryTypes = map[LogEntryType]systemEntryType{
+	logEntryTypeConfig: {
+		name:      "Config",
+		appended:  (*raft).appendedConfigEntry,
+		truncated: (*raft).truncatedConfigEntries,
+	},
+	logEntryTypeNoop: {
+		name: "Noop",
+	},
+	logEntryTypeBarrier: {
+		name:  "Barrier",
+		apply: (*raft).applyBarrier,
+	},
+}
+
+// appendedConfigEntry
+// Once a given server adds the new configuration entry to its log,
+// it uses that configuration for all future decisions
+func (r *raft) appendedConfigEntry(entry LogEntry) error {
+	config, err := r.configs.NewConfig(entry.Index, entry.Command)
+	if err != nil {
+		return err
+	}
+	r.configs.UseConfig(config)
+
+	if config.IsJoint() {
+		r.log(LogReplication).Info("~> C(old,new)", "config", config)
+	} else {
+		r.log(LogReplication).Info("~> C(new)", "config", config)
+	}
+	return nil
+}
+
+// truncatedConfigEntries fallback config if config log entry is delete
+func (r *raft) truncatedConfigEntries(afterIndex uint64) error {
+	config := r.configs.GetConfig()
+	for config.GetIndex() > afterIndex {
+		err := r.configs.FallbackConfig()
+		if err != nil {
+			return err
+		}
+		config = r.configs.GetConfig()
+	}
+	return nil
+}
+
+// appendedEntries follower 删除 afterIndex 之后的 log entry 并追加 entries 后,
+// 调用系统 log entry 类型的 truncated 与 appended
+func (r *raft) appendedEntries(afterIndex uint64, entries []LogEntry) error {
+	for _, typ := range systemEntryTypes {
+		if typ.truncated == nil {
+			continue
+		}
+		if err := typ.truncated(r, afterIndex); err != nil {
+			return err
+		}
+	}
+	for i, entry := range entries {
+		typ, ok := systemEntryTypes[entry.Type]
+		if !ok || typ.appended == nil {
+			continue
+		}
+		entry.Index = afterIndex + uint64(i) + 1
+		if err := typ.appended(r, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsCommand 是否是应用到状态机的 command 类型
+func (t LogEntryType) IsCommand() bool {
+	return t == logEntryTypeCommand
+}
+
+func (t LogEntryType) String() string {
+	if t == logEntryTypeCommand {
+		return "Command"
+	}
+	if typ, ok := systemEntryTypes[t]; ok {
+		return typ.name
+	}
+	return fmt.Sprintf("LogEntryType(%d)", uint8(t))
+}
@@ -0,0 +1,67 @@
+package raft
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSystemEntryTypes(t *testing.T) {
+	const customType LogEntryType = 8
+	var calls []string
+	systemEntryTypes[customType] = systemEntryType{
+		name: "Custom",
+		appended: func(r *raft, entry LogEntry) error {
+			calls = append(calls, "appended "+string(entry.Command))
+			return nil
+		},
+		apply: func(r *raft, entry LogEntry) error {
+			calls = append(calls, "apply "+string(entry.Command))
+			return nil
+		},
+	}
+	defer delete(systemEntryTypes, customType)
+
+	if !customType.known() || customType.String() != "Custom" {
+		t.Fatalf("expect registered type known as Custom but got %s", customType)
+	}
+	if LogEntryType(9).known() || LogEntryType(9).String() != "LogEntryType(9)" {
+		t.Fatalf("expect unregistered type unknown but got %s", LogEntryType(9))
+	}
+
+	fsm := &listFSM{}
+	r, err := New("system-entry", "system-entry", fsm.apply, &memoryStore{}, &memoryLog{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raft := r.(*raft)
+	service := raft.newRPCService()
+	var results AppendEntriesResults
+	err = service.AppendEntries(AppendEntriesArgs{
+		Term:     1,
+		LeaderId: "leader",
+		Entries: []LogEntry{
+			{Term: 1, Command: Command("a")},
+			{Term: 1, Type: customType, Command: Command("custom")},
+			{Term: 1, Command: Command("b")},
+		},
+		LeaderCommit: 3,
+	}, &results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results.Success {
+		t.Fatalf("expect entries appended")
+	}
+	if err := raft.applyCommitted(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fsm.get(); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("expect applied [a b] but got %v", got)
+	}
+	if expect := []string{"appended custom", "apply custom"}; !reflect.DeepEqual(calls, expect) {
+		t.Errorf("expect calls %v but got %v", expect, calls)
+	}
+	if raft.GetLastApplied() != 3 {
+		t.Errorf("expect last applied 3 but got %d", raft.GetLastApplied())
+	}
+}
@@ -0,0 +1,108 @@
+package raft
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrUnknownLogEntryType = errors.New("err: unknown log entry type")
+	ErrKnownLogEntryType   = errors.New("err: can't override handler of known log entry type")
+)
+
+// UnknownEntryPolicy 应用没有 LogEntryHandler 的未知类型 log entry 时的行为
+//
+// 新版本可能增加 log entry 类型, 滚动升级期间旧版本节点会复制并 commit 这类 log entry,
+// 它们永远不会被交给状态机.
+type UnknownEntryPolicy uint8
+
+const (
+	// UnknownEntrySkip 跳过该 log entry, 并发出 EventUnknownLogEntry 事件
+	UnknownEntrySkip UnknownEntryPolicy = iota
+	// UnknownEntryFailStop 发出 EventUnknownLogEntry 事件并停止本节点, 不再应用之后的 log entry
+	UnknownEntryFailStop
+)
+
+func (p UnknownEntryPolicy) String() string {
+	switch p {
+	case UnknownEntrySkip:
+		return "Skip"
+	case UnknownEntryFailStop:
+		return "FailStop"
+	default:
+		return "Unknown UnknownEntryPolicy"
+	}
+}
+
+// LogEntryHandler 应用某一类型的 log entry, 与 command 依序调用
+// 返回 error 时该 log entry 未被应用, 下次应用时重试
+type LogEntryHandler func(entry LogEntry) error
+
+// known 本版本是否能处理该类型的 log entry
+func (t LogEntryType) known() bool {
+	_, ok := systemEntryTypes[t]
+	return ok || t == logEntryTypeCommand
+}
+
+// applyAlone 应用时是否需要单独处理, 而不是随 command 一起应用或跳过
+func (t LogEntryType) applyAlone() bool {
+	if t == logEntryTypeCommand {
+		return false
+	}
+	typ, ok := systemEntryTypes[t]
+	return !ok || typ.apply != nil
+}
+
+// entryTypes 未知类型 log entry 的处理方式
+type entryTypes struct {
+	policy   UnknownEntryPolicy
+	handlers map[LogEntryType]LogEntryHandler
+}
+
+// firstAloneEntry entries 中第一个需要单独应用的 log entry 的下标, 没有时返回 -1
+func firstAloneEntry(entries []LogEntry) int {
+	for i := range entries {
+		if entries[i].Type.applyAlone() {
+			return i
+		}
+	}
+	return -1
+}
+
+// applyAloneEntry 单独应用一个 log entry
+// 系统 log entry 交给其 apply; 未知类型的 log entry 有 LogEntryHandler 时交给 handler,
+// 否则按 UnknownEntryPolicy 处理
+func (r *raft) applyAloneEntry(entry LogEntry, commitIndex uint64) (done bool, err error) {
+	if typ, ok := systemEntryTypes[entry.Type]; ok {
+		err = typ.apply(r, entry)
+		if err != nil {
+			return true, err
+		}
+	} else if handler, ok := r.entryTypes.handlers[entry.Type]; ok {
+		err = handler(entry)
+		if err != nil {
+			return true, err
+		}
+	} else {
+		event := Event{
+			Type:       EventUnknownLogEntry,
+			FirstIndex: entry.Index,
+			LastIndex:  entry.Index,
+		}
+		switch r.entryTypes.policy {
+		case UnknownEntryFailStop:
+			event.Level = EventLevelCritical
+			event.Message = fmt.Sprintf("unknown log entry type %d at index %d, stopping", entry.Type, entry.Index)
+			r.emit(event)
+			r.Stop()
+			return true, fmt.Errorf("%w: %d at index %d", ErrUnknownLogEntryType, entry.Type, entry.Index)
+		default:
+			event.Level = EventLevelWarning
+			event.Message = fmt.Sprintf("skipped unknown log entry type %d at index %d", entry.Type, entry.Index)
+			r.emit(event)
+		}
+	}
+	r.SetLastApplied(entry.Index)
+	r.metrics.SetGauge(MetricLastApplied, float64(entry.Index))
+	return entry.Index >= commitIndex, nil
+}
@@ -0,0 +1,108 @@
+package raft
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestUnknownLogEntry(t *testing.T) {
+	const futureType LogEntryType = 9
+
+	newRaft := func(t *testing.T, opts ...OptFn) (*raft, *listFSM, *[]Event) {
+		fsm := &listFSM{}
+		var events []Event
+		opts = append(opts, WithObserver(func(event Event) { events = append(events, event) }))
+		r, err := New("unknown-entry", "unknown-entry", fsm.apply, &memoryStore{}, &memoryLog{}, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = r.(*raft).Append(
+			LogEntry{Term: 1, Command: Command("a")},
+			LogEntry{Term: 1, Type: futureType, Command: Command("future")},
+			LogEntry{Term: 1, Command: Command("b")},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.(*raft).SetCommitIndex(3)
+		return r.(*raft), fsm, &events
+	}
+
+	t.Run("skip", func(t *testing.T) {
+		r, fsm, events := newRaft(t)
+		err := r.applyCommitted()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fsm.get(); !reflect.DeepEqual(got, []string{"a", "b"}) {
+			t.Errorf("expect applied [a b] but got %v", got)
+		}
+		if r.GetLastApplied() != 3 {
+			t.Errorf("expect last applied 3 but got %d", r.GetLastApplied())
+		}
+		if len(*events) != 1 || (*events)[0].Type != EventUnknownLogEntry || (*events)[0].FirstIndex != 2 {
+			t.Errorf("expect unknown log entry event at index 2 but got %+v", *events)
+		}
+	})
+
+	t.Run("fail stop", func(t *testing.T) {
+		r, fsm, events := newRaft(t, WithUnknownEntryPolicy(UnknownEntryFailStop))
+		err := r.applyCommitted()
+		if !errors.Is(err, ErrUnknownLogEntryType) {
+			t.Errorf("expect %v but got %v", ErrUnknownLogEntryType, err)
+		}
+		if got := fsm.get(); !reflect.DeepEqual(got, []string{"a"}) {
+			t.Errorf("expect applied [a] but got %v", got)
+		}
+		if r.GetLastApplied() != 1 {
+			t.Errorf("expect last applied 1 but got %d", r.GetLastApplied())
+		}
+		if len(*events) != 1 || (*events)[0].Level != EventLevelCritical {
+			t.Errorf("expect critical event but got %+v", *events)
+		}
+		select {
+		case <-r.Done():
+		default:
+			t.Errorf("expect stopped")
+		}
+	})
+
+	t.Run("handler", func(t *testing.T) {
+		var handled []LogEntry
+		fail := true
+		r, fsm, events := newRaft(t, WithLogEntryHandler(futureType, func(entry LogEntry) error {
+			if fail {
+				fail = false
+				return errors.New("not ready")
+			}
+			handled = append(handled, entry)
+			return nil
+		}))
+		err := r.applyCommitted()
+		if err == nil || r.GetLastApplied() != 1 {
+			t.Errorf("expect handler error stops applying at 1 but got %d, err: %v", r.GetLastApplied(), err)
+		}
+		err = r.applyCommitted()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(handled) != 1 || string(handled[0].Command) != "future" {
+			t.Errorf("expect future entry handled but got %+v", handled)
+		}
+		if got := fsm.get(); !reflect.DeepEqual(got, []string{"a", "b"}) {
+			t.Errorf("expect applied [a b] but got %v", got)
+		}
+		if len(*events) != 0 {
+			t.Errorf("expect no event but got %+v", *events)
+		}
+	})
+
+	t.Run("known type handler", func(t *testing.T) {
+		handler := func(LogEntry) error { return nil }
+		_, err := New("known-handler", "known-handler", nil, nil, nil, WithLogEntryHandler(logEntryTypeCommand, handler))
+		if !errors.Is(err, ErrKnownLogEntryType) {
+			t.Errorf("expect ErrKnownLogEntryType but got %v", err)
+		}
+	})
+}
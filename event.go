@@ -0,0 +1,157 @@
+package raft
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// EventType 事件类型
+type EventType uint8
+
+const (
+	_ EventType = iota
+	// EventSlowApply 单批 command 应用到状态机的时间超过期限
+	EventSlowApply
+	// EventUnknownLogEntry 应用了没有 LogEntryHandler 的未知类型 log entry, 见 UnknownEntryPolicy
+	EventUnknownLogEntry
+	// EventLogDiverged 启动时探测到本节点的日志与集群分叉, 见 WithStartupProbe
+	EventLogDiverged
+	// EventSLOBurnRate commit 延迟 SLO 的燃烧率越过或回落到阈值以下, 见 WithCommitLatencySLO
+	EventSLOBurnRate
+	// EventSlowStorage 启动时测得 Log 追加耗时相对选举超时过长, 见 WithStorageBenchmark
+	EventSlowStorage
+	// EventBecameLeader 本节点成为 Leader, FirstIndex 为其任期的第一个 log entry 索引
+	EventBecameLeader
+	// EventBecameFollower 本节点不再是 Leader
+	EventBecameFollower
+	// EventLeaderChanged 本节点知道的 Leader 发生变化, Peer 为新的 Leader
+	EventLeaderChanged
+	// EventPeerAdded 集群配置中加入了 Peer, FirstIndex 为配置的索引
+	EventPeerAdded
+	// EventPeerRemoved 集群配置中移除了 Peer, FirstIndex 为配置的索引
+	EventPeerRemoved
+	// EventSnapshotTaken 创建了快照, LastIndex 为快照包含的最后一个 log entry 索引
+	EventSnapshotTaken
+	// EventLogGap Leader 复制时发现 log 中缺少未压缩的 log entry, 存储可能已损坏
+	EventLogGap
+	// EventConfigMismatch Follower 同一索引的配置与 Leader 心跳中的校验和不一致, 在一致之前拒绝投票
+	EventConfigMismatch
+	// EventLogTruncated Follower 删除了与 Leader 冲突的 log entry, [FirstIndex, LastIndex] 为删除的区间
+	// 将删除已 commit 的 log entry 时拒绝删除, 级别为 EventLevelCritical
+	EventLogTruncated
+	// EventQuorumLost Leader 与多数节点失去联系超过 WithQuorumLossTimeout, 提案返回 ErrNoQuorum
+	EventQuorumLost
+	// EventQuorumRestored Leader 恢复了与多数节点的联系
+	EventQuorumRestored
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventSlowApply:
+		return "SlowApply"
+	case EventUnknownLogEntry:
+		return "UnknownLogEntry"
+	case EventLogDiverged:
+		return "LogDiverged"
+	case EventSLOBurnRate:
+		return "SLOBurnRate"
+	case EventSlowStorage:
+		return "SlowStorage"
+	case EventBecameLeader:
+		return "BecameLeader"
+	case EventBecameFollower:
+		return "BecameFollower"
+	case EventLeaderChanged:
+		return "LeaderChanged"
+	case EventPeerAdded:
+		return "PeerAdded"
+	case EventPeerRemoved:
+		return "PeerRemoved"
+	case EventSnapshotTaken:
+		return "SnapshotTaken"
+	case EventLogGap:
+		return "LogGap"
+	case EventConfigMismatch:
+		return "ConfigMismatch"
+	case EventLogTruncated:
+		return "LogTruncated"
+	case EventQuorumLost:
+		return "QuorumLost"
+	case EventQuorumRestored:
+		return "QuorumRestored"
+	default:
+		return "Unknown EventType"
+	}
+}
+
+// EventLevel 事件级别
+type EventLevel uint8
+
+const (
+	EventLevelInfo EventLevel = iota
+	EventLevelWarning
+	EventLevelCritical
+)
+
+func (l EventLevel) String() string {
+	switch l {
+	case EventLevelInfo:
+		return "Info"
+	case EventLevelWarning:
+		return "Warning"
+	case EventLevelCritical:
+		return "Critical"
+	default:
+		return "Unknown EventLevel"
+	}
+}
+
+// slogLevel 输出事件时的日志级别
+func (l EventLevel) slogLevel() slog.Level {
+	switch l {
+	case EventLevelWarning:
+		return slog.LevelWarn
+	case EventLevelCritical:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// Event raft 一致性模型发出的事件
+type Event struct {
+	Type  EventType
+	Level EventLevel
+	Time  time.Time
+
+	// Id 发出事件的节点
+	Id   RaftId
+	Term uint64
+
+	// FirstIndex, LastIndex 事件涉及的 log entry 区间 [FirstIndex, LastIndex]
+	FirstIndex uint64
+	LastIndex  uint64
+	// Peer 事件涉及的节点, 如新的 Leader 或加入、移除的 peer
+	Peer RaftPeer
+
+	Message string
+}
+
+// Observer 接收事件
+// 在发出事件的 goroutine 中同步调用, 不应阻塞
+type Observer func(Event)
+
+// emit 向所有 Observer 与订阅者发出事件
+func (r *raft) emit(event Event) {
+	event.Time = time.Now()
+	event.Id = r.Id()
+	event.Term = r.GetCurrentTerm()
+	r.log(LogGeneral).Log(context.Background(), event.Level.slogLevel(), event.Message, "event", event.Type)
+	for _, observer := range r.observers {
+		observer(event)
+	}
+	if dropped := r.subscriptions.publish(event); dropped > 0 {
+		r.metrics.IncrCounter(MetricEventsDropped, float64(dropped))
+	}
+}
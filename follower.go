@@ -10,6 +10,8 @@ type follower struct {
 }
 
 func (f *follower) Run() (server, error) {
+	// preVote result of the in-progress pre-vote
+	var preVote <-chan bool
 	for {
 		select {
 		case <-f.Done():
@@ -26,17 +28,57 @@ func (f *follower) Run() (server, error) {
 			if !f.raft.configs.GetConfig().IncludePeer(f.Id()) {
 				continue
 			}
-			f.debug("Election timeout")
+			if f.cooldown.coolingDown(f.now()) {
+				f.log(LogElection).Debug("Election timeout, cooling down after losing election")
+				continue
+			}
+			if f.deferCampaign() {
+				continue
+			}
+			if f.pressure.declineCampaign() {
+				f.log(LogElection).Info("Election timeout, under sustained resource pressure, decline to campaign")
+				continue
+			}
+			if f.refuseCampaign() {
+				continue
+			}
+			if f.withholding.withhold(f.Id(), f.now()) {
+				f.log(LogElection).Debug("Election timeout, leadership is being transferred to another peer")
+				continue
+			}
+			if f.preVoteEnabled() {
+				// campaign only if a majority would vote for us
+				if preVote == nil {
+					preVote = f.startPreVote()
+				}
+				continue
+			}
+			f.log(LogElection).Debug("Election timeout")
 			// If election timeout elapses without receiving AppendEntries
 			// 	 RPC from current leader or granting vote to candidate:
 			// 		convert to candidate
-			return f.toCandidate(), nil
+			return f.toCandidate()
+		case won := <-preVote:
+			preVote = nil
+			if !won || f.isLeaderActive() {
+				continue
+			}
+			f.log(LogElection).Debug("Election timeout, won pre-vote")
+			return f.toCandidate()
+		case <-f.timeoutNow:
+			if !f.transfer.inTerm(f.GetCurrentTerm()) {
+				continue
+			}
+			f.log(LogElection).Debug("<- TimeoutNow")
+			// start an election immediately,
+			// as if election timeout elapsed (§3.10)
+			return f.toCandidate()
 		}
 	}
 }
 
 func (f *follower) Handle(context.Context, ...Command) error {
-	return ErrIsNotLeader
+	return f.notLeader()
 }
 
 func (f *follower) ResetTimer() {
@@ -0,0 +1,69 @@
+package raft
+
+import "io"
+
+// FSM 复制状态机, 见 WithFSM
+//
+// 与 Apply 不同, FSM 只依赖 log entry, 可以独立于 raft 一致性模型测试:
+//
+//	results, err := fsm.Apply([]raft.LogEntry{{Index: 1, Command: cmd}})
+type FSM interface {
+	// Apply 依序应用 entries 中的 command, 返回与 entries 一一对应的结果
+	//
+	// 只应用了前 n 个 command 时返回 n 个结果, 其余的 command 之后重新应用;
+	// 返回错误时, 结果中的 command 已被应用.
+	Apply(entries []LogEntry) ([]Result, error)
+	// Snapshot 返回状态机当前状态的快照, 读取完毕后关闭
+	// 读取期间不会有 command 被应用到状态机
+	Snapshot() (io.ReadCloser, error)
+	// Restore 丢弃状态机当前的状态, 从 r 中恢复
+	Restore(r io.Reader) error
+}
+
+// WithFSM 使用 fsm 作为状态机, 取代 New 的 apply 参数, 并以 fsm 创建快照, 快照保存在 store 中
+// store 为 nil 时快照只保存在内存中
+//
+//	r, err := raft.New(id, addr, nil, store, log, raft.WithFSM(fsm, snapshots))
+func WithFSM(fsm FSM, store SnapshotStore) OptFn {
+	adapter := fsmAdapter{fsm: fsm}
+	withSnapshot := WithSnapshot(adapter, store)
+	return func(o *opts) {
+		o.apply = adapter.apply
+		withSnapshot(o)
+	}
+}
+
+var _ Snapshotter = fsmAdapter{}
+
+// fsmAdapter 以 Apply 与 Snapshotter 的形式使用 FSM
+type fsmAdapter struct {
+	fsm FSM
+}
+
+func (a fsmAdapter) apply(commands Commands) (int, error) {
+	entries := EntriesOf(commands)
+	results, err := a.fsm.Apply(entries)
+	if len(results) > len(entries) {
+		results = results[:len(entries)]
+	}
+	for i, result := range results {
+		SetResult(commands, i, result)
+	}
+	return len(results), err
+}
+
+func (a fsmAdapter) Snapshot(w io.Writer) error {
+	rc, err := a.fsm.Snapshot()
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, rc)
+	if closeErr := rc.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (a fsmAdapter) Restore(r io.Reader) error {
+	return a.fsm.Restore(r)
+}
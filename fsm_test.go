@@ -0,0 +1,259 @@
+package raft
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+)
+
+var _ FSM = (*counterFSM)(nil)
+
+// counterFSM 统计每个 command 出现次数的状态机, 结果为 command 的当前次数
+type counterFSM struct {
+	mux    sync.Mutex
+	counts map[string]int
+	// limit 每次 Apply 最多应用的 command 数量, 0 表示不限制
+	limit int
+}
+
+func (f *counterFSM) Apply(entries []LogEntry) ([]Result, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if f.counts == nil {
+		f.counts = make(map[string]int)
+	}
+	if f.limit > 0 && len(entries) > f.limit {
+		entries = entries[:f.limit]
+	}
+	results := make([]Result, 0, len(entries))
+	for _, entry := range entries {
+		f.counts[string(entry.Command)]++
+		results = append(results, f.counts[string(entry.Command)])
+	}
+	return results, nil
+}
+
+func (f *counterFSM) Snapshot() (io.ReadCloser, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	data, err := json.Marshal(f.counts)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (f *counterFSM) Restore(r io.Reader) error {
+	counts := make(map[string]int)
+	if err := json.NewDecoder(r).Decode(&counts); err != nil {
+		return err
+	}
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.counts = counts
+	return nil
+}
+
+func (f *counterFSM) count(command string) int {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.counts[command]
+}
+
+func TestFSM(t *testing.T) {
+	t.Run("standalone", func(t *testing.T) {
+		fsm := &counterFSM{}
+		results, err := fsm.Apply([]LogEntry{{Index: 1, Command: Command("a")}, {Index: 2, Command: Command("a")}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 2 || results[1] != 2 {
+			t.Fatalf("expect results [1 2] but got %v", results)
+		}
+	})
+
+	t.Run("propose", func(t *testing.T) {
+		fsm := &counterFSM{limit: 1}
+		r, err := New("fsm-propose", "fsm-propose", nil, nil, nil, WithDevMode(), WithFSM(fsm, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Stop()
+		go r.Run()
+		ctx := context.Background()
+		for i := 1; i <= 3; i++ {
+			result, err := r.Propose(ctx, Command("a"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != i {
+				t.Fatalf("expect result %d but got %v", i, result)
+			}
+		}
+		// only one command is applied per call, the rest are applied later
+		if err := r.Handle(ctx, Command("b"), Command("b"), Command("b")); err != nil {
+			t.Fatal(err)
+		}
+		if count := fsm.count("b"); count != 1 {
+			t.Fatalf("expect b applied once but got %d", count)
+		}
+		if err := r.Handle(ctx, Command("c")); err != nil {
+			t.Fatal(err)
+		}
+		if count := fsm.count("b"); count != 2 {
+			t.Fatalf("expect b applied twice but got %d", count)
+		}
+	})
+
+	t.Run("snapshot and restore", func(t *testing.T) {
+		fsm := &counterFSM{}
+		if _, err := fsm.Apply([]LogEntry{{Index: 1, Command: Command("a")}}); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := (fsmAdapter{fsm: fsm}).Snapshot(&buf); err != nil {
+			t.Fatal(err)
+		}
+		restored := &counterFSM{}
+		if err := (fsmAdapter{fsm: restored}).Restore(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if count := restored.count("a"); count != 1 {
+			t.Fatalf("expect a restored with count 1 but got %d", count)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		applyErr := errors.New("apply failed")
+		commands := newCommands([]LogEntry{
+			{Index: 1, Type: logEntryTypeCommand, Command: Command("a")},
+			{Index: 2, Type: logEntryTypeCommand, Command: Command("b")},
+		})
+		n, err := fsmAdapter{fsm: &errFSM{err: applyErr}}.apply(commands)
+		if !errors.Is(err, applyErr) || n != 1 {
+			t.Fatalf("expect 1 applied with %v but got %d with %v", applyErr, n, err)
+		}
+		if result := commands.result(0); result != "a" {
+			t.Fatalf("expect result a but got %v", result)
+		}
+	})
+
+	t.Run("partial failure", func(t *testing.T) {
+		fsm := &failOnceFSM{err: errors.New("apply failed")}
+		r, err := New("fsm-partial", "fsm-partial", nil, &memoryStore{}, &memoryLog{}, WithFSM(fsm, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		raft := r.(*raft)
+		id, waiter := raft.results.register()
+		err = raft.Append(
+			LogEntry{Term: 1, Command: Command("a"), Extensions: map[string][]byte{extensionProposalId: []byte(id)}},
+			LogEntry{Term: 1, Command: Command("b")},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raft.SetCommitIndex(2)
+
+		err = raft.applyCommitted()
+		if !errors.Is(err, fsm.err) {
+			t.Fatalf("expect %v but got %v", fsm.err, err)
+		}
+		if applied := raft.GetLastApplied(); applied != 1 {
+			t.Fatalf("expect last applied 1 but got %d", applied)
+		}
+		select {
+		case <-waiter.applied:
+			if waiter.index != 1 || waiter.result != 1 {
+				t.Fatalf("expect result 1 at index 1 but got %v at %d", waiter.result, waiter.index)
+			}
+		default:
+			t.Fatal("expect result of the applied command delivered")
+		}
+
+		err = raft.applyCommitted()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a, b := fsm.count("a"), fsm.count("b"); a != 1 || b != 1 {
+			t.Fatalf("expect a and b applied once but got %d and %d", a, b)
+		}
+	})
+}
+
+// failOnceFSM 第一次 Apply 只应用第一个 command 后返回 err 的状态机
+type failOnceFSM struct {
+	counterFSM
+	err    error
+	failed bool
+}
+
+func (f *failOnceFSM) Apply(entries []LogEntry) ([]Result, error) {
+	if f.failed {
+		return f.counterFSM.Apply(entries)
+	}
+	f.failed = true
+	results, _ := f.counterFSM.Apply(entries[:1])
+	return results, f.err
+}
+
+// errFSM 只应用第一个 command 后返回 err 的状态机
+type errFSM struct {
+	counterFSM
+	err error
+}
+
+func (f *errFSM) Apply(entries []LogEntry) ([]Result, error) {
+	return []Result{string(entries[0].Command)}, f.err
+}
+
+// dataCommands 只实现 Commands 的命令序列
+type dataCommands []Command
+
+func (c dataCommands) Data() []Command { return c }
+
+func TestEntriesOf(t *testing.T) {
+	t.Run("entries", func(t *testing.T) {
+		cmds := &commands{
+			data:    []Command{Command("a")},
+			entries: []LogEntry{{Index: 3, Term: 2, Type: logEntryTypeCommand, Command: Command("a")}},
+		}
+		entries := EntriesOf(cmds)
+		if len(entries) != 1 || entries[0].Index != 3 || entries[0].Term != 2 {
+			t.Fatalf("expect entry with index 3 term 2 but got %+v", entries)
+		}
+	})
+	t.Run("data only", func(t *testing.T) {
+		entries := EntriesOf(dataCommands{Command("a"), Command("b")})
+		if len(entries) != 2 {
+			t.Fatalf("expect 2 entries but got %d", len(entries))
+		}
+		for i, want := range []string{"a", "b"} {
+			if entries[i].Type != logEntryTypeCommand || string(entries[i].Command) != want {
+				t.Fatalf("expect command entry %q but got %+v", want, entries[i])
+			}
+		}
+	})
+}
+
+func TestSetResult(t *testing.T) {
+	t.Run("out of range", func(t *testing.T) {
+		cmds := &commands{data: []Command{Command("a")}}
+		SetResult(cmds, -1, "x")
+		SetResult(cmds, 1, "x")
+		SetResult(cmds, 0, "a")
+		if res := cmds.result(0); res != "a" {
+			t.Fatalf("expect result a but got %v", res)
+		}
+		if res := cmds.result(1); res != nil {
+			t.Fatalf("expect no result but got %v", res)
+		}
+	})
+	t.Run("without setter", func(t *testing.T) {
+		SetResult(dataCommands{Command("a")}, 0, "a")
+	})
+}
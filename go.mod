@@ -1,3 +1,3 @@
 module github.com/mind1949/raft
 
-go 1.18
+go 1.21
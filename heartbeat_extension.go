@@ -0,0 +1,33 @@
+package raft
+
+// maxHeartbeatExtensionSize 心跳附加数据的最大字节数
+const maxHeartbeatExtensionSize = 4 << 10
+
+// HeartbeatExtensionProvider Leader 发送心跳时调用, 返回附加到心跳中的数据
+// (如租约元数据, 负载提示), 数据须小于 4KB, 超出时将被丢弃
+type HeartbeatExtensionProvider func() []byte
+
+// HeartbeatExtensionConsumer Follower 收到携带附加数据的心跳时调用
+// 在 rpc 处理过程中同步调用, 不应阻塞
+type HeartbeatExtensionConsumer func(leaderId RaftId, payload []byte)
+
+// heartbeatExtension 获取附加到本轮心跳中的数据
+func (r *raft) heartbeatExtension() []byte {
+	if r.heartbeatExtensionProvider == nil {
+		return nil
+	}
+	payload := r.heartbeatExtensionProvider()
+	if len(payload) > maxHeartbeatExtensionSize {
+		r.log(LogReplication).Warn("Drop heartbeat extension", "size", len(payload), "max", maxHeartbeatExtensionSize)
+		return nil
+	}
+	return payload
+}
+
+// consumeHeartbeatExtension 交付 Leader 心跳中的附加数据
+func (r *raft) consumeHeartbeatExtension(args AppendEntriesArgs) {
+	if r.heartbeatExtensionConsumer == nil || len(args.Extension) == 0 {
+		return
+	}
+	r.heartbeatExtensionConsumer(args.LeaderId, args.Extension)
+}
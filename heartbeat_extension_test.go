@@ -0,0 +1,45 @@
+package raft
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHeartbeatExtension(t *testing.T) {
+	provider := func() []byte { return []byte("lease") }
+	leader, err := New("extension-leader", "extension-leader", nil, nil, nil, WithDevMode(),
+		WithHeartbeatExtension(provider, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leader.Stop()
+	go leader.Run()
+
+	type extension struct {
+		leaderId RaftId
+		payload  string
+	}
+	received := make(chan extension, 16)
+	consumer := func(leaderId RaftId, payload []byte) {
+		select {
+		case received <- extension{leaderId: leaderId, payload: string(payload)}:
+		default:
+		}
+	}
+	follower := runLoopbackFollower(t, "extension-follower", WithHeartbeatExtension(nil, consumer))
+	defer follower.Stop()
+	err = leader.AddVoter(context.Background(), follower.Id(), follower.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case got := <-received:
+		if got.leaderId != leader.Id() || got.payload != "lease" {
+			t.Errorf("expect extension lease from %s but got %q from %s", leader.Id(), got.payload, got.leaderId)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expect follower received heartbeat extension")
+	}
+}
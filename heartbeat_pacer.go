@@ -0,0 +1,65 @@
+package raft
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// heartbeatPacer 自适应调整 Leader 的心跳间隔
+//
+// 日志复制的 AppendEntries 同样会重置 follower 的选举计时器, 持续复制时心跳是多余的:
+// 上次心跳之后有过日志复制, 心跳间隔翻倍, 但不超过 max; 空闲时恢复为 min.
+// 复制停止后至多一个 max 就会发出心跳, max 须小于选举超时的下界.
+type heartbeatPacer struct {
+	enabled  bool
+	min, max time.Duration
+
+	// interval 当前心跳间隔, 只在 Leader 的主循环中读写
+	interval time.Duration
+	// replicated 上次心跳之后是否有过日志复制
+	replicated int32
+}
+
+// newHeartbeatPacer 心跳间隔介于默认心跳间隔与选举超时下界的 3/4 之间
+func (r *raft) newHeartbeatPacer() heartbeatPacer {
+	return heartbeatPacer{
+		enabled:  r.adaptiveHeartbeat,
+		min:      r.heartbeatTimeout(),
+		max:      r.electionTimeout[0] * 3 / 4,
+		interval: r.heartbeatTimeout(),
+	}
+}
+
+// observeReplication 记录一次成功的日志复制
+func (p *heartbeatPacer) observeReplication() {
+	if p.enabled {
+		atomic.StoreInt32(&p.replicated, 1)
+	}
+}
+
+// next 计算下一个心跳间隔, 间隔改变时 changed 为 true
+func (p *heartbeatPacer) next() (interval time.Duration, changed bool) {
+	prev := p.interval
+	if atomic.SwapInt32(&p.replicated, 0) == 1 {
+		p.interval *= 2
+		if p.interval > p.max {
+			p.interval = p.max
+		}
+	} else {
+		p.interval = p.min
+	}
+	return p.interval, p.interval != prev
+}
+
+// pace 按复制流量调整心跳间隔
+func (l *leader) pace() {
+	if !l.pacer.enabled {
+		return
+	}
+	interval, changed := l.pacer.next()
+	if !changed {
+		return
+	}
+	l.ticker.Reset(interval)
+	l.metrics.SetGauge(MetricHeartbeatInterval, float64(interval.Milliseconds()))
+}
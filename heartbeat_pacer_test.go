@@ -0,0 +1,42 @@
+package raft
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHeartbeatPacer(t *testing.T) {
+	r := &raft{
+		electionTimeout:   [2]time.Duration{400 * time.Millisecond, 800 * time.Millisecond},
+		adaptiveHeartbeat: true,
+	}
+	pacer := r.newHeartbeatPacer()
+	expect := func(t *testing.T, interval time.Duration, changed bool) {
+		t.Helper()
+		gotInterval, gotChanged := pacer.next()
+		if gotInterval != interval || gotChanged != changed {
+			t.Fatalf("expect (%s, %t) but got (%s, %t)", interval, changed, gotInterval, gotChanged)
+		}
+	}
+
+	t.Run("idle", func(t *testing.T) {
+		expect(t, 200*time.Millisecond, false)
+	})
+	t.Run("stretch under replication", func(t *testing.T) {
+		pacer.observeReplication()
+		expect(t, 300*time.Millisecond, true)
+		pacer.observeReplication()
+		expect(t, 300*time.Millisecond, false)
+	})
+	t.Run("tighten when idle", func(t *testing.T) {
+		expect(t, 200*time.Millisecond, true)
+	})
+	t.Run("disabled", func(t *testing.T) {
+		r.adaptiveHeartbeat = false
+		pacer := r.newHeartbeatPacer()
+		pacer.observeReplication()
+		if interval, changed := pacer.next(); interval != 200*time.Millisecond || changed {
+			t.Fatalf("expect fixed interval but got (%s, %t)", interval, changed)
+		}
+	})
+}
@@ -32,6 +32,21 @@ func (m *raftIdIndexMap) Store(id RaftId, index uint64) {
 	m.m[id] = index
 }
 
+// StoreMax 只在 index 大于已有的值时更新, 返回是否更新
+func (m *raftIdIndexMap) StoreMax(id RaftId, index uint64) bool {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.m == nil {
+		m.m = map[RaftId]uint64{}
+	}
+
+	if old, ok := m.m[id]; ok && old >= index {
+		return false
+	}
+	m.m[id] = index
+	return true
+}
+
 func (m *raftIdIndexMap) Range(fn func(id RaftId, index uint64) bool) {
 	m.mux.Lock()
 	defer m.mux.Unlock()
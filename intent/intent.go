@@ -0,0 +1,220 @@
+// Package intent 跨多个 raft group 的两阶段 intent 协调
+//
+// 每个 raft group 各自保证一致性, 但无法原子地修改多个 group.
+// 本包提供一个构建块: 先在每个参与的 group 中写入 intent(暂存的修改),
+// 再在协调者 group 中写入 commit/abort 决议, 最后在每个参与的 group 中写入 resolve,
+// 状态机在 resolve 时应用或丢弃暂存的修改.
+//
+// 决议以协调者 group 中第一个决议为准, 协调过程中断时,
+// Recover 为超时仍未解决的 intent 补写 abort 决议(若还没有决议)并完成 resolve.
+// 在所有 group resolve 之前, 不同 group 的读者可能观察到不一致的中间状态.
+package intent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mind1949/raft"
+)
+
+var (
+	ErrUnknownGroup = errors.New("err: unknown participant group")
+	ErrNoDecision   = errors.New("err: coordinator has no decision for transaction")
+)
+
+// Kind 记录类型
+type Kind uint8
+
+const (
+	_ Kind = iota
+	// KindIntent 参与者 group 中暂存的修改
+	KindIntent
+	// KindDecision 协调者 group 中事务的 commit/abort 决议
+	KindDecision
+	// KindResolve 参与者 group 中 intent 的最终结果
+	KindResolve
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindIntent:
+		return "Intent"
+	case KindDecision:
+		return "Decision"
+	case KindResolve:
+		return "Resolve"
+	default:
+		return "Unknown Kind"
+	}
+}
+
+// Record 写入 raft log 的协调记录
+type Record struct {
+	Kind  Kind
+	TxnId string
+	// Group intent 所在的参与者 group
+	Group string
+	// Commit 决议或 resolve 的结果
+	Commit bool
+	// Payload intent 暂存的修改, 由状态机解释
+	Payload []byte
+	// Time 记录的创建时间, Recover 据此判断 intent 是否超时
+	Time time.Time
+}
+
+// magic 协调记录 command 的前缀, 与普通 command 区分
+var magic = []byte("RIN1")
+
+// Encode 将记录编码为 command
+func Encode(rec Record) raft.Command {
+	b, _ := json.Marshal(rec)
+	return append(append(raft.Command(nil), magic...), b...)
+}
+
+// Decode 解码 command 中的协调记录, 不是协调记录时 ok 为 false
+func Decode(cmd raft.Command) (rec Record, ok bool, err error) {
+	if !bytes.HasPrefix(cmd, magic) {
+		return rec, false, nil
+	}
+	err = json.Unmarshal(cmd[len(magic):], &rec)
+	if err != nil {
+		return rec, true, fmt.Errorf("err: decode intent record: %w", err)
+	}
+	return rec, true, nil
+}
+
+// Proposer 向 raft group 提交 command, raft.Raft 的 Leader 满足该接口
+type Proposer interface {
+	Handle(ctx context.Context, cmd ...raft.Command) error
+}
+
+// Decisions 协调者状态机中已应用的决议, 见 State
+type Decisions interface {
+	// Decision 获取 txnId 的决议, 没有决议时 ok 为 false
+	Decision(txnId string) (commit bool, ok bool)
+}
+
+// Pending 参与者状态机中已应用但还未 resolve 的 intent, 见 State
+type Pending interface {
+	Pending() []Record
+}
+
+// Participant 参与者 group
+type Participant struct {
+	Proposer
+	Pending
+}
+
+// Coordinator 跨 group 的两阶段 intent 协调者
+type Coordinator struct {
+	proposer  Proposer
+	decisions Decisions
+	groups    map[string]Participant
+}
+
+// NewCoordinator 使用 proposer 所在的 group 记录决议, decisions 读取该 group 已应用的决议
+func NewCoordinator(proposer Proposer, decisions Decisions, groups map[string]Participant) *Coordinator {
+	return &Coordinator{
+		proposer:  proposer,
+		decisions: decisions,
+		groups:    groups,
+	}
+}
+
+// Run 在 intents 中的每个 group 写入 intent, 全部成功时决议 commit, 否则决议 abort
+//
+// 返回最终的决议: Recover 可能已经先为该事务写入 abort 决议.
+// 写入决议之后 resolve 失败不影响结果, 由 Recover 完成.
+func (c *Coordinator) Run(ctx context.Context, txnId string, intents map[string][]byte) (committed bool, err error) {
+	for group := range intents {
+		if _, ok := c.groups[group]; !ok {
+			return false, fmt.Errorf("%w: %q", ErrUnknownGroup, group)
+		}
+	}
+
+	now := time.Now()
+	commit := true
+	for group, payload := range intents {
+		err = c.groups[group].Handle(ctx, Encode(Record{
+			Kind:    KindIntent,
+			TxnId:   txnId,
+			Group:   group,
+			Payload: payload,
+			Time:    now,
+		}))
+		if err != nil {
+			commit = false
+			break
+		}
+	}
+
+	committed, err = c.decide(ctx, txnId, commit)
+	if err != nil {
+		return false, err
+	}
+	for group := range intents {
+		// best effort, left to Recover on failure
+		c.resolve(ctx, group, txnId, committed)
+	}
+	return committed, nil
+}
+
+// Recover 为 olderThan 之前写入且仍未 resolve 的 intent 完成协调
+//
+// 没有决议的事务被视为中断, 决议 abort. 返回 resolve 的 intent 数量.
+func (c *Coordinator) Recover(ctx context.Context, olderThan time.Duration) (resolved int, err error) {
+	deadline := time.Now().Add(-olderThan)
+	for group, participant := range c.groups {
+		for _, rec := range participant.Pending.Pending() {
+			if rec.Time.After(deadline) {
+				continue
+			}
+			commit, ok := c.decisions.Decision(rec.TxnId)
+			if !ok {
+				commit, err = c.decide(ctx, rec.TxnId, false)
+				if err != nil {
+					return resolved, err
+				}
+			}
+			err = c.resolve(ctx, group, rec.TxnId, commit)
+			if err != nil {
+				return resolved, err
+			}
+			resolved++
+		}
+	}
+	return resolved, nil
+}
+
+// decide 提交决议, 返回协调者 group 中生效的决议
+func (c *Coordinator) decide(ctx context.Context, txnId string, commit bool) (bool, error) {
+	err := c.proposer.Handle(ctx, Encode(Record{
+		Kind:   KindDecision,
+		TxnId:  txnId,
+		Commit: commit,
+		Time:   time.Now(),
+	}))
+	if err != nil {
+		return false, err
+	}
+	// the first decision wins
+	decided, ok := c.decisions.Decision(txnId)
+	if !ok {
+		return false, fmt.Errorf("%w: %q", ErrNoDecision, txnId)
+	}
+	return decided, nil
+}
+
+func (c *Coordinator) resolve(ctx context.Context, group, txnId string, commit bool) error {
+	return c.groups[group].Handle(ctx, Encode(Record{
+		Kind:   KindResolve,
+		TxnId:  txnId,
+		Group:  group,
+		Commit: commit,
+		Time:   time.Now(),
+	}))
+}
@@ -0,0 +1,154 @@
+package intent
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mind1949/raft"
+	"github.com/mind1949/raft/raftmock"
+)
+
+// group 使用 State 的状态机所在的 raft group
+type group struct {
+	*raftmock.Raft
+	*State
+
+	mux     sync.Mutex
+	applied []string
+}
+
+func newGroup(id raft.RaftId) *group {
+	g := &group{State: NewState()}
+	g.Raft = raftmock.NewRaft(id, g.apply)
+	return g
+}
+
+func (g *group) apply(commands raft.Commands) (int, error) {
+	for _, cmd := range commands.Data() {
+		rec, ok, err := Decode(cmd)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			continue
+		}
+		if intent, ok := g.State.Apply(rec); ok {
+			g.mux.Lock()
+			g.applied = append(g.applied, string(intent.Payload))
+			g.mux.Unlock()
+		}
+	}
+	return len(commands.Data()), nil
+}
+
+func (g *group) get() []string {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	return append([]string(nil), g.applied...)
+}
+
+func newCoordinator() (*Coordinator, *group, map[string]*group) {
+	coordinator := newGroup("coordinator")
+	groups := map[string]*group{"a": newGroup("a"), "b": newGroup("b")}
+	participants := make(map[string]Participant)
+	for name, g := range groups {
+		participants[name] = Participant{Proposer: g, Pending: g}
+	}
+	return NewCoordinator(coordinator, coordinator, participants), coordinator, groups
+}
+
+func TestEncode(t *testing.T) {
+	rec := Record{Kind: KindIntent, TxnId: "t", Group: "a", Payload: []byte("x"), Time: time.Unix(1, 0).UTC()}
+	got, ok, err := Decode(Encode(rec))
+	if err != nil || !ok || !reflect.DeepEqual(got, rec) {
+		t.Errorf("expect %+v but got %+v, ok: %v, err: %v", rec, got, ok, err)
+	}
+	_, ok, err = Decode(raft.Command("plain"))
+	if ok || err != nil {
+		t.Errorf("expect plain command not decoded but got ok: %v, err: %v", ok, err)
+	}
+}
+
+func TestCoordinator(t *testing.T) {
+	ctx := context.Background()
+	intents := map[string][]byte{"a": []byte("a1"), "b": []byte("b1")}
+
+	t.Run("commit", func(t *testing.T) {
+		c, _, groups := newCoordinator()
+		committed, err := c.Run(ctx, "t1", intents)
+		if err != nil || !committed {
+			t.Fatalf("expect committed but got %v, err: %v", committed, err)
+		}
+		for name, g := range groups {
+			if got := g.get(); !reflect.DeepEqual(got, []string{name + "1"}) {
+				t.Errorf("expect group %s applied %s1 but got %v", name, name, got)
+			}
+			if pending := g.Pending(); len(pending) != 0 {
+				t.Errorf("expect no pending intent but got %+v", pending)
+			}
+		}
+	})
+
+	t.Run("abort on failed intent", func(t *testing.T) {
+		c, _, groups := newCoordinator()
+		groups["b"].FailAlways("Handle", errors.New("unavailable"))
+		committed, err := c.Run(ctx, "t2", intents)
+		if err != nil || committed {
+			t.Fatalf("expect aborted but got %v, err: %v", committed, err)
+		}
+		if got := groups["a"].get(); len(got) != 0 {
+			t.Errorf("expect nothing applied but got %v", got)
+		}
+		if pending := groups["a"].Pending(); len(pending) != 0 {
+			t.Errorf("expect intent resolved but got %+v", pending)
+		}
+	})
+
+	t.Run("unknown group", func(t *testing.T) {
+		c, _, _ := newCoordinator()
+		_, err := c.Run(ctx, "t3", map[string][]byte{"c": nil})
+		if !errors.Is(err, ErrUnknownGroup) {
+			t.Errorf("expect %v but got %v", ErrUnknownGroup, err)
+		}
+	})
+}
+
+func TestRecover(t *testing.T) {
+	ctx := context.Background()
+	c, coordinator, groups := newCoordinator()
+	old := time.Now().Add(-time.Hour)
+	// coordinator crashed after writing intents: t1 without decision, t2 decided commit
+	for _, txn := range []string{"t1", "t2"} {
+		err := groups["a"].Handle(ctx, Encode(Record{Kind: KindIntent, TxnId: txn, Group: "a", Payload: []byte(txn), Time: old}))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := coordinator.Handle(ctx, Encode(Record{Kind: KindDecision, TxnId: "t2", Commit: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// in-flight intent isn't touched
+	err = groups["b"].Handle(ctx, Encode(Record{Kind: KindIntent, TxnId: "t3", Group: "b", Time: time.Now()}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolved, err := c.Recover(ctx, time.Minute)
+	if err != nil || resolved != 2 {
+		t.Fatalf("expect 2 intents resolved but got %d, err: %v", resolved, err)
+	}
+	if got := groups["a"].get(); !reflect.DeepEqual(got, []string{"t2"}) {
+		t.Errorf("expect t2 applied but got %v", got)
+	}
+	if commit, ok := coordinator.Decision("t1"); !ok || commit {
+		t.Errorf("expect t1 aborted but got commit: %v, ok: %v", commit, ok)
+	}
+	if pending := groups["b"].Pending(); len(pending) != 1 {
+		t.Errorf("expect in-flight intent pending but got %+v", pending)
+	}
+}
@@ -0,0 +1,74 @@
+package intent
+
+import (
+	"sort"
+	"sync"
+)
+
+// NewState 创建空的协调状态
+func NewState() *State {
+	return &State{
+		pending:   make(map[string]Record),
+		decisions: make(map[string]bool),
+	}
+}
+
+var (
+	_ Decisions = (*State)(nil)
+	_ Pending   = (*State)(nil)
+)
+
+// State 状态机中的协调状态, 状态机在 Apply 中将解码出的协调记录交给 State
+//
+// 应随状态机一起写入快照, 才能在恢复后继续协调.
+type State struct {
+	mux       sync.Mutex
+	pending   map[string]Record
+	decisions map[string]bool
+}
+
+// Apply 应用协调记录
+// 记录是 commit 的 resolve 时返回被提交的 intent, 状态机此时应用其 Payload
+func (s *State) Apply(rec Record) (committed Record, ok bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	switch rec.Kind {
+	case KindIntent:
+		s.pending[rec.TxnId] = rec
+	case KindDecision:
+		// the first decision wins
+		if _, ok := s.decisions[rec.TxnId]; !ok {
+			s.decisions[rec.TxnId] = rec.Commit
+		}
+	case KindResolve:
+		intent, ok := s.pending[rec.TxnId]
+		if !ok {
+			return committed, false
+		}
+		delete(s.pending, rec.TxnId)
+		return intent, rec.Commit
+	}
+	return committed, false
+}
+
+// Decision 获取 txnId 的决议, 没有决议时 ok 为 false
+func (s *State) Decision(txnId string) (commit bool, ok bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	commit, ok = s.decisions[txnId]
+	return commit, ok
+}
+
+// Pending 还未 resolve 的 intent, 按写入时间排序
+func (s *State) Pending() []Record {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	records := make([]Record, 0, len(s.pending))
+	for _, rec := range s.pending {
+		records = append(records, rec)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Time.Before(records[j].Time)
+	})
+	return records
+}
@@ -0,0 +1,66 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/mind1949/raft"
+)
+
+var ErrInvalidInterval = errors.New("err: watch interval must be positive")
+
+// WatchPeerAddresses 定期解析 peer 的 DNS 名称, pod ip 变化时关闭与该 peer 的连接,
+// 直到 ctx 结束
+//
+// pod 重建后 ip 会变化, 而已建立的连接仍指向旧 ip. 地址保持为 DNS 名称(tls 校验
+// 证书依赖名称), 关闭连接后在下次拨号时重新解析. r 需实现 raft.AddrCloser,
+// 否则 WatchPeerAddresses 不做任何事.
+func WatchPeerAddresses(ctx context.Context, r raft.Raft, peers []raft.RaftPeer, interval time.Duration) error {
+	if interval <= 0 {
+		return ErrInvalidInterval
+	}
+	closer, ok := r.(raft.AddrCloser)
+	if !ok {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return watchPeerAddresses(ctx, closer, net.DefaultResolver, peers, interval)
+}
+
+type hostLookup interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+func watchPeerAddresses(ctx context.Context, closer raft.AddrCloser, resolver hostLookup, peers []raft.RaftPeer, interval time.Duration) error {
+	// resolved peer 最近一次解析到的 ip
+	resolved := make(map[raft.RaftId]string)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for _, peer := range peers {
+			host, _, err := net.SplitHostPort(string(peer.Addr))
+			if err != nil {
+				continue
+			}
+			ips, err := resolver.LookupHost(ctx, host)
+			if err != nil || len(ips) == 0 {
+				continue
+			}
+			pre, ok := resolved[peer.Id]
+			resolved[peer.Id] = ips[0]
+			if ok && pre != ips[0] {
+				_ = closer.CloseAddr(peer.Addr)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			// no-op
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Package k8s 在 Kubernetes StatefulSet 中部署 raft 的辅助工具
+//
+// StatefulSet 的 pod 名称形如 <statefulset>-<ordinal>, 通过 headless service
+// 可以使用稳定的 DNS 名称 <pod>.<service>.<namespace>.svc.<cluster-domain> 访问.
+//
+//	ss, err := k8s.FromEnv(3, 7000)
+//	id, addr, peers := ss.Id(), ss.Addr(), ss.Peers()
+//	var opts []raft.OptFn
+//	if ss.IsBootstrap() {
+//		opts = append(opts, raft.WithBootstrapAsLeader())
+//	}
+package k8s
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mind1949/raft"
+)
+
+var (
+	ErrInvalidPodName = errors.New("err: pod name is not of the form <statefulset>-<ordinal>")
+)
+
+// StatefulSet 描述 raft 节点所在的 StatefulSet
+type StatefulSet struct {
+	// Name StatefulSet 名称
+	Name string
+	// Service headless service 名称
+	Service string
+	// Namespace 命名空间
+	Namespace string
+	// ClusterDomain 集群域名, 默认为 cluster.local
+	ClusterDomain string
+	// Replicas 副本数
+	Replicas int
+	// Port raft rpc 端口
+	Port int
+	// Ordinal 本 pod 的序号
+	Ordinal int
+}
+
+// FromEnv 根据 pod 的环境推导 StatefulSet 信息
+//
+// pod 名称取自 hostname, 命名空间取自 POD_NAMESPACE 环境变量(可通过 downward api 注入),
+// headless service 名称取自 RAFT_SERVICE 环境变量, 默认与 StatefulSet 同名.
+func FromEnv(replicas, port int) (StatefulSet, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return StatefulSet{}, err
+	}
+	ss, err := ParsePodName(hostname)
+	if err != nil {
+		return StatefulSet{}, err
+	}
+	ss.Replicas = replicas
+	ss.Port = port
+	ss.Namespace = os.Getenv("POD_NAMESPACE")
+	if service := os.Getenv("RAFT_SERVICE"); service != "" {
+		ss.Service = service
+	}
+	return ss, nil
+}
+
+// ParsePodName 从 pod 名称中解析 StatefulSet 名称与序号
+func ParsePodName(pod string) (StatefulSet, error) {
+	i := strings.LastIndex(pod, "-")
+	if i <= 0 || i == len(pod)-1 {
+		return StatefulSet{}, ErrInvalidPodName
+	}
+	ordinal, err := strconv.Atoi(pod[i+1:])
+	if err != nil || ordinal < 0 {
+		return StatefulSet{}, ErrInvalidPodName
+	}
+	return StatefulSet{
+		Name:    pod[:i],
+		Service: pod[:i],
+		Ordinal: ordinal,
+	}, nil
+}
+
+// Id 本 pod 的 raft id, 即 pod 名称
+func (s StatefulSet) Id() raft.RaftId {
+	return s.id(s.Ordinal)
+}
+
+// Addr 本 pod 的 raft rpc 地址
+func (s StatefulSet) Addr() raft.RaftAddr {
+	return s.addr(s.Ordinal)
+}
+
+// Peers StatefulSet 中所有 pod 对应的 raft peer
+func (s StatefulSet) Peers() []raft.RaftPeer {
+	peers := make([]raft.RaftPeer, 0, s.Replicas)
+	for i := 0; i < s.Replicas; i++ {
+		peers = append(peers, raft.RaftPeer{Id: s.id(i), Addr: s.addr(i)})
+	}
+	return peers
+}
+
+// IsBootstrap 序号为 0 的 pod 负责初始化集群
+// 其他 pod 以空日志启动, 通过成员变更加入集群
+func (s StatefulSet) IsBootstrap() bool {
+	return s.Ordinal == 0
+}
+
+func (s StatefulSet) id(ordinal int) raft.RaftId {
+	return raft.RaftId(fmt.Sprintf("%s-%d", s.Name, ordinal))
+}
+
+func (s StatefulSet) addr(ordinal int) raft.RaftAddr {
+	host := fmt.Sprintf("%s.%s", s.id(ordinal), s.Service)
+	if s.Namespace != "" {
+		domain := s.ClusterDomain
+		if domain == "" {
+			domain = "cluster.local"
+		}
+		host = fmt.Sprintf("%s.%s.svc.%s", host, s.Namespace, domain)
+	}
+	return raft.RaftAddr(fmt.Sprintf("%s:%d", host, s.Port))
+}
@@ -0,0 +1,102 @@
+package k8s
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mind1949/raft"
+)
+
+func TestStatefulSet(t *testing.T) {
+	t.Run("invalid pod name", func(t *testing.T) {
+		for _, pod := range []string{"raft", "raft-", "-1", "raft-a"} {
+			if _, err := ParsePodName(pod); err != ErrInvalidPodName {
+				t.Errorf("ParsePodName(%q), expect %v but got %v", pod, ErrInvalidPodName, err)
+			}
+		}
+	})
+	t.Run("peers", func(t *testing.T) {
+		ss, err := ParsePodName("my-raft-2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ss.Namespace, ss.Replicas, ss.Port = "default", 3, 7000
+
+		if ss.Id() != "my-raft-2" {
+			t.Errorf("expect id %q but got %q", "my-raft-2", ss.Id())
+		}
+		expect := raft.RaftAddr("my-raft-2.my-raft.default.svc.cluster.local:7000")
+		if ss.Addr() != expect {
+			t.Errorf("expect addr %q but got %q", expect, ss.Addr())
+		}
+		peers := ss.Peers()
+		if len(peers) != 3 || peers[0].Id != "my-raft-0" {
+			t.Errorf("expect 3 peers starting with my-raft-0 but got %v", peers)
+		}
+		if ss.IsBootstrap() {
+			t.Errorf("expect only ordinal 0 bootstrap")
+		}
+	})
+}
+
+type fakeLookup struct {
+	mux   sync.Mutex
+	hosts map[string][]string
+}
+
+func (f *fakeLookup) set(host string, ips ...string) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.hosts[host] = ips
+}
+
+func (f *fakeLookup) LookupHost(_ context.Context, host string) ([]string, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.hosts[host], nil
+}
+
+type fakeCloser struct {
+	closed chan raft.RaftAddr
+}
+
+func (f *fakeCloser) CloseAddr(addr raft.RaftAddr) error {
+	f.closed <- addr
+	return nil
+}
+
+func TestWatchPeerAddresses(t *testing.T) {
+	t.Run("invalid interval", func(t *testing.T) {
+		err := WatchPeerAddresses(context.Background(), nil, nil, 0)
+		if err != ErrInvalidInterval {
+			t.Errorf("expect %v but got %v", ErrInvalidInterval, err)
+		}
+	})
+	t.Run("close connection on ip change", func(t *testing.T) {
+		lookup := &fakeLookup{hosts: map[string][]string{"raft-1.local": {"10.0.0.1"}}}
+		closer := &fakeCloser{closed: make(chan raft.RaftAddr, 1)}
+		peers := []raft.RaftPeer{{Id: "1", Addr: "raft-1.local:7000"}}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go watchPeerAddresses(ctx, closer, lookup, peers, 10*time.Millisecond)
+
+		select {
+		case addr := <-closer.closed:
+			t.Fatalf("expect no close before ip change but closed %q", addr)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		lookup.set("raft-1.local", "10.0.0.2")
+		select {
+		case addr := <-closer.closed:
+			// 地址保持为 DNS 名称
+			if addr != peers[0].Addr {
+				t.Errorf("expect %q but got %q", peers[0].Addr, addr)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expect connection closed after ip change")
+		}
+	})
+}
@@ -0,0 +1,30 @@
+package k8s
+
+import (
+	"net/http"
+
+	"github.com/mind1949/raft"
+)
+
+// LivenessHandler 存活探针: raft 一致性模型未停止即为存活
+func LivenessHandler(r raft.Raft) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		select {
+		case <-r.Done():
+			http.Error(w, "stopped", http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte("ok"))
+		}
+	})
+}
+
+// ReadinessHandler 就绪探针: 根据 raft.Raft.Healthy 判断
+func ReadinessHandler(r raft.Raft) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if !r.Healthy() {
+			http.Error(w, "unhealthy", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+}
@@ -4,9 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"sync"
 	"sync/atomic"
-	"time"
 )
 
 var _ server = (*leader)(nil)
@@ -24,6 +24,12 @@ type leader struct {
 	//	increases monotonically)
 	matchIndex raftIdIndexMap
 
+	// learners non-voting members catching up with leader
+	learners learnerTracker
+
+	// reads batch ReadIndex requests
+	reads readIndexBatcher
+
 	// once resetTimer
 	once sync.Once
 
@@ -33,11 +39,43 @@ type leader struct {
 	// jointCommitCond
 	jointCommitCond *sync.Cond
 
-	// stepDown wether or not been stepped down
+	// stepDown whether or not been stepped down
 	stepDown int32
+
+	// transferring whether or not transferring leadership
+	transferring int32
+
+	// transferTarget target of the in-progress leadership transfer
+	transferTarget atomic.Value
+	// pausedUntil unix nano until which new proposals are rejected during leadership transfer
+	pausedUntil int64
+
+	// quorumLost whether or not lost contact with a majority longer than quorumLossTimeout
+	quorumLost int32
+
+	// contact last contact with each peer
+	contact contactTracker
+
+	// replicators replicate log entries to each peer
+	replicators replicatorSet
+
+	// pacer adjust heartbeat interval to replication traffic
+	pacer heartbeatPacer
+
+	// batcher coalesce concurrent proposals
+	batcher proposalBatcher
+
+	// termCommitted closed after committing a no-op in the term, see commitNoop
+	termCommitted chan struct{}
 }
 
 func (l *leader) Run() (server, error) {
+	defer l.stopReplicators()
+	defer close(l.batcher.stopped)
+	if l.batcher.enabled() {
+		go l.loopBatchProposals()
+	}
+
 	// Upon election: sendding initial empty AppendEntries RPC
 	// (heartbeat) to each server
 	err := l.sendHeartbeats()
@@ -48,6 +86,7 @@ func (l *leader) Run() (server, error) {
 	done := make(chan struct{})
 	defer close(done)
 	go l.loopTransiteToNewConfig(done)
+	go l.commitNoop(done)
 
 	for {
 		select {
@@ -64,7 +103,14 @@ func (l *leader) Run() (server, error) {
 		case <-l.ticker.C:
 			// the leader steps down (returns to follower state)
 			if atomic.LoadInt32(&l.stepDown) != 0 {
-				l.debug("Stepped down, convert to follower...")
+				l.log(LogElection).Info("Stepped down, convert to follower")
+				return l.toFollower(l.GetCurrentTerm())
+			}
+
+			// the leader loses contact with a majority
+			if !l.checkQuorum() {
+				l.log(LogElection).Warn("Lost contact with a majority, convert to follower")
+				l.metrics.IncrCounter(MetricQuorumLost, 1)
 				return l.toFollower(l.GetCurrentTerm())
 			}
 
@@ -74,6 +120,15 @@ func (l *leader) Run() (server, error) {
 			if err != nil {
 				return nil, err
 			}
+			// responses may be dropped while sending heartbeats
+			if term, stale := l.staleTerm(); stale {
+				l.log(LogElection).Info("Discovered higher term, convert to follower", "newTerm", term)
+				return l.toFollower(term)
+			}
+			// after the heartbeats refreshed the contacts
+			l.detectQuorumLoss()
+			l.avoidPressure()
+			l.pace()
 		}
 	}
 }
@@ -83,49 +138,123 @@ func (l *leader) Run() (server, error) {
 // respond after entry applied to state machine (§5.3)
 //
 // append log entry -->  log replication --> apply 客户端命令 cmd
-func (l *leader) Handle(ctx context.Context, cmd ...Command) error {
+func (l *leader) Handle(ctx context.Context, cmd ...Command) (err error) {
 	if len(cmd) == 0 {
 		return nil
 	}
+	ctx, end := l.writeTracer.Start(ctx, SpanPropose, Label{Name: "raft.commands", Value: strconv.Itoa(len(cmd))})
+	defer func() { end(err) }()
+	if l.proposalsPaused() {
+		return ErrLeadershipTransferInProgress
+	}
+	if term, stale := l.staleTerm(); stale {
+		return l.staleLeaderError(term)
+	}
+	if l.noQuorum() {
+		return ErrNoQuorum
+	}
 
 	// If command received from client: append entry to local log,
 	// respond after entry applied to state machine (§5.3)
 	entries := make([]LogEntry, 0, len(cmd))
 	currentTerm := l.GetCurrentTerm()
+	proposer := ProposerFromContext(ctx)
+	now := l.now()
 	for i := range cmd {
 		entries = append(entries, LogEntry{
-			Term:    currentTerm,
-			Command: cmd[i],
+			Term:       currentTerm,
+			Command:    cmd[i],
+			AppendTime: now,
+			Proposer:   proposer,
+			Extensions: proposalExtensions(ctx, i, len(cmd)),
 		})
 	}
+	l.injectTraceContext(ctx, entries)
+	if l.batcher.enabled() {
+		return l.proposeBatched(ctx, entries)
+	}
+	err = l.commitEntries(ctx, entries)
+	if err != nil {
+		return err
+	}
+	if AcknowledgementFromContext(ctx) == AckCommitted {
+		l.notifyApply()
+		return nil
+	}
+	return l.applyCommitted()
+}
+
+// commitEntries 追加 entries, 复制到多数派后 commit
+func (l *leader) commitEntries(ctx context.Context, entries []LogEntry) error {
+	_, end := l.writeTracer.Start(ctx, SpanAppend)
 	err := l.Append(entries...)
+	end(err)
 	if err != nil {
 		return err
 	}
+	return l.commitAppended(ctx, entries)
+}
 
-	err = l.replicateToAll(ctx)
+// commitAppended 将已追加到本地 log 的 entries 复制到多数派后 commit
+func (l *leader) commitAppended(ctx context.Context, entries []LogEntry) (err error) {
+	replicateCtx, end := l.writeTracer.Start(ctx, SpanReplicate)
+	if l.configs.GetConfig().IsStandalone(l.Id()) {
+		// single-node fast path:
+		// the local durable append alone forms a majority
+		_, err = l.replicate(l.Id(), l.Addr())
+	} else {
+		err = l.replicateToAll(replicateCtx)
+	}
+	end(err)
 	if err != nil {
 		return err
 	}
+	_, end = l.writeTracer.Start(ctx, SpanCommit)
 	ok, err := l.refreshCommitIndex()
+	end(err)
 	if err != nil {
 		return err
 	}
 	if !ok {
-		panic("refresh commit index failed")
+		// the term moved on while replicating, e.g. a higher term seen from a peer
+		return l.staleLeaderError(l.GetCurrentTerm())
 	}
-
-	return l.applyCommitted()
+	l.observeCommitLatency(entries)
+	return nil
 }
 
 func (l *leader) sendHeartbeats() error {
 	// Leaders send periodic
 	// heartbeats (AppendEntries RPCs that carry no log entries)
 	// to all followers in order to maintain their authority.
-	var wg sync.WaitGroup
 	config := l.raft.configs.GetConfig()
-	for _, peer := range config.GetPeers() {
-		id, addr := peer.Id, peer.Addr
+	// learners never vote, but still need to know the leader
+	// to redirect clients
+	peers := config.GetPeers()
+	for _, learner := range l.learners.peers() {
+		if !includePeer(peers, learner) {
+			peers = append(peers, learner)
+		}
+	}
+	if config.IsStandalone(l.Id()) && len(peers) == 1 {
+		l.refreshLastHeartbeat()
+		return nil
+	}
+	extension := l.heartbeatExtension()
+	checksum, err := configChecksum(config)
+	if err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	for _, peer := range peers {
+		if l.quarantine.contains(peer.Id) {
+			continue
+		}
+		// the in-flight AppendEntries serves as heartbeat
+		if l.replicators.inflight(peer.Id) && !l.bandwidth.throttled(peer.Id) {
+			continue
+		}
+		id, addr := peer.Id, l.resolve(peer)
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -133,18 +262,47 @@ func (l *leader) sendHeartbeats() error {
 				l.refreshLastHeartbeat()
 				return
 			}
-			// empty args
-			var args = AppendEntriesArgs{
-				Term:     l.GetCurrentTerm(),
-				LeaderId: l.Id(),
-			}
-			l.rpc.CallAppendEntries(addr, args)
+			l.heartbeat(id, addr, extension, config.GetIndex(), checksum)
 		}()
 	}
 	wg.Wait()
 	return nil
 }
 
+// heartbeat 向 peer 发送心跳
+func (l *leader) heartbeat(id RaftId, addr RaftAddr, extension []byte, configIndex, configChecksum uint64) (AppendEntriesResults, error) {
+	// carries no log entries, but the entries known to match
+	// so that idle followers learn the commit index
+	prevLogIndex, _ := l.matchIndex.Load(id)
+	prevLogTerm, err := l.Get(prevLogIndex)
+	if err != nil || prevLogTerm == 0 {
+		prevLogIndex, prevLogTerm = 0, 0
+	}
+	var args = AppendEntriesArgs{
+		Term:           l.GetCurrentTerm(),
+		LeaderId:       l.Id(),
+		LeaderAddr:     l.Addr(),
+		PrevLogIndex:   prevLogIndex,
+		PrevLogTerm:    prevLogTerm,
+		LeaderCommit:   l.GetCommitIndex(),
+		Extension:      extension,
+		TransferTarget: l.getTransferTarget(),
+		ConfigIndex:    configIndex,
+		ConfigChecksum: configChecksum,
+	}
+	start := l.now()
+	results, err := l.rpc.CallAppendEntries(addr, args)
+	if err == nil {
+		// a response with a higher term doesn't acknowledge the leadership
+		if results.Term == l.GetCurrentTerm() {
+			l.contact.observe(id, start)
+		}
+		l.observeProtocolVersion(id, results.ProtocolVersion)
+		l.pressure.observePeer(id, results.UnderPressure)
+	}
+	return results, err
+}
+
 // ResetTimer
 // 重置计时器(心跳)
 func (l *leader) ResetTimer() {
@@ -160,58 +318,6 @@ func (*leader) String() string {
 	return "Leader"
 }
 
-// replicateToAll
-// replicateToAll log entries to all peers
-func (l *leader) replicateToAll(ctx context.Context) error {
-	config := l.configs.GetConfig()
-	peers := config.GetPeers()
-	replicateCh := make(chan RaftId, len(peers))
-
-	go func() {
-		defer close(replicateCh)
-
-		var wg sync.WaitGroup
-		for _, peer := range peers {
-			wg.Add(1)
-			go func(id RaftId, addr RaftAddr) {
-				defer wg.Done()
-
-				for {
-					select {
-					case <-ctx.Done():
-						return
-					default:
-						// no-op
-					}
-
-					success, err := l.replicate(id, addr)
-					if err != nil {
-						continue
-					}
-					if success {
-						replicateCh <- id
-						return
-					}
-				}
-			}(peer.Id, peer.Addr)
-		}
-		wg.Wait()
-	}()
-
-	decider := config.NewDecider()
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case replicateId := <-replicateCh:
-			decider.AddVote(replicateId)
-			if decider.HasAchievedMajority() {
-				return nil
-			}
-		}
-	}
-}
-
 // replicate replicate log entries to specify peer
 func (l *leader) replicate(id RaftId, addr RaftAddr) (success bool, err error) {
 	lastLogIndex, _, err := l.Last()
@@ -230,13 +336,16 @@ func (l *leader) replicate(id RaftId, addr RaftAddr) (success bool, err error) {
 	if !ok {
 		nextIndex = lastLogIndex + 1
 	}
-	prevLogIndex := nextIndex - 1
-	prevLogTerm, err := l.Get(prevLogIndex)
+	// log entries needed by peer have been compacted
+	firstIndex, err := l.FirstIndex()
 	if err != nil {
-		return
+		return false, err
 	}
+	if nextIndex < firstIndex {
+		return false, l.sendSnapshot(id, addr)
+	}
+	prevLogIndex := nextIndex - 1
 
-	var entries []LogEntry
 	// 为了避免 Figure 8 的问题
 	// 若最新 log entry 的 term 不是 currentTerm
 	// 则不复制
@@ -244,41 +353,42 @@ func (l *leader) replicate(id RaftId, addr RaftAddr) (success bool, err error) {
 	if err != nil {
 		return false, err
 	}
-	if lastLogTerm == l.GetCurrentTerm() {
-		// FIXME: 什么时候会出现 last log index < next ?
-		// If last log index ≥ nextIndex for a follower: send
-		// AppendEntries RPC with log entries starting at nextIndex
-		if lastLogIndex >= nextIndex {
-			start, end := nextIndex-1, lastLogIndex
-			entries, err = l.RangeGet(start, end)
-			if err != nil {
-				return false, err
-			}
-		}
+	end := prevLogIndex
+	// FIXME: 什么时候会出现 last log index < next ?
+	// If last log index ≥ nextIndex for a follower: send
+	// AppendEntries RPC with log entries starting at nextIndex
+	if lastLogTerm == l.GetCurrentTerm() && lastLogIndex >= nextIndex {
+		end = l.appendEnd(prevLogIndex, lastLogIndex)
 	}
+	prevLogTerm, entries, err := l.readEntries(prevLogIndex, end)
+	if errors.Is(err, errLogEntryCompacted) {
+		// compacted after checking first index
+		return false, l.sendSnapshot(id, addr)
+	}
+	if err != nil {
+		return false, err
+	}
+	entries = l.limitAppendBytes(entries)
 
 	args := AppendEntriesArgs{
-		Term:         l.GetCurrentTerm(),
-		LeaderId:     l.Id(),
-		PrevLogIndex: prevLogIndex,
-		PrevLogTerm:  prevLogTerm,
-		Entries:      entries,
-		LeaderCommit: l.GetCommitIndex(),
+		Term:           l.GetCurrentTerm(),
+		LeaderId:       l.Id(),
+		LeaderAddr:     l.Addr(),
+		PrevLogIndex:   prevLogIndex,
+		PrevLogTerm:    prevLogTerm,
+		Entries:        entries,
+		LeaderCommit:   l.GetCommitIndex(),
+		TransferTarget: l.getTransferTarget(),
 	}
 
-	results, err := l.rpc.CallAppendEntries(addr, args)
+	results, err := l.callAppendEntries(id, addr, args)
 	if err != nil {
-		l.debug("Call %s's AppendEntries, err: %+v", id, err)
 		return false, err
 	}
 	// If successful: update nextIndex and matchIndex for
 	// follower (§5.3)
 	if results.Success {
-		if len(args.Entries) > 0 {
-			nextIndex := args.Entries[len(args.Entries)-1].Index + 1
-			l.nextIndex.Store(id, nextIndex)
-		}
-		l.matchIndex.Store(id, prevLogIndex+uint64(len(args.Entries)))
+		l.acknowledge(id, args, results, lastLogIndex)
 		return results.Success, nil
 	}
 
@@ -287,10 +397,65 @@ func (l *leader) replicate(id RaftId, addr RaftAddr) (success bool, err error) {
 	if nextIndex == 1 {
 		return results.Success, nil
 	}
-	l.nextIndex.Store(id, nextIndex-1)
+	l.nextIndex.Store(id, l.conflictNextIndex(nextIndex, results))
+	l.gaugeProgress(id, lastLogIndex)
 	return results.Success, nil
 }
 
+// callAppendEntries 调用 peer 的 AppendEntries, 并记录与 peer 的联系
+func (l *leader) callAppendEntries(id RaftId, addr RaftAddr, args AppendEntriesArgs) (AppendEntriesResults, error) {
+	if err := l.throttle(id, entriesSize(args.Entries)); err != nil {
+		return AppendEntriesResults{}, err
+	}
+	start := l.now()
+	end := l.traceAppendEntries(id, args.Entries)
+	results, err := l.rpc.CallAppendEntries(l.resolve(RaftPeer{id, addr}), args)
+	end(err)
+	elapsed := l.now().Sub(start)
+	l.learners.record(id, args.Entries, elapsed, err == nil && results.Success)
+	if err != nil {
+		l.log(LogTransport).Debug("Call AppendEntries", "peer", id, "err", err)
+		return results, err
+	}
+	// a response with a higher term doesn't acknowledge the leadership
+	if results.Term == l.GetCurrentTerm() {
+		l.contact.observe(id, start)
+	}
+	l.observeProtocolVersion(id, results.ProtocolVersion)
+	l.pressure.observePeer(id, results.UnderPressure)
+	return results, nil
+}
+
+// acknowledge peer 成功追加了 args 中的 log entry, 更新其 matchIndex 与 nextIndex
+func (l *leader) acknowledge(id RaftId, args AppendEntriesArgs, results AppendEntriesResults, lastLogIndex uint64) {
+	matchIndex := args.PrevLogIndex + uint64(len(args.Entries))
+	// follower acknowledges cumulatively, an ack may cover
+	// entries sent by other AppendEntries
+	if results.MatchIndex > matchIndex && results.MatchIndex <= lastLogIndex {
+		matchIndex = results.MatchIndex
+	}
+	if !l.matchIndex.StoreMax(id, matchIndex) {
+		// already covered by a later ack
+		l.metrics.IncrCounter(MetricAppendEntriesAcksCoalesced, 1, Label{Name: LabelPeer, Value: string(id)})
+	}
+	l.nextIndex.StoreMax(id, matchIndex+1)
+	l.gaugeProgress(id, lastLogIndex)
+}
+
+// gaugeProgress 记录 peer 的 nextIndex, matchIndex 及其落后 Leader 的 log entry 数
+func (l *leader) gaugeProgress(id RaftId, lastLogIndex uint64) {
+	label := Label{Name: LabelPeer, Value: string(id)}
+	nextIndex, _ := l.nextIndex.Load(id)
+	matchIndex, _ := l.matchIndex.Load(id)
+	var lag uint64
+	if lastLogIndex > matchIndex {
+		lag = lastLogIndex - matchIndex
+	}
+	l.metrics.SetGauge(MetricPeerNextIndex, float64(nextIndex), label)
+	l.metrics.SetGauge(MetricPeerMatchIndex, float64(matchIndex), label)
+	l.metrics.SetGauge(MetricPeerLag, float64(lag), label)
+}
+
 // refreshCommitIndex
 //
 // If there exists an N such that N > commitIndex, a majority
@@ -336,6 +501,9 @@ func (l *leader) refreshCommitIndex() (bool, error) {
 		return false, nil
 	}
 	l.SetCommitIndex(nextCommitIndex)
+	l.metrics.SetGauge(MetricCommitIndex, float64(nextCommitIndex))
+	l.gaugeApplyBacklog()
+	l.notifyPreApply()
 
 	// Once Cold,new has been committed, neither Cold nor Cnew
 	// can make decisions without approval of the other, and the
@@ -365,18 +533,38 @@ func (l *leader) ChangeConfig(ctx context.Context, add []RaftPeer, remove []Raft
 	if len(add)+len(remove) == 0 {
 		return nil
 	}
+	if l.proposalsPaused() {
+		return ErrLeadershipTransferInProgress
+	}
+	err := l.commitInTerm(ctx)
+	if err != nil {
+		return err
+	}
+	// fail fast before catching up new servers
+	if l.configChangeInProgress(l.configs.GetConfig()) {
+		return ErrConfigChangeInProgress
+	}
+	err = l.authorizeMembershipChange(ctx, add, remove)
+	if err != nil {
+		return err
+	}
 
 	// non-voting phase
-	err := l.tryCatchupLeader(ctx, add)
+	err = l.tryCatchupLeader(ctx, add)
 	if err != nil {
 		return err
 	}
 
-	l.ccm.Lock()
+	if !l.ccm.TryLock() {
+		return ErrConfigChangeInProgress
+	}
 	defer l.ccm.Unlock()
 
 	// generate joint consensus configuration
 	config := l.raft.configs.GetConfig()
+	if l.configChangeInProgress(config) {
+		return ErrConfigChangeInProgress
+	}
 	jointConfig := config.GenJointConfig(add, remove)
 	// store the configuration for joint consensus as log entry
 	logEntry, err := l.configs.NewConfigLogEntry(
@@ -396,7 +584,7 @@ func (l *leader) ChangeConfig(ctx context.Context, add []RaftPeer, remove []Raft
 	if err != nil {
 		return err
 	}
-	l.debug("~> C(old,new): %s", jointConfig)
+	l.log(LogReplication).Info("~> C(old,new)", "config", jointConfig)
 	// replicates log entry
 	err = l.replicateToAll(ctx)
 	if err != nil {
@@ -421,6 +609,15 @@ func (l *leader) ChangeConfig(ctx context.Context, add []RaftPeer, remove []Raft
 // log entries to it, but it is not yet counted towards majorities for voting or commitment purposes.
 // Once the new server has caught up with the rest of the cluster, the reconfiguration can proceed
 func (l *leader) tryCatchupLeader(ctx context.Context, peers []RaftPeer) error {
+	for _, peer := range peers {
+		l.learners.add(peer)
+	}
+	defer func() {
+		for _, peer := range peers {
+			l.learners.remove(peer.Id)
+		}
+	}()
+
 	errCh := make(chan error, len(peers))
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -441,6 +638,9 @@ func (l *leader) tryCatchupLeader(ctx context.Context, peers []RaftPeer) error {
 				// durations shrink in time. The algorithm waits a fixed number of rounds (such as 10). If the last
 				// round lasts less than an election timeout, then the leader adds the new server to the cluster, under
 				// the assumption that there are not enough unreplicated entries to create a significant availability gap.
+				//
+				// Instead of timing only the last round, the learner's recent replication throughput is used to
+				// estimate whether the remaining entries can be replicated within an election timeout.
 				const rounds = 10
 				for i := 0; i < rounds; i++ {
 					select {
@@ -450,8 +650,7 @@ func (l *leader) tryCatchupLeader(ctx context.Context, peers []RaftPeer) error {
 						// no-op
 					}
 
-					start := time.Now()
-					success, err := l.replicate(peer.Id, peer.Addr)
+					_, err := l.replicate(peer.Id, peer.Addr)
 					if i < rounds-1 {
 						continue
 					}
@@ -460,8 +659,7 @@ func (l *leader) tryCatchupLeader(ctx context.Context, peers []RaftPeer) error {
 						errCh <- err
 						return
 					}
-					timout := time.Since(start) > l.raft.electionTimeout[0]
-					if timout || !success {
+					if !l.isPromotable(peer.Id) {
 						format := "Peer %s may bee too slow to catch up leader"
 						msg := fmt.Sprintf(format, peer)
 						err = errors.New(msg)
@@ -476,6 +674,71 @@ func (l *leader) tryCatchupLeader(ctx context.Context, peers []RaftPeer) error {
 	return <-errCh
 }
 
+// commitInTerm 确保 Leader 已在其 term 中 commit 了 log entry
+//
+// 在此之前 Leader 无法得知之前 term 的配置是否已 commit,
+// 不能开始新的配置变更, 因此先 commit 一个 no-op log entry.
+func (l *leader) commitInTerm(ctx context.Context) error {
+	currentTerm := l.GetCurrentTerm()
+	term, err := l.Get(l.GetCommitIndex())
+	if err != nil || term == currentTerm {
+		return err
+	}
+	_, err = l.AppendEntry(LogEntry{
+		Term:       currentTerm,
+		Type:       logEntryTypeNoop,
+		AppendTime: l.now(),
+	})
+	if err != nil {
+		return err
+	}
+	if l.configs.GetConfig().IsStandalone(l.Id()) {
+		_, err = l.replicate(l.Id(), l.Addr())
+	} else {
+		err = l.replicateToAll(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = l.refreshCommitIndex()
+	return err
+}
+
+// commitNoop 当选后在新的 term 中 commit 一个 no-op log entry (§6.4)
+//
+// 在此之前 Leader 的 commitIndex 可能落后, 不能作为 read index;
+// 之前 term 的 log entry 也只能随本 term 的 log entry 一起 commit.
+// 无论成功与否, 结束后关闭 termCommitted.
+func (l *leader) commitNoop(done <-chan struct{}) {
+	defer close(l.termCommitted)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-done:
+		case <-l.Done():
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+	err := l.commitInTerm(ctx)
+	if err != nil {
+		l.log(LogReplication).Debug("Commit no-op in new term", "err", err)
+		return
+	}
+	l.notifyApply()
+}
+
+// waitTermCommitted 等待 commitNoop 结束
+func (l *leader) waitTermCommitted(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-l.termCommitted:
+		return nil
+	}
+}
+
 // loopTransiteToNewConfig wait for transitting from C(old,new) to C(new)
 func (l *leader) loopTransiteToNewConfig(done <-chan struct{}) {
 	for {
@@ -499,7 +762,7 @@ func (l *leader) loopTransiteToNewConfig(done <-chan struct{}) {
 			}
 			err := l.transiteToNewConfig()
 			if err != nil {
-				l.debug("transite to C(new) failed, err: %v", err)
+				l.log(LogReplication).Warn("Transit to C(new)", "err", err)
 			}
 		}()
 	}
@@ -535,7 +798,7 @@ func (l *leader) transiteToNewConfig() error {
 		return err
 	}
 
-	l.debug("~> C(new): %s", newConfig)
+	l.log(LogReplication).Info("~> C(new)", "config", newConfig)
 	// if leader is not in the new configuration,
 	// the leader steps down (returns to follower state)
 	// once it has committed the Cnew log entry.
@@ -0,0 +1,92 @@
+package raft
+
+import (
+	"fmt"
+	"sync"
+)
+
+// NotLeaderError 非 Leader 节点拒绝请求时返回, 携带本节点知道的 Leader, 供客户端重定向
+//
+//	var notLeader *raft.NotLeaderError
+//	if errors.As(err, &notLeader) {
+//		// retry on notLeader.Leader.Addr
+//	}
+//
+// errors.Is(err, ErrIsNotLeader) 为 true
+type NotLeaderError struct {
+	Leader RaftPeer
+	Term   uint64
+}
+
+func (e *NotLeaderError) Error() string {
+	return fmt.Sprintf("%s, leader is %s(%s) at term %d", ErrIsNotLeader, e.Leader.Id, e.Leader.Addr, e.Term)
+}
+
+func (e *NotLeaderError) Is(target error) bool {
+	return target == ErrIsNotLeader
+}
+
+// leaderHint 本节点从 Leader 的 rpc 中得知的 Leader
+//
+// learner 等非投票成员不参与选举, 只能通过 Leader 的复制流得知 leadership 的变化,
+// 因此 Leader 的每个 AppendEntries 与 InstallSnapshot 都携带自己的地址.
+type leaderHint struct {
+	mux    sync.RWMutex
+	term   uint64
+	leader RaftPeer
+}
+
+// observe 记录 term 的 Leader, 忽略旧 term 的 Leader
+func (h *leaderHint) observe(term uint64, leader RaftPeer) {
+	if leader.Id.isNil() {
+		return
+	}
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	if term < h.term {
+		return
+	}
+	if term == h.term && leader.Addr == "" {
+		leader.Addr = h.leader.Addr
+	}
+	h.term, h.leader = term, leader
+}
+
+// get 返回 term 的 Leader
+func (h *leaderHint) get(term uint64) (RaftPeer, bool) {
+	h.mux.RLock()
+	defer h.mux.RUnlock()
+	if h.term != term || h.leader.Id.isNil() {
+		return RaftPeer{}, false
+	}
+	return h.leader, true
+}
+
+// Leader 返回本节点知道的当前 term 的 Leader
+func (r *raft) Leader() (RaftPeer, bool) {
+	if r.IsLeader() {
+		return RaftPeer{Id: r.Id(), Addr: r.Addr()}, true
+	}
+	leader, ok := r.hint.get(r.GetCurrentTerm())
+	if !ok {
+		return leader, false
+	}
+	if leader.Addr == "" {
+		// leaders of old protocol don't advertise address
+		for _, peer := range r.configs.GetConfig().GetPeers() {
+			if peer.Id == leader.Id {
+				leader.Addr = peer.Addr
+			}
+		}
+	}
+	return leader, true
+}
+
+// notLeader 非 Leader 拒绝请求时返回的错误, 知道 Leader 时为 *NotLeaderError
+func (r *raft) notLeader() error {
+	leader, ok := r.Leader()
+	if !ok || leader.Id == r.Id() {
+		return ErrIsNotLeader
+	}
+	return &NotLeaderError{Leader: leader, Term: r.GetCurrentTerm()}
+}
@@ -0,0 +1,91 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLeaderHint(t *testing.T) {
+	r, err := New("hint-follower", "hint-follower", nil, &memoryStore{}, &memoryLog{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.Leader(); ok {
+		t.Errorf("expect leader unknown")
+	}
+	if err := r.Handle(context.Background()); err != ErrIsNotLeader {
+		t.Errorf("expect %v but got %v", ErrIsNotLeader, err)
+	}
+
+	// term is updated by the follower's loop, which isn't running
+	r.(*raft).SetCurrentTerm(1)
+	service := r.(*raft).newRPCService()
+	args := AppendEntriesArgs{Term: 1, LeaderId: "hint-leader", LeaderAddr: "hint-leader-addr"}
+	var results AppendEntriesResults
+	err = service.AppendEntries(args, &results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leader, ok := r.Leader()
+	if !ok || leader.Id != "hint-leader" || leader.Addr != "hint-leader-addr" {
+		t.Errorf("expect leader hint-leader but got %+v", leader)
+	}
+
+	err = r.Handle(context.Background(), Command("x"))
+	var notLeader *NotLeaderError
+	if !errors.As(err, &notLeader) || !errors.Is(err, ErrIsNotLeader) {
+		t.Fatalf("expect *NotLeaderError but got %v", err)
+	}
+	if notLeader.Leader != leader || notLeader.Term != 1 {
+		t.Errorf("expect hint %+v at term 1 but got %+v", leader, notLeader)
+	}
+
+	// a new term without hearing from its leader
+	r.(*raft).SetCurrentTerm(2)
+	if leader, ok := r.Leader(); ok {
+		t.Errorf("expect leader unknown in new term but got %+v", leader)
+	}
+}
+
+func TestLeaderHintToLearner(t *testing.T) {
+	r, err := New("hint-leader", "hint-leader", nil, nil, nil, WithDevMode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	go r.Run()
+
+	learner, err := New("hint-learner", "hint-learner", nil, &memoryStore{}, &memoryLog{},
+		WithRPC(newLoopbackRPC()), WithElection(5*time.Second, 6*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer learner.Stop()
+	go learner.Run()
+	for {
+		if _, ok := loopbackServices.Load(string(learner.Addr())); ok {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// learner being caught up isn't in configuration yet
+	l := r.(*raft).GetServer().(*leader)
+	l.learners.add(RaftPeer{Id: learner.Id(), Addr: learner.Addr()})
+	err = l.sendHeartbeats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the learner adopts the leader's term asynchronously
+	deadline := time.Now().Add(time.Second)
+	hint, ok := learner.Leader()
+	for !ok && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+		hint, ok = learner.Leader()
+	}
+	if !ok || hint.Id != r.Id() || hint.Addr != r.Addr() {
+		t.Errorf("expect learner knows leader %s but got %+v", r.Id(), hint)
+	}
+}
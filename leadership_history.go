@@ -0,0 +1,117 @@
+package raft
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// leadership 变化的原因
+const (
+	// LeadershipReasonElection 本节点赢得选举
+	LeadershipReasonElection = "election"
+	// LeadershipReasonTransfer 本节点通过 leadership transfer 赢得选举
+	LeadershipReasonTransfer = "leadership transfer"
+	// LeadershipReasonStandalone 本节点是单节点集群中唯一的节点
+	LeadershipReasonStandalone = "standalone"
+	// LeadershipReasonObserved 从 Leader 的 AppendEntries 得知新的 Leader
+	LeadershipReasonObserved = "observed"
+	// LeadershipReasonSteppedDown 本节点不再是 Leader
+	LeadershipReasonSteppedDown = "stepped down"
+)
+
+// maxLeadershipHistory 最多保留的 leadership 变化记录数
+const maxLeadershipHistory = 128
+
+// LeadershipRecord 本节点观察到的一次 leadership 变化
+type LeadershipRecord struct {
+	Term uint64
+	// LeaderId 为空表示本节点不再是 Leader, 且还不知道新的 Leader
+	LeaderId RaftId
+	// StartIndex Leader 当选时的 lastLogIndex+1, 由其他节点观察到时为 0 (未知)
+	StartIndex uint64
+	Reason     string
+	Time       time.Time
+}
+
+func newLeadershipHistory(store Store) (*leadershipHistory, error) {
+	h := &leadershipHistory{
+		key:   []byte("raft.leadership.history"),
+		store: store,
+	}
+	b, err := store.Get(h.key)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > 0 {
+		err = json.Unmarshal(b, &h.records)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// leadershipHistory 持久化的 leadership 变化记录, 只保留最近的记录
+type leadershipHistory struct {
+	mux     sync.Mutex
+	key     []byte
+	store   Store
+	records []LeadershipRecord
+}
+
+// record 追加一条记录, 与最近一条记录的 term 与 Leader 相同时忽略
+func (h *leadershipHistory) record(record LeadershipRecord) (recorded bool, err error) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	if n := len(h.records); n > 0 {
+		last := h.records[n-1]
+		if last.Term == record.Term && last.LeaderId == record.LeaderId {
+			return false, nil
+		}
+	}
+	h.records = append(h.records, record)
+	if len(h.records) > maxLeadershipHistory {
+		h.records = append([]LeadershipRecord(nil), h.records[len(h.records)-maxLeadershipHistory:]...)
+	}
+	b, err := json.Marshal(h.records)
+	if err != nil {
+		return true, err
+	}
+	return true, h.store.Set(h.key, b)
+}
+
+func (h *leadershipHistory) list() []LeadershipRecord {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	return append([]LeadershipRecord(nil), h.records...)
+}
+
+// LeadershipHistory 获取本节点观察到的 leadership 变化记录, 按时间排序
+func (r *raft) LeadershipHistory() []LeadershipRecord {
+	return r.history.list()
+}
+
+// recordLeadership 记录 leadership 变化
+func (r *raft) recordLeadership(term uint64, leaderId RaftId, startIndex uint64, reason string) {
+	r.notifyLeadership(term, leaderId, startIndex)
+	if leaderId != "" {
+		// the election is settled
+		r.campaign.reset()
+	}
+	recorded, err := r.history.record(LeadershipRecord{
+		Term:       term,
+		LeaderId:   leaderId,
+		StartIndex: startIndex,
+		Reason:     reason,
+		Time:       time.Now(),
+	})
+	if err != nil {
+		r.log(LogElection).Error("Record leadership change", "err", err)
+		return
+	}
+	if recorded {
+		r.log(LogElection).Info("Leadership changed", "leader", leaderId, "leaderTerm", term, "reason", reason)
+	}
+}
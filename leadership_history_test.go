@@ -0,0 +1,58 @@
+package raft
+
+import "testing"
+
+func TestLeadershipHistory(t *testing.T) {
+	store := &memoryStore{}
+	history, err := newLeadershipHistory(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := []LeadershipRecord{
+		{Term: 1, LeaderId: "1", StartIndex: 1, Reason: LeadershipReasonElection},
+		{Term: 1, LeaderId: "1", Reason: LeadershipReasonObserved},
+		{Term: 1, LeaderId: "", Reason: LeadershipReasonSteppedDown},
+		{Term: 2, LeaderId: "2", Reason: LeadershipReasonObserved},
+	}
+	for _, record := range records {
+		_, err = history.record(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("dedupe", func(t *testing.T) {
+		got := history.list()
+		if len(got) != 3 {
+			t.Fatalf("expect 3 records but got %+v", got)
+		}
+		if got[0].Reason != LeadershipReasonElection || got[2].LeaderId != "2" {
+			t.Errorf("expect records in order but got %+v", got)
+		}
+	})
+	t.Run("persisted", func(t *testing.T) {
+		reloaded, err := newLeadershipHistory(store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := reloaded.list(); len(got) != 3 || got[2].Term != 2 {
+			t.Errorf("expect persisted records but got %+v", got)
+		}
+	})
+	t.Run("bounded", func(t *testing.T) {
+		for term := uint64(3); term < maxLeadershipHistory+10; term++ {
+			_, err = history.record(LeadershipRecord{Term: term, LeaderId: "1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		got := history.list()
+		if len(got) != maxLeadershipHistory {
+			t.Fatalf("expect %d records but got %d", maxLeadershipHistory, len(got))
+		}
+		if last := got[len(got)-1]; last.Term != maxLeadershipHistory+9 {
+			t.Errorf("expect latest record kept but got %+v", last)
+		}
+	})
+}
@@ -0,0 +1,192 @@
+package raft
+
+import (
+	"sync"
+	"time"
+)
+
+// LearnerProgress learner 追赶 leader 日志的进度估计
+type LearnerProgress struct {
+	Peer RaftPeer
+	// MatchIndex index of highest log entry known to be replicated on learner
+	MatchIndex uint64
+	// RemainingEntries 尚未复制到 learner 的 log entry 数量
+	RemainingEntries uint64
+	// RemainingBytes 依据最近复制的平均 entry 大小估计的剩余字节数
+	RemainingBytes uint64
+	// Throughput 最近的复制速率 (entries/s)
+	Throughput float64
+	// ETA 预计追上 leader 所需的时间
+	ETA time.Duration
+	// Rounds 已完成的复制轮数
+	Rounds int
+}
+
+// learnerTracker 记录 learner(正在追赶 leader 的非投票成员) 的复制速率
+type learnerTracker struct {
+	mux      sync.Mutex
+	learners map[RaftId]*learnerStats
+}
+
+// learnerStats
+type learnerStats struct {
+	peer RaftPeer
+	// entriesPerSec 复制速率的指数加权平均值
+	entriesPerSec float64
+	// bytesPerEntry entry 平均大小的指数加权平均值
+	bytesPerEntry float64
+	// rounds 完成的复制轮数
+	rounds int
+	// lastSuccess 最后一轮复制是否成功
+	lastSuccess bool
+	// lastElapsed 最后一轮复制的耗时
+	lastElapsed time.Duration
+}
+
+// learnerRateWeight 最新样本在指数加权平均中所占权重
+const learnerRateWeight = 0.3
+
+func (t *learnerTracker) add(peer RaftPeer) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if t.learners == nil {
+		t.learners = make(map[RaftId]*learnerStats)
+	}
+	if _, ok := t.learners[peer.Id]; ok {
+		return
+	}
+	t.learners[peer.Id] = &learnerStats{peer: peer}
+}
+
+func (t *learnerTracker) remove(id RaftId) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	delete(t.learners, id)
+}
+
+// peers 所有 learner
+func (t *learnerTracker) peers() []RaftPeer {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	peers := make([]RaftPeer, 0, len(t.learners))
+	for _, stats := range t.learners {
+		peers = append(peers, stats.peer)
+	}
+	return peers
+}
+
+// record 记录一轮复制的结果
+func (t *learnerTracker) record(id RaftId, entries []LogEntry, elapsed time.Duration, success bool) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	stats, ok := t.learners[id]
+	if !ok {
+		return
+	}
+
+	stats.rounds++
+	stats.lastSuccess = success
+	stats.lastElapsed = elapsed
+	if !success || len(entries) == 0 || elapsed <= 0 {
+		return
+	}
+
+	var size int
+	for i := range entries {
+		size += len(entries[i].Command)
+	}
+	rate := float64(len(entries)) / elapsed.Seconds()
+	avg := float64(size) / float64(len(entries))
+	if stats.entriesPerSec == 0 {
+		stats.entriesPerSec, stats.bytesPerEntry = rate, avg
+		return
+	}
+	stats.entriesPerSec = learnerRateWeight*rate + (1-learnerRateWeight)*stats.entriesPerSec
+	stats.bytesPerEntry = learnerRateWeight*avg + (1-learnerRateWeight)*stats.bytesPerEntry
+}
+
+// progress 根据 leader 的 lastLogIndex 与 learner 的 matchIndex 估计追赶进度
+func (t *learnerTracker) progress(id RaftId, lastLogIndex, matchIndex uint64) (LearnerProgress, bool) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	stats, ok := t.learners[id]
+	if !ok {
+		return LearnerProgress{}, false
+	}
+
+	progress := LearnerProgress{
+		Peer:       stats.peer,
+		MatchIndex: matchIndex,
+		Throughput: stats.entriesPerSec,
+		Rounds:     stats.rounds,
+	}
+	if lastLogIndex > matchIndex {
+		progress.RemainingEntries = lastLogIndex - matchIndex
+	}
+	progress.RemainingBytes = uint64(float64(progress.RemainingEntries) * stats.bytesPerEntry)
+	if progress.RemainingEntries > 0 && stats.entriesPerSec > 0 {
+		seconds := float64(progress.RemainingEntries) / stats.entriesPerSec
+		progress.ETA = time.Duration(seconds * float64(time.Second))
+	}
+	return progress, true
+}
+
+// promotable learner 最后一轮复制成功,
+// 且剩余的 log entry 能在 within 时间内复制完成
+//
+// 尚无复制速率样本时, 退化为论文中的判断: 最后一轮复制耗时少于 within
+func (t *learnerTracker) promotable(progress LearnerProgress, within time.Duration) bool {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	stats, ok := t.learners[progress.Peer.Id]
+	if !ok || !stats.lastSuccess {
+		return false
+	}
+
+	if progress.RemainingEntries == 0 {
+		return true
+	}
+	if progress.Throughput == 0 {
+		return stats.lastElapsed < within
+	}
+	return progress.ETA < within
+}
+
+// LearnerProgress 获取 learner 追赶 leader 日志的进度估计
+// 只有 Leader 才追踪 learner 的进度
+func (r *raft) LearnerProgress(id RaftId) (LearnerProgress, bool) {
+	l, ok := r.GetServer().(*leader)
+	if !ok {
+		return LearnerProgress{}, false
+	}
+	return l.learnerProgress(id)
+}
+
+// IsPromotable learner 是否已足够接近 leader, 可以提升为投票成员
+//
+// If the remaining log entries can be replicated within an election timeout,
+// adding the learner to the cluster won't create a significant availability gap.
+func (r *raft) IsPromotable(id RaftId) bool {
+	l, ok := r.GetServer().(*leader)
+	if !ok {
+		return false
+	}
+	return l.isPromotable(id)
+}
+
+func (l *leader) learnerProgress(id RaftId) (LearnerProgress, bool) {
+	lastLogIndex, _, err := l.Last()
+	if err != nil {
+		return LearnerProgress{}, false
+	}
+	matchIndex, _ := l.matchIndex.Load(id)
+	return l.learners.progress(id, lastLogIndex, matchIndex)
+}
+
+func (l *leader) isPromotable(id RaftId) bool {
+	progress, ok := l.learnerProgress(id)
+	if !ok {
+		return false
+	}
+	return l.learners.promotable(progress, l.electionTimeout[0])
+}
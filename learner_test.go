@@ -0,0 +1,60 @@
+package raft
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLearnerTracker(t *testing.T) {
+	peer := RaftPeer{Id: "learner", Addr: ":5080"}
+	entries := make([]LogEntry, 100)
+	for i := range entries {
+		entries[i].Command = make(Command, 10)
+	}
+
+	t.Run("untracked peer", func(t *testing.T) {
+		var tracker learnerTracker
+		if _, ok := tracker.progress(peer.Id, 100, 0); ok {
+			t.Errorf("expect no progress for untracked peer")
+		}
+	})
+	t.Run("estimate", func(t *testing.T) {
+		var tracker learnerTracker
+		tracker.add(peer)
+		tracker.record(peer.Id, entries, time.Second, true)
+
+		progress, ok := tracker.progress(peer.Id, 300, 100)
+		if !ok {
+			t.Fatal("expect progress of tracked learner")
+		}
+		if progress.RemainingEntries != 200 {
+			t.Errorf("expect remaining entries %d but got %d", 200, progress.RemainingEntries)
+		}
+		if progress.RemainingBytes != 2000 {
+			t.Errorf("expect remaining bytes %d but got %d", 2000, progress.RemainingBytes)
+		}
+		if progress.ETA != 2*time.Second {
+			t.Errorf("expect eta %s but got %s", 2*time.Second, progress.ETA)
+		}
+		if tracker.promotable(progress, time.Second) {
+			t.Errorf("expect not promotable")
+		}
+		if !tracker.promotable(progress, 3*time.Second) {
+			t.Errorf("expect promotable")
+		}
+	})
+	t.Run("caught up", func(t *testing.T) {
+		var tracker learnerTracker
+		tracker.add(peer)
+		tracker.record(peer.Id, nil, time.Millisecond, true)
+		progress, _ := tracker.progress(peer.Id, 100, 100)
+		if !tracker.promotable(progress, time.Millisecond) {
+			t.Errorf("expect caught up learner promotable")
+		}
+
+		tracker.record(peer.Id, nil, time.Millisecond, false)
+		if tracker.promotable(progress, time.Millisecond) {
+			t.Errorf("expect learner failed last round not promotable")
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrLeaseNotConfigured = errors.New("err: leader lease isn't configured")
+	ErrLeaseExpired       = errors.New("err: leader lease expired, fall back to ReadIndex")
+)
+
+// LeaseRead 在 Leader 租约有效期内直接读取状态机, 状态机应用到 commitIndex 之后调用 fn
+//
+// 与 ReadIndex 不同, 不需要一轮心跳确认 leadership, 而是依赖时钟: 多数节点在
+// 最近一个租约期内响应过心跳, 它们在最小选举超时内不会投票给其他 candidate,
+// 因此不会选出新的 Leader. 时钟漂移超过 WithLeaderLease 配置的上限时读取可能
+// 不是线性一致的. 租约过期时返回 ErrLeaseExpired, 调用方可改用 LinearizableRead.
+func (r *raft) LeaseRead(ctx context.Context, fn func() error) error {
+	if r.leaseDrift < 0 {
+		return ErrLeaseNotConfigured
+	}
+	if r.catchingUp() {
+		return ErrCatchingUp
+	}
+	l, ok := r.GetServer().(*leader)
+	if !ok {
+		return r.notLeader()
+	}
+	err := l.waitTermCommitted(ctx)
+	if err != nil {
+		return err
+	}
+	index, err := l.leaseReadIndex()
+	if err != nil {
+		return err
+	}
+	err = r.waitApplied(ctx, index)
+	if err != nil {
+		return err
+	}
+	return fn()
+}
+
+// leaseReadIndex 租约有效时以 commitIndex 作为 read index
+func (l *leader) leaseReadIndex() (uint64, error) {
+	// TimeoutNow lets the target campaign regardless of the lease
+	if l.proposalsPaused() {
+		return 0, ErrLeadershipTransferInProgress
+	}
+	// responses of a newer leader may arrive before the leader steps down
+	if term, stale := l.staleTerm(); stale {
+		return 0, l.staleLeaderError(term)
+	}
+	commitIndex := l.GetCommitIndex()
+	term, err := l.Get(commitIndex)
+	if err != nil {
+		return 0, err
+	}
+	if term != l.GetCurrentTerm() {
+		return 0, ErrReadIndexNotReady
+	}
+	if !l.leaseValid(l.now()) {
+		return 0, ErrLeaseExpired
+	}
+	return commitIndex, nil
+}
+
+// leaseValid 多数节点是否在 now 之前的一个租约期内响应过 RPC
+//
+// 租约期为最小选举超时减去时钟漂移上限, 从发出 RPC 的时间开始计算.
+func (l *leader) leaseValid(now time.Time) bool {
+	config := l.configs.GetConfig()
+	if config.IsStandalone(l.Id()) {
+		return true
+	}
+	lease := l.electionTimeout[0] - l.leaseDrift
+	decider := config.NewDecider()
+	for _, peer := range config.GetPeers() {
+		if peer.Id == l.Id() {
+			decider.AddVote(peer.Id)
+			continue
+		}
+		sentAt, ok := l.contact.acked(peer.Id)
+		if ok && now.Sub(sentAt) < lease {
+			decider.AddVote(peer.Id)
+		}
+	}
+	return decider.HasAchievedMajority()
+}
@@ -0,0 +1,108 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLeaseRead(t *testing.T) {
+	ctx := context.Background()
+	read := func(r Raft, fsm *listFSM) (got []string, err error) {
+		err = r.LeaseRead(ctx, func() error {
+			got = fsm.get()
+			return nil
+		})
+		return got, err
+	}
+
+	t.Run("not configured", func(t *testing.T) {
+		r, err := New("lease-none", "lease-none", nil, nil, nil, WithDevMode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = read(r, &listFSM{})
+		if !errors.Is(err, ErrLeaseNotConfigured) {
+			t.Errorf("expect %v but got %v", ErrLeaseNotConfigured, err)
+		}
+	})
+
+	t.Run("lease expires without quorum", func(t *testing.T) {
+		fsm := &listFSM{}
+		r, err := New("lease-leader", "lease-leader", fsm.apply, nil, nil, WithDevMode(), WithLeaderLease(10*time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Stop()
+		go r.Run()
+
+		follower := runLoopbackFollower(t, "lease-follower")
+		err = r.AddVoter(ctx, follower.Id(), follower.Addr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = r.Handle(ctx, Command("a"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := read(r, fsm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expect := []string{"a"}; !reflect.DeepEqual(got, expect) {
+			t.Errorf("expect %v but got %v", expect, got)
+		}
+
+		// the lease expires before the leader steps down
+		follower.Stop()
+		deadline := time.Now().Add(time.Second)
+		for err == nil && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+			_, err = read(r, fsm)
+		}
+		if !errors.Is(err, ErrLeaseExpired) {
+			t.Errorf("expect %v but got %v", ErrLeaseExpired, err)
+		}
+	})
+
+	t.Run("higher term response", func(t *testing.T) {
+		r, err := New("lease-deposed", "lease-deposed", nil, &memoryStore{}, &memoryLog{},
+			WithRPC(higherTermRPC{RPC: newLoopbackRPC()}), WithLeaderLease(time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		raft := r.(*raft)
+		l := &leader{raft: raft, contact: contactTracker{since: raft.now()}}
+		for _, call := range []func() (AppendEntriesResults, error){
+			func() (AppendEntriesResults, error) {
+				return l.heartbeat("lease-peer", "lease-peer", nil, 0, 0)
+			},
+			func() (AppendEntriesResults, error) {
+				return l.callAppendEntries("lease-peer", "lease-peer", AppendEntriesArgs{Term: raft.GetCurrentTerm()})
+			},
+		} {
+			_, err = call()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := l.contact.acked("lease-peer"); ok {
+				t.Fatal("expect response of a higher term not extending the lease")
+			}
+		}
+		_, err = l.leaseReadIndex()
+		if !errors.Is(err, ErrIsNotLeader) {
+			t.Errorf("expect %v but got %v", ErrIsNotLeader, err)
+		}
+	})
+}
+
+// higherTermRPC peer 均已进入更高的 term
+type higherTermRPC struct {
+	RPC
+}
+
+func (higherTermRPC) CallAppendEntries(addr RaftAddr, args AppendEntriesArgs) (AppendEntriesResults, error) {
+	return AppendEntriesResults{Term: args.Term + 1}, nil
+}
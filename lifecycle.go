@@ -0,0 +1,93 @@
+package raft
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// LifecycleState raft 一致性模型的生命周期状态, 见 Raft.State
+//
+//	Created --Run--> Starting ----> Running --Stop--> Stopping --Run 返回--> Stopped
+//	Created --Stop--> Stopped
+type LifecycleState int32
+
+const (
+	// LifecycleCreated New 之后, 尚未 Run
+	LifecycleCreated LifecycleState = iota
+	// LifecycleStarting Run 正在启动 rpc 与后台任务
+	LifecycleStarting
+	// LifecycleRunning 正在运行
+	LifecycleRunning
+	// LifecycleStopping 已调用 Stop, 等待 Run 返回
+	LifecycleStopping
+	// LifecycleStopped 已停止, 不能再次 Run, 重启需以相同的 Store 与 Log 重新 New
+	LifecycleStopped
+)
+
+func (s LifecycleState) String() string {
+	switch s {
+	case LifecycleCreated:
+		return "Created"
+	case LifecycleStarting:
+		return "Starting"
+	case LifecycleRunning:
+		return "Running"
+	case LifecycleStopping:
+		return "Stopping"
+	case LifecycleStopped:
+		return "Stopped"
+	default:
+		return "Unknown LifecycleState"
+	}
+}
+
+// lifecycle 串行化 Run 的启动阶段与 Stop
+//
+// 启动期间持有 mux, 此时调用的 Stop 等到启动完成, 状态一致之后才停止.
+type lifecycle struct {
+	mux   sync.Mutex
+	state int32
+}
+
+func (l *lifecycle) get() LifecycleState {
+	return LifecycleState(atomic.LoadInt32(&l.state))
+}
+
+func (l *lifecycle) set(state LifecycleState) {
+	atomic.StoreInt32(&l.state, int32(state))
+}
+
+// State 获取生命周期状态
+func (r *raft) State() LifecycleState {
+	return r.lifecycle.get()
+}
+
+// beginRun 开始启动, 返回时持有 lifecycle.mux, 启动完成后调用 endStartup 释放
+// 已在运行时返回 ErrAlreadyRunning, 已停止时返回 ErrStopped
+func (r *raft) beginRun() error {
+	r.lifecycle.mux.Lock()
+	switch r.lifecycle.get() {
+	case LifecycleCreated:
+		r.lifecycle.set(LifecycleStarting)
+		return nil
+	case LifecycleStarting, LifecycleRunning:
+		r.lifecycle.mux.Unlock()
+		return ErrAlreadyRunning
+	default:
+		r.lifecycle.mux.Unlock()
+		return ErrStopped
+	}
+}
+
+// endStartup 启动完成
+func (r *raft) endStartup() {
+	r.lifecycle.set(LifecycleRunning)
+	r.lifecycle.mux.Unlock()
+}
+
+// endRun Run 返回时调用, 因错误返回时同样停止本节点
+func (r *raft) endRun() {
+	r.Stop()
+	r.lifecycle.set(LifecycleStopped)
+	r.log(LogGeneral).Info("Raft consensus module stopped")
+}
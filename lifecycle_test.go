@@ -0,0 +1,133 @@
+package raft
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingLog 追加 no-op log entry 时通知 appending, 并等待 release 关闭
+type blockingLog struct {
+	memoryLog
+	appending chan struct{}
+	release   chan struct{}
+}
+
+func (l *blockingLog) AppendEntry(entry LogEntry) (uint64, error) {
+	if entry.Type != logEntryTypeNoop {
+		return l.memoryLog.AppendEntry(entry)
+	}
+	select {
+	case l.appending <- struct{}{}:
+	default:
+	}
+	<-l.release
+	return l.memoryLog.AppendEntry(entry)
+}
+
+func TestLifecycle(t *testing.T) {
+	// waitState 等待 r 进入 state
+	waitState := func(t *testing.T, r Raft, state LifecycleState) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for r.State() != state {
+			if time.Now().After(deadline) {
+				t.Fatalf("expect %s but got %s", state, r.State())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	t.Run("run repeatedly", func(t *testing.T) {
+		r, err := New("lifecycle-run", "lifecycle-run", nil, nil, nil, WithDevMode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state := r.State(); state != LifecycleCreated {
+			t.Fatalf("expect %s but got %s", LifecycleCreated, state)
+		}
+		ran := make(chan error, 1)
+		go func() {
+			ran <- r.Run()
+		}()
+		waitState(t, r, LifecycleRunning)
+		if err := r.Run(); !errors.Is(err, ErrAlreadyRunning) {
+			t.Fatalf("expect %v but got %v", ErrAlreadyRunning, err)
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.Stop()
+			}()
+		}
+		wg.Wait()
+		if err := <-ran; err != nil {
+			t.Fatal(err)
+		}
+		if state := r.State(); state != LifecycleStopped {
+			t.Fatalf("expect %s but got %s", LifecycleStopped, state)
+		}
+		if err := r.Run(); !errors.Is(err, ErrStopped) {
+			t.Fatalf("expect %v but got %v", ErrStopped, err)
+		}
+	})
+
+	t.Run("stop before run", func(t *testing.T) {
+		r, err := New("lifecycle-stop", "lifecycle-stop", nil, nil, nil, WithDevMode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Stop()
+		if state := r.State(); state != LifecycleStopped {
+			t.Fatalf("expect %s but got %s", LifecycleStopped, state)
+		}
+		if err := r.Run(); !errors.Is(err, ErrStopped) {
+			t.Fatalf("expect %v but got %v", ErrStopped, err)
+		}
+	})
+
+	t.Run("stop during startup", func(t *testing.T) {
+		log := &blockingLog{appending: make(chan struct{}, 1), release: make(chan struct{})}
+		r, err := New("lifecycle-startup", "lifecycle-startup", nil, nil, log,
+			WithDevMode(), WithStorageBenchmark(1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ran := make(chan error, 1)
+		go func() {
+			ran <- r.Run()
+		}()
+		<-log.appending
+		if state := r.State(); state != LifecycleStarting {
+			t.Fatalf("expect %s but got %s", LifecycleStarting, state)
+		}
+
+		stopped := make(chan struct{})
+		go func() {
+			r.Stop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+			t.Fatal("expect Stop waiting for startup")
+		case <-time.After(20 * time.Millisecond):
+		}
+		close(log.release)
+		<-stopped
+		if err := <-ran; err != nil {
+			t.Fatal(err)
+		}
+		// the leader may have appended a no-op in its term since
+		last, _, _ := log.Last()
+		entries, _ := log.RangeGet(1, last)
+		for _, entry := range entries {
+			if entry.Type == logEntryTypeNoop && entry.Term == 0 {
+				t.Fatalf("expect benchmark entries truncated but got %+v", entries)
+			}
+		}
+	})
+}
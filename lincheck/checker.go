@@ -0,0 +1,248 @@
+// Package lincheck 线性一致性检查, 以及在故障注入下验证 raft 集群的测试工具
+//
+// Check 以 Wing & Gong 的回溯算法(带有 Lowe 的状态缓存, 与 porcupine 相同)
+// 判断客户端记录的 history 是否存在符合 Model 顺序规约的线性化.
+// RunKV 在 transport/inmem 的集群上运行键值状态机, 由多个客户端并发读写,
+// 同时注入网络分区、丢包与节点重启, 最后检查记录的 history.
+package lincheck
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// CheckResult 检查结果
+type CheckResult int
+
+const (
+	// Linearizable history 可以线性化
+	Linearizable CheckResult = iota
+	// NotLinearizable history 不可线性化
+	NotLinearizable
+	// Unknown 超时前没有得出结论
+	Unknown
+)
+
+func (r CheckResult) String() string {
+	switch r {
+	case Linearizable:
+		return "Linearizable"
+	case NotLinearizable:
+		return "NotLinearizable"
+	case Unknown:
+		return "Unknown"
+	default:
+		return "Unknown CheckResult"
+	}
+}
+
+// Operation 客户端的一次操作
+type Operation struct {
+	ClientId int
+	Input    interface{}
+	Output   interface{}
+	// Call, Return 调用与返回的时间
+	// 结果未知的操作(如超时的写入)可能在调用之后的任意时刻生效, Return 使用 Pending
+	Call, Return time.Time
+}
+
+// Pending 结果未知的操作的 Return
+var Pending = time.Unix(0, math.MaxInt64)
+
+// Model 对象的顺序规约
+type Model struct {
+	// Partition 将 history 拆分为互不影响的子 history 分别检查, 如按 key 拆分, nil 时不拆分
+	Partition func(history []Operation) [][]Operation
+	// Init 初始状态
+	Init func() interface{}
+	// Step 在 state 上执行 input 得到 output 是否合法, 合法时返回执行后的状态
+	Step func(state, input, output interface{}) (bool, interface{})
+	// Equal 状态是否相同, nil 时使用 ==, 此时状态须可比较
+	Equal func(a, b interface{}) bool
+}
+
+func (m Model) equal(a, b interface{}) bool {
+	if m.Equal != nil {
+		return m.Equal(a, b)
+	}
+	return a == b
+}
+
+// Check history 是否可以线性化
+func Check(model Model, history []Operation) bool {
+	return CheckTimeout(model, history, 0) == Linearizable
+}
+
+// CheckTimeout history 是否可以线性化, timeout 为 0 时不限时
+func CheckTimeout(model Model, history []Operation, timeout time.Duration) CheckResult {
+	partitions := [][]Operation{history}
+	if model.Partition != nil {
+		partitions = model.Partition(history)
+	}
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	result := Linearizable
+	for _, partition := range partitions {
+		switch checkSingle(model, partition, deadline) {
+		case NotLinearizable:
+			return NotLinearizable
+		case Unknown:
+			result = Unknown
+		}
+	}
+	return result
+}
+
+// entry 按时间排序的调用或返回, 组成双向链表
+type entry struct {
+	call   bool
+	id     int
+	time   time.Time
+	input  interface{}
+	output interface{}
+	// match 调用对应的返回
+	match      *entry
+	prev, next *entry
+}
+
+// makeEntries 按时间排序所有调用与返回, 返回链表头(哨兵)
+// 同时发生的调用排在返回之前, 视为并发
+func makeEntries(history []Operation) *entry {
+	entries := make([]*entry, 0, 2*len(history))
+	for i, op := range history {
+		ret := &entry{id: i, time: op.Return, output: op.Output}
+		call := &entry{call: true, id: i, time: op.Call, input: op.Input, match: ret}
+		entries = append(entries, call, ret)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].time.Equal(entries[j].time) {
+			return entries[i].time.Before(entries[j].time)
+		}
+		return entries[i].call && !entries[j].call
+	})
+	head := &entry{}
+	prev := head
+	for _, e := range entries {
+		prev.next, e.prev = e, prev
+		prev = e
+	}
+	return head
+}
+
+// lift 从链表中移除调用及其返回
+func lift(e *entry) {
+	e.prev.next = e.next
+	if e.next != nil {
+		e.next.prev = e.prev
+	}
+	m := e.match
+	m.prev.next = m.next
+	if m.next != nil {
+		m.next.prev = m.prev
+	}
+}
+
+// unlift 将 lift 移除的调用及其返回放回原处
+func unlift(e *entry) {
+	m := e.match
+	m.prev.next = m
+	if m.next != nil {
+		m.next.prev = m
+	}
+	e.prev.next = e
+	if e.next != nil {
+		e.next.prev = e
+	}
+}
+
+// bitset 已线性化的操作
+type bitset []uint64
+
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+func (b bitset) set(i int) bitset {
+	b[i/64] |= 1 << (uint(i) % 64)
+	return b
+}
+
+func (b bitset) clear(i int) bitset {
+	b[i/64] &^= 1 << (uint(i) % 64)
+	return b
+}
+
+func (b bitset) clone() bitset {
+	return append(bitset(nil), b...)
+}
+
+func (b bitset) key() string {
+	buf := make([]byte, 0, 8*len(b))
+	for _, word := range b {
+		for i := 0; i < 8; i++ {
+			buf = append(buf, byte(word>>(8*i)))
+		}
+	}
+	return string(buf)
+}
+
+// checkSingle 以回溯搜索 history 的线性化
+//
+// 依次尝试将链表中最早的调用之一线性化; 遇到返回说明其调用无法在此之前线性化, 回溯.
+// 已线性化的操作集合与状态相同的搜索分支只需尝试一次.
+func checkSingle(model Model, history []Operation, deadline time.Time) CheckResult {
+	type call struct {
+		entry *entry
+		state interface{}
+	}
+	head := makeEntries(history)
+	linearized := newBitset(len(history))
+	cache := make(map[string][]interface{})
+	cached := func(b bitset, state interface{}) bool {
+		for _, s := range cache[b.key()] {
+			if model.equal(s, state) {
+				return true
+			}
+		}
+		return false
+	}
+
+	state := model.Init()
+	var calls []call
+	e := head.next
+	for steps := 0; head.next != nil; steps++ {
+		if !deadline.IsZero() && steps%1024 == 0 && time.Now().After(deadline) {
+			return Unknown
+		}
+		if e.call {
+			ok, next := model.Step(state, e.input, e.match.output)
+			if ok {
+				b := linearized.clone().set(e.id)
+				if !cached(b, next) {
+					cache[b.key()] = append(cache[b.key()], next)
+					calls = append(calls, call{e, state})
+					state = next
+					linearized.set(e.id)
+					lift(e)
+					e = head.next
+					continue
+				}
+			}
+			e = e.next
+			continue
+		}
+		if len(calls) == 0 {
+			return NotLinearizable
+		}
+		top := calls[len(calls)-1]
+		calls = calls[:len(calls)-1]
+		state = top.state
+		linearized.clear(top.entry.id)
+		unlift(top.entry)
+		e = top.entry.next
+	}
+	return Linearizable
+}
@@ -0,0 +1,99 @@
+package lincheck
+
+import (
+	"testing"
+	"time"
+)
+
+// at 以毫秒表示的时间
+func at(ms int) time.Time {
+	return time.Unix(0, 0).Add(time.Duration(ms) * time.Millisecond)
+}
+
+func put(client int, key, value string, call, ret int) Operation {
+	return Operation{ClientId: client, Input: KvInput{Op: KvPut, Key: key, Value: value}, Output: KvOutput{}, Call: at(call), Return: at(ret)}
+}
+
+func get(client int, key, value string, call, ret int) Operation {
+	return Operation{ClientId: client, Input: KvInput{Op: KvGet, Key: key}, Output: KvOutput{Value: value}, Call: at(call), Return: at(ret)}
+}
+
+func TestCheck(t *testing.T) {
+	cases := []struct {
+		name    string
+		history []Operation
+		expect  bool
+	}{
+		{
+			name:    "sequential",
+			history: []Operation{put(0, "x", "1", 0, 10), get(1, "x", "1", 20, 30)},
+			expect:  true,
+		},
+		{
+			name:    "stale read",
+			history: []Operation{put(0, "x", "1", 0, 10), put(0, "x", "2", 20, 30), get(1, "x", "1", 40, 50)},
+			expect:  false,
+		},
+		{
+			name: "read reverts an observed write",
+			history: []Operation{
+				put(0, "x", "1", 0, 100),
+				get(1, "x", "1", 10, 20),
+				get(2, "x", "", 30, 40),
+			},
+			expect: false,
+		},
+		{
+			name: "concurrent write",
+			history: []Operation{
+				put(0, "x", "1", 0, 100),
+				get(1, "x", "", 10, 20),
+				get(2, "x", "1", 30, 40),
+			},
+			expect: true,
+		},
+		{
+			name: "pending write may take effect",
+			history: []Operation{
+				{ClientId: 0, Input: KvInput{Op: KvPut, Key: "x", Value: "1"}, Call: at(0), Return: Pending},
+				get(1, "x", "", 10, 20),
+				get(1, "x", "1", 30, 40),
+			},
+			expect: true,
+		},
+		{
+			name: "pending write may never take effect",
+			history: []Operation{
+				{ClientId: 0, Input: KvInput{Op: KvPut, Key: "x", Value: "1"}, Call: at(0), Return: Pending},
+				get(1, "x", "", 10, 20),
+			},
+			expect: true,
+		},
+		{
+			name: "independent keys",
+			history: []Operation{
+				put(0, "x", "1", 0, 10),
+				put(1, "y", "2", 0, 10),
+				get(2, "x", "1", 20, 30),
+				get(2, "y", "", 40, 50),
+			},
+			expect: false,
+		},
+		{
+			name: "append",
+			history: []Operation{
+				{ClientId: 0, Input: KvInput{Op: KvAppend, Key: "x", Value: "a"}, Output: KvOutput{}, Call: at(0), Return: at(50)},
+				{ClientId: 1, Input: KvInput{Op: KvAppend, Key: "x", Value: "b"}, Output: KvOutput{}, Call: at(0), Return: at(50)},
+				get(2, "x", "ba", 60, 70),
+			},
+			expect: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := Check(KvModel, c.history); got != c.expect {
+				t.Errorf("expect linearizable %t but got %t", c.expect, got)
+			}
+		})
+	}
+}
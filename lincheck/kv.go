@@ -0,0 +1,388 @@
+package lincheck
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/mind1949/raft"
+	"github.com/mind1949/raft/transport/inmem"
+)
+
+var (
+	ErrNotLinearizable = errors.New("err: history is not linearizable")
+	ErrCheckTimeout    = errors.New("err: linearizability check timed out")
+)
+
+// KvOp 键值操作类型
+type KvOp uint8
+
+const (
+	KvGet KvOp = iota
+	KvPut
+	KvAppend
+)
+
+func (op KvOp) String() string {
+	switch op {
+	case KvGet:
+		return "Get"
+	case KvPut:
+		return "Put"
+	case KvAppend:
+		return "Append"
+	default:
+		return "Unknown KvOp"
+	}
+}
+
+// KvInput 键值操作的输入
+type KvInput struct {
+	Op    KvOp
+	Key   string
+	Value string
+}
+
+// KvOutput 键值操作的输出, Get 读到的值
+type KvOutput struct {
+	Value string
+}
+
+// KvModel 键值存储的顺序规约, 按 key 拆分 history
+//
+// 输入为 KvInput, 输出为 KvOutput, 状态为 key 的当前值.
+var KvModel = Model{
+	Partition: func(history []Operation) [][]Operation {
+		keys := make(map[string]int)
+		var partitions [][]Operation
+		for _, op := range history {
+			key := op.Input.(KvInput).Key
+			i, ok := keys[key]
+			if !ok {
+				i = len(partitions)
+				keys[key] = i
+				partitions = append(partitions, nil)
+			}
+			partitions[i] = append(partitions[i], op)
+		}
+		return partitions
+	},
+	Init: func() interface{} {
+		return ""
+	},
+	Step: func(state, input, output interface{}) (bool, interface{}) {
+		value, in := state.(string), input.(KvInput)
+		switch in.Op {
+		case KvGet:
+			out, _ := output.(KvOutput)
+			return out.Value == value, value
+		case KvPut:
+			return true, in.Value
+		case KvAppend:
+			return true, value + in.Value
+		default:
+			return false, value
+		}
+	},
+}
+
+// kvFSM 键值状态机, command 为 JSON 编码的 KvInput, Get 的结果为 KvOutput
+type kvFSM struct {
+	mux  sync.Mutex
+	data map[string]string
+}
+
+func newKvFSM() *kvFSM {
+	return &kvFSM{data: make(map[string]string)}
+}
+
+func (f *kvFSM) apply(commands raft.Commands) (int, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	for i, command := range commands.Data() {
+		var in KvInput
+		err := json.Unmarshal(command, &in)
+		if err != nil {
+			return i, err
+		}
+		switch in.Op {
+		case KvGet:
+			raft.SetResult(commands, i, KvOutput{Value: f.data[in.Key]})
+		case KvPut:
+			f.data[in.Key] = in.Value
+		case KvAppend:
+			f.data[in.Key] += in.Value
+		}
+	}
+	return len(commands.Data()), nil
+}
+
+// OptFn RunKV 的可选项
+type OptFn func(*opts)
+
+// WithNodes 集群的节点数
+func WithNodes(n int) OptFn {
+	return func(o *opts) {
+		o.nodes = n
+	}
+}
+
+// WithClients 并发的客户端数
+func WithClients(n int) OptFn {
+	return func(o *opts) {
+		o.clients = n
+	}
+}
+
+// WithKeys 客户端读写的 key 的数量, key 越少操作之间的冲突越多
+func WithKeys(n int) OptFn {
+	return func(o *opts) {
+		o.keys = n
+	}
+}
+
+// WithDuration 客户端读写的时间
+func WithDuration(d time.Duration) OptFn {
+	return func(o *opts) {
+		o.duration = d
+	}
+}
+
+// WithNemesis 每隔 interval 随机注入一种故障: 隔离 Leader, 随机分区, 丢包, 重启节点, 或恢复正常
+// interval 为 0 时不注入故障
+func WithNemesis(interval time.Duration) OptFn {
+	return func(o *opts) {
+		o.nemesis = interval
+	}
+}
+
+// WithSeed 选择操作与故障的随机数种子
+func WithSeed(seed int64) OptFn {
+	return func(o *opts) {
+		o.seed = seed
+	}
+}
+
+// WithCheckTimeout 检查 history 的时间上限
+func WithCheckTimeout(timeout time.Duration) OptFn {
+	return func(o *opts) {
+		o.checkTimeout = timeout
+	}
+}
+
+// WithRaftOptions 用于所有节点的 raft 可选项
+func WithRaftOptions(optFns ...raft.OptFn) OptFn {
+	return func(o *opts) {
+		o.raftOptFns = append(o.raftOptFns, optFns...)
+	}
+}
+
+type opts struct {
+	nodes        int
+	clients      int
+	keys         int
+	duration     time.Duration
+	nemesis      time.Duration
+	seed         int64
+	checkTimeout time.Duration
+	raftOptFns   []raft.OptFn
+}
+
+// Report RunKV 的结果
+type Report struct {
+	History []Operation
+	Result  CheckResult
+	// Ok 成功的操作数, Failed 结果未知或失败的操作数
+	Ok, Failed int
+	// Faults 注入的故障
+	Faults []string
+}
+
+// RunKV 在 inmem 集群上运行键值状态机, 客户端并发读写的同时注入故障, 然后检查 history 的线性一致性
+//
+// 读写都经过 log, 写入超时等结果未知的操作以 Pending 记录, 失败的读取不记录.
+// history 不可线性化时返回 ErrNotLinearizable, 检查超时返回 ErrCheckTimeout, 均附带 Report.
+func RunKV(ctx context.Context, optFns ...OptFn) (Report, error) {
+	o := &opts{
+		nodes:        3,
+		clients:      4,
+		keys:         3,
+		duration:     3 * time.Second,
+		nemesis:      300 * time.Millisecond,
+		seed:         time.Now().UnixNano(),
+		checkTimeout: time.Minute,
+	}
+	for _, fn := range optFns {
+		fn(o)
+	}
+
+	c, err := inmem.NewCluster(o.nodes, func(raft.RaftId) raft.Apply {
+		return newKvFSM().apply
+	}, o.raftOptFns...)
+	if err != nil {
+		return Report{}, err
+	}
+	c.Start()
+	defer c.Stop()
+
+	ctx, cancel := context.WithTimeout(ctx, o.duration)
+	defer cancel()
+	var (
+		mux    sync.Mutex
+		report Report
+		wg     sync.WaitGroup
+	)
+	record := func(op Operation, ok bool) {
+		mux.Lock()
+		defer mux.Unlock()
+		if ok {
+			report.Ok++
+		} else {
+			report.Failed++
+		}
+		if ok || op.Return.Equal(Pending) {
+			report.History = append(report.History, op)
+		}
+	}
+	for i := 0; i < o.clients; i++ {
+		wg.Add(1)
+		go func(client int) {
+			defer wg.Done()
+			runClient(ctx, c, client, rand.New(rand.NewSource(o.seed+int64(client))), o.keys, record)
+		}(i)
+	}
+	if o.nemesis > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			faults := runNemesis(ctx, c, rand.New(rand.NewSource(o.seed)), o.nemesis)
+			mux.Lock()
+			report.Faults = faults
+			mux.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	report.Result = CheckTimeout(KvModel, pruneUnobserved(report.History), o.checkTimeout)
+	switch report.Result {
+	case NotLinearizable:
+		return report, fmt.Errorf("%w: seed %d", ErrNotLinearizable, o.seed)
+	case Unknown:
+		return report, fmt.Errorf("%w: seed %d", ErrCheckTimeout, o.seed)
+	}
+	return report, nil
+}
+
+// pruneUnobserved 去掉没有被任何 Get 读到的 Pending 写入
+//
+// 写入的值唯一, 没有被读到的 Pending 写入总可以线性化在 history 的末尾, 不影响结论,
+// 而每个 Pending 写入都会使搜索的状态数翻倍.
+func pruneUnobserved(history []Operation) []Operation {
+	observed := make(map[string]bool)
+	for _, op := range history {
+		if in := op.Input.(KvInput); in.Op == KvGet {
+			out, _ := op.Output.(KvOutput)
+			observed[in.Key+"\x00"+out.Value] = true
+		}
+	}
+	pruned := make([]Operation, 0, len(history))
+	for _, op := range history {
+		in := op.Input.(KvInput)
+		if op.Return.Equal(Pending) && in.Op == KvPut && !observed[in.Key+"\x00"+in.Value] {
+			continue
+		}
+		pruned = append(pruned, op)
+	}
+	return pruned
+}
+
+// runClient 依次向 Leader 提交随机的读写, 直到 ctx 结束
+func runClient(ctx context.Context, c *inmem.Cluster, client int, rnd *rand.Rand, keys int, record func(Operation, bool)) {
+	for n := 0; ctx.Err() == nil; n++ {
+		leader, ok := c.Leader()
+		if !ok {
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		// pending appends at unknown points multiply the states to search, so only get and put
+		in := KvInput{Op: KvOp(rnd.Intn(2)), Key: fmt.Sprint("k", rnd.Intn(keys))}
+		if in.Op != KvGet {
+			// unique values identify which write a read observes
+			in.Value = fmt.Sprintf("%d.%d", client, n)
+		}
+		command, err := json.Marshal(in)
+		if err != nil {
+			panic(err)
+		}
+
+		op := Operation{ClientId: client, Input: in, Call: time.Now()}
+		opCtx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		result, err := leader.Raft().Propose(opCtx, raft.Command(command))
+		cancel()
+		op.Return = time.Now()
+		if err != nil {
+			if in.Op != KvGet {
+				// the command may still be committed later
+				op.Return = Pending
+			}
+			record(op, false)
+			continue
+		}
+		if in.Op == KvGet {
+			op.Output = result
+		} else {
+			op.Output = KvOutput{}
+		}
+		record(op, true)
+	}
+}
+
+// runNemesis 每隔 interval 注入一种随机的故障, 结束时恢复正常, 返回注入的故障
+func runNemesis(ctx context.Context, c *inmem.Cluster, rnd *rand.Rand, interval time.Duration) (faults []string) {
+	defer func() {
+		c.Heal()
+		c.Network().SetDropRate(0)
+	}()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	nodes := c.Nodes()
+	for {
+		select {
+		case <-ctx.Done():
+			return faults
+		case <-ticker.C:
+		}
+		switch rnd.Intn(5) {
+		case 0:
+			if leader, ok := c.Leader(); ok {
+				if err := c.Partition([]raft.RaftId{leader.Id}); err == nil {
+					faults = append(faults, "isolate leader "+string(leader.Id))
+				}
+			}
+		case 1:
+			var minority []raft.RaftId
+			for _, i := range rnd.Perm(len(nodes))[:(len(nodes)-1)/2] {
+				minority = append(minority, nodes[i].Id)
+			}
+			if err := c.Partition(minority); err == nil {
+				faults = append(faults, fmt.Sprint("partition ", minority))
+			}
+		case 2:
+			c.Network().SetDropRate(0.1)
+			faults = append(faults, "drop 10% messages")
+		case 3:
+			node := nodes[rnd.Intn(len(nodes))]
+			if err := c.Restart(node.Id); err == nil {
+				faults = append(faults, "restart "+string(node.Id))
+			}
+		default:
+			c.Heal()
+			c.Network().SetDropRate(0)
+			faults = append(faults, "heal")
+		}
+	}
+}
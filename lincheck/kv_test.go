@@ -0,0 +1,51 @@
+package lincheck
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRunKV(t *testing.T) {
+	report, err := RunKV(context.Background(),
+		WithNodes(3),
+		WithClients(4),
+		WithKeys(3),
+		WithDuration(3*time.Second),
+		WithNemesis(200*time.Millisecond),
+		WithSeed(1),
+	)
+	if err != nil {
+		t.Fatalf("%v, faults %v", err, report.Faults)
+	}
+	if report.Ok == 0 {
+		t.Fatal("expect operations succeeded under faults")
+	}
+	if len(report.Faults) == 0 {
+		t.Error("expect faults injected")
+	}
+	t.Logf("%d ok, %d failed, faults %v", report.Ok, report.Failed, report.Faults)
+}
+
+func TestPruneUnobserved(t *testing.T) {
+	now := time.Now()
+	at := func(d int) time.Time { return now.Add(time.Duration(d) * time.Millisecond) }
+	history := []Operation{
+		{ClientId: 0, Input: KvInput{Op: KvPut, Key: "k", Value: "a"}, Output: KvOutput{}, Call: at(0), Return: at(1)},
+		{ClientId: 1, Input: KvInput{Op: KvPut, Key: "k", Value: "b"}, Call: at(2), Return: Pending},
+		{ClientId: 2, Input: KvInput{Op: KvPut, Key: "k", Value: "c"}, Call: at(2), Return: Pending},
+		{ClientId: 0, Input: KvInput{Op: KvGet, Key: "k"}, Output: KvOutput{Value: "b"}, Call: at(3), Return: at(4)},
+	}
+	pruned := pruneUnobserved(history)
+	if len(pruned) != 3 {
+		t.Fatalf("expect 3 operations but got %d", len(pruned))
+	}
+	for _, op := range pruned {
+		if op.Input.(KvInput).Value == "c" {
+			t.Error("expect unobserved pending put pruned")
+		}
+	}
+	if !Check(KvModel, pruned) {
+		t.Error("expect pruned history linearizable")
+	}
+}
@@ -26,6 +26,14 @@ type Log interface {
 	Append(entries ...LogEntry) error
 	// AppendEntry 追加一个 log entry , 并返回索引
 	AppendEntry(entry LogEntry) (index uint64, err error)
+	// FirstIndex 返回第一个保留的 log entry 的索引, 未压缩过的 log 返回 1
+	FirstIndex() (uint64, error)
+	// Compact 丢弃索引不大于 upToIndex 的 log entry, 用于快照之后压缩 log
+	// upToIndex 超出最后一个 log entry 时返回 ErrCompactBeyondLastIndex
+	Compact(upToIndex uint64) error
+	// TruncatePrefix 丢弃索引不大于 index 的 log entry, 之后 Get(index) 返回 term
+	// 若 log 中没有匹配 index 与 term 的 log entry, 丢弃整个 log, 用于安装快照
+	TruncatePrefix(index, term uint64) error
 }
 
 type LogEntryType uint8
@@ -35,6 +43,10 @@ const (
 	logEntryTypeCommand LogEntryType = iota
 	// cluster configuration changes log entry type
 	logEntryTypeConfig
+	// no-op log entry type, committed by leader in its term
+	logEntryTypeNoop
+	// barrier log entry type, applied after all preceding entries
+	logEntryTypeBarrier
 )
 
 // LogEntry raft log entry
@@ -46,14 +58,27 @@ type LogEntry struct {
 	Type       LogEntryType
 	Command    Command
 	AppendTime time.Time
+	// Proposer client proposing the command, see WithProposer
+	Proposer string
+	// Extensions 附加在 log entry 上的扩展字段, 如 ExtensionIdempotencyKey
+	Extensions map[string][]byte
 }
 
 var _ Log = (*memoryLog)(nil)
 
+// NewMemoryLog 创建保存在内存中的 Log, 不持久化, 用于开发模式与测试
+func NewMemoryLog() Log {
+	return &memoryLog{}
+}
+
 // memoryLog just for testing
 type memoryLog struct {
 	mux   sync.Mutex
 	queue []LogEntry
+
+	// prevIndex, prevTerm 第一个保留的 log entry 之前的 log entry(已被快照覆盖)
+	prevIndex uint64
+	prevTerm  uint64
 }
 
 // Get 获取 raft log 中索引为 index 的 log entry term
@@ -62,11 +87,14 @@ func (l *memoryLog) Get(index uint64) (term uint64, err error) {
 	l.mux.Lock()
 	defer l.mux.Unlock()
 
-	if index == 0 {
+	if index == 0 || index < l.prevIndex {
 		return 0, nil
 	}
+	if index == l.prevIndex {
+		return l.prevTerm, nil
+	}
 
-	index--
+	index -= l.prevIndex + 1
 
 	length := uint64(len(l.queue))
 	if index >= 0 && index < length {
@@ -77,14 +105,18 @@ func (l *memoryLog) Get(index uint64) (term uint64, err error) {
 }
 
 // Match 是否有匹配上 term 与 index 的 log entry
+// 被快照覆盖的 log entry 都已 commit, 总是匹配
 func (l *memoryLog) Match(index, term uint64) (bool, error) {
 	l.mux.Lock()
 	defer l.mux.Unlock()
-	if index == 0 {
+	if index == 0 || index < l.prevIndex {
 		return true, nil
 	}
+	if index == l.prevIndex {
+		return term == l.prevTerm, nil
+	}
 
-	index--
+	index -= l.prevIndex + 1
 	length := uint64(len(l.queue))
 	if length <= index {
 		return false, nil
@@ -105,7 +137,7 @@ func (l *memoryLog) Last() (index, term uint64, err error) {
 
 func (l *memoryLog) last() (index, term uint64, err error) {
 	if len(l.queue) == 0 {
-		return 0, 0, nil
+		return l.prevIndex, l.prevTerm, nil
 	}
 
 	entry := l.queue[len(l.queue)-1]
@@ -118,12 +150,15 @@ func (l *memoryLog) RangeGet(i, j uint64) ([]LogEntry, error) {
 	l.mux.Lock()
 	defer l.mux.Unlock()
 
+	if i < l.prevIndex {
+		i = l.prevIndex
+	}
 	if j <= i {
 		return nil, nil
 	}
 
-	i--
-	j--
+	i -= l.prevIndex + 1
+	j -= l.prevIndex + 1
 	var entries []LogEntry
 	for k := i + 1; k <= j && k < uint64(len(l.queue)); k++ {
 		entries = append(entries, l.queue[k])
@@ -132,16 +167,26 @@ func (l *memoryLog) RangeGet(i, j uint64) ([]LogEntry, error) {
 }
 
 // AppendAfter 追加 log entry
+// 已被快照覆盖的 log entry 会被跳过
 func (l *memoryLog) AppendAfter(afterIndex uint64, entries ...LogEntry) error {
 	l.mux.Lock()
 	defer l.mux.Unlock()
 
+	if afterIndex < l.prevIndex {
+		skip := l.prevIndex - afterIndex
+		if skip > uint64(len(entries)) {
+			skip = uint64(len(entries))
+		}
+		entries = entries[skip:]
+		afterIndex = l.prevIndex
+	}
+
 	// pop after
-	if afterIndex > uint64(len(l.queue)) {
+	if afterIndex > l.prevIndex+uint64(len(l.queue)) {
 		msg := fmt.Sprintf("afterIndex(%d) out of range", afterIndex)
 		return errors.New(msg)
 	}
-	l.queue = l.queue[:afterIndex]
+	l.queue = l.queue[:afterIndex-l.prevIndex]
 
 	// append
 	start := afterIndex + 1
@@ -182,3 +227,45 @@ func (l *memoryLog) AppendEntry(entry LogEntry) (index uint64, err error) {
 	l.queue = append(l.queue, entry)
 	return entry.Index, nil
 }
+
+// FirstIndex 返回第一个保留的 log entry 的索引
+func (l *memoryLog) FirstIndex() (uint64, error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	return l.prevIndex + 1, nil
+}
+
+// Compact 丢弃索引不大于 upToIndex 的 log entry
+func (l *memoryLog) Compact(upToIndex uint64) error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if upToIndex <= l.prevIndex {
+		return nil
+	}
+	i := upToIndex - l.prevIndex
+	if i > uint64(len(l.queue)) {
+		return fmt.Errorf("%w: %d", ErrCompactBeyondLastIndex, upToIndex)
+	}
+	l.prevIndex, l.prevTerm = upToIndex, l.queue[i-1].Term
+	l.queue = append([]LogEntry(nil), l.queue[i:]...)
+	return nil
+}
+
+// TruncatePrefix 丢弃索引不大于 index 的 log entry
+// 若 log 中没有匹配 index 与 term 的 log entry, 丢弃整个 log
+func (l *memoryLog) TruncatePrefix(index, term uint64) error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if index <= l.prevIndex {
+		return nil
+	}
+
+	i := index - l.prevIndex
+	if i <= uint64(len(l.queue)) && l.queue[i-1].Term == term {
+		l.queue = append([]LogEntry(nil), l.queue[i:]...)
+	} else {
+		l.queue = nil
+	}
+	l.prevIndex, l.prevTerm = index, term
+	return nil
+}
@@ -0,0 +1,83 @@
+package raft
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrLogEntryNotExists = errors.New("err: log entry does not exist")
+)
+
+// errLogEntryCompacted 需要复制的 log entry 已被压缩, 应改为发送快照
+var errLogEntryCompacted = errors.New("err: log entry has been compacted")
+
+// readEntries 读取 prevLogIndex 的 term 与 (prevLogIndex, lastIndex] 的 log entry
+//
+// Log 对不存在的 log entry 返回零值而不是错误, 缺少 log entry 时区分两种情况:
+// 所需的 log entry 在读取前被并发地压缩, 返回 errLogEntryCompacted, 调用方改为发送快照;
+// 否则 log 中出现了空洞, 说明存储已损坏, 发出 EventLogGap 事件并返回 ErrLogEntryNotExists.
+func (l *leader) readEntries(prevLogIndex, lastIndex uint64) (prevLogTerm uint64, entries []LogEntry, err error) {
+	prevLogTerm, err = l.Get(prevLogIndex)
+	if err != nil {
+		return 0, nil, err
+	}
+	if prevLogIndex > 0 && prevLogTerm == 0 {
+		// the bootstrap entry has term 0 as well
+		ok, err := l.hasEntry(prevLogIndex)
+		if err != nil {
+			return 0, nil, err
+		}
+		if !ok {
+			return 0, nil, l.missingEntry(prevLogIndex)
+		}
+	}
+	if lastIndex <= prevLogIndex {
+		return prevLogTerm, nil, nil
+	}
+	entries, err = l.RangeGet(prevLogIndex, lastIndex)
+	if err != nil {
+		return 0, nil, err
+	}
+	if n := uint64(len(entries)); n != lastIndex-prevLogIndex {
+		return 0, nil, l.missingEntry(prevLogIndex + 1 + n)
+	}
+	return prevLogTerm, entries, nil
+}
+
+// hasEntry log 中是否有索引为 index 的 log entry, 或 index 是压缩的边界
+func (l *leader) hasEntry(index uint64) (bool, error) {
+	firstIndex, err := l.FirstIndex()
+	if err != nil {
+		return false, err
+	}
+	// term of the last compacted entry is retained, see Log.TruncatePrefix
+	if index+1 == firstIndex {
+		return true, nil
+	}
+	entries, err := l.RangeGet(index-1, index)
+	if err != nil {
+		return false, err
+	}
+	return len(entries) == 1, nil
+}
+
+// missingEntry 判断读不到的 log entry index 是已被压缩, 还是 log 中的空洞
+func (l *leader) missingEntry(index uint64) error {
+	firstIndex, err := l.FirstIndex()
+	if err != nil {
+		return err
+	}
+	if index < firstIndex {
+		return fmt.Errorf("%w: %d, first index %d", errLogEntryCompacted, index, firstIndex)
+	}
+	l.metrics.IncrCounter(MetricLogGaps, 1)
+	l.emit(Event{
+		Type:       EventLogGap,
+		Level:      EventLevelCritical,
+		FirstIndex: index,
+		LastIndex:  index,
+		Message:    fmt.Sprintf("log entry %d is missing while first index is %d, log storage may be corrupted", index, firstIndex),
+	})
+	return fmt.Errorf("%w: %d", ErrLogEntryNotExists, index)
+}
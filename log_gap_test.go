@@ -0,0 +1,130 @@
+package raft
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gapLog 读不到索引不小于 missing 的 log entry, FirstIndex 至少为 first
+type gapLog struct {
+	*memoryLog
+	mux     sync.Mutex
+	missing uint64
+	first   uint64
+}
+
+func (l *gapLog) set(missing, first uint64) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.missing, l.first = missing, first
+}
+
+func (l *gapLog) Get(index uint64) (uint64, error) {
+	l.mux.Lock()
+	missing := l.missing
+	l.mux.Unlock()
+	if missing > 0 && index >= missing {
+		return 0, nil
+	}
+	return l.memoryLog.Get(index)
+}
+
+func (l *gapLog) RangeGet(i, j uint64) ([]LogEntry, error) {
+	l.mux.Lock()
+	missing := l.missing
+	l.mux.Unlock()
+	if missing > 0 && j >= missing {
+		j = missing - 1
+	}
+	return l.memoryLog.RangeGet(i, j)
+}
+
+func (l *gapLog) FirstIndex() (uint64, error) {
+	l.mux.Lock()
+	first := l.first
+	l.mux.Unlock()
+	index, err := l.memoryLog.FirstIndex()
+	if first > index {
+		index = first
+	}
+	return index, err
+}
+
+func TestReadEntries(t *testing.T) {
+	log := &gapLog{memoryLog: &memoryLog{}}
+	var (
+		mux    sync.Mutex
+		events []Event
+	)
+	observer := func(event Event) {
+		mux.Lock()
+		defer mux.Unlock()
+		if event.Type == EventLogGap {
+			events = append(events, event)
+		}
+	}
+	r, err := New("gap", "gap", (&listFSM{}).apply, &memoryStore{}, log, WithDevMode(), WithObserver(observer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	go r.Run()
+	for !r.IsLeader() {
+		time.Sleep(time.Millisecond)
+	}
+	l := r.(*raft).GetServer().(*leader)
+	for i := 0; i < 4; i++ {
+		if _, err := log.AppendEntry(LogEntry{Term: l.GetCurrentTerm()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lastLogIndex, _, err := log.Last()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("complete", func(t *testing.T) {
+		// the bootstrap entry at index 1 has term 0
+		prevLogTerm, entries, err := l.readEntries(1, lastLogIndex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prevLogTerm != 0 || uint64(len(entries)) != lastLogIndex-1 {
+			t.Fatalf("expect %d entries after term 0 but got %d after term %d", lastLogIndex-1, len(entries), prevLogTerm)
+		}
+	})
+
+	t.Run("compacted concurrently", func(t *testing.T) {
+		log.set(3, 4)
+		defer log.set(0, 0)
+		_, _, err := l.readEntries(1, lastLogIndex)
+		if !errors.Is(err, errLogEntryCompacted) {
+			t.Fatalf("expect %v but got %v", errLogEntryCompacted, err)
+		}
+		mux.Lock()
+		defer mux.Unlock()
+		if len(events) != 0 {
+			t.Fatalf("expect no gap event but got %+v", events)
+		}
+	})
+
+	t.Run("gap", func(t *testing.T) {
+		log.set(3, 0)
+		defer log.set(0, 0)
+		_, _, err := l.readEntries(1, lastLogIndex)
+		if !errors.Is(err, ErrLogEntryNotExists) {
+			t.Fatalf("expect %v but got %v", ErrLogEntryNotExists, err)
+		}
+		_, _, err = l.readEntries(3, lastLogIndex)
+		if !errors.Is(err, ErrLogEntryNotExists) {
+			t.Fatalf("expect %v but got %v", ErrLogEntryNotExists, err)
+		}
+		mux.Lock()
+		defer mux.Unlock()
+		if len(events) != 2 || events[0].FirstIndex != 3 || events[0].Level != EventLevelCritical {
+			t.Fatalf("expect critical gap events at 3 but got %+v", events)
+		}
+	})
+}
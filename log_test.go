@@ -1,6 +1,7 @@
 package raft
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
 	"testing"
@@ -187,3 +188,88 @@ func TestLog(t *testing.T) {
 	})
 
 }
+
+func TestMemoryLogCompact(t *testing.T) {
+	log := &memoryLog{}
+	log.Append(LogEntry{Term: 1}, LogEntry{Term: 1}, LogEntry{Term: 2})
+
+	err := log.Compact(4)
+	if !errors.Is(err, ErrCompactBeyondLastIndex) {
+		t.Errorf("expect %v but got %v", ErrCompactBeyondLastIndex, err)
+	}
+	err = log.Compact(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := log.FirstIndex()
+	if first != 3 {
+		t.Errorf("expect first index 3 but got %d", first)
+	}
+	if match, _ := log.Match(2, 1); !match {
+		t.Errorf("expect compacted index 2 match term 1")
+	}
+	index, term, _ := log.Last()
+	if index != 3 || term != 2 {
+		t.Errorf("expect last (3, 2) but got (%d, %d)", index, term)
+	}
+	// compacting already compacted entries is a no-op
+	err = log.Compact(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemoryLogTruncatePrefix(t *testing.T) {
+	newLog := func() *memoryLog {
+		log := &memoryLog{}
+		log.Append(LogEntry{Term: 1}, LogEntry{Term: 1}, LogEntry{Term: 2}, LogEntry{Term: 2})
+		return log
+	}
+
+	t.Run("retain entries following the matched entry", func(t *testing.T) {
+		log := newLog()
+		err := log.TruncatePrefix(2, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		first, _ := log.FirstIndex()
+		if first != 3 {
+			t.Errorf("expect first index 3 but got %d", first)
+		}
+		if term, _ := log.Get(2); term != 1 {
+			t.Errorf("expect term of truncated index 1 but got %d", term)
+		}
+		if match, _ := log.Match(1, 9); !match {
+			t.Errorf("expect truncated entries always match")
+		}
+		entries, _ := log.RangeGet(0, 4)
+		if len(entries) != 2 || entries[0].Index != 3 || entries[1].Index != 4 {
+			t.Errorf("expect entries [3, 4] but got %+v", entries)
+		}
+		index, err := log.AppendEntry(LogEntry{Term: 3})
+		if err != nil || index != 5 {
+			t.Errorf("expect appended at 5 but got %d, err: %v", index, err)
+		}
+	})
+
+	t.Run("discard entire log on mismatch", func(t *testing.T) {
+		log := newLog()
+		err := log.TruncatePrefix(6, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		index, term, _ := log.Last()
+		if index != 6 || term != 3 {
+			t.Errorf("expect last (6, 3) but got (%d, %d)", index, term)
+		}
+		// leader resends entries already covered by snapshot
+		err = log.AppendAfter(5, LogEntry{Term: 3}, LogEntry{Term: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		index, _, _ = log.Last()
+		if index != 7 {
+			t.Errorf("expect last index 7 but got %d", index)
+		}
+	})
+}
@@ -1,32 +1,164 @@
 package raft
 
 import (
+	"context"
 	"fmt"
-	stdlog "log"
+	"log/slog"
 	"os"
-	"time"
+	"strings"
 )
 
+// LogSubsystem 输出日志的子系统, 可分别设置日志级别, 见 WithLogLevel
+type LogSubsystem string
+
+const (
+	// LogGeneral 启动, 停止, 事件等不属于其他子系统的日志
+	LogGeneral LogSubsystem = "raft"
+	// LogElection 预投票, 选举与状态转换
+	LogElection LogSubsystem = "election"
+	// LogReplication 日志复制, 快照与成员变更
+	LogReplication LogSubsystem = "replication"
+	// LogApply 应用到状态机与日志压缩
+	LogApply LogSubsystem = "apply"
+	// LogTransport 与其他节点的 RPC
+	LogTransport LogSubsystem = "transport"
+)
+
+// logSubsystems 所有的子系统
+var logSubsystems = []LogSubsystem{LogGeneral, LogElection, LogReplication, LogApply, LogTransport}
+
+// Logger 只支持格式化输出的日志, 见 WithLogger
+//
+// Deprecated: 使用 WithSlog 输出结构化的日志
 type Logger interface {
 	Debug(format string, args ...interface{})
 }
 
-func newLogger() *logger {
-	return &logger{
-		Logger: stdlog.New(
-			os.Stdout,
-			"",
-			0),
+// newLogger 默认的日志, 以文本格式输出所有级别的日志到标准输出
+func newLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+// log 输出 subsystem 的日志, 附带节点的 id, term 与状态
+func (r *raft) log(subsystem LogSubsystem) *slog.Logger {
+	return r.loggers[subsystem]
+}
+
+// newSubsystemLoggers 为每个子系统创建日志, 低于 levels 中对应级别的日志被丢弃
+func newSubsystemLoggers(logger *slog.Logger, levels map[LogSubsystem]slog.Level, r *raft) map[LogSubsystem]*slog.Logger {
+	loggers := make(map[LogSubsystem]*slog.Logger, len(logSubsystems))
+	for _, subsystem := range logSubsystems {
+		level, ok := levels[subsystem]
+		if !ok {
+			level = slog.LevelDebug
+		}
+		handler := logger.Handler().WithAttrs([]slog.Attr{slog.String("subsystem", string(subsystem))})
+		loggers[subsystem] = slog.New(&nodeHandler{Handler: handler, level: level, raft: r})
+	}
+	return loggers
+}
+
+var _ slog.Handler = (*nodeHandler)(nil)
+
+// nodeHandler 按子系统的级别过滤日志, 并在日志的开头附加节点的 id, term 与状态
+type nodeHandler struct {
+	slog.Handler
+	level slog.Level
+	raft  *raft
+	// derive 依序执行的 WithAttrs 与 WithGroup,
+	// 在附加节点的属性之后执行, 使节点的属性不属于任何组
+	derive []func(slog.Handler) slog.Handler
+}
+
+func (h *nodeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level && h.Handler.Enabled(ctx, level)
+}
+
+func (h *nodeHandler) Handle(ctx context.Context, record slog.Record) error {
+	var state string
+	if server := h.raft.GetServer(); server != nil {
+		state = server.String()
+	}
+	attrs := []slog.Attr{
+		slog.String("id", string(h.raft.Id())),
+		slog.Uint64("term", h.raft.GetCurrentTerm()),
+		slog.String("state", state),
+	}
+	if len(h.derive) > 0 {
+		handler := h.Handler.WithAttrs(attrs)
+		for _, derive := range h.derive {
+			handler = derive(handler)
+		}
+		return handler.Handle(ctx, record)
+	}
+	node := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	node.AddAttrs(attrs...)
+	record.Attrs(func(attr slog.Attr) bool {
+		node.AddAttrs(attr)
+		return true
+	})
+	return h.Handler.Handle(ctx, node)
+}
+
+func (h *nodeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler {
+		return handler.WithAttrs(attrs)
+	})
+}
+
+func (h *nodeHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler {
+		return handler.WithGroup(name)
+	})
+}
+
+func (h *nodeHandler) with(derive func(slog.Handler) slog.Handler) slog.Handler {
+	derived := make([]func(slog.Handler) slog.Handler, len(h.derive), len(h.derive)+1)
+	copy(derived, h.derive)
+	return &nodeHandler{Handler: h.Handler, level: h.level, raft: h.raft, derive: append(derived, derive)}
+}
+
+var _ slog.Handler = (*legacyHandler)(nil)
+
+// legacyHandler 将结构化的日志格式化为一行, 输出到 Logger
+type legacyHandler struct {
+	logger Logger
+	// attrs 已格式化的 WithAttrs 的属性
+	attrs string
+	// group WithGroup 的组名前缀
+	group string
+}
+
+func (h *legacyHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *legacyHandler) Handle(_ context.Context, record slog.Record) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s %s", record.Time.Format("20060102T15:04:05.0000000"), record.Level, record.Message)
+	b.WriteString(h.attrs)
+	record.Attrs(func(attr slog.Attr) bool {
+		h.format(&b, attr)
+		return true
+	})
+	h.logger.Debug("%s", b.String())
+	return nil
+}
+
+func (h *legacyHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	b.WriteString(h.attrs)
+	for _, attr := range attrs {
+		h.format(&b, attr)
 	}
+	return &legacyHandler{logger: h.logger, attrs: b.String(), group: h.group}
 }
 
-type logger struct {
-	*stdlog.Logger
+func (h *legacyHandler) WithGroup(name string) slog.Handler {
+	return &legacyHandler{logger: h.logger, attrs: h.attrs, group: h.group + name + "."}
 }
 
-// Debug
-func (l *logger) Debug(format string, args ...interface{}) {
-	now := time.Now().Format("20060102T15:04:05.0000000")
-	format = fmt.Sprintf("%s %s", now, format)
-	l.Logger.Printf(format, args...)
+// format 以 key=value 的格式输出 attr
+func (h *legacyHandler) format(b *strings.Builder, attr slog.Attr) {
+	fmt.Fprintf(b, " %s%s=%v", h.group, attr.Key, attr.Value.Resolve())
 }
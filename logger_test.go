@@ -0,0 +1,91 @@
+package raft
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// lineLogger 记录每行日志的 Logger
+type lineLogger struct {
+	mux   sync.Mutex
+	lines []string
+}
+
+func (l *lineLogger) Debug(format string, args ...interface{}) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func TestLogger(t *testing.T) {
+	t.Run("structured", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		r, err := New("logger", "logger", nil, nil, nil, WithDevMode(),
+			WithSlog(logger), WithLogLevel(LogElection, slog.LevelWarn))
+		if err != nil {
+			t.Fatal(err)
+		}
+		raft := r.(*raft)
+		raft.log(LogApply).Debug("Applied", "index", 3)
+		raft.log(LogElection).Info("Dropped")
+		raft.log(LogElection).Warn("Kept")
+
+		var records []map[string]interface{}
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			record := make(map[string]interface{})
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatal(err)
+			}
+			records = append(records, record)
+		}
+		var messages []string
+		for _, record := range records {
+			messages = append(messages, record["msg"].(string))
+			if record["subsystem"] == string(LogElection) && record["level"] != "WARN" {
+				t.Errorf("expect election logs below warn dropped but got %v", record)
+			}
+			if record["msg"] != "Applied" {
+				continue
+			}
+			expect := map[string]interface{}{
+				"subsystem": "apply",
+				"id":        "logger",
+				"term":      float64(raft.GetCurrentTerm()),
+				"state":     "Leader",
+				"index":     float64(3),
+			}
+			for key, value := range expect {
+				if record[key] != value {
+					t.Errorf("expect %s %v but got %v", key, value, record[key])
+				}
+			}
+		}
+		if !strings.Contains(strings.Join(messages, ","), "Applied,Kept") {
+			t.Errorf("expect Applied and Kept logged but got %q", messages)
+		}
+	})
+
+	t.Run("legacy", func(t *testing.T) {
+		logger := &lineLogger{}
+		r, err := New("legacy-logger", "legacy-logger", nil, nil, nil, WithDevMode(), WithLogger(logger))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.(*raft).log(LogReplication).WithGroup("peer").Info("Replicated", "id", "b")
+
+		logger.mux.Lock()
+		defer logger.mux.Unlock()
+		last := logger.lines[len(logger.lines)-1]
+		for _, expect := range []string{"INFO Replicated", "subsystem=replication", " id=legacy-logger", "state=Leader", "peer.id=b"} {
+			if !strings.Contains(last, expect) {
+				t.Errorf("expect %q in %q", expect, last)
+			}
+		}
+	})
+}
@@ -0,0 +1,139 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrServerAddrConflict    = errors.New("err: server is already a voter with a different addr")
+	ErrConfigurationMismatch = errors.New("err: current configuration doesn't match the expected old configuration")
+	ErrConfigurationEmpty    = errors.New("err: new configuration has no peer")
+)
+
+// configChangePollInterval 等待 C(new) commit 时检查配置的间隔
+const configChangePollInterval = 10 * time.Millisecond
+
+// AddVoter 将 id 加入集群成为投票成员
+//
+// 是只变更一个 server 的 ChangeConfig, 新 server 先作为 non-voting 成员追赶日志,
+// 直到 C(new) commit 才返回. id 已是相同 addr 的投票成员时直接返回.
+func (r *raft) AddVoter(ctx context.Context, id RaftId, addr RaftAddr) error {
+	if !r.GetServer().IsLeader() {
+		return r.notLeader()
+	}
+	for _, peer := range r.configs.GetConfig().GetPeers() {
+		if peer.Id != id {
+			continue
+		}
+		if peer.Addr != addr {
+			return fmt.Errorf("%w: %s(%s)", ErrServerAddrConflict, peer.Id, peer.Addr)
+		}
+		return r.waitConfigChange(ctx)
+	}
+	err := r.ChangeConfig(ctx, []RaftPeer{{Id: id, Addr: addr}}, nil)
+	if err != nil {
+		return err
+	}
+	return r.waitConfigChange(ctx)
+}
+
+// RemoveServer 将 id 移出集群
+//
+// 是只变更一个 server 的 ChangeConfig, 直到 C(new) commit 才返回.
+// id 不在集群中时直接返回. 移除 Leader 自身时, Leader 在 C(new) commit 后退位.
+func (r *raft) RemoveServer(ctx context.Context, id RaftId) error {
+	if !r.GetServer().IsLeader() {
+		return r.notLeader()
+	}
+	if !r.configs.GetConfig().IncludePeer(id) {
+		return r.waitConfigChange(ctx)
+	}
+	err := r.ChangeConfig(ctx, nil, []RaftId{id})
+	if err != nil {
+		return err
+	}
+	return r.waitConfigChange(ctx)
+}
+
+// ChangeConfiguration 将集群配置从 old 变更为 new
+//
+// 经过 joint consensus: 先 commit C(old,new), 期间日志 commit 与选举都需要同时获得
+// old 与 new 各自的多数, 再 commit C(new) 后返回, 因此可以一次替换多个节点.
+// 当前配置与 old 不一致时返回 ErrConfigurationMismatch, 避免基于过期的配置做变更.
+// old 与 new 中同一 id 的 addr 须相同, 修改地址使用 UpdatePeerAddress.
+func (r *raft) ChangeConfiguration(ctx context.Context, old, new []RaftPeer) error {
+	if !r.GetServer().IsLeader() {
+		return r.notLeader()
+	}
+	if len(new) == 0 {
+		return ErrConfigurationEmpty
+	}
+	current := r.configs.GetConfig()
+	if current.IsJoint() || !samePeers(current.GetPeers(), old) {
+		return fmt.Errorf("%w: current %v, expected %v", ErrConfigurationMismatch, current.GetPeers(), old)
+	}
+
+	var added []RaftPeer
+	for _, peer := range new {
+		for _, o := range old {
+			if o.Id == peer.Id && o.Addr != peer.Addr {
+				return fmt.Errorf("%w: %s(%s)", ErrServerAddrConflict, o.Id, o.Addr)
+			}
+		}
+		if !includePeer(old, peer) {
+			added = append(added, peer)
+		}
+	}
+	var removed []RaftId
+	for _, peer := range old {
+		if !includePeer(new, peer) {
+			removed = append(removed, peer.Id)
+		}
+	}
+	err := r.ChangeConfig(ctx, added, removed)
+	if err != nil {
+		return err
+	}
+	return r.waitConfigChange(ctx)
+}
+
+// samePeers a 与 b 是否包含相同的 peer, 与顺序无关
+func samePeers(a, b []RaftPeer) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, peer := range a {
+		found := false
+		for _, other := range b {
+			if other == peer {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// waitConfigChange 等待进行中的配置变更完成, 即 C(new) 生效且 commit
+//
+// ChangeConfig 在 C(old,new) commit 后即返回, C(new) 由 Leader 随后追加.
+func (r *raft) waitConfigChange(ctx context.Context) error {
+	ticker := time.NewTicker(configChangePollInterval)
+	defer ticker.Stop()
+	for r.configChangeInProgress(r.configs.GetConfig()) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-r.Done():
+			return ErrStopped
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
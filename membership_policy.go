@@ -0,0 +1,69 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var ErrMembershipChangeRejected = errors.New("err: membership change is rejected by policy")
+
+// MembershipChange Leader 准备进行的成员变更
+type MembershipChange struct {
+	// Current 当前配置中的 peer
+	Current []RaftPeer
+	// Added 将加入集群的 peer
+	Added []RaftPeer
+	// Removed 将移出集群的 peer
+	Removed []RaftId
+}
+
+// MembershipPolicy 在 Leader 接受成员变更之前检查变更是否符合部署约束,
+// 如新节点的版本、可用区分布、白名单
+//
+// AddVoter, RemoveServer, ChangeConfiguration 与 ChangeConfig 都会经过检查.
+type MembershipPolicy interface {
+	// Authorize 返回错误时拒绝变更, 调用方得到包装了该错误的 ErrMembershipChangeRejected
+	Authorize(ctx context.Context, change MembershipChange) error
+}
+
+// MembershipPolicyFunc 函数形式的 MembershipPolicy
+type MembershipPolicyFunc func(ctx context.Context, change MembershipChange) error
+
+func (f MembershipPolicyFunc) Authorize(ctx context.Context, change MembershipChange) error {
+	return f(ctx, change)
+}
+
+// AllowPeers 只允许 ids 中的 peer 加入集群的 MembershipPolicy
+func AllowPeers(ids ...RaftId) MembershipPolicy {
+	allowed := make(map[RaftId]bool, len(ids))
+	for _, id := range ids {
+		allowed[id] = true
+	}
+	return MembershipPolicyFunc(func(ctx context.Context, change MembershipChange) error {
+		for _, peer := range change.Added {
+			if !allowed[peer.Id] {
+				return fmt.Errorf("%s is not allowed", peer.Id)
+			}
+		}
+		return nil
+	})
+}
+
+// authorizeMembershipChange 由 MembershipPolicy 检查变更, 未配置时允许所有变更
+func (r *raft) authorizeMembershipChange(ctx context.Context, add []RaftPeer, remove []RaftId) error {
+	if r.membershipPolicy == nil {
+		return nil
+	}
+	change := MembershipChange{
+		Current: r.configs.GetConfig().GetPeers(),
+		Added:   add,
+		Removed: remove,
+	}
+	err := r.membershipPolicy.Authorize(ctx, change)
+	if err != nil {
+		r.log(LogReplication).Warn("Membership change rejected", "added", change.Added, "removed", change.Removed, "err", err)
+		return fmt.Errorf("%w: %v", ErrMembershipChangeRejected, err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMembershipPolicy(t *testing.T) {
+	var changes []MembershipChange
+	policy := MembershipPolicyFunc(func(ctx context.Context, change MembershipChange) error {
+		changes = append(changes, change)
+		if len(change.Removed) > 0 {
+			return errors.New("removing is disabled")
+		}
+		return AllowPeers("policy-allowed").Authorize(ctx, change)
+	})
+	leader, err := New("policy-leader", "policy-leader", (&listFSM{}).apply, nil, nil,
+		WithDevMode(), WithMembershipPolicy(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leader.Stop()
+	go leader.Run()
+
+	allowed := runLoopbackFollower(t, "policy-allowed")
+	defer allowed.Stop()
+	denied := runLoopbackFollower(t, "policy-denied")
+	defer denied.Stop()
+	ctx := context.Background()
+
+	t.Run("rejected", func(t *testing.T) {
+		err := leader.AddVoter(ctx, denied.Id(), denied.Addr())
+		if !errors.Is(err, ErrMembershipChangeRejected) {
+			t.Fatalf("expect %v but got %v", ErrMembershipChangeRejected, err)
+		}
+		if peers := leader.GetConfiguration().Peers; len(peers) != 1 {
+			t.Fatalf("expect configuration unchanged but got %v", peers)
+		}
+	})
+
+	t.Run("allowed", func(t *testing.T) {
+		if err := leader.AddVoter(ctx, allowed.Id(), allowed.Addr()); err != nil {
+			t.Fatal(err)
+		}
+		change := changes[len(changes)-1]
+		if len(change.Current) != 1 || change.Current[0].Id != leader.Id() {
+			t.Fatalf("expect current [%s] but got %v", leader.Id(), change.Current)
+		}
+		if len(change.Added) != 1 || change.Added[0].Id != allowed.Id() {
+			t.Fatalf("expect added [%s] but got %v", allowed.Id(), change.Added)
+		}
+	})
+
+	t.Run("removal rejected", func(t *testing.T) {
+		err := leader.RemoveServer(ctx, allowed.Id())
+		if !errors.Is(err, ErrMembershipChangeRejected) {
+			t.Fatalf("expect %v but got %v", ErrMembershipChangeRejected, err)
+		}
+		if !leader.GetConfiguration().Committed || len(leader.GetConfiguration().Peers) != 2 {
+			t.Fatalf("expect configuration unchanged but got %+v", leader.GetConfiguration())
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// runLoopbackFollower 运行使用 loopback rpc 的 Follower, 返回时已可接收 rpc
+func runLoopbackFollower(t *testing.T, id RaftId, opts ...OptFn) Raft {
+	t.Helper()
+	opts = append([]OptFn{WithRPC(newLoopbackRPC()), WithElection(5*time.Second, 6*time.Second)}, opts...)
+	follower, err := New(id, RaftAddr(id), (&listFSM{}).apply, &memoryStore{}, &memoryLog{}, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go follower.Run()
+	for {
+		if _, ok := loopbackServices.Load(string(follower.Addr())); ok {
+			return follower
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMembership(t *testing.T) {
+	leader, err := New("membership-leader", "membership-leader", nil, nil, nil, WithDevMode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leader.Stop()
+	go leader.Run()
+
+	follower := runLoopbackFollower(t, "membership-follower")
+	defer follower.Stop()
+
+	ctx := context.Background()
+	includes := func(id RaftId) bool {
+		return includePeer(leader.GetConfiguration().Peers, RaftPeer{Id: id})
+	}
+
+	err = leader.AddVoter(ctx, follower.Id(), follower.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !includes(follower.Id()) {
+		t.Errorf("expect %s is a voter after AddVoter", follower.Id())
+	}
+	index := leader.GetConfiguration().Index
+	err = leader.AddVoter(ctx, follower.Id(), follower.Addr())
+	if err != nil || leader.GetConfiguration().Index != index {
+		t.Errorf("expect adding an existing voter is a no-op but got err: %v", err)
+	}
+	err = leader.AddVoter(ctx, follower.Id(), "elsewhere")
+	if !errors.Is(err, ErrServerAddrConflict) {
+		t.Errorf("expect %v but got %v", ErrServerAddrConflict, err)
+	}
+
+	err = leader.RemoveServer(ctx, follower.Id())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if includes(follower.Id()) {
+		t.Errorf("expect %s isn't a voter after RemoveServer", follower.Id())
+	}
+	index = leader.GetConfiguration().Index
+	err = leader.RemoveServer(ctx, follower.Id())
+	if err != nil || leader.GetConfiguration().Index != index {
+		t.Errorf("expect removing an absent server is a no-op but got err: %v", err)
+	}
+
+	err = follower.RemoveServer(ctx, leader.Id())
+	if !errors.Is(err, ErrIsNotLeader) {
+		t.Errorf("expect %v but got %v", ErrIsNotLeader, err)
+	}
+}
+
+func TestChangeConfiguration(t *testing.T) {
+	leader, err := New("configuration-leader", "configuration-leader", nil, nil, nil, WithDevMode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leader.Stop()
+	go leader.Run()
+	var followers []Raft
+	for _, id := range []RaftId{"configuration-1", "configuration-2", "configuration-3"} {
+		follower := runLoopbackFollower(t, id)
+		defer follower.Stop()
+		followers = append(followers, follower)
+	}
+	peer := func(r Raft) RaftPeer {
+		return RaftPeer{Id: r.Id(), Addr: r.Addr()}
+	}
+
+	ctx := context.Background()
+	old := []RaftPeer{peer(leader)}
+	new := []RaftPeer{peer(leader), peer(followers[0]), peer(followers[1])}
+	err = leader.ChangeConfiguration(ctx, old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := leader.GetConfiguration()
+	if !samePeers(config.Peers, new) || config.ChangeInProgress {
+		t.Errorf("expect committed configuration %v but got %+v", new, config)
+	}
+
+	// replace two servers at once
+	err = leader.ChangeConfiguration(ctx, old, new)
+	if !errors.Is(err, ErrConfigurationMismatch) {
+		t.Errorf("expect %v but got %v", ErrConfigurationMismatch, err)
+	}
+	old, new = new, []RaftPeer{peer(leader), peer(followers[2])}
+	err = leader.ChangeConfiguration(ctx, old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config = leader.GetConfiguration()
+	if !samePeers(config.Peers, new) || config.ChangeInProgress {
+		t.Errorf("expect committed configuration %v but got %+v", new, config)
+	}
+
+	err = leader.ChangeConfiguration(ctx, new, nil)
+	if !errors.Is(err, ErrConfigurationEmpty) {
+		t.Errorf("expect %v but got %v", ErrConfigurationEmpty, err)
+	}
+}
@@ -0,0 +1,203 @@
+package raft
+
+import "time"
+
+// MetricsSink 接收 raft 一致性模型的指标
+//
+// 实现需并发安全, 且不应阻塞. 可选的实现(Prometheus, statsd, OTLP, expvar)
+// 见 github.com/mind1949/raft/metrics
+type MetricsSink interface {
+	// IncrCounter 累加计数器
+	IncrCounter(name string, value float64, labels ...Label)
+	// SetGauge 设置当前值
+	SetGauge(name string, value float64, labels ...Label)
+	// AddSample 记录一次采样(如耗时), 用于统计分布
+	AddSample(name string, value float64, labels ...Label)
+}
+
+// Label 指标的标签
+type Label struct {
+	Name  string
+	Value string
+}
+
+// ExemplarSink 可选接口, 支持为采样附加 exemplar 的 sink
+//
+// exemplar 将一次采样关联到对应的 trace, 便于从监控面板上的耗时尖刺
+// 直接跳转到出问题的 peer 的 trace. 不支持的 sink 只记录采样.
+type ExemplarSink interface {
+	MetricsSink
+	// AddSampleWithExemplar 记录一次采样, 并将其作为 exemplar
+	AddSampleWithExemplar(name string, value float64, exemplar Exemplar, labels ...Label)
+}
+
+// Exemplar 采样关联的 trace
+type Exemplar struct {
+	TraceID string
+	SpanID  string
+	Time    time.Time
+}
+
+// Tracer 为 Leader 的每次 AppendEntries 调用创建 trace span
+type Tracer interface {
+	// StartAppendEntries 开始调用 peer 的 AppendEntries, 返回 span 的 trace id, span id
+	// 以及结束 span 的函数
+	StartAppendEntries(peer RaftId, entries int) (traceID, spanID string, end func(err error))
+}
+
+const (
+	// MetricElections 发起选举的次数
+	MetricElections = "raft.elections"
+	// MetricElectionsRefused 日志落后太多而放弃竞选的次数
+	MetricElectionsRefused = "raft.elections.refused"
+	// MetricElectionsDeferred 连续竞选失败后按 CampaignStrategy 推迟竞选的次数
+	MetricElectionsDeferred = "raft.elections.deferred"
+	// MetricPreVotes 发起 pre-vote 的次数
+	MetricPreVotes = "raft.elections.pre_votes"
+	// MetricPreVotesLost 未能在 pre-vote 中获得多数而放弃竞选的次数
+	MetricPreVotesLost = "raft.elections.pre_votes.lost"
+	// MetricLeaderChanges 成为 Leader 的次数
+	MetricLeaderChanges = "raft.leader.changes"
+	// MetricQuorumLost Leader 与多数节点失去联系而退位的次数
+	MetricQuorumLost = "raft.leader.quorum_lost"
+	// MetricProposalBatchSize 每批提交的 command 数量, 见 WithProposalBatching
+	MetricProposalBatchSize = "raft.leader.proposal_batch.size"
+	// MetricHeartbeatInterval 当前心跳间隔(毫秒), 见 WithAdaptiveHeartbeat
+	MetricHeartbeatInterval = "raft.leader.heartbeat_interval"
+	// MetricTerm 当前 term
+	MetricTerm = "raft.term"
+	// MetricCommitIndex commitIndex
+	MetricCommitIndex = "raft.commit_index"
+	// MetricLastApplied lastApplied
+	MetricLastApplied = "raft.last_applied"
+	// MetricApplyBacklog 已 commit 但未应用到状态机的 log entry 数量
+	MetricApplyBacklog = "raft.apply.backlog"
+	// MetricApplyDuration 单批 command 应用到状态机的耗时(毫秒)
+	MetricApplyDuration = "raft.apply.duration_ms"
+	// MetricApplyEntries 单批应用的 log entry 数量
+	MetricApplyEntries = "raft.apply.entries"
+	// MetricApplyNotifications commitIndex 推进后通知 apply worker 的次数
+	MetricApplyNotifications = "raft.apply.notifications"
+	// MetricApplyNotificationsCoalesced 与未处理的通知合并的次数
+	MetricApplyNotificationsCoalesced = "raft.apply.notifications.coalesced"
+	// MetricApplyWakeups apply worker 被唤醒的次数
+	MetricApplyWakeups = "raft.apply.wakeups"
+	// MetricApplyWakeupsEmpty apply worker 被唤醒但没有需要应用的 log entry 的次数
+	MetricApplyWakeupsEmpty = "raft.apply.wakeups.empty"
+	// MetricAppendEntriesDuration Leader 调用 AppendEntries 的耗时(毫秒)
+	MetricAppendEntriesDuration = "raft.replication.append_entries.duration_ms"
+	// MetricAppendEntriesFailures Leader 调用 AppendEntries 失败的次数
+	MetricAppendEntriesFailures = "raft.replication.append_entries.failures"
+	// MetricAppendEntriesCoalesced Follower 收到已被之后的请求写入的 log entry 的次数
+	MetricAppendEntriesCoalesced = "raft.replication.append_entries.coalesced"
+	// MetricAppendEntriesAcksCoalesced Leader 收到已被之后的确认覆盖的确认的次数
+	MetricAppendEntriesAcksCoalesced = "raft.replication.append_entries.acks_coalesced"
+	// MetricAppendEntriesBytes Leader 通过 AppendEntries 发送的 command 字节数
+	MetricAppendEntriesBytes = "raft.replication.append_entries.bytes"
+	// MetricPeerNextIndex Leader 记录的 peer 的 nextIndex, 带 peer 标签
+	MetricPeerNextIndex = "raft.replication.next_index"
+	// MetricPeerMatchIndex Leader 记录的 peer 的 matchIndex, 带 peer 标签
+	MetricPeerMatchIndex = "raft.replication.match_index"
+	// MetricPeerLag peer 已复制的日志落后 Leader 最新日志的条目数, 带 peer 标签
+	MetricPeerLag = "raft.replication.lag"
+	// MetricPipelineFallbacks 流水线复制退回逐个等待响应的次数, 带 peer 标签
+	MetricPipelineFallbacks = "raft.replication.pipeline.fallbacks"
+	// MetricBandwidthThrottled 因超出带宽预算而等待的耗时(毫秒), 带 peer 标签, 见 WithBandwidthBudget
+	MetricBandwidthThrottled = "raft.replication.throttled_ms"
+	// MetricLogGaps Leader 复制时发现 log 中缺少未压缩的 log entry 的次数
+	MetricLogGaps = "raft.replication.log_gaps"
+	// MetricConfigMismatches Follower 发现配置与 Leader 不一致的次数
+	MetricConfigMismatches = "raft.replication.config_mismatches"
+	// MetricLogTruncated Follower 删除的与 Leader 冲突的 log entry 数量
+	MetricLogTruncated = "raft.replication.truncated"
+	// MetricLogTruncationsRefused Follower 拒绝删除已 commit 的 log entry 的次数
+	MetricLogTruncationsRefused = "raft.replication.truncations_refused"
+	// MetricSnapshotDuration 创建快照的耗时(毫秒)
+	MetricSnapshotDuration = "raft.snapshot.duration_ms"
+	// MetricSnapshotsAutomatic 按 WithSnapshotPolicy 自动创建快照的次数
+	MetricSnapshotsAutomatic = "raft.snapshot.automatic"
+	// MetricSnapshotsSent Leader 向 peer 发送快照的次数
+	MetricSnapshotsSent = "raft.snapshot.sent"
+	// MetricSnapshotsInstalled 安装 Leader 发送的快照的次数
+	MetricSnapshotsInstalled = "raft.snapshot.installed"
+	// MetricLogCompacted 快照之后压缩丢弃的 log entry 数
+	MetricLogCompacted = "raft.log.compacted"
+	// MetricApplyDeduplicated 因幂等键重复而跳过的 log entry 数量, 见 WithDedupWindow
+	MetricApplyDeduplicated = "raft.apply.deduplicated"
+	// MetricPreApplyPanics PreApplyHook panic 的次数
+	MetricPreApplyPanics = "raft.apply.pre_apply.panics"
+	// MetricCommitDuration Leader 上 command 从提交到 commit 的耗时(毫秒)
+	MetricCommitDuration = "raft.commit.duration_ms"
+	// MetricSLOViolations commit 延迟超过 SLO 阈值的 command 数量, 见 WithCommitLatencySLO
+	MetricSLOViolations = "raft.slo.commit.violations"
+	// MetricSLOBurnRate commit 延迟 SLO 错误预算的燃烧率
+	MetricSLOBurnRate = "raft.slo.commit.burn_rate"
+	// MetricStartupDiverged 启动探测发现日志与集群分叉的次数
+	MetricStartupDiverged = "raft.startup.diverged"
+	// MetricStorageAppendDuration 启动基准测试中追加一个 log entry 的耗时(毫秒), 见 WithStorageBenchmark
+	MetricStorageAppendDuration = "raft.startup.storage.append_ms"
+	// MetricEventsDropped 订阅者缓冲已满而丢弃的事件数量, 见 Subscribe
+	MetricEventsDropped = "raft.events.dropped"
+
+	// LabelPeer 复制指标的 peer id 标签
+	LabelPeer = "peer"
+)
+
+var _ MetricsSink = noopMetricsSink{}
+
+// noopMetricsSink 丢弃所有指标
+type noopMetricsSink struct{}
+
+func (noopMetricsSink) IncrCounter(string, float64, ...Label) {}
+func (noopMetricsSink) SetGauge(string, float64, ...Label)    {}
+func (noopMetricsSink) AddSample(string, float64, ...Label)   {}
+
+// noopTracer 不创建 span
+type noopTracer struct{}
+
+func (noopTracer) StartAppendEntries(RaftId, int) (string, string, func(error)) {
+	return "", "", func(error) {}
+}
+
+// traceAppendEntries 开始调用 peer 的 AppendEntries, 返回结束时记录复制指标的函数
+//
+// 复制指标都带有 peer 标签; 耗时达到 slowAppendEntries 时, 若 sink 支持,
+// 将本次调用的 trace 作为 exemplar 附加到耗时采样上.
+func (r *raft) traceAppendEntries(peer RaftId, entries []LogEntry) (end func(err error)) {
+	traceID, spanID, endSpan := r.tracer.StartAppendEntries(peer, len(entries))
+	start := time.Now()
+	return func(err error) {
+		elapsed := time.Since(start)
+		endSpan(err)
+
+		label := Label{Name: LabelPeer, Value: string(peer)}
+		if size := entriesSize(entries); size > 0 {
+			r.metrics.IncrCounter(MetricAppendEntriesBytes, float64(size), label)
+		}
+		if err != nil {
+			r.metrics.IncrCounter(MetricAppendEntriesFailures, 1, label)
+		}
+		sink, ok := r.metrics.(ExemplarSink)
+		if !ok || traceID == "" || elapsed < r.slowAppendEntries {
+			r.metrics.AddSample(MetricAppendEntriesDuration, milliseconds(elapsed), label)
+			return
+		}
+		exemplar := Exemplar{TraceID: traceID, SpanID: spanID, Time: time.Now()}
+		sink.AddSampleWithExemplar(MetricAppendEntriesDuration, milliseconds(elapsed), exemplar, label)
+	}
+}
+
+// gaugeApplyBacklog 记录已 commit 但未应用的 log entry 数量
+func (r *raft) gaugeApplyBacklog() {
+	commitIndex, lastApplied := r.GetCommitIndex(), r.GetLastApplied()
+	var backlog uint64
+	if commitIndex > lastApplied {
+		backlog = commitIndex - lastApplied
+	}
+	r.metrics.SetGauge(MetricApplyBacklog, float64(backlog))
+}
+
+// milliseconds d 的毫秒数
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
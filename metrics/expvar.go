@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"strings"
+
+	"github.com/mind1949/raft"
+)
+
+// NewExpvar 创建以 expvar 暴露的 sink, 以 name 发布到 /debug/vars
+// 与 expvar.Publish 相同, name 重复时 panic
+func NewExpvar(name string) *Expvar {
+	e := &Expvar{registry: newRegistry(DefaultBuckets)}
+	expvar.Publish(name, e)
+	return e
+}
+
+var (
+	_ raft.MetricsSink = (*Expvar)(nil)
+	_ expvar.Var       = (*Expvar)(nil)
+)
+
+// Expvar 在内存中聚合指标, 以 json 对象暴露
+// 键为指标名及标签, 如 raft.replication.lag{peer=2};
+// counter 与 gauge 的值为数字, 采样的值为 {"count", "sum", "buckets"}
+type Expvar struct {
+	*registry
+}
+
+// expvarHistogram 采样分布, buckets 的键为 bucket 上界
+type expvarHistogram struct {
+	Count   uint64            `json:"count"`
+	Sum     float64           `json:"sum"`
+	Buckets map[string]uint64 `json:"buckets"`
+}
+
+// String 实现 expvar.Var
+func (e *Expvar) String() string {
+	values := make(map[string]interface{})
+	for _, m := range e.snapshot() {
+		k := expvarKey(m.name, m.labels)
+		if m.kind != kindHistogram {
+			values[k] = m.value
+			continue
+		}
+		h := expvarHistogram{Count: m.count, Sum: m.sum, Buckets: make(map[string]uint64, len(e.bounds))}
+		for i, bound := range e.bounds {
+			h.Buckets[promValue(bound)] = m.buckets[i]
+		}
+		values[k] = h
+	}
+	b, err := json.Marshal(values)
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
+}
+
+// expvarKey 指标名及标签, 如 name{a=1,b=2}
+func expvarKey(name string, labels []raft.Label) string {
+	if len(labels) == 0 {
+		return name
+	}
+	pairs := make([]string, 0, len(labels))
+	for _, label := range labels {
+		pairs = append(pairs, label.Name+"="+label.Value)
+	}
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
@@ -0,0 +1,188 @@
+// Package metrics raft.MetricsSink 的实现
+//
+//	prom := metrics.NewPrometheus()
+//	http.Handle("/metrics", prom)
+//	r, err := raft.New(id, addr, apply, store, log, raft.WithMetrics(prom))
+//
+// 推送型的监控系统可以使用 Statsd 或 OTLP, 也可以通过 Expvar 暴露到 /debug/vars,
+// 多个 sink 可以通过 Fanout 组合.
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mind1949/raft"
+)
+
+// DefaultBuckets 采样分布的默认边界, 适用于以毫秒为单位的耗时
+var DefaultBuckets = []float64{0.5, 1, 2.5, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000}
+
+var _ raft.ExemplarSink = Fanout(nil)
+
+// Fanout 将指标发送到多个 sink
+type Fanout []raft.MetricsSink
+
+func (f Fanout) IncrCounter(name string, value float64, labels ...raft.Label) {
+	for _, sink := range f {
+		sink.IncrCounter(name, value, labels...)
+	}
+}
+
+func (f Fanout) SetGauge(name string, value float64, labels ...raft.Label) {
+	for _, sink := range f {
+		sink.SetGauge(name, value, labels...)
+	}
+}
+
+func (f Fanout) AddSample(name string, value float64, labels ...raft.Label) {
+	for _, sink := range f {
+		sink.AddSample(name, value, labels...)
+	}
+}
+
+// AddSampleWithExemplar 不支持 exemplar 的 sink 只记录采样
+func (f Fanout) AddSampleWithExemplar(name string, value float64, exemplar raft.Exemplar, labels ...raft.Label) {
+	for _, sink := range f {
+		if s, ok := sink.(raft.ExemplarSink); ok {
+			s.AddSampleWithExemplar(name, value, exemplar, labels...)
+		} else {
+			sink.AddSample(name, value, labels...)
+		}
+	}
+}
+
+type kind uint8
+
+const (
+	kindCounter kind = iota + 1
+	kindGauge
+	kindHistogram
+)
+
+// metric 一个指标(名称与标签组合)的当前值
+type metric struct {
+	kind   kind
+	name   string
+	labels []raft.Label
+
+	// value counter 与 gauge 的值
+	value float64
+
+	// histogram
+	count   uint64
+	sum     float64
+	buckets []uint64
+	// exemplars 每个 bucket (含 +Inf) 最近一次的 exemplar
+	exemplars []*exemplar
+}
+
+// exemplar 附加到 histogram bucket 的采样
+type exemplar struct {
+	raft.Exemplar
+	value float64
+}
+
+// registry 在内存中聚合指标, 供拉取或定期推送
+type registry struct {
+	mux     sync.Mutex
+	bounds  []float64
+	metrics map[string]*metric
+}
+
+func newRegistry(bounds []float64) *registry {
+	return &registry{
+		bounds:  bounds,
+		metrics: make(map[string]*metric),
+	}
+}
+
+func (r *registry) IncrCounter(name string, value float64, labels ...raft.Label) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.get(kindCounter, name, labels).value += value
+}
+
+func (r *registry) SetGauge(name string, value float64, labels ...raft.Label) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.get(kindGauge, name, labels).value = value
+}
+
+func (r *registry) AddSample(name string, value float64, labels ...raft.Label) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.observe(name, value, labels)
+}
+
+func (r *registry) AddSampleWithExemplar(name string, value float64, e raft.Exemplar, labels ...raft.Label) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	m := r.observe(name, value, labels)
+	// the exemplar belongs to the first bucket containing value
+	i := sort.SearchFloat64s(r.bounds, value)
+	m.exemplars[i] = &exemplar{Exemplar: e, value: value}
+}
+
+func (r *registry) observe(name string, value float64, labels []raft.Label) *metric {
+	m := r.get(kindHistogram, name, labels)
+	m.count++
+	m.sum += value
+	for i, bound := range r.bounds {
+		if value <= bound {
+			m.buckets[i]++
+		}
+	}
+	return m
+}
+
+func (r *registry) get(kind kind, name string, labels []raft.Label) *metric {
+	k := key(name, labels)
+	m, ok := r.metrics[k]
+	if !ok {
+		m = &metric{
+			kind:   kind,
+			name:   name,
+			labels: append([]raft.Label(nil), labels...),
+		}
+		if kind == kindHistogram {
+			m.buckets = make([]uint64, len(r.bounds))
+			m.exemplars = make([]*exemplar, len(r.bounds)+1)
+		}
+		r.metrics[k] = m
+	}
+	return m
+}
+
+// snapshot 所有指标的副本, 按名称与标签排序
+func (r *registry) snapshot() []metric {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	keys := make([]string, 0, len(r.metrics))
+	for k := range r.metrics {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	metrics := make([]metric, 0, len(keys))
+	for _, k := range keys {
+		m := *r.metrics[k]
+		m.buckets = append([]uint64(nil), m.buckets...)
+		m.exemplars = append([]*exemplar(nil), m.exemplars...)
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+func key(name string, labels []raft.Label) string {
+	var b strings.Builder
+	b.WriteString(name)
+	for _, label := range labels {
+		b.WriteByte(0)
+		b.WriteString(label.Name)
+		b.WriteByte('=')
+		b.WriteString(label.Value)
+	}
+	return b.String()
+}
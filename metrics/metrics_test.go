@@ -0,0 +1,173 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mind1949/raft"
+)
+
+func TestPrometheus(t *testing.T) {
+	prom := NewPrometheus()
+	prom.IncrCounter(raft.MetricElections, 1)
+	prom.IncrCounter(raft.MetricElections, 2)
+	prom.SetGauge(raft.MetricTerm, 7, raft.Label{Name: "id", Value: "1"})
+	prom.AddSample(raft.MetricApplyDuration, 3)
+
+	recorder := httptest.NewRecorder()
+	prom.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := recorder.Body.String()
+	for _, line := range []string{
+		"# TYPE raft_elections counter",
+		"raft_elections 3",
+		"# TYPE raft_term gauge",
+		`raft_term{id="1"} 7`,
+		"# TYPE raft_apply_duration_ms histogram",
+		`raft_apply_duration_ms_bucket{le="2.5"} 0`,
+		`raft_apply_duration_ms_bucket{le="5"} 1`,
+		`raft_apply_duration_ms_bucket{le="+Inf"} 1`,
+		"raft_apply_duration_ms_sum 3",
+		"raft_apply_duration_ms_count 1",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expect line %q but got:\n%s", line, body)
+		}
+	}
+}
+
+func TestStatsd(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	statsd, err := NewStatsd(conn.LocalAddr().String(), "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer statsd.Close()
+
+	statsd.SetGauge(raft.MetricTerm, 2, raft.Label{Name: "id", Value: "1"})
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 512)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "app.raft.term:2|g|#id:1"
+	if got := string(buf[:n]); got != expect {
+		t.Errorf("expect %q but got %q", expect, got)
+	}
+}
+
+func TestExpvar(t *testing.T) {
+	e := NewExpvar("raft-test")
+	e.IncrCounter(raft.MetricElections, 2)
+	e.SetGauge(raft.MetricPeerLag, 3, raft.Label{Name: raft.LabelPeer, Value: "2"})
+	e.AddSample(raft.MetricApplyDuration, 3)
+
+	var values struct {
+		Elections float64 `json:"raft.elections"`
+		Lag       float64 `json:"raft.replication.lag{peer=2}"`
+		Apply     struct {
+			Count   uint64            `json:"count"`
+			Sum     float64           `json:"sum"`
+			Buckets map[string]uint64 `json:"buckets"`
+		} `json:"raft.apply.duration_ms"`
+	}
+	if err := json.Unmarshal([]byte(expvar.Get("raft-test").String()), &values); err != nil {
+		t.Fatal(err)
+	}
+	if values.Elections != 2 || values.Lag != 3 {
+		t.Errorf("expect elections 2, lag 3 but got %+v", values)
+	}
+	if values.Apply.Count != 1 || values.Apply.Sum != 3 || values.Apply.Buckets["5"] != 1 || values.Apply.Buckets["2.5"] != 0 {
+		t.Errorf("expect one sample in bucket 5 but got %+v", values.Apply)
+	}
+}
+
+func TestOTLP(t *testing.T) {
+	received := make(chan otlpRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		var req otlpRequest
+		if err := json.Unmarshal(b, &req); err != nil {
+			t.Error(err)
+		}
+		received <- req
+	}))
+	defer server.Close()
+
+	otlp := NewOTLP(server.URL+"/v1/metrics", raft.Label{Name: "service.name", Value: "raft"})
+	otlp.IncrCounter(raft.MetricElections, 1)
+	otlp.AddSample(raft.MetricApplyDuration, 3)
+	otlp.AddSample(raft.MetricApplyDuration, 30)
+	if err := otlp.Push(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-received
+	metrics := req.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	if len(metrics) != 2 {
+		t.Fatalf("expect 2 metrics but got %d", len(metrics))
+	}
+	histogram := metrics[0].Histogram
+	if metrics[0].Name != raft.MetricApplyDuration || histogram == nil {
+		t.Fatalf("expect histogram %s but got %+v", raft.MetricApplyDuration, metrics[0])
+	}
+	var total int
+	for _, count := range histogram.DataPoints[0].BucketCounts {
+		n, _ := json.Number(count).Int64()
+		total += int(n)
+	}
+	if total != 2 {
+		t.Errorf("expect 2 samples in buckets but got %d", total)
+	}
+	if sum := metrics[1].Sum; sum == nil || !sum.IsMonotonic || sum.DataPoints[0].AsDouble != 1 {
+		t.Errorf("expect monotonic sum of 1 but got %+v", sum)
+	}
+}
+
+func TestExemplar(t *testing.T) {
+	prom := NewPrometheus()
+	otlp := NewOTLP("")
+	sink := Fanout{prom, otlp}
+	labels := raft.Label{Name: raft.LabelPeer, Value: "2"}
+	exemplar := raft.Exemplar{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Time: time.Unix(1700000000, 0)}
+	sink.AddSampleWithExemplar(raft.MetricAppendEntriesDuration, 30, exemplar, labels)
+	sink.IncrCounter(raft.MetricAppendEntriesFailures, 1, labels)
+
+	t.Run("prometheus", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+		recorder := httptest.NewRecorder()
+		prom.ServeHTTP(recorder, req)
+		body := recorder.Body.String()
+		for _, line := range []string{
+			`raft_replication_append_entries_duration_ms_bucket{peer="2",le="50"} 1 # {trace_id="4bf92f3577b34da6a3ce929d0e0e4736",span_id="00f067aa0ba902b7"} 30 1700000000.000`,
+			`raft_replication_append_entries_duration_ms_bucket{peer="2",le="25"} 0`,
+			`raft_replication_append_entries_failures_total{peer="2"} 1`,
+			"# EOF",
+		} {
+			if !strings.Contains(body, line+"\n") {
+				t.Errorf("expect line %q but got:\n%s", line, body)
+			}
+		}
+	})
+
+	t.Run("otlp", func(t *testing.T) {
+		metrics := otlp.export(time.Now()).ResourceMetrics[0].ScopeMetrics[0].Metrics
+		exemplars := metrics[0].Histogram.DataPoints[0].Exemplars
+		if len(exemplars) != 1 || exemplars[0].TraceId != exemplar.TraceID || exemplars[0].AsDouble != 30 {
+			t.Errorf("expect exemplar of %s but got %+v", exemplar.TraceID, exemplars)
+		}
+	})
+}
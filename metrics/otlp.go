@@ -0,0 +1,245 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mind1949/raft"
+)
+
+// NewOTLP 创建定期以 OTLP/HTTP (json) 推送指标的 sink
+//
+// endpoint 为 collector 的指标接收地址, 如 http://127.0.0.1:4318/v1/metrics,
+// resource 为附加到所有指标的资源属性, 如 service.name
+func NewOTLP(endpoint string, resource ...raft.Label) *OTLP {
+	return &OTLP{
+		registry: newRegistry(DefaultBuckets),
+		endpoint: endpoint,
+		resource: resource,
+		client:   http.DefaultClient,
+		start:    time.Now(),
+	}
+}
+
+var _ raft.MetricsSink = (*OTLP)(nil)
+
+// OTLP 在内存中聚合指标, 以累计值(cumulative)定期推送
+type OTLP struct {
+	*registry
+	endpoint string
+	resource []raft.Label
+	client   *http.Client
+	start    time.Time
+}
+
+// Run 每隔 interval 推送一次, 直到 ctx 结束
+func (o *OTLP) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			_ = o.Push(ctx)
+		}
+	}
+}
+
+// Push 推送当前所有指标
+func (o *OTLP) Push(ctx context.Context) error {
+	body, err := json.Marshal(o.export(time.Now()))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("err: push metrics to %s: %s", o.endpoint, resp.Status)
+	}
+	return nil
+}
+
+// aggregationTemporalityCumulative OTLP AGGREGATION_TEMPORALITY_CUMULATIVE
+const aggregationTemporalityCumulative = 2
+
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes,omitempty"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetric struct {
+	Name      string         `json:"name"`
+	Sum       *otlpSum       `json:"sum,omitempty"`
+	Gauge     *otlpGauge     `json:"gauge,omitempty"`
+	Histogram *otlpHistogram `json:"histogram,omitempty"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpNumberDataPoint `json:"dataPoints"`
+	AggregationTemporality int                   `json:"aggregationTemporality"`
+	IsMonotonic            bool                  `json:"isMonotonic"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpNumberDataPoint `json:"dataPoints"`
+}
+
+type otlpHistogram struct {
+	DataPoints             []otlpHistogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                      `json:"aggregationTemporality"`
+}
+
+type otlpNumberDataPoint struct {
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	AsDouble          float64         `json:"asDouble"`
+}
+
+type otlpHistogramDataPoint struct {
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	Count             string          `json:"count"`
+	Sum               float64         `json:"sum"`
+	BucketCounts      []string        `json:"bucketCounts"`
+	ExplicitBounds    []float64       `json:"explicitBounds"`
+	Exemplars         []otlpExemplar  `json:"exemplars,omitempty"`
+}
+
+// otlpExemplar trace id 与 span id 为十六进制编码
+type otlpExemplar struct {
+	TimeUnixNano string  `json:"timeUnixNano"`
+	AsDouble     float64 `json:"asDouble"`
+	TraceId      string  `json:"traceId,omitempty"`
+	SpanId       string  `json:"spanId,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string          `json:"key"`
+	Value otlpStringValue `json:"value"`
+}
+
+type otlpStringValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+// export 将当前所有指标转换为 OTLP 请求
+// 同名指标的不同标签组合作为同一指标的多个数据点
+func (o *OTLP) export(now time.Time) otlpRequest {
+	start := strconv.FormatInt(o.start.UnixNano(), 10)
+	ts := strconv.FormatInt(now.UnixNano(), 10)
+
+	var metrics []otlpMetric
+	for _, m := range o.snapshot() {
+		if len(metrics) == 0 || metrics[len(metrics)-1].Name != m.name {
+			metrics = append(metrics, otlpMetric{Name: m.name})
+		}
+		last := &metrics[len(metrics)-1]
+		attributes := otlpAttributes(m.labels)
+		point := otlpNumberDataPoint{
+			Attributes:        attributes,
+			StartTimeUnixNano: start,
+			TimeUnixNano:      ts,
+			AsDouble:          m.value,
+		}
+
+		switch m.kind {
+		case kindCounter:
+			if last.Sum == nil {
+				last.Sum = &otlpSum{AggregationTemporality: aggregationTemporalityCumulative, IsMonotonic: true}
+			}
+			last.Sum.DataPoints = append(last.Sum.DataPoints, point)
+		case kindGauge:
+			if last.Gauge == nil {
+				last.Gauge = &otlpGauge{}
+			}
+			last.Gauge.DataPoints = append(last.Gauge.DataPoints, point)
+		case kindHistogram:
+			if last.Histogram == nil {
+				last.Histogram = &otlpHistogram{AggregationTemporality: aggregationTemporalityCumulative}
+			}
+			// OTLP bucket counts are per bucket, not cumulative
+			counts := make([]string, 0, len(m.buckets)+1)
+			var pre uint64
+			for _, n := range m.buckets {
+				counts = append(counts, strconv.FormatUint(n-pre, 10))
+				pre = n
+			}
+			counts = append(counts, strconv.FormatUint(m.count-pre, 10))
+			last.Histogram.DataPoints = append(last.Histogram.DataPoints, otlpHistogramDataPoint{
+				Attributes:        attributes,
+				StartTimeUnixNano: start,
+				TimeUnixNano:      ts,
+				Count:             strconv.FormatUint(m.count, 10),
+				Sum:               m.sum,
+				BucketCounts:      counts,
+				ExplicitBounds:    o.bounds,
+				Exemplars:         otlpExemplars(m.exemplars),
+			})
+		}
+	}
+
+	return otlpRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource: otlpResource{Attributes: otlpAttributes(o.resource)},
+		ScopeMetrics: []otlpScopeMetrics{{
+			Scope:   otlpScope{Name: "github.com/mind1949/raft"},
+			Metrics: metrics,
+		}},
+	}}}
+}
+
+func otlpExemplars(exemplars []*exemplar) []otlpExemplar {
+	var result []otlpExemplar
+	for _, e := range exemplars {
+		if e == nil {
+			continue
+		}
+		result = append(result, otlpExemplar{
+			TimeUnixNano: strconv.FormatInt(e.Time.UnixNano(), 10),
+			AsDouble:     e.value,
+			TraceId:      e.TraceID,
+			SpanId:       e.SpanID,
+		})
+	}
+	return result
+}
+
+func otlpAttributes(labels []raft.Label) []otlpAttribute {
+	var attributes []otlpAttribute
+	for _, label := range labels {
+		attributes = append(attributes, otlpAttribute{Key: label.Name, Value: otlpStringValue{label.Value}})
+	}
+	return attributes
+}
@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mind1949/raft"
+)
+
+// NewPrometheus 创建供 Prometheus 拉取的 sink
+func NewPrometheus() *Prometheus {
+	return &Prometheus{registry: newRegistry(DefaultBuckets)}
+}
+
+var (
+	_ raft.MetricsSink = (*Prometheus)(nil)
+	_ http.Handler     = (*Prometheus)(nil)
+)
+
+// Prometheus 在内存中聚合指标, 以 Prometheus 文本格式暴露
+// 指标名中的 '.' 替换为 '_', 采样以 histogram 暴露
+//
+// 请求接受 OpenMetrics 格式时以 OpenMetrics 暴露, 并附带 histogram bucket 的 exemplar
+type Prometheus struct {
+	*registry
+}
+
+// openMetricsType OpenMetrics 文本格式的 Content-Type
+const openMetricsType = "application/openmetrics-text"
+
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	openMetrics := strings.Contains(r.Header.Get("Accept"), openMetricsType)
+	if openMetrics {
+		w.Header().Set("Content-Type", openMetricsType+"; version=1.0.0; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	}
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+
+	var pre string
+	for _, m := range p.snapshot() {
+		name := promName(m.name)
+		if name != pre {
+			fmt.Fprintf(bw, "# TYPE %s %s\n", name, promType(m.kind))
+			pre = name
+		}
+		if m.kind != kindHistogram {
+			sample := name
+			if openMetrics && m.kind == kindCounter {
+				// OpenMetrics counter samples have the _total suffix
+				sample += "_total"
+			}
+			fmt.Fprintf(bw, "%s%s %s\n", sample, promLabels(m.labels), promValue(m.value))
+			continue
+		}
+		for i, bound := range p.bounds {
+			le := raft.Label{Name: "le", Value: promValue(bound)}
+			fmt.Fprintf(bw, "%s_bucket%s %d%s\n", name, promLabels(m.labels, le), m.buckets[i],
+				promExemplar(openMetrics, m.exemplars[i]))
+		}
+		inf := raft.Label{Name: "le", Value: "+Inf"}
+		fmt.Fprintf(bw, "%s_bucket%s %d%s\n", name, promLabels(m.labels, inf), m.count,
+			promExemplar(openMetrics, m.exemplars[len(p.bounds)]))
+		fmt.Fprintf(bw, "%s_sum%s %s\n", name, promLabels(m.labels), promValue(m.sum))
+		fmt.Fprintf(bw, "%s_count%s %d\n", name, promLabels(m.labels), m.count)
+	}
+	if openMetrics {
+		fmt.Fprint(bw, "# EOF\n")
+	}
+}
+
+// promExemplar OpenMetrics 格式的 exemplar, 如 ` # {trace_id="abc"} 12.5 1700000000.123`
+func promExemplar(openMetrics bool, e *exemplar) string {
+	if !openMetrics || e == nil {
+		return ""
+	}
+	labels := []raft.Label{{Name: "trace_id", Value: e.TraceID}}
+	if e.SpanID != "" {
+		labels = append(labels, raft.Label{Name: "span_id", Value: e.SpanID})
+	}
+	ts := float64(e.Time.UnixNano()) / float64(time.Second)
+	return fmt.Sprintf(" # %s %s %s", promLabels(labels), promValue(e.value),
+		strconv.FormatFloat(ts, 'f', 3, 64))
+}
+
+func promType(kind kind) string {
+	switch kind {
+	case kindCounter:
+		return "counter"
+	case kindGauge:
+		return "gauge"
+	default:
+		return "histogram"
+	}
+}
+
+// promName 将指标名转换为合法的 Prometheus 指标名
+func promName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == ':' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func promLabels(labels []raft.Label, extra ...raft.Label) string {
+	labels = append(labels[:len(labels):len(labels)], extra...)
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels))
+	for _, label := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", promName(label.Name), strconv.Quote(label.Value)))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func promValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/mind1949/raft"
+)
+
+// NewStatsd 创建通过 udp 向 statsd 推送指标的 sink
+// prefix 不为空时作为指标名的前缀
+func NewStatsd(addr, prefix string) (*Statsd, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+	return &Statsd{conn: conn, prefix: prefix}, nil
+}
+
+var _ raft.MetricsSink = (*Statsd)(nil)
+
+// Statsd 每个指标即时发送一个 udp 包, 标签以 DogStatsD 格式(|#name:value)附加
+type Statsd struct {
+	conn   net.Conn
+	prefix string
+}
+
+func (s *Statsd) IncrCounter(name string, value float64, labels ...raft.Label) {
+	s.send(name, value, "c", labels)
+}
+
+func (s *Statsd) SetGauge(name string, value float64, labels ...raft.Label) {
+	s.send(name, value, "g", labels)
+}
+
+func (s *Statsd) AddSample(name string, value float64, labels ...raft.Label) {
+	s.send(name, value, "ms", labels)
+}
+
+// Close 关闭连接
+func (s *Statsd) Close() error {
+	return s.conn.Close()
+}
+
+// send 发送失败时丢弃指标, 不影响 raft 的运行
+func (s *Statsd) send(name string, value float64, typ string, labels []raft.Label) {
+	line := fmt.Sprintf("%s%s:%s|%s", s.prefix, name, promValue(value), typ)
+	if len(labels) > 0 {
+		tags := make([]string, 0, len(labels))
+		for _, label := range labels {
+			tags = append(tags, label.Name+":"+label.Value)
+		}
+		line += "|#" + strings.Join(tags, ",")
+	}
+	_, _ = s.conn.Write([]byte(line))
+}
@@ -0,0 +1,139 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type countingSink struct {
+	noopMetricsSink
+	mux       sync.Mutex
+	counters  map[string]float64
+	exemplars []Exemplar
+	labels    map[string][]Label
+	// gauges 以指标名与第一个标签的值为键
+	gauges map[string]float64
+}
+
+func (s *countingSink) SetGauge(name string, value float64, labels ...Label) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.gauges == nil {
+		s.gauges = make(map[string]float64)
+	}
+	if len(labels) > 0 {
+		name += "/" + labels[0].Value
+	}
+	s.gauges[name] = value
+}
+
+func (s *countingSink) gauge(name string) float64 {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.gauges[name]
+}
+
+func (s *countingSink) IncrCounter(name string, value float64, labels ...Label) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.counters == nil {
+		s.counters = make(map[string]float64)
+		s.labels = make(map[string][]Label)
+	}
+	s.counters[name] += value
+	s.labels[name] = labels
+}
+
+func (s *countingSink) AddSampleWithExemplar(name string, value float64, exemplar Exemplar, labels ...Label) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.exemplars = append(s.exemplars, exemplar)
+}
+
+func (s *countingSink) counter(name string) float64 {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.counters[name]
+}
+
+type testTracer struct{}
+
+func (testTracer) StartAppendEntries(peer RaftId, entries int) (string, string, func(error)) {
+	return "trace-" + string(peer), "span", func(error) {}
+}
+
+func TestTraceAppendEntries(t *testing.T) {
+	sink := new(countingSink)
+	r, err := New("trace", "trace", nil, nil, nil,
+		WithDevMode(), WithMetrics(sink), WithTracer(testTracer{}, 10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raft := r.(*raft)
+	entries := []LogEntry{{Command: Command("abc")}, {Command: Command("de")}}
+
+	// fast round, no exemplar
+	raft.traceAppendEntries("peer1", entries)(nil)
+	if got := sink.counter(MetricAppendEntriesBytes); got != 5 {
+		t.Errorf("expect 5 bytes but got %v", got)
+	}
+	if len(sink.exemplars) != 0 {
+		t.Errorf("expect no exemplar but got %+v", sink.exemplars)
+	}
+	if labels := sink.labels[MetricAppendEntriesBytes]; len(labels) != 1 || labels[0] != (Label{Name: LabelPeer, Value: "peer1"}) {
+		t.Errorf("expect peer label but got %+v", labels)
+	}
+
+	// slow round
+	end := raft.traceAppendEntries("peer2", nil)
+	time.Sleep(20 * time.Millisecond)
+	end(errors.New("timeout"))
+	if got := sink.counter(MetricAppendEntriesFailures); got != 1 {
+		t.Errorf("expect 1 failure but got %v", got)
+	}
+	if len(sink.exemplars) != 1 || sink.exemplars[0].TraceID != "trace-peer2" {
+		t.Errorf("expect exemplar of trace-peer2 but got %+v", sink.exemplars)
+	}
+}
+
+func TestProgressMetrics(t *testing.T) {
+	sink := new(countingSink)
+	leader, err := New("progress-leader", "progress-leader", (&listFSM{}).apply, nil, nil,
+		WithDevMode(), WithMetrics(sink))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leader.Stop()
+	go leader.Run()
+
+	follower := runLoopbackFollower(t, "progress-follower")
+	defer follower.Stop()
+	ctx := context.Background()
+	if err := leader.AddVoter(ctx, follower.Id(), follower.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	if err := leader.Handle(ctx, Command("a"), Command("b")); err != nil {
+		t.Fatal(err)
+	}
+	lastLogIndex, _, err := leader.(*raft).Last()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peer := "/" + string(follower.Id())
+	if got := sink.gauge(MetricPeerMatchIndex + peer); got != float64(lastLogIndex) {
+		t.Errorf("expect match index %d but got %v", lastLogIndex, got)
+	}
+	if got := sink.gauge(MetricPeerNextIndex + peer); got != float64(lastLogIndex+1) {
+		t.Errorf("expect next index %d but got %v", lastLogIndex+1, got)
+	}
+	if got := sink.gauge(MetricPeerLag + peer); got != 0 {
+		t.Errorf("expect no lag but got %v", got)
+	}
+	if got := sink.gauge(MetricApplyBacklog); got != 0 {
+		t.Errorf("expect empty apply backlog but got %v", got)
+	}
+}
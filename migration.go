@@ -0,0 +1,169 @@
+package raft
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	ErrStorageVersionTooNew       = errors.New("err: storage was written by a newer version")
+	ErrMigrationBackupDirRequired = errors.New("err: storage migration requires a backup dir")
+)
+
+// StorageVersion 当前版本使用的存储格式版本
+//
+// 存储格式(Log, Store, 快照)发生不兼容的变化时递增,
+// 并在 storageMigrations 中追加从上一版本升级的 migration.
+const StorageVersion uint64 = 1
+
+// keyStorageVersion 存储格式版本在 Store 中的 key
+// 引入版本之前写入的存储没有该 key, 视为版本 0
+var keyStorageVersion = []byte("raft.storage.version")
+
+// migration 将存储从 version-1 升级到 version
+//
+// 每个 migration 完成后立即记录版本, 崩溃后重启会重新执行未记录版本的 migration,
+// 因此 migrate 须是幂等的.
+type migration struct {
+	version uint64
+	name    string
+	// backup 将 migrate 会修改的旧格式数据写入 w, 为 nil 时表示无需备份
+	backup func(m *migrator, w io.Writer) error
+	// migrate 原地升级存储格式
+	migrate func(m *migrator) error
+}
+
+// storageMigrations 按版本递增排列, 最后一个的版本为 StorageVersion
+var storageMigrations = []migration{
+	{
+		version: 1,
+		name:    "record storage version",
+		migrate: func(*migrator) error { return nil },
+	},
+}
+
+// migrator 启动时将存储升级到最新的格式
+type migrator struct {
+	store     Store
+	log       Log
+	snapshots SnapshotStore
+	// backupDir 保存旧格式数据备份的目录
+	backupDir  string
+	logger     *slog.Logger
+	migrations []migration
+}
+
+// run 依序执行存储版本之后的所有 migration
+//
+// 全新的存储无需升级, 直接记录最新的版本.
+// 存储版本比当前版本新时返回 ErrStorageVersionTooNew, 防止降级后以旧格式改写存储.
+func (m *migrator) run() error {
+	if len(m.migrations) == 0 {
+		return nil
+	}
+	latest := m.migrations[len(m.migrations)-1].version
+	version, err := m.store.GetUint64(keyStorageVersion)
+	if err != nil {
+		return err
+	}
+	if version > latest {
+		return fmt.Errorf("%w: storage version %d, supported version %d", ErrStorageVersionTooNew, version, latest)
+	}
+	if version == latest {
+		return nil
+	}
+	if version == 0 {
+		fresh, err := m.fresh()
+		if err != nil {
+			return err
+		}
+		if fresh {
+			return m.store.SetUint64(keyStorageVersion, latest)
+		}
+	}
+
+	for _, mg := range m.migrations {
+		if mg.version <= version {
+			continue
+		}
+		start := time.Now()
+		if mg.backup != nil {
+			path, err := m.backup(mg, version)
+			if err != nil {
+				return fmt.Errorf("err: backup before migrating storage to version %d(%s): %w", mg.version, mg.name, err)
+			}
+			m.logger.Info("Backed up storage", "version", version, "path", path)
+		}
+		err := mg.migrate(m)
+		if err != nil {
+			return fmt.Errorf("err: migrate storage to version %d(%s): %w", mg.version, mg.name, err)
+		}
+		err = m.store.SetUint64(keyStorageVersion, mg.version)
+		if err != nil {
+			return err
+		}
+		m.logger.Info("Migrated storage",
+			"from", version, "to", mg.version, "migration", mg.name, "elapsed", time.Since(start))
+		version = mg.version
+	}
+	return nil
+}
+
+// fresh 存储是否从未写入过数据
+func (m *migrator) fresh() (bool, error) {
+	// same key as state.keyCurrentTerm
+	term, err := m.store.GetUint64([]byte("state.CurrentTerm"))
+	if err != nil || term > 0 {
+		return false, err
+	}
+	if m.log != nil {
+		lastIndex, _, err := m.log.Last()
+		if err != nil || lastIndex > 0 {
+			return false, err
+		}
+	}
+	if m.snapshots != nil {
+		metas, err := m.snapshots.List()
+		if err != nil || len(metas) > 0 {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// backup 将 mg 会修改的旧格式数据备份到 backupDir, 返回备份文件的路径
+func (m *migrator) backup(mg migration, version uint64) (string, error) {
+	if m.backupDir == "" {
+		return "", ErrMigrationBackupDirRequired
+	}
+	err := os.MkdirAll(m.backupDir, 0o755)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(m.backupDir, fmt.Sprintf("storage-v%d-%d.bak", version, time.Now().UnixMilli()))
+	tmp := path + snapshotTmpSuffix
+	f, err := os.Create(tmp)
+	if err != nil {
+		return "", err
+	}
+	err = mg.backup(m, f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return path, syncDir(m.backupDir)
+}
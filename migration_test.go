@@ -0,0 +1,127 @@
+package raft
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrator(t *testing.T) {
+	var migrated []uint64
+	migrations := []migration{
+		{version: 1, name: "one", migrate: func(*migrator) error {
+			migrated = append(migrated, 1)
+			return nil
+		}},
+		{
+			version: 2,
+			name:    "two",
+			backup: func(m *migrator, w io.Writer) error {
+				b, err := m.store.Get([]byte("old"))
+				if err != nil {
+					return err
+				}
+				_, err = w.Write(b)
+				return err
+			},
+			migrate: func(m *migrator) error {
+				migrated = append(migrated, 2)
+				return m.store.Set([]byte("old"), []byte("new format"))
+			},
+		},
+	}
+	legacyStore := func() *memoryStore {
+		store := &memoryStore{}
+		store.SetUint64([]byte("state.CurrentTerm"), 3)
+		store.Set([]byte("old"), []byte("old format"))
+		return store
+	}
+	version := func(store Store) uint64 {
+		v, _ := store.GetUint64(keyStorageVersion)
+		return v
+	}
+
+	t.Run("fresh storage", func(t *testing.T) {
+		migrated = nil
+		store := &memoryStore{}
+		m := &migrator{store: store, log: &memoryLog{}, logger: newLogger(), migrations: migrations}
+		err := m.run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(migrated) != 0 || version(store) != 2 {
+			t.Errorf("expect version 2 recorded without migrating but got version %d, migrated %v", version(store), migrated)
+		}
+	})
+
+	t.Run("legacy storage", func(t *testing.T) {
+		migrated = nil
+		dir := t.TempDir()
+		store := legacyStore()
+		m := &migrator{store: store, log: &memoryLog{}, backupDir: dir, logger: newLogger(), migrations: migrations}
+		err := m.run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(migrated) != 2 || version(store) != 2 {
+			t.Errorf("expect migrated to version 2 but got version %d, migrated %v", version(store), migrated)
+		}
+		if b, _ := store.Get([]byte("old")); string(b) != "new format" {
+			t.Errorf("expect new format but got %q", b)
+		}
+		paths, _ := filepath.Glob(filepath.Join(dir, "storage-v1-*.bak"))
+		if len(paths) != 1 {
+			t.Fatalf("expect 1 backup but got %v", paths)
+		}
+		b, _ := os.ReadFile(paths[0])
+		if string(b) != "old format" {
+			t.Errorf("expect backup of old format but got %q", b)
+		}
+
+		// migrations are not rerun
+		err = m.run()
+		if err != nil || len(migrated) != 2 {
+			t.Errorf("expect no migration rerun but got migrated %v, err: %v", migrated, err)
+		}
+	})
+
+	t.Run("backup dir required", func(t *testing.T) {
+		migrated = nil
+		store := legacyStore()
+		m := &migrator{store: store, log: &memoryLog{}, logger: newLogger(), migrations: migrations}
+		err := m.run()
+		if !errors.Is(err, ErrMigrationBackupDirRequired) {
+			t.Errorf("expect %v but got %v", ErrMigrationBackupDirRequired, err)
+		}
+		// the migration before the one requiring backup has been recorded
+		if version(store) != 1 {
+			t.Errorf("expect version 1 but got %d", version(store))
+		}
+		if b, _ := store.Get([]byte("old")); string(b) != "old format" {
+			t.Errorf("expect old format untouched but got %q", b)
+		}
+	})
+
+	t.Run("storage too new", func(t *testing.T) {
+		store := legacyStore()
+		store.SetUint64(keyStorageVersion, 3)
+		m := &migrator{store: store, log: &memoryLog{}, logger: newLogger(), migrations: migrations}
+		err := m.run()
+		if !errors.Is(err, ErrStorageVersionTooNew) {
+			t.Errorf("expect %v but got %v", ErrStorageVersionTooNew, err)
+		}
+	})
+
+	t.Run("new raft records storage version", func(t *testing.T) {
+		store := &memoryStore{}
+		_, err := New("migration", "migration", nil, store, &memoryLog{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version(store) != StorageVersion {
+			t.Errorf("expect version %d but got %d", StorageVersion, version(store))
+		}
+	})
+}
@@ -0,0 +1,321 @@
+package raft
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	ErrGroupExists     = errors.New("err: raft group already exists")
+	ErrGroupNotFound   = errors.New("err: raft group not found")
+	ErrMultiRaftClosed = errors.New("err: multi raft has been closed")
+	ErrNoGroupStorage  = errors.New("err: group storage is required")
+)
+
+// GroupId raft 组 id, 见 MultiRaft
+type GroupId string
+
+// GroupStorage 多个 raft 组共用的存储后端, 为每个组提供独立的 Store 与 Log
+type GroupStorage interface {
+	// Group 返回组 group 的 Store 与 Log
+	// 同一 group 重复调用, 包括进程重启之后, 应返回相同的数据
+	Group(group GroupId) (Store, Log, error)
+}
+
+// GroupStorageFunc 函数形式的 GroupStorage
+type GroupStorageFunc func(group GroupId) (Store, Log, error)
+
+func (f GroupStorageFunc) Group(group GroupId) (Store, Log, error) {
+	return f(group)
+}
+
+// MultiRaft 在一个进程中运行多个独立的 raft 组
+//
+// 分片的数据库每个节点需要运行数百个 raft 组, MultiRaft 使它们共用:
+//   - 一个 RPC, 只监听一个地址, 请求按 Args 中的 Group 路由到对应的组;
+//   - 一个定时器池, 由一个 goroutine 驱动所有组的选举与心跳定时器;
+//   - 一个 GroupStorage, 为每个组提供独立的 Store 与 Log.
+//
+// 本节点在所有组中使用相同的 RaftAddr, 同一个 peer 在不同组中的 RaftId 可以相同.
+//
+//	m, _ := raft.NewMultiRaft(addr, nil, storage)
+//	go m.Run()
+//	r, _ := m.NewGroup("shard-1", id, apply)
+//	go r.Run()
+type MultiRaft struct {
+	addr    RaftAddr
+	rpc     RPC
+	storage GroupStorage
+	tickers *tickerPool
+
+	mux      sync.RWMutex
+	groups   map[GroupId]Raft
+	services map[GroupId]RPCService
+	closed   bool
+}
+
+// NewMultiRaft 创建在 addr 上共用 rpc 的 MultiRaft, rpc 为 nil 时使用默认的 rpc 实现
+func NewMultiRaft(addr RaftAddr, rpc RPC, storage GroupStorage) (*MultiRaft, error) {
+	if storage == nil {
+		return nil, ErrNoGroupStorage
+	}
+	if rpc == nil {
+		rpc = newDefaultRpc()
+	}
+	return &MultiRaft{
+		addr:     addr,
+		rpc:      rpc,
+		storage:  storage,
+		tickers:  newTickerPool(),
+		groups:   make(map[GroupId]Raft),
+		services: make(map[GroupId]RPCService),
+	}, nil
+}
+
+// Run 在 addr 上监听并处理所有组的 rpc 请求, 直到 Close
+func (m *MultiRaft) Run() error {
+	err := m.rpc.Register(&multiRaftService{m: m})
+	if err != nil {
+		return err
+	}
+	err = m.rpc.Listen(string(m.addr))
+	if err != nil {
+		return err
+	}
+	return m.rpc.Serve()
+}
+
+// Close 停止所有组, 关闭 rpc
+func (m *MultiRaft) Close() error {
+	m.mux.Lock()
+	if m.closed {
+		m.mux.Unlock()
+		return nil
+	}
+	m.closed = true
+	groups := make([]Raft, 0, len(m.groups))
+	for _, r := range m.groups {
+		groups = append(groups, r)
+	}
+	m.groups = make(map[GroupId]Raft)
+	m.mux.Unlock()
+
+	for _, r := range groups {
+		r.Stop()
+	}
+	m.tickers.close()
+	return m.rpc.Close()
+}
+
+// NewGroup 创建组 group 中 id 为 id 的 raft 一致性模型, Store 与 Log 由 GroupStorage 提供
+//
+// 返回的 Raft 尚未运行, 可以先调用 BootstrapCluster, 再调用 Run.
+// optFns 中的 WithRPC, WithTLS 与 WithExternalRPCServer 不适用于组.
+func (m *MultiRaft) NewGroup(group GroupId, id RaftId, apply Apply, optFns ...OptFn) (Raft, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.closed {
+		return nil, ErrMultiRaftClosed
+	}
+	if _, ok := m.groups[group]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrGroupExists, group)
+	}
+	store, log, err := m.storage.Group(group)
+	if err != nil {
+		return nil, err
+	}
+	optFns = append(optFns, func(o *opts) {
+		o.rpc = &groupRPC{m: m, group: group, closed: make(chan struct{})}
+		o.externalRPCServer = false
+		o.tickers = m.tickers
+	})
+	r, err := New(id, m.addr, apply, store, log, optFns...)
+	if err != nil {
+		return nil, err
+	}
+	m.groups[group] = r
+	return r, nil
+}
+
+// Group 获取组 group 的 raft 一致性模型
+func (m *MultiRaft) Group(group GroupId) (Raft, bool) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	r, ok := m.groups[group]
+	return r, ok
+}
+
+// Groups 获取所有组的 id
+func (m *MultiRaft) Groups() []GroupId {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	groups := make([]GroupId, 0, len(m.groups))
+	for group := range m.groups {
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// RemoveGroup 停止并移除组 group, 不删除其存储的数据
+func (m *MultiRaft) RemoveGroup(group GroupId) error {
+	m.mux.Lock()
+	r, ok := m.groups[group]
+	delete(m.groups, group)
+	m.mux.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrGroupNotFound, group)
+	}
+	r.Stop()
+	return nil
+}
+
+func (m *MultiRaft) register(group GroupId, service RPCService) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.services[group] = service
+}
+
+func (m *MultiRaft) deregister(group GroupId, service RPCService) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.services[group] == service {
+		delete(m.services, group)
+	}
+}
+
+func (m *MultiRaft) lookup(group GroupId) (RPCService, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	service, ok := m.services[group]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrGroupNotFound, group)
+	}
+	return service, nil
+}
+
+var (
+	_ RPCService        = (*multiRaftService)(nil)
+	_ TimeoutNowService = (*multiRaftService)(nil)
+)
+
+// multiRaftService 按 Args 中的 Group 将请求路由到对应组的 RPCService
+type multiRaftService struct {
+	m *MultiRaft
+}
+
+func (s *multiRaftService) AppendEntries(args AppendEntriesArgs, results *AppendEntriesResults) error {
+	service, err := s.m.lookup(args.Group)
+	if err != nil {
+		return err
+	}
+	return service.AppendEntries(args, results)
+}
+
+func (s *multiRaftService) RequestVote(args RequestVoteArgs, results *RequestVoteResults) error {
+	service, err := s.m.lookup(args.Group)
+	if err != nil {
+		return err
+	}
+	return service.RequestVote(args, results)
+}
+
+func (s *multiRaftService) TimeoutNow(args TimeoutNowArgs, results *TimeoutNowResults) error {
+	service, err := s.m.lookup(args.Group)
+	if err != nil {
+		return err
+	}
+	return ServeTimeoutNow(service, args, results)
+}
+
+func (s *multiRaftService) InstallSnapshot(args InstallSnapshotArgs, results *InstallSnapshotResults) error {
+	service, err := s.m.lookup(args.Group)
+	if err != nil {
+		return err
+	}
+	return service.InstallSnapshot(args, results)
+}
+
+func (s *multiRaftService) PreVote(args PreVoteArgs, results *PreVoteResults) error {
+	service, err := s.m.lookup(args.Group)
+	if err != nil {
+		return err
+	}
+	return service.PreVote(args, results)
+}
+
+var (
+	_ RPC              = (*groupRPC)(nil)
+	_ TimeoutNowCaller = (*groupRPC)(nil)
+)
+
+// groupRPC 组使用的 RPC, 通过 MultiRaft 共用的 RPC 发起调用, 请求带上组的 id
+// 不监听地址, Register 将组的 RPCService 注册到 MultiRaft 的路由中
+type groupRPC struct {
+	m     *MultiRaft
+	group GroupId
+
+	mux     sync.Mutex
+	service RPCService
+
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (r *groupRPC) Listen(addr string) error {
+	return nil
+}
+
+func (r *groupRPC) Serve() error {
+	<-r.closed
+	return nil
+}
+
+func (r *groupRPC) Register(service RPCService) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.service = service
+	r.m.register(r.group, service)
+	return nil
+}
+
+func (r *groupRPC) Close() error {
+	r.once.Do(func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		if r.service != nil {
+			r.m.deregister(r.group, r.service)
+		}
+		close(r.closed)
+	})
+	return nil
+}
+
+func (r *groupRPC) CallAppendEntries(addr RaftAddr, args AppendEntriesArgs) (AppendEntriesResults, error) {
+	args.Group = r.group
+	return r.m.rpc.CallAppendEntries(addr, args)
+}
+
+func (r *groupRPC) CallRequestVote(addr RaftAddr, args RequestVoteArgs) (RequestVoteResults, error) {
+	args.Group = r.group
+	return r.m.rpc.CallRequestVote(addr, args)
+}
+
+func (r *groupRPC) CallTimeoutNow(addr RaftAddr, args TimeoutNowArgs) (TimeoutNowResults, error) {
+	caller, ok := r.m.rpc.(TimeoutNowCaller)
+	if !ok {
+		return TimeoutNowResults{}, ErrTimeoutNowNotSupported
+	}
+	args.Group = r.group
+	return caller.CallTimeoutNow(addr, args)
+}
+
+func (r *groupRPC) CallInstallSnapshot(addr RaftAddr, args InstallSnapshotArgs) (InstallSnapshotResults, error) {
+	args.Group = r.group
+	return r.m.rpc.CallInstallSnapshot(addr, args)
+}
+
+func (r *groupRPC) CallPreVote(addr RaftAddr, args PreVoteArgs) (PreVoteResults, error) {
+	args.Group = r.group
+	return r.m.rpc.CallPreVote(addr, args)
+}
@@ -0,0 +1,182 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryGroupStorage 为每个组提供内存中的 Store 与 Log
+type memoryGroupStorage struct {
+	mux    sync.Mutex
+	stores map[GroupId]*memoryStore
+	logs   map[GroupId]*memoryLog
+}
+
+func (s *memoryGroupStorage) Group(group GroupId) (Store, Log, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.stores == nil {
+		s.stores = make(map[GroupId]*memoryStore)
+		s.logs = make(map[GroupId]*memoryLog)
+	}
+	if _, ok := s.stores[group]; !ok {
+		s.stores[group], s.logs[group] = &memoryStore{}, &memoryLog{}
+	}
+	return s.stores[group], s.logs[group], nil
+}
+
+func TestMultiRaft(t *testing.T) {
+	addrs := []RaftAddr{"multi-1", "multi-2", "multi-3"}
+	ids := []RaftId{"n1", "n2", "n3"}
+	groups := []GroupId{"g1", "g2"}
+	var configuration Configuration
+	for i := range ids {
+		configuration.Peers = append(configuration.Peers, RaftPeer{Id: ids[i], Addr: addrs[i]})
+	}
+
+	var nodes []*MultiRaft
+	fsms := make(map[GroupId]*listFSM)
+	for i, addr := range addrs {
+		m, err := NewMultiRaft(addr, newLoopbackRPC(), &memoryGroupStorage{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer m.Close()
+		go m.Run()
+		nodes = append(nodes, m)
+
+		for _, group := range groups {
+			fsm := &listFSM{}
+			if i == 0 {
+				fsms[group] = fsm
+			}
+			r, err := m.NewGroup(group, ids[i], fsm.apply, WithElection(50*time.Millisecond, 100*time.Millisecond))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if i == 0 {
+				if err := r.BootstrapCluster(configuration); err != nil {
+					t.Fatal(err)
+				}
+			}
+			go r.Run()
+		}
+	}
+
+	t.Run("independent groups", func(t *testing.T) {
+		for _, group := range groups {
+			r, ok := nodes[0].Group(group)
+			if !ok {
+				t.Fatalf("expect group %s", group)
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for !r.IsLeader() {
+				if time.Now().After(deadline) {
+					t.Fatalf("expect the bootstrapped node elected in %s", group)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			if err := r.Handle(context.Background(), Command(group)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, group := range groups {
+			if got, expect := fsms[group].get(), []string{string(group)}; !reflect.DeepEqual(got, expect) {
+				t.Fatalf("expect %v applied in %s but got %v", expect, group, got)
+			}
+			r, _ := nodes[0].Group(group)
+			if peers := r.GetConfiguration().Peers; len(peers) != len(ids) {
+				t.Fatalf("expect %d peers in %s but got %v", len(ids), group, peers)
+			}
+		}
+	})
+
+	t.Run("group exists", func(t *testing.T) {
+		_, err := nodes[0].NewGroup("g1", "n1", nil)
+		if !errors.Is(err, ErrGroupExists) {
+			t.Fatalf("expect %v but got %v", ErrGroupExists, err)
+		}
+	})
+
+	t.Run("remove group", func(t *testing.T) {
+		if err := nodes[2].RemoveGroup("g2"); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := nodes[2].Group("g2"); ok {
+			t.Fatal("expect g2 removed")
+		}
+		deadline := time.Now().Add(time.Second)
+		for {
+			_, err := nodes[0].rpc.CallRequestVote(addrs[2], RequestVoteArgs{Group: "g2"})
+			if errors.Is(err, ErrGroupNotFound) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expect %v but got %v", ErrGroupNotFound, err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err := nodes[2].RemoveGroup("g2"); !errors.Is(err, ErrGroupNotFound) {
+			t.Fatalf("expect %v but got %v", ErrGroupNotFound, err)
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		if err := nodes[1].Close(); err != nil {
+			t.Fatal(err)
+		}
+		_, err := nodes[1].NewGroup(GroupId(fmt.Sprint("g", len(groups)+1)), "n2", nil)
+		if !errors.Is(err, ErrMultiRaftClosed) {
+			t.Fatalf("expect %v but got %v", ErrMultiRaftClosed, err)
+		}
+	})
+}
+
+func TestTickerPool(t *testing.T) {
+	pool := newTickerPool()
+	defer pool.close()
+
+	t.Run("tick", func(t *testing.T) {
+		tk := pool.newTicker(10 * time.Millisecond)
+		defer tk.Stop()
+		for i := 0; i < 3; i++ {
+			select {
+			case <-tk.C:
+			case <-time.After(time.Second):
+				t.Fatalf("expect tick %d", i)
+			}
+		}
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		tk := pool.newTicker(time.Hour)
+		defer tk.Stop()
+		tk.Reset(10 * time.Millisecond)
+		select {
+		case <-tk.C:
+		case <-time.After(time.Second):
+			t.Fatal("expect tick after reset")
+		}
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		tk := pool.newTicker(10 * time.Millisecond)
+		tk.Stop()
+		select {
+		case <-tk.C:
+			t.Fatal("expect no tick after stop")
+		case <-time.After(50 * time.Millisecond):
+		}
+		pool.mux.Lock()
+		n := len(pool.tickers)
+		pool.mux.Unlock()
+		if n != 0 {
+			t.Fatalf("expect stopped tickers removed but got %d", n)
+		}
+	})
+}
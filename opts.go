@@ -1,6 +1,11 @@
 package raft
 
-import "time"
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"time"
+)
 
 // OptFn raft 配置可选项
 type OptFn func(*opts)
@@ -12,6 +17,25 @@ func WithRPC(rpc RPC) OptFn {
 	}
 }
 
+// WithExternalRPCServer Run 不再监听 addr, peer 的 rpc 请求由外部服务器处理
+//
+// 将 Raft.RPCService 挂载到外部服务器上, 见 RPCServer.
+func WithExternalRPCServer() OptFn {
+	return func(o *opts) {
+		o.externalRPCServer = true
+	}
+}
+
+// WithTLS 内置的 tcp rpc 使用 tls 加密 peer 间的通信
+//
+// config 同时用于监听与拨号, 双向认证的配置见 NewMutualTLSConfig.
+// 与 WithRPC 提供的自定义 rpc 一起使用时 New 返回 ErrTLSUnsupportedRPC.
+func WithTLS(config *tls.Config) OptFn {
+	return func(o *opts) {
+		o.tls = config
+	}
+}
+
 // WithElection 提供选举超时范围
 func WithElection(min, max time.Duration) OptFn {
 	if min >= max {
@@ -23,25 +47,449 @@ func WithElection(min, max time.Duration) OptFn {
 	}
 }
 
-// WithLogger
+// WithLogger 输出格式化为一行的日志到 logger
+//
+// Deprecated: 使用 WithSlog
 func WithLogger(logger Logger) OptFn {
+	return func(o *opts) {
+		o.logger = slog.New(&legacyHandler{logger: logger})
+	}
+}
+
+// WithSlog 输出结构化的日志到 logger
+//
+// 每条日志附带 subsystem, id, term 与 state 属性, 默认以文本格式输出所有级别的日志到标准输出.
+func WithSlog(logger *slog.Logger) OptFn {
 	return func(o *opts) {
 		o.logger = logger
 	}
 }
 
+// WithLogLevel 丢弃 subsystem 中低于 level 的日志, 默认为 slog.LevelDebug
+//
+//	raft.WithLogLevel(raft.LogReplication, slog.LevelWarn)
+func WithLogLevel(subsystem LogSubsystem, level slog.Level) OptFn {
+	return func(o *opts) {
+		if o.logLevels == nil {
+			o.logLevels = make(map[LogSubsystem]slog.Level)
+		}
+		o.logLevels[subsystem] = level
+	}
+}
+
 // WithBootstrapAsLeader bootstrap raft consensus module as leader
+// log 为空时以只包含本节点的配置初始化集群, 否则忽略; 以多个节点初始化集群见 BootstrapCluster
 func WithBootstrapAsLeader() OptFn {
 	return func(o *opts) {
 		o.bootstrapAsLeader = true
 	}
 }
 
+// WithProtocolVersion 指定本节点使用的最高协议版本
+//
+// 滚动升级时, 新版本节点先以旧协议版本运行,
+// 所有节点升级完成后再提升协议版本.
+// version 不在 [ProtocolVersionMin, ProtocolVersionMax] 内时 New 返回 ErrUnsupportedProtocolVersion
+func WithProtocolVersion(version ProtocolVersion) OptFn {
+	return func(o *opts) {
+		if version < ProtocolVersionMin || version > ProtocolVersionMax {
+			o.invalid(fmt.Errorf("%w: %d", ErrUnsupportedProtocolVersion, version))
+			return
+		}
+		o.protocolVersion = version
+	}
+}
+
+// WithCompactionHook 注册截断 log 前调用的钩子
+// timeout 为单个钩子的最长执行时间, 超时视为否决此次压缩
+func WithCompactionHook(hook CompactionHook, timeout time.Duration) OptFn {
+	return func(o *opts) {
+		o.compactionHooks = append(o.compactionHooks, hook)
+		if timeout > 0 {
+			o.compactionHookTimeout = timeout
+		}
+	}
+}
+
+// WithLogRetention 快照之后仍保留最新的 entries 个 log entry,
+// 以及 age 之内追加的 log entry, 0 表示不按该条件保留
+//
+// 稍微落后的 Follower 可以通过日志复制追上, 无需安装快照.
+func WithLogRetention(entries uint64, age time.Duration) OptFn {
+	return func(o *opts) {
+		o.retention = logRetention{entries: entries, age: age}
+	}
+}
+
+// WithSnapshot 使用 snapshotter 为状态机创建快照, 快照保存在 store 中
+// store 为 nil 时快照只保存在内存中
+//
+// 落后太多, 所需 log entry 已被压缩的 Follower 通过 InstallSnapshot 追上 Leader.
+func WithSnapshot(snapshotter Snapshotter, store SnapshotStore) OptFn {
+	if store == nil {
+		store = NewMemorySnapshotStore(defaultSnapshotRetain)
+	}
+	return func(o *opts) {
+		o.snapshotter = snapshotter
+		o.snapshotStore = store
+	}
+}
+
+// WithSnapshotPolicy 在后台自动创建快照并压缩 log:
+// 距上一次快照应用了 entries 个 log entry, 或距上一次自动快照经过 interval 且有新应用的 log entry 时创建,
+// 0 表示不按该条件创建. 需同时配置 WithSnapshot 或 WithFSM
+//
+// 应用 command 不等待快照完成, 快照期间达到阈值的多次通知合并为一次快照.
+//
+//	raft.WithSnapshotPolicy(10000, 30*time.Minute)
+func WithSnapshotPolicy(entries uint64, interval time.Duration) OptFn {
+	return func(o *opts) {
+		o.snapshotThreshold = entries
+		o.snapshotInterval = interval
+	}
+}
+
+// WithSnapshotEncryption 使用 provider 提供的密钥加密快照, 见 EncryptSnapshot
+// 集群中所有节点须能通过 provider 获取相同的密钥
+func WithSnapshotEncryption(provider KeyProvider) OptFn {
+	return func(o *opts) {
+		o.snapshotKeys = provider
+	}
+}
+
+// WithSnapshotFSMFactory factory 创建空的状态机实例, OpenSnapshotFSM 将历史快照恢复到其中
+//
+// 配合保留多个快照的 SnapshotStore, 可以查看状态机在历史某个索引处的状态.
+func WithSnapshotFSMFactory(factory func() Snapshotter) OptFn {
+	return func(o *opts) {
+		o.newSnapshotFSM = factory
+	}
+}
+
+// WithHeartbeatExtension 在心跳中附加应用数据
+// provider 在 Leader 发送心跳时调用, consumer 在 Follower 收到心跳时调用
+func WithHeartbeatExtension(provider HeartbeatExtensionProvider, consumer HeartbeatExtensionConsumer) OptFn {
+	return func(o *opts) {
+		o.heartbeatExtensionProvider = provider
+		o.heartbeatExtensionConsumer = consumer
+	}
+}
+
+// WithResolver 使用 resolver 解析 peer 的 rpc 通信地址
+func WithResolver(resolver Resolver) OptFn {
+	return func(o *opts) {
+		o.resolver = resolver
+	}
+}
+
+// WithRegistrar 在外部服务目录中登记 Leader 的地址
+func WithRegistrar(registrar Registrar) OptFn {
+	return func(o *opts) {
+		o.registrar = registrar
+	}
+}
+
+// WithMembershipPolicy Leader 接受成员变更之前由 policy 检查, 拒绝违反部署约束的变更
+func WithMembershipPolicy(policy MembershipPolicy) OptFn {
+	return func(o *opts) {
+		o.membershipPolicy = policy
+	}
+}
+
+// WithPressureProbe 资源压力感知: 持续处于压力之下超过 sustained 的节点
+// 放弃竞选 Leader, 若已是 Leader 则主动将 leadership 转移给最健康的 peer
+func WithPressureProbe(probe PressureProbe, sustained time.Duration) OptFn {
+	return func(o *opts) {
+		o.pressureProbe = probe
+		o.pressureSustained = sustained
+	}
+}
+
+// WithMaxLogDivergence 日志落后于已知 commitIndex 超过 n 个 entry 的节点放弃竞选
+//
+// 已知 commitIndex 来自 Leader 的 AppendEntries 以及 voter 对 RequestVote 的响应,
+// 避免勉强当选的节点迫使其他节点截断大量 log entry. 0 表示不限制.
+func WithMaxLogDivergence(n uint64) OptFn {
+	return func(o *opts) {
+		o.maxLogDivergence = n
+	}
+}
+
+// WithObserver 接收 raft 一致性模型发出的事件
+func WithObserver(observer Observer) OptFn {
+	return func(o *opts) {
+		o.observers = append(o.observers, observer)
+	}
+}
+
+// WithPreVote 选举前先进行 pre-vote, 只有能获得多数投票时才递增 term 发起选举
+//
+// 防止被分区的节点不断递增 term, 在重新加入集群时迫使现任 Leader 退位.
+// 需要所有节点都支持 ProtocolVersion4, 滚动升级完成后再启用.
+func WithPreVote() OptFn {
+	return func(o *opts) {
+		o.preVote = true
+	}
+}
+
+// WithCampaignStrategy 连续竞选失败后由 strategy 决定选举超时区间与是否推迟竞选
+//
+//	raft.WithCampaignStrategy(raft.WidenElectionTimeout(100*time.Millisecond, time.Second))
+func WithCampaignStrategy(strategy CampaignStrategy) OptFn {
+	return func(o *opts) {
+		o.campaignStrategy = strategy
+	}
+}
+
+// WithElectionCooldown 竞选失败后, 至少等待 cooldown 才再次竞选
+//
+// 已被移出集群但尚未得知的节点会不断发起选举, 冷却时间降低其对集群的干扰.
+// cooldown 应大于选举超时, 否则没有效果.
+func WithElectionCooldown(cooldown time.Duration) OptFn {
+	return func(o *opts) {
+		o.electionCooldown = cooldown
+	}
+}
+
+// WithAdaptiveHeartbeat Leader 根据日志复制的流量调整心跳间隔
+//
+// 持续复制时逐步拉长心跳间隔, 最多到选举超时下界的 3/4, 空闲时恢复默认间隔,
+// 降低大集群稳定运行时的网络开销.
+func WithAdaptiveHeartbeat() OptFn {
+	return func(o *opts) {
+		o.adaptiveHeartbeat = true
+	}
+}
+
+// WithPipeline 以流水线方式复制日志, 每个 peer 最多有 window 个进行中的 AppendEntries
+//
+// 不等待响应连续发送 AppendEntries, 适用于 RTT 较大的跨地域部署.
+// 失败时退回逐个等待响应的模式, window 不大于 1 时不启用.
+func WithPipeline(window int) OptFn {
+	return func(o *opts) {
+		o.pipelineWindow = window
+	}
+}
+
+// WithDedupWindow 应用 log entry 时跳过幂等键在最近 window 个 log entry 中出现过的 command
+//
+// 为无法使用客户端会话的状态机提供尽力而为的去重, 幂等键见 WithIdempotencyKey.
+// 跳过的次数见 MetricApplyDeduplicated.
+func WithDedupWindow(window uint64) OptFn {
+	return func(o *opts) {
+		o.dedupWindow = window
+	}
+}
+
+// WithProposalBatching 合并并发的 Handle, 一次 Append 与一轮复制提交多个 command
+//
+// 第一个 command 到达后最多等待 maxDelay, 或直到累积 maxSize 个 command.
+// 高并发时大幅提升吞吐, 代价是每个 command 至多增加 maxDelay 的延迟.
+// maxSize 不大于 1 时不启用.
+func WithProposalBatching(maxSize int, maxDelay time.Duration) OptFn {
+	return func(o *opts) {
+		o.batchSize = maxSize
+		o.batchDelay = maxDelay
+	}
+}
+
+// WithStorageBenchmark 启动时在 Log 末尾追加并截断 samples 个 log entry, 测量追加(含 fsync)耗时
+//
+// 未通过 WithProposalBatching 配置时, 磁盘较慢则自动启用 proposal 合并;
+// 耗时相对选举超时过长时发出 EventSlowStorage 事件, 避免集群因磁盘过慢而反复选举.
+// samples 为 0 时不测量.
+func WithStorageBenchmark(samples int) OptFn {
+	return func(o *opts) {
+		o.storageBenchmark = samples
+	}
+}
+
+// WithCommitLatencySLO 声明 commit 延迟的 SLO, 跟踪错误预算的燃烧率
+//
+// 燃烧率越过阈值时发出 EventSLOBurnRate 事件, 运维可据此自动缓解,
+// 如转移 Leader. Threshold 不大于 0, 或 Objective 不在 (0, 1) 之间时不启用.
+//
+//	raft.WithCommitLatencySLO(raft.CommitLatencySLO{Threshold: 50 * time.Millisecond, Objective: 0.99})
+func WithCommitLatencySLO(slo CommitLatencySLO) OptFn {
+	return func(o *opts) {
+		o.commitLatencySLO = slo
+	}
+}
+
+// WithBandwidthBudget 限制 Leader 发往每个 peer 与所有 peer 的日志复制与快照流量, 单位为字节每秒
+//
+// 使 raft 的流量低于共享链路的容量, 0 表示不限制. 心跳不计入预算.
+func WithBandwidthBudget(perPeer, global int64) OptFn {
+	return func(o *opts) {
+		o.peerBandwidth = perPeer
+		o.globalBandwidth = global
+	}
+}
+
+// WithMaxAppendEntries 单个 AppendEntries 最多携带 n 个 log entry, 默认为 64, 0 表示不限制
+//
+// 落后很多的 peer 分多次追赶, 每次只读取并发送一批 log entry.
+func WithMaxAppendEntries(n int) OptFn {
+	return func(o *opts) {
+		o.maxAppendEntries = n
+	}
+}
+
+// WithMaxAppendBytes 单个 AppendEntries 携带的 command 最多 n 字节, 默认为 1MiB, 0 表示不限制
+// 单个 command 超过 n 字节时单独发送
+func WithMaxAppendBytes(n int) OptFn {
+	return func(o *opts) {
+		o.maxAppendBytes = n
+	}
+}
+
+// WithStartupProbe 启动时向 peer 查询日志状态, 本节点的日志与集群分叉时发出 EventLogDiverged 事件
+//
+// 最多等待 timeout, 探测完成之前拒绝读请求.
+func WithStartupProbe(timeout time.Duration) OptFn {
+	return func(o *opts) {
+		o.startupProbe = timeout
+	}
+}
+
+// WithQuorumLossTimeout Leader 与多数节点失去联系超过 timeout 时发出 EventQuorumLost,
+// 并使提案立即返回 ErrNoQuorum, 而不是等到提案的超时; 恢复联系后发出 EventQuorumRestored
+//
+// 在每次心跳时检测, timeout 应小于选举超时上界, 否则 Leader 已先行退位. 为 0 时不检测.
+func WithQuorumLossTimeout(timeout time.Duration) OptFn {
+	return func(o *opts) {
+		o.quorumLossTimeout = timeout
+	}
+}
+
+// WithLeaderLease 启用 LeaseRead, maxClockDrift 为节点间时钟漂移的上限
+//
+// 租约期为最小选举超时减去 maxClockDrift, maxClockDrift 不小于最小选举超时时
+// 租约总是过期.
+func WithLeaderLease(maxClockDrift time.Duration) OptFn {
+	if maxClockDrift < 0 {
+		panic("leader lease's max clock drift must not be negative")
+	}
+	return func(o *opts) {
+		o.leaseDrift = maxClockDrift
+	}
+}
+
+// WithPreApplyHook 在 log entry commit 之后, 应用到状态机之前调用 hook, 见 PreApplyHook
+func WithPreApplyHook(hook PreApplyHook) OptFn {
+	return func(o *opts) {
+		o.preApplyHook = hook
+	}
+}
+
+// WithUnknownEntryPolicy 应用没有 LogEntryHandler 的未知类型 log entry 时的行为
+// 默认为 UnknownEntrySkip
+func WithUnknownEntryPolicy(policy UnknownEntryPolicy) OptFn {
+	return func(o *opts) {
+		o.unknownEntryPolicy = policy
+	}
+}
+
+// WithLogEntryHandler 使用 handler 应用 typ 类型的 log entry
+//
+// 用于在旧版本节点上处理新版本增加的 log entry 类型, 不能覆盖本版本已知的类型,
+// typ 为已知类型时 New 返回 ErrKnownLogEntryType.
+func WithLogEntryHandler(typ LogEntryType, handler LogEntryHandler) OptFn {
+	return func(o *opts) {
+		if typ.known() {
+			o.invalid(fmt.Errorf("%w: %d", ErrKnownLogEntryType, typ))
+			return
+		}
+		if o.entryHandlers == nil {
+			o.entryHandlers = make(map[LogEntryType]LogEntryHandler)
+		}
+		o.entryHandlers[typ] = handler
+	}
+}
+
+// WithApplyWatchdog 监控每批 command 应用到状态机的时间
+//
+// 超过 deadline 时发出 EventSlowApply, 携带该批 log entry 的区间;
+// split 为 true 时, 之后的批次减半, 逐步缩小问题 command 所在的区间,
+// 批次恢复正常后再逐步增大.
+func WithApplyWatchdog(deadline time.Duration, split bool) OptFn {
+	return func(o *opts) {
+		o.applyDeadline = deadline
+		o.applySplit = split
+	}
+}
+
+// WithMetrics 将指标发送到 sink
+func WithMetrics(sink MetricsSink) OptFn {
+	return func(o *opts) {
+		o.metrics = sink
+	}
+}
+
+// WithTracer 为 Leader 的每次 AppendEntries 调用创建 trace span
+//
+// 耗时达到 slow 的调用, 其 trace 作为 exemplar 附加到 MetricAppendEntriesDuration 上,
+// 需要 MetricsSink 实现 ExemplarSink.
+func WithTracer(tracer Tracer, slow time.Duration) OptFn {
+	return func(o *opts) {
+		o.tracer = tracer
+		o.slowAppendEntries = slow
+	}
+}
+
+// WithWriteTracer 跟踪每次写入从 Handle 到应用到状态机的各个阶段, 见 WriteTracer
+func WithWriteTracer(tracer WriteTracer) OptFn {
+	return func(o *opts) {
+		o.writeTracer = tracer
+	}
+}
+
+// WithMigrationBackupDir 启动时升级存储格式前, 将旧格式数据备份到 dir
+//
+// 需要备份的升级在未指定 dir 时返回 ErrMigrationBackupDirRequired, 节点不会启动.
+func WithMigrationBackupDir(dir string) OptFn {
+	return func(o *opts) {
+		o.migrationBackupDir = dir
+	}
+}
+
+// WithDevMode 开发模式: 方便在单元测试或演示中使用
+//
+// store 与 log 为 nil 时使用内存实现, 使用进程内的 loopback rpc,
+// 以单节点集群启动(New 返回时即为 Leader), 并输出详细日志.
+//
+//	r, _ := raft.New("dev", "dev", apply, nil, nil, raft.WithDevMode())
+//	go r.Run()
+//	err := r.Handle(ctx, cmd)
+func WithDevMode() OptFn {
+	return func(o *opts) {
+		o.devMode = true
+		o.rpc = newLoopbackRPC()
+		o.bootstrapAsLeader = true
+		o.election = [2]time.Duration{50 * time.Millisecond, 100 * time.Millisecond}
+	}
+}
+
 func newOpts() *opts {
 	return &opts{
 		rpc:      newDefaultRpc(),
 		election: [2]time.Duration{300 * time.Millisecond, 500 * time.Millisecond},
 		logger:   newLogger(),
+
+		protocolVersion: ProtocolVersionMax,
+
+		compactionHookTimeout: defaultCompactionHookTimeout,
+
+		maxAppendEntries: defaultMaxAppendEntries,
+		maxAppendBytes:   defaultMaxAppendBytes,
+
+		// lease reads are disabled by default
+		leaseDrift: -1,
+
+		metrics: noopMetricsSink{},
+		tracer:  noopTracer{},
+
+		writeTracer: noopWriteTracer{},
 	}
 }
 
@@ -49,10 +497,124 @@ func newOpts() *opts {
 type opts struct {
 	// rpc
 	rpc RPC
+	// externalRPCServer peer rpc requests are served by external server
+	externalRPCServer bool
+	// tickers shared by raft groups of a MultiRaft
+	tickers *tickerPool
+	// random source of election timeouts, nil for math/rand
+	random func(n int64) int64
+	// tls encrypt built-in tcp rpc
+	tls *tls.Config
 	// election timeout duration
 	election [2]time.Duration
 	// bootsTrapAsLeader wether or not bootstrap as leader
 	bootstrapAsLeader bool
+	// devMode wether or not run in development mode
+	devMode bool
+	// protocolVersion highest protocol version
+	protocolVersion ProtocolVersion
+
+	// compactionHooks hooks called before log compaction
+	compactionHooks       []CompactionHook
+	compactionHookTimeout time.Duration
+	// retention entries retained beyond snapshots
+	retention logRetention
+
+	// snapshotter state machine snapshot
+	snapshotter Snapshotter
+	// apply 取代 New 的 apply 参数, 见 WithFSM
+	apply         Apply
+	snapshotStore SnapshotStore
+	// snapshotKeys encrypt snapshots if not nil
+	snapshotKeys KeyProvider
+	// newSnapshotFSM create throwaway state machine to inspect snapshots
+	newSnapshotFSM func() Snapshotter
+	// snapshotThreshold, snapshotInterval create snapshots automatically
+	snapshotThreshold uint64
+	snapshotInterval  time.Duration
+
+	// heartbeat extension payload
+	heartbeatExtensionProvider HeartbeatExtensionProvider
+	heartbeatExtensionConsumer HeartbeatExtensionConsumer
 
-	logger Logger
+	// resolver resolve peer's rpc address
+	resolver Resolver
+
+	// registrar register leader's address in external service catalog
+	registrar Registrar
+	// membershipPolicy authorize membership changes, nil if all changes are allowed
+	membershipPolicy MembershipPolicy
+
+	// pressure probe resource pressure
+	pressureProbe     PressureProbe
+	pressureSustained time.Duration
+
+	// maxLogDivergence 日志最多落后已知 commitIndex 的 entry 数量
+	maxLogDivergence uint64
+
+	// observers receive events
+	observers []Observer
+	// preVote run pre-vote before election
+	preVote bool
+	// electionCooldown wait before campaigning again after losing an election
+	electionCooldown time.Duration
+	// campaignStrategy decide when to campaign again after losing elections
+	campaignStrategy CampaignStrategy
+	// startupProbe timeout of probing peers' log on start, 0 if disabled
+	startupProbe time.Duration
+	// adaptiveHeartbeat adjust heartbeat interval to replication traffic
+	adaptiveHeartbeat bool
+	// pipelineWindow max in-flight AppendEntries per peer, pipelining is disabled if not greater than 1
+	pipelineWindow int
+	// maxAppendEntries, maxAppendBytes limit entries and command bytes of an AppendEntries, 0 if unlimited
+	maxAppendEntries int
+	maxAppendBytes   int
+	// dedupWindow entries within which idempotency keys are remembered, 0 if disabled
+	dedupWindow uint64
+	// batchSize, batchDelay coalesce concurrent proposals, disabled if batchSize is not greater than 1
+	batchSize  int
+	batchDelay time.Duration
+	// commitLatencySLO declared commit latency SLO
+	commitLatencySLO CommitLatencySLO
+	// storageBenchmark entries appended to benchmark the log on start, 0 if disabled
+	storageBenchmark int
+	// peerBandwidth, globalBandwidth outbound bytes per second, 0 if unlimited
+	peerBandwidth   int64
+	globalBandwidth int64
+	// leaseDrift clock drift bound of leader lease, negative if lease reads are disabled
+	leaseDrift time.Duration
+	// quorumLossTimeout reject proposals after losing contact with a majority this long, 0 if disabled
+	quorumLossTimeout time.Duration
+	// preApplyHook hook called before applying
+	preApplyHook PreApplyHook
+	// unknown log entry types
+	unknownEntryPolicy UnknownEntryPolicy
+	entryHandlers      map[LogEntryType]LogEntryHandler
+	// apply watchdog
+	applyDeadline time.Duration
+	applySplit    bool
+
+	// metrics sink
+	metrics MetricsSink
+	// tracer AppendEntries tracer, slowAppendEntries 附加 exemplar 的耗时阈值
+	tracer            Tracer
+	slowAppendEntries time.Duration
+	writeTracer       WriteTracer
+
+	// migrationBackupDir 存储格式升级前备份旧格式数据的目录
+	migrationBackupDir string
+
+	logger *slog.Logger
+	// logLevels 各子系统的日志级别
+	logLevels map[LogSubsystem]slog.Level
+
+	// err 第一个无效的选项, 由 New 返回
+	err error
+}
+
+// invalid 记录无效的选项, 只保留第一个
+func (o *opts) invalid(err error) {
+	if o.err == nil {
+		o.err = err
+	}
 }
@@ -0,0 +1,128 @@
+package raft
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// pipeline 不等待响应, 连续向 peer 发送 AppendEntries
+//
+// 逐个等待响应时复制的吞吐受限于 1/RTT. 流水线模式下最多有 window 个进行中的
+// AppendEntries; 任一 AppendEntries 失败或被拒绝时退回逐个等待响应的模式,
+// 由 replicate 修正 nextIndex, 再次追上 Leader 后恢复流水线.
+// follower 会忽略乱序到达的已覆盖的 AppendEntries, 见 appendAcks.
+type pipeline struct {
+	// window 进行中的 AppendEntries, 容量为最大数量
+	window chan struct{}
+	wg     sync.WaitGroup
+	// next 下一个待发送的 log entry index, 只在 replicator 的 goroutine 中读写
+	next uint64
+	// failed 是否有 AppendEntries 失败或被拒绝
+	failed int32
+}
+
+func (p *pipeline) hasFailed() bool {
+	return atomic.LoadInt32(&p.failed) != 0
+}
+
+// startPipeline peer 已追上 Leader, 启用流水线
+func (l *leader) startPipeline(r *replicator, peer RaftPeer) {
+	if l.pipelineWindow <= 1 {
+		return
+	}
+	nextIndex, _ := l.nextIndex.Load(peer.Id)
+	r.pipeline = &pipeline{
+		window: make(chan struct{}, l.pipelineWindow),
+		next:   nextIndex,
+	}
+}
+
+// stopPipeline 等待进行中的 AppendEntries 结束, 退回逐个等待响应的模式
+func (l *leader) stopPipeline(r *replicator, peer RaftPeer) {
+	r.pipeline.wg.Wait()
+	r.pipeline = nil
+	l.metrics.IncrCounter(MetricPipelineFallbacks, 1, Label{Name: LabelPeer, Value: string(peer.Id)})
+}
+
+// pipelineReplicate 以流水线方式发送所有尚未发送的 log entry
+// 需要退回逐个等待响应的模式时返回 false
+func (l *leader) pipelineReplicate(r *replicator, peer RaftPeer) bool {
+	p := r.pipeline
+	for {
+		if p.hasFailed() {
+			return false
+		}
+		lastLogIndex, lastLogTerm, err := l.Last()
+		if err != nil {
+			return false
+		}
+		// entries of previous terms are not replicated alone, see replicate
+		if lastLogTerm != l.GetCurrentTerm() {
+			return false
+		}
+		if p.next > lastLogIndex {
+			return true
+		}
+		// log entries needed by peer have been compacted
+		firstIndex, err := l.FirstIndex()
+		if err != nil || p.next < firstIndex {
+			return false
+		}
+
+		select {
+		case <-r.stop:
+			return true
+		case p.window <- struct{}{}:
+		}
+		args, err := l.pipelineArgs(p.next, lastLogIndex)
+		if err != nil || p.hasFailed() {
+			<-p.window
+			return false
+		}
+		p.next = args.PrevLogIndex + uint64(len(args.Entries)) + 1
+
+		p.wg.Add(1)
+		atomic.AddInt32(&r.inflight, 1)
+		go func() {
+			defer func() {
+				atomic.AddInt32(&r.inflight, -1)
+				<-p.window
+				p.wg.Done()
+			}()
+			results, err := l.callAppendEntries(peer.Id, peer.Addr, args)
+			if err != nil || !results.Success {
+				atomic.StoreInt32(&p.failed, 1)
+				// wake the replicator to fall back
+				select {
+				case r.notify <- struct{}{}:
+				default:
+				}
+				return
+			}
+			l.acknowledge(peer.Id, args, results, lastLogIndex)
+			l.pacer.observeReplication()
+			l.replicators.progressed()
+		}()
+	}
+}
+
+// pipelineArgs 携带从索引 next 开始至多到 last 的 log entry 的 AppendEntries 参数
+// 每次携带的数量受 WithMaxAppendEntries 与 WithMaxAppendBytes 限制
+func (l *leader) pipelineArgs(next, last uint64) (AppendEntriesArgs, error) {
+	prevLogIndex := next - 1
+	prevLogTerm, entries, err := l.readEntries(prevLogIndex, l.appendEnd(prevLogIndex, last))
+	if err != nil {
+		return AppendEntriesArgs{}, err
+	}
+	entries = l.limitAppendBytes(entries)
+	return AppendEntriesArgs{
+		Term:           l.GetCurrentTerm(),
+		LeaderId:       l.Id(),
+		LeaderAddr:     l.Addr(),
+		PrevLogIndex:   prevLogIndex,
+		PrevLogTerm:    prevLogTerm,
+		Entries:        entries,
+		LeaderCommit:   l.GetCommitIndex(),
+		TransferTarget: l.getTransferTarget(),
+	}, nil
+}
@@ -0,0 +1,89 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyRPC 在 fail 非 0 时使下一个携带 log entry 的 AppendEntries 失败
+type flakyRPC struct {
+	*slowRPC
+	fail int32
+}
+
+func (r *flakyRPC) CallAppendEntries(addr RaftAddr, args AppendEntriesArgs) (AppendEntriesResults, error) {
+	if len(args.Entries) > 0 && atomic.CompareAndSwapInt32(&r.fail, 1, 0) {
+		return AppendEntriesResults{}, errors.New("flaky")
+	}
+	return r.slowRPC.CallAppendEntries(addr, args)
+}
+
+func TestPipeline(t *testing.T) {
+	rpc := &flakyRPC{slowRPC: &slowRPC{loopbackRPC: newLoopbackRPC(), delay: 20 * time.Millisecond}}
+	fsm := &listFSM{}
+	metrics := &countingSink{}
+	leader, err := New("pipeline-leader", "pipeline-leader", fsm.apply, nil, nil,
+		WithDevMode(), WithRPC(rpc), WithPipeline(4), WithMetrics(metrics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leader.Stop()
+	go leader.Run()
+
+	follower := runLoopbackFollower(t, "pipeline-follower")
+	defer follower.Stop()
+	ctx := context.Background()
+	if err := leader.AddVoter(ctx, follower.Id(), follower.Addr()); err != nil {
+		t.Fatal(err)
+	}
+
+	// proposals arrive while previous AppendEntries are in flight
+	propose := func(t *testing.T, n int) {
+		t.Helper()
+		var wg sync.WaitGroup
+		errs := make(chan error, n)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+				defer cancel()
+				errs <- leader.Handle(ctx, Command("c"))
+			}()
+			time.Sleep(2 * time.Millisecond)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	t.Run("window", func(t *testing.T) {
+		atomic.StoreInt32(&rpc.maxInflight, 0)
+		propose(t, 20)
+		if got := len(fsm.get()); got != 20 {
+			t.Errorf("expect 20 commands applied but got %d", got)
+		}
+		max := atomic.LoadInt32(&rpc.maxInflight)
+		if max <= 1 || max > 4 {
+			t.Errorf("expect 2 to 4 in-flight AppendEntries to the follower but got %d", max)
+		}
+	})
+	t.Run("fallback", func(t *testing.T) {
+		atomic.StoreInt32(&rpc.fail, 1)
+		propose(t, 10)
+		if got := len(fsm.get()); got != 30 {
+			t.Errorf("expect 30 commands applied but got %d", got)
+		}
+		if got := metrics.counter(MetricPipelineFallbacks); got < 1 {
+			t.Errorf("expect pipeline to fall back but got %v fallbacks", got)
+		}
+	})
+}
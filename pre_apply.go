@@ -0,0 +1,86 @@
+package raft
+
+// PreApplyHook 在 log entry commit 之后, 应用到状态机之前调用
+//
+// 在独立的 goroutine 中执行, 与应用较早 log entry 的 Apply 并发,
+// 用于预取数据或预热缓存, 使对延迟敏感的状态机可以提前准备.
+//
+// 钩子不能修改状态机, 也不能假设状态机的进度: 调用时状态机可能还没应用更早的 log entry,
+// 也可能已经应用了这批 log entry; 落后太多时部分 log entry 可能不会经过钩子.
+// 钩子 panic 会被恢复并记录, 不影响应用.
+type PreApplyHook func(commands Commands)
+
+// preApply 调用 PreApplyHook 的 worker
+type preApply struct {
+	hook PreApplyHook
+	// notify 通知 commitIndex 更新, 容量为 1, 多次通知会合并
+	notify chan struct{}
+	// prepared 已经过钩子的最大索引, 只由 worker 访问
+	prepared uint64
+}
+
+func (p *preApply) enabled() bool {
+	return p.hook != nil
+}
+
+// notifyPreApply 通知 pre-apply worker commitIndex 已更新
+func (r *raft) notifyPreApply() {
+	if !r.preApply.enabled() {
+		return
+	}
+	select {
+	case r.preApply.notify <- struct{}{}:
+	default:
+		// a wakeup is already pending
+	}
+}
+
+func (r *raft) loopPreApply() {
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-r.preApply.notify:
+			// no-op
+		}
+		err := r.runPreApply()
+		if err != nil {
+			r.log(LogApply).Error("Pre-apply commands", "err", err)
+		}
+	}
+}
+
+// runPreApply 将已 commit 且还没经过钩子的 command 交给钩子
+// 已应用的 log entry 不再经过钩子
+func (r *raft) runPreApply() error {
+	commitIndex := r.GetCommitIndex()
+	from := r.preApply.prepared
+	if lastApplied := r.GetLastApplied(); lastApplied > from {
+		from = lastApplied
+	}
+	if commitIndex <= from {
+		return nil
+	}
+	entries, err := r.RangeGet(from, commitIndex)
+	if err != nil {
+		return err
+	}
+	r.preApply.prepared = commitIndex
+	commands := newCommands(entries)
+	if len(commands.Data()) == 0 {
+		return nil
+	}
+	r.callPreApplyHook(commands)
+	return nil
+}
+
+// callPreApplyHook 调用钩子, 恢复钩子的 panic
+func (r *raft) callPreApplyHook(commands Commands) {
+	defer func() {
+		if p := recover(); p != nil {
+			r.metrics.IncrCounter(MetricPreApplyPanics, 1)
+			r.log(LogApply).Error("Pre-apply hook panicked", "panic", p)
+		}
+	}()
+	r.preApply.hook(commands)
+}
@@ -0,0 +1,81 @@
+package raft
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPreApply(t *testing.T) {
+	var prepared []string
+	sink := &countingSink{}
+	fsm := &listFSM{}
+	r, err := New("pre-apply", "pre-apply", fsm.apply, &memoryStore{}, &memoryLog{},
+		WithMetrics(sink), WithPreApplyHook(func(commands Commands) {
+			for _, command := range commands.Data() {
+				if string(command) == "panic" {
+					panic("bad command")
+				}
+				prepared = append(prepared, string(command))
+			}
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raft := r.(*raft)
+	err = raft.Append(
+		LogEntry{Term: 1, Command: Command("a")},
+		LogEntry{Term: 1, Type: logEntryTypeNoop},
+		LogEntry{Term: 1, Command: Command("b")},
+		LogEntry{Term: 1, Command: Command("panic")},
+		LogEntry{Term: 1, Command: Command("c")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("before apply", func(t *testing.T) {
+		raft.SetCommitIndex(3)
+		err := raft.runPreApply()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(prepared, []string{"a", "b"}) {
+			t.Errorf("expect prepared [a b] but got %v", prepared)
+		}
+		if applied := fsm.get(); len(applied) != 0 {
+			t.Errorf("expect nothing applied but got %v", applied)
+		}
+		// entries are prepared only once
+		err = raft.runPreApply()
+		if err != nil || len(prepared) != 2 {
+			t.Errorf("expect prepared once but got %v, err: %v", prepared, err)
+		}
+	})
+
+	t.Run("panic isolated", func(t *testing.T) {
+		raft.SetCommitIndex(4)
+		err := raft.runPreApply()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sink.counter(MetricPreApplyPanics) != 1 {
+			t.Errorf("expect 1 panic recorded but got %v", sink.counter(MetricPreApplyPanics))
+		}
+		err = raft.applyCommitted()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if applied := fsm.get(); !reflect.DeepEqual(applied, []string{"a", "b", "panic"}) {
+			t.Errorf("expect applied [a b panic] but got %v", applied)
+		}
+	})
+
+	t.Run("skip applied", func(t *testing.T) {
+		raft.SetCommitIndex(5)
+		raft.SetLastApplied(5)
+		err := raft.runPreApply()
+		if err != nil || len(prepared) != 2 {
+			t.Errorf("expect applied entries skipped but got %v, err: %v", prepared, err)
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package raft
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PressureProbe 探测本节点的资源压力(如 CPU, 磁盘 IO), 返回是否处于压力之下
+type PressureProbe func() (underPressure bool)
+
+// maxPressureDeclines 处于压力下的节点最多连续放弃竞选的次数
+// 超过后仍然发起选举, 避免所有节点都处于压力下时集群没有 Leader
+const maxPressureDeclines = 3
+
+// pressureTracker 记录本节点及 peer 的资源压力
+type pressureTracker struct {
+	probe PressureProbe
+	// sustained 压力持续超过该时间才视为处于压力之下
+	sustained time.Duration
+
+	// since 开始处于压力之下的时间(unix nano), 0 表示没有压力
+	since int64
+	// declines 连续放弃竞选的次数
+	declines int32
+
+	// peers peer 通告的压力状态, RaftId -> bool
+	peers sync.Map
+}
+
+func (p *pressureTracker) enabled() bool {
+	return p.probe != nil
+}
+
+// sample 调用 probe 采样一次
+func (p *pressureTracker) sample() {
+	if !p.probe() {
+		atomic.StoreInt64(&p.since, 0)
+		return
+	}
+	atomic.CompareAndSwapInt64(&p.since, 0, time.Now().UnixNano())
+}
+
+// underPressure 是否持续处于压力之下
+func (p *pressureTracker) underPressure() bool {
+	if !p.enabled() {
+		return false
+	}
+	since := atomic.LoadInt64(&p.since)
+	return since != 0 && time.Since(time.Unix(0, since)) >= p.sustained
+}
+
+// declineCampaign 是否放弃此次竞选
+func (p *pressureTracker) declineCampaign() bool {
+	if !p.underPressure() || atomic.LoadInt32(&p.declines) >= maxPressureDeclines {
+		atomic.StoreInt32(&p.declines, 0)
+		return false
+	}
+	atomic.AddInt32(&p.declines, 1)
+	return true
+}
+
+func (p *pressureTracker) observePeer(id RaftId, underPressure bool) {
+	if !p.enabled() {
+		return
+	}
+	p.peers.Store(id, underPressure)
+}
+
+func (p *pressureTracker) peerUnderPressure(id RaftId) bool {
+	v, ok := p.peers.Load(id)
+	return ok && v.(bool)
+}
+
+// loopSamplePressure 每个心跳间隔采样一次资源压力
+func (r *raft) loopSamplePressure() {
+	ticker := time.NewTicker(r.heartbeatTimeout())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			r.pressure.sample()
+		}
+	}
+}
+
+// avoidPressure 处于压力之下的 Leader 将 leadership 转移给最健康的 peer
+//
+// 选择没有压力且日志最新的投票成员, 若没有合适的 peer 则继续担任 Leader.
+func (l *leader) avoidPressure() {
+	if !l.pressure.underPressure() {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&l.transferring, 0, 1) {
+		return
+	}
+
+	var (
+		target     RaftId
+		matchIndex uint64
+	)
+	for _, peer := range l.configs.GetConfig().GetPeers() {
+		if peer.Id == l.Id() || l.pressure.peerUnderPressure(peer.Id) ||
+			!l.peerSupports(peer.Id, featureTimeoutNow) {
+			continue
+		}
+		index, _ := l.matchIndex.Load(peer.Id)
+		if target.isNil() || index > matchIndex {
+			target, matchIndex = peer.Id, index
+		}
+	}
+	if target.isNil() {
+		atomic.StoreInt32(&l.transferring, 0)
+		return
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&l.transferring, 0)
+		l.log(LogElection).Warn("Under sustained resource pressure, transfer leadership", "target", target)
+		ctx, cancel := context.WithTimeout(context.Background(), l.electionTimeout[0])
+		defer cancel()
+		err := l.transferLeadership(ctx, target)
+		if err != nil {
+			l.log(LogElection).Warn("Transfer leadership", "target", target, "err", err)
+		}
+	}()
+}
@@ -0,0 +1,56 @@
+package raft
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPressureTracker(t *testing.T) {
+	var pressured int32
+	p := pressureTracker{
+		probe:     func() bool { return atomic.LoadInt32(&pressured) == 1 },
+		sustained: 20 * time.Millisecond,
+	}
+
+	t.Run("sustained", func(t *testing.T) {
+		atomic.StoreInt32(&pressured, 1)
+		p.sample()
+		if p.underPressure() {
+			t.Errorf("expect not under pressure before %s", p.sustained)
+		}
+		time.Sleep(p.sustained)
+		p.sample()
+		if !p.underPressure() {
+			t.Errorf("expect under pressure after %s", p.sustained)
+		}
+		atomic.StoreInt32(&pressured, 0)
+		p.sample()
+		if p.underPressure() {
+			t.Errorf("expect pressure relieved")
+		}
+	})
+	t.Run("bounded declines", func(t *testing.T) {
+		atomic.StoreInt32(&pressured, 1)
+		p.sample()
+		time.Sleep(p.sustained)
+		for i := 0; i < maxPressureDeclines; i++ {
+			if !p.declineCampaign() {
+				t.Errorf("expect decline campaign %d", i)
+			}
+		}
+		if p.declineCampaign() {
+			t.Errorf("expect campaign after %d declines", maxPressureDeclines)
+		}
+	})
+	t.Run("disabled", func(t *testing.T) {
+		var p pressureTracker
+		if p.underPressure() || p.declineCampaign() {
+			t.Errorf("expect no pressure without probe")
+		}
+		p.observePeer("1", true)
+		if p.peerUnderPressure("1") {
+			t.Errorf("expect no peer pressure without probe")
+		}
+	})
+}
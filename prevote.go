@@ -0,0 +1,216 @@
+package raft
+
+import (
+	"errors"
+	"net/rpc"
+	"strings"
+)
+
+var _ rpcArgs = PreVoteArgs{}
+
+// PreVoteArgs
+type PreVoteArgs struct {
+	// highest protocol version supported by candidate
+	ProtocolVersion ProtocolVersion
+	// raft group the request is routed to,
+	// empty outside of MultiRaft
+	Group GroupId
+
+	// term candidate would campaign in, currentTerm + 1,
+	// candidate doesn't increment its currentTerm before winning pre-vote
+	Term uint64
+	// candidateId candidate requesting pre-vote
+	CandidateId RaftId
+
+	// lastLogIndex index of candidate’s last log entry (§5.4)
+	LastLogIndex uint64
+	// lastLogTerm term of candidate’s last log entry (§5.4)
+	LastLogTerm uint64
+}
+
+func (PreVoteArgs) getType() rpcArgsType {
+	return rpcArgsTypePreVoteArgs
+}
+
+func (a PreVoteArgs) getTerm() uint64 {
+	return a.Term
+}
+
+var _ rpcArgs = PreVoteResults{}
+
+// PreVoteResults
+type PreVoteResults struct {
+	// highest protocol version supported by voter
+	ProtocolVersion ProtocolVersion
+
+	// currentTerm, for candidate to update itself
+	Term uint64
+	// true means voter would grant its vote in a real election
+	VoteGranted bool
+
+	// voter's log state, compared with local state by startup probe
+	CommitIndex  uint64
+	LastLogIndex uint64
+	LastLogTerm  uint64
+	// true means voter's log contains candidate's last log entry
+	LogMatch bool
+}
+
+func (PreVoteResults) getType() rpcArgsType {
+	return rpcArgsTypePreVoteResults
+}
+
+func (r PreVoteResults) getTerm() uint64 {
+	return r.Term
+}
+
+// PreVote 实现 PreVote RPC
+//
+// Pre-Vote(§9.6): 发起选举前先确认能否赢得选举, 只有在能获得多数投票时才递增 currentTerm.
+// 被分区的节点无法获得多数, 不会不断递增 term, 重新加入集群时也不会干扰现任 Leader.
+// PreVote 不改变接收方的任何状态: 不更新 term, 不记录投票, 不重置选举计时器.
+func (s *rpcService) PreVote(args PreVoteArgs, results *PreVoteResults) error {
+	if s.quarantined(args.CandidateId, &results.Term) {
+		return nil
+	}
+	s.observeProtocolVersion(args.CandidateId, args.ProtocolVersion)
+	defer func() {
+		results.Term = s.GetCurrentTerm()
+		results.ProtocolVersion = s.versions.local
+		results.CommitIndex = s.GetCommitIndex()
+		results.LastLogIndex, results.LastLogTerm, _ = s.Last()
+		results.LogMatch, _ = s.Match(args.LastLogIndex, args.LastLogTerm)
+		s.log(LogElection).Debug("-> Pre-vote", "candidate", args.CandidateId, "candidateTerm", args.Term, "granted", results.VoteGranted)
+	}()
+
+	if args.Term < s.GetCurrentTerm() {
+		return nil
+	}
+	// voter believes a current leader exists
+	if s.GetServer().IsLeader() || s.isLeaderActive() {
+		return nil
+	}
+	if s.withholding.withhold(args.CandidateId, s.now()) {
+		return nil
+	}
+	if s.configMismatch.diverged() {
+		return nil
+	}
+	upToDate, err := s.logUpToDate(args.LastLogIndex, args.LastLogTerm)
+	if err != nil {
+		return err
+	}
+	results.VoteGranted = upToDate
+	return nil
+}
+
+// logUpToDate candidate 的日志是否至少与本节点一样新
+//
+// Raft determines which of two logs is more up-to-date
+// by comparing the index and term of the last entries in the
+// logs.
+//
+// If the logs have last entries with different terms, then
+// the log with the later term is more up-to-date.
+//
+// If the logs end with the same term, then whichever log is longer is
+// more up-to-date.
+func (r *raft) logUpToDate(lastLogIndex, lastLogTerm uint64) (bool, error) {
+	index, term, err := r.Last()
+	if err != nil {
+		return false, err
+	}
+	if term != lastLogTerm {
+		return term < lastLogTerm, nil
+	}
+	return index <= lastLogIndex, nil
+}
+
+// preVoteUnsupported err 是否表示 peer 没有 PreVote 方法, 即不支持 PreVote 的旧版本节点
+func preVoteUnsupported(err error) bool {
+	var serverErr rpc.ServerError
+	return errors.As(err, &serverErr) && strings.HasPrefix(string(serverErr), "rpc: can't find method")
+}
+
+// preVoteEnabled 选举前是否先进行 pre-vote
+func (r *raft) preVoteEnabled() bool {
+	return r.preVote && r.versions.local.supports(featurePreVote)
+}
+
+// startPreVote 向所有投票成员发送 PreVote, 返回是否能赢得选举
+//
+// 已知不支持 PreVote 的旧版本节点视为同意, 与不使用 pre-vote 时一致.
+// 协议版本未知(如重启后)的节点返回没有 PreVote 方法时同样视为旧版本节点;
+// 网络错误与超时均视为不同意, 被分区的节点不能赢得 pre-vote.
+func (r *raft) startPreVote() <-chan bool {
+	result := make(chan bool, 1)
+	lastLogIndex, lastLogTerm, err := r.Last()
+	if err != nil {
+		r.log(LogElection).Error("Get last log entry", "err", err)
+		result <- false
+		return result
+	}
+	args := PreVoteArgs{
+		Term:         r.GetCurrentTerm() + 1,
+		CandidateId:  r.Id(),
+		LastLogIndex: lastLogIndex,
+		LastLogTerm:  lastLogTerm,
+	}
+	config := r.configs.GetConfig()
+	peers := config.GetPeers()
+	r.metrics.IncrCounter(MetricPreVotes, 1)
+	r.log(LogElection).Debug("Start pre-vote", "preVoteTerm", args.Term)
+
+	votes := make(chan RaftId, len(peers))
+	go func() {
+		defer close(votes)
+		done := make(chan struct{}, len(peers))
+		waiting := 0
+		for _, peer := range peers {
+			peer := peer
+			if peer.Id == r.Id() {
+				votes <- peer.Id
+				continue
+			}
+			if version, ok := r.versions.known(peer.Id); ok && !version.supports(featurePreVote) {
+				votes <- peer.Id
+				continue
+			}
+			waiting++
+			go func() {
+				defer func() { done <- struct{}{} }()
+				results, err := r.rpc.CallPreVote(r.resolve(peer), args)
+				if err != nil {
+					r.log(LogTransport).Debug("Call PreVote", "peer", peer.Id, "err", err)
+					if preVoteUnsupported(err) {
+						votes <- peer.Id
+					}
+					return
+				}
+				r.observeProtocolVersion(peer.Id, results.ProtocolVersion)
+				if results.VoteGranted {
+					votes <- peer.Id
+				}
+			}()
+		}
+		for ; waiting > 0; waiting-- {
+			<-done
+		}
+	}()
+
+	go func() {
+		decider := config.NewDecider()
+		for id := range votes {
+			decider.AddVote(id)
+			if decider.HasAchievedMajority() {
+				r.log(LogElection).Debug("Won pre-vote", "preVoteTerm", args.Term, "counts", decider.Counts())
+				result <- true
+				return
+			}
+		}
+		r.log(LogElection).Debug("Lost pre-vote", "preVoteTerm", args.Term, "counts", decider.Counts())
+		r.metrics.IncrCounter(MetricPreVotesLost, 1)
+		result <- false
+	}()
+	return result
+}
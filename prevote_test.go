@@ -0,0 +1,142 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"net/rpc"
+	"sync/atomic"
+	"testing"
+)
+
+// noPreVoteRPC 模拟 old 中不支持 PreVote 的旧版本节点, 其余节点不可达
+type noPreVoteRPC struct {
+	RPC
+	old map[RaftAddr]bool
+}
+
+func (r noPreVoteRPC) CallPreVote(addr RaftAddr, args PreVoteArgs) (PreVoteResults, error) {
+	if r.old[addr] {
+		return PreVoteResults{}, rpc.ServerError("rpc: can't find method raft.PreVote")
+	}
+	return PreVoteResults{}, errors.New("dial tcp: connection refused")
+}
+
+func TestPreVote(t *testing.T) {
+	t.Run("receiver state unchanged", func(t *testing.T) {
+		r, err := New("prevote-receiver", "prevote-receiver", nil, &memoryStore{}, &memoryLog{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		raft := r.(*raft)
+		err = raft.Append(LogEntry{Term: 1}, LogEntry{Term: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		raft.SetCurrentTerm(2)
+		service := raft.newRPCService()
+
+		cases := []struct {
+			name    string
+			args    PreVoteArgs
+			active  bool
+			granted bool
+		}{
+			{name: "up-to-date", args: PreVoteArgs{Term: 3, CandidateId: "c", LastLogIndex: 2, LastLogTerm: 2}, granted: true},
+			{name: "stale log", args: PreVoteArgs{Term: 3, CandidateId: "c", LastLogIndex: 5, LastLogTerm: 1}},
+			{name: "stale term", args: PreVoteArgs{Term: 1, CandidateId: "c", LastLogIndex: 2, LastLogTerm: 2}},
+			{name: "leader active", args: PreVoteArgs{Term: 3, CandidateId: "c", LastLogIndex: 2, LastLogTerm: 2}, active: true},
+		}
+		for _, c := range cases {
+			c := c
+			t.Run(c.name, func(t *testing.T) {
+				atomic.StoreInt64(&raft.lastHeartbeat, 0)
+				if c.active {
+					raft.refreshLastHeartbeat()
+				}
+				var results PreVoteResults
+				err := service.PreVote(c.args, &results)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if results.VoteGranted != c.granted {
+					t.Errorf("expect granted %v but got %v", c.granted, results.VoteGranted)
+				}
+				if raft.GetCurrentTerm() != 2 || !raft.GetVotedFor().isNil() {
+					t.Errorf("expect state unchanged but got term %d, voted for %q", raft.GetCurrentTerm(), raft.GetVotedFor())
+				}
+			})
+		}
+	})
+
+	t.Run("partitioned node doesn't inflate term", func(t *testing.T) {
+		leader, err := New("prevote-leader", "prevote-leader", nil, nil, nil, WithDevMode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer leader.Stop()
+		go leader.Run()
+		followers := []*raft{
+			runLoopbackFollower(t, "prevote-1", WithPreVote()).(*raft),
+			runLoopbackFollower(t, "prevote-2", WithPreVote()).(*raft),
+		}
+		ctx := context.Background()
+		for _, follower := range followers {
+			defer follower.Stop()
+			err = leader.AddVoter(ctx, follower.Id(), follower.Addr())
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		term := followers[0].GetCurrentTerm()
+
+		// leader and the other follower still hear from the leader
+		if <-followers[0].startPreVote() {
+			t.Error("expect pre-vote lost while leader is active")
+		}
+		if followers[0].GetCurrentTerm() != term {
+			t.Errorf("expect term %d unchanged but got %d", term, followers[0].GetCurrentTerm())
+		}
+
+		// leader is gone
+		leader.Stop()
+		atomic.StoreInt64(&followers[1].lastHeartbeat, 0)
+		if !<-followers[0].startPreVote() {
+			t.Error("expect pre-vote won after leader is gone")
+		}
+	})
+
+	// versions of peers are unknown after restart
+	newRestarted := func(t *testing.T, id RaftId, old ...RaftAddr) *raft {
+		rpc := noPreVoteRPC{RPC: newLoopbackRPC(), old: make(map[RaftAddr]bool)}
+		for _, addr := range old {
+			rpc.old[addr] = true
+		}
+		r, err := New(id, RaftAddr(id), nil, &memoryStore{}, &memoryLog{}, WithRPC(rpc), WithPreVote())
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = r.BootstrapCluster(Configuration{Peers: []RaftPeer{
+			{Id: id, Addr: RaftAddr(id)},
+			{Id: "prevote-a", Addr: "prevote-a"},
+			{Id: "prevote-b", Addr: "prevote-b"},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r.(*raft)
+	}
+
+	t.Run("old peers", func(t *testing.T) {
+		r := newRestarted(t, "prevote-old-peers", "prevote-a")
+		if !<-r.startPreVote() {
+			t.Error("expect peer without PreVote method counted as granted")
+		}
+	})
+
+	t.Run("unreachable peers", func(t *testing.T) {
+		r := newRestarted(t, "prevote-unreachable")
+		if <-r.startPreVote() {
+			t.Error("expect pre-vote lost when peers are unreachable")
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package raft
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrUnsupportedProtocolVersion 协议版本不在支持的范围内
+var ErrUnsupportedProtocolVersion = errors.New("err: unsupported protocol version")
+
+// ProtocolVersion raft rpc 协议版本
+//
+// 每个 rpc 请求与响应都携带发送方支持的最高协议版本,
+// 与每个 peer 通信时使用双方都支持的最高版本,
+// 使集群可以逐个节点滚动升级.
+type ProtocolVersion uint32
+
+const (
+	// ProtocolVersion1 AppendEntries 与 RequestVote
+	ProtocolVersion1 ProtocolVersion = 1
+	// ProtocolVersion2 TimeoutNow
+	ProtocolVersion2 ProtocolVersion = 2
+	// ProtocolVersion3 InstallSnapshot
+	ProtocolVersion3 ProtocolVersion = 3
+	// ProtocolVersion4 PreVote
+	ProtocolVersion4 ProtocolVersion = 4
+)
+
+const (
+	// ProtocolVersionMin 支持的最低协议版本
+	ProtocolVersionMin = ProtocolVersion1
+	// ProtocolVersionMax 支持的最高协议版本
+	ProtocolVersionMax = ProtocolVersion4
+)
+
+// protocolFeature 依赖协议版本的特性
+type protocolFeature uint8
+
+const (
+	// featureTimeoutNow leadership transfer
+	featureTimeoutNow protocolFeature = iota + 1
+	// featureInstallSnapshot snapshot transfer
+	featureInstallSnapshot
+	// featurePreVote pre-vote before election
+	featurePreVote
+)
+
+// featureVersions 特性 -> 引入该特性的协议版本
+var featureVersions = map[protocolFeature]ProtocolVersion{
+	featureTimeoutNow:      ProtocolVersion2,
+	featureInstallSnapshot: ProtocolVersion3,
+	featurePreVote:         ProtocolVersion4,
+}
+
+// normalize 未携带协议版本的 rpc 来自旧版本节点, 视为 ProtocolVersion1
+func (v ProtocolVersion) normalize() ProtocolVersion {
+	if v == 0 {
+		return ProtocolVersion1
+	}
+	return v
+}
+
+// supports 该协议版本是否支持特性 f
+func (v ProtocolVersion) supports(f protocolFeature) bool {
+	since, ok := featureVersions[f]
+	return ok && v.normalize() >= since
+}
+
+// protocolVersions 记录每个 peer 支持的最高协议版本
+type protocolVersions struct {
+	mux sync.RWMutex
+	// local 本节点使用的最高协议版本
+	local ProtocolVersion
+	peers map[RaftId]ProtocolVersion
+}
+
+// observe 记录 peer 通告的协议版本, 返回版本是否发生变化
+func (p *protocolVersions) observe(id RaftId, version ProtocolVersion) bool {
+	if id.isNil() {
+		return false
+	}
+	version = version.normalize()
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.peers == nil {
+		p.peers = make(map[RaftId]ProtocolVersion)
+	}
+	pre, ok := p.peers[id]
+	p.peers[id] = version
+	return !ok || pre != version
+}
+
+// negotiate 与 peer 通信时使用的协议版本
+// 未知 peer 的协议版本时使用最低版本
+func (p *protocolVersions) negotiate(id RaftId) ProtocolVersion {
+	p.mux.RLock()
+	defer p.mux.RUnlock()
+	version, ok := p.peers[id]
+	if !ok {
+		return ProtocolVersionMin
+	}
+	if version > p.local {
+		return p.local
+	}
+	return version
+}
+
+// known peer 通告过的协议版本, 未知时 ok 为 false
+func (p *protocolVersions) known(id RaftId) (version ProtocolVersion, ok bool) {
+	p.mux.RLock()
+	defer p.mux.RUnlock()
+	version, ok = p.peers[id]
+	return version, ok
+}
+
+// peerSupports peer 是否支持特性 f
+func (r *raft) peerSupports(id RaftId, f protocolFeature) bool {
+	return r.versions.negotiate(id).supports(f)
+}
+
+// observeProtocolVersion 记录 peer 通告的协议版本
+func (r *raft) observeProtocolVersion(id RaftId, version ProtocolVersion) {
+	if r.versions.observe(id, version) {
+		r.log(LogTransport).Info("Observed protocol version",
+			"peer", id, "version", version.normalize(), "negotiated", r.versions.negotiate(id))
+	}
+}
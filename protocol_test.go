@@ -0,0 +1,15 @@
+package raft
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestWithProtocolVersion(t *testing.T) {
+	for _, version := range []ProtocolVersion{0, ProtocolVersionMax + 1} {
+		_, err := New("protocol", "protocol", nil, nil, nil, WithProtocolVersion(version))
+		if !errors.Is(err, ErrUnsupportedProtocolVersion) {
+			t.Errorf("expect ErrUnsupportedProtocolVersion for version %d but got %v", version, err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package raft
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+var ErrQuarantineSelf = errors.New("err: can not quarantine self")
+
+// quarantine 被隔离的 peer
+//
+// 调查疑似数据损坏的节点期间, 在正式将其移出集群之前隔离它:
+// 它的 rpc 请求只交换 term, 不会重置选举计时器、不会被投票,
+// 也不会让本节点追随更大的 term; 本节点作为 Leader 时也不向它复制日志.
+// 隔离只对本节点生效且不持久化, 需要在每个节点上分别隔离.
+type quarantine struct {
+	mux   sync.RWMutex
+	peers map[RaftId]struct{}
+}
+
+func (q *quarantine) add(id RaftId) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	if q.peers == nil {
+		q.peers = make(map[RaftId]struct{})
+	}
+	q.peers[id] = struct{}{}
+}
+
+func (q *quarantine) remove(id RaftId) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	delete(q.peers, id)
+}
+
+func (q *quarantine) contains(id RaftId) bool {
+	q.mux.RLock()
+	defer q.mux.RUnlock()
+	_, ok := q.peers[id]
+	return ok
+}
+
+func (q *quarantine) list() []RaftId {
+	q.mux.RLock()
+	defer q.mux.RUnlock()
+	ids := make([]RaftId, 0, len(q.peers))
+	for id := range q.peers {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// Quarantine 隔离 peer id, 见 quarantine
+func (r *raft) Quarantine(id RaftId) error {
+	if id == r.Id() {
+		return ErrQuarantineSelf
+	}
+	r.quarantine.add(id)
+	r.log(LogTransport).Warn("Quarantine", "peer", id)
+	return nil
+}
+
+// Unquarantine 解除对 peer id 的隔离
+func (r *raft) Unquarantine(id RaftId) {
+	r.quarantine.remove(id)
+	r.log(LogTransport).Info("Unquarantine", "peer", id)
+}
+
+// Quarantined 返回被隔离的 peer
+func (r *raft) Quarantined() []RaftId {
+	return r.quarantine.list()
+}
+
+// quarantined 被隔离的 peer 的 rpc 请求只返回 currentTerm
+func (s *rpcService) quarantined(id RaftId, term *uint64) bool {
+	if !s.quarantine.contains(id) {
+		return false
+	}
+	*term = s.GetCurrentTerm()
+	s.log(LogTransport).Debug("Ignore rpc from quarantined peer", "peer", id)
+	return true
+}
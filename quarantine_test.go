@@ -0,0 +1,93 @@
+package raft
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestQuarantine(t *testing.T) {
+	t.Run("rpc from quarantined peer", func(t *testing.T) {
+		r, err := New("quarantine", "quarantine", nil, &memoryStore{}, &memoryLog{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		raft := r.(*raft)
+		raft.SetCurrentTerm(3)
+
+		if err := r.Quarantine(r.Id()); err != ErrQuarantineSelf {
+			t.Errorf("expect %v but got %v", ErrQuarantineSelf, err)
+		}
+		if err := r.Quarantine("suspect"); err != nil {
+			t.Fatal(err)
+		}
+		if got := r.Quarantined(); len(got) != 1 || got[0] != "suspect" {
+			t.Errorf("expect [suspect] but got %v", got)
+		}
+
+		service := raft.RPCService()
+		var vote RequestVoteResults
+		err = service.RequestVote(RequestVoteArgs{Term: 10, CandidateId: "suspect"}, &vote)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if vote.Term != 3 || vote.VoteGranted {
+			t.Errorf("expect vote rejected at term 3 but got %+v", vote)
+		}
+		var preVote PreVoteResults
+		err = service.PreVote(PreVoteArgs{Term: 10, CandidateId: "suspect"}, &preVote)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if preVote.Term != 3 || preVote.VoteGranted {
+			t.Errorf("expect pre-vote rejected at term 3 but got %+v", preVote)
+		}
+		var heartbeat AppendEntriesResults
+		err = service.AppendEntries(AppendEntriesArgs{Term: 10, LeaderId: "suspect"}, &heartbeat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if heartbeat.Term != 3 || heartbeat.Success {
+			t.Errorf("expect append rejected at term 3 but got %+v", heartbeat)
+		}
+		if term := raft.GetCurrentTerm(); term != 3 {
+			t.Errorf("expect current term 3 but got %d", term)
+		}
+		if leader, ok := r.Leader(); ok {
+			t.Errorf("expect no leader but got %s", leader)
+		}
+
+		r.Unquarantine("suspect")
+		if got := r.Quarantined(); len(got) != 0 {
+			t.Errorf("expect no quarantined peer but got %v", got)
+		}
+	})
+
+	t.Run("no replication to quarantined peer", func(t *testing.T) {
+		r, err := New("quarantine-leader", "quarantine-leader", nil, nil, nil, WithDevMode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Stop()
+		go r.Run()
+
+		follower := runLoopbackFollower(t, "quarantine-follower")
+		defer follower.Stop()
+		err = r.AddVoter(context.Background(), follower.Id(), follower.Addr())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// without heartbeats to the follower, the leader loses contact with a majority
+		if err := r.Quarantine(follower.Id()); err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(3 * time.Second)
+		for r.IsLeader() && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if r.IsLeader() {
+			t.Error("expect leader stepped down while its only follower is quarantined")
+		}
+	})
+}
@@ -3,7 +3,7 @@ package raft
 import (
 	"context"
 	"errors"
-	"fmt"
+	"log/slog"
 	"math/rand"
 	"net"
 	"os"
@@ -13,16 +13,53 @@ import (
 )
 
 var (
-	ErrStopped       = errors.New("err: raft consensus module has been stopped")
-	ErrRanRepeatedly = errors.New("err: raft consensus module can not bee ran repeatedly")
+	ErrStopped        = errors.New("err: raft consensus module has been stopped")
+	ErrAlreadyRunning = errors.New("err: raft consensus module is already running")
+	// Deprecated: 使用 ErrAlreadyRunning
+	ErrRanRepeatedly = ErrAlreadyRunning
 )
 
 // New 实例化一个 raft 一致性模型
+// 使用 WithFSM 时 apply 被忽略, 可以为 nil
 func New(id RaftId, addr RaftAddr, apply Apply, store Store, log Log, optFns ...OptFn) (Raft, error) {
 	opts := newOpts()
 	for _, fn := range optFns {
 		fn(opts)
 	}
+	if opts.err != nil {
+		return nil, opts.err
+	}
+	if opts.tls != nil {
+		if err := applyTLS(opts.rpc, opts.tls); err != nil {
+			return nil, err
+		}
+	}
+	if opts.apply != nil {
+		apply = opts.apply
+	}
+	if opts.devMode {
+		if store == nil {
+			store = &memoryStore{}
+		}
+		if log == nil {
+			log = &memoryLog{}
+		}
+	}
+
+	if store != nil {
+		migrator := &migrator{
+			store:      store,
+			log:        log,
+			snapshots:  opts.snapshotStore,
+			backupDir:  opts.migrationBackupDir,
+			logger:     opts.logger,
+			migrations: storageMigrations,
+		}
+		err := migrator.run()
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	state, err := newState(store)
 	if err != nil {
@@ -34,6 +71,11 @@ func New(id RaftId, addr RaftAddr, apply Apply, store Store, log Log, optFns ...
 		return nil, err
 	}
 
+	history, err := newLeadershipHistory(store)
+	if err != nil {
+		return nil, err
+	}
+
 	raft := &raft{
 		id: id,
 
@@ -47,18 +89,84 @@ func New(id RaftId, addr RaftAddr, apply Apply, store Store, log Log, optFns ...
 		rpc:  opts.rpc,
 		addr: addr,
 
-		commitCond: sync.NewCond(&sync.Mutex{}),
-		rpcArgs:    make(chan rpcArgs),
+		externalRPCServer: opts.externalRPCServer,
+
+		applyNotify:      make(chan struct{}, 1),
+		rpcArgs:          make(chan rpcArgs),
+		timeoutNow:       make(chan struct{}, 1),
+		leaderDiscovered: make(chan uint64, 1),
 
 		configs:         configs,
 		electionTimeout: opts.election,
 
-		logger: opts.logger,
-
 		bootstrapAsLeader: opts.bootstrapAsLeader,
+		devMode:           opts.devMode,
+
+		versions: protocolVersions{local: opts.protocolVersion},
+
+		compactionHooks:       opts.compactionHooks,
+		compactionHookTimeout: opts.compactionHookTimeout,
+		retention:             opts.retention,
+
+		snapshotter:   opts.snapshotter,
+		snapshotStore: opts.snapshotStore,
+		snapshotKeys:  opts.snapshotKeys,
+
+		newSnapshotFSM: opts.newSnapshotFSM,
+
+		heartbeatExtensionProvider: opts.heartbeatExtensionProvider,
+		heartbeatExtensionConsumer: opts.heartbeatExtensionConsumer,
+		adaptiveHeartbeat:          opts.adaptiveHeartbeat,
+		pipelineWindow:             opts.pipelineWindow,
+		maxAppendEntries:           opts.maxAppendEntries,
+		maxAppendBytes:             opts.maxAppendBytes,
+		dedup:                      dedupWindow{window: opts.dedupWindow},
+		batchSize:                  opts.batchSize,
+		batchDelay:                 opts.batchDelay,
+		slo:                        newSLOTracker(opts.commitLatencySLO),
+		results:                    newProposalResults(id),
+		bandwidth:                  newBandwidthBudget(opts.peerBandwidth, opts.globalBandwidth),
+		storageBenchmark:           opts.storageBenchmark,
+
+		resolver: opts.resolver,
+
+		registrar: leaderRegistrar{registrar: opts.registrar},
+
+		membershipPolicy: opts.membershipPolicy,
+
+		pressure: pressureTracker{probe: opts.pressureProbe, sustained: opts.pressureSustained},
+
+		snapshotPolicy: newSnapshotPolicy(opts.snapshotThreshold, opts.snapshotInterval),
+
+		divergence: logDivergence{max: opts.maxLogDivergence},
+
+		observers:  opts.observers,
+		entryTypes: entryTypes{policy: opts.unknownEntryPolicy, handlers: opts.entryHandlers},
+		preVote:    opts.preVote,
+		cooldown:   electionCooldown{duration: opts.electionCooldown},
+		campaign:   campaignTracker{strategy: opts.campaignStrategy},
+		probe:      startupProbe{timeout: opts.startupProbe},
+		leaseDrift: opts.leaseDrift,
+		preApply:   preApply{hook: opts.preApplyHook, notify: make(chan struct{}, 1)},
+		watchdog:   applyWatchdog{deadline: opts.applyDeadline, split: opts.applySplit},
+
+		quorumLossTimeout: opts.quorumLossTimeout,
+
+		metrics: opts.metrics,
+
+		tracer:            opts.tracer,
+		writeTracer:       opts.writeTracer,
+		slowAppendEntries: opts.slowAppendEntries,
+
+		history: history,
+
+		tickers: opts.tickers,
+		random:  opts.random,
 
 		done: make(chan struct{}),
 	}
+	raft.loggers = newSubsystemLoggers(opts.logger, opts.logLevels, raft)
+	raft.configs = notifyingConfigs{configManager: configs, raft: raft}
 	err = raft.init()
 	if err != nil {
 		return nil, err
@@ -80,16 +188,81 @@ type Raft interface {
 	Stop()
 	// Done 是否已经停止
 	Done() <-chan struct{}
+	// State 获取生命周期状态
+	State() LifecycleState
 
 	// Handle 处理 cmd
 	//
 	// append log entry --> log replication --> apply to state matchine
 	Handle(ctx context.Context, cmd ...Command) error
+	// Propose 提交 cmd, 应用到状态机后返回 Apply 通过 SetResult 设置的结果
+	Propose(ctx context.Context, cmd Command) (Result, error)
+	// ProposeAsync 异步提交 cmd, 返回的 Future 在应用后或 ctx 结束时完成
+	ProposeAsync(ctx context.Context, cmd Command) Future
+	// ProposeEntry 提交 NewNoopEntry 或 NewBarrierEntry 创建的系统 log entry, 应用后返回其索引
+	ProposeEntry(ctx context.Context, entry LogEntry) (uint64, error)
+	// Subscribe 返回接收事件的 channel, 包括 Leader 与成员变化、快照等, Stop 之后关闭
+	Subscribe() <-chan Event
 	// IsLeader 是否是 Leader
 	IsLeader() bool
-
+	// Leader 返回本节点知道的当前 term 的 Leader
+	// 非 Leader 节点拒绝请求时返回的 *NotLeaderError 也携带该 Leader
+	Leader() (RaftPeer, bool)
+	// ReadIndex 获取线性一致读的 read index
+	ReadIndex(ctx context.Context) (uint64, error)
+	// LinearizableRead 状态机应用到 read index 之后调用 fn 读取状态机
+	LinearizableRead(ctx context.Context, fn func() error) error
+	// LeaseRead 在 Leader 租约有效期内, 状态机应用到 commitIndex 之后调用 fn 读取状态机
+	LeaseRead(ctx context.Context, fn func() error) error
+	// RPCService 返回处理 peer rpc 请求的 RPCService, 用于挂载到外部服务器
+	RPCService() RPCService
+
+	// BootstrapCluster 以 configuration 初始化新集群, 只能在没有任何状态的节点上 Run 之前调用
+	BootstrapCluster(configuration Configuration) error
 	// ChangeConfig add added and remove removed
 	ChangeConfig(ctx context.Context, added []RaftPeer, removed []RaftId) error
+	// ChangeConfiguration 经过 joint consensus 将集群配置从 old 变更为 new
+	ChangeConfiguration(ctx context.Context, old, new []RaftPeer) error
+	// AddVoter 将 id 加入集群成为投票成员
+	AddVoter(ctx context.Context, id RaftId, addr RaftAddr) error
+	// RemoveServer 将 id 移出集群
+	RemoveServer(ctx context.Context, id RaftId) error
+	// TransferLeadership 将 leadership 转移给 target
+	TransferLeadership(ctx context.Context, target RaftId) error
+	// Quarantine 隔离疑似异常的 peer: 只与其交换 term, 不向其复制日志, 也不会因其发起选举
+	Quarantine(id RaftId) error
+	// Unquarantine 解除对 peer 的隔离
+	Unquarantine(id RaftId)
+	// Quarantined 返回被隔离的 peer
+	Quarantined() []RaftId
+
+	// Healthy 是否正在运行, 且是 Leader 或最近收到过 Leader 的心跳, 且不处于启动后的追赶状态
+	Healthy() bool
+	// UpdatePeerAddress 更新与 peer 通信使用的地址
+	UpdatePeerAddress(id RaftId, addr RaftAddr)
+
+	// GetConfiguration 获取当前使用的集群配置
+	GetConfiguration() Configuration
+	// LeadershipHistory 获取本节点观察到的 leadership 变化记录
+	LeadershipHistory() []LeadershipRecord
+	// TermBoundaries 获取 log 中每个 term 的区间
+	TermBoundaries() ([]TermBoundary, error)
+	// FirstIndexOfTerm 获取 term 的第一个 log entry 的索引
+	FirstIndexOfTerm(term uint64) (index uint64, ok bool, err error)
+	// Stats 获取状态快照
+	Stats() Status
+
+	// Snapshot 为状态机创建快照, 快照包含所有已应用的 log entry
+	Snapshot() (SnapshotMeta, error)
+	// ListSnapshots 返回保留的所有快照的元数据, 最新的快照在前
+	ListSnapshots() ([]SnapshotMeta, error)
+	// OpenSnapshotFSM 将快照恢复到新的状态机实例中, 用于只读查看历史状态
+	OpenSnapshotFSM(id string) (Snapshotter, SnapshotMeta, error)
+
+	// LearnerProgress 获取 learner 追赶 leader 日志的进度估计
+	LearnerProgress(id RaftId) (LearnerProgress, bool)
+	// IsPromotable learner 是否已足够接近 leader, 可以提升为投票成员
+	IsPromotable(id RaftId) bool
 }
 
 // RaftId raft 一致性模型 id
@@ -117,14 +290,34 @@ type raft struct {
 
 	rpc  RPC
 	addr RaftAddr
+	// externalRPCServer peer rpc requests are served by external server
+	externalRPCServer bool
 
-	// 通知 commitIndex 更新事件发生
-	commitCond *sync.Cond
+	// 通知 commitIndex 更新事件发生, 容量为 1, 多次通知会合并
+	applyNotify chan struct{}
 
 	// 存放 rpc rpcArgs, 方便执行以下操作:
 	// If RPC request or response contains term T > currentTerm:
 	// set currentTerm = T, convert to follower (§5.1)
 	rpcArgs chan rpcArgs
+	// timeoutNow 收到 TimeoutNow, 立即发起选举
+	timeoutNow chan struct{}
+	// hint leader known from its rpc, including to learners
+	hint leaderHint
+	// leaderDiscovered candidate 收到合法 Leader 的 AppendEntries, 值为 Leader 的 term
+	leaderDiscovered chan uint64
+	// transfer progress transferred by previous leader
+	transfer leadershipTransfer
+	// withholding withhold votes during leadership transfer
+	withholding voteWithholding
+	// divergence refuse to campaign when log lags too far behind
+	divergence logDivergence
+	// configMismatch refuse to vote when configuration diverges from leader's
+	configMismatch configMismatch
+	// acks cumulative acknowledgement of AppendEntries
+	acks appendAcks
+	// catchup catching up with leader after start
+	catchup catchUp
 
 	// cluster configuration
 	configs configManager
@@ -132,19 +325,129 @@ type raft struct {
 	electionTimeout [2]time.Duration
 
 	// ticker heartbeat/election timer
-	ticker *time.Ticker
+	ticker *ticker
+	// tickers drive tickers of raft groups sharing it, nil if ticker is driven by time.Ticker
+	tickers *tickerPool
+	// random source of election timeouts, nil for math/rand
+	random func(n int64) int64
 
 	// lastHeartbeat last heartbeat's unix time (the number of milliseconds)
 	// help to show leaders' activity
 	lastHeartbeat int64
 
-	logger Logger
+	// loggers logger of each subsystem
+	loggers map[LogSubsystem]*slog.Logger
 
-	// whether or not already ran
-	ran int32
+	// lifecycle Run and Stop
+	lifecycle lifecycle
 
 	// wether or not bootstrap as leader
 	bootstrapAsLeader bool
+	// wether or not run in development mode
+	devMode bool
+
+	// versions protocol versions of peers
+	versions protocolVersions
+
+	// compactionHooks hooks called before log compaction
+	compactionHooks       []CompactionHook
+	compactionHookTimeout time.Duration
+	// retention entries retained beyond snapshots
+	retention logRetention
+
+	// snapshotter state machine snapshot
+	snapshotter   Snapshotter
+	snapshotStore SnapshotStore
+	// snapshotKeys encrypt snapshots if not nil
+	snapshotKeys KeyProvider
+	// newSnapshotFSM create throwaway state machine to inspect snapshots
+	newSnapshotFSM func() Snapshotter
+	// receiving snapshot being received from leader
+	receiving snapshotReceiver
+	// applyMux 应用 command 与快照的创建, 安装互斥
+	applyMux sync.Mutex
+	// snapshotPolicy create snapshots automatically, see WithSnapshotPolicy
+	snapshotPolicy snapshotPolicy
+
+	// heartbeat extension payload
+	heartbeatExtensionProvider HeartbeatExtensionProvider
+	heartbeatExtensionConsumer HeartbeatExtensionConsumer
+
+	// resolver resolve peer's rpc address
+	resolver Resolver
+
+	// registrar register leader's address in external service catalog
+	registrar leaderRegistrar
+	// membershipPolicy authorize membership changes, see WithMembershipPolicy
+	membershipPolicy MembershipPolicy
+	// peerAddrs updated peers' address, RaftId -> RaftAddr
+	peerAddrs sync.Map
+	// resolvedAddrs last address used to reach peers, RaftId -> RaftAddr
+	resolvedAddrs sync.Map
+
+	// pressure resource pressure of local node and peers
+	pressure pressureTracker
+
+	// observers receive events
+	observers []Observer
+	// subscriptions channels receiving events, see Subscribe
+	subscriptions subscriptions
+	// preVote run pre-vote before election
+	preVote bool
+	// cooldown wait before campaigning again after losing an election
+	cooldown electionCooldown
+	// campaign decide when to campaign again after losing elections, see WithCampaignStrategy
+	campaign campaignTracker
+	// quarantine peers whose rpcs are answered with term only
+	quarantine quarantine
+	// probe compare local log with peers' on start
+	probe startupProbe
+	// adaptiveHeartbeat adjust heartbeat interval to replication traffic
+	adaptiveHeartbeat bool
+	// dedup skip entries whose idempotency key has been applied
+	dedup dedupWindow
+	// batchSize, batchDelay coalesce concurrent proposals, see WithProposalBatching
+	batchSize  int
+	batchDelay time.Duration
+	// slo track commit latency SLO, nil if not declared
+	slo *sloTracker
+	// results results of applied commands waited by Propose
+	results proposalResults
+	// bandwidth outbound bandwidth budget of replication and snapshots, nil if unlimited
+	bandwidth *bandwidthBudget
+	// storageBenchmark entries appended to benchmark the log on start, see WithStorageBenchmark
+	storageBenchmark int
+	// pipelineWindow max in-flight AppendEntries per peer, pipelining is disabled if not greater than 1
+	pipelineWindow int
+	// maxAppendEntries, maxAppendBytes limit entries and command bytes of an AppendEntries, 0 if unlimited
+	maxAppendEntries int
+	maxAppendBytes   int
+	// newerTerm highest term learned from peers' responses
+	newerTerm uint64
+	// leaseDrift clock drift bound of leader lease, negative if lease reads are disabled
+	leaseDrift time.Duration
+	// quorumLossTimeout reject proposals after losing contact with a majority this long, 0 if disabled
+	quorumLossTimeout time.Duration
+	// preApply call PreApplyHook before applying
+	preApply preApply
+	// entryTypes how to apply unknown log entry types
+	entryTypes entryTypes
+	// watchdog watch slow apply
+	watchdog applyWatchdog
+	// accounting time spent by apply worker
+	accounting applyAccounting
+
+	// metrics metrics sink
+	metrics MetricsSink
+	// tracer AppendEntries tracer
+	tracer Tracer
+	// slowAppendEntries AppendEntries 耗时达到该值时附加 exemplar
+	slowAppendEntries time.Duration
+	// writeTracer 跟踪写入的各个阶段
+	writeTracer WriteTracer
+
+	// history leadership changes
+	history *leadershipHistory
 
 	// 表示一致性模型是否已停用
 	done chan struct{}
@@ -155,8 +458,7 @@ func (r *raft) init() (err error) {
 	r.rpc = rpc
 
 	timeout := r.randomElectionTimeout()
-	ticker := time.NewTicker(timeout)
-	r.ticker = ticker
+	r.ticker = r.newTicker(timeout)
 
 	if r.bootstrapAsLeader {
 		lastIndex, _, err := r.Log.Last()
@@ -164,8 +466,6 @@ func (r *raft) init() (err error) {
 			return err
 		}
 		if lastIndex == 0 {
-			// Instead, we recommend that the very first time a cluster is created,
-			// one server is initialized with a configuration entry as the first entry in its log.
 			// This configuration lists only that one server;
 			// it alone forms a majority of its configuration,
 			// so it can consider this configuration committed.
@@ -173,33 +473,41 @@ func (r *raft) init() (err error) {
 			// Other servers from then on should be initialized with empty logs;
 			// they are added to the cluster and learn of the current configuration
 			// through the membership change mechanism.
-			peer := RaftPeer{r.Id(), r.Addr()}
-			config := newBootstrapAsLeaderConfig(peer)
-			entry, err := r.configs.NewConfigLogEntry(
-				r.GetCurrentTerm(), config)
-			if err != nil {
-				return err
-			}
-			index, err := r.Log.AppendEntry(*entry)
-			if err != nil {
-				return err
-			}
-			config.SetIndex(index)
-			err = r.configs.UseConfig(config)
+			err = r.bootstrap([]RaftPeer{{r.Id(), r.Addr()}})
 			if err != nil {
 				return err
 			}
-			r.SetCommitIndex(index)
-			r.debug("Will bootstrap as leader")
+			r.log(LogElection).Info("Will bootstrap as leader")
 		}
 	}
 
+	if r.devMode && r.configs.GetConfig().IsStandalone(r.Id()) {
+		// the vote for self is already a majority,
+		// become leader without waiting for election timeout
+		candidate, err := r.toCandidate()
+		if err != nil {
+			return err
+		}
+		r.SetServer(candidate)
+		server, err := r.toLeader()
+		r.SetServer(server)
+		return err
+	}
+
 	server, err := r.toFollower(r.GetCurrentTerm())
 	r.SetServer(server)
 	return err
 }
 
+// RPCService 返回处理 peer rpc 请求的 RPCService, 见 RPCServer
+func (r *raft) RPCService() RPCService {
+	return r.newRPCService()
+}
+
 func (r *raft) runRPC() error {
+	if r.externalRPCServer {
+		return nil
+	}
 	service := r.newRPCService()
 	err := r.rpc.Register(service)
 	if err != nil {
@@ -229,30 +537,54 @@ func (r *raft) IsLeader() bool {
 	return r.GetServer().IsLeader()
 }
 
+// Run 启动 raft 一致性模型, 阻塞直到 Stop 或出错
+// 已在运行时返回 ErrAlreadyRunning, 已停止后返回 ErrStopped
 func (r *raft) Run() (err error) {
-	if atomic.SwapInt32(&r.ran, 1) != 0 {
-		return ErrRanRepeatedly
+	if err := r.beginRun(); err != nil {
+		return err
 	}
+	defer r.endRun()
 
-	r.debug("Run raft consensuse module")
+	r.log(LogGeneral).Info("Run raft consensus module")
 	rand.Seed(time.Now().UnixNano())
+	if r.storageBenchmark > 0 {
+		r.benchmarkStorage(r.storageBenchmark)
+	}
 
 	go func() {
 		err := r.runRPC()
 		if err != nil && !errors.Is(err, net.ErrClosed) {
-			r.debug("run rpc, err: %+v", err)
+			r.log(LogTransport).Error("Run rpc", "err", err)
 			os.Exit(1)
 		}
 	}()
 	defer r.rpc.Close()
 
 	go r.loopApplyCommitted()
+	if r.probe.enabled() {
+		atomic.StoreInt32(&r.probe.pending, 1)
+		go r.probeCluster()
+	}
+	if r.preApply.enabled() {
+		go r.loopPreApply()
+	}
+	if r.pressure.enabled() {
+		go r.loopSamplePressure()
+	}
+	if r.snapshotter != nil && r.snapshotPolicy.enabled() {
+		go r.loopSnapshot()
+	}
 
 	// drop ticks to avoid election timeout
 	for len(r.ticker.C) != 0 {
 		<-r.ticker.C
 	}
 	r.GetServer().ResetTimer()
+	if r.IsLeader() {
+		r.onLeadershipChanged(true)
+	}
+	defer r.deregisterOnStop()
+	r.endStartup()
 
 	for {
 		server, err := r.GetServer().Run()
@@ -262,23 +594,31 @@ func (r *raft) Run() (err error) {
 		if err != nil {
 			return err
 		}
-		r.SetServer(server)
+		r.switchServer(server)
 	}
 }
 
+// Stop 停止 raft 一致性模型, 可以重复及并发调用
+// Run 启动期间调用时等待启动完成后再停止
 func (r *raft) Stop() {
-	select {
-	case <-r.done:
+	r.lifecycle.mux.Lock()
+	defer r.lifecycle.mux.Unlock()
+	switch r.lifecycle.get() {
+	case LifecycleStopping, LifecycleStopped:
 		// Has already been stopped - no need to do anything
 		return
+	case LifecycleRunning:
+		// Run returns and then it's stopped
+		r.lifecycle.set(LifecycleStopping)
 	default:
-		// no-op
+		r.lifecycle.set(LifecycleStopped)
 	}
 
 	if r.ticker != nil {
 		r.ticker.Stop()
 	}
 	close(r.done)
+	r.subscriptions.close()
 	return
 }
 
@@ -287,30 +627,56 @@ func (r *raft) Done() <-chan struct{} {
 	return r.done
 }
 
+// Healthy 是否正在运行, 且是 Leader 或最近收到过 Leader 的心跳
+// 重启后还未应用到从 Leader 得知的 commitIndex 的节点不健康
+func (r *raft) Healthy() bool {
+	if r.State() != LifecycleRunning {
+		return false
+	}
+	if r.catchingUp() {
+		return false
+	}
+	return r.IsLeader() || r.isLeaderActive()
+}
+
 func (r *raft) loopApplyCommitted() {
 	for {
+		start := time.Now()
 		select {
 		case <-r.done:
 			return
-		default:
+		case <-r.applyNotify:
 			// no-op
 		}
+		r.accounting.record(ApplyAccounting{WaitCommit: time.Since(start)})
 
-		func() {
-			r.commitCond.L.Lock()
-			defer r.commitCond.L.Unlock()
-
-			var lastApplied, commitIndex uint64
-			for commitIndex <= lastApplied {
-				r.commitCond.Wait()
-				commitIndex, lastApplied = r.GetCommitIndex(), r.GetLastApplied()
-			}
+		r.metrics.IncrCounter(MetricApplyWakeups, 1)
+		if r.GetCommitIndex() <= r.GetLastApplied() {
+			r.metrics.IncrCounter(MetricApplyWakeupsEmpty, 1)
+			continue
+		}
+		err := r.applyCommitted()
+		if err != nil {
+			r.log(LogApply).Error("Apply commands", "err", err)
+		}
+	}
+}
 
-			err := r.applyCommitted()
-			if err != nil {
-				r.debug("apply commands, err: %+v", err)
-			}
-		}()
+// notifyApply 通知 apply worker commitIndex 已超过 lastApplied
+//
+// 通知会合并: worker 处理之前的多次 commitIndex 推进只唤醒一次,
+// 心跳频繁时不会造成大量无效的唤醒.
+func (r *raft) notifyApply() {
+	r.notifyPreApply()
+	if r.GetCommitIndex() <= r.GetLastApplied() {
+		return
+	}
+	r.metrics.IncrCounter(MetricApplyNotifications, 1)
+	select {
+	case r.applyNotify <- struct{}{}:
+	default:
+		// a wakeup is already pending
+		r.metrics.IncrCounter(MetricApplyNotificationsCoalesced, 1)
 	}
 }
 
@@ -330,14 +696,19 @@ func (r *raft) syncLeaderCommit(leaderCommit uint64) error {
 		commitIndex = lastIndex
 	}
 	r.state.SetCommitIndex(commitIndex)
+	r.metrics.SetGauge(MetricCommitIndex, float64(commitIndex))
+	r.gaugeApplyBacklog()
 
 	// 通知 commitIndex 更新事件发生
-	r.commitCond.Signal()
+	r.notifyApply()
 	return nil
 }
 
 // Apply 依序应用 commands 到状态机中
 // 返回 应用的 Command 数量 appliedCount
+// 可通过 SetResult 设置每个 command 的结果, 由 Propose 返回给提交者
+//
+// 需要快照的状态机实现 FSM, 见 WithFSM
 type Apply func(commands Commands) (appliedCount int, err error)
 
 // applyCommitted
@@ -346,48 +717,109 @@ type Apply func(commands Commands) (appliedCount int, err error)
 // 		If commitIndex > lastApplied: increment lastApplied, apply
 // 		log[lastApplied] to state machine(§5.3)
 func (r *raft) applyCommitted() error {
+	for {
+		r.applyMux.Lock()
+		done, err := r.applyBatch()
+		r.applyMux.Unlock()
+		if done || err != nil {
+			return err
+		}
+	}
+}
+
+// applyBatch 应用一批已 commit 的 log entry
+// 批次大小受 applyWatchdog 限制, done 为 false 时还有待应用的 log entry
+func (r *raft) applyBatch() (done bool, err error) {
 	commitIndex, lastApplied := r.GetCommitIndex(), r.GetLastApplied()
 	if commitIndex <= lastApplied {
-		return nil
+		return true, nil
+	}
+	end := commitIndex
+	if limit := r.watchdog.batchLimit(); limit > 0 && end-lastApplied > limit {
+		end = lastApplied + limit
 	}
 
 	// 获取已 commit 且没 apply 的命令
-	entries, err := r.RangeGet(lastApplied, commitIndex)
+	readStart := time.Now()
+	entries, err := r.RangeGet(lastApplied, end)
+	r.accounting.record(ApplyAccounting{ReadLog: time.Since(readStart)})
 	if err != nil {
-		return err
+		return true, err
 	}
 
+	// system entries with apply and unknown entries are applied
+	// one at a time, in order with commands
+	switch i := firstAloneEntry(entries); {
+	case i == 0:
+		return r.applyAloneEntry(entries[0], commitIndex)
+	case i > 0:
+		entries = entries[:i]
+		end = lastApplied + uint64(i)
+	}
+
+	// skip entries whose idempotency key has been applied
+	duplicates, err := r.dedupEntries(lastApplied, entries)
+	if err != nil {
+		return true, err
+	}
+	r.results.reject(entries, duplicates, ErrDuplicateCommand)
+
 	// apply command type log entries
 	var commandEntries []LogEntry
 	for i := range entries {
-		if entries[i].Type == logEntryTypeCommand {
+		if entries[i].Type == logEntryTypeCommand && !duplicates[entries[i].Index] {
 			commandEntries = append(commandEntries, entries[i])
 		}
 	}
 	if len(commandEntries) == 0 {
-		return nil
+		// configuration entries only
+		r.SetLastApplied(end)
+		return end == commitIndex, nil
 	}
 	commands := newCommands(commandEntries)
 
 	// apply
+	stop := r.watchApply(lastApplied+1, end)
+	endSpans := r.traceEntries(SpanApply, commandEntries)
+	start := time.Now()
 	appliedCount, err := r.apply(commands)
-	if err != nil {
-		return err
-	}
+	endSpans(err)
+	stop()
+	elapsed := time.Since(start)
+	r.accounting.record(ApplyAccounting{Apply: elapsed})
+	r.metrics.AddSample(MetricApplyDuration, milliseconds(elapsed))
+	r.metrics.AddSample(MetricApplyEntries, float64(len(commandEntries)))
+	if appliedCount > len(commandEntries) {
+		appliedCount = len(commandEntries)
+	}
+	// the first appliedCount commands were applied even if err != nil,
+	// they mustn't be applied again
+	if err != nil && appliedCount <= 0 {
+		return true, err
+	}
+	partial := appliedCount < len(commandEntries)
+	r.results.deliver(commands, appliedCount)
 
 	// update lastApplied
-	var count uint64
-	for _, entry := range entries {
-		if entry.Type == logEntryTypeCommand {
-			appliedCount--
-		}
-		count++
-		if appliedCount == 0 {
-			break
+	// trailing configuration entries are applied along with the batch
+	count := uint64(len(entries))
+	if partial {
+		count = 0
+		for remaining := appliedCount; remaining > 0; count++ {
+			entry := entries[count]
+			if entry.Type == logEntryTypeCommand && !duplicates[entry.Index] {
+				remaining--
+			}
 		}
 	}
 	r.SetLastApplied(lastApplied + count)
-	return nil
+	r.metrics.SetGauge(MetricLastApplied, float64(lastApplied+count))
+	r.gaugeApplyBacklog()
+	r.snapshotPolicy.applied(lastApplied + count)
+	if err != nil {
+		return true, err
+	}
+	return end == commitIndex || partial, nil
 }
 
 // sendRPCArgs
@@ -411,8 +843,8 @@ func (r *raft) sendRPCArgs(args rpcArgs) {
 // 		set currentTerm = T, convert to follower (§5.1)
 func (r *raft) reactToRPCArgs(args rpcArgs) (server server, converted bool, err error) {
 	if args.getTerm() > r.GetCurrentTerm() {
-		r.debug("React to args(term: %d, type: %q)",
-			args.getTerm(), args.getType())
+		r.log(LogElection).Debug("React to args",
+			"argsTerm", args.getTerm(), "type", args.getType())
 		server, err = r.toFollower(args.getTerm())
 		if err != nil {
 			return nil, false, err
@@ -430,6 +862,7 @@ func (r *raft) newRPCService() RPCService {
 
 func (r *raft) toFollower(term uint64, votedFor ...RaftId) (server, error) {
 	r.SetCurrentTerm(term)
+	r.metrics.SetGauge(MetricTerm, float64(term))
 	if len(votedFor) > 0 {
 		err := r.SetVotedFor(votedFor[0])
 		if err != nil {
@@ -440,7 +873,7 @@ func (r *raft) toFollower(term uint64, votedFor ...RaftId) (server, error) {
 		raft: r,
 	}
 	server.ResetTimer()
-	defer r.debug("Convert to follower")
+	defer r.log(LogElection).Info("Convert to follower")
 
 	return server, nil
 }
@@ -454,29 +887,47 @@ func (r *raft) toFollower(term uint64, votedFor ...RaftId) (server, error) {
 // • Vote for self
 //
 // • Reset election timer
-func (r *raft) toCandidate() server {
-	defer r.debug("Convert to candidate")
-
-	nextTerm := r.GetCurrentTerm() + 1
-	r.SetCurrentTerm(nextTerm)
-	id := r.Id()
-	r.SetVotedFor(id)
+func (r *raft) toCandidate() (server, error) {
+	nextTerm := r.GetCurrentTerm()
+	// may have voted in a later term that is not current yet
+	if voteTerm, _ := r.GetVote(); voteTerm > nextTerm {
+		nextTerm = voteTerm
+	}
+	nextTerm++
+	// the new term and the vote for self are durable before
+	// any RequestVote is sent
+	err := r.SetVote(nextTerm, r.Id())
+	if err != nil {
+		return nil, err
+	}
+	err = r.SetCurrentTerm(nextTerm)
+	if err != nil {
+		return nil, err
+	}
+	defer r.log(LogElection).Info("Convert to candidate")
+	r.metrics.IncrCounter(MetricElections, 1)
+	r.metrics.SetGauge(MetricTerm, float64(nextTerm))
 	server := &candidate{
 		raft: r,
 	}
 	server.ResetTimer()
-	return server
+	return server, nil
 }
 
 // toLeader
 func (r *raft) toLeader() (server, error) {
-	defer r.debug("Convert to leader")
+	defer r.log(LogElection).Info("Convert to leader")
+	r.metrics.IncrCounter(MetricLeaderChanges, 1)
 
 	var mux sync.Mutex
 	server := &leader{
 		raft:            r,
 		ccm:             &mux,
 		jointCommitCond: sync.NewCond(&mux),
+		contact:         contactTracker{since: r.now()},
+		pacer:           r.newHeartbeatPacer(),
+		batcher:         r.newProposalBatcher(),
+		termCommitted:   make(chan struct{}),
 	}
 
 	// Volatile state on leaders:
@@ -486,12 +937,21 @@ func (r *raft) toLeader() (server, error) {
 		return nil, err
 	}
 
-	peers := r.configs.GetConfig().GetPeers()
-	for _, peer := range peers {
+	config := r.configs.GetConfig()
+	for _, peer := range config.GetPeers() {
 		server.nextIndex.Store(peer.Id, lastLogIndex+1)
 		server.matchIndex.Store(peer.Id, 0)
 	}
 
+	reason := LeadershipReasonElection
+	if config.IsStandalone(r.Id()) {
+		reason = LeadershipReasonStandalone
+	} else if r.transfer.inTerm(r.GetCurrentTerm() - 1) {
+		reason = LeadershipReasonTransfer
+	}
+	r.recordLeadership(r.GetCurrentTerm(), r.Id(), lastLogIndex+1, reason)
+	server.warmStart(lastLogIndex)
+
 	server.ResetTimer()
 	return server, nil
 }
@@ -502,37 +962,24 @@ func (r *raft) heartbeatTimeout() time.Duration {
 }
 
 // randomElectionTimeout 随机选举超时
+// 连续竞选失败后使用 CampaignStrategy 决定的区间
 func (r *raft) randomElectionTimeout() time.Duration {
-	start := r.electionTimeout[0]
-	end := r.electionTimeout[1]
-	d := rand.Int63n(int64(end - start))
-	return start + time.Duration(d)
-}
-
-// debug
-func (r *raft) debug(format string, args ...interface{}) {
-	format = fmt.Sprintf("%s %s", r.who(), format)
-	r.logger.Debug(format, args...)
-}
-
-// who
-func (r *raft) who() string {
-	// raftId:term:state
-	var state string
-	if r.GetServer() != nil {
-		state = r.GetServer().String()
+	timeout := r.campaign.electionTimeout(r.electionTimeout)
+	start := timeout[0]
+	end := timeout[1]
+	var d int64
+	if r.random != nil {
+		d = r.random(int64(end - start))
+	} else {
+		d = rand.Int63n(int64(end - start))
 	}
-	for i := 9 - len(state); i > 0; i-- {
-		state += " "
-	}
-
-	return fmt.Sprintf("[%s:%d:%d:%d:%s]", r.Id(), r.GetCurrentTerm(), r.GetCommitIndex(), r.GetLastApplied(), state)
+	return start + time.Duration(d)
 }
 
 // ChangeConfig add added and remove removed
 func (r *raft) ChangeConfig(ctx context.Context, added []RaftPeer, removed []RaftId) error {
 	if !r.GetServer().IsLeader() {
-		return ErrIsNotLeader
+		return r.notLeader()
 	}
 
 	return r.GetServer().ChangeConfig(ctx, added, removed)
@@ -545,7 +992,7 @@ func (r *raft) ChangeConfig(ctx context.Context, added []RaftPeer, removed []Raf
 // of hearing from a current leader, it does not update its
 // term or grant its vote.
 func (r *raft) refreshLastHeartbeat() {
-	atomic.StoreInt64(&r.lastHeartbeat, time.Now().UnixMilli())
+	atomic.StoreInt64(&r.lastHeartbeat, r.now().UnixMilli())
 }
 
 // isLeaderActive
@@ -556,5 +1003,5 @@ func (r *raft) refreshLastHeartbeat() {
 // term or grant its vote.
 func (r *raft) isLeaderActive() bool {
 	lastHeartbeatTime := time.UnixMilli(atomic.LoadInt64(&r.lastHeartbeat))
-	return time.Since(lastHeartbeatTime) < r.electionTimeout[0]
+	return r.now().Sub(lastHeartbeatTime) < r.electionTimeout[0]
 }
@@ -122,6 +122,214 @@ func TestHandle(t *testing.T) {
 	})
 }
 
+func TestStandalone(t *testing.T) {
+	cluster := newCluster(t, map[RaftId]RaftAddr{"1": ":5090"})
+	defer cluster.Stop()
+	agent := cluster.agents[0]
+	go func() {
+		err := agent.Run()
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+	cluster.waitLeaderShip()
+
+	const n = 100
+	for i := 0; i < n; i++ {
+		command := Command(fmt.Sprintf("command %d", i))
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		err := cluster.Handle(ctx, command)
+		cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if agent.length() != n {
+		t.Errorf("expect apply %d commands, got %d", n, agent.length())
+	}
+}
+
+func TestTransferLeadership(t *testing.T) {
+	peers := map[RaftId]RaftAddr{
+		"1": ":5210",
+		"2": ":5220",
+		"3": ":5230",
+	}
+	cluster := newCluster(t, peers)
+	defer cluster.Stop()
+	go func() {
+		err := cluster.Run()
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+	cluster.waitLeaderShip()
+	time.Sleep(1 * time.Second)
+
+	for i := 0; i < 10; i++ {
+		err := cluster.Handle(context.Background(), Command(fmt.Sprintf("command %d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	old, ok := cluster.getLeader()
+	if !ok {
+		t.Fatal("get leader failed")
+	}
+	var target Raft
+	for _, agent := range cluster.agents {
+		if agent.raft.Id() != old.Id() {
+			target = agent.raft
+			break
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := old.(*raft).GetServer().(*leader).transferLeadership(ctx, target.Id())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for !target.IsLeader() {
+		if time.Now().After(deadline) {
+			t.Fatalf("expect %s to be leader", target.Id())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Run("warm start", func(t *testing.T) {
+		l, ok := target.(*raft).GetServer().(*leader)
+		if !ok {
+			t.Skip("leadership changed again")
+		}
+		matchIndex, _ := l.matchIndex.Load(old.Id())
+		if matchIndex == 0 {
+			t.Errorf("expect transferred matchIndex of %s but got 0", old.Id())
+		}
+	})
+}
+
+func TestReadIndexIdleLeader(t *testing.T) {
+	peers := map[RaftId]RaftAddr{
+		"1": ":5410",
+		"2": ":5420",
+		"3": ":5430",
+	}
+	cluster := newCluster(t, peers)
+	defer cluster.Stop()
+	go func() {
+		err := cluster.Run()
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+	cluster.waitLeaderShip()
+	leader, ok := cluster.getLeader()
+	if !ok {
+		t.Fatal("get leader failed")
+	}
+
+	// no command has been handled in the leader's term
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	index, err := leader.ReadIndex(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := leader.(*raft)
+	term, err := r.Get(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if term != r.GetCurrentTerm() {
+		t.Errorf("expect read index in term %d but got term %d", r.GetCurrentTerm(), term)
+	}
+}
+
+func TestReadIndex(t *testing.T) {
+	peers := map[RaftId]RaftAddr{
+		"1": ":5310",
+		"2": ":5320",
+		"3": ":5330",
+	}
+	cluster := newCluster(t, peers)
+	defer cluster.Stop()
+	go func() {
+		err := cluster.Run()
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+	cluster.waitLeaderShip()
+	time.Sleep(1 * time.Second)
+
+	err := cluster.Handle(context.Background(), Command("command"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	leader, ok := cluster.getLeader()
+	if !ok {
+		t.Fatal("get leader failed")
+	}
+	commitIndex := leader.(*raft).GetCommitIndex()
+
+	const n = 100
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			index, err := leader.ReadIndex(ctx)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if index != commitIndex {
+				t.Errorf("expect read index %d but got %d", commitIndex, index)
+			}
+		}()
+	}
+	wg.Wait()
+
+	follower, ok := cluster.getFollower()
+	if !ok {
+		t.Fatal("get follower failed")
+	}
+	_, err = follower.ReadIndex(context.Background())
+	if !errors.Is(err, ErrIsNotLeader) {
+		t.Errorf("expect %v but got %v", ErrIsNotLeader, err)
+	}
+}
+
+func TestDevMode(t *testing.T) {
+	var agent agent
+	raft, err := New("dev", "dev", agent.apply, nil, nil, WithDevMode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent.raft = raft
+	defer agent.Stop()
+	go func() {
+		// stopped before running if the test finishes first
+		err := agent.Run()
+		if err != nil && !errors.Is(err, ErrStopped) {
+			t.Error(err)
+		}
+	}()
+
+	err = raft.Handle(context.Background(), Command("command"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if agent.length() != 1 {
+		t.Errorf("expect apply %d command, got %d", 1, agent.length())
+	}
+}
+
 func newCluster(t *testing.T, peers map[RaftId]RaftAddr) *cluster {
 	t.Helper()
 
@@ -227,7 +435,13 @@ func (c *cluster) Run() error {
 	}
 	err := leader.ChangeConfig(context.Background(), added, nil)
 	if err != nil {
-		return err
+		select {
+		case <-leader.Done():
+			// stopped while changing configuration
+			return nil
+		default:
+			return err
+		}
 	}
 
 	return <-errCh
@@ -0,0 +1,139 @@
+// Package raftbolt 基于 BoltDB 的持久化 raft.Log 与 raft.Store
+//
+// 每次写入都在一个 bbolt 事务中完成, 事务提交时 fsync,
+// 节点崩溃重启后 currentTerm, votedFor 与 log 均不会丢失.
+//
+//	db, err := raftbolt.Open(filepath.Join(dir, "raft.db"))
+//	if err != nil {
+//		return err
+//	}
+//	defer db.Close()
+//	r, err := raft.New(id, addr, apply, db.Store(), db.Log())
+//
+// DB 实现 raft.GroupStorage, raft.MultiRaft 的各组共用一个数据库文件, 见 DB.Group.
+//
+// 该包是独立的 module, 使用 raft 本身不需要引入 bbolt 依赖.
+package raftbolt
+
+import (
+	"encoding/binary"
+	"os"
+	"time"
+
+	"github.com/mind1949/raft"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bucketLogs  = []byte("logs")
+	bucketStore = []byte("store")
+	bucketMeta  = []byte("meta")
+)
+
+// OptFn DB 配置可选项
+type OptFn func(*opts)
+
+// WithFileMode 数据库文件不存在时以 mode 创建, 默认 0600
+func WithFileMode(mode os.FileMode) OptFn {
+	return func(o *opts) {
+		o.mode = mode
+	}
+}
+
+// WithOpenTimeout 等待数据库文件锁的超时, 默认一直等待
+func WithOpenTimeout(timeout time.Duration) OptFn {
+	return func(o *opts) {
+		o.timeout = timeout
+	}
+}
+
+type opts struct {
+	mode    os.FileMode
+	timeout time.Duration
+}
+
+// DB 保存 raft log 与 raft store 的 BoltDB 数据库
+type DB struct {
+	db    *bolt.DB
+	log   *Log
+	store *Store
+}
+
+// Open 打开 path 处的数据库, 不存在时创建
+func Open(path string, optFns ...OptFn) (*DB, error) {
+	o := &opts{mode: 0o600}
+	for _, fn := range optFns {
+		fn(o)
+	}
+
+	db, err := bolt.Open(path, o.mode, &bolt.Options{Timeout: o.timeout})
+	if err != nil {
+		return nil, err
+	}
+	err = createBuckets(db, bucketLogs, bucketStore, bucketMeta)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &DB{
+		db:    db,
+		log:   &Log{db: db, logs: bucketLogs, meta: bucketMeta},
+		store: &Store{db: db, bucket: bucketStore},
+	}, nil
+}
+
+func createBuckets(db *bolt.DB, names ...[]byte) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		for _, name := range names {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Log 返回持久化的 raft.Log
+func (d *DB) Log() *Log {
+	return d.log
+}
+
+// Store 返回持久化的 raft.Store
+func (d *DB) Store() *Store {
+	return d.store
+}
+
+var _ raft.GroupStorage = (*DB)(nil)
+
+// Group 返回 raft.MultiRaft 中组 group 的 Store 与 Log, 各组的数据保存在独立的 bucket 中
+//
+// 所有组共用一个数据库文件:
+//
+//	m, err := raft.NewMultiRaft(addr, nil, db)
+func (d *DB) Group(group raft.GroupId) (raft.Store, raft.Log, error) {
+	prefix := "group/" + string(group) + "/"
+	logs, store, meta := []byte(prefix+"logs"), []byte(prefix+"store"), []byte(prefix+"meta")
+	err := createBuckets(d.db, logs, store, meta)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &Store{db: d.db, bucket: store}, &Log{db: d.db, logs: logs, meta: meta}, nil
+}
+
+// Close 关闭数据库
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+func encodeUint64(val uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, val)
+	return b
+}
+
+func decodeUint64(b []byte) uint64 {
+	if len(b) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
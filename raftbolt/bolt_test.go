@@ -0,0 +1,300 @@
+package raftbolt
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mind1949/raft"
+)
+
+func openTestDB(t *testing.T, path string) *DB {
+	t.Helper()
+	db, err := Open(path, WithOpenTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "raft.db")
+	db := openTestDB(t, path)
+
+	store := db.Store()
+	got, err := store.Get([]byte("missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || len(got) != 0 {
+		t.Errorf("expect empty value but got %v", got)
+	}
+	if err := store.Set([]byte("votedFor"), []byte("node-1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetUint64([]byte("currentTerm"), 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openTestDB(t, path)
+	defer db.Close()
+	store = db.Store()
+	got, err = store.Get([]byte("votedFor"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "node-1" {
+		t.Errorf("expect votedFor node-1 but got %q", got)
+	}
+	term, err := store.GetUint64([]byte("currentTerm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if term != 7 {
+		t.Errorf("expect currentTerm 7 but got %d", term)
+	}
+}
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "raft.db")
+	db := openTestDB(t, path)
+	defer func() { db.Close() }()
+	log := db.Log()
+
+	expectLast := func(t *testing.T, index, term uint64) {
+		t.Helper()
+		gotIndex, gotTerm, err := log.Last()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gotIndex != index || gotTerm != term {
+			t.Errorf("expect last (%d, %d) but got (%d, %d)", index, term, gotIndex, gotTerm)
+		}
+	}
+	expectTerms := func(t *testing.T, terms map[uint64]uint64) {
+		t.Helper()
+		for index, term := range terms {
+			got, err := log.Get(index)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != term {
+				t.Errorf("Get(%d), expect %d but got %d", index, term, got)
+			}
+		}
+	}
+
+	t.Run("empty log", func(t *testing.T) {
+		expectLast(t, 0, 0)
+		expectTerms(t, map[uint64]uint64{0: 0, 1: 0, 100: 0})
+		entries, err := log.RangeGet(0, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entries != nil {
+			t.Errorf("expect nil but got %v", entries)
+		}
+		first, err := log.FirstIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first != 1 {
+			t.Errorf("expect first index 1 but got %d", first)
+		}
+	})
+
+	t.Run("append", func(t *testing.T) {
+		err := log.Append(raft.LogEntry{Term: 1, Command: raft.Command("a")}, raft.LogEntry{Term: 1, Command: raft.Command("b")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		index, err := log.AppendEntry(raft.LogEntry{Term: 2, Command: raft.Command("c")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if index != 3 {
+			t.Errorf("expect index 3 but got %d", index)
+		}
+		expectLast(t, 3, 2)
+		expectTerms(t, map[uint64]uint64{1: 1, 2: 1, 3: 2, 4: 0})
+
+		entries, err := log.RangeGet(1, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2 || string(entries[0].Command) != "b" || entries[1].Index != 3 {
+			t.Errorf("expect entries b, c but got %+v", entries)
+		}
+		match, err := log.Match(3, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !match {
+			t.Error("expect match (3, 2)")
+		}
+		match, err = log.Match(3, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if match {
+			t.Error("expect mismatch (3, 1)")
+		}
+	})
+
+	t.Run("append after", func(t *testing.T) {
+		err := log.AppendAfter(2, raft.LogEntry{Term: 3}, raft.LogEntry{Term: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectLast(t, 4, 3)
+		expectTerms(t, map[uint64]uint64{2: 1, 3: 3, 4: 3})
+
+		err = log.AppendAfter(10, raft.LogEntry{Term: 3})
+		if !errors.Is(err, ErrAppendOutOfRange) {
+			t.Errorf("expect %v but got %v", ErrAppendOutOfRange, err)
+		}
+	})
+
+	t.Run("compact", func(t *testing.T) {
+		if err := log.Compact(2); err != nil {
+			t.Fatal(err)
+		}
+		first, err := log.FirstIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first != 3 {
+			t.Errorf("expect first index 3 but got %d", first)
+		}
+		expectTerms(t, map[uint64]uint64{1: 0, 2: 1, 3: 3})
+
+		// entries covered by compaction are skipped
+		if err := log.AppendAfter(1, raft.LogEntry{Term: 1}, raft.LogEntry{Term: 3}, raft.LogEntry{Term: 4}); err != nil {
+			t.Fatal(err)
+		}
+		expectLast(t, 4, 4)
+
+		err = log.Compact(10)
+		if !errors.Is(err, raft.ErrCompactBeyondLastIndex) {
+			t.Errorf("expect %v but got %v", raft.ErrCompactBeyondLastIndex, err)
+		}
+	})
+
+	t.Run("restart", func(t *testing.T) {
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+		db = openTestDB(t, path)
+		log = db.Log()
+
+		expectLast(t, 4, 4)
+		expectTerms(t, map[uint64]uint64{2: 1, 3: 3, 4: 4})
+	})
+
+	t.Run("truncate prefix", func(t *testing.T) {
+		if err := log.TruncatePrefix(3, 3); err != nil {
+			t.Fatal(err)
+		}
+		expectLast(t, 4, 4)
+		expectTerms(t, map[uint64]uint64{3: 3, 4: 4})
+
+		// mismatched snapshot discards the whole log
+		if err := log.TruncatePrefix(8, 5); err != nil {
+			t.Fatal(err)
+		}
+		expectLast(t, 8, 5)
+		entries, err := log.RangeGet(0, 8)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entries != nil {
+			t.Errorf("expect nil but got %v", entries)
+		}
+	})
+}
+
+func TestRestartRaft(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "raft.db")
+	db := openTestDB(t, path)
+
+	apply := func(commands raft.Commands) (int, error) { return len(commands.Data()), nil }
+	r, err := raft.New("raftbolt", "raftbolt", apply, db.Store(), db.Log(), raft.WithDevMode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go r.Run()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.Handle(ctx, raft.Command("a")); err != nil {
+		t.Fatal(err)
+	}
+	before := r.Stats()
+	r.Stop()
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openTestDB(t, path)
+	defer db.Close()
+	r, err = raft.New("raftbolt", "raftbolt", apply, db.Store(), db.Log())
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := r.Stats()
+	if after.Term != before.Term {
+		t.Errorf("expect term %d but got %d", before.Term, after.Term)
+	}
+	if after.LastLogIndex != before.LastLogIndex {
+		t.Errorf("expect last log index %d but got %d", before.LastLogIndex, after.LastLogIndex)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "raft.db")
+	db := openTestDB(t, path)
+
+	store1, log1, err := db.Group("g1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store2, log2, err := db.Group("g2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store1.SetUint64([]byte("currentTerm"), 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := log1.AppendEntry(raft.LogEntry{Term: 3, Command: raft.Command("a")}); err != nil {
+		t.Fatal(err)
+	}
+	if term, err := store2.GetUint64([]byte("currentTerm")); err != nil || term != 0 {
+		t.Errorf("expect groups isolated but got term %d, err %v", term, err)
+	}
+	if index, _, err := log2.Last(); err != nil || index != 0 {
+		t.Errorf("expect groups isolated but got last index %d, err %v", index, err)
+	}
+	if index, _, err := db.Log().Last(); err != nil || index != 0 {
+		t.Errorf("expect default log isolated but got last index %d, err %v", index, err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openTestDB(t, path)
+	defer db.Close()
+	store1, log1, err = db.Group("g1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if term, err := store1.GetUint64([]byte("currentTerm")); err != nil || term != 3 {
+		t.Errorf("expect term 3 but got %d, err %v", term, err)
+	}
+	if index, term, err := log1.Last(); err != nil || index != 1 || term != 3 {
+		t.Errorf("expect last log entry (1, 3) but got (%d, %d), err %v", index, term, err)
+	}
+}
@@ -0,0 +1,12 @@
+module github.com/mind1949/raft/raftbolt
+
+go 1.21
+
+require (
+	github.com/mind1949/raft v0.0.0
+	go.etcd.io/bbolt v1.3.9
+)
+
+require golang.org/x/sys v0.16.0 // indirect
+
+replace github.com/mind1949/raft => ../
@@ -0,0 +1,319 @@
+package raftbolt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/mind1949/raft"
+	bolt "go.etcd.io/bbolt"
+)
+
+var ErrAppendOutOfRange = errors.New("err: append after index out of range")
+
+var (
+	// keyPrevIndex, keyPrevTerm 第一个保留的 log entry 之前的 log entry(已被快照覆盖)
+	keyPrevIndex = []byte("prev_index")
+	keyPrevTerm  = []byte("prev_term")
+)
+
+var _ raft.Log = (*Log)(nil)
+
+// Log 持久化的 raft.Log
+//
+// log entry 以索引的大端编码为 key 保存, 压缩与截断后的边界保存在 meta bucket 中.
+type Log struct {
+	db *bolt.DB
+	// logs, meta 保存 log entry 与边界的 bucket
+	logs []byte
+	meta []byte
+}
+
+// Get 获取 raft log 中索引为 index 的 log entry term
+// 若无, 则返回 0, nil
+func (l *Log) Get(index uint64) (term uint64, err error) {
+	err = l.db.View(func(tx *bolt.Tx) error {
+		term, err = l.newTx(tx).term(index)
+		return err
+	})
+	return term, err
+}
+
+// Match 是否有匹配上 term 与 index 的 log entry
+// 被快照覆盖的 log entry 都已 commit, 总是匹配
+func (l *Log) Match(index, term uint64) (match bool, err error) {
+	err = l.db.View(func(tx *bolt.Tx) error {
+		t := l.newTx(tx)
+		prevIndex, prevTerm := t.prev()
+		if index == 0 || index < prevIndex {
+			match = true
+			return nil
+		}
+		if index == prevIndex {
+			match = term == prevTerm
+			return nil
+		}
+		v := t.logs.Get(encodeUint64(index))
+		if v == nil {
+			return nil
+		}
+		entry, err := decodeEntry(v)
+		if err != nil {
+			return err
+		}
+		match = entry.Term == term
+		return nil
+	})
+	return match, err
+}
+
+// Last 返回最后一个 log entry 的 term 与 index
+// 若无, 则返回 0 , 0
+func (l *Log) Last() (index, term uint64, err error) {
+	err = l.db.View(func(tx *bolt.Tx) error {
+		index, term, err = l.newTx(tx).last()
+		return err
+	})
+	return index, term, err
+}
+
+// RangeGet 获取在 (i, j] 索引区间的 log entry
+// 若无, 则返回 nil, nil
+func (l *Log) RangeGet(i, j uint64) (entries []raft.LogEntry, err error) {
+	err = l.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(l.logs).Cursor()
+		for k, v := c.Seek(encodeUint64(i + 1)); k != nil && decodeUint64(k) <= j; k, v = c.Next() {
+			entry, err := decodeEntry(v)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// AppendAfter 在afterIndex之后追加 log entry
+// 已被快照覆盖的 log entry 会被跳过
+func (l *Log) AppendAfter(afterIndex uint64, entries ...raft.LogEntry) error {
+	return l.db.Update(func(tx *bolt.Tx) error {
+		t := l.newTx(tx)
+		prevIndex, _ := t.prev()
+		if afterIndex < prevIndex {
+			skip := prevIndex - afterIndex
+			if skip > uint64(len(entries)) {
+				skip = uint64(len(entries))
+			}
+			entries = entries[skip:]
+			afterIndex = prevIndex
+		}
+
+		last, _, err := t.last()
+		if err != nil {
+			return err
+		}
+		if afterIndex > last {
+			return fmt.Errorf("%w: %d", ErrAppendOutOfRange, afterIndex)
+		}
+		if err := t.deleteAfter(afterIndex); err != nil {
+			return err
+		}
+		return t.append(afterIndex, entries)
+	})
+}
+
+// Append 追加log entry
+func (l *Log) Append(entries ...raft.LogEntry) error {
+	return l.db.Update(func(tx *bolt.Tx) error {
+		t := l.newTx(tx)
+		last, _, err := t.last()
+		if err != nil {
+			return err
+		}
+		return t.append(last, entries)
+	})
+}
+
+// AppendEntry 追加一个 log entry , 并返回索引
+func (l *Log) AppendEntry(entry raft.LogEntry) (index uint64, err error) {
+	err = l.db.Update(func(tx *bolt.Tx) error {
+		t := l.newTx(tx)
+		last, _, err := t.last()
+		if err != nil {
+			return err
+		}
+		index = last + 1
+		return t.append(last, []raft.LogEntry{entry})
+	})
+	return index, err
+}
+
+// FirstIndex 返回第一个保留的 log entry 的索引
+func (l *Log) FirstIndex() (index uint64, err error) {
+	err = l.db.View(func(tx *bolt.Tx) error {
+		prevIndex, _ := l.newTx(tx).prev()
+		index = prevIndex + 1
+		return nil
+	})
+	return index, err
+}
+
+// Compact 丢弃索引不大于 upToIndex 的 log entry
+func (l *Log) Compact(upToIndex uint64) error {
+	return l.db.Update(func(tx *bolt.Tx) error {
+		t := l.newTx(tx)
+		prevIndex, _ := t.prev()
+		if upToIndex <= prevIndex {
+			return nil
+		}
+		last, _, err := t.last()
+		if err != nil {
+			return err
+		}
+		if upToIndex > last {
+			return fmt.Errorf("%w: %d", raft.ErrCompactBeyondLastIndex, upToIndex)
+		}
+		term, err := t.term(upToIndex)
+		if err != nil {
+			return err
+		}
+		if err := t.deleteUpTo(upToIndex); err != nil {
+			return err
+		}
+		return t.setPrev(upToIndex, term)
+	})
+}
+
+// TruncatePrefix 丢弃索引不大于 index 的 log entry
+// 若 log 中没有匹配 index 与 term 的 log entry, 丢弃整个 log
+func (l *Log) TruncatePrefix(index, term uint64) error {
+	return l.db.Update(func(tx *bolt.Tx) error {
+		t := l.newTx(tx)
+		prevIndex, _ := t.prev()
+		if index <= prevIndex {
+			return nil
+		}
+
+		target, err := t.term(index)
+		if err != nil {
+			return err
+		}
+		if target == term {
+			err = t.deleteUpTo(index)
+		} else {
+			err = t.deleteAfter(0)
+		}
+		if err != nil {
+			return err
+		}
+		return t.setPrev(index, term)
+	})
+}
+
+// logTx 在一个事务中操作 log
+type logTx struct {
+	logs *bolt.Bucket
+	meta *bolt.Bucket
+}
+
+func (l *Log) newTx(tx *bolt.Tx) *logTx {
+	return &logTx{
+		logs: tx.Bucket(l.logs),
+		meta: tx.Bucket(l.meta),
+	}
+}
+
+func (t *logTx) prev() (index, term uint64) {
+	return decodeUint64(t.meta.Get(keyPrevIndex)), decodeUint64(t.meta.Get(keyPrevTerm))
+}
+
+func (t *logTx) setPrev(index, term uint64) error {
+	if err := t.meta.Put(keyPrevIndex, encodeUint64(index)); err != nil {
+		return err
+	}
+	return t.meta.Put(keyPrevTerm, encodeUint64(term))
+}
+
+func (t *logTx) term(index uint64) (uint64, error) {
+	prevIndex, prevTerm := t.prev()
+	if index == 0 || index < prevIndex {
+		return 0, nil
+	}
+	if index == prevIndex {
+		return prevTerm, nil
+	}
+	v := t.logs.Get(encodeUint64(index))
+	if v == nil {
+		return 0, nil
+	}
+	entry, err := decodeEntry(v)
+	if err != nil {
+		return 0, err
+	}
+	return entry.Term, nil
+}
+
+func (t *logTx) last() (index, term uint64, err error) {
+	k, v := t.logs.Cursor().Last()
+	if k == nil {
+		index, term = t.prev()
+		return index, term, nil
+	}
+	entry, err := decodeEntry(v)
+	if err != nil {
+		return 0, 0, err
+	}
+	return entry.Index, entry.Term, nil
+}
+
+// append 在 afterIndex 之后依序写入 entries, 并设置 entries 的索引
+func (t *logTx) append(afterIndex uint64, entries []raft.LogEntry) error {
+	for i := range entries {
+		entries[i].Index = afterIndex + 1 + uint64(i)
+		v, err := json.Marshal(entries[i])
+		if err != nil {
+			return err
+		}
+		if err := t.logs.Put(encodeUint64(entries[i].Index), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteAfter 删除索引大于 index 的 log entry
+func (t *logTx) deleteAfter(index uint64) error {
+	var keys [][]byte
+	c := t.logs.Cursor()
+	for k, _ := c.Seek(encodeUint64(index + 1)); k != nil; k, _ = c.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+	}
+	return t.delete(keys)
+}
+
+// deleteUpTo 删除索引不大于 index 的 log entry
+func (t *logTx) deleteUpTo(index uint64) error {
+	var keys [][]byte
+	c := t.logs.Cursor()
+	for k, _ := c.First(); k != nil && decodeUint64(k) <= index; k, _ = c.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+	}
+	return t.delete(keys)
+}
+
+// delete 游标遍历时删除会跳过元素, 先收集 key 再删除
+func (t *logTx) delete(keys [][]byte) error {
+	for _, k := range keys {
+		if err := t.logs.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeEntry(v []byte) (raft.LogEntry, error) {
+	var entry raft.LogEntry
+	err := json.Unmarshal(v, &entry)
+	return entry, err
+}
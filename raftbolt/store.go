@@ -0,0 +1,44 @@
+package raftbolt
+
+import (
+	"github.com/mind1949/raft"
+	bolt "go.etcd.io/bbolt"
+)
+
+var _ raft.Store = (*Store)(nil)
+
+// Store 持久化的 raft.Store, 保存 currentTerm 与 votedFor 等
+type Store struct {
+	db     *bolt.DB
+	bucket []byte
+}
+
+func (s *Store) Set(key []byte, val []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(s.bucket).Put(key, val)
+	})
+}
+
+// Get returns the value for key, or an empty byte slice if key was not found.
+func (s *Store) Get(key []byte) ([]byte, error) {
+	val := []byte{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		// bbolt 返回的 value 只在事务内有效
+		val = append(val, tx.Bucket(s.bucket).Get(key)...)
+		return nil
+	})
+	return val, err
+}
+
+func (s *Store) SetUint64(key []byte, val uint64) error {
+	return s.Set(key, encodeUint64(val))
+}
+
+// GetUint64 returns the uint64 value for key, or 0 if key was not found.
+func (s *Store) GetUint64(key []byte) (uint64, error) {
+	val, err := s.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	return decodeUint64(val), nil
+}
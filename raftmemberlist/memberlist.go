@@ -0,0 +1,83 @@
+// Package raftmemberlist 通过 memberlist 发现 peer
+//
+// 以 raft id 作为 memberlist 的节点名, 以 raft rpc 地址作为节点元数据,
+// 将 memberlist 观察到的成员变化转发给 discovery.Discovery:
+//
+//	d := discovery.New()
+//	list, err := memberlist.Create(raftmemberlist.Config(memberlist.DefaultLANConfig(), id, addr, d))
+//	_, err = list.Join(seeds)
+//
+//	r, err := raft.New(id, addr, apply, store, log, raft.WithResolver(d))
+//	go (&discovery.Reconciler{Raft: r, Discovery: d}).Run(ctx)
+package raftmemberlist
+
+import (
+	"github.com/hashicorp/memberlist"
+
+	"github.com/mind1949/raft"
+	"github.com/mind1949/raft/discovery"
+)
+
+// Config 设置 config 的节点名与元数据, 并将成员变化转发给 d
+func Config(config *memberlist.Config, id raft.RaftId, addr raft.RaftAddr, d *discovery.Discovery) *memberlist.Config {
+	config.Name = string(id)
+	config.Delegate = &metaDelegate{addr: addr}
+	config.Events = &EventDelegate{Discovery: d}
+	return config
+}
+
+var _ memberlist.EventDelegate = (*EventDelegate)(nil)
+
+// EventDelegate 将 memberlist 的成员变化转发给 Discovery
+//
+// 忽略没有元数据(raft rpc 地址)的节点
+type EventDelegate struct {
+	Discovery *discovery.Discovery
+}
+
+func (e *EventDelegate) NotifyJoin(n *memberlist.Node) {
+	if m, ok := member(n); ok {
+		e.Discovery.NotifyJoin(m)
+	}
+}
+
+func (e *EventDelegate) NotifyLeave(n *memberlist.Node) {
+	if m, ok := member(n); ok {
+		e.Discovery.NotifyLeave(m)
+	}
+}
+
+func (e *EventDelegate) NotifyUpdate(n *memberlist.Node) {
+	if m, ok := member(n); ok {
+		e.Discovery.NotifyUpdate(m)
+	}
+}
+
+func member(n *memberlist.Node) (discovery.Member, bool) {
+	if len(n.Meta) == 0 {
+		return discovery.Member{}, false
+	}
+	return discovery.Member{Id: raft.RaftId(n.Name), Addr: raft.RaftAddr(n.Meta)}, true
+}
+
+var _ memberlist.Delegate = (*metaDelegate)(nil)
+
+// metaDelegate 以 raft rpc 地址作为节点元数据, 不使用用户消息与状态同步
+type metaDelegate struct {
+	addr raft.RaftAddr
+}
+
+func (d *metaDelegate) NodeMeta(limit int) []byte {
+	if len(d.addr) > limit {
+		return nil
+	}
+	return []byte(d.addr)
+}
+
+func (d *metaDelegate) NotifyMsg([]byte) {}
+
+func (d *metaDelegate) GetBroadcasts(overhead, limit int) [][]byte { return nil }
+
+func (d *metaDelegate) LocalState(join bool) []byte { return nil }
+
+func (d *metaDelegate) MergeRemoteState(buf []byte, join bool) {}
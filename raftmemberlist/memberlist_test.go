@@ -0,0 +1,64 @@
+package raftmemberlist
+
+import (
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+
+	"github.com/mind1949/raft"
+	"github.com/mind1949/raft/discovery"
+)
+
+func TestConfig(t *testing.T) {
+	create := func(t *testing.T, id raft.RaftId) (*memberlist.Memberlist, *discovery.Discovery) {
+		t.Helper()
+		config := memberlist.DefaultLocalConfig()
+		config.BindAddr, config.BindPort = "127.0.0.1", 0
+		config.LogOutput = io.Discard
+		d := discovery.New()
+		list, err := memberlist.Create(Config(config, id, raft.RaftAddr(id+":7000"), d))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { list.Shutdown() })
+		return list, d
+	}
+	next := func(t *testing.T, d *discovery.Discovery, expect discovery.Suggestion) {
+		t.Helper()
+		select {
+		case s := <-d.Suggestions():
+			if s != expect {
+				t.Fatalf("expect %+v but got %+v", expect, s)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expect %+v", expect)
+		}
+	}
+
+	list1, d1 := create(t, "1")
+	list2, _ := create(t, "2")
+	node1 := discovery.Member{Id: "1", Addr: "1:7000"}
+	node2 := discovery.Member{Id: "2", Addr: "2:7000"}
+	next(t, d1, discovery.Suggestion{Type: discovery.SuggestJoin, Member: node1})
+
+	local := list1.LocalNode()
+	_, err := list2.Join([]string{local.Addr.String() + ":" + strconv.Itoa(int(local.Port))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next(t, d1, discovery.Suggestion{Type: discovery.SuggestJoin, Member: node2})
+	if addr, ok := d1.Resolve("2"); !ok || addr != node2.Addr {
+		t.Errorf("expect %q but got %q", node2.Addr, addr)
+	}
+
+	if err := list2.Leave(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	next(t, d1, discovery.Suggestion{Type: discovery.SuggestLeave, Member: node2})
+	if _, ok := d1.Resolve("2"); ok {
+		t.Errorf("expect 2 left")
+	}
+}
@@ -0,0 +1,105 @@
+// Package raftmock 提供 raft 公开接口的可配置假实现, 便于嵌入 raft 的应用在单元测试中
+// 验证集成代码, 无需启动真实的集群
+//
+//	r := raftmock.NewRaft("1", fsm.Apply)
+//	r.FailNext("Handle", raft.ErrIsNotLeader)
+//	r.SetLatency("ReadIndex", 50*time.Millisecond)
+//
+// 每个假实现都嵌入了 Faults, 按方法名注入错误与延迟, 并记录调用次数.
+package raftmock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Faults 可编排的故障, 按方法名(即接口方法的名字, 如 "AppendEntry")注入错误与延迟
+type Faults struct {
+	mux     sync.Mutex
+	next    map[string][]error
+	always  map[string]error
+	latency map[string]time.Duration
+	calls   map[string]int
+}
+
+// FailNext 之后对 method 的调用依次返回 errs, 用完后恢复正常
+func (f *Faults) FailNext(method string, errs ...error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if f.next == nil {
+		f.next = make(map[string][]error)
+	}
+	f.next[method] = append(f.next[method], errs...)
+}
+
+// FailAlways 之后对 method 的调用都返回 err, err 为 nil 时取消
+func (f *Faults) FailAlways(method string, err error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if f.always == nil {
+		f.always = make(map[string]error)
+	}
+	if err == nil {
+		delete(f.always, method)
+		return
+	}
+	f.always[method] = err
+}
+
+// SetLatency 对 method 的调用在返回前等待 d, d 为 0 时取消
+func (f *Faults) SetLatency(method string, d time.Duration) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if f.latency == nil {
+		f.latency = make(map[string]time.Duration)
+	}
+	f.latency[method] = d
+}
+
+// Calls method 被调用的次数
+func (f *Faults) Calls(method string) int {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.calls[method]
+}
+
+// Reset 清除所有故障与调用记录
+func (f *Faults) Reset() {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.next, f.always, f.latency, f.calls = nil, nil, nil, nil
+}
+
+// inject 记录对 method 的调用, 等待设定的延迟, 返回编排的错误
+func (f *Faults) inject(method string) error {
+	return f.injectContext(context.Background(), method)
+}
+
+// injectContext 同 inject, ctx 结束时停止等待并返回 ctx.Err()
+func (f *Faults) injectContext(ctx context.Context, method string) error {
+	f.mux.Lock()
+	if f.calls == nil {
+		f.calls = make(map[string]int)
+	}
+	f.calls[method]++
+	latency := f.latency[method]
+	var err error
+	if errs := f.next[method]; len(errs) > 0 {
+		err, f.next[method] = errs[0], errs[1:]
+	} else {
+		err = f.always[method]
+	}
+	f.mux.Unlock()
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return err
+}
@@ -0,0 +1,134 @@
+package raftmock
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/mind1949/raft"
+)
+
+// NewFSM 创建空的状态机
+func NewFSM() *FSM {
+	return &FSM{}
+}
+
+var _ raft.Snapshotter = (*FSM)(nil)
+
+// FSM 记录所有已应用 command 的状态机, Apply 可作为 raft.Apply 使用
+//
+//	fsm := raftmock.NewFSM()
+//	r, err := raft.New(id, addr, fsm.Apply, store, log, raft.WithSnapshot(fsm, nil))
+type FSM struct {
+	Faults
+
+	mux      sync.Mutex
+	commands []raft.Command
+}
+
+// Apply 依序应用 commands, 每个 command 的结果为应用后已应用的 command 数量
+func (f *FSM) Apply(commands raft.Commands) (int, error) {
+	if err := f.inject("Apply"); err != nil {
+		return 0, err
+	}
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	for i, command := range commands.Data() {
+		f.commands = append(f.commands, command)
+		raft.SetResult(commands, i, len(f.commands))
+	}
+	return len(commands.Data()), nil
+}
+
+// Commands 返回已应用的 command
+func (f *FSM) Commands() []raft.Command {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return append([]raft.Command(nil), f.commands...)
+}
+
+// Snapshot 将已应用的 command 以 json 编码写入 w
+func (f *FSM) Snapshot(w io.Writer) error {
+	if err := f.inject("Snapshot"); err != nil {
+		return err
+	}
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return json.NewEncoder(w).Encode(f.commands)
+}
+
+// Restore 从 Snapshot 写入的数据恢复
+func (f *FSM) Restore(r io.Reader) error {
+	if err := f.inject("Restore"); err != nil {
+		return err
+	}
+	var commands []raft.Command
+	if err := json.NewDecoder(r).Decode(&commands); err != nil {
+		return err
+	}
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.commands = commands
+	return nil
+}
+
+// NewSnapshotStore 创建保存在内存中的 SnapshotStore, 保留所有快照
+func NewSnapshotStore() *SnapshotStore {
+	return &SnapshotStore{store: raft.NewMemorySnapshotStore(int(^uint(0) >> 1))}
+}
+
+var _ raft.SnapshotStore = (*SnapshotStore)(nil)
+
+// SnapshotStore 内存中的 raft.SnapshotStore
+// Commit 的错误通过 "Commit" 注入, 写入的错误通过 "Write" 注入
+type SnapshotStore struct {
+	Faults
+
+	store *raft.MemorySnapshotStore
+}
+
+func (s *SnapshotStore) Create(id string) (raft.SnapshotSink, error) {
+	if err := s.inject("Create"); err != nil {
+		return nil, err
+	}
+	sink, err := s.store.Create(id)
+	if err != nil {
+		return nil, err
+	}
+	return &snapshotSink{SnapshotSink: sink, faults: &s.Faults}, nil
+}
+
+func (s *SnapshotStore) List() ([]raft.SnapshotMeta, error) {
+	if err := s.inject("List"); err != nil {
+		return nil, err
+	}
+	return s.store.List()
+}
+
+func (s *SnapshotStore) Open(id string) (raft.SnapshotMeta, io.ReadCloser, error) {
+	if err := s.inject("Open"); err != nil {
+		return raft.SnapshotMeta{}, nil, err
+	}
+	return s.store.Open(id)
+}
+
+// snapshotSink 注入写入与 Commit 的故障
+type snapshotSink struct {
+	raft.SnapshotSink
+	faults *Faults
+}
+
+func (s *snapshotSink) Write(p []byte) (int, error) {
+	if err := s.faults.inject("Write"); err != nil {
+		return 0, err
+	}
+	return s.SnapshotSink.Write(p)
+}
+
+func (s *snapshotSink) Commit(meta raft.SnapshotMeta) error {
+	if err := s.faults.inject("Commit"); err != nil {
+		s.SnapshotSink.Cancel()
+		return err
+	}
+	return s.SnapshotSink.Commit(meta)
+}
@@ -0,0 +1,257 @@
+package raftmock
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/mind1949/raft"
+)
+
+// NewLog 创建空的内存 Log
+func NewLog() *Log {
+	return &Log{}
+}
+
+var _ raft.Log = (*Log)(nil)
+
+// Log 内存中的 raft.Log, 支持丢弃快照之前的 log entry
+type Log struct {
+	Faults
+
+	mux     sync.Mutex
+	entries []raft.LogEntry
+	// prevIndex, prevTerm 第一个保留的 log entry 之前的 log entry
+	prevIndex uint64
+	prevTerm  uint64
+}
+
+// Entries 返回保留的所有 log entry
+func (l *Log) Entries() []raft.LogEntry {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	return append([]raft.LogEntry(nil), l.entries...)
+}
+
+func (l *Log) Get(index uint64) (term uint64, err error) {
+	if err = l.inject("Get"); err != nil {
+		return 0, err
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	return l.get(index), nil
+}
+
+func (l *Log) get(index uint64) uint64 {
+	switch {
+	case index == 0 || index < l.prevIndex:
+		return 0
+	case index == l.prevIndex:
+		return l.prevTerm
+	case index-l.prevIndex > uint64(len(l.entries)):
+		return 0
+	default:
+		return l.entries[index-l.prevIndex-1].Term
+	}
+}
+
+func (l *Log) Match(index, term uint64) (bool, error) {
+	if err := l.inject("Match"); err != nil {
+		return false, err
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if index == 0 || index < l.prevIndex {
+		return true, nil
+	}
+	if index-l.prevIndex > uint64(len(l.entries)) {
+		return false, nil
+	}
+	return l.get(index) == term, nil
+}
+
+func (l *Log) Last() (index, term uint64, err error) {
+	if err = l.inject("Last"); err != nil {
+		return 0, 0, err
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	index, term = l.last()
+	return index, term, nil
+}
+
+func (l *Log) last() (index, term uint64) {
+	if len(l.entries) == 0 {
+		return l.prevIndex, l.prevTerm
+	}
+	entry := l.entries[len(l.entries)-1]
+	return entry.Index, entry.Term
+}
+
+func (l *Log) RangeGet(i, j uint64) ([]raft.LogEntry, error) {
+	if err := l.inject("RangeGet"); err != nil {
+		return nil, err
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if i < l.prevIndex {
+		i = l.prevIndex
+	}
+	if last, _ := l.last(); j > last {
+		j = last
+	}
+	if j <= i {
+		return nil, nil
+	}
+	return append([]raft.LogEntry(nil), l.entries[i-l.prevIndex:j-l.prevIndex]...), nil
+}
+
+func (l *Log) AppendAfter(afterIndex uint64, entries ...raft.LogEntry) error {
+	if err := l.inject("AppendAfter"); err != nil {
+		return err
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if afterIndex < l.prevIndex {
+		skip := l.prevIndex - afterIndex
+		if skip > uint64(len(entries)) {
+			skip = uint64(len(entries))
+		}
+		entries, afterIndex = entries[skip:], l.prevIndex
+	}
+	if last, _ := l.last(); afterIndex > last {
+		return fmt.Errorf("afterIndex(%d) out of range", afterIndex)
+	}
+	l.entries = l.entries[:afterIndex-l.prevIndex]
+	l.append(entries)
+	return nil
+}
+
+func (l *Log) Append(entries ...raft.LogEntry) error {
+	if err := l.inject("Append"); err != nil {
+		return err
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.append(entries)
+	return nil
+}
+
+func (l *Log) AppendEntry(entry raft.LogEntry) (index uint64, err error) {
+	if err = l.inject("AppendEntry"); err != nil {
+		return 0, err
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.append([]raft.LogEntry{entry})
+	index, _ = l.last()
+	return index, nil
+}
+
+func (l *Log) append(entries []raft.LogEntry) {
+	last, _ := l.last()
+	for i := range entries {
+		entry := entries[i]
+		entry.Index = last + uint64(i) + 1
+		l.entries = append(l.entries, entry)
+	}
+}
+
+// FirstIndex 返回第一个保留的 log entry 的索引
+func (l *Log) FirstIndex() (uint64, error) {
+	if err := l.inject("FirstIndex"); err != nil {
+		return 0, err
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	return l.prevIndex + 1, nil
+}
+
+// Compact 丢弃索引不大于 upToIndex 的 log entry
+func (l *Log) Compact(upToIndex uint64) error {
+	if err := l.inject("Compact"); err != nil {
+		return err
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if upToIndex <= l.prevIndex {
+		return nil
+	}
+	if upToIndex-l.prevIndex > uint64(len(l.entries)) {
+		return fmt.Errorf("%w: %d", raft.ErrCompactBeyondLastIndex, upToIndex)
+	}
+	term := l.get(upToIndex)
+	l.entries = append([]raft.LogEntry(nil), l.entries[upToIndex-l.prevIndex:]...)
+	l.prevIndex, l.prevTerm = upToIndex, term
+	return nil
+}
+
+// TruncatePrefix 丢弃索引不大于 index 的 log entry
+// 若 log 中没有匹配 index 与 term 的 log entry, 丢弃整个 log
+func (l *Log) TruncatePrefix(index, term uint64) error {
+	if err := l.inject("TruncatePrefix"); err != nil {
+		return err
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if index <= l.prevIndex {
+		return nil
+	}
+	if index-l.prevIndex <= uint64(len(l.entries)) && l.get(index) == term {
+		l.entries = append([]raft.LogEntry(nil), l.entries[index-l.prevIndex:]...)
+	} else {
+		l.entries = nil
+	}
+	l.prevIndex, l.prevTerm = index, term
+	return nil
+}
+
+// NewStore 创建空的内存 Store
+func NewStore() *Store {
+	return &Store{m: make(map[string][]byte)}
+}
+
+var _ raft.Store = (*Store)(nil)
+
+// Store 内存中的 raft.Store
+type Store struct {
+	Faults
+
+	mux sync.Mutex
+	m   map[string][]byte
+}
+
+func (s *Store) Set(key []byte, val []byte) error {
+	if err := s.inject("Set"); err != nil {
+		return err
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.m[string(key)] = append([]byte(nil), val...)
+	return nil
+}
+
+// Get returns the value for key, or an empty byte slice if key was not found.
+func (s *Store) Get(key []byte) ([]byte, error) {
+	if err := s.inject("Get"); err != nil {
+		return nil, err
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return append([]byte{}, s.m[string(key)]...), nil
+}
+
+func (s *Store) SetUint64(key []byte, val uint64) error {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, val)
+	return s.Set(key, b)
+}
+
+// GetUint64 returns the uint64 value for key, or 0 if key was not found.
+func (s *Store) GetUint64(key []byte) (uint64, error) {
+	b, err := s.Get(key)
+	if err != nil || len(b) == 0 {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
@@ -0,0 +1,731 @@
+package raftmock
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mind1949/raft"
+)
+
+// NewRaft 创建单节点的 Leader, Handle 的 command 立即 commit 并应用到 apply
+// apply 为 nil 时只记录 command
+func NewRaft(id raft.RaftId, apply raft.Apply) *Raft {
+	r := &Raft{
+		id:      id,
+		addr:    raft.RaftAddr(id),
+		apply:   apply,
+		leader:  true,
+		healthy: true,
+		term:    1,
+		done:    make(chan struct{}),
+	}
+	r.config = raft.Configuration{
+		Peers:     []raft.RaftPeer{{Id: id, Addr: r.addr}},
+		Committed: true,
+	}
+	r.history = []raft.LeadershipRecord{{Term: 1, LeaderId: id, StartIndex: 1, Time: time.Now()}}
+	return r
+}
+
+var (
+	_ raft.Raft           = (*Raft)(nil)
+	_ raft.CommandEntries = (*commands)(nil)
+	_ raft.ResultSetter   = (*commands)(nil)
+)
+
+// Raft 可编排的 raft.Raft
+//
+// 节点的角色与健康状态由 SetLeader, SetHealthy 控制, 非 Leader 时 Handle
+// 返回 raft.ErrIsNotLeader. 每个方法的错误与延迟通过 Faults 按方法名注入.
+type Raft struct {
+	Faults
+
+	mux     sync.Mutex
+	id      raft.RaftId
+	addr    raft.RaftAddr
+	apply   raft.Apply
+	leader  bool
+	healthy bool
+	term    uint64
+	state   raft.LifecycleState
+	entries []raft.LogEntry
+	config  raft.Configuration
+	history []raft.LeadershipRecord
+	hint    raft.RaftPeer
+	learner map[raft.RaftId]raft.LearnerProgress
+
+	quarantined map[raft.RaftId]struct{}
+
+	subscribers []chan raft.Event
+
+	once sync.Once
+	done chan struct{}
+}
+
+// SetLeader 设置是否是 Leader, 成为 Leader 时 term 加一
+// 并向订阅者发布 raft.EventBecameLeader 或 raft.EventBecameFollower 事件
+func (r *Raft) SetLeader(leader bool) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if leader == r.leader {
+		return
+	}
+	r.leader = leader
+	record := raft.LeadershipRecord{Term: r.term, Time: time.Now()}
+	if leader {
+		r.term++
+		record.Term, record.LeaderId = r.term, r.id
+		record.StartIndex = uint64(len(r.entries)) + 1
+	}
+	r.history = append(r.history, record)
+
+	event := raft.Event{Type: raft.EventBecameFollower, Time: record.Time, Id: r.id, Term: r.term}
+	if leader {
+		event.Type, event.FirstIndex = raft.EventBecameLeader, record.StartIndex
+		event.Peer = raft.RaftPeer{Id: r.id, Addr: r.addr}
+	}
+	r.publish(event)
+}
+
+// Publish 向订阅者发布 event, 订阅者缓冲已满时丢弃
+func (r *Raft) Publish(event raft.Event) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.publish(event)
+}
+
+func (r *Raft) publish(event raft.Event) {
+	for _, ch := range r.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// SetLeaderHint 设置非 Leader 时 Leader 返回的 Leader
+// 非 Leader 时拒绝请求返回的 *raft.NotLeaderError 也携带该 Leader
+func (r *Raft) SetLeaderHint(leader raft.RaftPeer) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.hint = leader
+}
+
+// SetHealthy 设置 Healthy 的返回值
+func (r *Raft) SetHealthy(healthy bool) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.healthy = healthy
+}
+
+// SetLearnerProgress 设置 LearnerProgress 与 IsPromotable 使用的 learner 进度
+func (r *Raft) SetLearnerProgress(id raft.RaftId, progress raft.LearnerProgress) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.learner == nil {
+		r.learner = make(map[raft.RaftId]raft.LearnerProgress)
+	}
+	r.learner[id] = progress
+}
+
+// Commands 返回 Handle 成功的所有 command
+func (r *Raft) Commands() []raft.Command {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	var commands []raft.Command
+	for _, entry := range r.entries {
+		commands = append(commands, entry.Command)
+	}
+	return commands
+}
+
+func (r *Raft) Id() raft.RaftId {
+	return r.id
+}
+
+func (r *Raft) Addr() raft.RaftAddr {
+	return r.addr
+}
+
+// Run 阻塞直到 Stop
+func (r *Raft) Run() error {
+	if err := r.inject("Run"); err != nil {
+		return err
+	}
+	r.mux.Lock()
+	switch r.state {
+	case raft.LifecycleCreated:
+		r.state = raft.LifecycleRunning
+	case raft.LifecycleRunning:
+		r.mux.Unlock()
+		return raft.ErrAlreadyRunning
+	default:
+		r.mux.Unlock()
+		return raft.ErrStopped
+	}
+	r.mux.Unlock()
+	<-r.done
+	return nil
+}
+
+func (r *Raft) Stop() {
+	r.once.Do(func() {
+		close(r.done)
+
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		r.state = raft.LifecycleStopped
+		for _, ch := range r.subscribers {
+			close(ch)
+		}
+		r.subscribers = nil
+	})
+}
+
+func (r *Raft) State() raft.LifecycleState {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.state
+}
+
+func (r *Raft) Done() <-chan struct{} {
+	return r.done
+}
+
+// Subscribe 返回接收 SetLeader 与 Publish 发布的事件的 channel, Stop 之后关闭
+func (r *Raft) Subscribe() <-chan raft.Event {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	ch := make(chan raft.Event, 64)
+	select {
+	case <-r.done:
+		close(ch)
+	default:
+		r.subscribers = append(r.subscribers, ch)
+	}
+	return ch
+}
+
+func (r *Raft) Handle(ctx context.Context, cmd ...raft.Command) error {
+	if err := r.injectContext(ctx, "Handle"); err != nil {
+		return err
+	}
+	_, err := r.handle(ctx, cmd...)
+	return err
+}
+
+// Propose 返回 apply 为 cmd 设置的结果, 注入的故障名同 Handle
+func (r *Raft) Propose(ctx context.Context, cmd raft.Command) (raft.Result, error) {
+	if err := r.injectContext(ctx, "Handle"); err != nil {
+		return nil, err
+	}
+	commands, err := r.handle(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	return commands.result(0), nil
+}
+
+// ProposeAsync 同步应用 cmd, 返回已完成的 Future
+func (r *Raft) ProposeAsync(ctx context.Context, cmd raft.Command) raft.Future {
+	f := &future{done: make(chan struct{})}
+	defer close(f.done)
+	if f.err = r.injectContext(ctx, "Handle"); f.err != nil {
+		return f
+	}
+	commands, err := r.handle(ctx, cmd)
+	if err != nil {
+		f.err = err
+		return f
+	}
+	f.index, f.response = commands.entries[0].Index, commands.result(0)
+	return f
+}
+
+// ProposeEntry 直接追加系统 log entry, 返回其索引
+func (r *Raft) ProposeEntry(ctx context.Context, entry raft.LogEntry) (uint64, error) {
+	if err := r.injectContext(ctx, "ProposeEntry"); err != nil {
+		return 0, err
+	}
+	if entry.Type != raft.NewNoopEntry().Type && entry.Type != raft.NewBarrierEntry().Type {
+		return 0, raft.ErrEntryNotProposable
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if !r.leader {
+		return 0, r.notLeader()
+	}
+	entry.Index = uint64(len(r.entries)) + 1
+	entry.Term = r.term
+	entry.AppendTime = time.Now()
+	entry.Proposer = raft.ProposerFromContext(ctx)
+	r.entries = append(r.entries, entry)
+	return entry.Index, nil
+}
+
+func (r *Raft) handle(ctx context.Context, cmd ...raft.Command) (*commands, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if !r.leader {
+		return nil, r.notLeader()
+	}
+	proposer := raft.ProposerFromContext(ctx)
+	entries := &commands{}
+	for _, c := range cmd {
+		entries.entries = append(entries.entries, raft.LogEntry{
+			Index:      uint64(len(r.entries)+len(entries.entries)) + 1,
+			Term:       r.term,
+			Command:    c,
+			AppendTime: time.Now(),
+			Proposer:   proposer,
+		})
+	}
+	if r.apply != nil {
+		if _, err := r.apply(entries); err != nil {
+			return nil, err
+		}
+	}
+	r.entries = append(r.entries, entries.entries...)
+	return entries, nil
+}
+
+func (r *Raft) IsLeader() bool {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.leader
+}
+
+func (r *Raft) Leader() (raft.RaftPeer, bool) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.leader {
+		return raft.RaftPeer{Id: r.id, Addr: r.addr}, true
+	}
+	return r.hint, r.hint.Id != ""
+}
+
+// notLeader 调用方需持有 r.mux
+func (r *Raft) notLeader() error {
+	if r.hint.Id == "" {
+		return raft.ErrIsNotLeader
+	}
+	return &raft.NotLeaderError{Leader: r.hint, Term: r.term}
+}
+
+// LeaseRead 假实现没有租约, 与 LinearizableRead 相同
+func (r *Raft) LeaseRead(ctx context.Context, fn func() error) error {
+	if err := r.injectContext(ctx, "LeaseRead"); err != nil {
+		return err
+	}
+	return r.LinearizableRead(ctx, fn)
+}
+
+// RPCService 假实现不处理 peer 的 rpc 请求, 返回 nil
+func (r *Raft) RPCService() raft.RPCService {
+	return nil
+}
+
+// ReadIndex 返回最后一个 command 的索引
+func (r *Raft) ReadIndex(ctx context.Context) (uint64, error) {
+	if err := r.injectContext(ctx, "ReadIndex"); err != nil {
+		return 0, err
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if !r.leader {
+		return 0, r.notLeader()
+	}
+	return uint64(len(r.entries)), nil
+}
+
+// LinearizableRead command 同步应用, 获取 read index 后直接调用 fn
+func (r *Raft) LinearizableRead(ctx context.Context, fn func() error) error {
+	if _, err := r.ReadIndex(ctx); err != nil {
+		return err
+	}
+	return fn()
+}
+
+// BootstrapCluster NewRaft 创建的节点已初始化, 总是返回 raft.ErrCantBootstrap
+func (r *Raft) BootstrapCluster(configuration raft.Configuration) error {
+	if err := r.inject("BootstrapCluster"); err != nil {
+		return err
+	}
+	return raft.ErrCantBootstrap
+}
+
+// ChangeConfig 直接修改配置
+func (r *Raft) ChangeConfig(ctx context.Context, added []raft.RaftPeer, removed []raft.RaftId) error {
+	if err := r.injectContext(ctx, "ChangeConfig"); err != nil {
+		return err
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if !r.leader {
+		return r.notLeader()
+	}
+	var peers []raft.RaftPeer
+	for _, peer := range r.config.Peers {
+		if !containsId(removed, peer.Id) {
+			peers = append(peers, peer)
+		}
+	}
+	for _, peer := range added {
+		if !containsPeer(peers, peer.Id) {
+			peers = append(peers, peer)
+		}
+	}
+	r.usePeers(peers)
+	return nil
+}
+
+// ChangeConfiguration 当前配置与 old 一致时直接将配置替换为 new
+func (r *Raft) ChangeConfiguration(ctx context.Context, old, new []raft.RaftPeer) error {
+	if err := r.injectContext(ctx, "ChangeConfiguration"); err != nil {
+		return err
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if !r.leader {
+		return r.notLeader()
+	}
+	if len(new) == 0 {
+		return raft.ErrConfigurationEmpty
+	}
+	if len(old) != len(r.config.Peers) {
+		return raft.ErrConfigurationMismatch
+	}
+	for _, peer := range old {
+		if !containsPeer(r.config.Peers, peer.Id) {
+			return raft.ErrConfigurationMismatch
+		}
+	}
+	r.usePeers(append([]raft.RaftPeer(nil), new...))
+	return nil
+}
+
+// AddVoter 直接将 id 加入配置
+func (r *Raft) AddVoter(ctx context.Context, id raft.RaftId, addr raft.RaftAddr) error {
+	if err := r.injectContext(ctx, "AddVoter"); err != nil {
+		return err
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if !r.leader {
+		return r.notLeader()
+	}
+	for _, peer := range r.config.Peers {
+		if peer.Id != id {
+			continue
+		}
+		if peer.Addr != addr {
+			return fmt.Errorf("%w: %s(%s)", raft.ErrServerAddrConflict, peer.Id, peer.Addr)
+		}
+		return nil
+	}
+	r.usePeers(append(r.config.Peers, raft.RaftPeer{Id: id, Addr: addr}))
+	return nil
+}
+
+// RemoveServer 直接将 id 移出配置
+func (r *Raft) RemoveServer(ctx context.Context, id raft.RaftId) error {
+	if err := r.injectContext(ctx, "RemoveServer"); err != nil {
+		return err
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if !r.leader {
+		return r.notLeader()
+	}
+	if !containsPeer(r.config.Peers, id) {
+		return nil
+	}
+	var peers []raft.RaftPeer
+	for _, peer := range r.config.Peers {
+		if peer.Id != id {
+			peers = append(peers, peer)
+		}
+	}
+	r.usePeers(peers)
+	return nil
+}
+
+// usePeers 使用新的配置, 并向订阅者发布 raft.EventPeerAdded, raft.EventPeerRemoved 事件
+func (r *Raft) usePeers(peers []raft.RaftPeer) {
+	pre := r.config.Peers
+	r.config.Peers = peers
+	r.config.Index = uint64(len(r.entries))
+
+	event := raft.Event{Time: time.Now(), Id: r.id, Term: r.term, FirstIndex: r.config.Index}
+	for _, peer := range peers {
+		if !containsPeer(pre, peer.Id) {
+			event.Type, event.Peer = raft.EventPeerAdded, peer
+			r.publish(event)
+		}
+	}
+	for _, peer := range pre {
+		if !containsPeer(peers, peer.Id) {
+			event.Type, event.Peer = raft.EventPeerRemoved, peer
+			r.publish(event)
+		}
+	}
+}
+
+// TransferLeadership 成功时本节点不再是 Leader
+func (r *Raft) TransferLeadership(ctx context.Context, target raft.RaftId) error {
+	if err := r.injectContext(ctx, "TransferLeadership"); err != nil {
+		return err
+	}
+	r.mux.Lock()
+	if !r.leader {
+		r.mux.Unlock()
+		return r.notLeader()
+	}
+	if !containsPeer(r.config.Peers, target) || target == r.id {
+		r.mux.Unlock()
+		return raft.ErrTransferTargetInvalid
+	}
+	r.mux.Unlock()
+	r.SetLeader(false)
+	return nil
+}
+
+func (r *Raft) Healthy() bool {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.healthy
+}
+
+func (r *Raft) UpdatePeerAddress(id raft.RaftId, addr raft.RaftAddr) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for i := range r.config.Peers {
+		if r.config.Peers[i].Id == id {
+			r.config.Peers[i].Addr = addr
+		}
+	}
+}
+
+func (r *Raft) GetConfiguration() raft.Configuration {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	config := r.config
+	config.Peers = append([]raft.RaftPeer(nil), r.config.Peers...)
+	return config
+}
+
+func (r *Raft) LeadershipHistory() []raft.LeadershipRecord {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return append([]raft.LeadershipRecord(nil), r.history...)
+}
+
+func (r *Raft) TermBoundaries() ([]raft.TermBoundary, error) {
+	if err := r.inject("TermBoundaries"); err != nil {
+		return nil, err
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	var boundaries []raft.TermBoundary
+	for _, entry := range r.entries {
+		n := len(boundaries)
+		if n > 0 && boundaries[n-1].Term == entry.Term {
+			boundaries[n-1].LastIndex = entry.Index
+			continue
+		}
+		boundaries = append(boundaries, raft.TermBoundary{Term: entry.Term, FirstIndex: entry.Index, LastIndex: entry.Index})
+	}
+	return boundaries, nil
+}
+
+func (r *Raft) FirstIndexOfTerm(term uint64) (index uint64, ok bool, err error) {
+	boundaries, err := r.TermBoundaries()
+	if err != nil {
+		return 0, false, err
+	}
+	for _, boundary := range boundaries {
+		if boundary.Term == term {
+			return boundary.FirstIndex, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+func (r *Raft) Stats() raft.Status {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	state, leader := "Follower", r.hint
+	if r.leader {
+		state, leader = "Leader", raft.RaftPeer{Id: r.id, Addr: r.addr}
+	}
+	index := uint64(len(r.entries))
+	var lastLogTerm uint64
+	if index > 0 {
+		lastLogTerm = r.entries[index-1].Term
+	}
+	return raft.Status{
+		Id:           r.id,
+		State:        state,
+		Term:         r.term,
+		CommitIndex:  index,
+		LastApplied:  index,
+		LastLogIndex: index,
+		LastLogTerm:  lastLogTerm,
+		Leader:       leader,
+	}
+}
+
+// Snapshot 返回包含所有 command 的快照元数据, 不保存快照数据
+func (r *Raft) Snapshot() (raft.SnapshotMeta, error) {
+	if err := r.inject("Snapshot"); err != nil {
+		return raft.SnapshotMeta{}, err
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if len(r.entries) == 0 {
+		return raft.SnapshotMeta{}, raft.ErrNothingToSnapshot
+	}
+	last := r.entries[len(r.entries)-1]
+	return raft.SnapshotMeta{
+		Id:         string(r.id) + "-snapshot",
+		Index:      last.Index,
+		Term:       last.Term,
+		CreateTime: time.Now(),
+	}, nil
+}
+
+func (r *Raft) Quarantine(id raft.RaftId) error {
+	if id == r.id {
+		return raft.ErrQuarantineSelf
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.quarantined == nil {
+		r.quarantined = make(map[raft.RaftId]struct{})
+	}
+	r.quarantined[id] = struct{}{}
+	return nil
+}
+
+func (r *Raft) Unquarantine(id raft.RaftId) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	delete(r.quarantined, id)
+}
+
+func (r *Raft) Quarantined() []raft.RaftId {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	ids := make([]raft.RaftId, 0, len(r.quarantined))
+	for id := range r.quarantined {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// ListSnapshots Snapshot 不保存快照, 总是返回空
+func (r *Raft) ListSnapshots() ([]raft.SnapshotMeta, error) {
+	return nil, nil
+}
+
+func (r *Raft) OpenSnapshotFSM(id string) (raft.Snapshotter, raft.SnapshotMeta, error) {
+	return nil, raft.SnapshotMeta{}, raft.ErrSnapshotNotFound
+}
+
+func (r *Raft) LearnerProgress(id raft.RaftId) (raft.LearnerProgress, bool) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	progress, ok := r.learner[id]
+	return progress, ok
+}
+
+// IsPromotable learner 没有剩余的 log entry 时可以提升
+func (r *Raft) IsPromotable(id raft.RaftId) bool {
+	progress, ok := r.LearnerProgress(id)
+	return ok && progress.RemainingEntries == 0
+}
+
+// commands 实现 raft.Commands
+type commands struct {
+	entries []raft.LogEntry
+	results []raft.Result
+}
+
+func (c *commands) Data() []raft.Command {
+	data := make([]raft.Command, 0, len(c.entries))
+	for _, entry := range c.entries {
+		data = append(data, entry.Command)
+	}
+	return data
+}
+
+func (c *commands) Entries() []raft.LogEntry {
+	return c.entries
+}
+
+// SetResult i 超出命令序列范围时忽略
+func (c *commands) SetResult(i int, result raft.Result) {
+	if i < 0 || i >= len(c.entries) {
+		return
+	}
+	if c.results == nil {
+		c.results = make([]raft.Result, len(c.entries))
+	}
+	c.results[i] = result
+}
+
+func (c *commands) result(i int) raft.Result {
+	if i >= len(c.results) {
+		return nil
+	}
+	return c.results[i]
+}
+
+func containsId(ids []raft.RaftId, id raft.RaftId) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+func containsPeer(peers []raft.RaftPeer, id raft.RaftId) bool {
+	for _, peer := range peers {
+		if peer.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// future 实现 raft.Future
+type future struct {
+	done     chan struct{}
+	index    uint64
+	response raft.Result
+	err      error
+}
+
+func (f *future) Done() <-chan struct{} {
+	return f.done
+}
+
+func (f *future) Index() uint64 {
+	<-f.done
+	return f.index
+}
+
+func (f *future) Err() error {
+	<-f.done
+	return f.err
+}
+
+func (f *future) Response() raft.Result {
+	<-f.done
+	return f.response
+}
@@ -0,0 +1,141 @@
+package raftmock
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mind1949/raft"
+)
+
+func TestFaults(t *testing.T) {
+	var f Faults
+	errA, errB := errors.New("a"), errors.New("b")
+	f.FailNext("Get", errA, errB)
+	f.FailAlways("Set", errA)
+	for _, expect := range []error{errA, errB, nil} {
+		if err := f.inject("Get"); err != expect {
+			t.Errorf("expect %v but got %v", expect, err)
+		}
+	}
+	f.FailAlways("Set", nil)
+	if err := f.inject("Set"); err != nil {
+		t.Errorf("expect no error after cancel but got %v", err)
+	}
+	if calls := f.Calls("Get"); calls != 3 {
+		t.Errorf("expect 3 calls but got %d", calls)
+	}
+
+	f.SetLatency("Handle", time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := f.injectContext(ctx, "Handle"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expect %v but got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestRaft(t *testing.T) {
+	fsm := NewFSM()
+	r := NewRaft("1", fsm.Apply)
+	events := r.Subscribe()
+	ctx := context.Background()
+	err := r.Handle(ctx, raft.Command("a"), raft.Command("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []raft.Command{raft.Command("a"), raft.Command("b")}
+	if got := fsm.Commands(); !reflect.DeepEqual(got, expect) {
+		t.Errorf("expect applied %q but got %q", expect, got)
+	}
+	if index, _ := r.ReadIndex(ctx); index != 2 {
+		t.Errorf("expect read index 2 but got %d", index)
+	}
+	if result, err := r.Propose(ctx, raft.Command("c")); err != nil || result != 3 {
+		t.Errorf("expect result 3 but got (%v, %v)", result, err)
+	}
+	expect = append(expect, raft.Command("c"))
+	if f := r.ProposeAsync(ctx, raft.Command("d")); f.Err() != nil || f.Index() != 4 || f.Response() != 4 {
+		t.Errorf("expect future (4, 4) but got (%d, %v, %v)", f.Index(), f.Response(), f.Err())
+	}
+	expect = append(expect, raft.Command("d"))
+	err = r.LinearizableRead(ctx, func() error {
+		if got := fsm.Commands(); !reflect.DeepEqual(got, expect) {
+			t.Errorf("expect read %q but got %q", expect, got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AddVoter(ctx, "2", "addr-2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AddVoter(ctx, "2", "addr-x"); !errors.Is(err, raft.ErrServerAddrConflict) {
+		t.Errorf("expect %v but got %v", raft.ErrServerAddrConflict, err)
+	}
+	if err := r.RemoveServer(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if peers := r.GetConfiguration().Peers; len(peers) != 1 || peers[0].Id != "2" {
+		t.Errorf("expect peers [2] but got %v", peers)
+	}
+
+	r.SetLeader(false)
+	if err := r.Handle(ctx, raft.Command("c")); err != raft.ErrIsNotLeader {
+		t.Errorf("expect %v but got %v", raft.ErrIsNotLeader, err)
+	}
+	if history := r.LeadershipHistory(); len(history) != 2 || history[1].LeaderId != "" {
+		t.Errorf("expect stepping down recorded but got %+v", history)
+	}
+
+	r.Stop()
+	var types []raft.EventType
+	for event := range events {
+		types = append(types, event.Type)
+	}
+	expectTypes := []raft.EventType{raft.EventPeerAdded, raft.EventPeerRemoved, raft.EventBecameFollower}
+	if !reflect.DeepEqual(types, expectTypes) {
+		t.Errorf("expect events %v but got %v", expectTypes, types)
+	}
+}
+
+// TestRealRaft 使用假的依赖运行真实的 raft
+func TestRealRaft(t *testing.T) {
+	fsm, log := NewFSM(), NewLog()
+	network := NewNetwork()
+	r, err := raft.New("mock", "mock", fsm.Apply, NewStore(), log,
+		raft.WithDevMode(), raft.WithRPC(network.NewRPC()), raft.WithSnapshot(fsm, NewSnapshotStore()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	go r.Run()
+
+	ctx := context.Background()
+	err = r.Handle(ctx, raft.Command("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fsm.Commands(); len(got) != 1 {
+		t.Errorf("expect 1 command applied but got %q", got)
+	}
+
+	injected := errors.New("disk full")
+	log.FailNext("Append", injected)
+	err = r.Handle(ctx, raft.Command("b"))
+	if !errors.Is(err, injected) {
+		t.Errorf("expect %v but got %v", injected, err)
+	}
+
+	fsm.FailNext("Snapshot", injected)
+	_, err = r.Snapshot()
+	if !errors.Is(err, injected) {
+		t.Errorf("expect %v but got %v", injected, err)
+	}
+	meta, err := r.Snapshot()
+	if err != nil || meta.Index != 2 {
+		t.Errorf("expect snapshot at index 2 but got %+v, err: %v", meta, err)
+	}
+}
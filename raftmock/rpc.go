@@ -0,0 +1,173 @@
+package raftmock
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/mind1949/raft"
+)
+
+var (
+	ErrUnreachable = errors.New("err: raftmock address unreachable")
+	ErrAddrInUse   = errors.New("err: raftmock address already in use")
+)
+
+// NewNetwork 创建进程内的网络
+func NewNetwork() *Network {
+	return &Network{
+		services:     make(map[raft.RaftAddr]raft.RPCService),
+		disconnected: make(map[raft.RaftAddr]bool),
+	}
+}
+
+// Network 连接同一网络中的 RPC, 可以断开节点模拟网络分区
+type Network struct {
+	mux          sync.RWMutex
+	services     map[raft.RaftAddr]raft.RPCService
+	disconnected map[raft.RaftAddr]bool
+}
+
+// NewRPC 创建连接到该网络的 RPC
+func (n *Network) NewRPC() *RPC {
+	return &RPC{network: n, closed: make(chan struct{})}
+}
+
+// Disconnect 断开 addr, 之后发往 addr 与从 addr 发出的请求都返回 ErrUnreachable
+func (n *Network) Disconnect(addr raft.RaftAddr) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	n.disconnected[addr] = true
+}
+
+// Reconnect 恢复 addr 的连接
+func (n *Network) Reconnect(addr raft.RaftAddr) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	delete(n.disconnected, addr)
+}
+
+func (n *Network) lookup(from, to raft.RaftAddr) (raft.RPCService, error) {
+	n.mux.RLock()
+	defer n.mux.RUnlock()
+	service, ok := n.services[to]
+	if !ok || n.disconnected[from] || n.disconnected[to] {
+		return nil, ErrUnreachable
+	}
+	return service, nil
+}
+
+var (
+	_ raft.RPC              = (*RPC)(nil)
+	_ raft.TimeoutNowCaller = (*RPC)(nil)
+)
+
+// RPC 通过 Network 调用其他节点的 raft.RPC
+// 调用方法的故障按 "CallAppendEntries" 等方法名注入
+type RPC struct {
+	Faults
+
+	network *Network
+	mux     sync.Mutex
+	addr    raft.RaftAddr
+	service raft.RPCService
+
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (r *RPC) Listen(addr string) error {
+	if err := r.inject("Listen"); err != nil {
+		return err
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.network.mux.Lock()
+	defer r.network.mux.Unlock()
+	if _, ok := r.network.services[raft.RaftAddr(addr)]; ok {
+		return ErrAddrInUse
+	}
+	r.addr = raft.RaftAddr(addr)
+	r.network.services[r.addr] = r.service
+	return nil
+}
+
+func (r *RPC) Serve() error {
+	<-r.closed
+	return nil
+}
+
+func (r *RPC) Register(service raft.RPCService) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.service = service
+	return nil
+}
+
+func (r *RPC) Close() error {
+	r.once.Do(func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		r.network.mux.Lock()
+		defer r.network.mux.Unlock()
+		if r.addr != "" {
+			delete(r.network.services, r.addr)
+		}
+		close(r.closed)
+	})
+	return nil
+}
+
+func (r *RPC) call(method string, addr raft.RaftAddr) (raft.RPCService, error) {
+	if err := r.inject(method); err != nil {
+		return nil, err
+	}
+	r.mux.Lock()
+	from := r.addr
+	r.mux.Unlock()
+	return r.network.lookup(from, addr)
+}
+
+func (r *RPC) CallAppendEntries(addr raft.RaftAddr, args raft.AppendEntriesArgs) (results raft.AppendEntriesResults, err error) {
+	service, err := r.call("CallAppendEntries", addr)
+	if err != nil {
+		return results, err
+	}
+	err = service.AppendEntries(args, &results)
+	return results, err
+}
+
+func (r *RPC) CallRequestVote(addr raft.RaftAddr, args raft.RequestVoteArgs) (results raft.RequestVoteResults, err error) {
+	service, err := r.call("CallRequestVote", addr)
+	if err != nil {
+		return results, err
+	}
+	err = service.RequestVote(args, &results)
+	return results, err
+}
+
+func (r *RPC) CallTimeoutNow(addr raft.RaftAddr, args raft.TimeoutNowArgs) (results raft.TimeoutNowResults, err error) {
+	service, err := r.call("CallTimeoutNow", addr)
+	if err != nil {
+		return results, err
+	}
+	err = raft.ServeTimeoutNow(service, args, &results)
+	return results, err
+}
+
+func (r *RPC) CallInstallSnapshot(addr raft.RaftAddr, args raft.InstallSnapshotArgs) (results raft.InstallSnapshotResults, err error) {
+	service, err := r.call("CallInstallSnapshot", addr)
+	if err != nil {
+		return results, err
+	}
+	err = service.InstallSnapshot(args, &results)
+	return results, err
+}
+
+func (r *RPC) CallPreVote(addr raft.RaftAddr, args raft.PreVoteArgs) (results raft.PreVoteResults, err error) {
+	service, err := r.call("CallPreVote", addr)
+	if err != nil {
+		return results, err
+	}
+	err = service.PreVote(args, &results)
+	return results, err
+}
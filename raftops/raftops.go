@@ -0,0 +1,271 @@
+// Package raftops raft 集群的运维操作
+package raftops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mind1949/raft"
+	"github.com/mind1949/raft/admin"
+)
+
+var (
+	ErrNoLeader  = errors.New("err: cluster has no leader")
+	ErrNoTarget  = errors.New("err: no healthy follower to transfer leadership to")
+	ErrUnhealthy = errors.New("err: cluster is unhealthy")
+)
+
+// Node 集群中的节点
+type Node struct {
+	Id raft.RaftId
+	// Admin 节点 http 管理接口的地址, 见 github.com/mind1949/raft/admin
+	Admin string
+}
+
+// Cluster 运维操作所需的集群访问能力
+type Cluster interface {
+	// Nodes 集群中的所有节点
+	Nodes() []Node
+	// Status 获取节点的状态快照
+	Status(ctx context.Context, node Node) (raft.Status, error)
+	// TransferLeadership 将 leader 节点的 leadership 转移给 target
+	TransferLeadership(ctx context.Context, leader Node, target raft.RaftId) error
+	// Restart 重启节点, 返回时节点已重新启动(不要求已追上 Leader)
+	Restart(ctx context.Context, node Node) error
+}
+
+// NewHTTPCluster 通过 http 管理接口访问的集群, restart 负责重启节点(如调用 systemctl)
+func NewHTTPCluster(nodes []Node, restart func(ctx context.Context, node Node) error) *HTTPCluster {
+	clients := make(map[raft.RaftId]*admin.Client, len(nodes))
+	for _, node := range nodes {
+		clients[node.Id] = admin.NewClient(node.Admin)
+	}
+	return &HTTPCluster{
+		nodes:   nodes,
+		clients: clients,
+		restart: restart,
+	}
+}
+
+var _ Cluster = (*HTTPCluster)(nil)
+
+// HTTPCluster 通过 http 管理接口访问的集群
+type HTTPCluster struct {
+	nodes   []Node
+	clients map[raft.RaftId]*admin.Client
+	restart func(ctx context.Context, node Node) error
+}
+
+func (c *HTTPCluster) Nodes() []Node {
+	return c.nodes
+}
+
+func (c *HTTPCluster) Status(ctx context.Context, node Node) (raft.Status, error) {
+	return c.clients[node.Id].Status(ctx)
+}
+
+func (c *HTTPCluster) TransferLeadership(ctx context.Context, leader Node, target raft.RaftId) error {
+	return c.clients[leader.Id].TransferLeadership(ctx, target)
+}
+
+func (c *HTTPCluster) Restart(ctx context.Context, node Node) error {
+	return c.restart(ctx, node)
+}
+
+// OptFn RollingRestart 的可选项
+type OptFn func(*opts)
+
+// WithPollInterval 检查集群状态的间隔
+func WithPollInterval(interval time.Duration) OptFn {
+	return func(o *opts) {
+		o.pollInterval = interval
+	}
+}
+
+// WithMaxLag 视为健康(已追上 Leader)时允许落后的最大 log entry 数
+func WithMaxLag(lag uint64) OptFn {
+	return func(o *opts) {
+		o.maxLag = lag
+	}
+}
+
+// WithLogf 输出操作进度
+func WithLogf(logf func(format string, args ...interface{})) OptFn {
+	return func(o *opts) {
+		o.logf = logf
+	}
+}
+
+type opts struct {
+	pollInterval time.Duration
+	maxLag       uint64
+	logf         func(format string, args ...interface{})
+}
+
+// RollingRestart 逐个安全地重启集群中的所有节点
+//
+// 先重启 Follower, 最后重启 Leader. 对于每个节点:
+//
+//  1. 等待集群健康: 所有节点可访问, 有 Leader, 且各节点落后 Leader 不超过 maxLag
+//  2. 若节点是 Leader, 将 leadership 转移给落后最少的 Follower, 并等待新 Leader 产生
+//  3. 重启节点
+//  4. 等待节点追上重启时 Leader 的 commitIndex
+//
+// ctx 结束时中止, 已重启的节点不会回滚.
+func RollingRestart(ctx context.Context, cluster Cluster, optFns ...OptFn) error {
+	o := &opts{
+		pollInterval: time.Second,
+		maxLag:       64,
+		logf:         func(string, ...interface{}) {},
+	}
+	for _, fn := range optFns {
+		fn(o)
+	}
+	ops := &rollingRestart{cluster: cluster, opts: o}
+
+	leader, _, err := ops.waitHealthy(ctx)
+	if err != nil {
+		return err
+	}
+	// restart followers first, then the leader
+	var nodes []Node
+	for _, node := range cluster.Nodes() {
+		if node.Id != leader.Id {
+			nodes = append(nodes, node)
+		}
+	}
+	nodes = append(nodes, leader)
+
+	for _, node := range nodes {
+		if err := ops.restart(ctx, node); err != nil {
+			return fmt.Errorf("restart %s: %w", node.Id, err)
+		}
+	}
+	return nil
+}
+
+type rollingRestart struct {
+	cluster Cluster
+	*opts
+}
+
+func (r *rollingRestart) restart(ctx context.Context, node Node) error {
+	leader, status, err := r.waitHealthy(ctx)
+	if err != nil {
+		return err
+	}
+	if leader.Id == node.Id {
+		target, err := r.transferTarget(status[leader.Id])
+		if err != nil {
+			return err
+		}
+		r.logf("transfer leadership from %s to %s", node.Id, target)
+		err = r.cluster.TransferLeadership(ctx, node, target)
+		if err != nil {
+			return err
+		}
+		leader, status, err = r.waitHealthy(ctx)
+		if err != nil {
+			return err
+		}
+		if leader.Id == node.Id {
+			return fmt.Errorf("%s is still leader after leadership transfer", node.Id)
+		}
+	}
+
+	commitIndex := status[leader.Id].CommitIndex
+	r.logf("restart %s", node.Id)
+	if err = r.cluster.Restart(ctx, node); err != nil {
+		return err
+	}
+	r.logf("wait for %s to catch up with commit index %d", node.Id, commitIndex)
+	return r.poll(ctx, func() (bool, error) {
+		s, err := r.cluster.Status(ctx, node)
+		if err != nil {
+			// still starting
+			return false, nil
+		}
+		return s.LastApplied >= commitIndex, nil
+	})
+}
+
+// waitHealthy 等待集群健康, 返回 Leader 与各节点的状态
+func (r *rollingRestart) waitHealthy(ctx context.Context) (leader Node, status map[raft.RaftId]raft.Status, err error) {
+	err = r.poll(ctx, func() (bool, error) {
+		leader, status, err = r.check(ctx)
+		if err != nil {
+			r.logf("wait for cluster to be healthy: %v", err)
+			return false, nil
+		}
+		return true, nil
+	})
+	return leader, status, err
+}
+
+// check 检查集群是否健康
+func (r *rollingRestart) check(ctx context.Context) (leader Node, status map[raft.RaftId]raft.Status, err error) {
+	status = make(map[raft.RaftId]raft.Status)
+	var leaders int
+	for _, node := range r.cluster.Nodes() {
+		s, err := r.cluster.Status(ctx, node)
+		if err != nil {
+			return leader, nil, fmt.Errorf("%w: %s: %v", ErrUnhealthy, node.Id, err)
+		}
+		if s.CatchingUp {
+			return leader, nil, fmt.Errorf("%w: %s is catching up with leader", ErrUnhealthy, node.Id)
+		}
+		status[node.Id] = s
+		if s.State == "Leader" {
+			leader = node
+			leaders++
+		}
+	}
+	if leaders != 1 {
+		return leader, nil, ErrNoLeader
+	}
+	for _, replication := range status[leader.Id].Replication {
+		if replication.Lag > r.maxLag {
+			return leader, nil, fmt.Errorf("%w: %s lags %d entries behind leader",
+				ErrUnhealthy, replication.Id, replication.Lag)
+		}
+	}
+	return leader, status, nil
+}
+
+// transferTarget 选择落后最少的 Follower
+func (r *rollingRestart) transferTarget(leader raft.Status) (raft.RaftId, error) {
+	var (
+		target raft.RaftId
+		lag    uint64
+	)
+	for _, replication := range leader.Replication {
+		if replication.Id == leader.Id {
+			continue
+		}
+		if target == "" || replication.Lag < lag {
+			target, lag = replication.Id, replication.Lag
+		}
+	}
+	if target == "" {
+		return "", ErrNoTarget
+	}
+	return target, nil
+}
+
+// poll 每隔 pollInterval 调用 fn, 直到 fn 返回 true 或 error
+func (r *rollingRestart) poll(ctx context.Context, fn func() (bool, error)) error {
+	for {
+		ok, err := fn()
+		if err != nil || ok {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.pollInterval):
+			// no-op
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package raftops
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mind1949/raft"
+)
+
+// fakeCluster 模拟集群: 重启的节点在下一次查询状态时不可访问, 之后追上 commitIndex
+type fakeCluster struct {
+	mux         sync.Mutex
+	nodes       []Node
+	leader      raft.RaftId
+	commitIndex uint64
+	restarting  map[raft.RaftId]bool
+	restarted   []raft.RaftId
+}
+
+func newFakeCluster(ids ...raft.RaftId) *fakeCluster {
+	c := &fakeCluster{leader: ids[0], commitIndex: 10, restarting: map[raft.RaftId]bool{}}
+	for _, id := range ids {
+		c.nodes = append(c.nodes, Node{Id: id})
+	}
+	return c
+}
+
+func (c *fakeCluster) Nodes() []Node {
+	return c.nodes
+}
+
+func (c *fakeCluster) Status(_ context.Context, node Node) (raft.Status, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.restarting[node.Id] {
+		delete(c.restarting, node.Id)
+		return raft.Status{}, errors.New("connection refused")
+	}
+	status := raft.Status{Id: node.Id, State: "Follower", CommitIndex: c.commitIndex, LastApplied: c.commitIndex}
+	if node.Id == c.leader {
+		status.State = "Leader"
+		for _, n := range c.nodes {
+			status.Replication = append(status.Replication, raft.ReplicationStatus{Id: n.Id, MatchIndex: c.commitIndex})
+		}
+	}
+	return status, nil
+}
+
+func (c *fakeCluster) TransferLeadership(_ context.Context, leader Node, target raft.RaftId) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if leader.Id != c.leader {
+		return raft.ErrIsNotLeader
+	}
+	c.leader = target
+	return nil
+}
+
+func (c *fakeCluster) Restart(_ context.Context, node Node) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if node.Id == c.leader {
+		return errors.New("restarting leader")
+	}
+	c.restarting[node.Id] = true
+	c.restarted = append(c.restarted, node.Id)
+	c.commitIndex++
+	return nil
+}
+
+func TestRollingRestart(t *testing.T) {
+	cluster := newFakeCluster("1", "2", "3")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := RollingRestart(ctx, cluster, WithPollInterval(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []raft.RaftId{"2", "3", "1"}
+	if !reflect.DeepEqual(cluster.restarted, expect) {
+		t.Errorf("expect restart order %v but got %v", expect, cluster.restarted)
+	}
+	if cluster.leader == "1" {
+		t.Errorf("expect leadership transferred away from 1")
+	}
+}
+
+func TestRollingRestartUnhealthy(t *testing.T) {
+	cluster := newFakeCluster("1", "2", "3")
+	cluster.leader = ""
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := RollingRestart(ctx, cluster, WithPollInterval(time.Millisecond))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expect %v but got %v", context.DeadlineExceeded, err)
+	}
+	if len(cluster.restarted) != 0 {
+		t.Errorf("expect no restart on unhealthy cluster but got %v", cluster.restarted)
+	}
+}
@@ -0,0 +1,98 @@
+// Package raftotel 基于 OpenTelemetry 实现 raft.WriteTracer
+//
+//	r, err := raft.New(id, addr, apply, store, log, raft.WithWriteTracer(raftotel.New()))
+//
+// trace 上下文以 W3C Trace Context 格式随 log entry 复制到 Follower,
+// Follower 的 span 与 Leader 的 span 属于同一个 trace.
+package raftotel
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/mind1949/raft"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName 创建 Tracer 的 instrumentation 名称
+const instrumentationName = "github.com/mind1949/raft"
+
+// OptFn New 的可选项
+type OptFn func(*Tracer)
+
+// WithTracerProvider 从 provider 创建 span, 默认使用全局的 TracerProvider
+func WithTracerProvider(provider trace.TracerProvider) OptFn {
+	return func(t *Tracer) {
+		t.tracer = provider.Tracer(instrumentationName)
+	}
+}
+
+// WithPropagator 以 propagator 编码 trace 上下文, 默认为 W3C Trace Context
+func WithPropagator(propagator propagation.TextMapPropagator) OptFn {
+	return func(t *Tracer) {
+		t.propagator = propagator
+	}
+}
+
+var _ raft.WriteTracer = (*Tracer)(nil)
+
+// New 创建 Tracer
+func New(optFns ...OptFn) *Tracer {
+	t := &Tracer{
+		tracer:     otel.GetTracerProvider().Tracer(instrumentationName),
+		propagator: propagation.TraceContext{},
+	}
+	for _, fn := range optFns {
+		fn(t)
+	}
+	return t
+}
+
+// Tracer 为写入的各个阶段创建 OpenTelemetry span
+type Tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// Start 开始 span, labels 作为 span 的属性; 结束时 err 不为 nil 则将 span 标记为错误
+func (t *Tracer) Start(ctx context.Context, name string, labels ...raft.Label) (context.Context, func(err error)) {
+	attrs := make([]attribute.KeyValue, 0, len(labels))
+	for _, label := range labels {
+		attrs = append(attrs, attribute.String(label.Name, label.Value))
+	}
+	ctx, span := t.tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// Inject 以 JSON 编码 propagator 注入的字段
+func (t *Tracer) Inject(ctx context.Context) []byte {
+	carrier := propagation.MapCarrier{}
+	t.propagator.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(carrier)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// Extract 恢复 Inject 编码的 trace 上下文, 无法解码时返回 ctx
+func (t *Tracer) Extract(ctx context.Context, b []byte) context.Context {
+	carrier := propagation.MapCarrier{}
+	if err := json.Unmarshal(b, &carrier); err != nil {
+		return ctx
+	}
+	return t.propagator.Extract(ctx, carrier)
+}
@@ -0,0 +1,55 @@
+package raftotel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mind1949/raft"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := New(WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))))
+	ctx := context.Background()
+
+	t.Run("propagate to followers", func(t *testing.T) {
+		ctx, endPropose := tracer.Start(ctx, raft.SpanPropose, raft.Label{Name: "raft.commands", Value: "1"})
+		carrier := tracer.Inject(ctx)
+		endPropose(nil)
+		if len(carrier) == 0 {
+			t.Fatal("expect trace context injected but got nothing")
+		}
+
+		// on a follower
+		_, endApply := tracer.Start(tracer.Extract(context.Background(), carrier), raft.SpanApply)
+		endApply(errors.New("apply failed"))
+
+		spans := recorder.Ended()
+		if len(spans) != 2 {
+			t.Fatalf("expect 2 spans but got %d", len(spans))
+		}
+		propose, apply := spans[0], spans[1]
+		if apply.Parent().SpanID() != propose.SpanContext().SpanID() || apply.SpanContext().TraceID() != propose.SpanContext().TraceID() {
+			t.Errorf("expect apply span child of propose span but got parent %s", apply.Parent().SpanID())
+		}
+		if attrs := propose.Attributes(); len(attrs) != 1 || attrs[0].Value.AsString() != "1" {
+			t.Errorf("expect attribute raft.commands=1 but got %v", attrs)
+		}
+		if apply.Status().Code != codes.Error {
+			t.Errorf("expect error status but got %v", apply.Status())
+		}
+	})
+
+	t.Run("no trace context", func(t *testing.T) {
+		if carrier := tracer.Inject(context.Background()); carrier != nil {
+			t.Errorf("expect nothing injected but got %q", carrier)
+		}
+		if got := tracer.Extract(ctx, []byte("corrupted")); got != ctx {
+			t.Error("expect ctx unchanged")
+		}
+	})
+}
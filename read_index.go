@@ -0,0 +1,202 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrLeadershipNotConfirmed = errors.New("err: failed to confirm leadership with a majority")
+	ErrReadIndexNotReady      = errors.New("err: leader hasn't committed an entry in its term yet")
+)
+
+// ReadIndex 获取线性一致读的 read index
+//
+// Leader 以当前的 commitIndex 作为 read index, 并通过一轮心跳确认自己仍是 Leader (§6.4).
+// 状态机应用到 read index 之后, 读取状态机即可得到线性一致的结果.
+func (r *raft) ReadIndex(ctx context.Context) (uint64, error) {
+	if r.catchingUp() {
+		return 0, ErrCatchingUp
+	}
+	l, ok := r.GetServer().(*leader)
+	if !ok {
+		return 0, r.notLeader()
+	}
+	return l.readIndex(ctx)
+}
+
+// appliedPollInterval 等待状态机应用到 read index 时检查 lastApplied 的间隔
+const appliedPollInterval = time.Millisecond
+
+// LinearizableRead 获取 read index, 等待状态机应用到 read index 之后调用 fn
+//
+// fn 中读取状态机得到线性一致的结果, 无需经过 Handle 提交 no-op command.
+//
+//	err := r.LinearizableRead(ctx, func() error {
+//		value = fsm.Get(key)
+//		return nil
+//	})
+func (r *raft) LinearizableRead(ctx context.Context, fn func() error) error {
+	index, err := r.ReadIndex(ctx)
+	if err != nil {
+		return err
+	}
+	err = r.waitApplied(ctx, index)
+	if err != nil {
+		return err
+	}
+	return fn()
+}
+
+// waitApplied 等待状态机应用到 index
+func (r *raft) waitApplied(ctx context.Context, index uint64) error {
+	if r.GetLastApplied() >= index {
+		return nil
+	}
+	ticker := time.NewTicker(appliedPollInterval)
+	defer ticker.Stop()
+	for r.GetLastApplied() < index {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-r.Done():
+			return ErrStopped
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// readIndexBatch 共用同一轮 leadership 确认的 ReadIndex 请求
+type readIndexBatch struct {
+	index uint64
+	err   error
+	done  chan struct{}
+}
+
+// readIndexBatcher 合并并发的 ReadIndex 请求
+//
+// 同一时间最多只有一轮 leadership 确认, 确认进行期间到达的请求
+// 合并到下一轮, 下一轮在当前轮结束后立即开始, 并以相同的 read index 返回.
+// 读多的负载不会成倍增加心跳流量.
+type readIndexBatcher struct {
+	mux     sync.Mutex
+	pending *readIndexBatch
+	running bool
+}
+
+// join 加入下一轮确认, start 表示需要开始确认
+func (b *readIndexBatcher) join() (batch *readIndexBatch, start bool) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.pending == nil {
+		b.pending = &readIndexBatch{done: make(chan struct{})}
+	}
+	start = !b.running
+	b.running = true
+	return b.pending, start
+}
+
+// next 取出下一轮需要确认的请求, 没有请求时结束确认
+func (b *readIndexBatcher) next() *readIndexBatch {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	batch := b.pending
+	b.pending = nil
+	if batch == nil {
+		b.running = false
+	}
+	return batch
+}
+
+func (l *leader) readIndex(ctx context.Context) (uint64, error) {
+	err := l.waitTermCommitted(ctx)
+	if err != nil {
+		return 0, err
+	}
+	batch, start := l.reads.join()
+	if start {
+		go l.loopConfirmReads()
+	}
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-batch.done:
+		return batch.index, batch.err
+	}
+}
+
+// loopConfirmReads 逐轮确认 leadership, 直到没有等待中的 ReadIndex 请求
+func (l *leader) loopConfirmReads() {
+	for batch := l.reads.next(); batch != nil; batch = l.reads.next() {
+		batch.index, batch.err = l.confirmReadIndex()
+		close(batch.done)
+	}
+}
+
+// confirmReadIndex 记录 commitIndex 作为 read index, 再确认 leadership
+func (l *leader) confirmReadIndex() (uint64, error) {
+	// the leader must have committed an entry in its term,
+	// otherwise commitIndex may be stale (§6.4)
+	commitIndex := l.GetCommitIndex()
+	term, err := l.Get(commitIndex)
+	if err != nil {
+		return 0, err
+	}
+	if term != l.GetCurrentTerm() {
+		return 0, ErrReadIndexNotReady
+	}
+
+	err = l.confirmLeadership()
+	if err != nil {
+		return 0, err
+	}
+	return commitIndex, nil
+}
+
+// confirmLeadership 向所有 peer 发送心跳, 收到多数派的确认后返回
+func (l *leader) confirmLeadership() error {
+	config := l.configs.GetConfig()
+	if config.IsStandalone(l.Id()) {
+		return nil
+	}
+	term := l.GetCurrentTerm()
+	checksum, err := configChecksum(config)
+	if err != nil {
+		return err
+	}
+	peers := config.GetPeers()
+	ackCh := make(chan RaftId, len(peers))
+	for _, peer := range peers {
+		id, addr := peer.Id, l.resolve(peer)
+		if id == l.Id() {
+			ackCh <- id
+			continue
+		}
+		go func() {
+			results, err := l.heartbeat(id, addr, nil, config.GetIndex(), checksum)
+			if err == nil && results.Term == term {
+				ackCh <- id
+			}
+		}()
+	}
+
+	timeout := time.NewTimer(l.electionTimeout[0])
+	defer timeout.Stop()
+	decider := config.NewDecider()
+	for {
+		select {
+		case <-l.Done():
+			return ErrStopped
+		case <-timeout.C:
+			return ErrLeadershipNotConfirmed
+		case id := <-ackCh:
+			decider.AddVote(id)
+			if decider.HasAchievedMajority() {
+				return nil
+			}
+		}
+	}
+}
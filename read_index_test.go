@@ -0,0 +1,141 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadIndexBatcher(t *testing.T) {
+	var b readIndexBatcher
+
+	first, start := b.join()
+	if !start {
+		t.Errorf("expect first request to start confirmation")
+	}
+	if batch := b.next(); batch != first {
+		t.Errorf("expect first batch")
+	}
+
+	// requests arriving during the confirmation join the next round
+	second, start := b.join()
+	if start {
+		t.Errorf("expect no new confirmation while running")
+	}
+	third, _ := b.join()
+	if second != third {
+		t.Errorf("expect concurrent requests to share a batch")
+	}
+	if batch := b.next(); batch != second {
+		t.Errorf("expect second batch")
+	}
+
+	if batch := b.next(); batch != nil {
+		t.Errorf("expect no pending batch but got %+v", batch)
+	}
+	if _, start = b.join(); !start {
+		t.Errorf("expect confirmation to restart after finishing")
+	}
+}
+
+func TestLinearizableRead(t *testing.T) {
+	fsm := &listFSM{}
+	r, err := New("linearizable-read", "linearizable-read", fsm.apply, nil, nil, WithDevMode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	go r.Run()
+
+	ctx := context.Background()
+	err = r.Handle(ctx, Command("a"), Command("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	err = r.LinearizableRead(ctx, func() error {
+		got = fsm.get()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []string{"a", "b"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("expect %v but got %v", expect, got)
+	}
+
+	t.Run("wait applied", func(t *testing.T) {
+		raft := r.(*raft)
+		ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		err := raft.waitApplied(ctx, raft.GetLastApplied()+1)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expect %v but got %v", context.DeadlineExceeded, err)
+		}
+	})
+
+	t.Run("not leader", func(t *testing.T) {
+		follower, err := New("linearizable-read-follower", "linearizable-read-follower", fsm.apply, &memoryStore{}, &memoryLog{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		called := false
+		err = follower.LinearizableRead(ctx, func() error {
+			called = true
+			return nil
+		})
+		if err == nil || called {
+			t.Errorf("expect follower refuses to read but got %v", err)
+		}
+	})
+}
+
+func TestReadOnIdleLeader(t *testing.T) {
+	r, err := New("idle-read", "idle-read", (&listFSM{}).apply, nil, nil, WithDevMode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	go r.Run()
+
+	follower := runLoopbackFollower(t, "idle-read-follower", WithLeaderLease(0))
+	defer follower.Stop()
+	ctx := context.Background()
+	err = r.AddVoter(ctx, follower.Id(), follower.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the new leader has handled no command in its term
+	err = r.TransferLeadership(ctx, follower.Id())
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for !follower.IsLeader() {
+		if time.Now().After(deadline) {
+			t.Fatal("expect follower became leader")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	called := false
+	err = follower.LinearizableRead(ctx, func() error {
+		called = true
+		return nil
+	})
+	if err != nil || !called {
+		t.Errorf("expect linearizable read on idle leader but got %v", err)
+	}
+	called = false
+	err = follower.LeaseRead(ctx, func() error {
+		called = true
+		return nil
+	})
+	if err != nil || !called {
+		t.Errorf("expect lease read on idle leader but got %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package raft
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+var (
+	ErrNothingToRecover      = errors.New("err: no existing state to recover")
+	ErrInvalidRecoveryConfig = errors.New("err: invalid recovery configuration")
+)
+
+// RecoverCluster 在节点停止时以 configuration 中的 Peers 强制替换集群配置, 用于多数节点永久丢失之后的人工恢复
+//
+// 多数节点不可用时集群无法 commit 配置变更, 只能离线修改: 停止所有存活的节点,
+// 在每个节点的 store 与 log 上以相同的 configuration 调用 RecoverCluster, 再以原有的 store 与 log 重新 New 并 Run.
+// RecoverCluster 以高于已知所有 term 的新 term 在 log 末尾写入 configuration,
+// 节点重启后立即使用该配置, 新配置中的节点可以选出 Leader 并 commit 之前未 commit 的 log entry.
+//
+// 这是不安全的操作: 丢失的节点上已 commit 而存活节点没有的 log entry 会丢失;
+// 丢失的节点恢复后不能以原有的状态重新加入集群, 需清空状态后再通过 ChangeConfig 加入.
+// 节点没有任何 term 与 log 时返回 ErrNothingToRecover, 新集群使用 BootstrapCluster.
+func RecoverCluster(store Store, log Log, configuration Configuration) error {
+	peers := configuration.Peers
+	err := validatePeers(ErrInvalidRecoveryConfig, peers)
+	if err != nil {
+		return err
+	}
+
+	state, err := newState(store)
+	if err != nil {
+		return err
+	}
+	lastIndex, lastTerm, err := log.Last()
+	if err != nil {
+		return err
+	}
+	voteTerm, _ := state.GetVote()
+	term := state.GetCurrentTerm()
+	if term == 0 && voteTerm == 0 && lastIndex == 0 {
+		return ErrNothingToRecover
+	}
+	if voteTerm > term {
+		term = voteTerm
+	}
+	if lastTerm > term {
+		term = lastTerm
+	}
+	// a new term, so that the configuration entry doesn't match an entry of another server
+	term++
+	err = state.SetCurrentTerm(term)
+	if err != nil {
+		return err
+	}
+
+	configs, err := newConfigManager(store)
+	if err != nil {
+		return err
+	}
+	config := &configImpl{peersList: [][]RaftPeer{peers}}
+	entry, err := configs.NewConfigLogEntry(term, config)
+	if err != nil {
+		return err
+	}
+	index, err := log.AppendEntry(*entry)
+	if err != nil {
+		return err
+	}
+	config.SetIndex(index)
+	return configs.UseConfig(config)
+}
+
+// peersFileEntry peers 文件中的一个 peer
+type peersFileEntry struct {
+	Id      RaftId   `json:"id"`
+	Address RaftAddr `json:"address"`
+}
+
+// ReadPeersFile 读取 peers 文件, 得到 RecoverCluster 使用的配置
+//
+// 文件内容为 peer 的 json 数组:
+//
+//	[
+//		{"id": "1", "address": "10.0.0.1:8300"},
+//		{"id": "2", "address": "10.0.0.2:8300"}
+//	]
+func ReadPeersFile(path string) (Configuration, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Configuration{}, err
+	}
+	var entries []peersFileEntry
+	err = json.Unmarshal(b, &entries)
+	if err != nil {
+		return Configuration{}, fmt.Errorf("%w: %s", ErrInvalidRecoveryConfig, err)
+	}
+	peers := make([]RaftPeer, 0, len(entries))
+	for _, entry := range entries {
+		peers = append(peers, RaftPeer{Id: entry.Id, Addr: entry.Address})
+	}
+	err = validatePeers(ErrInvalidRecoveryConfig, peers)
+	if err != nil {
+		return Configuration{}, err
+	}
+	return Configuration{Peers: peers}, nil
+}
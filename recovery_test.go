@@ -0,0 +1,131 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecoverCluster(t *testing.T) {
+	peers := func(ids ...RaftId) Configuration {
+		var configuration Configuration
+		for _, id := range ids {
+			configuration.Peers = append(configuration.Peers, RaftPeer{Id: id, Addr: RaftAddr(id)})
+		}
+		return configuration
+	}
+
+	t.Run("quorum lost", func(t *testing.T) {
+		store, log := &memoryStore{}, &memoryLog{}
+		r, err := New("recover-a", "recover-a", (&listFSM{}).apply, store, log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = r.BootstrapCluster(peers("recover-a", "recover-b", "recover-c"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// an uncommitted entry of a lost leader
+		_, err = log.AppendEntry(LogEntry{Term: 3, Type: logEntryTypeCommand, Command: Command("a")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = r.(*raft).SetCurrentTerm(3)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = RecoverCluster(store, log, peers("recover-a"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, lastTerm, err := log.Last()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lastTerm != 4 {
+			t.Fatalf("expect configuration appended at term 4 but got %d", lastTerm)
+		}
+
+		fsm := &listFSM{}
+		recovered, err := New("recover-a", "recover-a", fsm.apply, store, log,
+			WithRPC(newLoopbackRPC()), WithElection(50*time.Millisecond, 100*time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := recovered.GetConfiguration().Peers; len(got) != 1 {
+			t.Fatalf("expect recovered configuration but got %v", got)
+		}
+		defer recovered.Stop()
+		go recovered.Run()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for !recovered.IsLeader() {
+			if time.Now().After(deadline) {
+				t.Fatal("expect the recovered node elected")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err := recovered.Handle(context.Background(), Command("b")); err != nil {
+			t.Fatal(err)
+		}
+		if got, expect := fsm.get(), []string{"a", "b"}; !reflect.DeepEqual(got, expect) {
+			t.Fatalf("expect %v but got %v", expect, got)
+		}
+	})
+
+	t.Run("nothing to recover", func(t *testing.T) {
+		err := RecoverCluster(&memoryStore{}, &memoryLog{}, peers("recover-empty"))
+		if !errors.Is(err, ErrNothingToRecover) {
+			t.Fatalf("expect %v but got %v", ErrNothingToRecover, err)
+		}
+	})
+
+	t.Run("invalid configuration", func(t *testing.T) {
+		for _, configuration := range []Configuration{
+			{},
+			{Peers: []RaftPeer{{Id: "recover-a"}}},
+			peers("recover-a", "recover-a"),
+		} {
+			err := RecoverCluster(&memoryStore{}, &memoryLog{}, configuration)
+			if !errors.Is(err, ErrInvalidRecoveryConfig) {
+				t.Fatalf("expect %v but got %v", ErrInvalidRecoveryConfig, err)
+			}
+		}
+	})
+}
+
+func TestReadPeersFile(t *testing.T) {
+	write := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "peers.json")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	t.Run("peers", func(t *testing.T) {
+		path := write(t, `[{"id": "1", "address": "10.0.0.1:8300"}, {"id": "2", "address": "10.0.0.2:8300"}]`)
+		configuration, err := ReadPeersFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := []RaftPeer{{Id: "1", Addr: "10.0.0.1:8300"}, {Id: "2", Addr: "10.0.0.2:8300"}}
+		if !reflect.DeepEqual(configuration.Peers, expect) {
+			t.Fatalf("expect %v but got %v", expect, configuration.Peers)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, content := range []string{`{}`, `[]`, `[{"id": "1"}]`} {
+			_, err := ReadPeersFile(write(t, content))
+			if !errors.Is(err, ErrInvalidRecoveryConfig) {
+				t.Fatalf("expect %v for %s but got %v", ErrInvalidRecoveryConfig, content, err)
+			}
+		}
+	})
+}
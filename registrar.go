@@ -0,0 +1,88 @@
+package raft
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Registrar 在外部服务目录(如 Consul, etcd)中登记当前 Leader 的地址,
+// 使外部客户端总能找到可写入的节点
+type Registrar interface {
+	// Register 本节点成为 Leader 时调用
+	Register(ctx context.Context, id RaftId, addr RaftAddr) error
+	// Deregister 本节点不再是 Leader 时调用
+	// 实现需保证不会删除其他节点的登记
+	Deregister(ctx context.Context, id RaftId, addr RaftAddr) error
+}
+
+// registrarTimeout 单次登记的超时时间
+const registrarTimeout = 5 * time.Second
+
+// leaderRegistrar 依序执行 Leader 的登记与注销
+type leaderRegistrar struct {
+	registrar Registrar
+
+	// mux 保证登记与注销依序执行
+	mux sync.Mutex
+	// generation 每次 leadership 变化递增, 只执行最新的变化
+	generation uint64
+}
+
+// switchServer 切换服务状态, 并处理 leadership 变化
+func (r *raft) switchServer(server server) {
+	pre := r.GetServer()
+	r.SetServer(server)
+	if pre != nil && pre.IsLeader() == server.IsLeader() {
+		return
+	}
+	if pre != nil && pre.IsLeader() {
+		r.recordLeadership(r.GetCurrentTerm(), "", 0, LeadershipReasonSteppedDown)
+	}
+	r.onLeadershipChanged(server.IsLeader())
+}
+
+// onLeadershipChanged leadership 发生变化
+func (r *raft) onLeadershipChanged(leading bool) {
+	if r.registrar.registrar == nil {
+		return
+	}
+	generation := atomic.AddUint64(&r.registrar.generation, 1)
+	go func() {
+		r.registrar.mux.Lock()
+		defer r.registrar.mux.Unlock()
+		// superseded by a newer leadership change
+		if atomic.LoadUint64(&r.registrar.generation) != generation {
+			return
+		}
+		r.register(leading)
+	}()
+}
+
+// register 登记或注销 Leader
+func (r *raft) register(leading bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), registrarTimeout)
+	defer cancel()
+
+	var err error
+	if leading {
+		err = r.registrar.registrar.Register(ctx, r.Id(), r.Addr())
+	} else {
+		err = r.registrar.registrar.Deregister(ctx, r.Id(), r.Addr())
+	}
+	if err != nil {
+		r.log(LogGeneral).Warn("Register leader", "leading", leading, "err", err)
+	}
+}
+
+// deregisterOnStop 停止时若仍是 Leader, 同步注销
+func (r *raft) deregisterOnStop() {
+	if r.registrar.registrar == nil || !r.IsLeader() {
+		return
+	}
+	atomic.AddUint64(&r.registrar.generation, 1)
+	r.registrar.mux.Lock()
+	defer r.registrar.mux.Unlock()
+	r.register(false)
+}
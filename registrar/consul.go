@@ -0,0 +1,75 @@
+package registrar
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mind1949/raft"
+)
+
+// NewConsul 创建将 Leader 地址写入 Consul KV 的 Registrar
+// addr 为 Consul agent 的 http 地址, key 为存放 Leader 地址的 key
+func NewConsul(addr, key string) *Consul {
+	return &Consul{
+		Addr:   strings.TrimSuffix(addr, "/"),
+		Key:    strings.TrimPrefix(key, "/"),
+		Client: http.DefaultClient,
+	}
+}
+
+var _ raft.Registrar = (*Consul)(nil)
+
+// Consul 将 Leader 地址写入 Consul KV
+type Consul struct {
+	Addr   string
+	Key    string
+	Client *http.Client
+	// Advertise 登记的地址, 为空时登记 raft rpc 地址
+	Advertise string
+}
+
+func (c *Consul) Register(ctx context.Context, id raft.RaftId, addr raft.RaftAddr) error {
+	url := fmt.Sprintf("%s/v1/kv/%s", c.Addr, c.Key)
+	_, err := do(ctx, c.Client, http.MethodPut, url, strings.NewReader(c.value(addr)))
+	return err
+}
+
+// Deregister 仅当 key 的值仍是本节点地址时, 使用 check-and-set 删除
+func (c *Consul) Deregister(ctx context.Context, id raft.RaftId, addr raft.RaftAddr) error {
+	url := fmt.Sprintf("%s/v1/kv/%s", c.Addr, c.Key)
+	b, err := do(ctx, c.Client, http.MethodGet, url, nil)
+	if err != nil || b == nil {
+		return err
+	}
+	var pairs []struct {
+		ModifyIndex uint64
+		Value       string
+	}
+	err = json.Unmarshal(b, &pairs)
+	if err != nil || len(pairs) == 0 {
+		return err
+	}
+	value, err := base64.StdEncoding.DecodeString(pairs[0].Value)
+	if err != nil {
+		return err
+	}
+	if string(value) != c.value(addr) {
+		// registered by another leader
+		return nil
+	}
+
+	url = fmt.Sprintf("%s?cas=%d", url, pairs[0].ModifyIndex)
+	_, err = do(ctx, c.Client, http.MethodDelete, url, nil)
+	return err
+}
+
+func (c *Consul) value(addr raft.RaftAddr) string {
+	if c.Advertise != "" {
+		return c.Advertise
+	}
+	return string(addr)
+}
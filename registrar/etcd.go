@@ -0,0 +1,76 @@
+package registrar
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/mind1949/raft"
+)
+
+// NewEtcd 创建将 Leader 地址写入 etcd 的 Registrar
+// endpoint 为 etcd v3 grpc-gateway 的 http 地址, key 为存放 Leader 地址的 key
+func NewEtcd(endpoint, key string) *Etcd {
+	return &Etcd{
+		Endpoint: strings.TrimSuffix(endpoint, "/"),
+		Key:      key,
+		Client:   http.DefaultClient,
+	}
+}
+
+var _ raft.Registrar = (*Etcd)(nil)
+
+// Etcd 通过 etcd v3 json api 写入 Leader 地址
+type Etcd struct {
+	Endpoint string
+	Key      string
+	Client   *http.Client
+	// Advertise 登记的地址, 为空时登记 raft rpc 地址
+	Advertise string
+}
+
+func (e *Etcd) Register(ctx context.Context, id raft.RaftId, addr raft.RaftAddr) error {
+	return e.post(ctx, "/v3/kv/put", map[string]interface{}{
+		"key":   e.encode(e.Key),
+		"value": e.encode(e.value(addr)),
+	})
+}
+
+// Deregister 使用事务, 仅当 key 的值仍是本节点地址时删除
+func (e *Etcd) Deregister(ctx context.Context, id raft.RaftId, addr raft.RaftAddr) error {
+	key := e.encode(e.Key)
+	return e.post(ctx, "/v3/kv/txn", map[string]interface{}{
+		"compare": []map[string]interface{}{{
+			"key":    key,
+			"target": "VALUE",
+			"result": "EQUAL",
+			"value":  e.encode(e.value(addr)),
+		}},
+		"success": []map[string]interface{}{{
+			"request_delete_range": map[string]interface{}{"key": key},
+		}},
+	})
+}
+
+func (e *Etcd) post(ctx context.Context, path string, body interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	_, err = do(ctx, e.Client, http.MethodPost, e.Endpoint+path, bytes.NewReader(b))
+	return err
+}
+
+func (e *Etcd) value(addr raft.RaftAddr) string {
+	if e.Advertise != "" {
+		return e.Advertise
+	}
+	return string(addr)
+}
+
+func (*Etcd) encode(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
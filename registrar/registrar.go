@@ -0,0 +1,40 @@
+// Package registrar 将 raft Leader 的地址登记到外部服务目录
+//
+//	r, err := raft.New(id, addr, apply, store, log,
+//		raft.WithRegistrar(registrar.NewConsul("http://127.0.0.1:8500", "service/kv/leader")))
+package registrar
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// do 发送 http 请求, 非 2xx 响应视为错误
+func do(ctx context.Context, client *http.Client, method, url string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("err: %s %s: %s: %s", method, url, resp.Status, b)
+	}
+	return b, nil
+}
@@ -0,0 +1,236 @@
+package registrar
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mind1949/raft"
+)
+
+// fakeConsul 实现 Consul KV 的 GET/PUT/DELETE(cas)
+type fakeConsul struct {
+	mux   sync.Mutex
+	value map[string]string
+	index map[string]uint64
+	next  uint64
+
+	// beforeDelete 在处理 DELETE 前调用, 模拟并发的写入
+	beforeDelete func()
+}
+
+func newFakeConsul() *fakeConsul {
+	return &fakeConsul{value: make(map[string]string), index: make(map[string]uint64)}
+}
+
+func (f *fakeConsul) put(key, value string) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.next++
+	f.value[key], f.index[key] = value, f.next
+}
+
+func (f *fakeConsul) get(key string) (string, bool) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	value, ok := f.value[key]
+	return value, ok
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	key := strings.TrimPrefix(req.URL.Path, "/v1/kv/")
+	switch req.Method {
+	case http.MethodPut:
+		b, _ := io.ReadAll(req.Body)
+		f.put(key, string(b))
+		io.WriteString(w, "true")
+	case http.MethodGet:
+		f.mux.Lock()
+		defer f.mux.Unlock()
+		value, ok := f.value[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode([]map[string]interface{}{{
+			"ModifyIndex": f.index[key],
+			"Value":       base64.StdEncoding.EncodeToString([]byte(value)),
+		}})
+	case http.MethodDelete:
+		if f.beforeDelete != nil {
+			f.beforeDelete()
+		}
+		f.mux.Lock()
+		defer f.mux.Unlock()
+		cas, _ := strconv.ParseUint(req.URL.Query().Get("cas"), 10, 64)
+		if f.index[key] != cas {
+			io.WriteString(w, "false")
+			return
+		}
+		delete(f.value, key)
+		delete(f.index, key)
+		io.WriteString(w, "true")
+	}
+}
+
+// fakeEtcd 实现 etcd v3 json api 的 put 与 txn(比较 value 后删除)
+type fakeEtcd struct {
+	mux sync.Mutex
+	kv  map[string]string
+}
+
+func (f *fakeEtcd) get(key string) (string, bool) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	value, ok := f.kv[key]
+	return value, ok
+}
+
+func (f *fakeEtcd) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	decode := func(s string) string {
+		b, _ := base64.StdEncoding.DecodeString(s)
+		return string(b)
+	}
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	switch req.URL.Path {
+	case "/v3/kv/put":
+		var body struct{ Key, Value string }
+		json.NewDecoder(req.Body).Decode(&body)
+		f.kv[decode(body.Key)] = decode(body.Value)
+		io.WriteString(w, "{}")
+	case "/v3/kv/txn":
+		var body struct {
+			Compare []struct{ Key, Target, Result, Value string }
+			Success []struct {
+				RequestDeleteRange struct{ Key string } `json:"request_delete_range"`
+			}
+		}
+		json.NewDecoder(req.Body).Decode(&body)
+		succeeded := true
+		for _, c := range body.Compare {
+			if c.Target != "VALUE" || c.Result != "EQUAL" || f.kv[decode(c.Key)] != decode(c.Value) {
+				succeeded = false
+			}
+		}
+		if succeeded {
+			for _, op := range body.Success {
+				delete(f.kv, decode(op.RequestDeleteRange.Key))
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]bool{"succeeded": succeeded})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestConsul(t *testing.T) {
+	fake := newFakeConsul()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	ctx := context.Background()
+	const key = "service/kv/leader"
+
+	expect := func(t *testing.T, value string, ok bool) {
+		t.Helper()
+		got, gotOk := fake.get(key)
+		if got != value || gotOk != ok {
+			t.Errorf("expect (%q, %v) but got (%q, %v)", value, ok, got, gotOk)
+		}
+	}
+
+	node1, node2 := NewConsul(server.URL+"/", "/"+key), NewConsul(server.URL, key)
+	t.Run("register", func(t *testing.T) {
+		if err := node1.Register(ctx, "1", "10.0.0.1:7000"); err != nil {
+			t.Fatal(err)
+		}
+		expect(t, "10.0.0.1:7000", true)
+	})
+	t.Run("keep registration of another leader", func(t *testing.T) {
+		if err := node2.Register(ctx, "2", "10.0.0.2:7000"); err != nil {
+			t.Fatal(err)
+		}
+		if err := node1.Deregister(ctx, "1", "10.0.0.1:7000"); err != nil {
+			t.Fatal(err)
+		}
+		expect(t, "10.0.0.2:7000", true)
+	})
+	t.Run("compare-and-set", func(t *testing.T) {
+		// 另一 Leader 在读取与删除之间完成登记, 删除因 ModifyIndex 变化而失败
+		fake.beforeDelete = func() { fake.put(key, "10.0.0.3:7000") }
+		defer func() { fake.beforeDelete = nil }()
+		if err := node2.Deregister(ctx, "2", "10.0.0.2:7000"); err != nil {
+			t.Fatal(err)
+		}
+		expect(t, "10.0.0.3:7000", true)
+	})
+	t.Run("deregister", func(t *testing.T) {
+		node3 := NewConsul(server.URL, key)
+		if err := node3.Deregister(ctx, "3", "10.0.0.3:7000"); err != nil {
+			t.Fatal(err)
+		}
+		expect(t, "", false)
+		// 已注销时再次注销不报错
+		if err := node3.Deregister(ctx, "3", "10.0.0.3:7000"); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("advertise", func(t *testing.T) {
+		node := NewConsul(server.URL, key)
+		node.Advertise = "raft.example.com:7000"
+		if err := node.Register(ctx, "1", "10.0.0.1:7000"); err != nil {
+			t.Fatal(err)
+		}
+		expect(t, "raft.example.com:7000", true)
+		if err := node.Deregister(ctx, "1", "10.0.0.1:7000"); err != nil {
+			t.Fatal(err)
+		}
+		expect(t, "", false)
+	})
+}
+
+func TestEtcd(t *testing.T) {
+	fake := &fakeEtcd{kv: make(map[string]string)}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	ctx := context.Background()
+	const key = "/service/kv/leader"
+
+	expect := func(t *testing.T, value string, ok bool) {
+		t.Helper()
+		got, gotOk := fake.get(key)
+		if got != value || gotOk != ok {
+			t.Errorf("expect (%q, %v) but got (%q, %v)", value, ok, got, gotOk)
+		}
+	}
+
+	node1, node2 := NewEtcd(server.URL+"/", key), NewEtcd(server.URL, key)
+	var _ raft.Registrar = node1
+	if err := node1.Register(ctx, "1", "10.0.0.1:7000"); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "10.0.0.1:7000", true)
+
+	t.Run("compare-and-set", func(t *testing.T) {
+		if err := node2.Register(ctx, "2", "10.0.0.2:7000"); err != nil {
+			t.Fatal(err)
+		}
+		if err := node1.Deregister(ctx, "1", "10.0.0.1:7000"); err != nil {
+			t.Fatal(err)
+		}
+		expect(t, "10.0.0.2:7000", true)
+	})
+	t.Run("deregister", func(t *testing.T) {
+		if err := node2.Deregister(ctx, "2", "10.0.0.2:7000"); err != nil {
+			t.Fatal(err)
+		}
+		expect(t, "", false)
+	})
+}
@@ -0,0 +1,105 @@
+package raft
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingRegistrar 记录登记与注销, block 非 nil 时登记阻塞直到 block 关闭
+type recordingRegistrar struct {
+	mux   sync.Mutex
+	calls []string
+	block chan struct{}
+	// entered 每次调用开始时通知
+	entered chan struct{}
+}
+
+func (r *recordingRegistrar) record(call string) {
+	if r.entered != nil {
+		r.entered <- struct{}{}
+	}
+	if r.block != nil {
+		<-r.block
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.calls = append(r.calls, call)
+}
+
+func (r *recordingRegistrar) Register(ctx context.Context, id RaftId, addr RaftAddr) error {
+	r.record("register")
+	return nil
+}
+
+func (r *recordingRegistrar) Deregister(ctx context.Context, id RaftId, addr RaftAddr) error {
+	r.record("deregister")
+	return nil
+}
+
+func (r *recordingRegistrar) get() []string {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return append([]string(nil), r.calls...)
+}
+
+func TestRegistrar(t *testing.T) {
+	t.Run("deregister on stop", func(t *testing.T) {
+		registrar := &recordingRegistrar{}
+		r, err := New("registrar-stop", "registrar-stop", nil, nil, nil, WithDevMode(), WithRPC(newLoopbackRPC()), WithRegistrar(registrar))
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan error, 1)
+		go func() { done <- r.Run() }()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for len(registrar.get()) == 0 {
+			if time.Now().After(deadline) {
+				t.Fatal("expect leader registered")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		r.Stop()
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+
+		expect := []string{"register", "deregister"}
+		if calls := registrar.get(); !reflect.DeepEqual(calls, expect) {
+			t.Errorf("expect %v but got %v", expect, calls)
+		}
+	})
+
+	t.Run("generation ordering", func(t *testing.T) {
+		registrar := &recordingRegistrar{block: make(chan struct{}), entered: make(chan struct{}, 3)}
+		node, err := New("registrar-generation", "registrar-generation", nil, nil, nil, WithDevMode(), WithRPC(newLoopbackRPC()), WithRegistrar(registrar))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := node.(*raft)
+
+		r.onLeadershipChanged(true)
+		<-registrar.entered
+		// 第一次登记进行中时 leadership 又变化两次, 只执行最新的变化
+		r.onLeadershipChanged(false)
+		r.onLeadershipChanged(true)
+		time.Sleep(50 * time.Millisecond)
+		close(registrar.block)
+
+		deadline := time.Now().Add(5 * time.Second)
+		for len(registrar.get()) < 2 {
+			if time.Now().After(deadline) {
+				t.Fatalf("expect 2 calls but got %v", registrar.get())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		time.Sleep(50 * time.Millisecond)
+		expect := []string{"register", "register"}
+		if calls := registrar.get(); !reflect.DeepEqual(calls, expect) {
+			t.Errorf("expect %v but got %v", expect, calls)
+		}
+	})
+}
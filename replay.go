@@ -0,0 +1,152 @@
+package raft
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrReplayLogGap          = errors.New("err: log doesn't continue from snapshot")
+	ErrReplayBeyondLastIndex = errors.New("err: replay stop index beyond last log entry")
+	ErrReplaySnapshotTooNew  = errors.New("err: snapshot is after replay stop index")
+	ErrReplayStalled         = errors.New("err: state machine applied no command")
+)
+
+// replayBatchSize 每次从 log 中读取并重放的 log entry 数量
+const replayBatchSize = 1024
+
+// ReplayOptions 离线重放的参数, 见 Replay
+type ReplayOptions struct {
+	// Snapshotter 恢复快照的状态机, 为 nil 时不加载快照, 从第一个 log entry 开始重放
+	Snapshotter Snapshotter
+	// Snapshots 快照存储
+	Snapshots SnapshotStore
+	// SnapshotId 加载的快照, 为空时加载索引不超过 StopAt 的最新快照
+	SnapshotId string
+	// Keys 解密快照, 见 WithSnapshotEncryption
+	Keys KeyProvider
+	// StopAt 重放到该索引(含)为止, 0 表示重放到最后一个 log entry
+	StopAt uint64
+}
+
+// ReplayResult 重放的结果
+type ReplayResult struct {
+	// Snapshot 加载的快照, 未加载快照时为零值
+	Snapshot SnapshotMeta
+	// LastIndex 重放的最后一个 log entry 的索引
+	LastIndex uint64
+	// Commands 应用到状态机的 command 数量
+	Commands int
+}
+
+// Replay 在集群之外, 加载快照并将之后的 log entry 依序应用到 apply
+//
+// 只读取 log 与快照存储, 不会修改它们, 可以安全地在生产数据的副本上
+// 调试状态机. 只应用 command 类型的 log entry, 配置变更等其他类型的
+// log entry 被跳过.
+//
+//	fsm := newFSM()
+//	result, err := raft.Replay(fsm.Apply, log, raft.ReplayOptions{
+//		Snapshotter: fsm,
+//		Snapshots:   snapshots,
+//		StopAt:      1024,
+//	})
+func Replay(apply Apply, log Log, options ReplayOptions) (result ReplayResult, err error) {
+	lastIndex, _, err := log.Last()
+	if err != nil {
+		return result, err
+	}
+	stopAt := options.StopAt
+	if stopAt == 0 {
+		stopAt = lastIndex
+	}
+	if stopAt > lastIndex {
+		return result, fmt.Errorf("%w: %d > %d", ErrReplayBeyondLastIndex, stopAt, lastIndex)
+	}
+
+	if options.Snapshotter != nil && options.Snapshots != nil {
+		result.Snapshot, err = restoreReplaySnapshot(options, stopAt)
+		if err != nil {
+			return result, err
+		}
+	}
+	result.LastIndex = result.Snapshot.Index
+
+	firstIndex, err := log.FirstIndex()
+	if err != nil {
+		return result, err
+	}
+	if result.LastIndex < stopAt && firstIndex > result.LastIndex+1 {
+		return result, fmt.Errorf("%w: snapshot ends at %d, log starts at %d", ErrReplayLogGap, result.LastIndex, firstIndex)
+	}
+
+	for result.LastIndex < stopAt {
+		end := result.LastIndex + replayBatchSize
+		if end > stopAt {
+			end = stopAt
+		}
+		entries, err := log.RangeGet(result.LastIndex, end)
+		if err != nil {
+			return result, err
+		}
+		count, err := replayCommands(apply, newCommands(entries))
+		result.Commands += count
+		if err != nil {
+			return result, err
+		}
+		result.LastIndex = end
+	}
+	return result, nil
+}
+
+// restoreReplaySnapshot 将快照恢复到状态机, 没有可用的快照时返回零值
+func restoreReplaySnapshot(options ReplayOptions, stopAt uint64) (meta SnapshotMeta, err error) {
+	id := options.SnapshotId
+	if id == "" {
+		metas, err := options.Snapshots.List()
+		if err != nil {
+			return meta, err
+		}
+		for i := range metas {
+			if metas[i].Index <= stopAt {
+				id = metas[i].Id
+				break
+			}
+		}
+		if id == "" {
+			return meta, nil
+		}
+	}
+
+	meta, rc, err := options.Snapshots.Open(id)
+	if err != nil {
+		return meta, err
+	}
+	defer rc.Close()
+	if meta.Index > stopAt {
+		return SnapshotMeta{}, fmt.Errorf("%w: snapshot %s ends at %d, stop at %d", ErrReplaySnapshotTooNew, id, meta.Index, stopAt)
+	}
+	r := &raft{snapshotter: options.Snapshotter, snapshotKeys: options.Keys}
+	return meta, r.restoreSnapshot(meta, rc)
+}
+
+// replayCommands 将 commands 全部应用到 apply, 部分应用时继续应用剩余的 command
+func replayCommands(apply Apply, cmds *commands) (count int, err error) {
+	for len(cmds.data) > 0 {
+		n, err := apply(cmds)
+		if n > len(cmds.data) {
+			n = len(cmds.data)
+		}
+		if n > 0 {
+			count += n
+			cmds = &commands{data: cmds.data[n:], entries: cmds.entries[n:]}
+		}
+		if err != nil {
+			return count, err
+		}
+		if n <= 0 {
+			return count, ErrReplayStalled
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,111 @@
+package raft
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestReplay(t *testing.T) {
+	newLog := func() *memoryLog {
+		log := &memoryLog{}
+		log.Append(
+			LogEntry{Term: 1, Command: Command("a")},
+			LogEntry{Term: 1, Command: Command("b")},
+			LogEntry{Term: 1, Type: logEntryTypeConfig},
+			LogEntry{Term: 2, Command: Command("c")},
+			LogEntry{Term: 2, Command: Command("d")},
+		)
+		return log
+	}
+	newSnapshots := func(t *testing.T) SnapshotStore {
+		store := NewMemorySnapshotStore(1)
+		sink, err := store.Create("s2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fsm := &listFSM{items: []string{"a", "b"}}
+		fsm.Snapshot(sink)
+		err = sink.Commit(SnapshotMeta{Id: "s2", Index: 2, Term: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	}
+
+	t.Run("from first log entry", func(t *testing.T) {
+		fsm := &listFSM{}
+		result, err := Replay(fsm.apply, newLog(), ReplayOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := []string{"a", "b", "c", "d"}
+		if got := fsm.get(); !reflect.DeepEqual(got, expect) {
+			t.Errorf("expect %v but got %v", expect, got)
+		}
+		if result.LastIndex != 5 || result.Commands != 4 {
+			t.Errorf("expect last index 5 with 4 commands but got %+v", result)
+		}
+	})
+
+	t.Run("from snapshot and stop at index", func(t *testing.T) {
+		log := newLog()
+		log.Compact(2)
+		fsm := &listFSM{}
+		result, err := Replay(fsm.apply, log, ReplayOptions{Snapshotter: fsm, Snapshots: newSnapshots(t), StopAt: 4})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := []string{"a", "b", "c"}
+		if got := fsm.get(); !reflect.DeepEqual(got, expect) {
+			t.Errorf("expect %v but got %v", expect, got)
+		}
+		if result.Snapshot.Id != "s2" || result.LastIndex != 4 || result.Commands != 1 {
+			t.Errorf("expect replayed (2, 4] from snapshot s2 but got %+v", result)
+		}
+	})
+
+	t.Run("partial apply", func(t *testing.T) {
+		fsm := &listFSM{}
+		one := func(cmds Commands) (int, error) {
+			return fsm.apply(&commands{data: cmds.Data()[:1], entries: EntriesOf(cmds)[:1]})
+		}
+		_, err := Replay(one, newLog(), ReplayOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := []string{"a", "b", "c", "d"}
+		if got := fsm.get(); !reflect.DeepEqual(got, expect) {
+			t.Errorf("expect %v but got %v", expect, got)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		compacted := newLog()
+		compacted.Compact(3)
+		cases := []struct {
+			name    string
+			log     Log
+			options ReplayOptions
+			expect  error
+		}{
+			{name: "beyond last index", log: newLog(), options: ReplayOptions{StopAt: 6}, expect: ErrReplayBeyondLastIndex},
+			{name: "log gap", log: compacted, expect: ErrReplayLogGap},
+			{
+				name:    "snapshot too new",
+				log:     newLog(),
+				options: ReplayOptions{Snapshotter: &listFSM{}, Snapshots: newSnapshots(t), SnapshotId: "s2", StopAt: 1},
+				expect:  ErrReplaySnapshotTooNew,
+			},
+		}
+		for _, c := range cases {
+			c := c
+			t.Run(c.name, func(t *testing.T) {
+				_, err := Replay((&listFSM{}).apply, c.log, c.options)
+				if !errors.Is(err, c.expect) {
+					t.Errorf("expect %v but got %v", c.expect, err)
+				}
+			})
+		}
+	})
+}
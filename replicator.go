@@ -0,0 +1,247 @@
+package raft
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// replicateBackoffMin 复制失败后重试的最短等待时间
+const replicateBackoffMin = 10 * time.Millisecond
+
+// replicator 向一个 peer 复制日志的常驻 goroutine
+//
+// 同一时刻最多只有一个发往该 peer 的 AppendEntries(流水线模式下最多 window 个,
+// 见 WithPipeline), 慢 peer 不会导致 goroutine 堆积或重复发送相同的 log entry.
+// 有新的 log entry 时通过 notify 唤醒, 复制失败时退避重试.
+type replicator struct {
+	peer RaftPeer
+	// notify 容量为 1, 多次通知合并为一次
+	notify chan struct{}
+	stop   chan struct{}
+	// inflight 进行中的 AppendEntries 的数量
+	inflight int32
+	// pipeline 流水线模式, 逐个等待响应时为 nil, 只在 runReplicator 中读写
+	pipeline *pipeline
+}
+
+// replicatorSet Leader 的所有 replicator
+type replicatorSet struct {
+	mux     sync.Mutex
+	peers   map[RaftId]*replicator
+	stopped bool
+	// progress 任一 peer 复制有进展时关闭并替换, 用于唤醒等待者
+	progress chan struct{}
+}
+
+// watch 返回下一次复制有进展时关闭的 channel
+func (s *replicatorSet) watch() <-chan struct{} {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.progress == nil {
+		s.progress = make(chan struct{})
+	}
+	return s.progress
+}
+
+// progressed 唤醒等待复制进展的 goroutine
+func (s *replicatorSet) progressed() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.progress != nil {
+		close(s.progress)
+	}
+	s.progress = make(chan struct{})
+}
+
+// inflight 是否有发往 id 的进行中的 AppendEntries
+func (s *replicatorSet) inflight(id RaftId) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	r, ok := s.peers[id]
+	return ok && atomic.LoadInt32(&r.inflight) != 0
+}
+
+func (s *replicatorSet) isStopped() bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.stopped
+}
+
+// notifyReplicators 唤醒 peers 的 replicator, 按需启动,
+// 并停止已不在 peers 中的 replicator. Leader 已退位时返回 false
+func (l *leader) notifyReplicators(peers []RaftPeer) bool {
+	s := &l.replicators
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.stopped {
+		return false
+	}
+	if s.peers == nil {
+		s.peers = make(map[RaftId]*replicator)
+	}
+
+	for id, r := range s.peers {
+		if !includePeer(peers, RaftPeer{Id: id}) {
+			close(r.stop)
+			delete(s.peers, id)
+		}
+	}
+	for _, peer := range peers {
+		if peer.Id == l.Id() || l.quarantine.contains(peer.Id) {
+			continue
+		}
+		r, ok := s.peers[peer.Id]
+		if !ok {
+			r = &replicator{
+				notify: make(chan struct{}, 1),
+				stop:   make(chan struct{}),
+			}
+			s.peers[peer.Id] = r
+			go l.runReplicator(r)
+		}
+		r.peer = peer
+		select {
+		case r.notify <- struct{}{}:
+		default:
+			// already notified
+		}
+	}
+	return true
+}
+
+// stopReplicators Leader 退位时停止所有 replicator, 并唤醒等待者
+func (l *leader) stopReplicators() {
+	s := &l.replicators
+	s.mux.Lock()
+	s.stopped = true
+	for id, r := range s.peers {
+		close(r.stop)
+		delete(s.peers, id)
+	}
+	s.mux.Unlock()
+	s.progressed()
+}
+
+func (l *leader) runReplicator(r *replicator) {
+	var backoff time.Duration
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-r.notify:
+			// no-op
+		}
+
+		for {
+			// rejected by peers with a newer term
+			if _, stale := l.staleTerm(); stale {
+				l.replicators.progressed()
+				break
+			}
+
+			l.replicators.mux.Lock()
+			peer := r.peer
+			l.replicators.mux.Unlock()
+
+			if r.pipeline != nil {
+				if l.pipelineReplicate(r, peer) {
+					break
+				}
+				l.stopPipeline(r, peer)
+			}
+
+			atomic.AddInt32(&r.inflight, 1)
+			success, err := l.replicate(peer.Id, peer.Addr)
+			atomic.AddInt32(&r.inflight, -1)
+			if err != nil {
+				backoff *= 2
+				if backoff < replicateBackoffMin {
+					backoff = replicateBackoffMin
+				}
+				if max := l.heartbeatTimeout(); backoff > max {
+					backoff = max
+				}
+				select {
+				case <-r.stop:
+					return
+				case <-time.After(backoff):
+					continue
+				}
+			}
+			backoff = 0
+			l.pacer.observeReplication()
+			l.replicators.progressed()
+			if success && l.caughtUp(peer.Id) {
+				l.startPipeline(r, peer)
+				break
+			}
+		}
+	}
+}
+
+// caughtUp peer 是否已复制了所有可以复制的 log entry
+func (l *leader) caughtUp(id RaftId) bool {
+	lastLogIndex, lastLogTerm, err := l.Last()
+	if err != nil {
+		return false
+	}
+	// entries of previous terms are not replicated alone, see replicate
+	if lastLogTerm != l.GetCurrentTerm() {
+		return true
+	}
+	matchIndex, _ := l.matchIndex.Load(id)
+	return matchIndex >= lastLogIndex
+}
+
+// replicateToAll 将 log 中的 log entry 复制到集群中的多数派
+//
+// 唤醒每个 peer 的 replicator, 等待多数派的 matchIndex 不小于当前最后一个 log entry.
+func (l *leader) replicateToAll(ctx context.Context) error {
+	config := l.configs.GetConfig()
+	// the local durable append counts towards the majority
+	if _, err := l.replicate(l.Id(), l.Addr()); err != nil {
+		return err
+	}
+	target, _, err := l.Last()
+	if err != nil {
+		return err
+	}
+	if !l.notifyReplicators(config.GetPeers()) {
+		return l.staleLeaderError(l.GetCurrentTerm())
+	}
+
+	for {
+		progress := l.replicators.watch()
+		if l.replicatedToMajority(config, target) {
+			return nil
+		}
+		if term, stale := l.staleTerm(); stale {
+			return l.staleLeaderError(term)
+		}
+		if l.replicators.isStopped() {
+			return l.staleLeaderError(l.GetCurrentTerm())
+		}
+		if l.noQuorum() {
+			return ErrNoQuorum
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-progress:
+			// no-op
+		}
+	}
+}
+
+// replicatedToMajority config 的多数派是否已复制索引 index 之前的 log entry
+func (l *leader) replicatedToMajority(config config, index uint64) bool {
+	decider := config.NewDecider()
+	for _, peer := range config.GetPeers() {
+		if matchIndex, ok := l.matchIndex.Load(peer.Id); ok && matchIndex >= index {
+			decider.AddVote(peer.Id)
+		}
+	}
+	return decider.HasAchievedMajority()
+}
@@ -0,0 +1,79 @@
+package raft
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowRPC 延迟携带 log entry 的 AppendEntries, 并记录最大并发数
+type slowRPC struct {
+	*loopbackRPC
+	delay time.Duration
+
+	inflight    int32
+	maxInflight int32
+}
+
+func (r *slowRPC) CallAppendEntries(addr RaftAddr, args AppendEntriesArgs) (AppendEntriesResults, error) {
+	if len(args.Entries) == 0 {
+		return r.loopbackRPC.CallAppendEntries(addr, args)
+	}
+	n := atomic.AddInt32(&r.inflight, 1)
+	defer atomic.AddInt32(&r.inflight, -1)
+	for {
+		max := atomic.LoadInt32(&r.maxInflight)
+		if n <= max || atomic.CompareAndSwapInt32(&r.maxInflight, max, n) {
+			break
+		}
+	}
+	time.Sleep(r.delay)
+	return r.loopbackRPC.CallAppendEntries(addr, args)
+}
+
+func TestReplicator(t *testing.T) {
+	rpc := &slowRPC{loopbackRPC: newLoopbackRPC(), delay: 20 * time.Millisecond}
+	fsm := &listFSM{}
+	leader, err := New("replicator-leader", "replicator-leader", fsm.apply, nil, nil, WithDevMode(), WithRPC(rpc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leader.Stop()
+	go leader.Run()
+
+	follower := runLoopbackFollower(t, "replicator-follower")
+	defer follower.Stop()
+	ctx := context.Background()
+	if err := leader.AddVoter(ctx, follower.Id(), follower.Addr()); err != nil {
+		t.Fatal(err)
+	}
+
+	// concurrent proposals share the follower's single replication stream
+	atomic.StoreInt32(&rpc.maxInflight, 0)
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+			errs <- leader.Handle(ctx, Command("c"))
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := len(fsm.get()); got != 20 {
+		t.Errorf("expect 20 commands applied but got %d", got)
+	}
+	if max := atomic.LoadInt32(&rpc.maxInflight); max != 1 {
+		t.Errorf("expect at most 1 in-flight AppendEntries to the follower but got %d", max)
+	}
+}
@@ -0,0 +1,68 @@
+package raft
+
+// Resolver 解析 peer 的 rpc 通信地址
+//
+// 集群配置中记录的是 peer 加入集群时的地址,
+// 在地址会变化的环境中(如容器平台), 通过 Resolver 获取 peer 的最新地址.
+type Resolver interface {
+	// Resolve 返回 id 对应的地址, ok 为 false 时使用集群配置中的地址
+	Resolve(id RaftId) (addr RaftAddr, ok bool)
+}
+
+// AddrCloser 可由 RPC 实现, 关闭与 addr 之间已建立的连接
+//
+// peer 的地址变化后(Resolver 或 UpdatePeerAddress), 与旧地址的连接不再使用,
+// raft 通过 AddrCloser 及时释放, 未实现时连接保留到 RPC 关闭.
+type AddrCloser interface {
+	CloseAddr(addr RaftAddr) error
+}
+
+var _ AddrCloser = (*raft)(nil)
+
+// CloseAddr 实现 AddrCloser, 关闭 RPC 与 addr 之间的连接,
+// 下次通信时重新建立连接(重新解析 DNS)
+func (r *raft) CloseAddr(addr RaftAddr) error {
+	if closer, ok := r.rpc.(AddrCloser); ok {
+		return closer.CloseAddr(addr)
+	}
+	return nil
+}
+
+// UpdatePeerAddress 更新与 peer 通信使用的地址
+// 优先于 Resolver 与集群配置中的地址, addr 为空时取消更新
+func (r *raft) UpdatePeerAddress(id RaftId, addr RaftAddr) {
+	if addr == "" {
+		r.peerAddrs.Delete(id)
+		return
+	}
+	r.peerAddrs.Store(id, addr)
+	r.log(LogTransport).Info("Update peer address", "peer", id, "addr", addr)
+}
+
+// resolve 获取与 peer 通信使用的地址
+// 地址变化时关闭与旧地址的连接
+func (r *raft) resolve(peer RaftPeer) RaftAddr {
+	addr := r.lookupAddr(peer)
+	pre, loaded := r.resolvedAddrs.Swap(peer.Id, addr)
+	if loaded && pre.(RaftAddr) != addr {
+		if closer, ok := r.rpc.(AddrCloser); ok {
+			_ = closer.CloseAddr(pre.(RaftAddr))
+		}
+		r.log(LogTransport).Debug("Peer address changed", "peer", peer.Id, "from", pre, "to", addr)
+	}
+	return addr
+}
+
+func (r *raft) lookupAddr(peer RaftPeer) RaftAddr {
+	if addr, ok := r.peerAddrs.Load(peer.Id); ok {
+		return addr.(RaftAddr)
+	}
+	if r.resolver == nil {
+		return peer.Addr
+	}
+	addr, ok := r.resolver.Resolve(peer.Id)
+	if !ok || addr == "" {
+		return peer.Addr
+	}
+	return addr
+}
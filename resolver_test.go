@@ -0,0 +1,50 @@
+package raft
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// closingRPC 记录被关闭的地址
+type closingRPC struct {
+	*loopbackRPC
+
+	mux    sync.Mutex
+	closed []RaftAddr
+}
+
+func (r *closingRPC) CloseAddr(addr RaftAddr) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.closed = append(r.closed, addr)
+	return nil
+}
+
+func TestResolveCloseStaleAddr(t *testing.T) {
+	rpc := &closingRPC{loopbackRPC: newLoopbackRPC()}
+	node, err := New("resolve", "resolve", nil, nil, nil, WithDevMode(), WithRPC(rpc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := node.(*raft)
+	peer := RaftPeer{Id: "peer", Addr: "peer-0"}
+
+	resolve := func(expect RaftAddr) {
+		t.Helper()
+		if addr := r.resolve(peer); addr != expect {
+			t.Errorf("expect %q but got %q", expect, addr)
+		}
+	}
+	resolve("peer-0")
+	resolve("peer-0")
+	r.UpdatePeerAddress(peer.Id, "peer-1")
+	resolve("peer-1")
+	r.UpdatePeerAddress(peer.Id, "")
+	resolve("peer-0")
+
+	expect := []RaftAddr{"peer-0", "peer-1"}
+	if !reflect.DeepEqual(rpc.closed, expect) {
+		t.Errorf("expect closed %v but got %v", expect, rpc.closed)
+	}
+}
@@ -0,0 +1,199 @@
+package raft
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Result 状态机应用 command 的结果, 由 Apply 通过 SetResult 设置
+type Result interface{}
+
+// extensionProposalId log entry 扩展字段中 Propose 的 id, 用于将结果交给提交者
+const extensionProposalId = "raft.proposal_id"
+
+// proposalIdKey context 中 Propose 的 id 的 key
+type proposalIdKey struct{}
+
+// proposalResults 等待 command 应用结果的 Propose
+//
+// Propose 的 id 随 log entry 复制, 只有提交的节点上有等待者, 其他节点应用时忽略.
+type proposalResults struct {
+	// prefix 区分节点与进程, 重启前提交的 log entry 不会被当作新的 Propose
+	prefix string
+	seq    uint64
+
+	mux     sync.Mutex
+	waiters map[string]*proposalResult
+}
+
+type proposalResult struct {
+	index  uint64
+	result Result
+	// err 未被应用的原因, 如 ErrDuplicateCommand
+	err error
+	// applied 应用后关闭
+	applied chan struct{}
+}
+
+func newProposalResults(id RaftId) proposalResults {
+	return proposalResults{
+		prefix:  fmt.Sprintf("%s/%d/", id, time.Now().UnixNano()),
+		waiters: make(map[string]*proposalResult),
+	}
+}
+
+// register 登记一个等待结果的 Propose, 返回其 id
+func (p *proposalResults) register() (string, *proposalResult) {
+	id := p.prefix + strconv.FormatUint(atomic.AddUint64(&p.seq, 1), 10)
+	waiter := &proposalResult{applied: make(chan struct{})}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.waiters[id] = waiter
+	return id, waiter
+}
+
+// unregister 注销 id
+func (p *proposalResults) unregister(id string) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	delete(p.waiters, id)
+}
+
+// deliver 将已应用的前 count 个 command 的结果交给等待者
+func (p *proposalResults) deliver(commands *commands, count int) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if len(p.waiters) == 0 {
+		return
+	}
+	for i := 0; i < count && i < len(commands.entries); i++ {
+		id := commands.entries[i].Extensions[extensionProposalId]
+		if len(id) == 0 {
+			continue
+		}
+		if waiter, ok := p.waiters[string(id)]; ok {
+			waiter.index, waiter.result = commands.entries[i].Index, commands.result(i)
+			close(waiter.applied)
+			delete(p.waiters, string(id))
+		}
+	}
+}
+
+// reject 以 err 完成 entries 中 skip 的 log entry 的等待者
+func (p *proposalResults) reject(entries []LogEntry, skip map[uint64]bool, err error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if len(p.waiters) == 0 {
+		return
+	}
+	for _, entry := range entries {
+		id := entry.Extensions[extensionProposalId]
+		if !skip[entry.Index] || len(id) == 0 {
+			continue
+		}
+		if waiter, ok := p.waiters[string(id)]; ok {
+			waiter.err = err
+			close(waiter.applied)
+			delete(p.waiters, string(id))
+		}
+	}
+}
+
+// Propose 提交 cmd, 应用到状态机后返回 Apply 为其设置的结果
+//
+// 幂等键与窗口内已应用的 command 相同时不会再次应用, 返回 ErrDuplicateCommand
+func (r *raft) Propose(ctx context.Context, cmd Command) (Result, error) {
+	_, result, err := r.propose(ctx, cmd)
+	return result, err
+}
+
+// ProposeAsync 异步提交 cmd, 不阻塞调用者
+//
+// 高吞吐的客户端可以连续提交而不必逐个等待, 配合 WithProposalBatching 合并为批量复制.
+// ctx 结束时 Future 立即以 ctx.Err() 完成, 即使 Handle 仍阻塞在应用中, cmd 仍可能被应用.
+func (r *raft) ProposeAsync(ctx context.Context, cmd Command) Future {
+	f := &future{done: make(chan struct{})}
+	proposed := &future{done: make(chan struct{})}
+	go func() {
+		defer close(proposed.done)
+		proposed.index, proposed.response, proposed.err = r.propose(ctx, cmd)
+	}()
+	go func() {
+		defer close(f.done)
+		select {
+		case <-proposed.done:
+			f.index, f.response, f.err = proposed.index, proposed.response, proposed.err
+		case <-ctx.Done():
+			f.err = ctx.Err()
+		}
+	}()
+	return f
+}
+
+// propose 提交 cmd, 等待其应用, 返回 log entry 的索引与应用结果
+func (r *raft) propose(ctx context.Context, cmd Command) (uint64, Result, error) {
+	id, waiter := r.results.register()
+	defer r.results.unregister(id)
+	err := r.Handle(context.WithValue(ctx, proposalIdKey{}, id), cmd)
+	if err != nil {
+		return 0, nil, err
+	}
+	// Handle may return before the entry is applied
+	// if Apply applied only part of a batch
+	select {
+	case <-ctx.Done():
+		return 0, nil, ctx.Err()
+	case <-r.Done():
+		return 0, nil, ErrStopped
+	case <-waiter.applied:
+		if waiter.err != nil {
+			return 0, nil, waiter.err
+		}
+		return waiter.index, waiter.result, nil
+	}
+}
+
+// Future ProposeAsync 的结果, 在 log entry 应用后或提交失败时完成
+type Future interface {
+	// Done 完成时关闭
+	Done() <-chan struct{}
+	// Index 阻塞直到完成, 返回 log entry 的索引, 失败时为 0
+	Index() uint64
+	// Err 阻塞直到完成, 返回提交失败的原因
+	Err() error
+	// Response 阻塞直到完成, 返回 Apply 通过 SetResult 设置的结果
+	Response() Result
+}
+
+var _ Future = (*future)(nil)
+
+// future 实现 Future
+type future struct {
+	done     chan struct{}
+	index    uint64
+	response Result
+	err      error
+}
+
+func (f *future) Done() <-chan struct{} {
+	return f.done
+}
+
+func (f *future) Index() uint64 {
+	<-f.done
+	return f.index
+}
+
+func (f *future) Err() error {
+	<-f.done
+	return f.err
+}
+
+func (f *future) Response() Result {
+	<-f.done
+	return f.response
+}
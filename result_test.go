@@ -0,0 +1,91 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// upperApply 应用结果为 command 的大写形式
+func upperApply(commands Commands) (int, error) {
+	for i, command := range commands.Data() {
+		SetResult(commands, i, strings.ToUpper(string(command)))
+	}
+	return len(commands.Data()), nil
+}
+
+func TestPropose(t *testing.T) {
+	leader, err := New("propose-leader", "propose-leader", upperApply, nil, nil,
+		WithDevMode(), WithProposalBatching(16, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leader.Stop()
+	go leader.Run()
+
+	follower := runLoopbackFollower(t, "propose-follower")
+	defer follower.Stop()
+	ctx := context.Background()
+	if err := leader.AddVoter(ctx, follower.Id(), follower.Addr()); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("result", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for _, cmd := range []string{"a", "b", "c", "d"} {
+			cmd := cmd
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				result, err := leader.Propose(ctx, Command(cmd))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if expect := strings.ToUpper(cmd); result != expect {
+					t.Errorf("expect result %q but got %v", expect, result)
+				}
+			}()
+		}
+		wg.Wait()
+	})
+	t.Run("async", func(t *testing.T) {
+		var futures []Future
+		for _, cmd := range []string{"e", "f", "g"} {
+			futures = append(futures, leader.ProposeAsync(ctx, Command(cmd)))
+		}
+		indexes := make(map[uint64]bool)
+		for i, cmd := range []string{"e", "f", "g"} {
+			f := futures[i]
+			if err := f.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if expect := strings.ToUpper(cmd); f.Response() != expect {
+				t.Errorf("expect result %q but got %v", expect, f.Response())
+			}
+			if f.Index() == 0 || indexes[f.Index()] {
+				t.Errorf("expect distinct index but got %d", f.Index())
+			}
+			indexes[f.Index()] = true
+		}
+	})
+	t.Run("not leader", func(t *testing.T) {
+		if _, err := follower.Propose(ctx, Command("h")); !errors.Is(err, ErrIsNotLeader) {
+			t.Errorf("expect %v but got %v", ErrIsNotLeader, err)
+		}
+		if err := follower.ProposeAsync(ctx, Command("h")).Err(); !errors.Is(err, ErrIsNotLeader) {
+			t.Errorf("expect %v but got %v", ErrIsNotLeader, err)
+		}
+	})
+	t.Run("no waiters left", func(t *testing.T) {
+		r := leader.(*raft)
+		r.results.mux.Lock()
+		defer r.results.mux.Unlock()
+		if n := len(r.results.waiters); n != 0 {
+			t.Errorf("expect no waiters but got %d", n)
+		}
+	})
+}
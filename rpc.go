@@ -1,9 +1,10 @@
 package raft
 
 import (
+	"crypto/tls"
 	"errors"
+	"io"
 	"net"
-	"net/http"
 	"net/rpc"
 	"sync"
 )
@@ -17,12 +18,16 @@ type RPC interface {
 
 	CallAppendEntries(addr RaftAddr, args AppendEntriesArgs) (AppendEntriesResults, error)
 	CallRequestVote(addr RaftAddr, args RequestVoteArgs) (RequestVoteResults, error)
+	CallInstallSnapshot(addr RaftAddr, args InstallSnapshotArgs) (InstallSnapshotResults, error)
+	CallPreVote(addr RaftAddr, args PreVoteArgs) (PreVoteResults, error)
 }
 
 // RPCService raft rpc service
 type RPCService interface {
 	AppendEntries(args AppendEntriesArgs, results *AppendEntriesResults) error
 	RequestVote(args RequestVoteArgs, results *RequestVoteResults) error
+	InstallSnapshot(args InstallSnapshotArgs, results *InstallSnapshotResults) error
+	PreVote(args PreVoteArgs, results *PreVoteResults) error
 }
 
 type rpcArgsType int8
@@ -33,6 +38,12 @@ const (
 	rpcArgsTypeAppendEntriesResults
 	rpcArgsTypeRequestVoteArgs
 	rpcArgsTypeRequestVoteResults
+	rpcArgsTypeTimeoutNowArgs
+	rpcArgsTypeTimeoutNowResults
+	rpcArgsTypeInstallSnapshotArgs
+	rpcArgsTypeInstallSnapshotResults
+	rpcArgsTypePreVoteArgs
+	rpcArgsTypePreVoteResults
 )
 
 func (t rpcArgsType) String() string {
@@ -45,6 +56,18 @@ func (t rpcArgsType) String() string {
 		return "RequestVoteArgs"
 	case rpcArgsTypeRequestVoteResults:
 		return "RequestVoteResults"
+	case rpcArgsTypeTimeoutNowArgs:
+		return "TimeoutNowArgs"
+	case rpcArgsTypeTimeoutNowResults:
+		return "TimeoutNowResults"
+	case rpcArgsTypeInstallSnapshotArgs:
+		return "InstallSnapshotArgs"
+	case rpcArgsTypeInstallSnapshotResults:
+		return "InstallSnapshotResults"
+	case rpcArgsTypePreVoteArgs:
+		return "PreVoteArgs"
+	case rpcArgsTypePreVoteResults:
+		return "PreVoteResults"
 	default:
 		return "Unknown rpcArgsType"
 	}
@@ -60,10 +83,19 @@ var _ rpcArgs = AppendEntriesArgs{}
 
 // AppendEntriesArgs
 type AppendEntriesArgs struct {
+	// highest protocol version supported by leader
+	ProtocolVersion ProtocolVersion
+	// raft group the request is routed to,
+	// empty outside of MultiRaft
+	Group GroupId
+
 	// leader’s term
 	Term uint64
 	// so follower can redirect clients
 	LeaderId RaftId
+	// leader's address, so that learners not yet in
+	// configuration can redirect clients too
+	LeaderAddr RaftAddr
 
 	// index of log entry immediately preceding new ones
 	PrevLogIndex uint64
@@ -76,6 +108,19 @@ type AppendEntriesArgs struct {
 
 	// leader’s commitIndex
 	LeaderCommit uint64
+
+	// application payload piggybacked on heartbeat
+	Extension []byte
+
+	// target of an in-progress leadership transfer,
+	// other followers withhold their votes from
+	// any other candidate for an election timeout
+	TransferTarget RaftId
+
+	// index and checksum of leader's active configuration,
+	// carried by heartbeats to detect membership divergence
+	ConfigIndex    uint64
+	ConfigChecksum uint64
 }
 
 func (AppendEntriesArgs) getType() rpcArgsType {
@@ -90,11 +135,34 @@ var _ rpcArgs = AppendEntriesResults{}
 
 // AppendEntriesResults
 type AppendEntriesResults struct {
+	// highest protocol version supported by follower
+	ProtocolVersion ProtocolVersion
+
 	// currentTerm
 	Term uint64
 	// for leader to update itself success true
 	// if follower contained entry matching
 	Success bool
+
+	// follower is under sustained resource pressure,
+	// so leader won't transfer leadership to it
+	UnderPressure bool
+
+	// term of the conflicting entry at prevLogIndex,
+	// 0 if follower's log is too short
+	ConflictTerm uint64
+	// first index of ConflictTerm,
+	// or follower's last log index + 1 if its log is too short
+	ConflictIndex uint64
+
+	// highest index known to match leader's log, cumulative over
+	// the AppendEntries of leader's term (0 if unsupported)
+	MatchIndex uint64
+
+	// leader of Term known by follower, set when rejecting
+	// a stale leader so that it can redirect clients
+	LeaderId   RaftId
+	LeaderAddr RaftAddr
 }
 
 func (AppendEntriesResults) getType() rpcArgsType {
@@ -109,6 +177,12 @@ var _ rpcArgs = RequestVoteArgs{}
 
 // RequestVoteArgs
 type RequestVoteArgs struct {
+	// highest protocol version supported by candidate
+	ProtocolVersion ProtocolVersion
+	// raft group the request is routed to,
+	// empty outside of MultiRaft
+	Group GroupId
+
 	// term candidate’s term
 	Term uint64
 	// candidateId candidate requesting vote
@@ -118,6 +192,10 @@ type RequestVoteArgs struct {
 	LastLogIndex uint64
 	// lastLogTerm term of candidate’s last log entry (§5.4)
 	LastLogTerm uint64
+
+	// election started by TimeoutNow,
+	// voters shouldn't ignore it even if leader is active (§3.10)
+	LeadershipTransfer bool
 }
 
 func (RequestVoteArgs) getType() rpcArgsType {
@@ -132,10 +210,17 @@ var _ rpcArgs = RequestVoteResults{}
 
 // RequestVoteResults
 type RequestVoteResults struct {
+	// highest protocol version supported by voter
+	ProtocolVersion ProtocolVersion
+
 	// currentTerm, for candidate to update itself
 	Term uint64
 	// true means candidate received vote
 	VoteGranted bool
+
+	// voter's commitIndex, so that candidate lagging
+	// too far behind can abandon the election
+	CommitIndex uint64
 }
 
 func (RequestVoteResults) getType() rpcArgsType {
@@ -169,18 +254,41 @@ type rpcService struct {
 // 	4. Append any new entries not already in the log
 // 	5. If leaderCommit > commitIndex, set commitIndex = min(leaderCommit, index of last new entry)
 func (s *rpcService) AppendEntries(args AppendEntriesArgs, results *AppendEntriesResults) error {
+	if s.quarantined(args.LeaderId, &results.Term) {
+		return nil
+	}
 	s.refreshLastHeartbeat()
 	s.raft.sendRPCArgs(args)
 	s.GetServer().ResetTimer()
+	s.observeProtocolVersion(args.LeaderId, args.ProtocolVersion)
 	defer func() {
 		results.Term = s.GetCurrentTerm()
+		results.ProtocolVersion = s.versions.local
+		results.UnderPressure = s.pressure.underPressure()
 	}()
 
 	currentTerm := s.GetCurrentTerm()
 	// 1. Reply false if term < currentTerm (§5.1)
 	if args.Term < currentTerm {
+		if leader, ok := s.Leader(); ok {
+			results.LeaderId, results.LeaderAddr = leader.Id, leader.Addr
+		}
 		return nil
 	}
+	if args.LeaderId != s.Id() {
+		s.recordLeadership(args.Term, args.LeaderId, 0, LeadershipReasonObserved)
+		s.hint.observe(args.Term, RaftPeer{Id: args.LeaderId, Addr: args.LeaderAddr})
+	}
+	if c, ok := s.GetServer().(*candidate); ok {
+		c.discoverLeader(args.Term)
+	}
+	s.consumeHeartbeatExtension(args)
+	s.checkConfigChecksum(args)
+	s.withholding.observe(args.TransferTarget, s.electionTimeout[1], s.now())
+	s.divergence.observe(args.LeaderCommit)
+
+	s.acks.mux.Lock()
+	defer s.acks.mux.Unlock()
 	// 	2. Reply false if log doesn’t contain an entry at prevLogIndex
 	// 		whose term matches prevLogTerm (§5.3)
 	match, err := s.Match(args.PrevLogIndex, args.PrevLogTerm)
@@ -188,49 +296,45 @@ func (s *rpcService) AppendEntries(args AppendEntriesArgs, results *AppendEntrie
 		return err
 	}
 	if !match {
-		return nil
+		return s.fillConflictHint(args.PrevLogIndex, results)
 	}
 	results.Success = true
-	// 	3. If an existing entry conflicts with a new one (same index
-	// 		but different terms), delete the existing entry and all that follow it (§5.3)
-	// 	4. Append any new entries not already in the log
-	if len(args.Entries) > 0 {
-		err = s.raft.Log.AppendAfter(args.PrevLogIndex, args.Entries...)
+	lastNewIndex := args.PrevLogIndex + uint64(len(args.Entries))
+	if len(args.Entries) > 0 && s.acks.covered(args.Term, lastNewIndex) {
+		// entries are already appended by a later request from the same leader
+		s.metrics.IncrCounter(MetricAppendEntriesCoalesced, 1)
+	} else if len(args.Entries) > 0 {
+		// 	3. If an existing entry conflicts with a new one (same index
+		// 		but different terms), delete the existing entry and all that follow it (§5.3)
+		// 	4. Append any new entries not already in the log
+		err = s.raft.checkTruncation(args.PrevLogIndex, args.Entries)
 		if err != nil {
 			return err
 		}
-
-		// fallback config if config log entry is delete
-		config := s.raft.configs.GetConfig()
-		for config.GetIndex() > args.PrevLogIndex {
-			err = s.raft.configs.FallbackConfig()
-			if err != nil {
-				return err
-			}
-			config = s.raft.configs.GetConfig()
+		end := s.traceEntries(SpanFollowerAppend, args.Entries, Label{Name: "raft.leader", Value: string(args.LeaderId)})
+		err = s.raft.Log.AppendAfter(args.PrevLogIndex, args.Entries...)
+		end(err)
+		if err != nil {
+			return err
 		}
-		// Once a given server adds the new configuration entry to its log,
-		// it uses that configuration for all future decisions
-		for i, entry := range args.Entries {
-			index := args.PrevLogIndex + uint64(i) + 1
-			if entry.Type == logEntryTypeConfig {
-				config, err := s.raft.configs.NewConfig(index, entry.Command)
-				if err != nil {
-					return err
-				}
-				s.raft.configs.UseConfig(config)
-
-				if config.IsJoint() {
-					s.raft.debug("~> C(old,new): %v", config)
-				} else {
-					s.raft.debug("~> C(new): %v", config)
-				}
-			}
+		err = s.raft.appendedEntries(args.PrevLogIndex, args.Entries)
+		if err != nil {
+			return err
 		}
 	}
+	// heartbeats from leaders of older versions carry no leaderCommit
+	if args.LeaderCommit > 0 {
+		s.catchup.observe(args.LeaderCommit)
+	}
+	// acknowledge cumulatively
+	results.MatchIndex = s.acks.advance(args.Term, lastNewIndex)
 	// 	5. If leaderCommit > commitIndex,
 	//		set commitIndex = min(leaderCommit, index of last new entry)
-	s.syncLeaderCommit(args.LeaderCommit)
+	leaderCommit := args.LeaderCommit
+	if leaderCommit > lastNewIndex {
+		leaderCommit = lastNewIndex
+	}
+	s.syncLeaderCommit(leaderCommit)
 
 	return nil
 }
@@ -249,7 +353,22 @@ func (s *rpcService) AppendEntries(args AppendEntriesArgs, results *AppendEntrie
 // 	4. Append any new entries not already in the log
 // 	5. If leaderCommit > commitIndex, set commitIndex = min(leaderCommit, index of last new entry)
 func (s *rpcService) RequestVote(args RequestVoteArgs, results *RequestVoteResults) error {
-	if s.isLeaderActive() {
+	if s.quarantined(args.CandidateId, &results.Term) {
+		return nil
+	}
+	if s.removedCandidate(args.CandidateId) {
+		s.log(LogElection).Debug("Ignore vote request, not a member of configuration", "candidate", args.CandidateId, "candidateTerm", args.Term)
+		return nil
+	}
+	if s.isLeaderActive() && !args.LeadershipTransfer {
+		return nil
+	}
+	if s.withholding.withhold(args.CandidateId, s.now()) {
+		s.log(LogElection).Debug("Leadership is being transferred, withhold vote", "candidate", args.CandidateId, "candidateTerm", args.Term)
+		return nil
+	}
+	if s.configMismatch.diverged() {
+		s.log(LogElection).Warn("Configuration diverged from leader, refuse to vote", "candidate", args.CandidateId, "candidateTerm", args.Term)
 		return nil
 	}
 	// 加锁, 防止两个 term 相同
@@ -257,16 +376,27 @@ func (s *rpcService) RequestVote(args RequestVoteArgs, results *RequestVoteResul
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.debug("<- Vote request %s at %d", args.CandidateId, args.Term)
+	s.log(LogElection).Debug("<- Vote request", "candidate", args.CandidateId, "candidateTerm", args.Term)
 	s.sendRPCArgs(args)
 	s.GetServer().ResetTimer()
+	s.observeProtocolVersion(args.CandidateId, args.ProtocolVersion)
 	defer func() {
+		if results.VoteGranted {
+			// durable before replying, so that the voter can't vote for
+			// another candidate in the same term after restarting
+			err := s.SetVote(args.Term, args.CandidateId)
+			if err != nil {
+				s.log(LogElection).Error("Persist vote", "candidate", args.CandidateId, "candidateTerm", args.Term, "err", err)
+				results.VoteGranted = false
+			}
+		}
 		results.Term = s.GetCurrentTerm()
+		results.ProtocolVersion = s.versions.local
+		results.CommitIndex = s.GetCommitIndex()
 		if results.VoteGranted {
-			s.debug("-> Vote up %s at %d", args.CandidateId, args.Term)
-			s.SetVotedFor(args.CandidateId)
+			s.log(LogElection).Debug("-> Vote up", "candidate", args.CandidateId, "candidateTerm", args.Term)
 		} else {
-			s.debug("-> Vote down %s at %d", args.CandidateId, args.Term)
+			s.log(LogElection).Debug("-> Vote down", "candidate", args.CandidateId, "candidateTerm", args.Term)
 		}
 	}()
 
@@ -277,35 +407,22 @@ func (s *rpcService) RequestVote(args RequestVoteArgs, results *RequestVoteResul
 	}
 	// 	2. If votedFor is null or candidateId, and candidate’s log is at
 	// 		least as up-to-date as receiver’s log, grant vote (§5.2, §5.4)
-	votedFor := s.GetVotedFor()
-	if currentTerm == args.Term {
+	// the vote may be in a term that is not current yet
+	voteTerm, votedFor := s.GetVote()
+	if args.Term < voteTerm {
+		return nil
+	}
+	if args.Term == voteTerm {
 		if !(votedFor.isNil() || args.CandidateId == votedFor) {
 			return nil
 		}
 	}
 
-	// Raft determines which of two logs is more up-to-date
-	// by comparing the index and term of the last entries in the
-	// logs.
-	//
-	// If the logs have last entries with different terms, then
-	// the log with the later term is more up-to-date.
-	//
-	// If the logs end with the same term, then whichever log is longer is
-	// more up-to-date.
-	index, term, err := s.Last()
+	upToDate, err := s.logUpToDate(args.LastLogIndex, args.LastLogTerm)
 	if err != nil {
 		return err
 	}
-	if term < args.LastLogTerm {
-		results.VoteGranted = true
-		return nil
-	}
-	if term == args.LastLogTerm && index <= args.LastLogIndex {
-		results.VoteGranted = true
-		return nil
-	}
-
+	results.VoteGranted = upToDate
 	return nil
 }
 
@@ -316,7 +433,10 @@ func newDefaultRpc() *defaultRPC {
 	return rpc
 }
 
-var _ RPC = (*defaultRPC)(nil)
+var (
+	_ RPC              = (*defaultRPC)(nil)
+	_ TimeoutNowCaller = (*defaultRPC)(nil)
+)
 
 // defaultRPC
 type defaultRPC struct {
@@ -328,6 +448,9 @@ type defaultRPC struct {
 
 	server *rpc.Server
 
+	// tls 非 nil 时监听与拨号均使用 tls
+	tls *tls.Config
+
 	clients rpcClients
 }
 
@@ -340,11 +463,15 @@ func (r *defaultRPC) Listen(addr string) error {
 	if err != nil {
 		return err
 	}
+	if r.tls != nil {
+		r.l = tls.NewListener(r.l, r.tls)
+	}
 	return nil
 }
 
+// Serve 接受连接, 使用带 checksum 校验的 codec 处理 rpc 请求
 func (r *defaultRPC) Serve() error {
-	return http.Serve(r.l, r.server)
+	return serveRPC(r.server, r.l)
 }
 
 func (r *defaultRPC) Register(service RPCService) error {
@@ -356,15 +483,23 @@ func (r *defaultRPC) Close() error {
 	defer r.mux.Unlock()
 
 	closes := []func() error{
-		r.l.Close,
 		r.clients.Close,
 	}
+	if r.l != nil {
+		// not listening with external rpc server
+		closes = append(closes, r.l.Close)
+	}
 	for _, close := range closes {
 		_ = close()
 	}
 	return nil
 }
 
+// CloseAddr 实现 AddrCloser
+func (r *defaultRPC) CloseAddr(addr RaftAddr) error {
+	return r.clients.CloseAddr(addr)
+}
+
 func (r *defaultRPC) CallAppendEntries(addr RaftAddr, args AppendEntriesArgs) (results AppendEntriesResults, err error) {
 	client, err := r.clients.Get(addr)
 	if err != nil {
@@ -372,7 +507,7 @@ func (r *defaultRPC) CallAppendEntries(addr RaftAddr, args AppendEntriesArgs) (r
 	}
 
 	err = client.Call("raft.AppendEntries", args, &results)
-	if errors.Is(err, net.ErrClosed) {
+	if isClientBroken(err) {
 		r.clients.Delete(addr)
 	}
 	return results, err
@@ -385,17 +520,67 @@ func (r *defaultRPC) CallRequestVote(addr RaftAddr, args RequestVoteArgs) (resul
 	}
 
 	err = client.Call("raft.RequestVote", args, &results)
-	if errors.Is(err, net.ErrClosed) {
+	if isClientBroken(err) {
+		r.clients.Delete(addr)
+	}
+	return results, err
+}
+
+func (r *defaultRPC) CallTimeoutNow(addr RaftAddr, args TimeoutNowArgs) (results TimeoutNowResults, err error) {
+	client, err := r.clients.Get(addr)
+	if err != nil {
+		return results, err
+	}
+
+	err = client.Call("raft.TimeoutNow", args, &results)
+	if isClientBroken(err) {
+		r.clients.Delete(addr)
+	}
+	return results, err
+}
+
+func (r *defaultRPC) CallPreVote(addr RaftAddr, args PreVoteArgs) (results PreVoteResults, err error) {
+	client, err := r.clients.Get(addr)
+	if err != nil {
+		return results, err
+	}
+
+	err = client.Call("raft.PreVote", args, &results)
+	if isClientBroken(err) {
 		r.clients.Delete(addr)
 	}
 	return results, err
 }
 
+func (r *defaultRPC) CallInstallSnapshot(addr RaftAddr, args InstallSnapshotArgs) (results InstallSnapshotResults, err error) {
+	client, err := r.clients.Get(addr)
+	if err != nil {
+		return results, err
+	}
+
+	err = client.Call("raft.InstallSnapshot", args, &results)
+	if isClientBroken(err) {
+		r.clients.Delete(addr)
+	}
+	return results, err
+}
+
+// isClientBroken rpc.Client 是否已不可用
+// checksum 校验失败等错误会导致连接被关闭
+func isClientBroken(err error) bool {
+	return errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, rpc.ErrShutdown) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, ErrChecksumMismatch)
+}
+
 // rpcClients reuse rpc.Client
 type rpcClients struct {
 	mux     sync.RWMutex
 	clients map[RaftAddr]*rpc.Client
 	closed  bool
+
+	tls *tls.Config
 }
 
 func (c *rpcClients) Get(addr RaftAddr) (*rpc.Client, error) {
@@ -414,7 +599,11 @@ func (c *rpcClients) Get(addr RaftAddr) (*rpc.Client, error) {
 	if c.clients == nil {
 		c.clients = make(map[RaftAddr]*rpc.Client)
 	}
-	client, err := rpc.DialHTTP("tcp", string(addr))
+	conn, err := c.dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	client, err := dialRPC(conn, func() (net.Conn, error) { return c.dial(addr) })
 	if err != nil {
 		return nil, err
 	}
@@ -422,6 +611,13 @@ func (c *rpcClients) Get(addr RaftAddr) (*rpc.Client, error) {
 	return client, nil
 }
 
+func (c *rpcClients) dial(addr RaftAddr) (net.Conn, error) {
+	if c.tls != nil {
+		return tls.Dial("tcp", string(addr), c.tls)
+	}
+	return net.Dial("tcp", string(addr))
+}
+
 func (c *rpcClients) Delete(addr RaftAddr) {
 	c.mux.Lock()
 	defer c.mux.Unlock()
@@ -431,6 +627,18 @@ func (c *rpcClients) Delete(addr RaftAddr) {
 	delete(c.clients, addr)
 }
 
+// CloseAddr 关闭并移除 addr 的 rpc.Client
+func (c *rpcClients) CloseAddr(addr RaftAddr) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	client, ok := c.clients[addr]
+	if !ok {
+		return nil
+	}
+	delete(c.clients, addr)
+	return client.Close()
+}
+
 func (c *rpcClients) Close() error {
 	c.mux.Lock()
 	defer c.mux.Unlock()
@@ -446,7 +654,10 @@ func (c *rpcClients) Close() error {
 	return nil
 }
 
-var _ RPC = (*rpcWrapper)(nil)
+var (
+	_ RPC              = (*rpcWrapper)(nil)
+	_ TimeoutNowCaller = (*rpcWrapper)(nil)
+)
 
 func newRpcWrapper(raft *raft, rpc RPC) *rpcWrapper {
 	return &rpcWrapper{
@@ -461,14 +672,52 @@ type rpcWrapper struct {
 	RPC
 }
 
+// CloseAddr 实现 AddrCloser, 被包装的 RPC 未实现时不做任何事
+func (w *rpcWrapper) CloseAddr(addr RaftAddr) error {
+	if closer, ok := w.RPC.(AddrCloser); ok {
+		return closer.CloseAddr(addr)
+	}
+	return nil
+}
+
 func (w *rpcWrapper) CallAppendEntries(addr RaftAddr, args AppendEntriesArgs) (results AppendEntriesResults, err error) {
+	args.ProtocolVersion = w.versions.local
 	results, err = w.RPC.CallAppendEntries(addr, args)
+	if err == nil {
+		w.raft.observeNewerTerm(results.Term, RaftPeer{Id: results.LeaderId, Addr: results.LeaderAddr})
+	}
 	w.raft.sendRPCArgs(results)
 	return results, err
 }
 
 func (w *rpcWrapper) CallRequestVote(addr RaftAddr, args RequestVoteArgs) (results RequestVoteResults, err error) {
+	args.ProtocolVersion = w.versions.local
 	results, err = w.RPC.CallRequestVote(addr, args)
 	w.raft.sendRPCArgs(results)
 	return results, err
 }
+
+func (w *rpcWrapper) CallTimeoutNow(addr RaftAddr, args TimeoutNowArgs) (results TimeoutNowResults, err error) {
+	caller, ok := w.RPC.(TimeoutNowCaller)
+	if !ok {
+		return results, ErrTimeoutNowNotSupported
+	}
+	args.ProtocolVersion = w.versions.local
+	results, err = caller.CallTimeoutNow(addr, args)
+	w.raft.sendRPCArgs(results)
+	return results, err
+}
+
+func (w *rpcWrapper) CallInstallSnapshot(addr RaftAddr, args InstallSnapshotArgs) (results InstallSnapshotResults, err error) {
+	args.ProtocolVersion = w.versions.local
+	results, err = w.RPC.CallInstallSnapshot(addr, args)
+	w.raft.sendRPCArgs(results)
+	return results, err
+}
+
+func (w *rpcWrapper) CallPreVote(addr RaftAddr, args PreVoteArgs) (results PreVoteResults, err error) {
+	args.ProtocolVersion = w.versions.local
+	results, err = w.RPC.CallPreVote(addr, args)
+	w.raft.sendRPCArgs(results)
+	return results, err
+}
@@ -0,0 +1,158 @@
+package raft
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net/rpc"
+)
+
+var (
+	ErrChecksumMismatch = errors.New("err: rpc frame checksum mismatch")
+	ErrFrameTooLarge    = errors.New("err: rpc frame too large")
+)
+
+// maxFrameSize 单个 rpc 帧的最大字节数,
+// 防止损坏的长度字段导致分配过大的内存
+const maxFrameSize = 256 << 20
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// writeFrame 写入一帧: length(4 bytes) | crc32c(4 bytes) | payload
+func writeFrame(w *bufio.Writer, payload []byte) error {
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(header[4:], crc32.Checksum(payload, crc32cTable))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(payload); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// readFrame 读取一帧, 并在解码前校验 checksum
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	if length > maxFrameSize {
+		return nil, ErrFrameTooLarge
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	if crc32.Checksum(payload, crc32cTable) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, ErrChecksumMismatch
+	}
+	return payload, nil
+}
+
+// encodeFrame 将 header 与 body 编码为一帧
+//
+// 每帧使用独立的 gob encoder, 使得每帧可以单独校验与解码
+func encodeFrame(header, body interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	if err := enc.Encode(header); err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(body); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func newChecksumServerCodec(conn io.ReadWriteCloser) rpc.ServerCodec {
+	return &checksumServerCodec{
+		rwc: conn,
+		r:   bufio.NewReader(conn),
+		w:   bufio.NewWriter(conn),
+	}
+}
+
+var _ rpc.ServerCodec = (*checksumServerCodec)(nil)
+
+// checksumServerCodec 带 checksum 校验的 rpc.ServerCodec
+type checksumServerCodec struct {
+	rwc io.ReadWriteCloser
+	r   *bufio.Reader
+	w   *bufio.Writer
+	dec *gob.Decoder
+}
+
+func (c *checksumServerCodec) ReadRequestHeader(r *rpc.Request) error {
+	payload, err := readFrame(c.r)
+	if err != nil {
+		return err
+	}
+	c.dec = gob.NewDecoder(bytes.NewReader(payload))
+	return c.dec.Decode(r)
+}
+
+func (c *checksumServerCodec) ReadRequestBody(body interface{}) error {
+	return c.dec.Decode(body)
+}
+
+func (c *checksumServerCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	payload, err := encodeFrame(r, body)
+	if err != nil {
+		return err
+	}
+	return writeFrame(c.w, payload)
+}
+
+func (c *checksumServerCodec) Close() error {
+	return c.rwc.Close()
+}
+
+func newChecksumClientCodec(conn io.ReadWriteCloser) rpc.ClientCodec {
+	return &checksumClientCodec{
+		rwc: conn,
+		r:   bufio.NewReader(conn),
+		w:   bufio.NewWriter(conn),
+	}
+}
+
+var _ rpc.ClientCodec = (*checksumClientCodec)(nil)
+
+// checksumClientCodec 带 checksum 校验的 rpc.ClientCodec
+type checksumClientCodec struct {
+	rwc io.ReadWriteCloser
+	r   *bufio.Reader
+	w   *bufio.Writer
+	dec *gob.Decoder
+}
+
+func (c *checksumClientCodec) WriteRequest(r *rpc.Request, body interface{}) error {
+	payload, err := encodeFrame(r, body)
+	if err != nil {
+		return err
+	}
+	return writeFrame(c.w, payload)
+}
+
+func (c *checksumClientCodec) ReadResponseHeader(r *rpc.Response) error {
+	payload, err := readFrame(c.r)
+	if err != nil {
+		return err
+	}
+	c.dec = gob.NewDecoder(bytes.NewReader(payload))
+	return c.dec.Decode(r)
+}
+
+func (c *checksumClientCodec) ReadResponseBody(body interface{}) error {
+	return c.dec.Decode(body)
+}
+
+func (c *checksumClientCodec) Close() error {
+	return c.rwc.Close()
+}
@@ -0,0 +1,78 @@
+package raft
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"net/rpc"
+	"testing"
+)
+
+func TestFrame(t *testing.T) {
+	payload := []byte("AppendEntries payload")
+
+	t.Run("intact", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := writeFrame(bufio.NewWriter(&buf), payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := readFrame(bufio.NewReader(&buf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Errorf("expect %q but got %q", payload, got)
+		}
+	})
+	t.Run("corrupted", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := writeFrame(bufio.NewWriter(&buf), payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := buf.Bytes()
+		b[len(b)-1] ^= 0xff
+		_, err = readFrame(bufio.NewReader(bytes.NewReader(b)))
+		if !errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("expect %v but got %v", ErrChecksumMismatch, err)
+		}
+	})
+}
+
+type echoService struct{}
+
+func (echoService) Echo(args AppendEntriesArgs, results *AppendEntriesArgs) error {
+	*results = args
+	return nil
+}
+
+func TestChecksumCodec(t *testing.T) {
+	server := rpc.NewServer()
+	err := server.RegisterName("echo", echoService{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConn, clientConn := net.Pipe()
+	go server.ServeCodec(newChecksumServerCodec(serverConn))
+	client := rpc.NewClientWithCodec(newChecksumClientCodec(clientConn))
+	defer client.Close()
+
+	args := AppendEntriesArgs{
+		Term:     1,
+		LeaderId: "1",
+		Entries:  []LogEntry{{Index: 1, Term: 1, Command: Command("command")}},
+	}
+	for i := 0; i < 3; i++ {
+		var results AppendEntriesArgs
+		err = client.Call("echo.Echo", args, &results)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if results.LeaderId != args.LeaderId || len(results.Entries) != 1 ||
+			!bytes.Equal(results.Entries[0].Command, args.Entries[0].Command) {
+			t.Errorf("expect %+v but got %+v", args, results)
+		}
+	}
+}
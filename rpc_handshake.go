@@ -0,0 +1,147 @@
+package raft
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/rpc"
+	"time"
+)
+
+// rpc 连接的协商
+//
+// 带 checksum 的分帧协议与旧版本使用的 net/rpc over HTTP 不兼容, 因此在每条新连接上协商:
+//   - 新版本客户端建立连接后先发送 framedPreamble, 新版本服务端回复相同的内容,
+//     之后双方使用带 checksum 的分帧 codec;
+//   - 旧版本服务端(http.Serve)把 framedPreamble 当作非法的 HTTP 请求回复 400,
+//     客户端据此重新建立连接, 使用 HTTP CONNECT 与 gob codec;
+//   - 旧版本客户端(rpc.DialHTTP)发送 HTTP CONNECT, 服务端按旧协议处理.
+const framedPreamble = "RAFT-FRAMED/1\n"
+
+// rpcHandshakeTimeout 协商阶段的超时时间
+const rpcHandshakeTimeout = 5 * time.Second
+
+// httpConnected 与 net/rpc 中 HTTP CONNECT 成功时的响应一致
+const httpConnected = "200 Connected to Go RPC"
+
+var ErrRPCHandshake = errors.New("err: rpc handshake failed")
+
+// serveConn 协商 conn 使用的协议并处理请求, 阻塞直到连接关闭
+func serveConn(server *rpc.Server, conn io.ReadWriteCloser) {
+	r := bufio.NewReader(conn)
+	setReadDeadline(conn, time.Now().Add(rpcHandshakeTimeout))
+	preamble, err := r.Peek(len(framedPreamble))
+	setReadDeadline(conn, time.Time{})
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	buffered := &bufferedConn{ReadWriteCloser: conn, r: r}
+	if string(preamble) == framedPreamble {
+		_, _ = r.Discard(len(framedPreamble))
+		if _, err := io.WriteString(conn, framedPreamble); err != nil {
+			_ = conn.Close()
+			return
+		}
+		server.ServeCodec(newChecksumServerCodec(buffered))
+		return
+	}
+
+	// 旧版本客户端: net/rpc over HTTP
+	req, err := http.ReadRequest(r)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	if req.Method != http.MethodConnect || req.URL.Path != rpc.DefaultRPCPath {
+		_, _ = io.WriteString(conn, "HTTP/1.0 405 must CONNECT\n\n")
+		_ = conn.Close()
+		return
+	}
+	if _, err := io.WriteString(conn, "HTTP/1.0 "+httpConnected+"\n\n"); err != nil {
+		_ = conn.Close()
+		return
+	}
+	server.ServeConn(buffered)
+}
+
+// dialRPC 在 conn 上协商协议并创建 rpc.Client
+//
+// 对端为旧版本时, conn 会被关闭, 并通过 redial 建立新连接使用 net/rpc over HTTP
+func dialRPC(conn net.Conn, redial func() (net.Conn, error)) (*rpc.Client, error) {
+	framed, err := negotiateFramed(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if framed {
+		return rpc.NewClientWithCodec(newChecksumClientCodec(conn)), nil
+	}
+
+	_ = conn.Close()
+	conn, err = redial()
+	if err != nil {
+		return nil, err
+	}
+	client, err := dialHTTPRPC(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// negotiateFramed 发送 framedPreamble, 返回对端是否支持分帧协议
+func negotiateFramed(conn net.Conn) (bool, error) {
+	_ = conn.SetDeadline(time.Now().Add(rpcHandshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	if _, err := io.WriteString(conn, framedPreamble); err != nil {
+		return false, err
+	}
+	reply := make([]byte, len(framedPreamble))
+	_, err := io.ReadFull(conn, reply)
+	if err == nil {
+		return string(reply) == framedPreamble, nil
+	}
+	// 旧版本服务端回复 400 后关闭连接, 回复可能短于 framedPreamble
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return false, nil
+	}
+	return false, err
+}
+
+// dialHTTPRPC 同 rpc.DialHTTP, 但使用已经建立的连接(可能是 tls 连接)
+func dialHTTPRPC(conn net.Conn) (*rpc.Client, error) {
+	_ = conn.SetDeadline(time.Now().Add(rpcHandshakeTimeout))
+	if _, err := io.WriteString(conn, "CONNECT "+rpc.DefaultRPCPath+" HTTP/1.0\n\n"); err != nil {
+		return nil, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status != httpConnected {
+		return nil, ErrRPCHandshake
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return rpc.NewClient(conn), nil
+}
+
+// bufferedConn 先读取协商时已缓冲的数据
+type bufferedConn struct {
+	io.ReadWriteCloser
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+func setReadDeadline(conn io.ReadWriteCloser, t time.Time) {
+	if c, ok := conn.(interface{ SetReadDeadline(time.Time) error }); ok {
+		_ = c.SetReadDeadline(t)
+	}
+}
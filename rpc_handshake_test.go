@@ -0,0 +1,82 @@
+package raft
+
+import (
+	"net"
+	"net/http"
+	"net/rpc"
+	"testing"
+)
+
+func TestRPCHandshake(t *testing.T) {
+	server := rpc.NewServer()
+	err := server.RegisterName("echo", echoService{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := AppendEntriesArgs{Term: 1, LeaderId: "1"}
+	call := func(t *testing.T, client *rpc.Client) {
+		var results AppendEntriesArgs
+		err := client.Call("echo.Echo", args, &results)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if results.LeaderId != args.LeaderId {
+			t.Errorf("expect %+v but got %+v", args, results)
+		}
+	}
+	listen := func(t *testing.T) net.Listener {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { l.Close() })
+		return l
+	}
+
+	t.Run("framed", func(t *testing.T) {
+		l := listen(t)
+		go serveRPC(server, l)
+
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		framed, err := negotiateFramed(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !framed {
+			t.Fatalf("expect framed protocol but got http")
+		}
+		client := rpc.NewClientWithCodec(newChecksumClientCodec(conn))
+		defer client.Close()
+		call(t, client)
+	})
+
+	t.Run("old client", func(t *testing.T) {
+		l := listen(t)
+		go serveRPC(server, l)
+
+		client, err := rpc.DialHTTP("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+		call(t, client)
+	})
+
+	t.Run("old server", func(t *testing.T) {
+		l := listen(t)
+		mux := http.NewServeMux()
+		mux.Handle(rpc.DefaultRPCPath, server)
+		go http.Serve(l, mux)
+
+		clients := &rpcClients{}
+		defer clients.Close()
+		client, err := clients.Get(RaftAddr(l.Addr().String()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		call(t, client)
+	})
+}
@@ -0,0 +1,125 @@
+package raft
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	ErrLoopbackAddrInUse       = errors.New("err: loopback address already in use")
+	ErrLoopbackAddrUnreachable = errors.New("err: loopback address unreachable")
+)
+
+// loopbackServices 进程内所有 loopback rpc 服务, addr -> RPCService
+var loopbackServices sync.Map
+
+func newLoopbackRPC() *loopbackRPC {
+	return &loopbackRPC{
+		closed: make(chan struct{}),
+	}
+}
+
+var (
+	_ RPC              = (*loopbackRPC)(nil)
+	_ TimeoutNowCaller = (*loopbackRPC)(nil)
+)
+
+// loopbackRPC 进程内的 rpc 实现, 不经过网络
+// 用于开发模式与测试
+type loopbackRPC struct {
+	mux     sync.Mutex
+	addr    string
+	service RPCService
+
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (r *loopbackRPC) Listen(addr string) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	_, loaded := loopbackServices.LoadOrStore(addr, r.service)
+	if loaded {
+		return ErrLoopbackAddrInUse
+	}
+	r.addr = addr
+	return nil
+}
+
+func (r *loopbackRPC) Serve() error {
+	<-r.closed
+	return nil
+}
+
+func (r *loopbackRPC) Register(service RPCService) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.service = service
+	return nil
+}
+
+func (r *loopbackRPC) Close() error {
+	r.once.Do(func() {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		if r.addr != "" {
+			loopbackServices.Delete(r.addr)
+		}
+		close(r.closed)
+	})
+	return nil
+}
+
+func (r *loopbackRPC) CallAppendEntries(addr RaftAddr, args AppendEntriesArgs) (results AppendEntriesResults, err error) {
+	service, err := r.lookup(addr)
+	if err != nil {
+		return results, err
+	}
+	err = service.AppendEntries(args, &results)
+	return results, err
+}
+
+func (r *loopbackRPC) CallRequestVote(addr RaftAddr, args RequestVoteArgs) (results RequestVoteResults, err error) {
+	service, err := r.lookup(addr)
+	if err != nil {
+		return results, err
+	}
+	err = service.RequestVote(args, &results)
+	return results, err
+}
+
+func (r *loopbackRPC) CallTimeoutNow(addr RaftAddr, args TimeoutNowArgs) (results TimeoutNowResults, err error) {
+	service, err := r.lookup(addr)
+	if err != nil {
+		return results, err
+	}
+	err = ServeTimeoutNow(service, args, &results)
+	return results, err
+}
+
+func (r *loopbackRPC) CallInstallSnapshot(addr RaftAddr, args InstallSnapshotArgs) (results InstallSnapshotResults, err error) {
+	service, err := r.lookup(addr)
+	if err != nil {
+		return results, err
+	}
+	err = service.InstallSnapshot(args, &results)
+	return results, err
+}
+
+func (r *loopbackRPC) CallPreVote(addr RaftAddr, args PreVoteArgs) (results PreVoteResults, err error) {
+	service, err := r.lookup(addr)
+	if err != nil {
+		return results, err
+	}
+	err = service.PreVote(args, &results)
+	return results, err
+}
+
+func (r *loopbackRPC) lookup(addr RaftAddr) (RPCService, error) {
+	service, ok := loopbackServices.Load(string(addr))
+	if !ok {
+		return nil, ErrLoopbackAddrUnreachable
+	}
+	return service.(RPCService), nil
+}
@@ -0,0 +1,54 @@
+package raft
+
+import (
+	"io"
+	"net"
+	"net/rpc"
+)
+
+// RPCServer 在外部管理的连接上处理默认 rpc 协议的请求
+//
+// 默认的 RPC 实现由 Run 自行 Listen/Serve. 需要与其他服务共用端口(如 cmux)
+// 时, 使用 WithExternalRPCServer 禁止 Run 监听, 并将 Raft.RPCService 挂载到
+// RPCServer 上, 由外部服务器接受连接:
+//
+//	r, _ := raft.New(id, addr, apply, store, log, raft.WithExternalRPCServer())
+//	server, _ := raft.NewRPCServer(r.RPCService())
+//	go server.Serve(raftListener)
+//
+// 使用其他传输协议(gRPC, HTTP)时, 实现 RPC 发起调用, 并在 handler 中
+// 直接调用 RPCService 的方法.
+type RPCServer struct {
+	server *rpc.Server
+}
+
+// NewRPCServer 创建处理 service 请求的 RPCServer
+func NewRPCServer(service RPCService) (*RPCServer, error) {
+	server := rpc.NewServer()
+	err := server.RegisterName("raft", service)
+	if err != nil {
+		return nil, err
+	}
+	return &RPCServer{server: server}, nil
+}
+
+// Serve 接受 l 上的连接并处理请求, 直到 l 关闭
+func (s *RPCServer) Serve(l net.Listener) error {
+	return serveRPC(s.server, l)
+}
+
+// ServeConn 处理 conn 上的请求, 阻塞直到连接关闭
+func (s *RPCServer) ServeConn(conn io.ReadWriteCloser) {
+	serveConn(s.server, conn)
+}
+
+// serveRPC 接受连接, 协商协议后处理 rpc 请求, 见 serveConn
+func serveRPC(server *rpc.Server, l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go serveConn(server, conn)
+	}
+}
@@ -0,0 +1,40 @@
+package raft
+
+import (
+	"net"
+	"testing"
+)
+
+func TestRPCServer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	addr := RaftAddr(l.Addr().String())
+
+	// Run must not listen on addr, which is owned by the external server
+	r, err := New("rpc-server", addr, nil, &memoryStore{}, &memoryLog{}, WithExternalRPCServer())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	go r.Run()
+	r.(*raft).SetCurrentTerm(3)
+
+	server, err := NewRPCServer(r.RPCService())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(l)
+
+	client := newDefaultRpc()
+	defer client.Close()
+	results, err := client.CallRequestVote(addr, RequestVoteArgs{Term: 2, CandidateId: "candidate"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results.Term != 3 || results.VoteGranted {
+		t.Errorf("expect vote rejected at term 3 but got %+v", results)
+	}
+}
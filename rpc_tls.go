@@ -0,0 +1,54 @@
+package raft
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+var (
+	ErrTLSUnsupportedRPC = errors.New("err: tls is only supported by the built-in tcp rpc")
+	ErrInvalidCAFile     = errors.New("err: no certificate found in ca file")
+)
+
+// NewMutualTLSConfig 从 PEM 文件加载双向认证的 tls 配置
+//
+// 同一份配置同时用于服务端与客户端: certFile/keyFile 为本节点证书,
+// caFile 中的 CA 用于校验 peer 的服务端证书与客户端证书.
+//
+//	config, err := raft.NewMutualTLSConfig("node.crt", "node.key", "ca.crt")
+//	r, err := raft.New(id, addr, apply, store, log, raft.WithTLS(config))
+func NewMutualTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCAFile, caFile)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// applyTLS 为内置的 tcp rpc 启用 tls
+func applyTLS(rpc RPC, config *tls.Config) error {
+	d, ok := rpc.(*defaultRPC)
+	if !ok {
+		return ErrTLSUnsupportedRPC
+	}
+	d.tls = config
+	d.clients.tls = config
+	return nil
+}
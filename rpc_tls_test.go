@@ -0,0 +1,160 @@
+package raft
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	caCert, caKey := writeTestCert(t, dir, "ca", nil, nil)
+	writeTestCert(t, dir, "node", caCert, caKey)
+	writeTestCert(t, dir, "stranger", nil, nil)
+
+	config, err := NewMutualTLSConfig(
+		filepath.Join(dir, "node.crt"), filepath.Join(dir, "node.key"), filepath.Join(dir, "ca.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := RaftAddr(l.Addr().String())
+	l.Close()
+
+	r, err := New("tls", addr, nil, &memoryStore{}, &memoryLog{}, WithTLS(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	go r.Run()
+	r.(*raft).SetCurrentTerm(3)
+
+	t.Run("mutual authentication", func(t *testing.T) {
+		client := newDefaultRpc()
+		if err := applyTLS(client, config); err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		var results RequestVoteResults
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			results, err = client.CallRequestVote(addr, RequestVoteArgs{Term: 2, CandidateId: "candidate"})
+			if err == nil || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if results.Term != 3 || results.VoteGranted {
+			t.Errorf("expect vote rejected at term 3 but got %+v", results)
+		}
+	})
+
+	t.Run("client without certificate", func(t *testing.T) {
+		client := newDefaultRpc()
+		if err := applyTLS(client, &tls.Config{RootCAs: config.RootCAs}); err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		_, err := client.CallRequestVote(addr, RequestVoteArgs{Term: 2, CandidateId: "candidate"})
+		if err == nil {
+			t.Error("expect error but got nil")
+		}
+	})
+
+	t.Run("client with untrusted certificate", func(t *testing.T) {
+		cert, err := tls.LoadX509KeyPair(filepath.Join(dir, "stranger.crt"), filepath.Join(dir, "stranger.key"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := newDefaultRpc()
+		if err := applyTLS(client, &tls.Config{RootCAs: config.RootCAs, Certificates: []tls.Certificate{cert}}); err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		_, err = client.CallRequestVote(addr, RequestVoteArgs{Term: 2, CandidateId: "candidate"})
+		if err == nil {
+			t.Error("expect error but got nil")
+		}
+	})
+
+	t.Run("unsupported rpc", func(t *testing.T) {
+		_, err := New("tls-loopback", "tls-loopback", nil, &memoryStore{}, &memoryLog{},
+			WithRPC(newLoopbackRPC()), WithTLS(config))
+		if !errors.Is(err, ErrTLSUnsupportedRPC) {
+			t.Errorf("expect %v but got %v", ErrTLSUnsupportedRPC, err)
+		}
+	})
+
+	t.Run("invalid ca file", func(t *testing.T) {
+		_, err := NewMutualTLSConfig(
+			filepath.Join(dir, "node.crt"), filepath.Join(dir, "node.key"), filepath.Join(dir, "node.key"))
+		if !errors.Is(err, ErrInvalidCAFile) {
+			t.Errorf("expect %v but got %v", ErrInvalidCAFile, err)
+		}
+	})
+}
+
+// writeTestCert 生成证书写入 dir/name.crt 与 dir/name.key, parent 为 nil 时自签为 CA
+func writeTestCert(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err := os.WriteFile(filepath.Join(dir, name+".crt"), certPem, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".key"), keyPem, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
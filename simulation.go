@@ -0,0 +1,685 @@
+package raft
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrSimulationStopped = errors.New("err: simulation stopped")
+	ErrSimulationDropped = errors.New("err: message dropped by simulation")
+	ErrSimulationTimeout = errors.New("err: simulation condition not met in time")
+	ErrInvariantViolated = errors.New("err: raft invariant violated")
+)
+
+const (
+	// simSettleInterval 判断静止时每轮等待的真实时间
+	simSettleInterval = 200 * time.Microsecond
+	// simSettleRounds 连续多少轮没有变化视为静止
+	simSettleRounds = 3
+)
+
+// simEpoch 虚拟时钟的起点
+var simEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Simulation 确定性模拟, 时间与消息投递由以 seed 初始化的调度器驱动, 而不是真实时间
+//
+// 节点的选举与心跳定时器, 选举超时的随机数, 以及租约, check quorum 等依赖的时间都取自虚拟时钟;
+// 节点之间的 RPC 由调度器按虚拟的到达时间依次投递, 延迟与丢包由 seed 决定.
+// 每一步之前等待所有节点静止, 再推进到下一个最早的事件(消息到达或定时器到期),
+// 因此相同的 seed 重放出相同的集群历史, 无需等待真实的选举超时.
+//
+// 每一步之前检查 raft 的安全性不变式, 违反时 Step 返回 ErrInvariantViolated:
+//   - election safety: 每个 term 至多一个 Leader;
+//   - log matching: 两个 log 中 index 与 term 相同的 log entry 之前的 log entry 都相同;
+//   - state machine safety: 各节点在同一 index 上 commit 的 log entry 相同;
+//   - leader completeness: commit 之后当选的 Leader 包含该 log entry.
+//
+// 静止通过短暂的真实时间内没有新的消息判断; 依赖真实时间的部分, 如复制失败后的退避,
+// 以及 metrics 中的耗时, 不在模拟范围内.
+//
+//	sim := raft.NewSimulation(seed)
+//	defer sim.Stop()
+//	for _, peer := range peers {
+//		sim.NewNode(peer.Id, peer.Addr, apply, nil, nil)
+//	}
+//	sim.Start()
+//	err := sim.RunFor(10 * time.Second)
+type Simulation struct {
+	seed int64
+	// now 虚拟时间(unix nano)
+	now   int64
+	clock *tickerPool
+
+	mux      sync.Mutex
+	rand     *rand.Rand
+	links    map[[2]RaftAddr]*simLink
+	services map[RaftAddr]RPCService
+	queue    simQueue
+	// active 正在处理的请求数
+	active int
+	// changes 消息入队与请求处理完成的次数, 用于判断是否静止
+	changes uint64
+
+	latency    [2]time.Duration
+	dropRate   float64
+	partitions map[RaftAddr]int
+
+	nodes      []*SimNode
+	invariants invariantChecker
+
+	once sync.Once
+	done chan struct{}
+}
+
+// NewSimulation 创建以 seed 初始化的模拟, 消息延迟默认为 [1ms, 5ms)
+func NewSimulation(seed int64) *Simulation {
+	s := &Simulation{
+		seed:       seed,
+		now:        simEpoch.UnixNano(),
+		rand:       rand.New(rand.NewSource(seed)),
+		links:      make(map[[2]RaftAddr]*simLink),
+		services:   make(map[RaftAddr]RPCService),
+		latency:    [2]time.Duration{time.Millisecond, 5 * time.Millisecond},
+		partitions: make(map[RaftAddr]int),
+		done:       make(chan struct{}),
+	}
+	s.clock = newManualTickerPool(s.Now)
+	return s
+}
+
+// SimNode Simulation 中的节点
+type SimNode struct {
+	Id   RaftId
+	Addr RaftAddr
+	Raft Raft
+	log  Log
+}
+
+// Seed 模拟的 seed
+func (s *Simulation) Seed() int64 {
+	return s.seed
+}
+
+// Now 虚拟时间
+func (s *Simulation) Now() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&s.now)).UTC()
+}
+
+// NewNode 创建由模拟驱动的节点, 须在 Start 之前调用
+// store, log 为 nil 时使用内存中的实现; optFns 中的 WithRPC 被忽略
+func (s *Simulation) NewNode(id RaftId, addr RaftAddr, apply Apply, store Store, log Log, optFns ...OptFn) (*SimNode, error) {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	if log == nil {
+		log = NewMemoryLog()
+	}
+	transport := &simTransport{sim: s, addr: addr, closed: make(chan struct{})}
+	optFns = append(optFns, WithRPC(transport), func(o *opts) {
+		o.externalRPCServer = false
+		o.tickers = s.clock
+		o.random = s.int63n
+	})
+	r, err := New(id, addr, apply, store, log, optFns...)
+	if err != nil {
+		return nil, err
+	}
+	node := &SimNode{Id: id, Addr: addr, Raft: r, log: log}
+	s.mux.Lock()
+	s.nodes = append(s.nodes, node)
+	s.mux.Unlock()
+	return node, nil
+}
+
+// Nodes 所有节点
+func (s *Simulation) Nodes() []*SimNode {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return append([]*SimNode(nil), s.nodes...)
+}
+
+// Start 启动所有节点
+func (s *Simulation) Start() {
+	for _, node := range s.Nodes() {
+		go node.Raft.Run()
+	}
+}
+
+// Stop 停止所有节点与模拟, 等待中的 RPC 返回 ErrSimulationStopped
+func (s *Simulation) Stop() {
+	s.once.Do(func() {
+		close(s.done)
+		for _, node := range s.Nodes() {
+			node.Raft.Stop()
+		}
+	})
+}
+
+// Leader 当前 term 最高的 Leader, 没有时返回 false
+func (s *Simulation) Leader() (*SimNode, bool) {
+	var (
+		leader *SimNode
+		term   uint64
+	)
+	for _, node := range s.Nodes() {
+		status := node.Raft.Stats()
+		if node.Raft.State() != LifecycleRunning || status.State != "Leader" {
+			continue
+		}
+		if leader == nil || status.Term > term {
+			leader, term = node, status.Term
+		}
+	}
+	return leader, leader != nil
+}
+
+// SetLatency 每条消息延迟 [min, max) 之间的随机虚拟时间
+func (s *Simulation) SetLatency(min, max time.Duration) {
+	if min < 0 || max < min {
+		panic("latency must be a non-negative range")
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.latency = [2]time.Duration{min, max}
+}
+
+// SetDropRate 以 rate 的概率丢弃请求或响应, 0 表示不丢弃
+func (s *Simulation) SetDropRate(rate float64) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.dropRate = rate
+}
+
+// Partition 将节点分为互不连通的分区, 每个 group 为一个分区, 未列出的节点在同一个分区中
+// 覆盖之前的分区
+func (s *Simulation) Partition(groups ...[]RaftId) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.partitions = make(map[RaftAddr]int)
+	for i, group := range groups {
+		for _, id := range group {
+			for _, node := range s.nodes {
+				if node.Id == id {
+					s.partitions[node.Addr] = i + 1
+				}
+			}
+		}
+	}
+}
+
+// Heal 消除所有分区
+func (s *Simulation) Heal() {
+	s.Partition()
+}
+
+// Step 等待节点静止并检查不变式, 再执行下一个最早的事件
+// 没有待执行的事件时 ok 为 false
+func (s *Simulation) Step() (ok bool, err error) {
+	select {
+	case <-s.done:
+		return false, ErrSimulationStopped
+	default:
+	}
+	s.settle()
+	err = s.invariants.check(s.Nodes())
+	if err != nil {
+		return false, err
+	}
+
+	s.mux.Lock()
+	var message *simMessage
+	if len(s.queue) > 0 {
+		message = s.queue[0]
+	}
+	s.mux.Unlock()
+	deadline, hasDeadline := s.clock.deadline()
+	switch {
+	case message != nil && (!hasDeadline || !deadline.Before(message.at)):
+		s.mux.Lock()
+		heap.Pop(&s.queue)
+		s.mux.Unlock()
+		s.advance(message.at)
+		message.deliver()
+	case hasDeadline:
+		s.advance(deadline)
+		s.clock.fire(s.Now())
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// Run 执行 steps 步, 或直到没有待执行的事件
+func (s *Simulation) Run(steps int) error {
+	for i := 0; i < steps; i++ {
+		ok, err := s.Step()
+		if err != nil || !ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunFor 推进 d 的虚拟时间
+func (s *Simulation) RunFor(d time.Duration) error {
+	return s.runUntil(s.Now().Add(d), nil)
+}
+
+// RunUntil 推进直到 cond 成立, 超过 d 的虚拟时间时返回 ErrSimulationTimeout
+func (s *Simulation) RunUntil(cond func() bool, d time.Duration) error {
+	return s.runUntil(s.Now().Add(d), cond)
+}
+
+func (s *Simulation) runUntil(end time.Time, cond func() bool) error {
+	for {
+		if cond != nil && cond() {
+			return nil
+		}
+		if !s.Now().Before(end) {
+			if cond != nil {
+				return fmt.Errorf("%w: at %s", ErrSimulationTimeout, s.Now().Sub(simEpoch))
+			}
+			return nil
+		}
+		ok, err := s.Step()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			s.advance(end)
+		}
+	}
+}
+
+func (s *Simulation) advance(to time.Time) {
+	if to.UnixNano() > atomic.LoadInt64(&s.now) {
+		atomic.StoreInt64(&s.now, to.UnixNano())
+	}
+}
+
+// settle 等待节点静止: 连续几轮没有新的消息, 也没有正在处理的请求
+func (s *Simulation) settle() {
+	for stable := 0; stable < simSettleRounds; {
+		s.mux.Lock()
+		changes := s.changes
+		s.mux.Unlock()
+		time.Sleep(simSettleInterval)
+		s.mux.Lock()
+		if s.active == 0 && s.changes == changes {
+			stable++
+		} else {
+			stable = 0
+		}
+		s.mux.Unlock()
+	}
+}
+
+// int63n 选举超时的随机数
+func (s *Simulation) int63n(n int64) int64 {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.rand.Int63n(n)
+}
+
+// simLink 两个节点之间单向的链路
+// 每条链路有独立的随机数与序号, 链路上的消息与其他链路上的发送顺序无关
+type simLink struct {
+	rand *rand.Rand
+	seq  uint64
+}
+
+func (s *Simulation) link(from, to RaftAddr) *simLink {
+	key := [2]RaftAddr{from, to}
+	l, ok := s.links[key]
+	if !ok {
+		h := fnv.New64a()
+		h.Write([]byte(from))
+		h.Write([]byte{0})
+		h.Write([]byte(to))
+		l = &simLink{rand: rand.New(rand.NewSource(s.seed ^ int64(h.Sum64())))}
+		s.links[key] = l
+	}
+	return l
+}
+
+// send 在 from 到 to 的链路上发送消息, 到达时由调度器调用 deliver, 丢弃时调用 drop
+func (s *Simulation) send(from, to RaftAddr, deliver func(), drop func(error)) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	l := s.link(from, to)
+	delay := s.latency[0]
+	if s.latency[1] > s.latency[0] {
+		delay += time.Duration(l.rand.Int63n(int64(s.latency[1] - s.latency[0])))
+	}
+	dropped := l.rand.Float64() < s.dropRate
+	l.seq++
+	m := &simMessage{
+		at:   s.Now().Add(delay),
+		from: from,
+		to:   to,
+		seq:  l.seq,
+		deliver: func() {
+			s.mux.Lock()
+			connected := s.partitions[from] == s.partitions[to]
+			s.mux.Unlock()
+			switch {
+			case !connected:
+				drop(fmt.Errorf("%w: %s and %s are partitioned", ErrSimulationDropped, from, to))
+			case dropped:
+				drop(fmt.Errorf("%w: from %s to %s", ErrSimulationDropped, from, to))
+			default:
+				deliver()
+			}
+		},
+	}
+	heap.Push(&s.queue, m)
+	s.changes++
+}
+
+// simCall 从 from 向 to 发送请求 args, 由 handle 调用 to 的 RPCService, 再将响应发回 from
+func simCall[A any, R any](s *Simulation, from, to RaftAddr, args A, handle func(RPCService, A, *R) error) (R, error) {
+	type reply struct {
+		results R
+		err     error
+	}
+	replies := make(chan reply, 1)
+	drop := func(err error) {
+		replies <- reply{err: err}
+	}
+	s.send(from, to, func() {
+		s.mux.Lock()
+		service, ok := s.services[to]
+		if ok {
+			s.active++
+		}
+		s.mux.Unlock()
+		if !ok {
+			drop(fmt.Errorf("%w: %s unreachable", ErrSimulationDropped, to))
+			return
+		}
+		// the service may wait for the node, which may be waiting for the scheduler
+		go func() {
+			var results R
+			err := handle(service, args, &results)
+			s.send(to, from, func() { replies <- reply{results, err} }, drop)
+			s.mux.Lock()
+			s.active--
+			s.changes++
+			s.mux.Unlock()
+		}()
+	}, drop)
+
+	select {
+	case r := <-replies:
+		return r.results, r.err
+	case <-s.done:
+		var zero R
+		return zero, ErrSimulationStopped
+	}
+}
+
+// simMessage 等待投递的消息
+type simMessage struct {
+	at       time.Time
+	from, to RaftAddr
+	seq      uint64
+	deliver  func()
+}
+
+// simQueue 按到达时间排序的最小堆, 同时到达的消息按链路与链路上的序号排序, 实现 heap.Interface
+type simQueue []*simMessage
+
+func (q simQueue) Len() int { return len(q) }
+
+func (q simQueue) Less(i, j int) bool {
+	a, b := q[i], q[j]
+	if !a.at.Equal(b.at) {
+		return a.at.Before(b.at)
+	}
+	if a.from != b.from {
+		return a.from < b.from
+	}
+	if a.to != b.to {
+		return a.to < b.to
+	}
+	return a.seq < b.seq
+}
+
+func (q simQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *simQueue) Push(x interface{}) {
+	*q = append(*q, x.(*simMessage))
+}
+
+func (q *simQueue) Pop() interface{} {
+	old := *q
+	m := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return m
+}
+
+var (
+	_ RPC              = (*simTransport)(nil)
+	_ TimeoutNowCaller = (*simTransport)(nil)
+)
+
+// simTransport 节点在 Simulation 中的 RPC
+type simTransport struct {
+	sim  *Simulation
+	addr RaftAddr
+
+	mux     sync.Mutex
+	service RPCService
+
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (t *simTransport) Listen(addr string) error {
+	t.mux.Lock()
+	service := t.service
+	t.mux.Unlock()
+	t.sim.mux.Lock()
+	defer t.sim.mux.Unlock()
+	t.sim.services[t.addr] = service
+	t.sim.changes++
+	return nil
+}
+
+func (t *simTransport) Serve() error {
+	<-t.closed
+	return nil
+}
+
+func (t *simTransport) Register(service RPCService) error {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.service = service
+	return nil
+}
+
+func (t *simTransport) Close() error {
+	t.once.Do(func() {
+		t.sim.mux.Lock()
+		delete(t.sim.services, t.addr)
+		t.sim.mux.Unlock()
+		close(t.closed)
+	})
+	return nil
+}
+
+func (t *simTransport) CallAppendEntries(addr RaftAddr, args AppendEntriesArgs) (AppendEntriesResults, error) {
+	// the receiver may modify entries, which are shared without serialization
+	args.Entries = append([]LogEntry(nil), args.Entries...)
+	return simCall(t.sim, t.addr, addr, args, RPCService.AppendEntries)
+}
+
+func (t *simTransport) CallRequestVote(addr RaftAddr, args RequestVoteArgs) (RequestVoteResults, error) {
+	return simCall(t.sim, t.addr, addr, args, RPCService.RequestVote)
+}
+
+func (t *simTransport) CallTimeoutNow(addr RaftAddr, args TimeoutNowArgs) (TimeoutNowResults, error) {
+	return simCall(t.sim, t.addr, addr, args, ServeTimeoutNow)
+}
+
+func (t *simTransport) CallInstallSnapshot(addr RaftAddr, args InstallSnapshotArgs) (InstallSnapshotResults, error) {
+	return simCall(t.sim, t.addr, addr, args, RPCService.InstallSnapshot)
+}
+
+func (t *simTransport) CallPreVote(addr RaftAddr, args PreVoteArgs) (PreVoteResults, error) {
+	return simCall(t.sim, t.addr, addr, args, RPCService.PreVote)
+}
+
+// invariantChecker 检查 raft 的安全性不变式, 见 Simulation
+type invariantChecker struct {
+	// leaders 每个 term 的 Leader
+	leaders map[uint64]RaftId
+	// committed 已 commit 的 log entry, committed[i] 为索引 i+1 的 log entry
+	committed []committedEntry
+}
+
+type committedEntry struct {
+	term uint64
+	// commitTerm 发现该 log entry 已 commit 时的 term
+	commitTerm uint64
+}
+
+func (c *invariantChecker) check(nodes []*SimNode) error {
+	if c.leaders == nil {
+		c.leaders = make(map[uint64]RaftId)
+	}
+	statuses := make([]Status, len(nodes))
+	for i, node := range nodes {
+		statuses[i] = node.Raft.Stats()
+	}
+	for i, node := range nodes {
+		status := statuses[i]
+		if status.State != "Leader" {
+			continue
+		}
+		if leader, ok := c.leaders[status.Term]; ok && leader != node.Id {
+			return fmt.Errorf("%w: election safety, %s and %s are both leaders of term %d", ErrInvariantViolated, leader, node.Id, status.Term)
+		}
+		c.leaders[status.Term] = node.Id
+	}
+	for i, node := range nodes {
+		if err := c.checkCommitted(node, statuses[i]); err != nil {
+			return err
+		}
+	}
+	for i, node := range nodes {
+		if statuses[i].State != "Leader" {
+			continue
+		}
+		if err := c.checkLeaderCompleteness(node, statuses[i].Term); err != nil {
+			return err
+		}
+	}
+	for i := range nodes {
+		for j := i + 1; j < len(nodes); j++ {
+			if err := checkLogMatching(nodes[i], nodes[j]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkCommitted node 上已 commit 的 log entry 与其他节点相同
+func (c *invariantChecker) checkCommitted(node *SimNode, status Status) error {
+	first, err := node.log.FirstIndex()
+	if err != nil {
+		return err
+	}
+	for index := first; index <= status.CommitIndex; index++ {
+		term, err := node.log.Get(index)
+		if err != nil {
+			return err
+		}
+		if index <= uint64(len(c.committed)) {
+			if expect := c.committed[index-1].term; term != expect {
+				return fmt.Errorf("%w: state machine safety, %s committed term %d at index %d, but term %d was committed",
+					ErrInvariantViolated, node.Id, term, index, expect)
+			}
+			continue
+		}
+		if index == uint64(len(c.committed))+1 {
+			c.committed = append(c.committed, committedEntry{term: term, commitTerm: status.Term})
+		}
+	}
+	return nil
+}
+
+// checkLeaderCompleteness Leader 包含在其 term 之前 commit 的所有 log entry
+func (c *invariantChecker) checkLeaderCompleteness(node *SimNode, term uint64) error {
+	first, err := node.log.FirstIndex()
+	if err != nil {
+		return err
+	}
+	for i, entry := range c.committed {
+		index := uint64(i) + 1
+		if index < first || entry.commitTerm >= term {
+			continue
+		}
+		got, err := node.log.Get(index)
+		if err != nil {
+			return err
+		}
+		if got != entry.term {
+			return fmt.Errorf("%w: leader completeness, leader %s of term %d has term %d at committed index %d of term %d",
+				ErrInvariantViolated, node.Id, term, got, index, entry.term)
+		}
+	}
+	return nil
+}
+
+// checkLogMatching 两个 log 中最后一个 index 与 term 都相同的 log entry 之前的 log entry 都相同
+func checkLogMatching(a, b *SimNode) error {
+	var bounds [2][2]uint64
+	for i, node := range []*SimNode{a, b} {
+		first, err := node.log.FirstIndex()
+		if err != nil {
+			return err
+		}
+		last, _, err := node.log.Last()
+		if err != nil {
+			return err
+		}
+		bounds[i] = [2]uint64{first, last}
+	}
+	first, last := bounds[0][0], bounds[0][1]
+	if bounds[1][0] > first {
+		first = bounds[1][0]
+	}
+	if bounds[1][1] < last {
+		last = bounds[1][1]
+	}
+	matched := false
+	for index := last; index >= first && index > 0; index-- {
+		termA, err := a.log.Get(index)
+		if err != nil {
+			return err
+		}
+		termB, err := b.log.Get(index)
+		if err != nil {
+			return err
+		}
+		if termA == termB {
+			matched = true
+			continue
+		}
+		if matched {
+			return fmt.Errorf("%w: log matching, %s and %s differ at index %d before a matching entry",
+				ErrInvariantViolated, a.Id, b.Id, index)
+		}
+	}
+	return nil
+}
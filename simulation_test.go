@@ -0,0 +1,206 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestSimulation(t *testing.T, seed int64, n int) (*Simulation, []*listFSM) {
+	t.Helper()
+	sim := NewSimulation(seed)
+	t.Cleanup(sim.Stop)
+	var (
+		fsms  []*listFSM
+		peers []RaftPeer
+	)
+	for i := 1; i <= n; i++ {
+		id := RaftId(fmt.Sprint("sim-", i))
+		fsm := &listFSM{}
+		_, err := sim.NewNode(id, RaftAddr(id), fsm.apply, nil, nil, WithElection(150*time.Millisecond, 300*time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fsms = append(fsms, fsm)
+		peers = append(peers, RaftPeer{Id: id, Addr: RaftAddr(id)})
+	}
+	err := sim.Nodes()[0].Raft.BootstrapCluster(Configuration{Peers: peers})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.Start()
+	return sim, fsms
+}
+
+// simPropose 在模拟推进的同时由 Leader 提交 fn
+func simPropose(t *testing.T, sim *Simulation, fn func(r Raft) error) {
+	t.Helper()
+	err := sim.RunUntil(func() bool {
+		_, ok := sim.Leader()
+		return ok
+	}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leader, _ := sim.Leader()
+	done := make(chan error, 1)
+	go func() { done <- fn(leader.Raft) }()
+	var result error
+	err = sim.RunUntil(func() bool {
+		select {
+		case result = <-done:
+			return true
+		default:
+			return false
+		}
+	}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != nil {
+		t.Fatal(result)
+	}
+}
+
+func TestSimulation(t *testing.T) {
+	t.Run("replicate", func(t *testing.T) {
+		sim, fsms := newTestSimulation(t, 1, 3)
+		simPropose(t, sim, func(r Raft) error { return r.Handle(context.Background(), Command("a")) })
+		// followers learn the commit index from the next AppendEntries
+		simPropose(t, sim, func(r Raft) error {
+			_, err := r.ProposeEntry(context.Background(), NewNoopEntry())
+			return err
+		})
+		err := sim.RunFor(time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, fsm := range fsms {
+			if got := fsm.get(); !reflect.DeepEqual(got, []string{"a"}) {
+				t.Errorf("expect node %d applied [a] but got %v", i+1, got)
+			}
+		}
+	})
+
+	t.Run("partition leader", func(t *testing.T) {
+		sim, _ := newTestSimulation(t, 2, 5)
+		simPropose(t, sim, func(r Raft) error { return r.Handle(context.Background(), Command("a")) })
+		old, _ := sim.Leader()
+		oldTerm := old.Raft.Stats().Term
+
+		sim.Partition([]RaftId{old.Id})
+		err := sim.RunUntil(func() bool {
+			leader, ok := sim.Leader()
+			return ok && leader.Id != old.Id
+		}, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leader, _ := sim.Leader()
+		if term := leader.Raft.Stats().Term; term <= oldTerm {
+			t.Errorf("expect new leader's term greater than %d but got %d", oldTerm, term)
+		}
+
+		sim.Heal()
+		err = sim.RunUntil(func() bool { return !old.Raft.IsLeader() }, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		simPropose(t, sim, func(r Raft) error { return r.Handle(context.Background(), Command("b")) })
+	})
+
+	t.Run("unreliable network", func(t *testing.T) {
+		sim, _ := newTestSimulation(t, 3, 3)
+		sim.SetLatency(time.Millisecond, 50*time.Millisecond)
+		sim.SetDropRate(0.2)
+		err := sim.RunFor(5 * time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("virtual time", func(t *testing.T) {
+		sim, _ := newTestSimulation(t, 4, 3)
+		start := time.Now()
+		err := sim.RunFor(10 * time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(start); elapsed >= 10*time.Second {
+			t.Errorf("expect simulated 10s faster than real time but took %s", elapsed)
+		}
+		if now := sim.Now(); now.Sub(simEpoch) < 10*time.Second {
+			t.Errorf("expect virtual time advanced by 10s but got %s", now.Sub(simEpoch))
+		}
+	})
+}
+
+func TestSimulationReproducible(t *testing.T) {
+	history := func(seed int64) map[uint64]RaftId {
+		sim, _ := newTestSimulation(t, seed, 3)
+		err := sim.RunFor(2 * time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sim.invariants.leaders
+	}
+	for seed := int64(1); seed <= 3; seed++ {
+		first, second := history(seed), history(seed)
+		if len(first) == 0 {
+			t.Fatalf("expect a leader elected with seed %d", seed)
+		}
+		if !reflect.DeepEqual(first, second) {
+			t.Errorf("expect the same leaders with seed %d but got %v and %v", seed, first, second)
+		}
+	}
+}
+
+func TestInvariantChecker(t *testing.T) {
+	newNode := func(id RaftId, terms ...uint64) *SimNode {
+		log := NewMemoryLog()
+		for _, term := range terms {
+			if _, err := log.AppendEntry(LogEntry{Term: term}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return &SimNode{Id: id, log: log}
+	}
+
+	t.Run("log matching", func(t *testing.T) {
+		err := checkLogMatching(newNode("a", 1, 1, 2), newNode("b", 1, 1, 3))
+		if err != nil {
+			t.Errorf("expect diverging suffix allowed but got %v", err)
+		}
+		err = checkLogMatching(newNode("a", 1, 2, 3), newNode("b", 1, 1, 3))
+		if !errors.Is(err, ErrInvariantViolated) {
+			t.Errorf("expect %v but got %v", ErrInvariantViolated, err)
+		}
+	})
+
+	t.Run("state machine safety", func(t *testing.T) {
+		var c invariantChecker
+		err := c.checkCommitted(newNode("a", 1, 1), Status{Term: 1, CommitIndex: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = c.checkCommitted(newNode("b", 1, 2), Status{Term: 2, CommitIndex: 2})
+		if !errors.Is(err, ErrInvariantViolated) {
+			t.Errorf("expect %v but got %v", ErrInvariantViolated, err)
+		}
+	})
+
+	t.Run("leader completeness", func(t *testing.T) {
+		var c invariantChecker
+		err := c.checkCommitted(newNode("a", 1, 1), Status{Term: 1, CommitIndex: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = c.checkLeaderCompleteness(newNode("b", 1), 2)
+		if !errors.Is(err, ErrInvariantViolated) {
+			t.Errorf("expect %v but got %v", ErrInvariantViolated, err)
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package raft
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// sloBuckets 统计窗口划分的桶数
+	sloBuckets = 10
+	// sloMinSamples 窗口内的样本少于该数量时不计算燃烧率, 避免个别慢请求触发告警
+	sloMinSamples = 20
+)
+
+// CommitLatencySLO commit 延迟的 SLO, 如 99% 的 command 在 50ms 内 commit
+//
+// 燃烧率是窗口内超过 Threshold 的比例与错误预算(1 - Objective)之比,
+// 为 1 时恰好在窗口结束时耗尽错误预算.
+type CommitLatencySLO struct {
+	// Threshold commit 延迟的上限
+	Threshold time.Duration
+	// Objective 延迟不超过 Threshold 的比例, 如 0.99
+	Objective float64
+	// Window 计算燃烧率的滑动窗口, 默认 1h
+	Window time.Duration
+	// WarningBurnRate, CriticalBurnRate 燃烧率达到该值时发出对应级别的 EventSLOBurnRate 事件
+	// 默认为 2 与 10
+	WarningBurnRate  float64
+	CriticalBurnRate float64
+}
+
+func (s CommitLatencySLO) String() string {
+	return fmt.Sprintf("%.2f%% < %s over %s", s.Objective*100, s.Threshold, s.Window)
+}
+
+// sloTracker 跟踪 commit 延迟 SLO 的错误预算
+type sloTracker struct {
+	slo CommitLatencySLO
+
+	mux     sync.Mutex
+	buckets [sloBuckets]sloBucket
+	// level 当前燃烧率对应的事件级别
+	level EventLevel
+}
+
+type sloBucket struct {
+	start time.Time
+	total uint64
+	bad   uint64
+}
+
+func newSLOTracker(slo CommitLatencySLO) *sloTracker {
+	if slo.Threshold <= 0 || slo.Objective <= 0 || slo.Objective >= 1 {
+		return nil
+	}
+	if slo.Window <= 0 {
+		slo.Window = time.Hour
+	}
+	if slo.WarningBurnRate <= 0 {
+		slo.WarningBurnRate = 2
+	}
+	if slo.CriticalBurnRate <= 0 {
+		slo.CriticalBurnRate = 10
+	}
+	return &sloTracker{slo: slo}
+}
+
+// observe 记录 count 个 command 的 commit 延迟, 返回窗口内的燃烧率
+// 燃烧率对应的级别改变时 changed 为 true
+func (t *sloTracker) observe(latency time.Duration, count uint64, now time.Time) (burnRate float64, level EventLevel, changed bool) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	width := t.slo.Window / sloBuckets
+	start := now.Truncate(width)
+	bucket := &t.buckets[int(start.UnixNano()/int64(width))%sloBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = sloBucket{start: start}
+	}
+	bucket.total += count
+	if latency > t.slo.Threshold {
+		bucket.bad += count
+	}
+
+	var total, bad uint64
+	for _, b := range t.buckets {
+		if now.Sub(b.start) < t.slo.Window {
+			total += b.total
+			bad += b.bad
+		}
+	}
+	if total >= sloMinSamples {
+		burnRate = float64(bad) / float64(total) / (1 - t.slo.Objective)
+	}
+
+	switch {
+	case burnRate >= t.slo.CriticalBurnRate:
+		level = EventLevelCritical
+	case burnRate >= t.slo.WarningBurnRate:
+		level = EventLevelWarning
+	default:
+		level = EventLevelInfo
+	}
+	changed = level != t.level
+	t.level = level
+	return burnRate, level, changed
+}
+
+// observeCommitLatency 记录 entries 从提交到 commit 的延迟
+// 燃烧率越过阈值时发出 EventSLOBurnRate 事件, 回落时发出 Info 级别的事件
+func (r *raft) observeCommitLatency(entries []LogEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	now := time.Now()
+	latency := now.Sub(entries[0].AppendTime)
+	r.metrics.AddSample(MetricCommitDuration, milliseconds(latency))
+	if r.slo == nil {
+		return
+	}
+	if latency > r.slo.slo.Threshold {
+		r.metrics.IncrCounter(MetricSLOViolations, float64(len(entries)))
+	}
+	burnRate, level, changed := r.slo.observe(latency, uint64(len(entries)), now)
+	r.metrics.SetGauge(MetricSLOBurnRate, burnRate)
+	if !changed {
+		return
+	}
+	r.emit(Event{
+		Type:    EventSLOBurnRate,
+		Level:   level,
+		Message: fmt.Sprintf("commit latency SLO (%s) burn rate %.2f", r.slo.slo, burnRate),
+	})
+}
@@ -0,0 +1,78 @@
+package raft
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSLOTracker(t *testing.T) {
+	tracker := newSLOTracker(CommitLatencySLO{Threshold: 50 * time.Millisecond, Objective: 0.9, Window: 10 * time.Second, CriticalBurnRate: 5})
+	now := time.Unix(1000, 0)
+	fast, slow := 10*time.Millisecond, 100*time.Millisecond
+
+	t.Run("too few samples", func(t *testing.T) {
+		burnRate, level, changed := tracker.observe(slow, 10, now)
+		if burnRate != 0 || level != EventLevelInfo || changed {
+			t.Fatalf("expect no burn rate but got (%v, %s, %t)", burnRate, level, changed)
+		}
+	})
+	t.Run("warning", func(t *testing.T) {
+		// 10 bad out of 50
+		burnRate, level, changed := tracker.observe(fast, 40, now)
+		if burnRate < 1.99 || burnRate > 2.01 || level != EventLevelWarning || !changed {
+			t.Fatalf("expect warning at burn rate 2 but got (%v, %s, %t)", burnRate, level, changed)
+		}
+	})
+	t.Run("critical", func(t *testing.T) {
+		_, level, changed := tracker.observe(slow, 1000, now.Add(time.Second))
+		if level != EventLevelCritical || !changed {
+			t.Fatalf("expect critical but got (%s, %t)", level, changed)
+		}
+	})
+	t.Run("recovered after window", func(t *testing.T) {
+		_, level, changed := tracker.observe(fast, 100, now.Add(20*time.Second))
+		if level != EventLevelInfo || !changed {
+			t.Fatalf("expect info but got (%s, %t)", level, changed)
+		}
+	})
+	t.Run("disabled", func(t *testing.T) {
+		if tracker := newSLOTracker(CommitLatencySLO{Threshold: time.Second, Objective: 1}); tracker != nil {
+			t.Fatalf("expect no tracker for objective 1")
+		}
+	})
+}
+
+func TestCommitLatencySLO(t *testing.T) {
+	var (
+		mux    sync.Mutex
+		events []Event
+	)
+	observer := func(event Event) {
+		mux.Lock()
+		defer mux.Unlock()
+		if event.Type == EventSLOBurnRate {
+			events = append(events, event)
+		}
+	}
+	slo := CommitLatencySLO{Threshold: time.Nanosecond, Objective: 0.99}
+	leader, err := New("slo-leader", "slo-leader", (&listFSM{}).apply, nil, nil,
+		WithDevMode(), WithCommitLatencySLO(slo), WithObserver(observer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leader.Stop()
+	go leader.Run()
+
+	for i := 0; i < sloMinSamples; i++ {
+		if err := leader.Handle(context.Background(), Command("c")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mux.Lock()
+	defer mux.Unlock()
+	if len(events) != 1 || events[0].Level != EventLevelCritical {
+		t.Fatalf("expect one critical %s event but got %+v", EventSLOBurnRate, events)
+	}
+}
@@ -0,0 +1,519 @@
+package raft
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+var (
+	ErrSnapshotNotConfigured       = errors.New("err: snapshot isn't configured")
+	ErrSnapshotNotFound            = errors.New("err: snapshot not found")
+	ErrNothingToSnapshot           = errors.New("err: no log entry has been applied, nothing to snapshot")
+	ErrInstallSnapshotNotSupported = errors.New("err: peer doesn't support InstallSnapshot")
+	ErrInstallSnapshotRejected     = errors.New("err: snapshot rejected by peer")
+	ErrSnapshotChunkOutOfOrder     = errors.New("err: snapshot chunk out of order")
+)
+
+// Snapshotter 状态机快照
+type Snapshotter interface {
+	// Snapshot 将状态机当前的状态写入 w
+	// 调用期间不会有 command 被应用到状态机
+	Snapshot(w io.Writer) error
+	// Restore 丢弃状态机当前的状态, 从 r 中恢复
+	Restore(r io.Reader) error
+}
+
+// SnapshotMeta 快照元数据
+type SnapshotMeta struct {
+	Id string
+	// Index, Term 快照包含的最后一个 log entry
+	Index uint64
+	Term  uint64
+	// Configuration 快照时生效的集群配置, 编码与 config log entry 相同
+	Configuration      []byte
+	ConfigurationIndex uint64
+	// Size 快照数据的字节数
+	Size int64
+	// KeyId 加密快照使用的 KEK id, 未加密时为空, 见 WithSnapshotEncryption
+	KeyId      string
+	CreateTime time.Time
+}
+
+// SnapshotStore 快照存储
+type SnapshotStore interface {
+	// Create 开始写入 id 快照, Commit 之前快照不可见
+	Create(id string) (SnapshotSink, error)
+	// List 返回所有快照的元数据, 最新的快照在前
+	List() ([]SnapshotMeta, error)
+	// Open 打开 id 快照, 若不存在则返回 ErrSnapshotNotFound
+	Open(id string) (SnapshotMeta, io.ReadCloser, error)
+}
+
+// SnapshotSink 写入中的快照
+type SnapshotSink interface {
+	io.Writer
+	// Commit 完成写入并保存元数据, 之后快照可见
+	Commit(meta SnapshotMeta) error
+	// Cancel 放弃写入
+	Cancel() error
+}
+
+// Snapshot 为状态机创建快照, 快照包含所有已应用的 log entry
+//
+// 写入快照期间暂停应用 command, 使快照与 lastApplied 一致.
+// 若最新的快照已包含所有已应用的 log entry, 直接返回该快照.
+// 快照之后压缩 log, 丢弃快照覆盖且不在保留策略内的 log entry,
+// 压缩被 CompactionHook 否决时快照仍然有效, 区间留待下一次快照时再压缩.
+func (r *raft) Snapshot() (meta SnapshotMeta, err error) {
+	if r.snapshotter == nil {
+		return meta, ErrSnapshotNotConfigured
+	}
+	meta, err = r.takeSnapshot()
+	if err != nil {
+		return meta, err
+	}
+	r.snapshotPolicy.observe(meta.Index)
+	// compact outside applyMux, hooks may block for a long time
+	err = r.compact(meta)
+	if err != nil && !errors.Is(err, ErrCompactionVetoed) {
+		r.log(LogApply).Error("Compact log up to snapshot", "snapshot", meta.Id, "err", err)
+	}
+	return meta, nil
+}
+
+// takeSnapshot 将状态机写入快照, 最新的快照已包含所有已应用的 log entry 时直接返回该快照
+func (r *raft) takeSnapshot() (meta SnapshotMeta, err error) {
+	r.applyMux.Lock()
+	defer r.applyMux.Unlock()
+
+	index := r.GetLastApplied()
+	if index == 0 {
+		return meta, ErrNothingToSnapshot
+	}
+	latest, ok, err := r.latestSnapshot()
+	if err != nil {
+		return meta, err
+	}
+	if ok && latest.Index >= index {
+		return latest, nil
+	}
+
+	start := time.Now()
+	term, err := r.Get(index)
+	if err != nil {
+		return meta, err
+	}
+	config := r.configs.GetConfigAt(index)
+	configuration, err := config.Bytes()
+	if err != nil {
+		return meta, err
+	}
+	meta = SnapshotMeta{
+		Id:                 fmt.Sprintf("%d-%d-%d", term, index, start.UnixMilli()),
+		Index:              index,
+		Term:               term,
+		Configuration:      configuration,
+		ConfigurationIndex: config.GetIndex(),
+		CreateTime:         start,
+	}
+
+	sink, err := r.snapshotStore.Create(meta.Id)
+	if err != nil {
+		return meta, err
+	}
+	w := &countingWriter{w: sink}
+	meta.KeyId, err = r.writeSnapshot(w)
+	if err != nil {
+		sink.Cancel()
+		return meta, err
+	}
+	meta.Size = w.n
+	err = sink.Commit(meta)
+	if err != nil {
+		return meta, err
+	}
+	r.metrics.AddSample(MetricSnapshotDuration, milliseconds(time.Since(start)))
+	r.log(LogApply).Info("Took snapshot", "snapshot", meta.Id, "index", meta.Index)
+	r.emit(Event{Type: EventSnapshotTaken, Level: EventLevelInfo, LastIndex: meta.Index, Message: meta.Id})
+	return meta, nil
+}
+
+// compact 丢弃 meta 快照覆盖的 log entry
+func (r *raft) compact(meta SnapshotMeta) error {
+	firstIndex, err := r.FirstIndex()
+	if err != nil {
+		return err
+	}
+	rng, ok, err := r.compactionRange(firstIndex, meta.Index, meta.Id)
+	if err != nil || !ok {
+		return err
+	}
+	err = r.beforeCompaction(rng)
+	if err != nil {
+		return err
+	}
+	err = r.Compact(rng.LastIndex)
+	if err != nil {
+		return err
+	}
+	r.metrics.IncrCounter(MetricLogCompacted, float64(rng.LastIndex-rng.FirstIndex+1))
+	r.log(LogApply).Info("Compacted log covered by snapshot", "firstIndex", rng.FirstIndex, "lastIndex", rng.LastIndex, "snapshot", meta.Id)
+	return nil
+}
+
+// writeSnapshot 将状态机写入 w, 配置了 KeyProvider 时加密
+func (r *raft) writeSnapshot(w io.Writer) (keyId string, err error) {
+	if r.snapshotKeys == nil {
+		return "", r.snapshotter.Snapshot(w)
+	}
+	wc, keyId, err := EncryptSnapshot(w, r.snapshotKeys)
+	if err != nil {
+		return "", err
+	}
+	err = r.snapshotter.Snapshot(wc)
+	if err != nil {
+		return "", err
+	}
+	return keyId, wc.Close()
+}
+
+// restoreSnapshot 从快照恢复状态机
+func (r *raft) restoreSnapshot(meta SnapshotMeta, rd io.Reader) error {
+	if meta.KeyId != "" {
+		if r.snapshotKeys == nil {
+			return fmt.Errorf("%w: %q", ErrSnapshotKeyNotFound, meta.KeyId)
+		}
+		var err error
+		rd, err = DecryptSnapshot(rd, r.snapshotKeys)
+		if err != nil {
+			return err
+		}
+	}
+	return r.snapshotter.Restore(rd)
+}
+
+// latestSnapshot 最新的快照, 没有快照时 ok 为 false
+func (r *raft) latestSnapshot() (meta SnapshotMeta, ok bool, err error) {
+	metas, err := r.snapshotStore.List()
+	if err != nil || len(metas) == 0 {
+		return meta, false, err
+	}
+	return metas[0], true, nil
+}
+
+// installSnapshot 使用 Leader 发送的快照替换状态机与 log
+//
+// Implementation:
+//
+//  6. If existing log entry has same index and term as snapshot’s
+//     last included entry, retain log entries following it and reply
+//  7. Discard the entire log
+//  8. Reset state machine using snapshot contents (and load
+//     snapshot’s cluster configuration)
+func (r *raft) installSnapshot(meta SnapshotMeta) error {
+	r.applyMux.Lock()
+	defer r.applyMux.Unlock()
+	if meta.Index <= r.GetLastApplied() {
+		// state machine is already ahead of the snapshot
+		return nil
+	}
+
+	_, rc, err := r.snapshotStore.Open(meta.Id)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	// restore before truncating log, a failed restore leaves log intact
+	err = r.restoreSnapshot(meta, rc)
+	if err != nil {
+		return err
+	}
+	err = r.TruncatePrefix(meta.Index, meta.Term)
+	if err != nil {
+		return err
+	}
+
+	// fallback config if config log entry is discarded
+	lastIndex, _, err := r.Last()
+	if err != nil {
+		return err
+	}
+	for r.configs.GetConfig().GetIndex() > lastIndex {
+		err = r.configs.FallbackConfig()
+		if err != nil {
+			return err
+		}
+	}
+	if r.configs.GetConfig().GetIndex() < meta.ConfigurationIndex {
+		config, err := r.configs.NewConfig(meta.ConfigurationIndex, meta.Configuration)
+		if err != nil {
+			return err
+		}
+		err = r.configs.UseConfig(config)
+		if err != nil {
+			return err
+		}
+	}
+
+	r.SetCommitIndex(meta.Index)
+	r.SetLastApplied(meta.Index)
+	r.snapshotPolicy.observe(meta.Index)
+	r.metrics.SetGauge(MetricCommitIndex, float64(r.GetCommitIndex()))
+	r.metrics.SetGauge(MetricLastApplied, float64(meta.Index))
+	r.gaugeApplyBacklog()
+	r.metrics.IncrCounter(MetricSnapshotsInstalled, 1)
+	r.log(LogReplication).Info("Installed snapshot", "snapshot", meta.Id, "index", meta.Index)
+	return nil
+}
+
+var _ rpcArgs = InstallSnapshotArgs{}
+
+// InstallSnapshotArgs
+type InstallSnapshotArgs struct {
+	// highest protocol version supported by leader
+	ProtocolVersion ProtocolVersion
+	// raft group the request is routed to,
+	// empty outside of MultiRaft
+	Group GroupId
+
+	// leader’s term
+	Term uint64
+	// so follower can redirect clients
+	LeaderId   RaftId
+	LeaderAddr RaftAddr
+
+	// snapshot replaces all entries up through
+	// and including Meta.Index
+	Meta SnapshotMeta
+	// byte offset where chunk is positioned in the snapshot file
+	Offset int64
+	// raw bytes of the snapshot chunk, starting at offset
+	Data []byte
+	// true if this is the last chunk
+	Done bool
+}
+
+func (InstallSnapshotArgs) getType() rpcArgsType {
+	return rpcArgsTypeInstallSnapshotArgs
+}
+
+func (a InstallSnapshotArgs) getTerm() uint64 {
+	return a.Term
+}
+
+var _ rpcArgs = InstallSnapshotResults{}
+
+// InstallSnapshotResults
+type InstallSnapshotResults struct {
+	// highest protocol version supported by follower
+	ProtocolVersion ProtocolVersion
+
+	// currentTerm, for leader to update itself
+	Term uint64
+	// true means the chunk is stored,
+	// and the snapshot is installed if it's the last chunk
+	Success bool
+}
+
+func (InstallSnapshotResults) getType() rpcArgsType {
+	return rpcArgsTypeInstallSnapshotResults
+}
+
+func (r InstallSnapshotResults) getTerm() uint64 {
+	return r.Term
+}
+
+// InstallSnapshot 实现 InstallSnapshot RPC
+//
+// Invoked by leader to send chunks of a snapshot to a follower.
+// Leaders always send chunks in order.
+//
+// Implementation:
+//
+//  1. Reply immediately if term < currentTerm
+//  2. Create new snapshot file if first chunk (offset is 0)
+//  3. Write data into snapshot file at given offset
+//  4. Reply and wait for more data chunks if done is false
+//  5. Save snapshot file, discard any existing or partial snapshot
+//     with a smaller index
+//     6 ~ 8. see installSnapshot
+func (s *rpcService) InstallSnapshot(args InstallSnapshotArgs, results *InstallSnapshotResults) error {
+	if s.quarantined(args.LeaderId, &results.Term) {
+		return nil
+	}
+	s.refreshLastHeartbeat()
+	s.sendRPCArgs(args)
+	s.GetServer().ResetTimer()
+	s.observeProtocolVersion(args.LeaderId, args.ProtocolVersion)
+	defer func() {
+		results.Term = s.GetCurrentTerm()
+		results.ProtocolVersion = s.versions.local
+	}()
+
+	// 1. Reply immediately if term < currentTerm
+	if args.Term < s.GetCurrentTerm() {
+		return nil
+	}
+	if s.snapshotter == nil {
+		return ErrSnapshotNotConfigured
+	}
+	if args.LeaderId != s.Id() {
+		s.recordLeadership(args.Term, args.LeaderId, 0, LeadershipReasonObserved)
+		s.hint.observe(args.Term, RaftPeer{Id: args.LeaderId, Addr: args.LeaderAddr})
+	}
+	if c, ok := s.GetServer().(*candidate); ok {
+		c.discoverLeader(args.Term)
+	}
+
+	done, err := s.receiving.write(s.snapshotStore, args)
+	if err != nil {
+		return err
+	}
+	if done {
+		s.acks.mux.Lock()
+		defer s.acks.mux.Unlock()
+		err = s.installSnapshot(args.Meta)
+		if err != nil {
+			return err
+		}
+	}
+	results.Success = true
+	return nil
+}
+
+// snapshotReceiver Follower 接收中的快照
+type snapshotReceiver struct {
+	mux    sync.Mutex
+	id     string
+	sink   SnapshotSink
+	offset int64
+}
+
+// write 写入一个分块, 返回是否已接收并保存完整的快照
+func (rc *snapshotReceiver) write(store SnapshotStore, args InstallSnapshotArgs) (done bool, err error) {
+	rc.mux.Lock()
+	defer rc.mux.Unlock()
+
+	// 2. Create new snapshot file if first chunk (offset is 0)
+	if args.Offset == 0 {
+		rc.reset()
+		rc.sink, err = store.Create(args.Meta.Id)
+		if err != nil {
+			return false, err
+		}
+		rc.id = args.Meta.Id
+	}
+	if rc.sink == nil || rc.id != args.Meta.Id || rc.offset != args.Offset {
+		return false, ErrSnapshotChunkOutOfOrder
+	}
+
+	// 3. Write data into snapshot file at given offset
+	n, err := rc.sink.Write(args.Data)
+	rc.offset += int64(n)
+	if err != nil {
+		rc.reset()
+		return false, err
+	}
+	// 4. Reply and wait for more data chunks if done is false
+	if !args.Done {
+		return false, nil
+	}
+
+	// 5. Save snapshot file
+	meta := args.Meta
+	meta.Size = rc.offset
+	err = rc.sink.Commit(meta)
+	rc.sink, rc.id, rc.offset = nil, "", 0
+	return err == nil, err
+}
+
+// reset 放弃接收中的快照
+func (rc *snapshotReceiver) reset() {
+	if rc.sink != nil {
+		rc.sink.Cancel()
+	}
+	rc.sink, rc.id, rc.offset = nil, "", 0
+}
+
+// installSnapshotChunkSize InstallSnapshot 每个分块的大小
+const installSnapshotChunkSize = 1 << 20
+
+// sendSnapshot 向 peer 发送最新的快照
+// peer 需要的 log entry 已被压缩时, 使用快照代替 AppendEntries
+func (l *leader) sendSnapshot(id RaftId, addr RaftAddr) error {
+	if !l.peerSupports(id, featureInstallSnapshot) {
+		return ErrInstallSnapshotNotSupported
+	}
+	if l.snapshotter == nil {
+		return ErrSnapshotNotConfigured
+	}
+	meta, ok, err := l.latestSnapshot()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrSnapshotNotFound
+	}
+	_, rc, err := l.snapshotStore.Open(meta.Id)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	l.log(LogReplication).Info("-> InstallSnapshot", "snapshot", meta.Id, "peer", id)
+	buf := make([]byte, installSnapshotChunkSize)
+	var offset int64
+	for {
+		n, err := io.ReadFull(rc, buf)
+		done := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !done {
+			return err
+		}
+		args := InstallSnapshotArgs{
+			Term:       l.GetCurrentTerm(),
+			LeaderId:   l.Id(),
+			LeaderAddr: l.Addr(),
+			Meta:       meta,
+			Offset:     offset,
+			Data:       buf[:n],
+			Done:       done,
+		}
+		if err := l.throttle(id, n); err != nil {
+			return err
+		}
+		start := time.Now()
+		results, err := l.rpc.CallInstallSnapshot(l.resolve(RaftPeer{id, addr}), args)
+		if err != nil {
+			l.log(LogTransport).Warn("Call InstallSnapshot", "peer", id, "err", err)
+			return err
+		}
+		l.contact.observe(id, start)
+		if !results.Success {
+			return ErrInstallSnapshotRejected
+		}
+		offset += int64(n)
+		if done {
+			break
+		}
+	}
+
+	l.matchIndex.StoreMax(id, meta.Index)
+	l.nextIndex.Store(id, meta.Index+1)
+	l.metrics.IncrCounter(MetricSnapshotsSent, 1, Label{Name: LabelPeer, Value: string(id)})
+	return nil
+}
+
+// countingWriter 记录写入的字节数
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
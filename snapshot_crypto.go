@@ -0,0 +1,345 @@
+package raft
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var (
+	ErrSnapshotKeyNotFound  = errors.New("err: snapshot encryption key not found")
+	ErrSnapshotNotEncrypted = errors.New("err: snapshot is not encrypted")
+	ErrSnapshotTruncated    = errors.New("err: encrypted snapshot is truncated")
+)
+
+// KeyProvider 提供快照信封加密(envelope encryption)使用的密钥加密密钥(KEK)
+//
+// 每个快照使用随机生成的数据密钥(DEK)加密, DEK 由 KEK 加密后与 KEK 的 id
+// 一同存放在快照头部. 轮换 KEK 后旧快照仍可通过 id 找到对应的 KEK 解密.
+type KeyProvider interface {
+	// CurrentKey 返回加密新快照使用的 KEK 及其 id
+	CurrentKey() (id string, key []byte, err error)
+	// Key 根据 id 返回 KEK, 若不存在则返回 ErrSnapshotKeyNotFound
+	Key(id string) ([]byte, error)
+}
+
+// NewKeyring 创建以 id 为当前密钥的 Keyring
+// key 长度须为 16, 24 或 32 字节(AES-128, AES-192, AES-256)
+func NewKeyring(id string, key []byte) *Keyring {
+	k := &Keyring{}
+	k.Rotate(id, key)
+	return k
+}
+
+var _ KeyProvider = (*Keyring)(nil)
+
+// Keyring 内存中的 KeyProvider 实现, 保留所有轮换过的密钥
+type Keyring struct {
+	mux     sync.RWMutex
+	current string
+	keys    map[string][]byte
+}
+
+// Rotate 使用新的密钥加密之后的快照, 旧密钥仍用于解密旧快照
+func (k *Keyring) Rotate(id string, key []byte) {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	if k.keys == nil {
+		k.keys = make(map[string][]byte)
+	}
+	k.keys[id] = key
+	k.current = id
+}
+
+func (k *Keyring) CurrentKey() (id string, key []byte, err error) {
+	k.mux.RLock()
+	defer k.mux.RUnlock()
+	key, ok := k.keys[k.current]
+	if !ok {
+		return "", nil, ErrSnapshotKeyNotFound
+	}
+	return k.current, key, nil
+}
+
+func (k *Keyring) Key(id string) ([]byte, error) {
+	k.mux.RLock()
+	defer k.mux.RUnlock()
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrSnapshotKeyNotFound, id)
+	}
+	return key, nil
+}
+
+// snapshotCryptoMagic 加密快照的头部标识
+var snapshotCryptoMagic = []byte("RSE1")
+
+// snapshotChunkSize 加密快照的分块大小
+const snapshotChunkSize = 64 << 10
+
+// EncryptSnapshot 返回加密写入 w 的 io.WriteCloser, 以及所使用 KEK 的 id
+// 调用方需将 keyId 记录在快照元数据中, 并在写入完成后调用 Close
+//
+// format: magic | len(keyId) | keyId | len(wrappedKey) | wrappedKey | nonce | chunk...
+// chunk: len(sealed) | sealed, 最后一个 chunk 以 final 标记作为附加数据, 防止截断
+func EncryptSnapshot(w io.Writer, provider KeyProvider) (wc io.WriteCloser, keyId string, err error) {
+	keyId, kek, err := provider.CurrentKey()
+	if err != nil {
+		return nil, "", err
+	}
+	dek := make([]byte, 32)
+	if _, err = rand.Read(dek); err != nil {
+		return nil, "", err
+	}
+	wrappedKey, err := wrapKey(kek, dek, []byte(keyId))
+	if err != nil {
+		return nil, "", err
+	}
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, "", err
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.Write(snapshotCryptoMagic)
+	writeBytes(bw, []byte(keyId))
+	writeBytes(bw, wrappedKey)
+	bw.Write(nonce)
+	if err = bw.Flush(); err != nil {
+		return nil, "", err
+	}
+
+	return &snapshotEncrypter{
+		w:     w,
+		aead:  aead,
+		nonce: nonce,
+		buf:   make([]byte, 0, snapshotChunkSize),
+	}, keyId, nil
+}
+
+// DecryptSnapshot 返回解密 r 的 io.Reader
+// 若快照使用的 KEK 已不存在, 返回 ErrSnapshotKeyNotFound
+func DecryptSnapshot(r io.Reader, provider KeyProvider) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(snapshotCryptoMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || !bytes.Equal(magic, snapshotCryptoMagic) {
+		return nil, ErrSnapshotNotEncrypted
+	}
+	keyId, err := readBytes(br)
+	if err != nil {
+		return nil, err
+	}
+	wrappedKey, err := readBytes(br)
+	if err != nil {
+		return nil, err
+	}
+	kek, err := provider.Key(string(keyId))
+	if err != nil {
+		return nil, err
+	}
+	dek, err := unwrapKey(kek, wrappedKey, keyId)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(br, nonce); err != nil {
+		return nil, ErrSnapshotTruncated
+	}
+
+	return &snapshotDecrypter{
+		r:     br,
+		aead:  aead,
+		nonce: nonce,
+	}, nil
+}
+
+// snapshotEncrypter 分块加密快照
+type snapshotEncrypter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	nonce   []byte
+	counter uint64
+	buf     []byte
+	closed  bool
+}
+
+func (e *snapshotEncrypter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		if len(e.buf) == snapshotChunkSize {
+			if err = e.flush(false); err != nil {
+				return n, err
+			}
+		}
+		m := copy(e.buf[len(e.buf):snapshotChunkSize], p)
+		e.buf = e.buf[:len(e.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+func (e *snapshotEncrypter) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	return e.flush(true)
+}
+
+func (e *snapshotEncrypter) flush(final bool) error {
+	sealed := e.aead.Seal(nil, chunkNonce(e.nonce, e.counter), e.buf, chunkAdditionalData(final))
+	e.counter++
+	e.buf = e.buf[:0]
+
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(sealed)))
+	if _, err := e.w.Write(length[:]); err != nil {
+		return err
+	}
+	_, err := e.w.Write(sealed)
+	return err
+}
+
+// snapshotDecrypter 分块解密快照
+type snapshotDecrypter struct {
+	r       io.Reader
+	aead    cipher.AEAD
+	nonce   []byte
+	counter uint64
+	buf     []byte
+	final   bool
+}
+
+func (d *snapshotDecrypter) Read(p []byte) (n int, err error) {
+	for len(d.buf) == 0 {
+		if d.final {
+			return 0, io.EOF
+		}
+		if err = d.next(); err != nil {
+			return 0, err
+		}
+	}
+	n = copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+func (d *snapshotDecrypter) next() error {
+	var length [4]byte
+	if _, err := io.ReadFull(d.r, length[:]); err != nil {
+		return ErrSnapshotTruncated
+	}
+	n := binary.BigEndian.Uint32(length[:])
+	if n > snapshotChunkSize+uint32(d.aead.Overhead()) {
+		return ErrSnapshotTruncated
+	}
+	sealed := make([]byte, n)
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		return ErrSnapshotTruncated
+	}
+
+	nonce := chunkNonce(d.nonce, d.counter)
+	d.counter++
+	plain, err := d.aead.Open(nil, nonce, sealed, chunkAdditionalData(false))
+	if err == nil {
+		d.buf = plain
+		return nil
+	}
+	plain, err = d.aead.Open(nil, nonce, sealed, chunkAdditionalData(true))
+	if err != nil {
+		return err
+	}
+	d.buf, d.final = plain, true
+	return nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// wrapKey 使用 key 加密 plain, 返回 nonce | ciphertext
+func wrapKey(key, plain, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, additionalData), nil
+}
+
+// unwrapKey 解密 wrapKey 的结果
+func unwrapKey(key, sealed, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrSnapshotTruncated
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+// chunkNonce 每个 chunk 的 nonce: 基础 nonce 的后 8 字节与 chunk 序号异或
+func chunkNonce(base []byte, counter uint64) []byte {
+	nonce := make([]byte, len(base))
+	copy(nonce, base)
+	var c [8]byte
+	binary.BigEndian.PutUint64(c[:], counter)
+	for i := range c {
+		nonce[len(nonce)-8+i] ^= c[i]
+	}
+	return nonce
+}
+
+func chunkAdditionalData(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+func writeBytes(w io.Writer, b []byte) {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(b)))
+	w.Write(length[:])
+	w.Write(b)
+}
+
+func readBytes(r io.Reader) ([]byte, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, ErrSnapshotTruncated
+	}
+	n := binary.BigEndian.Uint32(length[:])
+	if n > snapshotChunkSize {
+		return nil, ErrSnapshotTruncated
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, ErrSnapshotTruncated
+	}
+	return b, nil
+}
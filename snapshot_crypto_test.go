@@ -0,0 +1,72 @@
+package raft
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestSnapshotEncryption(t *testing.T) {
+	keyring := NewKeyring("k1", bytes.Repeat([]byte{1}, 32))
+	encrypt := func(t *testing.T, plain []byte) ([]byte, string) {
+		t.Helper()
+		var buf bytes.Buffer
+		w, keyId, err := EncryptSnapshot(&buf, keyring)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write(plain); err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes(), keyId
+	}
+	decrypt := func(encrypted []byte) ([]byte, error) {
+		r, err := DecryptSnapshot(bytes.NewReader(encrypted), keyring)
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	}
+
+	plain := bytes.Repeat([]byte("state machine "), snapshotChunkSize/7)
+	old, keyId := encrypt(t, plain)
+	if keyId != "k1" {
+		t.Errorf("expect key id %q but got %q", "k1", keyId)
+	}
+
+	t.Run("round trip after rotation", func(t *testing.T) {
+		keyring.Rotate("k2", bytes.Repeat([]byte{2}, 32))
+		for _, encrypted := range [][]byte{old, func() []byte { b, _ := encrypt(t, plain); return b }()} {
+			got, err := decrypt(encrypted)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Errorf("expect %d bytes but got %d bytes", len(plain), len(got))
+			}
+		}
+	})
+	t.Run("missing key", func(t *testing.T) {
+		_, err := DecryptSnapshot(bytes.NewReader(old), NewKeyring("k3", bytes.Repeat([]byte{3}, 32)))
+		if !errors.Is(err, ErrSnapshotKeyNotFound) {
+			t.Errorf("expect %v but got %v", ErrSnapshotKeyNotFound, err)
+		}
+	})
+	t.Run("truncated", func(t *testing.T) {
+		_, err := decrypt(old[:len(old)-100])
+		if !errors.Is(err, ErrSnapshotTruncated) {
+			t.Errorf("expect %v but got %v", ErrSnapshotTruncated, err)
+		}
+	})
+	t.Run("tampered", func(t *testing.T) {
+		tampered := append([]byte(nil), old...)
+		tampered[len(tampered)-1] ^= 0xff
+		if _, err := decrypt(tampered); err == nil {
+			t.Errorf("expect error of tampered snapshot")
+		}
+	})
+}
@@ -0,0 +1,41 @@
+package raft
+
+import "errors"
+
+var ErrSnapshotFSMNotConfigured = errors.New("err: snapshot fsm factory isn't configured")
+
+// ListSnapshots 返回保留的所有快照的元数据, 最新的快照在前
+func (r *raft) ListSnapshots() ([]SnapshotMeta, error) {
+	if r.snapshotStore == nil {
+		return nil, ErrSnapshotNotConfigured
+	}
+	return r.snapshotStore.List()
+}
+
+// OpenSnapshotFSM 将 id 快照恢复到一个新的状态机实例中, 用于只读查看历史状态
+//
+// 状态机实例由 WithSnapshotFSMFactory 提供的 factory 创建, 与运行中的状态机无关,
+// 查看完毕后直接丢弃即可.
+//
+//	metas, _ := r.ListSnapshots()
+//	fsm, meta, err := r.OpenSnapshotFSM(metas[len(metas)-1].Id)
+func (r *raft) OpenSnapshotFSM(id string) (Snapshotter, SnapshotMeta, error) {
+	if r.snapshotStore == nil {
+		return nil, SnapshotMeta{}, ErrSnapshotNotConfigured
+	}
+	if r.newSnapshotFSM == nil {
+		return nil, SnapshotMeta{}, ErrSnapshotFSMNotConfigured
+	}
+	meta, rc, err := r.snapshotStore.Open(id)
+	if err != nil {
+		return nil, SnapshotMeta{}, err
+	}
+	defer rc.Close()
+
+	fsm := r.newSnapshotFSM()
+	restorer := &raft{snapshotter: fsm, snapshotKeys: r.snapshotKeys}
+	if err := restorer.restoreSnapshot(meta, rc); err != nil {
+		return nil, SnapshotMeta{}, err
+	}
+	return fsm, meta, nil
+}
@@ -0,0 +1,86 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestOpenSnapshotFSM(t *testing.T) {
+	t.Run("not configured", func(t *testing.T) {
+		r, err := New("snapshot-fsm-none", "snapshot-fsm-none", nil, nil, nil, WithDevMode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = r.OpenSnapshotFSM("any")
+		if !errors.Is(err, ErrSnapshotNotConfigured) {
+			t.Errorf("expect %v but got %v", ErrSnapshotNotConfigured, err)
+		}
+
+		r, err = New("snapshot-fsm-no-factory", "snapshot-fsm-no-factory", nil, nil, nil,
+			WithDevMode(), WithSnapshot(&listFSM{}, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = r.OpenSnapshotFSM("any")
+		if !errors.Is(err, ErrSnapshotFSMNotConfigured) {
+			t.Errorf("expect %v but got %v", ErrSnapshotFSMNotConfigured, err)
+		}
+	})
+
+	t.Run("historical snapshot", func(t *testing.T) {
+		fsm := &listFSM{}
+		r, err := New("snapshot-fsm", "snapshot-fsm", fsm.apply, nil, nil,
+			WithDevMode(),
+			WithSnapshot(fsm, NewMemorySnapshotStore(3)),
+			WithSnapshotFSMFactory(func() Snapshotter { return &listFSM{} }))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Stop()
+		go r.Run()
+
+		ctx := context.Background()
+		if err := r.Handle(ctx, Command("a")); err != nil {
+			t.Fatal(err)
+		}
+		old, err := r.Snapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Handle(ctx, Command("b")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Snapshot(); err != nil {
+			t.Fatal(err)
+		}
+
+		metas, err := r.ListSnapshots()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(metas) != 2 || metas[1].Id != old.Id {
+			t.Fatalf("expect 2 snapshots, oldest %s, but got %+v", old.Id, metas)
+		}
+
+		snapshot, meta, err := r.OpenSnapshotFSM(old.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if meta.Index != old.Index {
+			t.Errorf("expect snapshot index %d but got %d", old.Index, meta.Index)
+		}
+		if got := snapshot.(*listFSM).get(); !reflect.DeepEqual(got, []string{"a"}) {
+			t.Errorf("expect historical state [a] but got %v", got)
+		}
+		if got := fsm.get(); !reflect.DeepEqual(got, []string{"a", "b"}) {
+			t.Errorf("expect live state [a b] untouched but got %v", got)
+		}
+
+		_, _, err = r.OpenSnapshotFSM("missing")
+		if !errors.Is(err, ErrSnapshotNotFound) {
+			t.Errorf("expect %v but got %v", ErrSnapshotNotFound, err)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package raft
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// snapshotPolicy 自动创建快照的策略, 见 WithSnapshotPolicy
+type snapshotPolicy struct {
+	// threshold 距上一次快照应用了 threshold 个 log entry 后创建快照, 0 表示不按数量创建
+	threshold uint64
+	// interval 每隔 interval 创建快照, 0 表示不定时创建
+	interval time.Duration
+
+	// trigger 通知 loopSnapshot 创建快照
+	// 容量为 1, 快照期间的多次通知合并为一次, 通知者不会被阻塞
+	trigger chan struct{}
+	// lastIndex 最近一次快照包含的最后一个 log entry 索引
+	lastIndex uint64
+}
+
+func newSnapshotPolicy(threshold uint64, interval time.Duration) snapshotPolicy {
+	return snapshotPolicy{threshold: threshold, interval: interval, trigger: make(chan struct{}, 1)}
+}
+
+func (p *snapshotPolicy) enabled() bool {
+	return p.threshold > 0 || p.interval > 0
+}
+
+// observe 记录包含到 index 的快照
+func (p *snapshotPolicy) observe(index uint64) {
+	for {
+		last := atomic.LoadUint64(&p.lastIndex)
+		if index <= last || atomic.CompareAndSwapUint64(&p.lastIndex, last, index) {
+			return
+		}
+	}
+}
+
+// applied 应用到 lastApplied 后调用, 超过阈值时通知 loopSnapshot
+func (p *snapshotPolicy) applied(lastApplied uint64) {
+	if p.threshold == 0 || lastApplied-atomic.LoadUint64(&p.lastIndex) < p.threshold {
+		return
+	}
+	select {
+	case p.trigger <- struct{}{}:
+	default:
+		// a snapshot is pending
+	}
+}
+
+// loopSnapshot 按 snapshotPolicy 在后台创建快照并压缩 log
+//
+// 快照在独立的 goroutine 中创建, 应用 command 时只发出通知, 不等待快照完成;
+// 写入快照期间应用暂停, 以保证快照与 lastApplied 一致, 见 Snapshot.
+func (r *raft) loopSnapshot() {
+	if meta, ok, err := r.latestSnapshot(); err == nil && ok {
+		r.snapshotPolicy.observe(meta.Index)
+	}
+	var tick <-chan time.Time
+	if r.snapshotPolicy.interval > 0 {
+		ticker := time.NewTicker(r.snapshotPolicy.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-r.snapshotPolicy.trigger:
+		case <-tick:
+		}
+		if r.GetLastApplied() <= atomic.LoadUint64(&r.snapshotPolicy.lastIndex) {
+			continue
+		}
+		meta, err := r.Snapshot()
+		if errors.Is(err, ErrNothingToSnapshot) {
+			continue
+		}
+		if err != nil {
+			r.log(LogApply).Warn("Take automatic snapshot", "err", err)
+			continue
+		}
+		r.metrics.IncrCounter(MetricSnapshotsAutomatic, 1)
+		r.log(LogApply).Debug("Took automatic snapshot", "snapshot", meta.Id, "index", meta.Index)
+	}
+}
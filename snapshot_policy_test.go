@@ -0,0 +1,105 @@
+package raft
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestSnapshotPolicy(t *testing.T) {
+	// waitSnapshot 等待 r 自动创建包含 index 的快照并压缩 log
+	waitSnapshot := func(t *testing.T, r *raft, index uint64) {
+		deadline := time.Now().Add(time.Second)
+		for {
+			meta, ok, err := r.latestSnapshot()
+			if err != nil {
+				t.Fatal(err)
+			}
+			first, _ := r.FirstIndex()
+			if ok && meta.Index >= index && first > 1 {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expect snapshot including %d and log compacted but got snapshot %+v, first index %d", index, meta, first)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	newRaft := func(t *testing.T, id string, fsm *listFSM, opts ...OptFn) *raft {
+		opts = append([]OptFn{WithDevMode(), WithSnapshot(fsm, nil)}, opts...)
+		r, err := New(RaftId(id), RaftAddr(id), fsm.apply, nil, nil, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go r.Run()
+		return r.(*raft)
+	}
+
+	t.Run("threshold", func(t *testing.T) {
+		r := newRaft(t, "snapshot-policy-threshold", &listFSM{}, WithSnapshotPolicy(4, 0))
+		defer r.Stop()
+		ctx := context.Background()
+		for r.GetLastApplied() < 4 {
+			time.Sleep(5 * time.Millisecond)
+			if _, ok, _ := r.latestSnapshot(); ok {
+				t.Fatalf("expect no snapshot below threshold but got one at last applied %d", r.GetLastApplied())
+			}
+			if err := r.Handle(ctx, Command("a")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		waitSnapshot(t, r, 4)
+	})
+
+	t.Run("interval", func(t *testing.T) {
+		r := newRaft(t, "snapshot-policy-interval", &listFSM{}, WithSnapshotPolicy(0, 10*time.Millisecond))
+		defer r.Stop()
+		if err := r.Handle(context.Background(), Command("a")); err != nil {
+			t.Fatal(err)
+		}
+		waitSnapshot(t, r, r.GetLastApplied())
+	})
+
+	t.Run("apply doesn't wait for snapshot", func(t *testing.T) {
+		fsm := &blockingSnapshotFSM{started: make(chan struct{}, 1), release: make(chan struct{})}
+		r := newRaft(t, "snapshot-policy-blocking", &fsm.listFSM,
+			WithSnapshot(fsm, nil), WithSnapshotPolicy(1, 0))
+		defer r.Stop()
+		done := make(chan error, 1)
+		go func() {
+			done <- r.Handle(context.Background(), Command("a"))
+		}()
+		select {
+		case <-fsm.started:
+		case <-time.After(time.Second):
+			t.Fatal("expect snapshot started")
+		}
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expect Handle returned while writing snapshot")
+		}
+		close(fsm.release)
+		waitSnapshot(t, r, 1)
+	})
+}
+
+// blockingSnapshotFSM 写入快照时通知 started, 并等待 release 关闭
+type blockingSnapshotFSM struct {
+	listFSM
+	started chan struct{}
+	release chan struct{}
+}
+
+func (f *blockingSnapshotFSM) Snapshot(w io.Writer) error {
+	select {
+	case f.started <- struct{}{}:
+	default:
+	}
+	<-f.release
+	return f.listFSM.Snapshot(w)
+}
@@ -0,0 +1,366 @@
+package raft
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// defaultSnapshotRetain 默认保留的快照数量
+const defaultSnapshotRetain = 2
+
+// sortSnapshots 最新的快照在前
+func sortSnapshots(metas []SnapshotMeta) {
+	sort.Slice(metas, func(i, j int) bool {
+		if metas[i].Index != metas[j].Index {
+			return metas[i].Index > metas[j].Index
+		}
+		if metas[i].Term != metas[j].Term {
+			return metas[i].Term > metas[j].Term
+		}
+		return metas[i].CreateTime.After(metas[j].CreateTime)
+	})
+}
+
+// NewMemorySnapshotStore 创建保存在内存中的 SnapshotStore, 只保留最新的 retain 个快照
+func NewMemorySnapshotStore(retain int) *MemorySnapshotStore {
+	if retain < 1 {
+		retain = 1
+	}
+	return &MemorySnapshotStore{
+		retain:    retain,
+		snapshots: make(map[string]*memorySnapshot),
+	}
+}
+
+var _ SnapshotStore = (*MemorySnapshotStore)(nil)
+
+// MemorySnapshotStore 内存中的 SnapshotStore, 用于开发模式与测试
+type MemorySnapshotStore struct {
+	mux       sync.RWMutex
+	retain    int
+	snapshots map[string]*memorySnapshot
+}
+
+type memorySnapshot struct {
+	meta SnapshotMeta
+	data []byte
+}
+
+// Create 开始写入 id 快照, Commit 之前快照不可见
+func (s *MemorySnapshotStore) Create(id string) (SnapshotSink, error) {
+	return &memorySnapshotSink{store: s, id: id}, nil
+}
+
+// List 返回所有快照的元数据, 最新的快照在前
+func (s *MemorySnapshotStore) List() ([]SnapshotMeta, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.list(), nil
+}
+
+func (s *MemorySnapshotStore) list() []SnapshotMeta {
+	metas := make([]SnapshotMeta, 0, len(s.snapshots))
+	for _, snapshot := range s.snapshots {
+		metas = append(metas, snapshot.meta)
+	}
+	sortSnapshots(metas)
+	return metas
+}
+
+// Open 打开 id 快照, 若不存在则返回 ErrSnapshotNotFound
+func (s *MemorySnapshotStore) Open(id string) (SnapshotMeta, io.ReadCloser, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	snapshot, ok := s.snapshots[id]
+	if !ok {
+		return SnapshotMeta{}, nil, fmt.Errorf("%w: %q", ErrSnapshotNotFound, id)
+	}
+	return snapshot.meta, io.NopCloser(bytes.NewReader(snapshot.data)), nil
+}
+
+func (s *MemorySnapshotStore) commit(meta SnapshotMeta, data []byte) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.snapshots[meta.Id] = &memorySnapshot{meta: meta, data: data}
+	metas := s.list()
+	if len(metas) <= s.retain {
+		return
+	}
+	for _, meta := range metas[s.retain:] {
+		delete(s.snapshots, meta.Id)
+	}
+}
+
+// memorySnapshotSink 写入 MemorySnapshotStore 的快照
+type memorySnapshotSink struct {
+	store *MemorySnapshotStore
+	id    string
+	buf   bytes.Buffer
+	done  bool
+}
+
+func (s *memorySnapshotSink) Write(p []byte) (int, error) {
+	return s.buf.Write(p)
+}
+
+func (s *memorySnapshotSink) Commit(meta SnapshotMeta) error {
+	if s.done {
+		return nil
+	}
+	s.done = true
+	meta.Id = s.id
+	s.store.commit(meta, s.buf.Bytes())
+	return nil
+}
+
+func (s *memorySnapshotSink) Cancel() error {
+	s.done = true
+	return nil
+}
+
+const (
+	// snapshotMetaFile 快照目录中的元数据文件
+	snapshotMetaFile = "meta.json"
+	// snapshotDataFile 快照目录中的数据文件
+	snapshotDataFile = "state.bin"
+	// snapshotTmpSuffix 写入中的快照目录的后缀
+	snapshotTmpSuffix = ".tmp"
+)
+
+// NewFileSnapshotStore 创建将快照保存在 dir 目录下的 SnapshotStore, 只保留最新的 retain 个快照
+//
+// 每个快照保存在以快照 id 命名的子目录中, 写入时先写入临时目录,
+// Commit 时 fsync 后重命名, 崩溃时不会留下不完整的快照.
+func NewFileSnapshotStore(dir string, retain int) (*FileSnapshotStore, error) {
+	if retain < 1 {
+		retain = 1
+	}
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	// remove snapshots left incomplete by crash
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasSuffix(entry.Name(), snapshotTmpSuffix) {
+			os.RemoveAll(filepath.Join(dir, entry.Name()))
+		}
+	}
+	return &FileSnapshotStore{dir: dir, retain: retain}, nil
+}
+
+var _ SnapshotStore = (*FileSnapshotStore)(nil)
+
+// FileSnapshotStore 将快照保存在本地文件系统的 SnapshotStore
+type FileSnapshotStore struct {
+	mux    sync.Mutex
+	dir    string
+	retain int
+}
+
+// Create 开始写入 id 快照, Commit 之前快照不可见
+func (s *FileSnapshotStore) Create(id string) (SnapshotSink, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		return nil, fmt.Errorf("err: invalid snapshot id %q", id)
+	}
+	tmp := filepath.Join(s.dir, id+snapshotTmpSuffix)
+	err := os.MkdirAll(tmp, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Create(filepath.Join(tmp, snapshotDataFile))
+	if err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+	return &fileSnapshotSink{store: s, id: id, tmp: tmp, f: f}, nil
+}
+
+// List 返回所有快照的元数据, 最新的快照在前
+func (s *FileSnapshotStore) List() ([]SnapshotMeta, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.list()
+}
+
+func (s *FileSnapshotStore) list() ([]SnapshotMeta, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var metas []SnapshotMeta
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasSuffix(entry.Name(), snapshotTmpSuffix) {
+			continue
+		}
+		meta, err := s.readMeta(entry.Name())
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		metas = append(metas, meta)
+	}
+	sortSnapshots(metas)
+	return metas, nil
+}
+
+func (s *FileSnapshotStore) readMeta(id string) (meta SnapshotMeta, err error) {
+	b, err := os.ReadFile(filepath.Join(s.dir, id, snapshotMetaFile))
+	if err != nil {
+		return meta, err
+	}
+	err = json.Unmarshal(b, &meta)
+	return meta, err
+}
+
+// Open 打开 id 快照, 若不存在则返回 ErrSnapshotNotFound
+func (s *FileSnapshotStore) Open(id string) (SnapshotMeta, io.ReadCloser, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	meta, err := s.readMeta(id)
+	if errors.Is(err, os.ErrNotExist) {
+		return meta, nil, fmt.Errorf("%w: %q", ErrSnapshotNotFound, id)
+	}
+	if err != nil {
+		return meta, nil, err
+	}
+	f, err := os.Open(filepath.Join(s.dir, id, snapshotDataFile))
+	if err != nil {
+		return meta, nil, err
+	}
+	return meta, f, nil
+}
+
+// commit 将写入完成的临时目录重命名为快照目录, 并删除多余的旧快照
+func (s *FileSnapshotStore) commit(id, tmp string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	path := filepath.Join(s.dir, id)
+	err := os.RemoveAll(path)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, path)
+	if err != nil {
+		return err
+	}
+	err = syncDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	metas, err := s.list()
+	if err != nil {
+		return err
+	}
+	if len(metas) <= s.retain {
+		return nil
+	}
+	for _, meta := range metas[s.retain:] {
+		err = os.RemoveAll(filepath.Join(s.dir, meta.Id))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileSnapshotSink 写入 FileSnapshotStore 的快照
+type fileSnapshotSink struct {
+	store *FileSnapshotStore
+	id    string
+	tmp   string
+	f     *os.File
+	done  bool
+}
+
+func (s *fileSnapshotSink) Write(p []byte) (int, error) {
+	return s.f.Write(p)
+}
+
+func (s *fileSnapshotSink) Commit(meta SnapshotMeta) error {
+	if s.done {
+		return nil
+	}
+	s.done = true
+
+	err := s.f.Sync()
+	if err != nil {
+		s.abort()
+		return err
+	}
+	err = s.f.Close()
+	if err != nil {
+		s.abort()
+		return err
+	}
+
+	meta.Id = s.id
+	err = writeFileSync(filepath.Join(s.tmp, snapshotMetaFile), meta)
+	if err != nil {
+		s.abort()
+		return err
+	}
+	err = s.store.commit(s.id, s.tmp)
+	if err != nil {
+		s.abort()
+	}
+	return err
+}
+
+func (s *fileSnapshotSink) Cancel() error {
+	if s.done {
+		return nil
+	}
+	s.done = true
+	s.f.Close()
+	return os.RemoveAll(s.tmp)
+}
+
+func (s *fileSnapshotSink) abort() {
+	s.f.Close()
+	os.RemoveAll(s.tmp)
+}
+
+// writeFileSync 将 v 编码为 json 写入 path 并 fsync
+func writeFileSync(path string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// syncDir fsync 目录, 使重命名持久化
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
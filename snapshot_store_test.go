@@ -0,0 +1,67 @@
+package raft
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestSnapshotStore(t *testing.T) {
+	fileStore, err := NewFileSnapshotStore(t.TempDir(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]SnapshotStore{
+		"memory": NewMemorySnapshotStore(2),
+		"file":   fileStore,
+	}
+	for name, store := range stores {
+		store := store
+		t.Run(name, func(t *testing.T) {
+			write := func(id string, index uint64, data string) {
+				sink, err := store.Create(id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				sink.Write([]byte(data))
+				err = sink.Commit(SnapshotMeta{Index: index, Term: 1, Size: int64(len(data))})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			write("1-1", 1, "one")
+			write("1-3", 3, "three")
+
+			cancelled, err := store.Create("1-9")
+			if err != nil {
+				t.Fatal(err)
+			}
+			cancelled.Write([]byte("nine"))
+			cancelled.Cancel()
+
+			write("1-2", 2, "two")
+			metas, err := store.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(metas) != 2 || metas[0].Id != "1-3" || metas[1].Id != "1-2" {
+				t.Fatalf("expect snapshots [1-3 1-2] but got %+v", metas)
+			}
+
+			meta, rc, err := store.Open("1-3")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+			b, _ := io.ReadAll(rc)
+			if meta.Index != 3 || string(b) != "three" {
+				t.Errorf("expect snapshot at 3 with data %q but got %d %q", "three", meta.Index, b)
+			}
+
+			_, _, err = store.Open("1-1")
+			if !errors.Is(err, ErrSnapshotNotFound) {
+				t.Errorf("expect %v but got %v", ErrSnapshotNotFound, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package raft
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// listFSM 将 command 依序追加到列表的状态机
+type listFSM struct {
+	mux   sync.Mutex
+	items []string
+}
+
+func (f *listFSM) apply(commands Commands) (int, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	for _, command := range commands.Data() {
+		f.items = append(f.items, string(command))
+	}
+	return len(commands.Data()), nil
+}
+
+func (f *listFSM) Snapshot(w io.Writer) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return json.NewEncoder(w).Encode(f.items)
+}
+
+func (f *listFSM) Restore(r io.Reader) error {
+	var items []string
+	err := json.NewDecoder(r).Decode(&items)
+	if err != nil {
+		return err
+	}
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.items = items
+	return nil
+}
+
+func (f *listFSM) get() []string {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return append([]string(nil), f.items...)
+}
+
+func TestSnapshot(t *testing.T) {
+	t.Run("not configured", func(t *testing.T) {
+		r, err := New("snapshot-none", "snapshot-none", nil, nil, nil, WithDevMode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = r.Snapshot()
+		if !errors.Is(err, ErrSnapshotNotConfigured) {
+			t.Errorf("expect %v but got %v", ErrSnapshotNotConfigured, err)
+		}
+	})
+
+	t.Run("nothing applied", func(t *testing.T) {
+		r, err := New("snapshot-empty", "snapshot-empty", nil, &memoryStore{}, &memoryLog{},
+			WithSnapshot(&listFSM{}, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = r.Snapshot()
+		if !errors.Is(err, ErrNothingToSnapshot) {
+			t.Errorf("expect %v but got %v", ErrNothingToSnapshot, err)
+		}
+	})
+}
+
+func TestSnapshotCompaction(t *testing.T) {
+	newRaft := func(t *testing.T, id string, opts ...OptFn) Raft {
+		fsm := &listFSM{}
+		opts = append([]OptFn{WithDevMode(), WithSnapshot(fsm, nil)}, opts...)
+		r, err := New(RaftId(id), RaftAddr(id), fsm.apply, nil, nil, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go r.Run()
+		err = r.Handle(context.Background(), Command("a"), Command("b"), Command("c"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	cases := []struct {
+		name  string
+		opts  []OptFn
+		first uint64
+	}{
+		{name: "compact", first: 5},
+		{name: "retention", opts: []OptFn{WithLogRetention(2, 0)}, first: 3},
+		{
+			name: "vetoed",
+			opts: []OptFn{WithCompactionHook(func(ctx context.Context, rng CompactionRange) error {
+				return errors.New("archive unavailable")
+			}, time.Second)},
+			first: 1,
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			r := newRaft(t, "snapshot-compaction-"+c.name, c.opts...)
+			defer r.Stop()
+			_, err := r.Snapshot()
+			if err != nil {
+				t.Fatal(err)
+			}
+			first, _ := r.(*raft).FirstIndex()
+			if first != c.first {
+				t.Errorf("expect first index %d but got %d", c.first, first)
+			}
+		})
+	}
+}
+
+func TestInstallSnapshot(t *testing.T) {
+	keys := NewKeyring("k1", bytes.Repeat([]byte{1}, 32))
+
+	leaderFSM := &listFSM{}
+	leader, err := New("snapshot-leader", "snapshot-leader", leaderFSM.apply, nil, nil,
+		WithDevMode(), WithSnapshot(leaderFSM, nil), WithSnapshotEncryption(keys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leader.Stop()
+	go leader.Run()
+
+	followerFSM := &listFSM{}
+	followerStore := NewMemorySnapshotStore(1)
+	follower, err := New("snapshot-follower", "snapshot-follower", followerFSM.apply, &memoryStore{}, &memoryLog{},
+		WithRPC(newLoopbackRPC()), WithElection(5*time.Second, 6*time.Second),
+		WithSnapshot(followerFSM, followerStore), WithSnapshotEncryption(keys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer follower.Stop()
+	go follower.Run()
+	for {
+		if _, ok := loopbackServices.Load(string(follower.Addr())); ok {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx := context.Background()
+	// after the no-op of the leader's term
+	_, err = leader.ReadIndex(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = leader.Handle(ctx, Command("a"), Command("b"), Command("c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := leader.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Index != 5 || meta.KeyId != "k1" {
+		t.Errorf("expect encrypted snapshot at index 5 but got %+v", meta)
+	}
+	again, err := leader.Snapshot()
+	if err != nil || again.Id != meta.Id {
+		t.Errorf("expect snapshot %s reused but got %+v, err: %v", meta.Id, again, err)
+	}
+	// entries covered by snapshot are compacted, follower can only catch up by snapshot
+	first, _ := leader.(*raft).FirstIndex()
+	if first != meta.Index+1 {
+		t.Errorf("expect first index %d but got %d", meta.Index+1, first)
+	}
+	err = leader.Handle(ctx, Command("d"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = leader.ChangeConfig(ctx, []RaftPeer{{follower.Id(), follower.Addr()}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{"a", "b", "c", "d"}
+	deadline := time.Now().Add(3 * time.Second)
+	for !reflect.DeepEqual(followerFSM.get(), expect) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := followerFSM.get(); !reflect.DeepEqual(got, expect) {
+		t.Fatalf("expect follower state %v but got %v", expect, got)
+	}
+	first, _ = follower.(*raft).FirstIndex()
+	if first != meta.Index+1 {
+		t.Errorf("expect follower's first index %d but got %d", meta.Index+1, first)
+	}
+
+	metas, _ := followerStore.List()
+	if len(metas) != 1 || metas[0].Id != meta.Id || metas[0].KeyId != "k1" {
+		t.Fatalf("expect follower stored snapshot %s but got %+v", meta.Id, metas)
+	}
+	_, rc, err := followerStore.Open(meta.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	b, _ := io.ReadAll(rc)
+	if bytes.Contains(b, []byte(`"a"`)) {
+		t.Errorf("expect stored snapshot encrypted")
+	}
+}
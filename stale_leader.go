@@ -0,0 +1,35 @@
+package raft
+
+import "sync/atomic"
+
+// observeNewerTerm 记录 peer 响应中更新的 term, 以及 peer 知道的该 term 的 Leader
+//
+// 响应通过 sendRPCArgs 通知主循环, 主循环忙于发送心跳时通知会被丢弃,
+// 因此另外记录, 由 Leader 主动检查, 见 staleTerm.
+func (r *raft) observeNewerTerm(term uint64, leader RaftPeer) {
+	if term <= r.GetCurrentTerm() {
+		return
+	}
+	r.hint.observe(term, leader)
+	for {
+		observed := atomic.LoadUint64(&r.newerTerm)
+		if term <= observed || atomic.CompareAndSwapUint64(&r.newerTerm, observed, term) {
+			return
+		}
+	}
+}
+
+// staleTerm 是否已从 peer 得知更新的 term, 即本节点是过期的 Leader
+func (l *leader) staleTerm() (term uint64, stale bool) {
+	term = atomic.LoadUint64(&l.newerTerm)
+	return term, term > l.GetCurrentTerm()
+}
+
+// staleLeaderError 过期的 Leader 拒绝请求时返回, 携带 peer 告知的新 Leader
+func (l *leader) staleLeaderError(term uint64) error {
+	leader, ok := l.hint.get(term)
+	if !ok {
+		return ErrIsNotLeader
+	}
+	return &NotLeaderError{Leader: leader, Term: term}
+}
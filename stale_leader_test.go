@@ -0,0 +1,71 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStaleLeader(t *testing.T) {
+	newLeader := RaftPeer{Id: "stale-new-leader", Addr: "stale-new-leader-addr"}
+
+	t.Run("reject proposals", func(t *testing.T) {
+		r, err := New("stale-reject", "stale-reject", nil, nil, nil, WithDevMode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		raft := r.(*raft)
+		raft.observeNewerTerm(raft.GetCurrentTerm()+1, newLeader)
+		err = r.Handle(context.Background(), Command("a"))
+		var notLeader *NotLeaderError
+		if !errors.As(err, &notLeader) || notLeader.Leader != newLeader {
+			t.Errorf("expect redirected to %+v but got %v", newLeader, err)
+		}
+	})
+
+	t.Run("recovery", func(t *testing.T) {
+		fsm := &listFSM{}
+		r, err := New("stale-leader", "stale-leader", fsm.apply, nil, nil, WithDevMode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Stop()
+		go r.Run()
+
+		follower := runLoopbackFollower(t, "stale-follower")
+		defer follower.Stop()
+		ctx := context.Background()
+		err = r.AddVoter(ctx, follower.Id(), follower.Addr())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the follower moves on to a newer term led by another server
+		term := r.(*raft).GetCurrentTerm() + 3
+		f := follower.(*raft)
+		f.hint.observe(term, newLeader)
+		f.SetCurrentTerm(term)
+
+		// the stale leader learns the newer term from heartbeat responses
+		deadline := time.Now().Add(3 * time.Second)
+		for r.IsLeader() && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if r.IsLeader() {
+			t.Fatal("expect stale leader converted to follower")
+		}
+		if got := r.(*raft).GetCurrentTerm(); got != term {
+			t.Errorf("expect term %d but got %d", term, got)
+		}
+		leader, ok := r.Leader()
+		if !ok || leader != newLeader {
+			t.Errorf("expect leader %+v but got %+v", newLeader, leader)
+		}
+		err = r.Handle(ctx, Command("a"))
+		var notLeader *NotLeaderError
+		if !errors.As(err, &notLeader) || notLeader.Leader != newLeader || notLeader.Term != term {
+			t.Errorf("expect redirected to %+v at term %d but got %v", newLeader, term, err)
+		}
+	})
+}
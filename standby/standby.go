@@ -0,0 +1,200 @@
+// Package standby 将主集群已 commit 的 command 异步复制到备用集群, 用于异地容灾
+//
+//	bridge, err := standby.NewBridge(primaryLog, primary, standbyLeader, store)
+//	go bridge.Run(ctx)
+//
+// Bridge 与主集群的任一节点部署在一起, 读取该节点已 commit 的 log entry,
+// 通过备用集群的 Handle 提交. 备用集群是独立的集群, 不参与主集群的投票与 commit,
+// 其状态机最终一致地落后于主集群; 主集群的 quorum 不会跨越地域.
+package standby
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/mind1949/raft"
+)
+
+var (
+	ErrCompacted = errors.New("err: entries to ship have been compacted from primary log")
+)
+
+// Source 主集群中与 Bridge 部署在一起的节点
+type Source interface {
+	// Stats 获取节点的状态, Bridge 只复制不超过 CommitIndex 的 log entry
+	Stats() raft.Status
+}
+
+// Target 备用集群, 通常是其 Leader
+type Target interface {
+	// Handle 提交 command, 应用到备用集群的状态机后返回
+	Handle(ctx context.Context, cmd ...raft.Command) error
+}
+
+// OptFn NewBridge 的可选项
+type OptFn func(*opts)
+
+// WithBatchSize 每次提交到备用集群的最大 log entry 数量
+func WithBatchSize(size int) OptFn {
+	return func(o *opts) {
+		o.batchSize = size
+	}
+}
+
+// WithPollInterval 追上主集群之后, 检查新 commit 的 log entry 的间隔
+func WithPollInterval(interval time.Duration) OptFn {
+	return func(o *opts) {
+		o.pollInterval = interval
+	}
+}
+
+// WithLogf 输出提交失败等信息
+func WithLogf(logf func(format string, args ...interface{})) OptFn {
+	return func(o *opts) {
+		o.logf = logf
+	}
+}
+
+type opts struct {
+	batchSize    int
+	pollInterval time.Duration
+	logf         func(format string, args ...interface{})
+}
+
+// cursorKey 已复制到备用集群的最后一个 log entry 索引在 Store 中的 key
+var cursorKey = []byte("raft.standby.cursor")
+
+// idempotencyPrefix 提交到备用集群的 command 的幂等键前缀
+const idempotencyPrefix = "standby/"
+
+// NewBridge 创建从 log 复制到 target 的 Bridge
+//
+// log 与 source 属于主集群的同一节点; store 保存复制进度, 重启后从中断处继续.
+func NewBridge(log raft.Log, source Source, target Target, store raft.Store, optFns ...OptFn) (*Bridge, error) {
+	o := &opts{
+		batchSize:    256,
+		pollInterval: 100 * time.Millisecond,
+		logf:         func(string, ...interface{}) {},
+	}
+	for _, fn := range optFns {
+		fn(o)
+	}
+	b, err := store.Get(cursorKey)
+	if err != nil {
+		return nil, err
+	}
+	bridge := &Bridge{log: log, source: source, target: target, store: store, opts: o}
+	if len(b) == 8 {
+		bridge.shipped = binary.BigEndian.Uint64(b)
+	}
+	return bridge, nil
+}
+
+// Bridge 将主集群已 commit 的 command 依序提交到备用集群
+//
+// 只复制 command 类型的 log entry, 配置变更等其他类型被跳过.
+// 每个 command 以其在主集群中的索引作为幂等键(见 raft.WithIdempotencyKey) 提交,
+// 备用集群启用 raft.WithDedupWindow 时, 提交成功但保存进度之前崩溃导致的重复提交会被跳过.
+type Bridge struct {
+	log    raft.Log
+	source Source
+	target Target
+	store  raft.Store
+	opts   *opts
+
+	// shipped 已复制到备用集群的最后一个 log entry 索引
+	shipped uint64
+}
+
+// Shipped 已复制到备用集群的最后一个 log entry 索引
+func (b *Bridge) Shipped() uint64 {
+	return atomic.LoadUint64(&b.shipped)
+}
+
+// Run 持续复制, 直到 ctx 结束
+//
+// 提交失败(如备用集群正在选举)时在下一个间隔重试;
+// 需要复制的 log entry 已被主集群压缩时返回 ErrCompacted, 备用集群需从快照重建.
+func (b *Bridge) Run(ctx context.Context) error {
+	ticker := time.NewTicker(b.opts.pollInterval)
+	defer ticker.Stop()
+	for {
+		n, err := b.Ship(ctx)
+		if errors.Is(err, ErrCompacted) {
+			return err
+		}
+		if err != nil {
+			b.opts.logf("standby: ship after %d, err: %+v", b.Shipped(), err)
+		}
+		if n > 0 && err == nil {
+			// catching up, ship the next batch immediately
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Ship 复制一批已 commit 的 log entry, 返回复制的 log entry 数量
+func (b *Bridge) Ship(ctx context.Context) (int, error) {
+	shipped := b.Shipped()
+	commitIndex := b.source.Stats().CommitIndex
+	if commitIndex <= shipped {
+		return 0, nil
+	}
+	end := commitIndex
+	if end-shipped > uint64(b.opts.batchSize) {
+		end = shipped + uint64(b.opts.batchSize)
+	}
+
+	firstIndex, err := b.log.FirstIndex()
+	if err != nil {
+		return 0, err
+	}
+	if shipped+1 < firstIndex {
+		return 0, fmt.Errorf("%w: next %d, first %d", ErrCompacted, shipped+1, firstIndex)
+	}
+	entries, err := b.log.RangeGet(shipped, end)
+	if err != nil {
+		return 0, err
+	}
+	if uint64(len(entries)) != end-shipped {
+		return 0, fmt.Errorf("%w: got %d entries in (%d, %d]", ErrCompacted, len(entries), shipped, end)
+	}
+
+	for _, entry := range entries {
+		if !entry.Type.IsCommand() {
+			continue
+		}
+		key := fmt.Sprintf("%s%d", idempotencyPrefix, entry.Index)
+		err := b.target.Handle(raft.WithIdempotencyKey(ctx, key), entry.Command)
+		if err != nil {
+			return 0, err
+		}
+		// record progress of each command so that a failed batch resumes where it stopped
+		err = b.advance(entry.Index)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(entries), b.advance(end)
+}
+
+// advance 记录已复制到 index
+func (b *Bridge) advance(index uint64) error {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, index)
+	err := b.store.Set(cursorKey, buf)
+	if err != nil {
+		return err
+	}
+	atomic.StoreUint64(&b.shipped, index)
+	return nil
+}
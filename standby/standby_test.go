@@ -0,0 +1,104 @@
+package standby
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mind1949/raft"
+	"github.com/mind1949/raft/raftmock"
+)
+
+// source 已 commit 到 commitIndex 的主集群节点
+type source struct {
+	commitIndex uint64
+}
+
+func (s *source) Stats() raft.Status {
+	return raft.Status{CommitIndex: atomic.LoadUint64(&s.commitIndex)}
+}
+
+func TestBridge(t *testing.T) {
+	log := raftmock.NewLog()
+	err := log.Append(
+		raft.LogEntry{Index: 1, Term: 1, Command: raft.Command("a")},
+		// a non-command entry, such as a configuration change
+		raft.LogEntry{Index: 2, Term: 1, Type: raft.LogEntryType(1)},
+		raft.LogEntry{Index: 3, Term: 1, Command: raft.Command("b")},
+		raft.LogEntry{Index: 4, Term: 1, Command: raft.Command("c")},
+		raft.LogEntry{Index: 5, Term: 1, Command: raft.Command("d")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary := &source{commitIndex: 4}
+	fsm := raftmock.NewFSM()
+	target := raftmock.NewRaft("standby", fsm.Apply)
+	store := raftmock.NewStore()
+	ctx := context.Background()
+
+	bridge, err := NewBridge(log, primary, target, store, WithBatchSize(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("resume after failure", func(t *testing.T) {
+		target.FailNext("Handle", nil, errors.New("electing"))
+		if _, err := bridge.Ship(ctx); err == nil {
+			t.Fatal("expect error but got nil")
+		}
+		if shipped := bridge.Shipped(); shipped != 1 {
+			t.Fatalf("expect shipped 1 but got %d", shipped)
+		}
+		if n, err := bridge.Ship(ctx); err != nil || n != 3 {
+			t.Fatalf("expect 3 entries shipped but got (%d, %v)", n, err)
+		}
+		if n, err := bridge.Ship(ctx); err != nil || n != 0 {
+			t.Fatalf("expect nothing beyond commit index but got (%d, %v)", n, err)
+		}
+		expect := []raft.Command{raft.Command("a"), raft.Command("b"), raft.Command("c")}
+		if got := fsm.Commands(); !reflect.DeepEqual(got, expect) {
+			t.Fatalf("expect applied %q but got %q", expect, got)
+		}
+	})
+
+	t.Run("restart from stored cursor", func(t *testing.T) {
+		restarted, err := NewBridge(log, primary, target, store, WithPollInterval(time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if shipped := restarted.Shipped(); shipped != 4 {
+			t.Fatalf("expect shipped 4 but got %d", shipped)
+		}
+		atomic.StoreUint64(&primary.commitIndex, 5)
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		go restarted.Run(ctx)
+		for restarted.Shipped() != 5 {
+			select {
+			case <-ctx.Done():
+				t.Fatalf("expect shipped 5 but got %d", restarted.Shipped())
+			case <-time.After(time.Millisecond):
+			}
+		}
+		if got := fsm.Commands(); len(got) != 4 || string(got[3]) != "d" {
+			t.Fatalf("expect d applied once but got %q", got)
+		}
+	})
+
+	t.Run("compacted", func(t *testing.T) {
+		if err := log.Append(raft.LogEntry{Index: 6, Term: 1, Command: raft.Command("e")}); err != nil {
+			t.Fatal(err)
+		}
+		if err := log.Compact(6); err != nil {
+			t.Fatal(err)
+		}
+		atomic.StoreUint64(&primary.commitIndex, 6)
+		if _, err := bridge.Ship(ctx); !errors.Is(err, ErrCompacted) {
+			t.Fatalf("expect %v but got %v", ErrCompacted, err)
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package raft
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// startupProbe 启动时向 peer 查询日志状态, 检查本节点是否与集群分叉
+//
+// 从旧备份恢复, 或误用其他集群数据目录的节点, 其日志可能与集群已 commit 的
+// log entry 冲突. 探测完成之前节点拒绝读请求.
+type startupProbe struct {
+	// timeout 等待 peer 响应的时间, 为 0 时不探测
+	timeout time.Duration
+	// pending 是否正在探测
+	pending int32
+}
+
+func (p *startupProbe) enabled() bool {
+	return p.timeout > 0
+}
+
+func (p *startupProbe) probing() bool {
+	return atomic.LoadInt32(&p.pending) == 1
+}
+
+// probeDivergence peer 的响应表明本节点的日志与其分叉的原因, 未分叉时为空
+func probeDivergence(lastLogIndex, lastLogTerm uint64, results PreVoteResults) string {
+	// local last entry conflicts with an entry committed on peer
+	if lastLogIndex > 0 && lastLogIndex <= results.CommitIndex && !results.LogMatch {
+		return fmt.Sprintf("log entry (%d, %d) conflicts with entry committed at %d", lastLogIndex, lastLogTerm, results.CommitIndex)
+	}
+	// local log contains a term that peer has never reached
+	if lastLogTerm > results.Term {
+		return fmt.Sprintf("last log term %d is beyond peer's term %d", lastLogTerm, results.Term)
+	}
+	return ""
+}
+
+// probeCluster 通过 PreVote 获取每个 peer 的日志状态, 与本地比较
+// 分叉时发出 EventLogDiverged 事件
+func (r *raft) probeCluster() {
+	defer atomic.StoreInt32(&r.probe.pending, 0)
+
+	lastLogIndex, lastLogTerm, err := r.Last()
+	if err != nil {
+		r.log(LogGeneral).Error("Probe cluster, get last log entry", "err", err)
+		return
+	}
+	args := PreVoteArgs{
+		ProtocolVersion: r.versions.local,
+		Term:            r.GetCurrentTerm(),
+		CandidateId:     r.Id(),
+		LastLogIndex:    lastLogIndex,
+		LastLogTerm:     lastLogTerm,
+	}
+
+	type response struct {
+		id      RaftId
+		results PreVoteResults
+		err     error
+	}
+	var peers []RaftPeer
+	for _, peer := range r.configs.GetConfig().GetPeers() {
+		if peer.Id != r.Id() {
+			peers = append(peers, peer)
+		}
+	}
+	// buffered, late responses don't block
+	responses := make(chan response, len(peers))
+	for _, peer := range peers {
+		peer := peer
+		go func() {
+			results, err := r.rpc.CallPreVote(r.resolve(peer), args)
+			responses <- response{id: peer.Id, results: results, err: err}
+		}()
+	}
+
+	var diverged []string
+	timeout := time.NewTimer(r.probe.timeout)
+	defer timeout.Stop()
+	for received := 0; received < len(peers); received++ {
+		select {
+		case <-r.done:
+			return
+		case <-timeout.C:
+			received = len(peers)
+			continue
+		case resp := <-responses:
+			if resp.err != nil {
+				r.log(LogTransport).Debug("Probe peer", "peer", resp.id, "err", resp.err)
+				continue
+			}
+			if reason := probeDivergence(lastLogIndex, lastLogTerm, resp.results); reason != "" {
+				diverged = append(diverged, fmt.Sprintf("%s: %s", resp.id, reason))
+			}
+		}
+	}
+	if len(diverged) == 0 {
+		return
+	}
+	r.metrics.IncrCounter(MetricStartupDiverged, 1)
+	r.emit(Event{
+		Type:      EventLogDiverged,
+		Level:     EventLevelWarning,
+		LastIndex: lastLogIndex,
+		Message:   "log appears to have diverged from cluster, " + strings.Join(diverged, "; "),
+	})
+}
@@ -0,0 +1,108 @@
+package raft
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProbeDivergence(t *testing.T) {
+	tests := []struct {
+		name         string
+		lastLogIndex uint64
+		lastLogTerm  uint64
+		results      PreVoteResults
+		diverged     bool
+	}{
+		{"empty", 0, 0, PreVoteResults{Term: 2, CommitIndex: 5}, false},
+		{"match committed", 3, 2, PreVoteResults{Term: 2, CommitIndex: 5, LogMatch: true}, false},
+		{"conflict committed", 3, 1, PreVoteResults{Term: 2, CommitIndex: 5}, true},
+		{"conflict uncommitted", 6, 1, PreVoteResults{Term: 2, CommitIndex: 5}, false},
+		{"term beyond peer", 6, 3, PreVoteResults{Term: 2, CommitIndex: 5}, true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			reason := probeDivergence(tt.lastLogIndex, tt.lastLogTerm, tt.results)
+			if diverged := reason != ""; diverged != tt.diverged {
+				t.Fatalf("expect diverged %t but got %t: %q", tt.diverged, diverged, reason)
+			}
+		})
+	}
+}
+
+func TestStartupProbe(t *testing.T) {
+	leader, err := New("probe-leader", "probe-leader", (&listFSM{}).apply, nil, nil, WithDevMode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leader.Stop()
+	go leader.Run()
+	for {
+		if _, ok := loopbackServices.Load(string(leader.Addr())); ok {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := leader.Handle(context.Background(), Command("a"), Command("b")); err != nil {
+		t.Fatal(err)
+	}
+
+	probe := func(t *testing.T, id RaftId, log *memoryLog) []Event {
+		var (
+			mux    sync.Mutex
+			events []Event
+		)
+		observer := func(event Event) {
+			if event.Type == EventPeerAdded {
+				return
+			}
+			mux.Lock()
+			defer mux.Unlock()
+			events = append(events, event)
+		}
+		rr, err := New(id, RaftAddr(id), nil, &memoryStore{}, log,
+			WithRPC(newLoopbackRPC()), WithStartupProbe(time.Second), WithObserver(observer))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := rr.(*raft)
+		config := newBootstrapAsLeaderConfig(RaftPeer{Id: id, Addr: RaftAddr(id)}).
+			GenJointConfig([]RaftPeer{{Id: leader.Id(), Addr: leader.Addr()}}, nil)
+		config.SetIndex(1)
+		if err := r.configs.UseConfig(config); err != nil {
+			t.Fatal(err)
+		}
+
+		r.probe.pending = 1
+		if !r.catchingUp() {
+			t.Fatalf("expect refusing reads while probing")
+		}
+		r.probeCluster()
+		if r.probe.probing() {
+			t.Fatalf("expect probe finished")
+		}
+
+		mux.Lock()
+		defer mux.Unlock()
+		return events
+	}
+
+	t.Run("consistent", func(t *testing.T) {
+		events := probe(t, "probe-consistent", &memoryLog{})
+		if len(events) != 0 {
+			t.Fatalf("expect no events but got %+v", events)
+		}
+	})
+	t.Run("diverged", func(t *testing.T) {
+		log := &memoryLog{queue: []LogEntry{{Index: 1, Term: 7}, {Index: 2, Term: 7}}}
+		events := probe(t, "probe-diverged", log)
+		if len(events) != 1 || events[0].Type != EventLogDiverged {
+			t.Fatalf("expect %s event but got %+v", EventLogDiverged, events)
+		}
+		if events[0].Level != EventLevelWarning {
+			t.Fatalf("expect level %s but got %s", EventLevelWarning, events[0].Level)
+		}
+	})
+}
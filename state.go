@@ -1,6 +1,16 @@
 package raft
 
-import "sync"
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	ErrVoteTermStale = errors.New("err: vote in a term older than current term")
+	ErrAlreadyVoted  = errors.New("err: already voted for another candidate in the term")
+)
 
 func newState(store Store) (*state_, error) {
 	s := &state_{
@@ -8,6 +18,7 @@ func newState(store Store) (*state_, error) {
 
 		keyCurrentTerm: []byte("state.CurrentTerm"),
 		keyVotedFor:    []byte("state.VotedFor"),
+		keyVote:        []byte("state.Vote"),
 	}
 	err := s.loadCurrentTerm()
 	if err != nil {
@@ -17,6 +28,10 @@ func newState(store Store) (*state_, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = s.loadVote()
+	if err != nil {
+		return nil, err
+	}
 
 	return s, nil
 }
@@ -38,6 +53,13 @@ type state interface {
 	// 	candidateId that received vote in current term (or null if none)
 	GetVotedFor() RaftId
 	SetVotedFor(RaftId) error
+	// GetVote 最近一次投票的 term 与 candidateId
+	//	voter 响应投票之后, 转换为 follower 之前, term 可能大于 currentTerm
+	GetVote() (term uint64, votedFor RaftId)
+	// SetVote 在一次写入中持久化 term 与在该 term 中的投票
+	//	candidate 在请求投票之前, voter 在响应投票之前调用,
+	//	重启后 currentTerm 不小于该 term, 不会在同一 term 中再次投票
+	SetVote(term uint64, votedFor RaftId) error
 
 	// ------------------------------------------------------
 	// Volatile state on all servers:
@@ -64,9 +86,13 @@ type state_ struct {
 
 	keyCurrentTerm []byte
 	keyVotedFor    []byte
+	// keyVote term 与 votedFor 一起持久化的 key, 见 SetVote
+	keyVote []byte
 
 	currentTerm uint64
 	votedFor    RaftId
+	// voteTerm votedFor 所在的 term, 与 currentTerm 不同时在 currentTerm 中尚未投票
+	voteTerm uint64
 
 	commitIndex uint64
 	lastApplied uint64
@@ -103,6 +129,29 @@ func (s *state_) loadVotedFor() error {
 	return nil
 }
 
+// loadVote 加载与 term 一起持久化的投票
+// 没有时沿用分开持久化的 votedFor, 视为在 currentTerm 中的投票
+func (s *state_) loadVote() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value, err := s.store.Get(s.keyVote)
+	if err != nil {
+		return err
+	}
+	if len(value) < 8 {
+		s.voteTerm = s.currentTerm
+		return nil
+	}
+	s.voteTerm = binary.BigEndian.Uint64(value[:8])
+	s.votedFor = RaftId(value[8:])
+	// the term may not be persisted separately before crashing
+	if s.voteTerm > s.currentTerm {
+		s.currentTerm = s.voteTerm
+	}
+	return nil
+}
+
 func (s *state_) GetCurrentTerm() uint64 {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -125,6 +174,10 @@ func (s *state_) GetVotedFor() RaftId {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	// voted in an older term
+	if s.voteTerm != s.currentTerm {
+		return ""
+	}
 	return s.votedFor
 }
 
@@ -132,8 +185,41 @@ func (s *state_) SetVotedFor(votedFor RaftId) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.votedFor = votedFor
-	return s.store.Set(s.keyVotedFor, []byte(votedFor))
+	return s.setVote(s.currentTerm, votedFor)
+}
+
+func (s *state_) GetVote() (term uint64, votedFor RaftId) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.voteTerm, s.votedFor
+}
+
+func (s *state_) SetVote(term uint64, votedFor RaftId) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.setVote(term, votedFor)
+}
+
+func (s *state_) setVote(term uint64, votedFor RaftId) error {
+	if term < s.currentTerm || term < s.voteTerm {
+		return fmt.Errorf("%w: %d", ErrVoteTermStale, term)
+	}
+	// candidate votes for self while a vote in the same term is being granted
+	if term == s.voteTerm && !s.votedFor.isNil() && s.votedFor != votedFor {
+		return fmt.Errorf("%w: %s at %d", ErrAlreadyVoted, s.votedFor, term)
+	}
+	// a single write, so that the term and the vote survive a crash together
+	value := make([]byte, 8, 8+len(votedFor))
+	binary.BigEndian.PutUint64(value, term)
+	value = append(value, votedFor...)
+	err := s.store.Set(s.keyVote, value)
+	if err != nil {
+		return err
+	}
+	s.voteTerm, s.votedFor = term, votedFor
+	return nil
 }
 
 func (s *state_) GetCommitIndex() uint64 {
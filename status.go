@@ -0,0 +1,98 @@
+package raft
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Status raft 一致性模型的状态快照
+type Status struct {
+	Id RaftId
+	// State Follower/Candidate/Leader
+	State string
+	Term  uint64
+	// VotedFor 当前 term 投票给的 candidate, 未投票时为空
+	VotedFor RaftId
+
+	CommitIndex  uint64
+	LastApplied  uint64
+	LastLogIndex uint64
+	LastLogTerm  uint64
+
+	// Leader 本节点知道的当前 term 的 Leader, 不知道时为零值
+	Leader RaftPeer
+	// LastContact 最近一次收到 Leader 心跳的时间, 未收到过或本节点是 Leader 时为零值
+	LastContact time.Time
+
+	// CatchingUp 重启后还未应用到从 Leader 得知的 commitIndex
+	CatchingUp bool
+
+	// Apply apply worker 的耗时分布
+	Apply ApplyStatus
+
+	// Replication leader 记录的各 peer 日志复制状态, 非 leader 时为空
+	Replication []ReplicationStatus
+}
+
+// ReplicationStatus leader 向 peer 复制日志的状态
+type ReplicationStatus struct {
+	Id         RaftId
+	NextIndex  uint64
+	MatchIndex uint64
+	// Lag leader 最新日志与 peer 已复制日志之间相差的条目数
+	Lag uint64
+	// LastContact leader 最近一次联系上 peer 的时间(发出被响应的 RPC 的时间), 未响应过时为零值
+	LastContact time.Time
+}
+
+// Stats 获取状态快照
+func (r *raft) Stats() Status {
+	lastLogIndex, lastLogTerm, _ := r.Last()
+	status := Status{
+		Id:           r.Id(),
+		Term:         r.GetCurrentTerm(),
+		VotedFor:     r.GetVotedFor(),
+		CommitIndex:  r.GetCommitIndex(),
+		LastApplied:  r.GetLastApplied(),
+		LastLogIndex: lastLogIndex,
+		LastLogTerm:  lastLogTerm,
+		CatchingUp:   r.catchingUp(),
+		Apply:        r.accounting.status(),
+	}
+	server := r.GetServer()
+	if server == nil {
+		return status
+	}
+	status.State = server.String()
+	status.Leader, _ = r.Leader()
+	if l, ok := server.(*leader); ok {
+		status.Replication = l.replicationStatus(lastLogIndex)
+	} else if lastHeartbeat := atomic.LoadInt64(&r.lastHeartbeat); lastHeartbeat > 0 {
+		status.LastContact = time.UnixMilli(lastHeartbeat)
+	}
+	return status
+}
+
+// replicationStatus 各 peer 的日志复制状态, 按 id 排序
+func (l *leader) replicationStatus(lastLogIndex uint64) []ReplicationStatus {
+	var replication []ReplicationStatus
+	for id, p := range l.progress() {
+		var lag uint64
+		if p.MatchIndex < lastLogIndex {
+			lag = lastLogIndex - p.MatchIndex
+		}
+		contact, _ := l.contact.acked(id)
+		replication = append(replication, ReplicationStatus{
+			Id:          id,
+			NextIndex:   p.NextIndex,
+			MatchIndex:  p.MatchIndex,
+			Lag:         lag,
+			LastContact: contact,
+		})
+	}
+	sort.Slice(replication, func(i, j int) bool {
+		return replication[i].Id < replication[j].Id
+	})
+	return replication
+}
@@ -0,0 +1,59 @@
+package raft
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	leader, err := New("stats-leader", "stats-leader", (&listFSM{}).apply, nil, nil, WithDevMode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leader.Stop()
+	go leader.Run()
+
+	follower := runLoopbackFollower(t, "stats-follower")
+	defer follower.Stop()
+	ctx := context.Background()
+	if err := leader.AddVoter(ctx, follower.Id(), follower.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	if err := leader.Handle(ctx, Command("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("leader", func(t *testing.T) {
+		status := leader.Stats()
+		if status.State != "Leader" || status.Leader.Id != leader.Id() {
+			t.Fatalf("expect leading itself but got %s led by %s", status.State, status.Leader)
+		}
+		if status.LastLogTerm != status.Term {
+			t.Fatalf("expect last log term %d but got %d", status.Term, status.LastLogTerm)
+		}
+		for _, replication := range status.Replication {
+			if replication.Id != follower.Id() {
+				continue
+			}
+			if replication.LastContact.IsZero() || time.Since(replication.LastContact) > time.Second {
+				t.Fatalf("expect recent contact with follower but got %s", replication.LastContact)
+			}
+			return
+		}
+		t.Fatalf("expect replication status of %s but got %+v", follower.Id(), status.Replication)
+	})
+
+	t.Run("follower", func(t *testing.T) {
+		status := follower.Stats()
+		if status.Leader.Id != leader.Id() || status.Leader.Addr != leader.Addr() {
+			t.Fatalf("expect leader %s but got %s", leader.Id(), status.Leader)
+		}
+		if status.LastContact.IsZero() || time.Since(status.LastContact) > time.Second {
+			t.Fatalf("expect recent heartbeat but got %s", status.LastContact)
+		}
+		if status.LastLogIndex != leader.Stats().LastLogIndex {
+			t.Fatalf("expect last log index %d but got %d", leader.Stats().LastLogIndex, status.LastLogIndex)
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package raft
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// storageBatchThreshold 中位追加耗时达到该值时, 自动启用 proposal 合并
+	storageBatchThreshold = 500 * time.Microsecond
+	// storageMaxBatchSize 自动启用合并时的最大批次
+	storageMaxBatchSize = 256
+	// storageSlowRatio 中位追加耗时超过选举超时的 1/storageSlowRatio 时, 认为磁盘过慢
+	storageSlowRatio = 10
+)
+
+// storageBenchmark 启动时对 Log 追加 log entry (含 fsync) 的耗时测量
+type storageBenchmark struct {
+	median time.Duration
+	max    time.Duration
+}
+
+// benchmarkStorage 在 Log 末尾逐个追加 samples 个 term 为 0 的 no-op log entry 并计时, 之后截断
+//
+// term 为 0 的 log entry 不会与任何 leader 的 log entry 匹配, 即便截断前崩溃,
+// 也会在之后的复制中被 leader 覆盖.
+// 未通过 WithProposalBatching 配置时, 根据耗时自动启用 proposal 合并;
+// 耗时相对选举超时过长时发出 EventSlowStorage 事件.
+func (r *raft) benchmarkStorage(samples int) {
+	lastIndex, _, err := r.Last()
+	if err != nil {
+		r.log(LogGeneral).Error("Benchmark storage, get last log entry", "err", err)
+		return
+	}
+	defer func() {
+		if err := r.AppendAfter(lastIndex); err != nil {
+			r.log(LogGeneral).Error("Benchmark storage, truncate", "after", lastIndex, "err", err)
+		}
+	}()
+
+	durations := make([]time.Duration, 0, samples)
+	for i := 0; i < samples; i++ {
+		start := time.Now()
+		_, err := r.AppendEntry(LogEntry{Type: logEntryTypeNoop, AppendTime: start})
+		if err != nil {
+			r.log(LogGeneral).Error("Benchmark storage, append", "err", err)
+			return
+		}
+		elapsed := time.Since(start)
+		durations = append(durations, elapsed)
+		r.metrics.AddSample(MetricStorageAppendDuration, milliseconds(elapsed))
+	}
+	if len(durations) == 0 {
+		return
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	r.tuneStorage(storageBenchmark{median: durations[len(durations)/2], max: durations[len(durations)-1]})
+}
+
+// tuneStorage 根据测量结果调整默认的合并参数, 并检查磁盘是否跟得上选举超时
+func (r *raft) tuneStorage(bench storageBenchmark) {
+	r.log(LogGeneral).Info("Benchmark storage", "median", bench.median, "max", bench.max)
+
+	if r.batchSize == 0 && bench.median >= storageBatchThreshold {
+		size := int(bench.median/storageBatchThreshold) + 1
+		if size > storageMaxBatchSize {
+			size = storageMaxBatchSize
+		}
+		r.batchSize = size
+		r.batchDelay = bench.median
+		r.log(LogGeneral).Info("Benchmark storage, batch proposals", "size", r.batchSize, "delay", r.batchDelay)
+	}
+
+	if bench.median*storageSlowRatio > r.electionTimeout[0] {
+		r.emit(Event{
+			Type:  EventSlowStorage,
+			Level: EventLevelWarning,
+			Message: fmt.Sprintf("append median %s (max %s) is too slow for election timeout %s",
+				bench.median, bench.max, r.electionTimeout[0]),
+		})
+	}
+}
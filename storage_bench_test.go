@@ -0,0 +1,77 @@
+package raft
+
+import (
+	"testing"
+	"time"
+)
+
+// slowLog 每次 AppendEntry 等待 delay, 模拟较慢的磁盘
+type slowLog struct {
+	*memoryLog
+	delay time.Duration
+}
+
+func (l *slowLog) AppendEntry(entry LogEntry) (uint64, error) {
+	time.Sleep(l.delay)
+	return l.memoryLog.AppendEntry(entry)
+}
+
+func TestBenchmarkStorage(t *testing.T) {
+	newRaft := func(t *testing.T, delay time.Duration, opts ...OptFn) (*raft, *[]Event) {
+		log := &slowLog{memoryLog: &memoryLog{}, delay: delay}
+		if err := log.Append(LogEntry{Index: 1, Term: 1}, LogEntry{Index: 2, Term: 1}); err != nil {
+			t.Fatal(err)
+		}
+		var events []Event
+		opts = append(opts, WithElection(50*time.Millisecond, 100*time.Millisecond), WithObserver(func(e Event) {
+			events = append(events, e)
+		}))
+		r, err := New("bench", "bench", (&listFSM{}).apply, &memoryStore{}, log, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r.(*raft), &events
+	}
+
+	t.Run("log is left untouched", func(t *testing.T) {
+		r, _ := newRaft(t, 0)
+		r.benchmarkStorage(5)
+		index, term, err := r.Last()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if index != 2 || term != 1 {
+			t.Fatalf("expect last entry (2, 1) but got (%d, %d)", index, term)
+		}
+	})
+
+	t.Run("fast disk", func(t *testing.T) {
+		r, events := newRaft(t, 0)
+		r.benchmarkStorage(5)
+		if r.batchSize != 0 {
+			t.Fatalf("expect batching disabled but got batch size %d", r.batchSize)
+		}
+		if len(*events) != 0 {
+			t.Fatalf("expect no event but got %+v", *events)
+		}
+	})
+
+	t.Run("slow disk", func(t *testing.T) {
+		r, events := newRaft(t, 10*time.Millisecond)
+		r.benchmarkStorage(3)
+		if r.batchSize <= 1 || r.batchDelay < 10*time.Millisecond {
+			t.Fatalf("expect batching enabled but got size %d, delay %s", r.batchSize, r.batchDelay)
+		}
+		if len(*events) != 1 || (*events)[0].Type != EventSlowStorage || (*events)[0].Level != EventLevelWarning {
+			t.Fatalf("expect a SlowStorage warning but got %+v", *events)
+		}
+	})
+
+	t.Run("configured batching is kept", func(t *testing.T) {
+		r, _ := newRaft(t, time.Millisecond, WithProposalBatching(8, time.Millisecond))
+		r.benchmarkStorage(3)
+		if r.batchSize != 8 || r.batchDelay != time.Millisecond {
+			t.Fatalf("expect batch size 8, delay 1ms but got %d, %s", r.batchSize, r.batchDelay)
+		}
+	})
+}
@@ -19,6 +19,11 @@ type Store interface {
 
 var _ Store = (*memoryStore)(nil)
 
+// NewMemoryStore 创建保存在内存中的 Store, 不持久化, 用于开发模式与测试
+func NewMemoryStore() Store {
+	return &memoryStore{}
+}
+
 // memoryStore just for testing
 type memoryStore struct {
 	mux sync.Mutex
@@ -0,0 +1,161 @@
+package raft
+
+import "sync"
+
+// subscriberBuffer 每个订阅 channel 的缓冲大小, 缓冲满时丢弃事件
+const subscriberBuffer = 64
+
+// subscriptions 通过 Subscribe 订阅事件的 channel
+type subscriptions struct {
+	mux    sync.Mutex
+	chans  []chan Event
+	closed bool
+
+	// term, leader 最近一次通知的 leadership, 避免每次心跳重复通知
+	term   uint64
+	leader RaftId
+}
+
+// subscribe 添加订阅, 已关闭时返回已关闭的 channel
+func (s *subscriptions) subscribe() <-chan Event {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	ch := make(chan Event, subscriberBuffer)
+	if s.closed {
+		close(ch)
+		return ch
+	}
+	s.chans = append(s.chans, ch)
+	return ch
+}
+
+// publish 不阻塞地向所有订阅 channel 发送 event, 返回因缓冲满而丢弃的数量
+func (s *subscriptions) publish(event Event) (dropped int) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for _, ch := range s.chans {
+		select {
+		case ch <- event:
+		default:
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// close 关闭所有订阅 channel
+func (s *subscriptions) close() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	for _, ch := range s.chans {
+		close(ch)
+	}
+	s.chans = nil
+}
+
+// changeLeadership 记录 term 的 Leader, 与最近一次通知相同时返回 false
+func (s *subscriptions) changeLeadership(term uint64, leaderId RaftId) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.term == term && s.leader == leaderId {
+		return false
+	}
+	s.term, s.leader = term, leaderId
+	return true
+}
+
+// Subscribe 返回接收事件的 channel, 包括 Leader 与成员变化、快照等
+//
+// 与 Observer 不同, 订阅者在自己的 goroutine 中接收事件, 适合启停只在 Leader
+// 上运行的后台任务. 订阅者处理不及时, 缓冲满时事件被丢弃, 见 MetricEventsDropped.
+// Stop 之后 channel 被关闭.
+func (r *raft) Subscribe() <-chan Event {
+	return r.subscriptions.subscribe()
+}
+
+// notifyLeadership 通知 leadership 变化
+// leaderId 为空表示本节点不再是 Leader
+func (r *raft) notifyLeadership(term uint64, leaderId RaftId, startIndex uint64) {
+	if !r.subscriptions.changeLeadership(term, leaderId) {
+		return
+	}
+	switch {
+	case leaderId.isNil():
+		r.emit(Event{Type: EventBecameFollower, Level: EventLevelInfo, Message: "stepped down"})
+		return
+	case leaderId == r.Id():
+		r.emit(Event{Type: EventBecameLeader, Level: EventLevelInfo, FirstIndex: startIndex,
+			Peer: RaftPeer{Id: r.Id(), Addr: r.Addr()}, Message: "became leader"})
+	}
+	leader := RaftPeer{Id: leaderId}
+	for _, peer := range r.configs.GetConfig().GetPeers() {
+		if peer.Id == leaderId {
+			leader.Addr = peer.Addr
+		}
+	}
+	r.emit(Event{Type: EventLeaderChanged, Level: EventLevelInfo, Peer: leader, Message: "leader changed"})
+}
+
+// diffPeers 返回 cur 相比 pre 增加与移除的 peer
+func diffPeers(pre, cur []RaftPeer) (added, removed []RaftPeer) {
+	ids := make(map[RaftId]bool, len(pre))
+	for _, peer := range pre {
+		ids[peer.Id] = true
+	}
+	for _, peer := range cur {
+		if !ids[peer.Id] {
+			added = append(added, peer)
+		}
+		delete(ids, peer.Id)
+	}
+	for _, peer := range pre {
+		if ids[peer.Id] {
+			removed = append(removed, peer)
+		}
+	}
+	return added, removed
+}
+
+var _ configManager = (*notifyingConfigs)(nil)
+
+// notifyingConfigs 配置变化时发出 EventPeerAdded, EventPeerRemoved 事件
+type notifyingConfigs struct {
+	configManager
+	raft *raft
+}
+
+func (c notifyingConfigs) UseConfig(cfg config) error {
+	pre := c.GetConfig()
+	err := c.configManager.UseConfig(cfg)
+	if err != nil {
+		return err
+	}
+	c.notify(pre, cfg)
+	return nil
+}
+
+func (c notifyingConfigs) FallbackConfig() error {
+	pre := c.GetConfig()
+	err := c.configManager.FallbackConfig()
+	if err != nil {
+		return err
+	}
+	c.notify(pre, c.GetConfig())
+	return nil
+}
+
+func (c notifyingConfigs) notify(pre, cur config) {
+	added, removed := diffPeers(pre.GetPeers(), cur.GetPeers())
+	for _, peer := range added {
+		c.raft.emit(Event{Type: EventPeerAdded, Level: EventLevelInfo, FirstIndex: cur.GetIndex(),
+			Peer: peer, Message: "peer added"})
+	}
+	for _, peer := range removed {
+		c.raft.emit(Event{Type: EventPeerRemoved, Level: EventLevelInfo, FirstIndex: cur.GetIndex(),
+			Peer: peer, Message: "peer removed"})
+	}
+}
@@ -0,0 +1,147 @@
+package raft
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// waitEvent 从 events 中等待类型为 typ 的事件
+func waitEvent(t *testing.T, events <-chan Event, typ EventType) Event {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatalf("expect event %s but channel closed", typ)
+			}
+			if event.Type == typ {
+				return event
+			}
+		case <-timeout:
+			t.Fatalf("expect event %s but timed out", typ)
+		}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	leader, err := New("subscribe-leader", "subscribe-leader", (&listFSM{}).apply, &memoryStore{}, &memoryLog{},
+		WithDevMode(), WithSnapshot(&listFSM{}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leader.Stop()
+	leaderEvents := leader.Subscribe()
+	go leader.Run()
+
+	follower, err := New("subscribe-follower", "subscribe-follower", (&listFSM{}).apply, &memoryStore{}, &memoryLog{},
+		WithRPC(newLoopbackRPC()), WithElection(5*time.Second, 6*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer follower.Stop()
+	followerEvents := follower.Subscribe()
+	go follower.Run()
+	for {
+		if _, ok := loopbackServices.Load(string(follower.Addr())); ok {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx := context.Background()
+	if err := leader.AddVoter(ctx, follower.Id(), follower.Addr()); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("peer added", func(t *testing.T) {
+		event := waitEvent(t, leaderEvents, EventPeerAdded)
+		if event.Peer.Id != follower.Id() || event.Peer.Addr != follower.Addr() {
+			t.Fatalf("expect peer %s but got %s", follower.Id(), event.Peer)
+		}
+	})
+
+	t.Run("leader changed", func(t *testing.T) {
+		event := waitEvent(t, followerEvents, EventLeaderChanged)
+		if event.Peer.Id != leader.Id() {
+			t.Fatalf("expect leader %s but got %s", leader.Id(), event.Peer)
+		}
+	})
+
+	t.Run("snapshot taken", func(t *testing.T) {
+		if err := leader.Handle(ctx, Command("x")); err != nil {
+			t.Fatal(err)
+		}
+		meta, err := leader.Snapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		event := waitEvent(t, leaderEvents, EventSnapshotTaken)
+		if event.LastIndex != meta.Index || event.Message != meta.Id {
+			t.Fatalf("expect snapshot %s at %d but got %s at %d", meta.Id, meta.Index, event.Message, event.LastIndex)
+		}
+	})
+
+	t.Run("peer removed", func(t *testing.T) {
+		if err := leader.RemoveServer(ctx, follower.Id()); err != nil {
+			t.Fatal(err)
+		}
+		event := waitEvent(t, leaderEvents, EventPeerRemoved)
+		if event.Peer.Id != follower.Id() {
+			t.Fatalf("expect peer %s but got %s", follower.Id(), event.Peer)
+		}
+	})
+
+	t.Run("closed on stop", func(t *testing.T) {
+		follower.Stop()
+		for range followerEvents {
+		}
+		if _, ok := <-follower.Subscribe(); ok {
+			t.Fatal("expect closed channel after stop")
+		}
+	})
+}
+
+func TestNotifyLeadership(t *testing.T) {
+	node, err := New("a", "a", (&listFSM{}).apply, &memoryStore{}, &memoryLog{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := node.(*raft)
+	events := r.Subscribe()
+
+	r.notifyLeadership(1, "a", 3)
+	r.notifyLeadership(1, "a", 3)
+	r.notifyLeadership(1, "", 0)
+	r.notifyLeadership(2, "b", 0)
+
+	expect := []EventType{EventBecameLeader, EventLeaderChanged, EventBecameFollower, EventLeaderChanged}
+	for _, typ := range expect {
+		select {
+		case event := <-events:
+			if event.Type != typ {
+				t.Fatalf("expect event %s but got %s", typ, event.Type)
+			}
+		default:
+			t.Fatalf("expect event %s but got none", typ)
+		}
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("expect no more events but got %s", event.Type)
+	default:
+	}
+}
+
+func TestDiffPeers(t *testing.T) {
+	pre := []RaftPeer{{Id: "a"}, {Id: "b"}}
+	cur := []RaftPeer{{Id: "b"}, {Id: "c"}}
+	added, removed := diffPeers(pre, cur)
+	if len(added) != 1 || added[0].Id != "c" {
+		t.Fatalf("expect added [c] but got %v", added)
+	}
+	if len(removed) != 1 || removed[0].Id != "a" {
+		t.Fatalf("expect removed [a] but got %v", removed)
+	}
+}
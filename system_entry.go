@@ -0,0 +1,96 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrEntryNotProposable = errors.New("err: log entry can't be proposed")
+)
+
+// NewNoopEntry 创建 no-op log entry, 见 ProposeEntry
+//
+// no-op 不交给状态机, 也不改变任何状态; 它被 commit 时, Leader 在当前 term 中
+// 已经 commit 了 log entry, 之前所有的 log entry 也都已 commit (§5.4.2, §8).
+// 可用于确认本节点仍是 Leader, 或在不写入应用数据的情况下推进 commitIndex.
+func NewNoopEntry() LogEntry {
+	return LogEntry{Type: logEntryTypeNoop}
+}
+
+// NewBarrierEntry 创建 barrier log entry, 见 ProposeEntry
+//
+// barrier 不交给状态机, 但与 command 依序单独应用: 它被应用时,
+// 之前所有的 log entry 都已应用到本节点的状态机.
+// 可用于在 Leader 上等待之前的写入全部生效, 如新 Leader 提供读服务之前, 或创建外部检查点之前.
+//
+// 不认识 barrier 的旧版本节点按 UnknownEntryPolicy 处理, 见 WithUnknownEntryPolicy.
+func NewBarrierEntry() LogEntry {
+	return LogEntry{Type: logEntryTypeBarrier}
+}
+
+// proposable 是否可以通过 ProposeEntry 提交
+func (t LogEntryType) proposable() bool {
+	return t == logEntryTypeNoop || t == logEntryTypeBarrier
+}
+
+// ProposeEntry 提交 NewNoopEntry 或 NewBarrierEntry 创建的系统 log entry, 返回其索引
+//
+// 与 Handle 相同, 默认在 Leader 应用到该 log entry 之后返回,
+// ctx 中的 AckCommitted 使其在 commit 之后返回, 见 WithAcknowledgement.
+// 提交 command 使用 Propose, 变更配置使用 ChangeConfig, 其他类型返回 ErrEntryNotProposable.
+func (r *raft) ProposeEntry(ctx context.Context, entry LogEntry) (index uint64, err error) {
+	if !entry.Type.proposable() {
+		return 0, fmt.Errorf("%w: %s", ErrEntryNotProposable, entry.Type)
+	}
+	l, ok := r.GetServer().(*leader)
+	if !ok {
+		return 0, r.notLeader()
+	}
+	return l.proposeEntry(ctx, entry)
+}
+
+func (l *leader) proposeEntry(ctx context.Context, entry LogEntry) (index uint64, err error) {
+	ctx, end := l.writeTracer.Start(ctx, SpanPropose, Label{Name: "raft.entry", Value: entry.Type.String()})
+	defer func() { end(err) }()
+	if l.proposalsPaused() {
+		return 0, ErrLeadershipTransferInProgress
+	}
+	if term, stale := l.staleTerm(); stale {
+		return 0, l.staleLeaderError(term)
+	}
+
+	entry.Term = l.GetCurrentTerm()
+	entry.AppendTime = time.Now()
+	entry.Proposer = ProposerFromContext(ctx)
+	entries := []LogEntry{entry}
+	l.injectTraceContext(ctx, entries)
+	_, endAppend := l.writeTracer.Start(ctx, SpanAppend)
+	index, err = l.AppendEntry(entries[0])
+	endAppend(err)
+	if err != nil {
+		return 0, err
+	}
+	entries[0].Index = index
+	err = l.commitAppended(ctx, entries)
+	if err != nil {
+		return index, err
+	}
+	if AcknowledgementFromContext(ctx) == AckCommitted {
+		l.notifyApply()
+		return index, nil
+	}
+	err = l.applyCommitted()
+	if err != nil {
+		return index, err
+	}
+	// a partial apply returns before reaching the entry
+	return index, l.waitApplied(ctx, index)
+}
+
+// applyBarrier barrier 只需与 command 依序单独应用, 应用时之前的 log entry 都已应用
+func (r *raft) applyBarrier(entry LogEntry) error {
+	return nil
+}
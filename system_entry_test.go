@@ -0,0 +1,81 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestProposeEntry(t *testing.T) {
+	// apply blocks until released
+	release := make(chan struct{})
+	fsm := &listFSM{}
+	apply := func(commands Commands) (int, error) {
+		<-release
+		return fsm.apply(commands)
+	}
+	r, err := New("propose-entry", "propose-entry", apply, nil, nil, WithDevMode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	go r.Run()
+	ctx := context.Background()
+
+	t.Run("noop", func(t *testing.T) {
+		index, err := r.ProposeEntry(WithAcknowledgement(ctx, AckCommitted), NewNoopEntry())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status := r.Stats(); status.CommitIndex < index {
+			t.Fatalf("expect no-op at %d committed but got commit index %d", index, status.CommitIndex)
+		}
+	})
+
+	t.Run("barrier", func(t *testing.T) {
+		err := r.Handle(WithAcknowledgement(ctx, AckCommitted), Command("a"), Command("b"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan uint64, 1)
+		go func() {
+			index, err := r.ProposeEntry(ctx, NewBarrierEntry())
+			if err != nil {
+				t.Error(err)
+			}
+			done <- index
+		}()
+		select {
+		case <-done:
+			t.Fatal("expect barrier waiting for preceding commands applied")
+		case <-time.After(20 * time.Millisecond):
+		}
+		close(release)
+		index := <-done
+		if got := fsm.get(); len(got) != 2 {
+			t.Fatalf("expect [a b] applied before barrier but got %v", got)
+		}
+		if lastApplied := r.Stats().LastApplied; lastApplied < index {
+			t.Fatalf("expect barrier at %d applied but got last applied %d", index, lastApplied)
+		}
+	})
+
+	t.Run("not proposable", func(t *testing.T) {
+		for _, entry := range []LogEntry{{Command: Command("a")}, {Type: logEntryTypeConfig}} {
+			if _, err := r.ProposeEntry(ctx, entry); !errors.Is(err, ErrEntryNotProposable) {
+				t.Errorf("expect %v for %s but got %v", ErrEntryNotProposable, entry.Type, err)
+			}
+		}
+	})
+
+	t.Run("not leader", func(t *testing.T) {
+		follower, err := New("propose-entry-follower", "propose-entry-follower", nil, &memoryStore{}, &memoryLog{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := follower.ProposeEntry(ctx, NewBarrierEntry()); !errors.Is(err, ErrIsNotLeader) {
+			t.Fatalf("expect %v but got %v", ErrIsNotLeader, err)
+		}
+	})
+}
@@ -0,0 +1,159 @@
+package raft
+
+// TermBoundary 同一 term 的 log entry 所在的区间 [FirstIndex, LastIndex]
+type TermBoundary struct {
+	Term       uint64
+	FirstIndex uint64
+	LastIndex  uint64
+}
+
+// TermBoundaries 获取 log 中每个 term 的区间, 按 term 递增排序
+func (r *raft) TermBoundaries() ([]TermBoundary, error) {
+	return termBoundaries(r.Log)
+}
+
+// FirstIndexOfTerm 获取 term 的第一个 log entry 的索引, log 中没有该 term 时 ok 为 false
+func (r *raft) FirstIndexOfTerm(term uint64) (index uint64, ok bool, err error) {
+	return firstIndexOfTerm(r.Log, term)
+}
+
+// log 中 entry 的 term 随索引单调不减, 因此 term 的边界可以通过二分查找得到,
+// 每个 term 只需 O(log n) 次 Get, 无需扫描整个 log.
+// 查找从 FirstIndex 开始, 压缩丢弃的 log entry 不参与查找.
+
+// logBounds log 中保留的 log entry 的索引区间 [first, last], 没有时 ok 为 false
+func logBounds(log Log) (first, last uint64, ok bool, err error) {
+	last, _, err = log.Last()
+	if err != nil || last == 0 {
+		return 0, 0, false, err
+	}
+	first, err = log.FirstIndex()
+	if err != nil || first > last {
+		return 0, 0, false, err
+	}
+	return first, last, true, nil
+}
+
+// searchLog 返回 [lo, hi] 中第一个满足 f(term) 的索引, 都不满足时返回 hi+1
+// f 须随 term 单调: 某个索引满足时, 之后的索引也都满足
+func searchLog(log Log, lo, hi uint64, f func(term uint64) bool) (uint64, error) {
+	hi++
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		term, err := log.Get(mid)
+		if err != nil {
+			return 0, err
+		}
+		if f(term) {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return lo, nil
+}
+
+// firstIndexOfTerm term 的第一个 log entry 的索引
+func firstIndexOfTerm(log Log, term uint64) (uint64, bool, error) {
+	firstIndex, lastIndex, ok, err := logBounds(log)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	index, err := searchLog(log, firstIndex, lastIndex, func(t uint64) bool { return t >= term })
+	if err != nil || index > lastIndex {
+		return 0, false, err
+	}
+	t, err := log.Get(index)
+	if err != nil || t != term {
+		return 0, false, err
+	}
+	return index, true, nil
+}
+
+// lastIndexOfTerm term 的最后一个 log entry 的索引
+func lastIndexOfTerm(log Log, term uint64) (uint64, bool, error) {
+	firstIndex, lastIndex, ok, err := logBounds(log)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	index, err := searchLog(log, firstIndex, lastIndex, func(t uint64) bool { return t > term })
+	if err != nil || index <= firstIndex {
+		return 0, false, err
+	}
+	t, err := log.Get(index - 1)
+	if err != nil || t != term {
+		return 0, false, err
+	}
+	return index - 1, true, nil
+}
+
+// termBoundaries log 中每个 term 的区间
+func termBoundaries(log Log) ([]TermBoundary, error) {
+	firstIndex, lastIndex, ok, err := logBounds(log)
+	if err != nil || !ok {
+		return nil, err
+	}
+	var boundaries []TermBoundary
+	for first := firstIndex; first <= lastIndex; {
+		term, err := log.Get(first)
+		if err != nil {
+			return nil, err
+		}
+		next, err := searchLog(log, first, lastIndex, func(t uint64) bool { return t > term })
+		if err != nil {
+			return nil, err
+		}
+		boundaries = append(boundaries, TermBoundary{
+			Term:       term,
+			FirstIndex: first,
+			LastIndex:  next - 1,
+		})
+		first = next
+	}
+	return boundaries, nil
+}
+
+// fillConflictHint Follower 的 log 与 prevLogIndex 不匹配时, 告知 Leader 冲突的位置,
+// 使 Leader 可以跳过整个冲突的 term, 而不是逐个递减 nextIndex
+func (s *rpcService) fillConflictHint(prevLogIndex uint64, results *AppendEntriesResults) error {
+	lastIndex, _, err := s.Last()
+	if err != nil {
+		return err
+	}
+	if lastIndex < prevLogIndex {
+		results.ConflictIndex = lastIndex + 1
+		return nil
+	}
+	term, err := s.Get(prevLogIndex)
+	if err != nil {
+		return err
+	}
+	index, ok, err := firstIndexOfTerm(s.Log, term)
+	if err != nil || !ok {
+		return err
+	}
+	results.ConflictTerm, results.ConflictIndex = term, index
+	return nil
+}
+
+// conflictNextIndex 根据 Follower 的冲突提示计算下一次尝试的 nextIndex
+//
+// 若 Leader 的 log 中有 ConflictTerm, 从该 term 的最后一个 entry 之后开始,
+// 否则从 ConflictIndex 开始. 没有提示(旧版本 Follower)时递减 nextIndex.
+func (l *leader) conflictNextIndex(nextIndex uint64, results AppendEntriesResults) uint64 {
+	fallback := nextIndex - 1
+	if results.ConflictIndex == 0 {
+		return fallback
+	}
+	next := results.ConflictIndex
+	if results.ConflictTerm != 0 {
+		last, ok, err := lastIndexOfTerm(l.Log, results.ConflictTerm)
+		if err == nil && ok {
+			next = last + 1
+		}
+	}
+	if next == 0 || next >= nextIndex {
+		return fallback
+	}
+	return next
+}
@@ -0,0 +1,115 @@
+package raft
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTermBoundaries(t *testing.T) {
+	log := &memoryLog{}
+	for _, term := range []uint64{1, 1, 2, 4, 4, 4, 5} {
+		err := log.Append(LogEntry{Term: term})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("boundaries", func(t *testing.T) {
+		got, err := termBoundaries(log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := []TermBoundary{
+			{Term: 1, FirstIndex: 1, LastIndex: 2},
+			{Term: 2, FirstIndex: 3, LastIndex: 3},
+			{Term: 4, FirstIndex: 4, LastIndex: 6},
+			{Term: 5, FirstIndex: 7, LastIndex: 7},
+		}
+		if !reflect.DeepEqual(got, expect) {
+			t.Errorf("expect %+v but got %+v", expect, got)
+		}
+	})
+	t.Run("first and last index of term", func(t *testing.T) {
+		cases := []struct {
+			term        uint64
+			first, last uint64
+			ok          bool
+		}{
+			{term: 1, first: 1, last: 2, ok: true},
+			{term: 3, ok: false},
+			{term: 4, first: 4, last: 6, ok: true},
+			{term: 6, ok: false},
+		}
+		for _, c := range cases {
+			first, ok, err := firstIndexOfTerm(log, c.term)
+			if err != nil || ok != c.ok || first != c.first {
+				t.Errorf("term %d: expect first index %d(%v) but got %d(%v)", c.term, c.first, c.ok, first, ok)
+			}
+			last, ok, err := lastIndexOfTerm(log, c.term)
+			if err != nil || ok != c.ok || last != c.last {
+				t.Errorf("term %d: expect last index %d(%v) but got %d(%v)", c.term, c.last, c.ok, last, ok)
+			}
+		}
+	})
+	t.Run("compacted log", func(t *testing.T) {
+		log := &memoryLog{}
+		for _, term := range []uint64{1, 1, 2, 4, 4, 4, 5} {
+			err := log.Append(LogEntry{Term: term})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := log.Compact(4)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := termBoundaries(log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := []TermBoundary{
+			{Term: 4, FirstIndex: 5, LastIndex: 6},
+			{Term: 5, FirstIndex: 7, LastIndex: 7},
+		}
+		if !reflect.DeepEqual(got, expect) {
+			t.Errorf("expect %+v but got %+v", expect, got)
+		}
+
+		cases := []struct {
+			term        uint64
+			first, last uint64
+			ok          bool
+		}{
+			{term: 1, ok: false},
+			{term: 2, ok: false},
+			{term: 4, first: 5, last: 6, ok: true},
+			{term: 5, first: 7, last: 7, ok: true},
+		}
+		for _, c := range cases {
+			first, ok, err := firstIndexOfTerm(log, c.term)
+			if err != nil || ok != c.ok || first != c.first {
+				t.Errorf("term %d: expect first index %d(%v) but got %d(%v)", c.term, c.first, c.ok, first, ok)
+			}
+			last, ok, err := lastIndexOfTerm(log, c.term)
+			if err != nil || ok != c.ok || last != c.last {
+				t.Errorf("term %d: expect last index %d(%v) but got %d(%v)", c.term, c.last, c.ok, last, ok)
+			}
+		}
+
+		err = log.Compact(7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err = termBoundaries(log)
+		if err != nil || got != nil {
+			t.Errorf("expect no boundaries after compacting all entries but got %+v, %v", got, err)
+		}
+	})
+	t.Run("empty log", func(t *testing.T) {
+		got, err := termBoundaries(&memoryLog{})
+		if err != nil || got != nil {
+			t.Errorf("expect no boundaries but got %+v, %v", got, err)
+		}
+	})
+}
@@ -0,0 +1,223 @@
+package raft
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// ticker 选举与心跳定时器
+//
+// 默认由 time.Ticker 驱动; MultiRaft 中的 raft 组共用一个 tickerPool,
+// 由一个 goroutine 驱动所有组的定时器, 见 newTicker.
+type ticker struct {
+	// C 到期时发送当前时间, 容量为 1, 未及时接收的到期被丢弃
+	C <-chan time.Time
+
+	reset func(d time.Duration)
+	stop  func()
+}
+
+func newTimeTicker(d time.Duration) *ticker {
+	t := time.NewTicker(d)
+	return &ticker{C: t.C, reset: t.Reset, stop: t.Stop}
+}
+
+// Reset 停止定时器, 并以 d 为周期重新开始
+func (t *ticker) Reset(d time.Duration) {
+	t.reset(d)
+}
+
+// Stop 停止定时器, 不关闭 C
+func (t *ticker) Stop() {
+	t.stop()
+}
+
+// newTicker 创建周期为 d 的定时器, 提供了 tickerPool 时由其驱动
+func (r *raft) newTicker(d time.Duration) *ticker {
+	if r.tickers != nil {
+		return r.tickers.newTicker(d)
+	}
+	return newTimeTicker(d)
+}
+
+// now 当前时间, 提供了 tickerPool 时使用其时钟
+//
+// 选举, 心跳, 租约等判断依赖的时间都应由此获取, 模拟中它们随虚拟时间推进, 见 Simulation.
+func (r *raft) now() time.Time {
+	if r.tickers != nil {
+		return r.tickers.now()
+	}
+	return time.Now()
+}
+
+// tickerPool 由一个 goroutine 驱动的一组定时器
+//
+// 定时器按下一次到期时间保存在最小堆中, goroutine 只等待最早的到期,
+// 数百个 raft 组的定时器也只需要一个 runtime timer 与一个 goroutine.
+type tickerPool struct {
+	// now 时钟, 默认为 time.Now, 模拟中为虚拟时间
+	now func() time.Time
+
+	mux     sync.Mutex
+	tickers tickerHeap
+
+	// wake 最早的到期时间变化时通知 goroutine, 容量为 1
+	wake chan struct{}
+	once sync.Once
+	done chan struct{}
+}
+
+func newTickerPool() *tickerPool {
+	p := newManualTickerPool(time.Now)
+	go p.run()
+	return p
+}
+
+// newManualTickerPool 创建以 now 为时钟的 tickerPool, 不启动 goroutine, 由调用方 fire
+func newManualTickerPool(now func() time.Time) *tickerPool {
+	return &tickerPool{
+		now:  now,
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+}
+
+// pooledTicker tickerPool 中的定时器
+type pooledTicker struct {
+	c      chan time.Time
+	period time.Duration
+	next   time.Time
+	// index 在堆中的位置, 已停止时为 -1
+	index int
+}
+
+func (p *tickerPool) newTicker(d time.Duration) *ticker {
+	if d <= 0 {
+		panic("non-positive interval for ticker")
+	}
+	t := &pooledTicker{c: make(chan time.Time, 1), index: -1}
+	p.reset(t, d)
+	return &ticker{
+		C:     t.c,
+		reset: func(d time.Duration) { p.reset(t, d) },
+		stop:  func() { p.stop(t) },
+	}
+}
+
+func (p *tickerPool) reset(t *pooledTicker, d time.Duration) {
+	if d <= 0 {
+		panic("non-positive interval for ticker")
+	}
+	p.mux.Lock()
+	t.period = d
+	t.next = p.now().Add(d)
+	if t.index < 0 {
+		heap.Push(&p.tickers, t)
+	} else {
+		heap.Fix(&p.tickers, t.index)
+	}
+	p.mux.Unlock()
+	p.notify()
+}
+
+func (p *tickerPool) stop(t *pooledTicker) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if t.index >= 0 {
+		heap.Remove(&p.tickers, t.index)
+	}
+}
+
+func (p *tickerPool) notify() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// close 停止驱动所有定时器
+func (p *tickerPool) close() {
+	p.once.Do(func() { close(p.done) })
+}
+
+func (p *tickerPool) run() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		wait := p.fire(p.now())
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-p.done:
+			return
+		case <-p.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// deadline 最早的到期时间, 没有运行中的定时器时 ok 为 false
+func (p *tickerPool) deadline() (next time.Time, ok bool) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if len(p.tickers) == 0 {
+		return time.Time{}, false
+	}
+	return p.tickers[0].next, true
+}
+
+// fire 向到期的定时器发送 now, 返回距下一次到期的时间
+func (p *tickerPool) fire(now time.Time) time.Duration {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	for len(p.tickers) > 0 {
+		t := p.tickers[0]
+		if t.next.After(now) {
+			return t.next.Sub(now)
+		}
+		select {
+		case t.c <- now:
+		default:
+			// like time.Ticker, drop ticks for slow receivers
+		}
+		t.next = t.next.Add(t.period)
+		if !t.next.After(now) {
+			t.next = now.Add(t.period)
+		}
+		heap.Fix(&p.tickers, 0)
+	}
+	return time.Hour
+}
+
+// tickerHeap 按下一次到期时间排序的最小堆, 实现 heap.Interface
+type tickerHeap []*pooledTicker
+
+func (h tickerHeap) Len() int           { return len(h) }
+func (h tickerHeap) Less(i, j int) bool { return h[i].next.Before(h[j].next) }
+
+func (h tickerHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *tickerHeap) Push(x interface{}) {
+	t := x.(*pooledTicker)
+	t.index = len(*h)
+	*h = append(*h, t)
+}
+
+func (h *tickerHeap) Pop() interface{} {
+	old := *h
+	t := old[len(old)-1]
+	old[len(old)-1] = nil
+	t.index = -1
+	*h = old[:len(old)-1]
+	return t
+}
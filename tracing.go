@@ -0,0 +1,97 @@
+package raft
+
+import (
+	"context"
+	"strconv"
+)
+
+// 写入各阶段的 span 名称
+const (
+	// SpanPropose Leader 处理一次 Handle, 包含之后的各个阶段
+	SpanPropose = "raft.propose"
+	// SpanAppend Leader 将 log entry 追加到本地 log
+	SpanAppend = "raft.append"
+	// SpanReplicate Leader 等待 log entry 复制到多数派
+	SpanReplicate = "raft.replicate"
+	// SpanCommit Leader 更新 commitIndex
+	SpanCommit = "raft.commit"
+	// SpanFollowerAppend Follower 处理 AppendEntries, 追加收到的 log entry
+	SpanFollowerAppend = "raft.follower.append"
+	// SpanApply 各节点将 log entry 应用到状态机
+	SpanApply = "raft.apply"
+)
+
+// ExtensionTraceContext 保存写入的 trace 上下文的 log entry 扩展字段, 见 WriteTracer.Inject
+const ExtensionTraceContext = "raft.trace"
+
+// WriteTracer 跟踪一次写入 propose → append → replicate → commit → apply 的各个阶段
+//
+// Leader 在 Handle 的 ctx 之下创建 SpanPropose 及其中各阶段的 span;
+// Inject 编码的 trace 上下文随 log entry 复制到 Follower, 各节点追加与应用该 log entry 时
+// 在 Extract 恢复的 trace 上下文之下创建 span, 从而在整个集群中追踪一次慢写入的耗时.
+// 基于 OpenTelemetry 的实现见 raftotel.
+type WriteTracer interface {
+	// Start 在 ctx 中的 span 之下开始名为 name 的 span,
+	// 返回包含新 span 的 ctx 与结束 span 的函数
+	Start(ctx context.Context, name string, labels ...Label) (context.Context, func(err error))
+	// Inject 编码 ctx 中的 trace 上下文, 没有时返回 nil
+	Inject(ctx context.Context) []byte
+	// Extract 将 Inject 编码的 trace 上下文恢复到 ctx 中
+	Extract(ctx context.Context, carrier []byte) context.Context
+}
+
+// noopWriteTracer 不创建 span
+type noopWriteTracer struct{}
+
+func (noopWriteTracer) Start(ctx context.Context, _ string, _ ...Label) (context.Context, func(error)) {
+	return ctx, func(error) {}
+}
+
+func (noopWriteTracer) Inject(context.Context) []byte {
+	return nil
+}
+
+func (noopWriteTracer) Extract(ctx context.Context, _ []byte) context.Context {
+	return ctx
+}
+
+// injectTraceContext 将 ctx 中的 trace 上下文附加到 entries 上
+func (r *raft) injectTraceContext(ctx context.Context, entries []LogEntry) {
+	carrier := r.writeTracer.Inject(ctx)
+	if len(carrier) == 0 {
+		return
+	}
+	for i := range entries {
+		if entries[i].Extensions == nil {
+			entries[i].Extensions = make(map[string][]byte)
+		}
+		entries[i].Extensions[ExtensionTraceContext] = carrier
+	}
+}
+
+// traceEntries 为 entries 中附加了 trace 上下文的每次写入开始名为 name 的 span, 返回结束这些 span 的函数
+//
+// 一次 Handle 提交的多个 command 共享同一个 span.
+func (r *raft) traceEntries(name string, entries []LogEntry, labels ...Label) (end func(err error)) {
+	var ends []func(error)
+	traced := make(map[string]bool)
+	for _, entry := range entries {
+		carrier := entry.Extensions[ExtensionTraceContext]
+		if len(carrier) == 0 || traced[string(carrier)] {
+			continue
+		}
+		traced[string(carrier)] = true
+		ctx := r.writeTracer.Extract(context.Background(), carrier)
+		spanLabels := append([]Label{
+			{Name: "raft.id", Value: string(r.Id())},
+			{Name: "raft.index", Value: strconv.FormatUint(entry.Index, 10)},
+		}, labels...)
+		_, end := r.writeTracer.Start(ctx, name, spanLabels...)
+		ends = append(ends, end)
+	}
+	return func(err error) {
+		for _, end := range ends {
+			end(err)
+		}
+	}
+}
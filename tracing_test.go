@@ -0,0 +1,147 @@
+package raft
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// traceKey ctx 中 trace id 的 key
+type traceKey struct{}
+
+// recordingTracer 记录 span, 以 ctx 中的 trace id 作为 trace 上下文
+type recordingTracer struct {
+	mux   sync.Mutex
+	spans []recordedSpan
+}
+
+type recordedSpan struct {
+	name    string
+	traceID string
+	labels  []Label
+	ended   bool
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, labels ...Label) (context.Context, func(error)) {
+	traceID, _ := ctx.Value(traceKey{}).(string)
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.spans = append(t.spans, recordedSpan{name: name, traceID: traceID, labels: labels})
+	i := len(t.spans) - 1
+	return ctx, func(error) {
+		t.mux.Lock()
+		defer t.mux.Unlock()
+		t.spans[i].ended = true
+	}
+}
+
+func (t *recordingTracer) Inject(ctx context.Context) []byte {
+	traceID, _ := ctx.Value(traceKey{}).(string)
+	return []byte(traceID)
+}
+
+func (t *recordingTracer) Extract(ctx context.Context, carrier []byte) context.Context {
+	return context.WithValue(ctx, traceKey{}, string(carrier))
+}
+
+// ended traceID 中已结束的 span 名称
+func (t *recordingTracer) ended(traceID string) map[string]bool {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	names := make(map[string]bool)
+	for _, span := range t.spans {
+		if span.traceID == traceID && span.ended {
+			names[span.name] = true
+		}
+	}
+	return names
+}
+
+func TestWriteTracer(t *testing.T) {
+	leaderTracer, followerTracer := &recordingTracer{}, &recordingTracer{}
+	leader, err := New("trace-leader", "trace-leader", (&listFSM{}).apply, nil, nil,
+		WithDevMode(), WithWriteTracer(leaderTracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leader.Stop()
+	go leader.Run()
+	follower := runLoopbackFollower(t, "trace-follower", WithWriteTracer(followerTracer))
+	defer follower.Stop()
+	if err := leader.AddVoter(context.Background(), follower.Id(), follower.Addr()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.WithValue(context.Background(), traceKey{}, "slow-write")
+	if err := leader.Handle(ctx, Command("a"), Command("b")); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("leader", func(t *testing.T) {
+		spans := leaderTracer.ended("slow-write")
+		for _, name := range []string{SpanPropose, SpanAppend, SpanReplicate, SpanCommit, SpanApply} {
+			if !spans[name] {
+				t.Errorf("expect span %s but got %v", name, spans)
+			}
+		}
+		leaderTracer.mux.Lock()
+		defer leaderTracer.mux.Unlock()
+		var applies int
+		for _, span := range leaderTracer.spans {
+			if span.name == SpanApply {
+				applies++
+			}
+		}
+		if applies != 1 {
+			t.Errorf("expect commands of a proposal applied in 1 span but got %d", applies)
+		}
+	})
+
+	t.Run("follower", func(t *testing.T) {
+		// followers learn the commit index from the next AppendEntries
+		if err := leader.Handle(context.Background(), Command("c")); err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(time.Second)
+		for {
+			spans := followerTracer.ended("slow-write")
+			if spans[SpanFollowerAppend] && spans[SpanApply] {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expect follower append and apply spans but got %v", spans)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		followerTracer.mux.Lock()
+		defer followerTracer.mux.Unlock()
+		for _, span := range followerTracer.spans {
+			if span.name != SpanFollowerAppend {
+				continue
+			}
+			if !includeLabel(span.labels, Label{Name: "raft.leader", Value: string(leader.Id())}) {
+				t.Errorf("expect leader label but got %v", span.labels)
+			}
+		}
+	})
+
+	t.Run("untraced", func(t *testing.T) {
+		leaderTracer.mux.Lock()
+		defer leaderTracer.mux.Unlock()
+		for _, span := range leaderTracer.spans {
+			if span.name == SpanApply && span.traceID == "" {
+				t.Errorf("expect no apply span without trace context but got %+v", span)
+			}
+		}
+	})
+}
+
+func includeLabel(labels []Label, label Label) bool {
+	for _, l := range labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
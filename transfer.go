@@ -0,0 +1,385 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrTransferTargetInvalid = errors.New("err: leadership transfer target isn't a voting member")
+	ErrTransferNotSupported  = errors.New("err: leadership transfer target doesn't support TimeoutNow")
+	ErrTransferRejected      = errors.New("err: leadership transfer rejected by target")
+
+	ErrTimeoutNowNotSupported = errors.New("err: rpc doesn't support TimeoutNow")
+
+	ErrLeadershipTransferInProgress = errors.New("err: leadership transfer in progress, proposals are paused")
+)
+
+// PeerProgress leader 记录的 peer 日志复制进度
+type PeerProgress struct {
+	NextIndex  uint64
+	MatchIndex uint64
+}
+
+// TimeoutNowCaller 可由 RPC 实现, 发送 TimeoutNow 使 target 立即发起选举
+//
+// 未实现时 TransferLeadership 在 target 的日志追上后退位, 由 target 在选举超时后当选,
+// 见 leader.transferLeadership.
+type TimeoutNowCaller interface {
+	CallTimeoutNow(addr RaftAddr, args TimeoutNowArgs) (TimeoutNowResults, error)
+}
+
+// TimeoutNowService 可由 RPCService 实现, 处理 TimeoutNow
+// raft.New 创建的 RPCService 均已实现
+type TimeoutNowService interface {
+	TimeoutNow(args TimeoutNowArgs, results *TimeoutNowResults) error
+}
+
+// ServeTimeoutNow 由 service 处理 TimeoutNow, 供传输层转发请求
+// service 未实现 TimeoutNowService 时返回 ErrTimeoutNowNotSupported
+func ServeTimeoutNow(service RPCService, args TimeoutNowArgs, results *TimeoutNowResults) error {
+	s, ok := service.(TimeoutNowService)
+	if !ok {
+		return ErrTimeoutNowNotSupported
+	}
+	return s.TimeoutNow(args, results)
+}
+
+var _ TimeoutNowService = (*rpcService)(nil)
+
+var _ rpcArgs = TimeoutNowArgs{}
+
+// TimeoutNowArgs
+type TimeoutNowArgs struct {
+	// highest protocol version supported by leader
+	ProtocolVersion ProtocolVersion
+	// raft group the request is routed to,
+	// empty outside of MultiRaft
+	Group GroupId
+
+	// leader’s term
+	Term uint64
+	// leader transferring leadership
+	LeaderId RaftId
+
+	// leader's replication progress of each peer,
+	// so that the new leader can start replication
+	// from accurate positions
+	Progress map[RaftId]PeerProgress
+}
+
+func (TimeoutNowArgs) getType() rpcArgsType {
+	return rpcArgsTypeTimeoutNowArgs
+}
+
+func (a TimeoutNowArgs) getTerm() uint64 {
+	return a.Term
+}
+
+var _ rpcArgs = TimeoutNowResults{}
+
+// TimeoutNowResults
+type TimeoutNowResults struct {
+	// highest protocol version supported by target
+	ProtocolVersion ProtocolVersion
+
+	// currentTerm
+	Term uint64
+	// true means target will start an election immediately
+	Success bool
+}
+
+func (TimeoutNowResults) getType() rpcArgsType {
+	return rpcArgsTypeTimeoutNowResults
+}
+
+func (r TimeoutNowResults) getTerm() uint64 {
+	return r.Term
+}
+
+// TimeoutNow 实现 TimeoutNow RPC
+//
+// Invoked by leader to transfer leadership (§3.10):
+// the target starts an election immediately, as if its election timer had elapsed.
+func (s *rpcService) TimeoutNow(args TimeoutNowArgs, results *TimeoutNowResults) error {
+	if s.quarantined(args.LeaderId, &results.Term) {
+		return nil
+	}
+	s.sendRPCArgs(args)
+	s.observeProtocolVersion(args.LeaderId, args.ProtocolVersion)
+	defer func() {
+		results.Term = s.GetCurrentTerm()
+		results.ProtocolVersion = s.versions.local
+	}()
+
+	if args.Term < s.GetCurrentTerm() {
+		return nil
+	}
+	if !s.configs.GetConfig().IncludePeer(s.Id()) {
+		return nil
+	}
+	if s.pressure.underPressure() {
+		s.log(LogElection).Info("Under sustained resource pressure, reject TimeoutNow")
+		return nil
+	}
+	s.transfer.receive(args.Term, args.Progress)
+	select {
+	case s.timeoutNow <- struct{}{}:
+	default:
+		// no-op
+	}
+	results.Success = true
+	return nil
+}
+
+// leadershipTransfer 记录由 TimeoutNow 发起的 leadership transfer
+type leadershipTransfer struct {
+	mux sync.Mutex
+	// term 发起 transfer 时 leader 的 term
+	term     uint64
+	progress map[RaftId]PeerProgress
+}
+
+func (t *leadershipTransfer) receive(term uint64, progress map[RaftId]PeerProgress) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.term, t.progress = term, progress
+}
+
+// inTerm 是否在 term 中收到了 TimeoutNow
+func (t *leadershipTransfer) inTerm(term uint64) bool {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	return t.term != 0 && t.term == term
+}
+
+// take 取出 term 中收到的复制进度
+func (t *leadershipTransfer) take(term uint64) (map[RaftId]PeerProgress, bool) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if t.term == 0 || t.term != term {
+		return nil, false
+	}
+	progress := t.progress
+	t.term, t.progress = 0, nil
+	return progress, true
+}
+
+// transferLeadership 将 leadership 转移给 target
+//
+// 先停止接受新的 proposal, 使 target 的日志与 leader 一致, 再发送 TimeoutNow 使其立即发起选举,
+// 同时携带各 peer 的复制进度, 新 leader 无需从 lastLogIndex+1 逐个探测.
+// transfer 失败时立即恢复接受 proposal, 成功时暂停到 target 当选, 最多一个最大选举超时.
+//
+// RPC 未实现 TimeoutNowCaller 时, leader 宣告 transfer 后退位: 其他 follower 只给 target 投票,
+// target 在选举超时后当选.
+func (l *leader) transferLeadership(ctx context.Context, target RaftId) (err error) {
+	config := l.configs.GetConfig()
+	if target == l.Id() || !config.IncludePeer(target) {
+		return ErrTransferTargetInvalid
+	}
+	var peer RaftPeer
+	for _, p := range config.GetPeers() {
+		if p.Id == target {
+			peer = p
+		}
+	}
+	if !l.peerSupports(target, featureTimeoutNow) {
+		return ErrTransferNotSupported
+	}
+
+	// the prior leader stops accepting client requests (§3.10)
+	l.pauseProposals(time.Time{})
+	defer func() {
+		if err != nil {
+			l.pauseProposals(l.now())
+			return
+		}
+		// target will be elected soon, if not, resume after an election timeout
+		l.pauseProposals(l.now().Add(l.electionTimeout[1]))
+	}()
+
+	// bring target's log up to date
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-l.Done():
+			return ErrStopped
+		default:
+			// no-op
+		}
+		lastLogIndex, _, err := l.Last()
+		if err != nil {
+			return err
+		}
+		if matchIndex, ok := l.matchIndex.Load(target); ok && matchIndex >= lastLogIndex {
+			break
+		}
+		_, err = l.replicate(peer.Id, peer.Addr)
+		if err != nil {
+			l.log(LogElection).Warn("Transfer leadership", "target", target, "err", err)
+		}
+	}
+
+	// announce the transfer, so that other followers withhold
+	// their votes from any candidate other than target
+	l.setTransferTarget(target)
+	defer l.setTransferTarget("")
+	l.withholding.observe(target, l.electionTimeout[1], l.now())
+	err = l.sendHeartbeats()
+	if err != nil {
+		return err
+	}
+
+	args := TimeoutNowArgs{
+		Term:     l.GetCurrentTerm(),
+		LeaderId: l.Id(),
+		Progress: l.progress(),
+	}
+	caller, ok := l.rpc.(TimeoutNowCaller)
+	if !ok {
+		caller = noTimeoutNow{}
+	}
+	l.log(LogElection).Info("-> TimeoutNow", "target", target)
+	results, err := caller.CallTimeoutNow(l.resolve(peer), args)
+	if errors.Is(err, ErrTimeoutNowNotSupported) {
+		l.log(LogElection).Info("RPC doesn't support TimeoutNow, step down for target", "target", target)
+		atomic.StoreInt32(&l.stepDown, 1)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	l.observeProtocolVersion(target, results.ProtocolVersion)
+	if !results.Success {
+		return ErrTransferRejected
+	}
+	return nil
+}
+
+// noTimeoutNow 未实现 TimeoutNowCaller 的 RPC
+type noTimeoutNow struct{}
+
+func (noTimeoutNow) CallTimeoutNow(RaftAddr, TimeoutNowArgs) (TimeoutNowResults, error) {
+	return TimeoutNowResults{}, ErrTimeoutNowNotSupported
+}
+
+// pauseProposals 在 until 之前拒绝新的 proposal, until 为零值时一直拒绝
+func (l *leader) pauseProposals(until time.Time) {
+	nanos := int64(math.MaxInt64)
+	if !until.IsZero() {
+		nanos = until.UnixNano()
+	}
+	atomic.StoreInt64(&l.pausedUntil, nanos)
+}
+
+// proposalsPaused 是否因 leadership transfer 拒绝新的 proposal
+func (l *leader) proposalsPaused() bool {
+	return l.now().UnixNano() < atomic.LoadInt64(&l.pausedUntil)
+}
+
+func (l *leader) setTransferTarget(target RaftId) {
+	l.transferTarget.Store(target)
+}
+
+// getTransferTarget 正在进行的 leadership transfer 的目标, 没有时为空
+func (l *leader) getTransferTarget() RaftId {
+	target, _ := l.transferTarget.Load().(RaftId)
+	return target
+}
+
+// voteWithholding 记录 Leader 告知的正在进行的 leadership transfer
+//
+// 在窗口期内只给 transfer 的目标投票, 防止第三个节点抢先当选使 transfer 失败.
+// 窗口期不超过一个最大选举超时, 目标未能当选时集群仍可正常选举.
+type voteWithholding struct {
+	mux    sync.Mutex
+	target RaftId
+	until  time.Time
+}
+
+// observe now 时根据 Leader 的 AppendEntries 更新窗口期
+// target 为空表示 transfer 已结束
+func (w *voteWithholding) observe(target RaftId, window time.Duration, now time.Time) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if target.isNil() {
+		w.target, w.until = "", time.Time{}
+		return
+	}
+	if target == w.target && now.Before(w.until) {
+		// 窗口期从第一次得知 transfer 开始计算
+		return
+	}
+	w.target, w.until = target, now.Add(window)
+}
+
+// withhold now 时是否拒绝给 candidate 投票
+func (w *voteWithholding) withhold(candidate RaftId, now time.Time) bool {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.target.isNil() || !now.Before(w.until) {
+		return false
+	}
+	return candidate != w.target
+}
+
+// progress 各 peer 的复制进度
+func (l *leader) progress() map[RaftId]PeerProgress {
+	progress := make(map[RaftId]PeerProgress)
+	l.nextIndex.Range(func(id RaftId, index uint64) bool {
+		p := progress[id]
+		p.NextIndex = index
+		progress[id] = p
+		return true
+	})
+	l.matchIndex.Range(func(id RaftId, index uint64) bool {
+		p := progress[id]
+		p.MatchIndex = index
+		progress[id] = p
+		return true
+	})
+	return progress
+}
+
+// warmStart 使用 transfer 时旧 leader 的复制进度初始化 nextIndex 与 matchIndex
+//
+// 只有在 TimeoutNow 之后的第一次选举中当选才使用,
+// 此时新 leader 的日志与旧 leader 一致, 旧 leader 记录的进度依然准确.
+func (l *leader) warmStart(lastLogIndex uint64) {
+	progress, ok := l.transfer.take(l.GetCurrentTerm() - 1)
+	if !ok {
+		return
+	}
+	for _, peer := range l.configs.GetConfig().GetPeers() {
+		p, ok := progress[peer.Id]
+		if !ok || peer.Id == l.Id() || p.NextIndex == 0 {
+			continue
+		}
+		nextIndex, matchIndex := p.NextIndex, p.MatchIndex
+		if nextIndex > lastLogIndex+1 {
+			nextIndex = lastLogIndex + 1
+		}
+		if matchIndex > lastLogIndex {
+			matchIndex = lastLogIndex
+		}
+		l.nextIndex.Store(peer.Id, nextIndex)
+		l.matchIndex.Store(peer.Id, matchIndex)
+	}
+	l.log(LogReplication).Debug("Warm start with transferred progress", "progress", progress)
+}
+
+// TransferLeadership 将 leadership 转移给 target
+// 返回时 target 已收到 TimeoutNow 并开始选举, RPC 不支持 TimeoutNow 时本节点已开始退位
+func (r *raft) TransferLeadership(ctx context.Context, target RaftId) error {
+	l, ok := r.GetServer().(*leader)
+	if !ok {
+		return r.notLeader()
+	}
+	return l.transferLeadership(ctx, target)
+}
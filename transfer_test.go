@@ -0,0 +1,123 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVoteWithholding(t *testing.T) {
+	var w voteWithholding
+	if w.withhold("a", time.Now()) {
+		t.Error("expect not withholding before any transfer")
+	}
+
+	t.Run("window", func(t *testing.T) {
+		w.observe("b", 50*time.Millisecond, time.Now())
+		if !w.withhold("a", time.Now()) {
+			t.Error("expect withholding vote from non-target candidate")
+		}
+		if w.withhold("b", time.Now()) {
+			t.Error("expect not withholding vote from target")
+		}
+		// repeated heartbeats don't extend the window
+		time.Sleep(30 * time.Millisecond)
+		w.observe("b", 50*time.Millisecond, time.Now())
+		time.Sleep(30 * time.Millisecond)
+		if w.withhold("a", time.Now()) {
+			t.Error("expect not withholding after window expires")
+		}
+	})
+
+	t.Run("transfer ended", func(t *testing.T) {
+		w.observe("b", time.Second, time.Now())
+		w.observe("", time.Second, time.Now())
+		if w.withhold("a", time.Now()) {
+			t.Error("expect not withholding after transfer ended")
+		}
+	})
+}
+
+func TestTransferPausesProposals(t *testing.T) {
+	fsm := &listFSM{}
+	r, err := New("transfer-pause", "transfer-pause", fsm.apply, nil, nil, WithDevMode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, ok := r.(*raft).GetServer().(*leader)
+	if !ok {
+		t.Fatal("expect leader")
+	}
+	ctx := context.Background()
+
+	l.pauseProposals(time.Time{})
+	err = r.Handle(ctx, Command("a"))
+	if !errors.Is(err, ErrLeadershipTransferInProgress) {
+		t.Errorf("expect %v but got %v", ErrLeadershipTransferInProgress, err)
+	}
+	err = r.ChangeConfig(ctx, nil, []RaftId{"absent"})
+	if !errors.Is(err, ErrLeadershipTransferInProgress) {
+		t.Errorf("expect %v but got %v", ErrLeadershipTransferInProgress, err)
+	}
+
+	l.pauseProposals(time.Now())
+	err = r.Handle(ctx, Command("a"))
+	if err != nil {
+		t.Errorf("expect proposals resumed but got %v", err)
+	}
+
+	// proposals resume once the transfer failed
+	go r.Run()
+	defer r.Stop()
+	follower := runLoopbackFollower(t, "transfer-pause-follower")
+	err = r.AddVoter(ctx, follower.Id(), follower.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	follower.Stop()
+	err = r.TransferLeadership(ctx, follower.Id())
+	if err == nil {
+		t.Error("expect transfer to stopped follower failed")
+	}
+	if l.proposalsPaused() {
+		t.Error("expect proposals resumed after failed transfer")
+	}
+}
+
+// noTimeoutNowRPC 未实现 TimeoutNowCaller 的 RPC
+type noTimeoutNowRPC struct {
+	RPC
+}
+
+func TestTransferWithoutTimeoutNow(t *testing.T) {
+	rpc := noTimeoutNowRPC{RPC: newLoopbackRPC()}
+	if _, ok := RPC(rpc).(TimeoutNowCaller); ok {
+		t.Fatal("expect rpc without TimeoutNow")
+	}
+	r, err := New("transfer-fallback", "transfer-fallback", (&listFSM{}).apply, nil, nil, WithDevMode(), WithRPC(rpc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	go r.Run()
+
+	follower := runLoopbackFollower(t, "transfer-fallback-follower", WithElection(50*time.Millisecond, 100*time.Millisecond))
+	defer follower.Stop()
+	ctx := context.Background()
+	err = r.AddVoter(ctx, follower.Id(), follower.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.TransferLeadership(ctx, follower.Id())
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for !follower.IsLeader() || r.IsLeader() {
+		if time.Now().After(deadline) {
+			t.Fatal("expect follower became leader after leader stepped down")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
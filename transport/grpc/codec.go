@@ -0,0 +1,648 @@
+package grpc
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mind1949/raft"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// codecName 请求的 content-subtype, 即 application/grpc+raftpb
+//
+// 消息按 raft.proto 以 protobuf 编码, 直接编解码 raft 的 Args/Results,
+// 不需要生成代码, 也不占用默认的 proto codec.
+const codecName = "raftpb"
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
+
+var _ encoding.Codec = codec{}
+
+// codec 按 raft.proto 编解码 raft rpc 消息
+type codec struct{}
+
+func (codec) Name() string {
+	return codecName
+}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	var e encoder
+	switch m := v.(type) {
+	case *raft.AppendEntriesArgs:
+		e.appendEntriesArgs(m)
+	case *raft.AppendEntriesResults:
+		e.appendEntriesResults(m)
+	case *raft.RequestVoteArgs:
+		e.requestVoteArgs(m)
+	case *raft.RequestVoteResults:
+		e.requestVoteResults(m)
+	case *raft.TimeoutNowArgs:
+		e.timeoutNowArgs(m)
+	case *raft.TimeoutNowResults:
+		e.timeoutNowResults(m)
+	case *raft.InstallSnapshotArgs:
+		e.installSnapshotArgs(m)
+	case *raft.InstallSnapshotResults:
+		e.installSnapshotResults(m)
+	case *raft.PreVoteArgs:
+		e.preVoteArgs(m)
+	case *raft.PreVoteResults:
+		e.preVoteResults(m)
+	default:
+		return nil, fmt.Errorf("raftpb: unsupported message %T", v)
+	}
+	return e.b, nil
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	switch m := v.(type) {
+	case *raft.AppendEntriesArgs:
+		return decodeAppendEntriesArgs(data, m)
+	case *raft.AppendEntriesResults:
+		return decodeAppendEntriesResults(data, m)
+	case *raft.RequestVoteArgs:
+		return decodeRequestVoteArgs(data, m)
+	case *raft.RequestVoteResults:
+		return decodeRequestVoteResults(data, m)
+	case *raft.TimeoutNowArgs:
+		return decodeTimeoutNowArgs(data, m)
+	case *raft.TimeoutNowResults:
+		return decodeTimeoutNowResults(data, m)
+	case *raft.InstallSnapshotArgs:
+		return decodeInstallSnapshotArgs(data, m)
+	case *raft.InstallSnapshotResults:
+		return decodeInstallSnapshotResults(data, m)
+	case *raft.PreVoteArgs:
+		return decodePreVoteArgs(data, m)
+	case *raft.PreVoteResults:
+		return decodePreVoteResults(data, m)
+	default:
+		return fmt.Errorf("raftpb: unsupported message %T", v)
+	}
+}
+
+// encoder protobuf 编码, 与 proto3 相同, 零值字段不编码
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) uint(num protowire.Number, v uint64) {
+	if v == 0 {
+		return
+	}
+	e.b = protowire.AppendTag(e.b, num, protowire.VarintType)
+	e.b = protowire.AppendVarint(e.b, v)
+}
+
+func (e *encoder) int(num protowire.Number, v int64) {
+	e.uint(num, uint64(v))
+}
+
+func (e *encoder) bool(num protowire.Number, v bool) {
+	if v {
+		e.uint(num, 1)
+	}
+}
+
+func (e *encoder) bytes(num protowire.Number, v []byte) {
+	if len(v) == 0 {
+		return
+	}
+	e.b = protowire.AppendTag(e.b, num, protowire.BytesType)
+	e.b = protowire.AppendBytes(e.b, v)
+}
+
+func (e *encoder) string(num protowire.Number, v string) {
+	e.bytes(num, []byte(v))
+}
+
+func (e *encoder) time(num protowire.Number, t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	e.int(num, t.UnixNano())
+}
+
+// message 编码嵌套的消息, 空消息也需要编码以保留 repeated 字段的元素
+func (e *encoder) message(num protowire.Number, encode func(e *encoder)) {
+	var sub encoder
+	encode(&sub)
+	e.b = protowire.AppendTag(e.b, num, protowire.BytesType)
+	e.b = protowire.AppendBytes(e.b, sub.b)
+}
+
+// optional 编码非 repeated 的嵌套消息, 空消息不编码
+func (e *encoder) optional(num protowire.Number, encode func(e *encoder)) {
+	var sub encoder
+	encode(&sub)
+	e.bytes(num, sub.b)
+}
+
+func (e *encoder) logEntry(entry *raft.LogEntry) {
+	e.uint(1, entry.Index)
+	e.uint(2, entry.Term)
+	e.uint(3, uint64(entry.Type))
+	e.bytes(4, entry.Command)
+	e.time(5, entry.AppendTime)
+	e.string(6, entry.Proposer)
+	// map fields are encoded as repeated key/value messages, in key order
+	keys := make([]string, 0, len(entry.Extensions))
+	for key := range entry.Extensions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		key, value := key, entry.Extensions[key]
+		e.message(7, func(e *encoder) {
+			e.string(1, key)
+			e.bytes(2, value)
+		})
+	}
+}
+
+func (e *encoder) appendEntriesArgs(m *raft.AppendEntriesArgs) {
+	e.uint(1, uint64(m.ProtocolVersion))
+	e.uint(2, m.Term)
+	e.string(3, string(m.LeaderId))
+	e.string(4, string(m.LeaderAddr))
+	e.uint(5, m.PrevLogIndex)
+	e.uint(6, m.PrevLogTerm)
+	for i := range m.Entries {
+		entry := &m.Entries[i]
+		e.message(7, func(e *encoder) { e.logEntry(entry) })
+	}
+	e.uint(8, m.LeaderCommit)
+	e.bytes(9, m.Extension)
+	e.string(10, string(m.TransferTarget))
+	e.uint(11, m.ConfigIndex)
+	e.uint(12, m.ConfigChecksum)
+	e.string(13, string(m.Group))
+}
+
+func (e *encoder) appendEntriesResults(m *raft.AppendEntriesResults) {
+	e.uint(1, uint64(m.ProtocolVersion))
+	e.uint(2, m.Term)
+	e.bool(3, m.Success)
+	e.bool(4, m.UnderPressure)
+	e.uint(5, m.ConflictTerm)
+	e.uint(6, m.ConflictIndex)
+	e.uint(7, m.MatchIndex)
+	e.string(8, string(m.LeaderId))
+	e.string(9, string(m.LeaderAddr))
+}
+
+func (e *encoder) requestVoteArgs(m *raft.RequestVoteArgs) {
+	e.uint(1, uint64(m.ProtocolVersion))
+	e.uint(2, m.Term)
+	e.string(3, string(m.CandidateId))
+	e.uint(4, m.LastLogIndex)
+	e.uint(5, m.LastLogTerm)
+	e.bool(6, m.LeadershipTransfer)
+	e.string(7, string(m.Group))
+}
+
+func (e *encoder) requestVoteResults(m *raft.RequestVoteResults) {
+	e.uint(1, uint64(m.ProtocolVersion))
+	e.uint(2, m.Term)
+	e.bool(3, m.VoteGranted)
+	e.uint(4, m.CommitIndex)
+}
+
+func (e *encoder) timeoutNowArgs(m *raft.TimeoutNowArgs) {
+	e.uint(1, uint64(m.ProtocolVersion))
+	e.uint(2, m.Term)
+	e.string(3, string(m.LeaderId))
+	for id, progress := range m.Progress {
+		id, progress := id, progress
+		// map entry: key = 1, value = 2
+		e.message(4, func(e *encoder) {
+			e.string(1, string(id))
+			e.optional(2, func(e *encoder) {
+				e.uint(1, progress.NextIndex)
+				e.uint(2, progress.MatchIndex)
+			})
+		})
+	}
+	e.string(5, string(m.Group))
+}
+
+func (e *encoder) timeoutNowResults(m *raft.TimeoutNowResults) {
+	e.uint(1, uint64(m.ProtocolVersion))
+	e.uint(2, m.Term)
+	e.bool(3, m.Success)
+}
+
+func (e *encoder) snapshotMeta(m *raft.SnapshotMeta) {
+	e.string(1, m.Id)
+	e.uint(2, m.Index)
+	e.uint(3, m.Term)
+	e.bytes(4, m.Configuration)
+	e.uint(5, m.ConfigurationIndex)
+	e.int(6, m.Size)
+	e.string(7, m.KeyId)
+	e.time(8, m.CreateTime)
+}
+
+func (e *encoder) installSnapshotArgs(m *raft.InstallSnapshotArgs) {
+	e.uint(1, uint64(m.ProtocolVersion))
+	e.uint(2, m.Term)
+	e.string(3, string(m.LeaderId))
+	e.string(4, string(m.LeaderAddr))
+	e.optional(5, func(e *encoder) { e.snapshotMeta(&m.Meta) })
+	e.int(6, m.Offset)
+	e.bytes(7, m.Data)
+	e.bool(8, m.Done)
+	e.string(9, string(m.Group))
+}
+
+func (e *encoder) installSnapshotResults(m *raft.InstallSnapshotResults) {
+	e.uint(1, uint64(m.ProtocolVersion))
+	e.uint(2, m.Term)
+	e.bool(3, m.Success)
+}
+
+func (e *encoder) preVoteArgs(m *raft.PreVoteArgs) {
+	e.uint(1, uint64(m.ProtocolVersion))
+	e.uint(2, m.Term)
+	e.string(3, string(m.CandidateId))
+	e.uint(4, m.LastLogIndex)
+	e.uint(5, m.LastLogTerm)
+	e.string(6, string(m.Group))
+}
+
+func (e *encoder) preVoteResults(m *raft.PreVoteResults) {
+	e.uint(1, uint64(m.ProtocolVersion))
+	e.uint(2, m.Term)
+	e.bool(3, m.VoteGranted)
+	e.uint(4, m.CommitIndex)
+	e.uint(5, m.LastLogIndex)
+	e.uint(6, m.LastLogTerm)
+	e.bool(7, m.LogMatch)
+}
+
+// field 解码出的字段, varint 类型的值在 v 中, bytes 类型的值在 b 中
+type field struct {
+	num protowire.Number
+	v   uint64
+	b   []byte
+}
+
+func (f field) uint() uint64                  { return f.v }
+func (f field) int() int64                    { return int64(f.v) }
+func (f field) bool() bool                    { return f.v != 0 }
+func (f field) string() string                { return string(f.b) }
+func (f field) bytes() []byte                 { return append([]byte(nil), f.b...) }
+func (f field) version() raft.ProtocolVersion { return raft.ProtocolVersion(f.v) }
+
+func (f field) time() time.Time {
+	if f.v == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, f.int())
+}
+
+// decode 依次解码 b 中的字段, 跳过未知类型的字段, 以兼容新增的字段
+func decode(b []byte, fn func(f field) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		f := field{num: num}
+		switch typ {
+		case protowire.VarintType:
+			f.v, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			f.b, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if typ != protowire.VarintType && typ != protowire.BytesType {
+			continue
+		}
+		err := fn(f)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeLogEntry(b []byte, m *raft.LogEntry) error {
+	return decode(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.Index = f.uint()
+		case 2:
+			m.Term = f.uint()
+		case 3:
+			m.Type = raft.LogEntryType(f.uint())
+		case 4:
+			m.Command = f.bytes()
+		case 5:
+			m.AppendTime = f.time()
+		case 6:
+			m.Proposer = f.string()
+		case 7:
+			var key string
+			var value []byte
+			err := decode(f.b, func(f field) error {
+				switch f.num {
+				case 1:
+					key = f.string()
+				case 2:
+					value = f.bytes()
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if m.Extensions == nil {
+				m.Extensions = make(map[string][]byte)
+			}
+			m.Extensions[key] = value
+		}
+		return nil
+	})
+}
+
+func decodeAppendEntriesArgs(b []byte, m *raft.AppendEntriesArgs) error {
+	return decode(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.ProtocolVersion = f.version()
+		case 2:
+			m.Term = f.uint()
+		case 3:
+			m.LeaderId = raft.RaftId(f.string())
+		case 4:
+			m.LeaderAddr = raft.RaftAddr(f.string())
+		case 5:
+			m.PrevLogIndex = f.uint()
+		case 6:
+			m.PrevLogTerm = f.uint()
+		case 7:
+			var entry raft.LogEntry
+			err := decodeLogEntry(f.b, &entry)
+			if err != nil {
+				return err
+			}
+			m.Entries = append(m.Entries, entry)
+		case 8:
+			m.LeaderCommit = f.uint()
+		case 9:
+			m.Extension = f.bytes()
+		case 10:
+			m.TransferTarget = raft.RaftId(f.string())
+		case 11:
+			m.ConfigIndex = f.uint()
+		case 12:
+			m.ConfigChecksum = f.uint()
+		case 13:
+			m.Group = raft.GroupId(f.string())
+		}
+		return nil
+	})
+}
+
+func decodeAppendEntriesResults(b []byte, m *raft.AppendEntriesResults) error {
+	return decode(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.ProtocolVersion = f.version()
+		case 2:
+			m.Term = f.uint()
+		case 3:
+			m.Success = f.bool()
+		case 4:
+			m.UnderPressure = f.bool()
+		case 5:
+			m.ConflictTerm = f.uint()
+		case 6:
+			m.ConflictIndex = f.uint()
+		case 7:
+			m.MatchIndex = f.uint()
+		case 8:
+			m.LeaderId = raft.RaftId(f.string())
+		case 9:
+			m.LeaderAddr = raft.RaftAddr(f.string())
+		}
+		return nil
+	})
+}
+
+func decodeRequestVoteArgs(b []byte, m *raft.RequestVoteArgs) error {
+	return decode(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.ProtocolVersion = f.version()
+		case 2:
+			m.Term = f.uint()
+		case 3:
+			m.CandidateId = raft.RaftId(f.string())
+		case 4:
+			m.LastLogIndex = f.uint()
+		case 5:
+			m.LastLogTerm = f.uint()
+		case 6:
+			m.LeadershipTransfer = f.bool()
+		case 7:
+			m.Group = raft.GroupId(f.string())
+		}
+		return nil
+	})
+}
+
+func decodeRequestVoteResults(b []byte, m *raft.RequestVoteResults) error {
+	return decode(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.ProtocolVersion = f.version()
+		case 2:
+			m.Term = f.uint()
+		case 3:
+			m.VoteGranted = f.bool()
+		case 4:
+			m.CommitIndex = f.uint()
+		}
+		return nil
+	})
+}
+
+func decodePeerProgress(b []byte) (id raft.RaftId, progress raft.PeerProgress, err error) {
+	err = decode(b, func(f field) error {
+		switch f.num {
+		case 1:
+			id = raft.RaftId(f.string())
+		case 2:
+			return decode(f.b, func(f field) error {
+				switch f.num {
+				case 1:
+					progress.NextIndex = f.uint()
+				case 2:
+					progress.MatchIndex = f.uint()
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return id, progress, err
+}
+
+func decodeTimeoutNowArgs(b []byte, m *raft.TimeoutNowArgs) error {
+	return decode(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.ProtocolVersion = f.version()
+		case 2:
+			m.Term = f.uint()
+		case 3:
+			m.LeaderId = raft.RaftId(f.string())
+		case 4:
+			id, progress, err := decodePeerProgress(f.b)
+			if err != nil {
+				return err
+			}
+			if m.Progress == nil {
+				m.Progress = make(map[raft.RaftId]raft.PeerProgress)
+			}
+			m.Progress[id] = progress
+		case 5:
+			m.Group = raft.GroupId(f.string())
+		}
+		return nil
+	})
+}
+
+func decodeTimeoutNowResults(b []byte, m *raft.TimeoutNowResults) error {
+	return decode(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.ProtocolVersion = f.version()
+		case 2:
+			m.Term = f.uint()
+		case 3:
+			m.Success = f.bool()
+		}
+		return nil
+	})
+}
+
+func decodeSnapshotMeta(b []byte, m *raft.SnapshotMeta) error {
+	return decode(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.Id = f.string()
+		case 2:
+			m.Index = f.uint()
+		case 3:
+			m.Term = f.uint()
+		case 4:
+			m.Configuration = f.bytes()
+		case 5:
+			m.ConfigurationIndex = f.uint()
+		case 6:
+			m.Size = f.int()
+		case 7:
+			m.KeyId = f.string()
+		case 8:
+			m.CreateTime = f.time()
+		}
+		return nil
+	})
+}
+
+func decodeInstallSnapshotArgs(b []byte, m *raft.InstallSnapshotArgs) error {
+	return decode(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.ProtocolVersion = f.version()
+		case 2:
+			m.Term = f.uint()
+		case 3:
+			m.LeaderId = raft.RaftId(f.string())
+		case 4:
+			m.LeaderAddr = raft.RaftAddr(f.string())
+		case 5:
+			return decodeSnapshotMeta(f.b, &m.Meta)
+		case 6:
+			m.Offset = f.int()
+		case 7:
+			m.Data = f.bytes()
+		case 8:
+			m.Done = f.bool()
+		case 9:
+			m.Group = raft.GroupId(f.string())
+		}
+		return nil
+	})
+}
+
+func decodeInstallSnapshotResults(b []byte, m *raft.InstallSnapshotResults) error {
+	return decode(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.ProtocolVersion = f.version()
+		case 2:
+			m.Term = f.uint()
+		case 3:
+			m.Success = f.bool()
+		}
+		return nil
+	})
+}
+
+func decodePreVoteArgs(b []byte, m *raft.PreVoteArgs) error {
+	return decode(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.ProtocolVersion = f.version()
+		case 2:
+			m.Term = f.uint()
+		case 3:
+			m.CandidateId = raft.RaftId(f.string())
+		case 4:
+			m.LastLogIndex = f.uint()
+		case 5:
+			m.LastLogTerm = f.uint()
+		case 6:
+			m.Group = raft.GroupId(f.string())
+		}
+		return nil
+	})
+}
+
+func decodePreVoteResults(b []byte, m *raft.PreVoteResults) error {
+	return decode(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.ProtocolVersion = f.version()
+		case 2:
+			m.Term = f.uint()
+		case 3:
+			m.VoteGranted = f.bool()
+		case 4:
+			m.CommitIndex = f.uint()
+		case 5:
+			m.LastLogIndex = f.uint()
+		case 6:
+			m.LastLogTerm = f.uint()
+		case 7:
+			m.LogMatch = f.bool()
+		}
+		return nil
+	})
+}
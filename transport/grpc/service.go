@@ -0,0 +1,97 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/mind1949/raft"
+	grpclib "google.golang.org/grpc"
+)
+
+// serviceName raft.proto 中定义的服务
+const serviceName = "raft.Raft"
+
+// RegisterService 将 service 挂载到 server 上
+//
+// server 可以同时提供其他 gRPC 服务, 见 raft.WithExternalRPCServer.
+func RegisterService(server grpclib.ServiceRegistrar, service raft.RPCService) {
+	server.RegisterService(&serviceDesc, service)
+}
+
+var serviceDesc = grpclib.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*raft.RPCService)(nil),
+	Methods: []grpclib.MethodDesc{
+		{
+			MethodName: "AppendEntries",
+			Handler: unaryHandler("AppendEntries", func() interface{} { return new(raft.AppendEntriesArgs) },
+				func(service raft.RPCService, args interface{}) (interface{}, error) {
+					var results raft.AppendEntriesResults
+					err := service.AppendEntries(*args.(*raft.AppendEntriesArgs), &results)
+					return &results, err
+				}),
+		},
+		{
+			MethodName: "RequestVote",
+			Handler: unaryHandler("RequestVote", func() interface{} { return new(raft.RequestVoteArgs) },
+				func(service raft.RPCService, args interface{}) (interface{}, error) {
+					var results raft.RequestVoteResults
+					err := service.RequestVote(*args.(*raft.RequestVoteArgs), &results)
+					return &results, err
+				}),
+		},
+		{
+			MethodName: "TimeoutNow",
+			Handler: unaryHandler("TimeoutNow", func() interface{} { return new(raft.TimeoutNowArgs) },
+				func(service raft.RPCService, args interface{}) (interface{}, error) {
+					var results raft.TimeoutNowResults
+					err := raft.ServeTimeoutNow(service, *args.(*raft.TimeoutNowArgs), &results)
+					return &results, err
+				}),
+		},
+		{
+			MethodName: "InstallSnapshot",
+			Handler: unaryHandler("InstallSnapshot", func() interface{} { return new(raft.InstallSnapshotArgs) },
+				func(service raft.RPCService, args interface{}) (interface{}, error) {
+					var results raft.InstallSnapshotResults
+					err := service.InstallSnapshot(*args.(*raft.InstallSnapshotArgs), &results)
+					return &results, err
+				}),
+		},
+		{
+			MethodName: "PreVote",
+			Handler: unaryHandler("PreVote", func() interface{} { return new(raft.PreVoteArgs) },
+				func(service raft.RPCService, args interface{}) (interface{}, error) {
+					var results raft.PreVoteResults
+					err := service.PreVote(*args.(*raft.PreVoteArgs), &results)
+					return &results, err
+				}),
+		},
+	},
+	Metadata: "raft.proto",
+}
+
+// methodHandler 同 grpc.MethodDesc 的 Handler
+type methodHandler = func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpclib.UnaryServerInterceptor) (interface{}, error)
+
+// unaryHandler 解码 args 并调用 RPCService 的 method 方法
+func unaryHandler(method string, newArgs func() interface{},
+	call func(service raft.RPCService, args interface{}) (interface{}, error)) methodHandler {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpclib.UnaryServerInterceptor) (interface{}, error) {
+		args := newArgs()
+		err := dec(args)
+		if err != nil {
+			return nil, err
+		}
+		handler := func(ctx context.Context, args interface{}) (interface{}, error) {
+			return call(srv.(raft.RPCService), args)
+		}
+		if interceptor == nil {
+			return handler(ctx, args)
+		}
+		info := &grpclib.UnaryServerInfo{
+			Server:     srv,
+			FullMethod: "/" + serviceName + "/" + method,
+		}
+		return interceptor(ctx, args, info, handler)
+	}
+}
@@ -0,0 +1,201 @@
+// Package grpc 基于 gRPC 的 raft.RPC 实现
+//
+//	transport := grpc.New(grpc.WithDialOptions(grpclib.WithTransportCredentials(creds)))
+//	r, err := raft.New(id, addr, apply, store, log, raft.WithRPC(transport))
+//
+// 消息按 raft.proto 以 protobuf 编码. 与其他 gRPC 服务共用服务器时,
+// 使用 raft.WithExternalRPCServer 并通过 RegisterService 挂载:
+//
+//	r, err := raft.New(id, addr, apply, store, log, raft.WithRPC(transport), raft.WithExternalRPCServer())
+//	grpc.RegisterService(server, r.RPCService())
+//
+// 该包是独立的 module, 使用 raft 本身不需要引入 gRPC 依赖.
+package grpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mind1949/raft"
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+var ErrNotRegistered = errors.New("err: rpc service isn't registered")
+
+// defaultTimeout 每次调用的默认超时
+const defaultTimeout = 10 * time.Second
+
+// OptFn Transport 配置可选项
+type OptFn func(*opts)
+
+// WithServerOptions 创建 gRPC 服务器的选项, 如 TLS 证书
+func WithServerOptions(options ...grpclib.ServerOption) OptFn {
+	return func(o *opts) {
+		o.serverOptions = append(o.serverOptions, options...)
+	}
+}
+
+// WithDialOptions 连接 peer 的选项, 默认不加密
+func WithDialOptions(options ...grpclib.DialOption) OptFn {
+	return func(o *opts) {
+		o.dialOptions = append(o.dialOptions, options...)
+	}
+}
+
+// WithTimeout 每次调用的超时
+func WithTimeout(timeout time.Duration) OptFn {
+	return func(o *opts) {
+		o.timeout = timeout
+	}
+}
+
+type opts struct {
+	serverOptions []grpclib.ServerOption
+	dialOptions   []grpclib.DialOption
+	timeout       time.Duration
+}
+
+var (
+	_ raft.RPC              = (*Transport)(nil)
+	_ raft.TimeoutNowCaller = (*Transport)(nil)
+)
+
+// New 创建 Transport
+func New(optFns ...OptFn) *Transport {
+	o := &opts{
+		dialOptions: []grpclib.DialOption{grpclib.WithTransportCredentials(insecure.NewCredentials())},
+		timeout:     defaultTimeout,
+	}
+	for _, fn := range optFns {
+		fn(o)
+	}
+	return &Transport{
+		opts:  *o,
+		conns: make(map[raft.RaftAddr]*grpclib.ClientConn),
+	}
+}
+
+// Transport 实现 raft.RPC
+type Transport struct {
+	opts
+
+	// protect server, l and conns
+	mux    sync.Mutex
+	server *grpclib.Server
+	l      net.Listener
+	conns  map[raft.RaftAddr]*grpclib.ClientConn
+}
+
+// Register 创建 gRPC 服务器并注册 service
+func (t *Transport) Register(service raft.RPCService) error {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	t.server = grpclib.NewServer(t.serverOptions...)
+	RegisterService(t.server, service)
+	return nil
+}
+
+func (t *Transport) Listen(addr string) error {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	var err error
+	t.l, err = net.Listen("tcp", addr)
+	return err
+}
+
+// Addr 监听的地址, 未监听时返回 nil
+func (t *Transport) Addr() net.Addr {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if t.l == nil {
+		return nil
+	}
+	return t.l.Addr()
+}
+
+func (t *Transport) Serve() error {
+	t.mux.Lock()
+	server, l := t.server, t.l
+	t.mux.Unlock()
+	if server == nil {
+		return ErrNotRegistered
+	}
+	err := server.Serve(l)
+	if errors.Is(err, grpclib.ErrServerStopped) {
+		return net.ErrClosed
+	}
+	return err
+}
+
+// Close 停止服务器并关闭所有连接
+func (t *Transport) Close() error {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	if t.server != nil {
+		t.server.Stop()
+	}
+	for addr, conn := range t.conns {
+		_ = conn.Close()
+		delete(t.conns, addr)
+	}
+	return nil
+}
+
+// conn 获取与 addr 的连接, gRPC 连接断开后自动重连
+func (t *Transport) conn(addr raft.RaftAddr) (*grpclib.ClientConn, error) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	conn, ok := t.conns[addr]
+	if ok {
+		return conn, nil
+	}
+	conn, err := grpclib.NewClient(string(addr), t.dialOptions...)
+	if err != nil {
+		return nil, err
+	}
+	t.conns[addr] = conn
+	return conn, nil
+}
+
+func (t *Transport) invoke(addr raft.RaftAddr, method string, args, results interface{}) error {
+	conn, err := t.conn(addr)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+	return conn.Invoke(ctx, "/"+serviceName+"/"+method, args, results, grpclib.CallContentSubtype(codecName))
+}
+
+func (t *Transport) CallAppendEntries(addr raft.RaftAddr, args raft.AppendEntriesArgs) (results raft.AppendEntriesResults, err error) {
+	err = t.invoke(addr, "AppendEntries", &args, &results)
+	return results, err
+}
+
+func (t *Transport) CallRequestVote(addr raft.RaftAddr, args raft.RequestVoteArgs) (results raft.RequestVoteResults, err error) {
+	err = t.invoke(addr, "RequestVote", &args, &results)
+	return results, err
+}
+
+func (t *Transport) CallTimeoutNow(addr raft.RaftAddr, args raft.TimeoutNowArgs) (results raft.TimeoutNowResults, err error) {
+	err = t.invoke(addr, "TimeoutNow", &args, &results)
+	return results, err
+}
+
+func (t *Transport) CallInstallSnapshot(addr raft.RaftAddr, args raft.InstallSnapshotArgs) (results raft.InstallSnapshotResults, err error) {
+	err = t.invoke(addr, "InstallSnapshot", &args, &results)
+	return results, err
+}
+
+func (t *Transport) CallPreVote(addr raft.RaftAddr, args raft.PreVoteArgs) (results raft.PreVoteResults, err error) {
+	err = t.invoke(addr, "PreVote", &args, &results)
+	return results, err
+}
@@ -0,0 +1,215 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mind1949/raft"
+	"github.com/mind1949/raft/raftmock"
+	grpclib "google.golang.org/grpc"
+)
+
+func TestCodec(t *testing.T) {
+	now := time.Unix(0, time.Now().UnixNano())
+	cases := []struct {
+		name    string
+		message interface{}
+		empty   interface{}
+	}{
+		{
+			name: "AppendEntriesArgs",
+			message: &raft.AppendEntriesArgs{
+				ProtocolVersion: raft.ProtocolVersionMax, Term: 3, LeaderId: "1", LeaderAddr: "addr-1",
+				PrevLogIndex: 10, PrevLogTerm: 2, LeaderCommit: 9, Extension: []byte("ext"), TransferTarget: "2",
+				ConfigIndex: 7, ConfigChecksum: 0xfeed, Group: "g1",
+				Entries: []raft.LogEntry{
+					{Index: 11, Term: 3, Command: raft.Command("a"), AppendTime: now, Proposer: "alice", Extensions: map[string][]byte{raft.ExtensionIdempotencyKey: []byte("k")}},
+					{Index: 12, Term: 3},
+				},
+			},
+			empty: &raft.AppendEntriesArgs{},
+		},
+		{
+			name: "AppendEntriesResults",
+			message: &raft.AppendEntriesResults{
+				ProtocolVersion: raft.ProtocolVersion1, Term: 3, Success: true, UnderPressure: true,
+				ConflictTerm: 2, ConflictIndex: 5, MatchIndex: 12, LeaderId: "2", LeaderAddr: "addr-2",
+			},
+			empty: &raft.AppendEntriesResults{},
+		},
+		{
+			name: "RequestVoteArgs",
+			message: &raft.RequestVoteArgs{
+				ProtocolVersion: raft.ProtocolVersion2, Term: 4, CandidateId: "2",
+				LastLogIndex: 12, LastLogTerm: 3, LeadershipTransfer: true, Group: "g1",
+			},
+			empty: &raft.RequestVoteArgs{},
+		},
+		{
+			name:    "RequestVoteResults",
+			message: &raft.RequestVoteResults{ProtocolVersion: raft.ProtocolVersion2, Term: 4, VoteGranted: true, CommitIndex: 9},
+			empty:   &raft.RequestVoteResults{},
+		},
+		{
+			name: "TimeoutNowArgs",
+			message: &raft.TimeoutNowArgs{
+				ProtocolVersion: raft.ProtocolVersion2, Term: 3, LeaderId: "1",
+				Progress: map[raft.RaftId]raft.PeerProgress{"2": {NextIndex: 13, MatchIndex: 12}, "3": {}},
+				Group:    "g1",
+			},
+			empty: &raft.TimeoutNowArgs{},
+		},
+		{
+			name:    "TimeoutNowResults",
+			message: &raft.TimeoutNowResults{ProtocolVersion: raft.ProtocolVersion2, Term: 3, Success: true},
+			empty:   &raft.TimeoutNowResults{},
+		},
+		{
+			name: "InstallSnapshotArgs",
+			message: &raft.InstallSnapshotArgs{
+				ProtocolVersion: raft.ProtocolVersion3, Term: 3, LeaderId: "1", LeaderAddr: "addr-1",
+				Meta: raft.SnapshotMeta{
+					Id: "s1", Index: 10, Term: 2, Configuration: []byte("config"), ConfigurationIndex: 1,
+					Size: 1024, KeyId: "k1", CreateTime: now,
+				},
+				Offset: 512, Data: []byte("chunk"), Done: true, Group: "g1",
+			},
+			empty: &raft.InstallSnapshotArgs{},
+		},
+		{
+			name:    "InstallSnapshotResults",
+			message: &raft.InstallSnapshotResults{ProtocolVersion: raft.ProtocolVersion3, Term: 3, Success: true},
+			empty:   &raft.InstallSnapshotResults{},
+		},
+		{
+			name:    "PreVoteArgs",
+			message: &raft.PreVoteArgs{ProtocolVersion: raft.ProtocolVersion4, Term: 5, CandidateId: "3", LastLogIndex: 12, LastLogTerm: 3, Group: "g1"},
+			empty:   &raft.PreVoteArgs{},
+		},
+		{
+			name:    "PreVoteResults",
+			message: &raft.PreVoteResults{ProtocolVersion: raft.ProtocolVersion4, Term: 4, VoteGranted: true, CommitIndex: 7, LastLogIndex: 9, LastLogTerm: 4, LogMatch: true},
+			empty:   &raft.PreVoteResults{},
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			b, err := codec{}.Marshal(c.message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := reflect.New(reflect.TypeOf(c.message).Elem()).Interface()
+			err = codec{}.Unmarshal(b, got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.message) {
+				t.Errorf("expect %+v but got %+v", c.message, got)
+			}
+
+			// zero values aren't encoded
+			b, err = codec{}.Marshal(c.empty)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(b) != 0 {
+				t.Errorf("expect empty encoding but got %d bytes", len(b))
+			}
+		})
+	}
+
+	t.Run("skip unknown fields", func(t *testing.T) {
+		var e encoder
+		e.requestVoteResults(&raft.RequestVoteResults{Term: 4, VoteGranted: true})
+		e.string(99, "added in a later version")
+		var got raft.RequestVoteResults
+		err := codec{}.Unmarshal(e.b, &got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Term != 4 || !got.VoteGranted {
+			t.Errorf("expect term 4 vote granted but got %+v", got)
+		}
+	})
+}
+
+func freeAddr(t *testing.T) raft.RaftAddr {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return raft.RaftAddr(l.Addr().String())
+}
+
+func TestTransport(t *testing.T) {
+	leaderFSM := raftmock.NewFSM()
+	leaderAddr := freeAddr(t)
+	leader, err := raft.New("1", leaderAddr, leaderFSM.Apply, nil, nil, raft.WithDevMode(), raft.WithRPC(New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leader.Stop()
+	go leader.Run()
+
+	// follower serves raft on an external grpc server
+	followerFSM := raftmock.NewFSM()
+	followerTransport := New()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	followerAddr := raft.RaftAddr(l.Addr().String())
+	follower, err := raft.New("2", followerAddr, followerFSM.Apply, raftmock.NewStore(), raftmock.NewLog(),
+		raft.WithRPC(followerTransport), raft.WithExternalRPCServer(), raft.WithElection(5*time.Second, 6*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer follower.Stop()
+	go follower.Run()
+	server := grpcServer(follower.RPCService())
+	defer server.Stop()
+	go server.Serve(l)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = leader.AddVoter(ctx, follower.Id(), follower.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = leader.Handle(ctx, raft.Command("a"), raft.Command("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// followers learn the commit index from the next AppendEntries
+	err = leader.Handle(ctx, raft.Command("c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied := func() []raft.Command {
+		commands := followerFSM.Commands()
+		if len(commands) > 2 {
+			commands = commands[:2]
+		}
+		return commands
+	}
+	expect := []raft.Command{raft.Command("a"), raft.Command("b")}
+	for !reflect.DeepEqual(applied(), expect) && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := applied(); !reflect.DeepEqual(got, expect) {
+		t.Errorf("expect follower applied %q but got %q", expect, got)
+	}
+}
+
+func grpcServer(service raft.RPCService) *grpclib.Server {
+	server := grpclib.NewServer()
+	RegisterService(server, service)
+	return server
+}
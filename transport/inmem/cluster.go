@@ -0,0 +1,221 @@
+package inmem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mind1949/raft"
+)
+
+var (
+	ErrNodeNotFound       = errors.New("err: inmem cluster node not found")
+	ErrInvalidClusterSize = errors.New("err: inmem cluster needs at least one node")
+)
+
+// Node Cluster 中的节点
+type Node struct {
+	Id   raft.RaftId
+	Addr raft.RaftAddr
+
+	mux  sync.Mutex
+	raft raft.Raft
+	// store, log 重启后沿用
+	store raft.Store
+	log   raft.Log
+}
+
+// Raft 节点当前的 raft 一致性模型, 重启后为新的实例
+func (n *Node) Raft() raft.Raft {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	return n.raft
+}
+
+// Cluster 在一个进程中通过 Network 连接的 N 个 raft 节点, 用于集成测试
+//
+//	c, err := inmem.NewCluster(3, func(id raft.RaftId) raft.Apply { return fsms[id].Apply })
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer c.Stop()
+//	c.Start()
+//	leader, err := c.WaitLeader(ctx)
+//	c.Partition([]raft.RaftId{leader.Id})
+//	...
+//	c.Heal()
+//
+// 节点使用内存中的 Store 与 Log, 选举超时默认为 [50ms, 100ms).
+type Cluster struct {
+	network  *Network
+	nodes    []*Node
+	newApply func(id raft.RaftId) raft.Apply
+	optFns   []raft.OptFn
+}
+
+// NewCluster 创建 n 个节点的集群, 节点 id 为 "1" 至 "n"
+// newApply 为每个节点创建 Apply, 为 nil 时丢弃 command; optFns 用于所有节点
+func NewCluster(n int, newApply func(id raft.RaftId) raft.Apply, optFns ...raft.OptFn) (*Cluster, error) {
+	if n < 1 {
+		return nil, ErrInvalidClusterSize
+	}
+	if newApply == nil {
+		newApply = func(raft.RaftId) raft.Apply {
+			return func(commands raft.Commands) (int, error) { return len(commands.Data()), nil }
+		}
+	}
+	c := &Cluster{
+		network:  NewNetwork(),
+		newApply: newApply,
+		optFns:   append([]raft.OptFn{raft.WithElection(50*time.Millisecond, 100*time.Millisecond)}, optFns...),
+	}
+	var configuration raft.Configuration
+	for i := 1; i <= n; i++ {
+		id := raft.RaftId(fmt.Sprint(i))
+		node := &Node{
+			Id:    id,
+			Addr:  raft.RaftAddr("inmem-" + string(id)),
+			store: raft.NewMemoryStore(),
+			log:   raft.NewMemoryLog(),
+		}
+		configuration.Peers = append(configuration.Peers, raft.RaftPeer{Id: node.Id, Addr: node.Addr})
+		err := c.newRaft(node)
+		if err != nil {
+			return nil, err
+		}
+		c.nodes = append(c.nodes, node)
+	}
+	// the other nodes learn the configuration from the elected node
+	err := c.nodes[0].raft.BootstrapCluster(configuration)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Cluster) newRaft(node *Node) error {
+	optFns := append(append([]raft.OptFn(nil), c.optFns...), raft.WithRPC(c.network.Transport(node.Addr)))
+	r, err := raft.New(node.Id, node.Addr, c.newApply(node.Id), node.store, node.log, optFns...)
+	if err != nil {
+		return err
+	}
+	node.mux.Lock()
+	defer node.mux.Unlock()
+	node.raft = r
+	return nil
+}
+
+// Network 连接节点的 Network, 用于注入丢包、重复与延迟
+func (c *Cluster) Network() *Network {
+	return c.network
+}
+
+// Nodes 所有节点
+func (c *Cluster) Nodes() []*Node {
+	return c.nodes
+}
+
+// Node 获取 id 对应的节点
+func (c *Cluster) Node(id raft.RaftId) (*Node, error) {
+	for _, node := range c.nodes {
+		if node.Id == id {
+			return node, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNodeNotFound, id)
+}
+
+// Start 启动所有节点
+func (c *Cluster) Start() {
+	for _, node := range c.nodes {
+		go node.Raft().Run()
+	}
+}
+
+// Stop 停止所有节点
+func (c *Cluster) Stop() {
+	for _, node := range c.nodes {
+		node.Raft().Stop()
+	}
+}
+
+// Restart 停止节点 id, 再以原有的 Store 与 Log 重新创建并启动
+func (c *Cluster) Restart(id raft.RaftId) error {
+	node, err := c.Node(id)
+	if err != nil {
+		return err
+	}
+	r := node.Raft()
+	r.Stop()
+	// the address is released before Run returns
+	for r.State() != raft.LifecycleStopped {
+		time.Sleep(time.Millisecond)
+	}
+	err = c.newRaft(node)
+	if err != nil {
+		return err
+	}
+	go node.Raft().Run()
+	return nil
+}
+
+// Partition 将节点分为互不连通的分区, 每个 group 为一个分区, 未列出的节点在同一个分区中
+func (c *Cluster) Partition(groups ...[]raft.RaftId) error {
+	addrs := make([][]raft.RaftAddr, 0, len(groups))
+	for _, group := range groups {
+		var partition []raft.RaftAddr
+		for _, id := range group {
+			node, err := c.Node(id)
+			if err != nil {
+				return err
+			}
+			partition = append(partition, node.Addr)
+		}
+		addrs = append(addrs, partition)
+	}
+	c.network.Partition(addrs...)
+	return nil
+}
+
+// Heal 消除所有分区
+func (c *Cluster) Heal() {
+	c.network.Heal()
+}
+
+// Leader 当前 term 最高的 Leader, 没有时返回 false
+//
+// 分区后旧的 Leader 可能仍认为自己是 Leader, 只有 term 最高的才能 commit.
+func (c *Cluster) Leader() (*Node, bool) {
+	var (
+		leader *Node
+		term   uint64
+	)
+	for _, node := range c.nodes {
+		r := node.Raft()
+		if r.State() != raft.LifecycleRunning || !r.IsLeader() {
+			continue
+		}
+		if t := r.Stats().Term; leader == nil || t > term {
+			leader, term = node, t
+		}
+	}
+	return leader, leader != nil
+}
+
+// WaitLeader 等待选出 Leader, 返回 term 最高的 Leader
+func (c *Cluster) WaitLeader(ctx context.Context) (*Node, error) {
+	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if leader, ok := c.Leader(); ok {
+			return leader, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,266 @@
+// Package inmem 进程内的 raft.RPC 实现, 可注入网络分区、丢包、重复与延迟
+//
+// 同一个 Network 上的 Transport 互相连通, 不经过真实的网络:
+//
+//	network := inmem.NewNetwork()
+//	r, err := raft.New(id, addr, apply, store, log, raft.WithRPC(network.Transport(addr)))
+//
+// 多节点的集成测试使用 Cluster, 它在一个进程中启动并连接 N 个 raft 节点.
+package inmem
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/mind1949/raft"
+)
+
+var (
+	ErrAddrInUse   = errors.New("err: inmem address already in use")
+	ErrAddrInvalid = errors.New("err: inmem transport listens on another address")
+	ErrUnreachable = errors.New("err: inmem address unreachable")
+	ErrDropped     = errors.New("err: message dropped by inmem network")
+)
+
+// Network 连接 Transport 的进程内网络
+//
+// 默认所有节点互相连通, 消息不会丢失、重复或延迟; 之后可以随时注入故障:
+//   - Partition 将节点分为互不连通的分区, Heal 恢复;
+//   - SetDropRate 随机丢弃请求或响应, 请求被处理但响应丢失时调用方同样收到 ErrDropped;
+//   - SetDuplicateRate 随机重复投递请求, 调用方只收到第一次的响应;
+//   - SetLatency 为每条消息增加随机延迟.
+type Network struct {
+	mux      sync.RWMutex
+	services map[raft.RaftAddr]raft.RPCService
+	// partitions 节点所在的分区, 未列出的节点都在分区 0
+	partitions map[raft.RaftAddr]int
+
+	dropRate      float64
+	duplicateRate float64
+	latency       [2]time.Duration
+
+	randMux sync.Mutex
+	rand    *rand.Rand
+}
+
+// NewNetwork 创建所有节点互相连通的 Network
+func NewNetwork() *Network {
+	return &Network{
+		services:   make(map[raft.RaftAddr]raft.RPCService),
+		partitions: make(map[raft.RaftAddr]int),
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Transport 创建连接到 n 上地址为 addr 的 raft.RPC
+func (n *Network) Transport(addr raft.RaftAddr) *Transport {
+	return &Transport{
+		network: n,
+		addr:    addr,
+		closed:  make(chan struct{}),
+	}
+}
+
+// Partition 将节点分为互不连通的分区, 每个 group 为一个分区, 未列出的节点在同一个分区中
+// 覆盖之前的分区
+func (n *Network) Partition(groups ...[]raft.RaftAddr) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	n.partitions = make(map[raft.RaftAddr]int)
+	for i, group := range groups {
+		for _, addr := range group {
+			n.partitions[addr] = i + 1
+		}
+	}
+}
+
+// Heal 消除所有分区
+func (n *Network) Heal() {
+	n.Partition()
+}
+
+// SetDropRate 以 rate 的概率丢弃请求或响应, 0 表示不丢弃
+func (n *Network) SetDropRate(rate float64) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	n.dropRate = rate
+}
+
+// SetDuplicateRate 以 rate 的概率重复投递请求, 0 表示不重复
+func (n *Network) SetDuplicateRate(rate float64) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	n.duplicateRate = rate
+}
+
+// SetLatency 每条消息延迟 [min, max) 之间的随机时间, 0 表示不延迟
+func (n *Network) SetLatency(min, max time.Duration) {
+	if min < 0 || max < min {
+		panic("latency must be a non-negative range")
+	}
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	n.latency = [2]time.Duration{min, max}
+}
+
+// Connected from 与 to 是否连通
+func (n *Network) Connected(from, to raft.RaftAddr) bool {
+	n.mux.RLock()
+	defer n.mux.RUnlock()
+	return n.partitions[from] == n.partitions[to]
+}
+
+func (n *Network) listen(addr raft.RaftAddr, service raft.RPCService) error {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if _, ok := n.services[addr]; ok {
+		return fmt.Errorf("%w: %s", ErrAddrInUse, addr)
+	}
+	n.services[addr] = service
+	return nil
+}
+
+func (n *Network) close(addr raft.RaftAddr, service raft.RPCService) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if n.services[addr] == service {
+		delete(n.services, addr)
+	}
+}
+
+// faults 投递一条消息时注入的故障
+type faults struct {
+	dropRequest  bool
+	dropResponse bool
+	duplicate    bool
+	delay        time.Duration
+}
+
+func (n *Network) route(from, to raft.RaftAddr) (raft.RPCService, faults, error) {
+	n.mux.RLock()
+	service, ok := n.services[to]
+	connected := n.partitions[from] == n.partitions[to]
+	dropRate, duplicateRate, latency := n.dropRate, n.duplicateRate, n.latency
+	n.mux.RUnlock()
+	if !ok {
+		return nil, faults{}, fmt.Errorf("%w: %s", ErrUnreachable, to)
+	}
+	if !connected {
+		return nil, faults{}, fmt.Errorf("%w: %s and %s are partitioned", ErrDropped, from, to)
+	}
+
+	n.randMux.Lock()
+	defer n.randMux.Unlock()
+	f := faults{
+		dropRequest:  n.rand.Float64() < dropRate,
+		dropResponse: n.rand.Float64() < dropRate,
+		duplicate:    n.rand.Float64() < duplicateRate,
+		delay:        latency[0],
+	}
+	if latency[1] > latency[0] {
+		f.delay += time.Duration(n.rand.Int63n(int64(latency[1] - latency[0])))
+	}
+	return service, f, nil
+}
+
+// deliver 从 from 向 to 投递请求 args, 由 handle 调用 to 的 RPCService
+func deliver[A any, R any](n *Network, from, to raft.RaftAddr, args A, handle func(raft.RPCService, A, *R) error) (results R, err error) {
+	service, f, err := n.route(from, to)
+	if err != nil {
+		return results, err
+	}
+	time.Sleep(f.delay)
+	if f.dropRequest {
+		return results, fmt.Errorf("%w: request from %s to %s", ErrDropped, from, to)
+	}
+	err = handle(service, args, &results)
+	if f.duplicate {
+		var duplicated R
+		_ = handle(service, args, &duplicated)
+	}
+	if f.dropResponse {
+		var zero R
+		return zero, fmt.Errorf("%w: response from %s to %s", ErrDropped, to, from)
+	}
+	return results, err
+}
+
+var (
+	_ raft.RPC              = (*Transport)(nil)
+	_ raft.TimeoutNowCaller = (*Transport)(nil)
+)
+
+// Transport Network 上地址为 addr 的 raft.RPC
+type Transport struct {
+	network *Network
+	addr    raft.RaftAddr
+
+	mux     sync.Mutex
+	service raft.RPCService
+
+	once   sync.Once
+	closed chan struct{}
+}
+
+// Addr Transport 的地址
+func (t *Transport) Addr() raft.RaftAddr {
+	return t.addr
+}
+
+func (t *Transport) Listen(addr string) error {
+	if raft.RaftAddr(addr) != t.addr {
+		return fmt.Errorf("%w: %s, not %s", ErrAddrInvalid, t.addr, addr)
+	}
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	return t.network.listen(t.addr, t.service)
+}
+
+func (t *Transport) Serve() error {
+	<-t.closed
+	return nil
+}
+
+func (t *Transport) Register(service raft.RPCService) error {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.service = service
+	return nil
+}
+
+func (t *Transport) Close() error {
+	t.once.Do(func() {
+		t.mux.Lock()
+		defer t.mux.Unlock()
+		if t.service != nil {
+			t.network.close(t.addr, t.service)
+		}
+		close(t.closed)
+	})
+	return nil
+}
+
+func (t *Transport) CallAppendEntries(addr raft.RaftAddr, args raft.AppendEntriesArgs) (raft.AppendEntriesResults, error) {
+	// the receiver may modify entries, which are shared without serialization
+	args.Entries = append([]raft.LogEntry(nil), args.Entries...)
+	return deliver(t.network, t.addr, addr, args, raft.RPCService.AppendEntries)
+}
+
+func (t *Transport) CallRequestVote(addr raft.RaftAddr, args raft.RequestVoteArgs) (raft.RequestVoteResults, error) {
+	return deliver(t.network, t.addr, addr, args, raft.RPCService.RequestVote)
+}
+
+func (t *Transport) CallTimeoutNow(addr raft.RaftAddr, args raft.TimeoutNowArgs) (raft.TimeoutNowResults, error) {
+	return deliver(t.network, t.addr, addr, args, raft.ServeTimeoutNow)
+}
+
+func (t *Transport) CallInstallSnapshot(addr raft.RaftAddr, args raft.InstallSnapshotArgs) (raft.InstallSnapshotResults, error) {
+	return deliver(t.network, t.addr, addr, args, raft.RPCService.InstallSnapshot)
+}
+
+func (t *Transport) CallPreVote(addr raft.RaftAddr, args raft.PreVoteArgs) (raft.PreVoteResults, error) {
+	return deliver(t.network, t.addr, addr, args, raft.RPCService.PreVote)
+}
@@ -0,0 +1,227 @@
+package inmem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mind1949/raft"
+)
+
+// listFSM 将 command 依序追加到列表的状态机
+type listFSM struct {
+	mux   sync.Mutex
+	items []string
+}
+
+func (f *listFSM) apply(commands raft.Commands) (int, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	for _, command := range commands.Data() {
+		f.items = append(f.items, string(command))
+	}
+	return len(commands.Data()), nil
+}
+
+func (f *listFSM) get() []string {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return append([]string(nil), f.items...)
+}
+
+func newTestCluster(t *testing.T, n int) (*Cluster, map[raft.RaftId]*listFSM) {
+	t.Helper()
+	fsms := make(map[raft.RaftId]*listFSM)
+	c, err := NewCluster(n, func(id raft.RaftId) raft.Apply {
+		fsm := &listFSM{}
+		fsms[id] = fsm
+		return fsm.apply
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Stop)
+	c.Start()
+	return c, fsms
+}
+
+func waitLeader(t *testing.T, c *Cluster) *Node {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	leader, err := c.WaitLeader(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leader
+}
+
+// expectApplied 等待所有节点应用 expect
+func expectApplied(t *testing.T, c *Cluster, fsms map[raft.RaftId]*listFSM, expect []string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for id, fsm := range fsms {
+		for !reflect.DeepEqual(fsm.get(), expect) {
+			if time.Now().After(deadline) {
+				t.Fatalf("expect %v applied on %s but got %v", expect, id, fsm.get())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+// handle 向 Leader 提交 cmd, Leader 变化或消息丢失时重试
+func handle(t *testing.T, c *Cluster, cmd string) {
+	t.Helper()
+	retry(t, c, func(ctx context.Context, r raft.Raft) error {
+		return r.Handle(ctx, raft.Command(cmd))
+	})
+}
+
+func propose(t *testing.T, c *Cluster, entry raft.LogEntry) {
+	t.Helper()
+	retry(t, c, func(ctx context.Context, r raft.Raft) error {
+		_, err := r.ProposeEntry(ctx, entry)
+		return err
+	})
+}
+
+func retry(t *testing.T, c *Cluster, fn func(context.Context, raft.Raft) error) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		leader := waitLeader(t, c)
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		err := fn(ctx, leader.Raft())
+		cancel()
+		if err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCluster(t *testing.T) {
+	t.Run("replicate", func(t *testing.T) {
+		c, fsms := newTestCluster(t, 3)
+		handle(t, c, "a")
+		expectApplied(t, c, fsms, []string{"a"})
+	})
+
+	t.Run("idle", func(t *testing.T) {
+		// followers learn the commit index from heartbeats without any write
+		c, _ := newTestCluster(t, 3)
+		leader := waitLeader(t, c)
+		expectCaughtUp := func(t *testing.T) {
+			t.Helper()
+			deadline := time.Now().Add(5 * time.Second)
+			for _, node := range c.Nodes() {
+				for !node.Raft().Healthy() || node.Raft().Stats().CatchingUp {
+					if time.Now().After(deadline) {
+						t.Fatalf("expect %s caught up and healthy on an idle cluster", node.Id)
+					}
+					time.Sleep(10 * time.Millisecond)
+				}
+			}
+		}
+		expectCaughtUp(t)
+
+		// a restarted follower hears nothing but heartbeats
+		for _, node := range c.Nodes() {
+			if node.Id == leader.Id {
+				continue
+			}
+			if err := c.Restart(node.Id); err != nil {
+				t.Fatal(err)
+			}
+			break
+		}
+		expectCaughtUp(t)
+	})
+	t.Run("partition and heal", func(t *testing.T) {
+		c, fsms := newTestCluster(t, 3)
+		old := waitLeader(t, c)
+		handle(t, c, "a")
+		expectApplied(t, c, fsms, []string{"a"})
+
+		if err := c.Partition([]raft.RaftId{old.Id}); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		err := old.Raft().Handle(ctx, raft.Command("lost"))
+		cancel()
+		if err == nil {
+			t.Fatal("expect the isolated leader unable to commit")
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			if leader, ok := c.Leader(); ok && leader.Id != old.Id {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("expect a new leader elected in the majority")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		handle(t, c, "b")
+
+		c.Heal()
+		for old.Raft().IsLeader() {
+			if time.Now().After(deadline) {
+				t.Fatal("expect the old leader to step down after healing")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		expectApplied(t, c, fsms, []string{"a", "b"})
+	})
+
+	t.Run("unreliable network", func(t *testing.T) {
+		c, fsms := newTestCluster(t, 3)
+		waitLeader(t, c)
+		c.Network().SetDropRate(0.1)
+		c.Network().SetDuplicateRate(0.2)
+		c.Network().SetLatency(time.Millisecond, 3*time.Millisecond)
+		var expect []string
+		for i := 0; i < 5; i++ {
+			cmd := fmt.Sprint("c", i)
+			handle(t, c, cmd)
+			expect = append(expect, cmd)
+		}
+		c.Network().SetDropRate(0)
+		expectApplied(t, c, fsms, expect)
+	})
+
+	t.Run("restart", func(t *testing.T) {
+		c, fsms := newTestCluster(t, 3)
+		handle(t, c, "a")
+		expectApplied(t, c, fsms, []string{"a"})
+		follower := c.Nodes()[2]
+		if leader := waitLeader(t, c); leader.Id == follower.Id {
+			follower = c.Nodes()[1]
+		}
+		if err := c.Restart(follower.Id); err != nil {
+			t.Fatal(err)
+		}
+		handle(t, c, "b")
+		// the restarted node replays its log into its new state machine
+		expectApplied(t, c, fsms, []string{"a", "b"})
+	})
+}
+
+func TestTransport(t *testing.T) {
+	network := NewNetwork()
+	transport := network.Transport("a")
+	if err := transport.Listen("b"); !errors.Is(err, ErrAddrInvalid) {
+		t.Fatalf("expect %v but got %v", ErrAddrInvalid, err)
+	}
+	_, err := transport.CallRequestVote("missing", raft.RequestVoteArgs{})
+	if !errors.Is(err, ErrUnreachable) {
+		t.Fatalf("expect %v but got %v", ErrUnreachable, err)
+	}
+}
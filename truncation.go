@@ -0,0 +1,93 @@
+package raft
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrTruncateCommitted = errors.New("err: refuse to truncate committed log entry")
+)
+
+// truncation follower 追加 log entry 时将被删除的本地 log entry
+type truncation struct {
+	// firstIndex, lastIndex 被删除的 log entry 区间 [firstIndex, lastIndex]
+	firstIndex uint64
+	lastIndex  uint64
+	// terms 被删除的 log entry 的 term, 按索引顺序去重
+	terms []uint64
+}
+
+// checkTruncation 在 AppendAfter(prevLogIndex, entries...) 之前检查将被删除的本地 log entry
+//
+// 从第一个与 entries 冲突 (同一索引但 term 不同) 或超出 entries 的本地 log entry 开始, 之后的 log entry 都会被删除 (§5.3).
+// 删除已 commit 的 log entry 违反 Leader Completeness (§5.4), 说明存在异常的分叉,
+// 此时拒绝追加, 发出 EventLevelCritical 级别的 EventLogTruncated 事件并返回 ErrTruncateCommitted;
+// 否则记录删除的数量与 term, 发出 EventLogTruncated 事件.
+func (r *raft) checkTruncation(prevLogIndex uint64, entries []LogEntry) error {
+	t, ok, err := r.findTruncation(prevLogIndex, entries)
+	if err != nil || !ok {
+		return err
+	}
+	count := t.lastIndex - t.firstIndex + 1
+	if commitIndex := r.GetCommitIndex(); t.firstIndex <= commitIndex {
+		r.metrics.IncrCounter(MetricLogTruncationsRefused, 1)
+		r.emit(Event{
+			Type:       EventLogTruncated,
+			Level:      EventLevelCritical,
+			FirstIndex: t.firstIndex,
+			LastIndex:  t.lastIndex,
+			Message: fmt.Sprintf("refused to truncate %d log entries of terms %v, commit index is %d",
+				count, t.terms, commitIndex),
+		})
+		return fmt.Errorf("%w: truncate from %d, commit index %d", ErrTruncateCommitted, t.firstIndex, commitIndex)
+	}
+	r.metrics.IncrCounter(MetricLogTruncated, float64(count))
+	r.emit(Event{
+		Type:       EventLogTruncated,
+		Level:      EventLevelWarning,
+		FirstIndex: t.firstIndex,
+		LastIndex:  t.lastIndex,
+		Message:    fmt.Sprintf("truncated %d conflicting log entries of terms %v", count, t.terms),
+	})
+	return nil
+}
+
+// findTruncation 查找 AppendAfter(prevLogIndex, entries...) 将删除的本地 log entry
+// 本地 log entry 都与 entries 匹配时返回 false
+func (r *raft) findTruncation(prevLogIndex uint64, entries []LogEntry) (truncation, bool, error) {
+	lastIndex, _, err := r.Log.Last()
+	if err != nil || lastIndex <= prevLogIndex {
+		return truncation{}, false, err
+	}
+	// entries covered by a snapshot are skipped by AppendAfter
+	firstIndex, err := r.Log.FirstIndex()
+	if err != nil {
+		return truncation{}, false, err
+	}
+	from := prevLogIndex
+	if firstIndex > 0 && from < firstIndex-1 {
+		from = firstIndex - 1
+	}
+	if lastIndex <= from {
+		return truncation{}, false, nil
+	}
+	local, err := r.Log.RangeGet(from, lastIndex)
+	if err != nil {
+		return truncation{}, false, err
+	}
+	for i, entry := range local {
+		index := from + uint64(i) + 1
+		if offset := index - prevLogIndex - 1; offset < uint64(len(entries)) && entries[offset].Term == entry.Term {
+			continue
+		}
+		t := truncation{firstIndex: index, lastIndex: lastIndex}
+		for _, entry := range local[i:] {
+			if n := len(t.terms); n == 0 || t.terms[n-1] != entry.Term {
+				t.terms = append(t.terms, entry.Term)
+			}
+		}
+		return t, true, nil
+	}
+	return truncation{}, false, nil
+}
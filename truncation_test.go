@@ -0,0 +1,95 @@
+package raft
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestCheckTruncation(t *testing.T) {
+	var (
+		mux    sync.Mutex
+		events []Event
+	)
+	observer := func(event Event) {
+		mux.Lock()
+		defer mux.Unlock()
+		if event.Type == EventLogTruncated {
+			events = append(events, event)
+		}
+	}
+	lastEvent := func() (Event, int) {
+		mux.Lock()
+		defer mux.Unlock()
+		if len(events) == 0 {
+			return Event{}, 0
+		}
+		return events[len(events)-1], len(events)
+	}
+	r, err := New("truncation", "truncation", nil, &memoryStore{}, &memoryLog{}, WithObserver(observer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := r.(*raft).newRPCService()
+	appendEntries := func(term, prevLogIndex, prevLogTerm, leaderCommit uint64, terms ...uint64) error {
+		var entries []LogEntry
+		for _, term := range terms {
+			entries = append(entries, LogEntry{Term: term, Command: Command("x")})
+		}
+		var results AppendEntriesResults
+		return service.AppendEntries(AppendEntriesArgs{
+			Term:         term,
+			LeaderId:     "leader",
+			PrevLogIndex: prevLogIndex,
+			PrevLogTerm:  prevLogTerm,
+			Entries:      entries,
+			LeaderCommit: leaderCommit,
+		}, &results)
+	}
+	lastIndex := func() uint64 {
+		index, _, err := r.(*raft).Last()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return index
+	}
+
+	t.Run("no conflict", func(t *testing.T) {
+		if err := appendEntries(2, 0, 0, 3, 1, 1, 1, 2, 2); err != nil {
+			t.Fatal(err)
+		}
+		if _, n := lastEvent(); n != 0 {
+			t.Fatalf("expect no truncation but got %d events", n)
+		}
+	})
+
+	t.Run("conflicting suffix", func(t *testing.T) {
+		if err := appendEntries(3, 3, 1, 3, 3); err != nil {
+			t.Fatal(err)
+		}
+		event, n := lastEvent()
+		if n != 1 || event.Level != EventLevelWarning || event.FirstIndex != 4 || event.LastIndex != 5 {
+			t.Fatalf("expect truncation of [4, 5] but got %d events, last %+v", n, event)
+		}
+		if event.Message != "truncated 2 conflicting log entries of terms [2]" {
+			t.Fatalf("expect discarded terms reported but got %q", event.Message)
+		}
+		if index := lastIndex(); index != 4 {
+			t.Fatalf("expect last index 4 but got %d", index)
+		}
+	})
+
+	t.Run("committed entries", func(t *testing.T) {
+		err := appendEntries(4, 1, 1, 3, 4)
+		if !errors.Is(err, ErrTruncateCommitted) {
+			t.Fatalf("expect %v but got %v", ErrTruncateCommitted, err)
+		}
+		event, n := lastEvent()
+		if n != 2 || event.Level != EventLevelCritical || event.FirstIndex != 2 || event.LastIndex != 4 {
+			t.Fatalf("expect refused truncation of [2, 4] but got %d events, last %+v", n, event)
+		}
+		if index := lastIndex(); index != 4 {
+			t.Fatalf("expect log untouched at last index 4 but got %d", index)
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package raft
+
+import (
+	"errors"
+	"testing"
+)
+
+// failingStore Set 总是失败的 Store
+type failingStore struct {
+	memoryStore
+}
+
+func (s *failingStore) Set(key []byte, val []byte) error {
+	return errors.New("disk full")
+}
+
+func TestVotePersistence(t *testing.T) {
+	// requestVote 以最新的 log 向 r 请求 term 中的投票
+	requestVote := func(t *testing.T, r *raft, term uint64, candidateId RaftId) bool {
+		var results RequestVoteResults
+		err := r.RPCService().RequestVote(RequestVoteArgs{
+			Term:         term,
+			CandidateId:  candidateId,
+			LastLogIndex: 10,
+			LastLogTerm:  10,
+		}, &results)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return results.VoteGranted
+	}
+	// restart 以同一 store 与 log 重新创建 id 的节点
+	restart := func(t *testing.T, id RaftId, store Store, log Log) *raft {
+		r, err := New(id, RaftAddr(id), nil, store, log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r.(*raft)
+	}
+
+	t.Run("candidate restarts mid-election", func(t *testing.T) {
+		store, log := &memoryStore{}, &memoryLog{}
+		r := restart(t, "vote-candidate", store, log)
+		r.SetCurrentTerm(2)
+		if _, err := r.toCandidate(); err != nil {
+			t.Fatal(err)
+		}
+
+		// crashes before any RequestVote is answered
+		recovered := restart(t, "vote-candidate", store, log)
+		if term, votedFor := recovered.GetCurrentTerm(), recovered.GetVotedFor(); term != 3 || votedFor != recovered.Id() {
+			t.Fatalf("expect voted for self at term 3 but got %q at %d", votedFor, term)
+		}
+		if requestVote(t, recovered, 3, "other") {
+			t.Fatal("expect vote for another candidate at term 3 denied")
+		}
+		if !requestVote(t, recovered, 4, "other") {
+			t.Fatal("expect vote for another candidate at term 4 granted")
+		}
+	})
+
+	t.Run("voter restarts before converting", func(t *testing.T) {
+		store, log := &memoryStore{}, &memoryLog{}
+		r := restart(t, "vote-voter", store, log)
+		r.SetCurrentTerm(2)
+		if !requestVote(t, r, 5, "a") {
+			t.Fatal("expect vote for a at term 5 granted")
+		}
+		// the vote is recorded before the voter converts to term 5
+		if requestVote(t, r, 5, "b") {
+			t.Fatal("expect vote for b at term 5 denied before restarting")
+		}
+
+		recovered := restart(t, "vote-voter", store, log)
+		if term, votedFor := recovered.GetCurrentTerm(), recovered.GetVotedFor(); term != 5 || votedFor != "a" {
+			t.Fatalf("expect voted for a at term 5 but got %q at %d", votedFor, term)
+		}
+		if requestVote(t, recovered, 5, "b") {
+			t.Fatal("expect vote for b at term 5 denied after restarting")
+		}
+		if !requestVote(t, recovered, 5, "a") {
+			t.Fatal("expect vote for a at term 5 granted again")
+		}
+	})
+
+	t.Run("candidate doesn't reuse a term it voted in", func(t *testing.T) {
+		r := restart(t, "vote-reuse", &memoryStore{}, &memoryLog{})
+		r.SetCurrentTerm(2)
+		if !requestVote(t, r, 3, "a") {
+			t.Fatal("expect vote for a at term 3 granted")
+		}
+		// election timeout elapses before converting to term 3
+		if _, err := r.toCandidate(); err != nil {
+			t.Fatal(err)
+		}
+		if term, votedFor := r.GetCurrentTerm(), r.GetVotedFor(); term != 4 || votedFor != r.Id() {
+			t.Fatalf("expect voted for self at term 4 but got %q at %d", votedFor, term)
+		}
+	})
+
+	t.Run("vote not persisted", func(t *testing.T) {
+		r := restart(t, "vote-failing", &failingStore{}, &memoryLog{})
+		if _, err := r.toCandidate(); err == nil {
+			t.Fatal("expect error but got nil")
+		}
+		if requestVote(t, r, 1, "a") {
+			t.Fatal("expect vote denied while it can't be persisted")
+		}
+	})
+
+	t.Run("already voted", func(t *testing.T) {
+		r := restart(t, "vote-twice", &memoryStore{}, &memoryLog{})
+		if err := r.SetVote(3, "a"); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.SetVote(3, "b"); !errors.Is(err, ErrAlreadyVoted) {
+			t.Fatalf("expect %v but got %v", ErrAlreadyVoted, err)
+		}
+		if err := r.SetVote(2, "b"); !errors.Is(err, ErrVoteTermStale) {
+			t.Fatalf("expect %v but got %v", ErrVoteTermStale, err)
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package wal
+
+import "github.com/mind1949/raft"
+
+// entryCache 最近追加的一段连续 log entry, 最多 max 条
+//
+// Leader 复制与 Follower 应用读取的大多是最近追加的 log entry,
+// 命中时 RangeGet 不需要读取文件与解码.
+type entryCache struct {
+	max int
+	// entries 索引从 entries[0].Index 开始连续
+	entries []raft.LogEntry
+}
+
+// add 缓存依序追加的 entries, 与已缓存的 log entry 不连续时丢弃已缓存的
+func (c *entryCache) add(entries []raft.LogEntry) {
+	if c.max <= 0 || len(entries) == 0 {
+		return
+	}
+	if n := len(c.entries); n > 0 && c.entries[n-1].Index+1 != entries[0].Index {
+		c.clear()
+	}
+	if len(entries) > c.max {
+		entries = entries[len(entries)-c.max:]
+	}
+	for _, entry := range entries {
+		c.entries = append(c.entries, cloneEntry(entry))
+	}
+	if n := len(c.entries) - c.max; n > 0 {
+		copy(c.entries, c.entries[n:])
+		for i := c.max; i < len(c.entries); i++ {
+			c.entries[i] = raft.LogEntry{}
+		}
+		c.entries = c.entries[:c.max]
+	}
+}
+
+// get 获取缓存的索引为 index 的 log entry
+func (c *entryCache) get(index uint64) (raft.LogEntry, bool) {
+	if len(c.entries) == 0 || index < c.entries[0].Index {
+		return raft.LogEntry{}, false
+	}
+	k := index - c.entries[0].Index
+	if k >= uint64(len(c.entries)) {
+		return raft.LogEntry{}, false
+	}
+	return c.entries[k], true
+}
+
+// truncate 丢弃索引大于 index 的 log entry
+func (c *entryCache) truncate(index uint64) {
+	for len(c.entries) > 0 && c.entries[len(c.entries)-1].Index > index {
+		c.entries[len(c.entries)-1] = raft.LogEntry{}
+		c.entries = c.entries[:len(c.entries)-1]
+	}
+}
+
+func (c *entryCache) clear() {
+	c.entries = nil
+}
+
+// cloneEntry 复制 entry, 避免调用方之后修改 Command 或 Extensions 影响缓存
+func cloneEntry(entry raft.LogEntry) raft.LogEntry {
+	entry.Command = append(raft.Command(nil), entry.Command...)
+	if entry.Extensions != nil {
+		extensions := make(map[string][]byte, len(entry.Extensions))
+		for key, value := range entry.Extensions {
+			extensions[key] = append([]byte(nil), value...)
+		}
+		entry.Extensions = extensions
+	}
+	return entry
+}
@@ -0,0 +1,69 @@
+package wal
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+)
+
+// compressedPayload 压缩后的 payload 的首字节
+// 未压缩的 payload 是 json 对象, 以 '{' 开头, 两种记录可以混合在同一个 segment 中
+const compressedPayload = 0x01
+
+// payloadCodec 编解码记录的 payload, 复用 flate 的 writer 与 reader
+// 由 Log.mux 保护
+type payloadCodec struct {
+	compress bool
+
+	buf    bytes.Buffer
+	writer *flate.Writer
+	reader io.ReadCloser
+}
+
+// encode 启用压缩且压缩后更小时返回压缩的 payload, 否则原样返回
+func (c *payloadCodec) encode(payload []byte) ([]byte, error) {
+	if !c.compress {
+		return payload, nil
+	}
+	c.buf.Reset()
+	c.buf.WriteByte(compressedPayload)
+	if c.writer == nil {
+		// BestSpeed keeps the compressor's memory and cpu usage low on small devices
+		w, err := flate.NewWriter(&c.buf, flate.BestSpeed)
+		if err != nil {
+			return nil, err
+		}
+		c.writer = w
+	} else {
+		c.writer.Reset(&c.buf)
+	}
+	if _, err := c.writer.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := c.writer.Close(); err != nil {
+		return nil, err
+	}
+	if c.buf.Len() >= len(payload) {
+		return payload, nil
+	}
+	return append([]byte(nil), c.buf.Bytes()...), nil
+}
+
+// decode 解压 encode 压缩的 payload, 未压缩的 payload 原样返回
+func (c *payloadCodec) decode(payload []byte) ([]byte, error) {
+	if len(payload) == 0 || payload[0] != compressedPayload {
+		return payload, nil
+	}
+	src := bytes.NewReader(payload[1:])
+	if c.reader == nil {
+		c.reader = flate.NewReader(src)
+	} else if err := c.reader.(flate.Resetter).Reset(src, nil); err != nil {
+		return nil, err
+	}
+	b, err := io.ReadAll(c.reader)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCorrupt, err)
+	}
+	return b, nil
+}
@@ -0,0 +1,783 @@
+// Package wal 基于文件的 raft.Log 实现, 不依赖第三方库
+//
+// log entry 按索引顺序写入固定大小的 segment 文件, 每条记录带有 CRC32 校验:
+//
+//	+------------+------------+------------------+
+//	| len uint32 | crc uint32 | payload(len 字节) |
+//	+------------+------------+------------------+
+//
+// 每次写入后 fsync, 断电等原因导致最后一个 segment 末尾的记录写入不完整或校验失败时,
+// Open 截断这些记录; 其他 segment 损坏时 Open 返回 ErrCorrupt.
+//
+//	log, err := wal.Open(filepath.Join(dir, "wal"))
+//	if err != nil {
+//		return err
+//	}
+//	defer log.Close()
+//	r, err := raft.New(id, addr, apply, store, log)
+//
+// 在内存与存储有限的设备上使用 WithCompactProfile.
+package wal
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mind1949/raft"
+)
+
+var (
+	ErrCorrupt          = errors.New("err: wal is corrupted")
+	ErrAppendOutOfRange = errors.New("err: append after index out of range")
+	ErrClosed           = errors.New("err: wal is closed")
+)
+
+const (
+	// headerSize 记录头: payload 长度与 payload 的 crc
+	headerSize = 8
+	// defaultSegmentSize segment 文件的默认大小上限
+	defaultSegmentSize = 64 << 20
+	// defaultCacheSize 默认缓存的最近追加的 log entry 数量
+	defaultCacheSize = 1024
+
+	// compactSegmentSize, compactCacheSize WithCompactProfile 使用的 segment 大小上限与缓存数量
+	compactSegmentSize = 4 << 20
+	compactCacheSize   = 64
+
+	segmentExt = ".wal"
+	metaFile   = "meta"
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// OptFn Log 配置可选项
+type OptFn func(*opts)
+
+// WithSegmentSize segment 文件的大小上限, 超过后写入新的 segment
+func WithSegmentSize(size int64) OptFn {
+	if size <= headerSize {
+		panic("segment size must be larger than record header")
+	}
+	return func(o *opts) {
+		o.segmentSize = size
+	}
+}
+
+// WithCacheSize 在内存中缓存最近追加的 size 条 log entry, RangeGet 命中时不读取文件
+// 默认 1024 条, 0 表示不缓存
+func WithCacheSize(size int) OptFn {
+	if size < 0 {
+		panic("cache size must not be negative")
+	}
+	return func(o *opts) {
+		o.cacheSize = size
+	}
+}
+
+// WithCompression 以 flate 压缩写入的 log entry, 压缩后不变小的 log entry 不压缩
+//
+// 已有的 wal 可以随时开启或关闭压缩, 压缩与未压缩的记录都能读取.
+func WithCompression(enabled bool) OptFn {
+	return func(o *opts) {
+		o.compress = enabled
+	}
+}
+
+// WithCompactProfile 适用于 ARM 等内存与存储有限的设备的配置
+//
+// 使用 4 MiB 的 segment, 只缓存最近的 64 条 log entry, 并默认压缩写入的 log entry;
+// 与其他 OptFn 一起使用时, 之后的 OptFn 可以覆盖其中的配置.
+// wal 不启动后台 goroutine, 所有写入与清理都在调用方的 goroutine 中完成.
+func WithCompactProfile() OptFn {
+	return func(o *opts) {
+		o.segmentSize = compactSegmentSize
+		o.cacheSize = compactCacheSize
+		o.compress = true
+	}
+}
+
+type opts struct {
+	segmentSize int64
+	cacheSize   int
+	compress    bool
+}
+
+var _ raft.Log = (*Log)(nil)
+
+// Log 基于 segment 文件的 raft.Log
+//
+// 所有记录的 term 与位置保存在内存中, RangeGet 从文件读取 log entry.
+// 压缩与截断后的边界 prevIndex, prevTerm 保存在 meta 文件中.
+type Log struct {
+	mux  sync.Mutex
+	dir  string
+	opts opts
+
+	segments []*segment
+	// cache 最近追加的 log entry
+	cache entryCache
+	// codec 编解码记录的 payload
+	codec payloadCodec
+
+	// prevIndex, prevTerm 第一个保留的 log entry 之前的 log entry(已被快照覆盖)
+	prevIndex uint64
+	prevTerm  uint64
+
+	closed bool
+}
+
+// Open 打开 dir 中的 wal, 不存在时创建
+func Open(dir string, optFns ...OptFn) (*Log, error) {
+	o := opts{segmentSize: defaultSegmentSize, cacheSize: defaultCacheSize}
+	for _, fn := range optFns {
+		fn(&o)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	l := &Log{
+		dir:   dir,
+		opts:  o,
+		cache: entryCache{max: o.cacheSize},
+		codec: payloadCodec{compress: o.compress},
+	}
+	if err := l.load(); err != nil {
+		l.closeSegments()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Close 关闭所有 segment 文件
+func (l *Log) Close() error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	return l.closeSegments()
+}
+
+func (l *Log) closeSegments() error {
+	var err error
+	for _, seg := range l.segments {
+		if e := seg.f.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	l.segments = nil
+	return err
+}
+
+// Get 获取 raft log 中索引为 index 的 log entry term
+// 若无, 则返回 0, nil
+func (l *Log) Get(index uint64) (term uint64, err error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.closed {
+		return 0, ErrClosed
+	}
+	term, _ = l.term(index)
+	return term, nil
+}
+
+// Match 是否有匹配上 term 与 index 的 log entry
+// 被快照覆盖的 log entry 都已 commit, 总是匹配
+func (l *Log) Match(index, term uint64) (bool, error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.closed {
+		return false, ErrClosed
+	}
+	if index == 0 || index < l.prevIndex {
+		return true, nil
+	}
+	target, ok := l.term(index)
+	return ok && target == term, nil
+}
+
+// Last 返回最后一个 log entry 的 term 与 index
+// 若无, 则返回 0 , 0
+func (l *Log) Last() (index, term uint64, err error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.closed {
+		return 0, 0, ErrClosed
+	}
+	index, term = l.last()
+	return index, term, nil
+}
+
+// RangeGet 获取在 (i, j] 索引区间的 log entry
+// 若无, 则返回 nil, nil
+func (l *Log) RangeGet(i, j uint64) ([]raft.LogEntry, error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.closed {
+		return nil, ErrClosed
+	}
+	if i < l.prevIndex {
+		i = l.prevIndex
+	}
+	if last, _ := l.last(); j > last {
+		j = last
+	}
+
+	var entries []raft.LogEntry
+	for index := i + 1; index <= j; index++ {
+		if entry, ok := l.cache.get(index); ok {
+			entries = append(entries, entry)
+			continue
+		}
+		seg, k := l.locate(index)
+		if seg == nil {
+			return nil, fmt.Errorf("%w: missing log entry %d", ErrCorrupt, index)
+		}
+		entry, err := seg.read(k, &l.codec)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// AppendAfter 在afterIndex之后追加 log entry
+// 已被快照覆盖的 log entry 会被跳过
+func (l *Log) AppendAfter(afterIndex uint64, entries ...raft.LogEntry) error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.closed {
+		return ErrClosed
+	}
+
+	if afterIndex < l.prevIndex {
+		skip := l.prevIndex - afterIndex
+		if skip > uint64(len(entries)) {
+			skip = uint64(len(entries))
+		}
+		entries = entries[skip:]
+		afterIndex = l.prevIndex
+	}
+	if last, _ := l.last(); afterIndex > last {
+		return fmt.Errorf("%w: %d", ErrAppendOutOfRange, afterIndex)
+	}
+	if err := l.truncateAfter(afterIndex); err != nil {
+		return err
+	}
+	return l.append(afterIndex, entries)
+}
+
+// Append 追加log entry
+func (l *Log) Append(entries ...raft.LogEntry) error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.closed {
+		return ErrClosed
+	}
+	last, _ := l.last()
+	return l.append(last, entries)
+}
+
+// AppendEntry 追加一个 log entry , 并返回索引
+func (l *Log) AppendEntry(entry raft.LogEntry) (index uint64, err error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.closed {
+		return 0, ErrClosed
+	}
+	last, _ := l.last()
+	err = l.append(last, []raft.LogEntry{entry})
+	if err != nil {
+		return 0, err
+	}
+	return last + 1, nil
+}
+
+// FirstIndex 返回第一个保留的 log entry 的索引
+func (l *Log) FirstIndex() (uint64, error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.closed {
+		return 0, ErrClosed
+	}
+	return l.prevIndex + 1, nil
+}
+
+// Compact 丢弃索引不大于 upToIndex 的 log entry
+// 只删除全部 log entry 都已被丢弃的 segment 文件
+func (l *Log) Compact(upToIndex uint64) error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.closed {
+		return ErrClosed
+	}
+	if upToIndex <= l.prevIndex {
+		return nil
+	}
+	if last, _ := l.last(); upToIndex > last {
+		return fmt.Errorf("%w: %d", raft.ErrCompactBeyondLastIndex, upToIndex)
+	}
+	term, _ := l.term(upToIndex)
+	if err := l.setPrev(upToIndex, term); err != nil {
+		return err
+	}
+	return l.removeCompacted()
+}
+
+// TruncatePrefix 丢弃索引不大于 index 的 log entry
+// 若 log 中没有匹配 index 与 term 的 log entry, 丢弃整个 log
+func (l *Log) TruncatePrefix(index, term uint64) error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.closed {
+		return ErrClosed
+	}
+	if index <= l.prevIndex {
+		return nil
+	}
+
+	target, ok := l.term(index)
+	match := ok && target == term
+	if err := l.setPrev(index, term); err != nil {
+		return err
+	}
+	if !match {
+		return l.removeSegments(0)
+	}
+	return l.removeCompacted()
+}
+
+// term 获取 index 处的 term, 不包括被快照覆盖的 log entry
+func (l *Log) term(index uint64) (uint64, bool) {
+	if index == 0 || index < l.prevIndex {
+		return 0, false
+	}
+	if index == l.prevIndex {
+		return l.prevTerm, true
+	}
+	seg, k := l.locate(index)
+	if seg == nil {
+		return 0, false
+	}
+	return seg.terms[k], true
+}
+
+func (l *Log) last() (index, term uint64) {
+	for i := len(l.segments) - 1; i >= 0; i-- {
+		seg := l.segments[i]
+		if n := len(seg.terms); n > 0 && seg.last() > l.prevIndex {
+			return seg.last(), seg.terms[n-1]
+		}
+	}
+	return l.prevIndex, l.prevTerm
+}
+
+// locate 查找 index 所在的 segment 及其在 segment 中的序号
+func (l *Log) locate(index uint64) (*segment, int) {
+	i := sort.Search(len(l.segments), func(i int) bool {
+		return l.segments[i].first > index
+	})
+	if i == 0 {
+		return nil, 0
+	}
+	seg := l.segments[i-1]
+	k := index - seg.first
+	if k >= uint64(len(seg.terms)) {
+		return nil, 0
+	}
+	return seg, int(k)
+}
+
+// append 在 afterIndex 之后依序写入 entries, 并设置 entries 的索引
+func (l *Log) append(afterIndex uint64, entries []raft.LogEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	var dirty []*segment
+	for i := range entries {
+		entries[i].Index = afterIndex + 1 + uint64(i)
+		payload, err := json.Marshal(entries[i])
+		if err != nil {
+			return err
+		}
+		payload, err = l.codec.encode(payload)
+		if err != nil {
+			return err
+		}
+		record := encodeRecord(payload)
+
+		seg := l.active()
+		if seg == nil || (len(seg.terms) > 0 && seg.size+int64(len(record)) > l.opts.segmentSize) {
+			seg, err = l.createSegment(entries[i].Index)
+			if err != nil {
+				return err
+			}
+		}
+		if err := seg.write(record, entries[i].Term); err != nil {
+			return err
+		}
+		if len(dirty) == 0 || dirty[len(dirty)-1] != seg {
+			dirty = append(dirty, seg)
+		}
+	}
+	for _, seg := range dirty {
+		if err := seg.f.Sync(); err != nil {
+			return err
+		}
+	}
+	l.cache.add(entries)
+	return nil
+}
+
+func (l *Log) active() *segment {
+	if len(l.segments) == 0 {
+		return nil
+	}
+	return l.segments[len(l.segments)-1]
+}
+
+// truncateAfter 删除索引大于 index 的记录
+func (l *Log) truncateAfter(index uint64) error {
+	l.cache.truncate(index)
+	for len(l.segments) > 0 {
+		seg := l.active()
+		if seg.first > index {
+			if err := l.removeSegments(len(l.segments) - 1); err != nil {
+				return err
+			}
+			continue
+		}
+		if n := index - seg.first + 1; n < uint64(len(seg.terms)) {
+			return seg.truncate(int(n))
+		}
+		return nil
+	}
+	return nil
+}
+
+// removeCompacted 删除全部记录都已被快照覆盖的 segment
+func (l *Log) removeCompacted() error {
+	n := 0
+	for n < len(l.segments) && l.segments[n].last() <= l.prevIndex {
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	removed := l.segments[:n]
+	for _, seg := range removed {
+		if err := seg.remove(); err != nil {
+			return err
+		}
+	}
+	l.segments = append([]*segment(nil), l.segments[n:]...)
+	return syncDir(l.dir)
+}
+
+// removeSegments 删除从第 i 个开始的 segment
+func (l *Log) removeSegments(i int) error {
+	if i < len(l.segments) {
+		l.cache.truncate(l.segments[i].first - 1)
+	}
+	for _, seg := range l.segments[i:] {
+		if err := seg.remove(); err != nil {
+			return err
+		}
+	}
+	l.segments = l.segments[:i]
+	return syncDir(l.dir)
+}
+
+func (l *Log) createSegment(first uint64) (*segment, error) {
+	path := filepath.Join(l.dir, segmentName(first))
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syncDir(l.dir); err != nil {
+		f.Close()
+		return nil, err
+	}
+	seg := &segment{first: first, path: path, f: f}
+	l.segments = append(l.segments, seg)
+	return seg, nil
+}
+
+// setPrev 原子地持久化 prevIndex 与 prevTerm
+func (l *Log) setPrev(index, term uint64) error {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b[0:], index)
+	binary.BigEndian.PutUint64(b[8:], term)
+	if err := writeFileSync(l.dir, metaFile, encodeRecord(b)); err != nil {
+		return err
+	}
+	l.prevIndex, l.prevTerm = index, term
+	return nil
+}
+
+// load 读取 meta 与所有 segment, 截断最后一个 segment 末尾损坏的记录
+func (l *Log) load() error {
+	if err := l.loadMeta(); err != nil {
+		return err
+	}
+
+	dirEntries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return err
+	}
+	var firsts []uint64
+	for _, e := range dirEntries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		first, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		firsts = append(firsts, first)
+	}
+	sort.Slice(firsts, func(i, j int) bool { return firsts[i] < firsts[j] })
+
+	for i, first := range firsts {
+		path := filepath.Join(l.dir, segmentName(first))
+		f, err := os.OpenFile(path, os.O_RDWR, 0o600)
+		if err != nil {
+			return err
+		}
+		seg := &segment{first: first, path: path, f: f}
+		l.segments = append(l.segments, seg)
+
+		torn, err := seg.scan(&l.codec)
+		if err != nil {
+			return err
+		}
+		if torn >= 0 {
+			if i != len(firsts)-1 {
+				return fmt.Errorf("%w: %s at offset %d", ErrCorrupt, path, torn)
+			}
+			// 写入最后一个 segment 时断电, 丢弃不完整的记录
+			if err := seg.truncateAt(torn); err != nil {
+				return err
+			}
+		}
+		if i > 0 {
+			pre := l.segments[i-1]
+			if len(pre.terms) == 0 || pre.last()+1 != seg.first {
+				return fmt.Errorf("%w: gap before %s", ErrCorrupt, path)
+			}
+		}
+	}
+
+	// 丢弃整个 log 时, 写入 meta 后删除 segment 前崩溃, 残留的记录与快照不匹配
+	if l.prevIndex > 0 {
+		if seg, k := l.locate(l.prevIndex); seg != nil && seg.terms[k] != l.prevTerm {
+			return l.removeSegments(0)
+		}
+	}
+	if len(l.segments) > 0 && l.segments[0].first > l.prevIndex+1 {
+		if l.segments[0].last() > l.prevIndex {
+			return fmt.Errorf("%w: missing log entries after %d", ErrCorrupt, l.prevIndex)
+		}
+	}
+	return l.removeCompacted()
+}
+
+func (l *Log) loadMeta() error {
+	b, err := os.ReadFile(filepath.Join(l.dir, metaFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	payload, n, err := decodeRecord(b)
+	if err != nil || n != len(b) || len(payload) != 16 {
+		return fmt.Errorf("%w: %s", ErrCorrupt, metaFile)
+	}
+	l.prevIndex = binary.BigEndian.Uint64(payload[0:])
+	l.prevTerm = binary.BigEndian.Uint64(payload[8:])
+	return nil
+}
+
+// segment 保存一段连续 log entry 的文件, 文件名为第一条记录的索引
+type segment struct {
+	first uint64
+	path  string
+	f     *os.File
+	size  int64
+
+	// offsets, terms 每条记录在文件中的位置与 term
+	offsets []int64
+	terms   []uint64
+}
+
+// last 最后一条记录的索引, 没有记录时为 first-1
+func (s *segment) last() uint64 {
+	return s.first + uint64(len(s.terms)) - 1
+}
+
+func (s *segment) write(record []byte, term uint64) error {
+	if _, err := s.f.WriteAt(record, s.size); err != nil {
+		return err
+	}
+	s.offsets = append(s.offsets, s.size)
+	s.terms = append(s.terms, term)
+	s.size += int64(len(record))
+	return nil
+}
+
+func (s *segment) read(k int, codec *payloadCodec) (raft.LogEntry, error) {
+	end := s.size
+	if k+1 < len(s.offsets) {
+		end = s.offsets[k+1]
+	}
+	b := make([]byte, end-s.offsets[k])
+	if _, err := s.f.ReadAt(b, s.offsets[k]); err != nil {
+		return raft.LogEntry{}, err
+	}
+	payload, _, err := decodeRecord(b)
+	if err != nil {
+		return raft.LogEntry{}, fmt.Errorf("%w: %s at offset %d", err, s.path, s.offsets[k])
+	}
+	payload, err = codec.decode(payload)
+	if err != nil {
+		return raft.LogEntry{}, fmt.Errorf("%w: %s at offset %d", err, s.path, s.offsets[k])
+	}
+	var entry raft.LogEntry
+	err = json.Unmarshal(payload, &entry)
+	return entry, err
+}
+
+// truncate 只保留前 n 条记录
+func (s *segment) truncate(n int) error {
+	size := s.offsets[n]
+	if err := s.truncateAt(size); err != nil {
+		return err
+	}
+	s.offsets = s.offsets[:n]
+	s.terms = s.terms[:n]
+	return nil
+}
+
+func (s *segment) truncateAt(size int64) error {
+	if err := s.f.Truncate(size); err != nil {
+		return err
+	}
+	s.size = size
+	return s.f.Sync()
+}
+
+func (s *segment) remove() error {
+	_ = s.f.Close()
+	err := os.Remove(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// scan 读取所有记录, 返回第一条损坏记录的位置, 没有损坏时返回 -1
+func (s *segment) scan(codec *payloadCodec) (torn int64, err error) {
+	b, err := os.ReadFile(s.path)
+	if err != nil {
+		return 0, err
+	}
+	var offset int64
+	for offset < int64(len(b)) {
+		payload, n, err := decodeRecord(b[offset:])
+		if err != nil {
+			return offset, nil
+		}
+		payload, err = codec.decode(payload)
+		if err != nil {
+			return offset, nil
+		}
+		var entry raft.LogEntry
+		if err := json.Unmarshal(payload, &entry); err != nil {
+			return offset, nil
+		}
+		if entry.Index != s.first+uint64(len(s.terms)) {
+			return offset, nil
+		}
+		s.offsets = append(s.offsets, offset)
+		s.terms = append(s.terms, entry.Term)
+		offset += int64(n)
+	}
+	s.size = offset
+	return -1, nil
+}
+
+func segmentName(first uint64) string {
+	return fmt.Sprintf("%020d%s", first, segmentExt)
+}
+
+func encodeRecord(payload []byte) []byte {
+	record := make([]byte, headerSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:], crc32.Checksum(payload, crcTable))
+	copy(record[headerSize:], payload)
+	return record
+}
+
+// decodeRecord 解码 b 开头的记录, 返回 payload 与记录的长度
+func decodeRecord(b []byte) (payload []byte, n int, err error) {
+	if len(b) < headerSize {
+		return nil, 0, ErrCorrupt
+	}
+	size := binary.BigEndian.Uint32(b[0:])
+	if size == 0 || uint64(size) > uint64(len(b)-headerSize) {
+		return nil, 0, ErrCorrupt
+	}
+	payload = b[headerSize : headerSize+int(size)]
+	if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(b[4:]) {
+		return nil, 0, ErrCorrupt
+	}
+	return payload, headerSize + int(size), nil
+}
+
+// writeFileSync 先写入临时文件再重命名, 保证文件内容完整
+func writeFileSync(dir, name string, data []byte) error {
+	tmp := filepath.Join(dir, name+".tmp")
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, name)); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir 持久化目录中文件的创建, 删除与重命名
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,349 @@
+package wal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mind1949/raft"
+)
+
+func openTestLog(t *testing.T, dir string) *Log {
+	t.Helper()
+	// 每个 segment 只能容纳少量记录
+	l, err := Open(dir, WithSegmentSize(256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func appendTerms(t *testing.T, l *Log, terms ...uint64) {
+	t.Helper()
+	for _, term := range terms {
+		if _, err := l.AppendEntry(raft.LogEntry{Term: term, Command: raft.Command("command")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func expectLast(t *testing.T, l *Log, index, term uint64) {
+	t.Helper()
+	gotIndex, gotTerm, err := l.Last()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotIndex != index || gotTerm != term {
+		t.Errorf("expect last (%d, %d) but got (%d, %d)", index, term, gotIndex, gotTerm)
+	}
+}
+
+func expectTerms(t *testing.T, l *Log, terms map[uint64]uint64) {
+	t.Helper()
+	for index, term := range terms {
+		got, err := l.Get(index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != term {
+			t.Errorf("Get(%d), expect %d but got %d", index, term, got)
+		}
+	}
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestLog(t *testing.T) {
+	dir := t.TempDir()
+	l := openTestLog(t, dir)
+	defer func() { l.Close() }()
+
+	t.Run("empty log", func(t *testing.T) {
+		expectLast(t, l, 0, 0)
+		expectTerms(t, l, map[uint64]uint64{0: 0, 1: 0})
+		entries, err := l.RangeGet(0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entries != nil {
+			t.Errorf("expect nil but got %v", entries)
+		}
+	})
+
+	t.Run("append across segments", func(t *testing.T) {
+		appendTerms(t, l, 1, 1, 1, 2, 2, 2, 2, 3, 3, 3)
+		expectLast(t, l, 10, 3)
+		expectTerms(t, l, map[uint64]uint64{1: 1, 4: 2, 10: 3, 11: 0})
+		if files := segmentFiles(t, dir); len(files) < 2 {
+			t.Errorf("expect multiple segments but got %v", files)
+		}
+
+		entries, err := l.RangeGet(2, 8)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 6 || entries[0].Index != 3 || entries[5].Index != 8 || string(entries[5].Command) != "command" {
+			t.Errorf("expect entries (2, 8] but got %+v", entries)
+		}
+		match, err := l.Match(8, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !match {
+			t.Error("expect match (8, 3)")
+		}
+	})
+
+	t.Run("append after", func(t *testing.T) {
+		err := l.AppendAfter(3, raft.LogEntry{Term: 4}, raft.LogEntry{Term: 4})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectLast(t, l, 5, 4)
+		expectTerms(t, l, map[uint64]uint64{3: 1, 4: 4, 5: 4, 6: 0})
+
+		err = l.AppendAfter(10, raft.LogEntry{Term: 4})
+		if !errors.Is(err, ErrAppendOutOfRange) {
+			t.Errorf("expect %v but got %v", ErrAppendOutOfRange, err)
+		}
+		appendTerms(t, l, 4, 4, 4, 4, 4)
+		expectLast(t, l, 10, 4)
+	})
+
+	t.Run("reopen", func(t *testing.T) {
+		if err := l.Close(); err != nil {
+			t.Fatal(err)
+		}
+		l = openTestLog(t, dir)
+		expectLast(t, l, 10, 4)
+		expectTerms(t, l, map[uint64]uint64{3: 1, 4: 4, 10: 4})
+	})
+
+	t.Run("compact", func(t *testing.T) {
+		before := len(segmentFiles(t, dir))
+		if err := l.Compact(7); err != nil {
+			t.Fatal(err)
+		}
+		if after := len(segmentFiles(t, dir)); after >= before {
+			t.Errorf("expect compacted segments removed, %d segments before but %d after", before, after)
+		}
+		first, err := l.FirstIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first != 8 {
+			t.Errorf("expect first index 8 but got %d", first)
+		}
+		expectTerms(t, l, map[uint64]uint64{6: 0, 7: 4, 8: 4})
+
+		err = l.Compact(20)
+		if !errors.Is(err, raft.ErrCompactBeyondLastIndex) {
+			t.Errorf("expect %v but got %v", raft.ErrCompactBeyondLastIndex, err)
+		}
+
+		if err := l.Close(); err != nil {
+			t.Fatal(err)
+		}
+		l = openTestLog(t, dir)
+		first, err = l.FirstIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first != 8 {
+			t.Errorf("expect first index 8 after reopen but got %d", first)
+		}
+		expectLast(t, l, 10, 4)
+	})
+
+	t.Run("truncate prefix", func(t *testing.T) {
+		// mismatched snapshot discards the whole log
+		if err := l.TruncatePrefix(15, 6); err != nil {
+			t.Fatal(err)
+		}
+		expectLast(t, l, 15, 6)
+		if files := segmentFiles(t, dir); len(files) != 0 {
+			t.Errorf("expect no segment but got %v", files)
+		}
+		appendTerms(t, l, 6)
+		expectLast(t, l, 16, 6)
+
+		if err := l.Close(); err != nil {
+			t.Fatal(err)
+		}
+		l = openTestLog(t, dir)
+		expectLast(t, l, 16, 6)
+		expectTerms(t, l, map[uint64]uint64{15: 6, 16: 6})
+	})
+}
+
+func TestRecovery(t *testing.T) {
+	t.Run("torn tail", func(t *testing.T) {
+		dir := t.TempDir()
+		l := openTestLog(t, dir)
+		appendTerms(t, l, 1, 1, 1, 1, 1, 1)
+		l.Close()
+
+		// 模拟断电: 最后一条记录只写入了一部分
+		files := segmentFiles(t, dir)
+		last := files[len(files)-1]
+		info, err := os.Stat(last)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Truncate(last, info.Size()-3); err != nil {
+			t.Fatal(err)
+		}
+
+		l = openTestLog(t, dir)
+		defer l.Close()
+		expectLast(t, l, 5, 1)
+		appendTerms(t, l, 2)
+		expectLast(t, l, 6, 2)
+	})
+
+	t.Run("corrupted tail", func(t *testing.T) {
+		dir := t.TempDir()
+		l := openTestLog(t, dir)
+		appendTerms(t, l, 1, 1, 1, 1, 1, 1)
+		l.Close()
+
+		files := segmentFiles(t, dir)
+		last := files[len(files)-1]
+		b, err := os.ReadFile(last)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b[len(b)-2] ^= 0xff
+		if err := os.WriteFile(last, b, 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		l = openTestLog(t, dir)
+		defer l.Close()
+		expectLast(t, l, 5, 1)
+	})
+
+	t.Run("corrupted segment", func(t *testing.T) {
+		dir := t.TempDir()
+		l := openTestLog(t, dir)
+		appendTerms(t, l, 1, 1, 1, 1, 1, 1)
+		l.Close()
+
+		files := segmentFiles(t, dir)
+		if len(files) < 2 {
+			t.Fatalf("expect multiple segments but got %v", files)
+		}
+		b, err := os.ReadFile(files[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		b[headerSize+1] ^= 0xff
+		if err := os.WriteFile(files[0], b, 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = Open(dir, WithSegmentSize(256))
+		if !errors.Is(err, ErrCorrupt) {
+			t.Errorf("expect %v but got %v", ErrCorrupt, err)
+		}
+	})
+}
+
+func TestCompactProfile(t *testing.T) {
+	command := raft.Command(strings.Repeat("compressible ", 64))
+	appendCommands := func(t *testing.T, l *Log, n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			if _, err := l.AppendEntry(raft.LogEntry{Term: 1, Command: command}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	size := func(t *testing.T, dir string) int64 {
+		t.Helper()
+		var total int64
+		for _, file := range segmentFiles(t, dir) {
+			info, err := os.Stat(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			total += info.Size()
+		}
+		return total
+	}
+
+	t.Run("compression", func(t *testing.T) {
+		plainDir, compactDir := t.TempDir(), t.TempDir()
+		plain, err := Open(plainDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer plain.Close()
+		appendCommands(t, plain, 8)
+
+		compact, err := Open(compactDir, WithCompactProfile())
+		if err != nil {
+			t.Fatal(err)
+		}
+		appendCommands(t, compact, 8)
+		if plainSize, compactSize := size(t, plainDir), size(t, compactDir); compactSize >= plainSize {
+			t.Errorf("expect compressed wal smaller than %d bytes but got %d", plainSize, compactSize)
+		}
+		if err := compact.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// compressed and plain records are mixed after compression is turned off
+		reopened, err := Open(compactDir, WithCompression(false), WithCacheSize(0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reopened.Close()
+		appendCommands(t, reopened, 2)
+		entries, err := reopened.RangeGet(0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 10 {
+			t.Fatalf("expect 10 entries but got %d", len(entries))
+		}
+		for _, entry := range entries {
+			if string(entry.Command) != string(command) {
+				t.Fatalf("expect command restored but got %q at %d", entry.Command, entry.Index)
+			}
+		}
+	})
+
+	t.Run("cache", func(t *testing.T) {
+		l, err := Open(t.TempDir(), WithCacheSize(2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		appendTerms(t, l, 1, 1, 1)
+		if n := len(l.cache.entries); n != 2 || l.cache.entries[0].Index != 2 {
+			t.Fatalf("expect entries 2, 3 cached but got %+v", l.cache.entries)
+		}
+
+		// truncated entries aren't served from the cache
+		if err := l.AppendAfter(2, raft.LogEntry{Term: 2, Command: raft.Command("new")}); err != nil {
+			t.Fatal(err)
+		}
+		entries, err := l.RangeGet(1, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2 || entries[1].Term != 2 || string(entries[1].Command) != "new" {
+			t.Fatalf("expect entry 3 replaced but got %+v", entries)
+		}
+	})
+}